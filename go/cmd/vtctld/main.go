@@ -52,6 +52,9 @@ func main() {
 	// Start schema manager service.
 	initSchema()
 
+	// Start recording the topology changes.
+	initTopoBackup()
+
 	// And run the server.
 	servenv.RunDefault()
 }
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topobackup"
+)
+
+var (
+	topoBackupDir              = flag.String("topo_backup_dir", "", "directory of the backup storage to record the changes of the global topology server to, for point in time restores with RestoreTopology. Only one vtctld should record to a directory. Disabled if empty.")
+	topoBackupFlushInterval    = flag.Duration("topo_backup_flush_interval", 10*time.Second, "how often the recorded changes of the global topology server are written to the backup storage")
+	topoBackupSnapshotInterval = flag.Duration("topo_backup_snapshot_interval", time.Hour, "how often a snapshot of the global topology server is written to the backup storage")
+)
+
+func initTopoBackup() {
+	// Start recording the topology changes if needed.
+	if *topoBackupDir == "" {
+		return
+	}
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		log.Fatalf("unable to get the backup storage for the topology backup: %v", err)
+	}
+	conn, err := ts.ConnForCell(context.Background(), topo.GlobalCell)
+	if err != nil {
+		log.Fatalf("unable to get the global topology connection for the topology backup: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	recorder := topobackup.NewRecorder(bs, *topoBackupDir, *topoBackupFlushInterval, *topoBackupSnapshotInterval)
+	go func() {
+		defer close(done)
+		recorder.Run(ctx, conn)
+	}()
+	servenv.OnClose(func() {
+		cancel()
+		<-done
+		bs.Close()
+	})
+}
@@ -35,6 +35,7 @@ import (
 	"vitess.io/vitess/go/vt/servenv"
 	"vitess.io/vitess/go/vt/srvtopo"
 	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/cellregistrar"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vtgate"
 
@@ -119,6 +120,9 @@ func main() {
 
 	ts := topo.Open()
 	defer ts.Close()
+	if registrar := cellregistrar.Init(ts); registrar != nil {
+		servenv.OnClose(registrar.Stop)
+	}
 
 	resilientServer = srvtopo.NewResilientServer(ts, "ResilientSrvTopoServer")
 
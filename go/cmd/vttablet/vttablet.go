@@ -35,6 +35,7 @@ import (
 	"vitess.io/vitess/go/vt/tableacl"
 	"vitess.io/vitess/go/vt/tableacl/simpleacl"
 	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/cellregistrar"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vttablet/onlineddl"
 	"vitess.io/vitess/go/vt/vttablet/tabletmanager"
@@ -79,6 +80,7 @@ func main() {
 	config, mycnf := initConfig(tabletAlias)
 
 	ts := topo.Open()
+	registrar := cellregistrar.Init(ts)
 	qsc := createTabletServer(config, ts, tabletAlias)
 
 	mysqld := mysqlctl.NewMysqld(config.DB)
@@ -116,8 +118,11 @@ func main() {
 		// Close the tm so that our topo entry gets pruned properly and any
 		// background goroutines that use the topo connection are stopped.
 		tm.Close()
+		if registrar != nil {
+			registrar.Stop()
+		}
 
-		// tm uses ts. So, it should be closed after tm.
+		// tm and the registrar use ts. So, it should be closed after them.
 		ts.Close()
 	})
 
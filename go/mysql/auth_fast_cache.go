@@ -0,0 +1,487 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/pools"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var (
+	fastAuthCacheMemcacheAddress string
+	fastAuthCacheMemcachePrefix  string
+	fastAuthCachePoolSize        int
+	fastAuthCacheTimeout         time.Duration
+	fastAuthCacheKeyFile         string
+	fastAuthCacheMaxTTL          time.Duration
+)
+
+func init() {
+	servenv.OnParseFor("vtgate", func(fs *pflag.FlagSet) {
+		fs.StringVar(&fastAuthCacheMemcacheAddress, "mysql_fast_auth_cache_memcache_address", "", "address of a memcache server that caches the caching_sha2_password fast authentications, shared by the vtgates. Only used by the auth servers that support caching_sha2_password on top of a plain text password check, e.g. ldap. Disabled if empty.")
+		fs.StringVar(&fastAuthCacheMemcachePrefix, "mysql_fast_auth_cache_memcache_prefix", "vtgate_fast_auth_", "prefix of the keys of the fast authentication cache in memcache")
+		fs.IntVar(&fastAuthCachePoolSize, "mysql_fast_auth_cache_pool_size", 4, "maximum number of connections to the memcache server of the fast authentication cache")
+		fs.DurationVar(&fastAuthCacheTimeout, "mysql_fast_auth_cache_timeout", time.Second, "timeout of the requests to the memcache server of the fast authentication cache")
+		fs.StringVar(&fastAuthCacheKeyFile, "mysql_fast_auth_cache_key_file", "", "file holding the secret HMAC key that signs the entries of the fast authentication cache. Must be the same for all the vtgates sharing the cache.")
+		fs.DurationVar(&fastAuthCacheMaxTTL, "mysql_fast_auth_cache_max_ttl", time.Hour, "how long a fast authentication cache entry can be used after the full authentication that created it")
+	})
+}
+
+// FastAuthCacheEntry is what a FastAuthCache stores for a user: the
+// SHA256(SHA256(password)) hash used by the caching_sha2_password fast
+// authentication path, the caller ID the full authentication returned
+// for that user, when that full authentication happened, and the MAC
+// of all of this, so entries can't be forged by whoever can write to
+// the cache.
+type FastAuthCacheEntry struct {
+	Hash     []byte
+	CallerID *querypb.VTGateCallerID
+	Created  time.Time
+	MAC      []byte
+}
+
+// FastAuthCache is a store for FastAuthCacheEntry values. Implementations
+// can be backed by an external service, so multiple processes share the
+// same cache and a restarted process doesn't need a full authentication
+// for every client that reconnects.
+type FastAuthCache interface {
+	// Get returns the entry for key, or nil if there is none.
+	Get(key string) (*FastAuthCacheEntry, error)
+
+	// Set stores the entry for key.
+	Set(key string, entry *FastAuthCacheEntry) error
+}
+
+// FastAuthCachingStorage implements the two layers needed by
+// NewSha2CachingAuthMethod on top of a FastAuthCache and a
+// PlainTextStorage. Successful full authentications are added to the
+// cache, and the fast authentication path is answered from it.
+//
+// Errors from the cache are logged and treated as cache misses, so an
+// unavailable cache only costs full authentications.
+//
+// Entries are signed with an HMAC key that is not stored in the cache,
+// and entries with a wrong MAC are ignored. Entries older than maxTTL
+// are ignored too, so the client goes through a full authentication,
+// which checks the password against the storage again.
+type FastAuthCachingStorage struct {
+	cache   FastAuthCache
+	storage PlainTextStorage
+	key     []byte
+	maxTTL  time.Duration
+
+	// now returns the current time, tests can override it.
+	now func() time.Time
+}
+
+// NewFastAuthCachingStorage returns a new FastAuthCachingStorage. key is
+// the HMAC key used to sign the entries, it must be shared by all the
+// processes using the same cache, and kept secret from the cache. maxTTL
+// is how long an entry can be used after the full authentication that
+// created it.
+func NewFastAuthCachingStorage(cache FastAuthCache, storage PlainTextStorage, key []byte, maxTTL time.Duration) (*FastAuthCachingStorage, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("fast auth cache requires an HMAC key")
+	}
+	if maxTTL <= 0 {
+		return nil, fmt.Errorf("fast auth cache requires a positive max TTL, got %v", maxTTL)
+	}
+	return &FastAuthCachingStorage{
+		cache:   cache,
+		storage: storage,
+		key:     key,
+		maxTTL:  maxTTL,
+		now:     time.Now,
+	}, nil
+}
+
+// NewFastAuthCachingStorageFromFlags returns a FastAuthCachingStorage on
+// top of storage, using the fast authentication cache configured by the
+// mysql_fast_auth_cache flags. If no cache is configured, it sends all
+// the clients through a full authentication.
+func NewFastAuthCachingStorageFromFlags(storage PlainTextStorage) (*FastAuthCachingStorage, error) {
+	if fastAuthCacheMemcacheAddress == "" {
+		return &FastAuthCachingStorage{storage: storage, now: time.Now}, nil
+	}
+	if fastAuthCacheKeyFile == "" {
+		return nil, fmt.Errorf("mysql_fast_auth_cache_key_file is required with mysql_fast_auth_cache_memcache_address")
+	}
+	data, err := os.ReadFile(fastAuthCacheKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mysql_fast_auth_cache_key_file: %v", err)
+	}
+	if fastAuthCachePoolSize <= 0 {
+		return nil, fmt.Errorf("mysql_fast_auth_cache_pool_size must be positive, got %v", fastAuthCachePoolSize)
+	}
+	cache := NewMemcacheFastAuthCache(fastAuthCacheMemcacheAddress, fastAuthCacheMemcachePrefix, fastAuthCachePoolSize, fastAuthCacheMaxTTL, fastAuthCacheTimeout)
+	return NewFastAuthCachingStorage(cache, storage, bytes.TrimSpace(data), fastAuthCacheMaxTTL)
+}
+
+// UserEntryWithCacheHash is part of the CachingStorage interface.
+func (s *FastAuthCachingStorage) UserEntryWithCacheHash(conn *Conn, salt []byte, user string, authResponse []byte, remoteAddr net.Addr) (Getter, CacheState, error) {
+	if s.cache == nil || len(authResponse) != sha256.Size {
+		return nil, AuthNeedMoreData, nil
+	}
+	key := fastAuthCacheKey(user, remoteAddr)
+	entry, err := s.cache.Get(key)
+	if err != nil {
+		log.Warningf("Error reading fast auth cache for user %v: %v", user, err)
+		return nil, AuthNeedMoreData, nil
+	}
+	if entry == nil {
+		return nil, AuthNeedMoreData, nil
+	}
+	if mac, err := s.mac(key, entry); err != nil || !hmac.Equal(mac, entry.MAC) {
+		log.Warningf("Ignoring fast auth cache entry with an invalid MAC for user %v", user)
+		return nil, AuthNeedMoreData, nil
+	}
+	if age := s.now().Sub(entry.Created); age < 0 || age > s.maxTTL {
+		// Expired: a full authentication will check the password
+		// against the storage, and refresh the entry.
+		return nil, AuthNeedMoreData, nil
+	}
+	if !VerifyHashedCachingSha2Password(authResponse, salt, entry.Hash) {
+		return nil, AuthNeedMoreData, nil
+	}
+	return &fastAuthUserData{callerID: entry.CallerID}, AuthAccepted, nil
+}
+
+// UserEntryWithPassword is part of the PlainTextStorage interface.
+func (s *FastAuthCachingStorage) UserEntryWithPassword(conn *Conn, user string, password string, remoteAddr net.Addr) (Getter, error) {
+	getter, err := s.storage.UserEntryWithPassword(conn, user, password, remoteAddr)
+	if err != nil || s.cache == nil {
+		return getter, err
+	}
+
+	stage1 := sha256.Sum256([]byte(password))
+	hash := sha256.Sum256(stage1[:])
+	key := fastAuthCacheKey(user, remoteAddr)
+	entry := &FastAuthCacheEntry{
+		Hash:     hash[:],
+		CallerID: getter.Get(),
+		Created:  s.now(),
+	}
+	mac, err := s.mac(key, entry)
+	if err != nil {
+		log.Warningf("Error signing fast auth cache entry for user %v: %v", user, err)
+		return getter, nil
+	}
+	entry.MAC = mac
+	if err := s.cache.Set(key, entry); err != nil {
+		log.Warningf("Error writing fast auth cache for user %v: %v", user, err)
+	}
+	return getter, nil
+}
+
+// mac returns the MAC of entry for the cache key. The cache key is
+// part of it, so an entry can't be copied to another user or host.
+func (s *FastAuthCachingStorage) mac(key string, entry *FastAuthCacheEntry) ([]byte, error) {
+	callerID, err := proto.MarshalOptions{Deterministic: true}.Marshal(entry.CallerID)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, s.key)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(key)))
+	h.Write(buf[:])
+	h.Write([]byte(key))
+	binary.BigEndian.PutUint64(buf[:], uint64(entry.Created.UnixNano()))
+	h.Write(buf[:])
+	h.Write(entry.Hash)
+	h.Write(callerID)
+	return h.Sum(nil), nil
+}
+
+// fastAuthCacheKey returns the cache key for a user connecting from
+// remoteAddr. The client host is part of the key, since the full
+// authentication may depend on it.
+func fastAuthCacheKey(user string, remoteAddr net.Addr) string {
+	host := ""
+	if remoteAddr != nil {
+		host = remoteAddr.String()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	return user + "@" + host
+}
+
+// fastAuthUserData is the Getter returned for users authenticated
+// from the cache.
+type fastAuthUserData struct {
+	callerID *querypb.VTGateCallerID
+}
+
+// Get is part of the Getter interface.
+func (f *fastAuthUserData) Get() *querypb.VTGateCallerID {
+	if f.callerID == nil {
+		return &querypb.VTGateCallerID{}
+	}
+	return f.callerID
+}
+
+// MemcacheFastAuthCache is a FastAuthCache backed by a server speaking
+// the memcached text protocol. It keeps a small pool of connections to
+// the server, so concurrent authentications don't wait for each other.
+type MemcacheFastAuthCache struct {
+	address string
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+
+	pool *pools.ResourcePool[*memcacheConn]
+}
+
+// memcacheConn is a connection to the memcache server, with its
+// buffers. It implements pools.Resource.
+type memcacheConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// Close is part of the pools.Resource interface.
+func (c *memcacheConn) Close() {
+	c.conn.Close()
+}
+
+// NewMemcacheFastAuthCache returns a MemcacheFastAuthCache for the server
+// at address. Keys are prefixed with prefix, and at most poolSize
+// connections are opened to the server. Entries expire after ttl (or
+// never if ttl is zero), and each request must complete within timeout.
+func NewMemcacheFastAuthCache(address, prefix string, poolSize int, ttl, timeout time.Duration) *MemcacheFastAuthCache {
+	m := &MemcacheFastAuthCache{
+		address: address,
+		prefix:  prefix,
+		ttl:     ttl,
+		timeout: timeout,
+	}
+	m.pool = pools.NewTypedResourcePool(m.connect, poolSize, poolSize, 0, 0, 0, nil, nil, 0)
+	return m
+}
+
+// connect is the factory of the pool of connections.
+func (m *MemcacheFastAuthCache) connect(ctx context.Context) (*memcacheConn, error) {
+	dialer := net.Dialer{Timeout: m.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", m.address)
+	if err != nil {
+		return nil, err
+	}
+	return &memcacheConn{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+// Get is part of the FastAuthCache interface.
+func (m *MemcacheFastAuthCache) Get(key string) (*FastAuthCacheEntry, error) {
+	var value []byte
+	err := m.do(func(rw *bufio.ReadWriter) error {
+		key := m.key(key)
+		if _, err := fmt.Fprintf(rw, "get %s\r\n", key); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+
+		line, err := readMemcacheLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if line == "END" {
+			return nil
+		}
+		// VALUE <key> <flags> <bytes>
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[0] != "VALUE" || fields[1] != key {
+			return fmt.Errorf("unexpected memcache response: %q", line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return fmt.Errorf("unexpected memcache response: %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rw, buf); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(buf, []byte("\r\n")) {
+			return fmt.Errorf("malformed memcache value for key %v", key)
+		}
+		value = buf[:size]
+
+		line, err = readMemcacheLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if line != "END" {
+			return fmt.Errorf("unexpected memcache response: %q", line)
+		}
+		return nil
+	})
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return decodeFastAuthCacheEntry(value)
+}
+
+// Set is part of the FastAuthCache interface.
+func (m *MemcacheFastAuthCache) Set(key string, entry *FastAuthCacheEntry) error {
+	value, err := encodeFastAuthCacheEntry(entry)
+	if err != nil {
+		return err
+	}
+	return m.do(func(rw *bufio.ReadWriter) error {
+		if _, err := fmt.Fprintf(rw, "set %s 0 %d %d\r\n", m.key(key), int64(m.ttl/time.Second), len(value)); err != nil {
+			return err
+		}
+		if _, err := rw.Write(value); err != nil {
+			return err
+		}
+		if _, err := rw.WriteString("\r\n"); err != nil {
+			return err
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+
+		line, err := readMemcacheLine(rw.Reader)
+		if err != nil {
+			return err
+		}
+		if line != "STORED" {
+			return fmt.Errorf("unexpected memcache response: %q", line)
+		}
+		return nil
+	})
+}
+
+// Close closes the connections to the memcache server.
+func (m *MemcacheFastAuthCache) Close() {
+	m.pool.Close()
+}
+
+// key returns the memcache key for key. Memcache keys can't contain
+// whitespace or control characters, and are limited to 250 bytes, so
+// the user and host are hashed.
+func (m *MemcacheFastAuthCache) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return m.prefix + hex.EncodeToString(sum[:])
+}
+
+// do runs f on a connection to the memcache server from the pool,
+// connecting first if needed. The connection is closed if f fails,
+// since the protocol state is unknown at that point.
+func (m *MemcacheFastAuthCache) do(f func(rw *bufio.ReadWriter) error) error {
+	ctx := context.Background()
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	c, err := m.pool.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := c.conn.SetDeadline(deadline); err != nil {
+			c.Close()
+			m.pool.Put(nil)
+			return err
+		}
+	}
+	if err := f(c.rw); err != nil {
+		c.Close()
+		m.pool.Put(nil)
+		return err
+	}
+	m.pool.Put(c)
+	return nil
+}
+
+func readMemcacheLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if strings.HasPrefix(line, "ERROR") || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") {
+		return "", fmt.Errorf("memcache error: %v", line)
+	}
+	return line, nil
+}
+
+// fastAuthCacheEntryHeaderSize is the size of the fixed part of an
+// encoded FastAuthCacheEntry: the creation time, the hash and the MAC.
+const fastAuthCacheEntryHeaderSize = 8 + sha256.Size + sha256.Size
+
+// encodeFastAuthCacheEntry serializes entry as the creation time in
+// nanoseconds, the hash and the MAC, followed by the marshaled caller
+// ID.
+func encodeFastAuthCacheEntry(entry *FastAuthCacheEntry) ([]byte, error) {
+	if len(entry.Hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid fast auth hash length: %v", len(entry.Hash))
+	}
+	if len(entry.MAC) != sha256.Size {
+		return nil, fmt.Errorf("invalid fast auth MAC length: %v", len(entry.MAC))
+	}
+	callerID, err := proto.MarshalOptions{Deterministic: true}.Marshal(entry.CallerID)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 8, fastAuthCacheEntryHeaderSize+len(callerID))
+	binary.BigEndian.PutUint64(value, uint64(entry.Created.UnixNano()))
+	value = append(value, entry.Hash...)
+	value = append(value, entry.MAC...)
+	return append(value, callerID...), nil
+}
+
+func decodeFastAuthCacheEntry(value []byte) (*FastAuthCacheEntry, error) {
+	if len(value) < fastAuthCacheEntryHeaderSize {
+		return nil, fmt.Errorf("invalid fast auth cache entry length: %v", len(value))
+	}
+	entry := &FastAuthCacheEntry{
+		Created:  time.Unix(0, int64(binary.BigEndian.Uint64(value))),
+		Hash:     value[8 : 8+sha256.Size],
+		MAC:      value[8+sha256.Size : fastAuthCacheEntryHeaderSize],
+		CallerID: &querypb.VTGateCallerID{},
+	}
+	if err := proto.Unmarshal(value[fastAuthCacheEntryHeaderSize:], entry.CallerID); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
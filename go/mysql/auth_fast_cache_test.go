@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMemcache is a minimal memcache server supporting get and set.
+type fakeMemcache struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newFakeMemcache(t *testing.T) *fakeMemcache {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	m := &fakeMemcache{
+		listener: listener,
+		values:   make(map[string][]byte),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	return m
+}
+
+func (m *fakeMemcache) serve(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "get":
+			m.mu.Lock()
+			value, ok := m.values[fields[1]]
+			m.mu.Unlock()
+			if ok {
+				rw.WriteString("VALUE " + fields[1] + " 0 " + strconv.Itoa(len(value)) + "\r\n")
+				rw.Write(value)
+				rw.WriteString("\r\n")
+			}
+			rw.WriteString("END\r\n")
+		case len(fields) == 5 && fields[0] == "set":
+			size, _ := strconv.Atoi(fields[4])
+			value := make([]byte, size+2)
+			if _, err := io.ReadFull(rw, value); err != nil {
+				return
+			}
+			m.mu.Lock()
+			m.values[fields[1]] = value[:size]
+			m.mu.Unlock()
+			rw.WriteString("STORED\r\n")
+		default:
+			rw.WriteString("ERROR\r\n")
+		}
+		rw.Flush()
+	}
+}
+
+func TestFastAuthCachingStorage(t *testing.T) {
+	server := newFakeMemcache(t)
+	defer server.listener.Close()
+
+	jsonConfig := `{"mysql_user": [{"Password": "password", "UserData": "user.name", "Groups": ["user_group"]}]}`
+	auth := NewAuthServerStatic("", jsonConfig, 0)
+	defer auth.close()
+	addr := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	cache1 := NewMemcacheFastAuthCache(server.listener.Addr().String(), "vt_", 2, time.Minute, time.Second)
+	defer cache1.Close()
+	storage1, err := NewFastAuthCachingStorage(cache1, auth, []byte("secret"), time.Hour)
+	require.NoError(t, err)
+
+	salt, err := newSalt()
+	require.NoError(t, err)
+	scrambled := ScrambleCachingSha2Password(salt, []byte("password"))
+
+	// Nothing cached yet, full auth is needed.
+	_, state, err := storage1.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+
+	// A failed full auth doesn't populate the cache.
+	_, err = storage1.UserEntryWithPassword(nil, "mysql_user", "wrong", addr)
+	require.Error(t, err)
+	assert.Empty(t, server.values)
+
+	getter, err := storage1.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "user.name", getter.Get().Username)
+	assert.Len(t, server.values, 1)
+
+	// Another process sharing the cache can now use the fast path.
+	cache2 := NewMemcacheFastAuthCache(server.listener.Addr().String(), "vt_", 2, time.Minute, time.Second)
+	defer cache2.Close()
+	storage2, err := NewFastAuthCachingStorage(cache2, auth, []byte("secret"), time.Hour)
+	require.NoError(t, err)
+
+	getter, state, err = storage2.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthAccepted, state)
+	assert.Equal(t, "user.name", getter.Get().Username)
+	assert.Equal(t, []string{"user_group"}, getter.Get().Groups)
+
+	// A wrong password or another host need a full auth.
+	_, state, err = storage2.UserEntryWithCacheHash(nil, salt, "mysql_user", ScrambleCachingSha2Password(salt, []byte("wrong")), addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+	_, state, err = storage2.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, &net.IPAddr{IP: net.ParseIP("127.0.0.2")})
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+
+	// If the cache goes away, full auth is still possible.
+	server.listener.Close()
+	cache3 := NewMemcacheFastAuthCache(server.listener.Addr().String(), "vt_", 2, time.Minute, time.Second)
+	storage3, err := NewFastAuthCachingStorage(cache3, auth, []byte("secret"), time.Hour)
+	require.NoError(t, err)
+	_, state, err = storage3.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+	getter, err = storage3.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "user.name", getter.Get().Username)
+}
+
+func TestFastAuthCachingStorageEntryChecks(t *testing.T) {
+	server := newFakeMemcache(t)
+	defer server.listener.Close()
+
+	jsonConfig := `{"mysql_user": [{"Password": "password", "UserData": "user.name"}]}`
+	auth := NewAuthServerStatic("", jsonConfig, 0)
+	defer auth.close()
+	addr := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	_, err := NewFastAuthCachingStorage(nil, auth, nil, time.Hour)
+	assert.Error(t, err)
+	_, err = NewFastAuthCachingStorage(nil, auth, []byte("secret"), 0)
+	assert.Error(t, err)
+
+	cache := NewMemcacheFastAuthCache(server.listener.Addr().String(), "vt_", 2, time.Minute, time.Second)
+	defer cache.Close()
+	storage, err := NewFastAuthCachingStorage(cache, auth, []byte("secret"), time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+	storage.now = func() time.Time { return now }
+
+	salt, err := newSalt()
+	require.NoError(t, err)
+	scrambled := ScrambleCachingSha2Password(salt, []byte("password"))
+	_, err = storage.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	_, state, err := storage.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthAccepted, state)
+
+	// Entries signed with another key are ignored.
+	otherStorage, err := NewFastAuthCachingStorage(cache, auth, []byte("other"), time.Hour)
+	require.NoError(t, err)
+	_, state, err = otherStorage.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+
+	// Entries modified in the cache are ignored.
+	key := fastAuthCacheKey("mysql_user", addr)
+	entry, err := cache.Get(key)
+	require.NoError(t, err)
+	entry.CallerID.Username = "admin"
+	require.NoError(t, cache.Set(key, entry))
+	_, state, err = storage.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+
+	// Entries copied from another user are ignored.
+	_, err = storage.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	entry, err = cache.Get(key)
+	require.NoError(t, err)
+	require.NoError(t, cache.Set(fastAuthCacheKey("other_user", addr), entry))
+	_, state, err = storage.UserEntryWithCacheHash(nil, salt, "other_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+
+	// Expired entries need a full auth, which refreshes them.
+	now = now.Add(2 * time.Hour)
+	_, state, err = storage.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+	_, err = storage.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	getter, state, err := storage.UserEntryWithCacheHash(nil, salt, "mysql_user", scrambled, addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthAccepted, state)
+	assert.Equal(t, "user.name", getter.Get().Username)
+}
+
+func TestFastAuthCacheKey(t *testing.T) {
+	assert.Equal(t, "user@127.0.0.1", fastAuthCacheKey("user", &net.IPAddr{IP: net.ParseIP("127.0.0.1")}))
+	assert.Equal(t, "user@127.0.0.1", fastAuthCacheKey("user", &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 3306}))
+	assert.Equal(t, "user@", fastAuthCacheKey("user", nil))
+}
+
+func TestMemcacheFastAuthCacheConcurrent(t *testing.T) {
+	server := newFakeMemcache(t)
+	defer server.listener.Close()
+
+	cache := NewMemcacheFastAuthCache(server.listener.Addr().String(), "vt_", 2, time.Minute, time.Second)
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "user" + strconv.Itoa(i) + "@"
+			entry := &FastAuthCacheEntry{
+				Hash:    make([]byte, 32),
+				Created: time.Unix(int64(i), 0),
+				MAC:     make([]byte, 32),
+			}
+			assert.NoError(t, cache.Set(key, entry))
+			got, err := cache.Get(key)
+			if assert.NoError(t, err) && assert.NotNil(t, got) {
+				assert.Equal(t, entry.Created, got.Created)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, server.values, 10)
+}
+
+func TestNewFastAuthCachingStorageFromFlags(t *testing.T) {
+	jsonConfig := `{"mysql_user": [{"Password": "password", "UserData": "user.name"}]}`
+	auth := NewAuthServerStatic("", jsonConfig, 0)
+	defer auth.close()
+	addr := &net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+
+	// Without a cache, all the clients need a full auth.
+	storage, err := NewFastAuthCachingStorageFromFlags(auth)
+	require.NoError(t, err)
+	salt, err := newSalt()
+	require.NoError(t, err)
+	_, state, err := storage.UserEntryWithCacheHash(nil, salt, "mysql_user", ScrambleCachingSha2Password(salt, []byte("password")), addr)
+	require.NoError(t, err)
+	assert.Equal(t, AuthNeedMoreData, state)
+	getter, err := storage.UserEntryWithPassword(nil, "mysql_user", "password", addr)
+	require.NoError(t, err)
+	assert.Equal(t, "user.name", getter.Get().Username)
+
+	// A cache needs a key.
+	defer func() { fastAuthCacheMemcacheAddress = "" }()
+	fastAuthCacheMemcacheAddress = "localhost:11211"
+	_, err = NewFastAuthCachingStorageFromFlags(auth)
+	assert.Error(t, err)
+}
@@ -595,9 +595,17 @@ func GetAuthServer(name string) AuthServer {
 
 func newSalt() ([]byte, error) {
 	salt := make([]byte, 20)
-	if _, err := rand.Read(salt); err != nil {
+	if err := fillSalt(salt); err != nil {
 		return nil, err
 	}
+	return salt, nil
+}
+
+// fillSalt fills salt with random data that is a legal UTF8 string.
+func fillSalt(salt []byte) error {
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
 
 	// Salt must be a legal UTF8 string.
 	for i := 0; i < len(salt); i++ {
@@ -607,7 +615,7 @@ func newSalt() ([]byte, error) {
 		}
 	}
 
-	return salt, nil
+	return nil
 }
 
 func negotiateAuthMethod(conn *Conn, as AuthServer, user string, requestedAuth AuthMethodDescription) (AuthMethod, error) {
@@ -29,6 +29,7 @@ import (
 
 	"github.com/spf13/pflag"
 
+	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/servenv"
 	"vitess.io/vitess/go/vt/vterrors"
@@ -87,6 +88,84 @@ type AuthServerStaticEntry struct {
 	UserData            string
 	SourceHost          string
 	Groups              []string
+
+	// PreviousPasswords and PreviousMysqlNativePasswords are secrets
+	// that are still accepted in addition to Password and
+	// MysqlNativePassword. They allow to rotate a password without
+	// downtime: the new password is added as the current one, and the
+	// old one is removed from the previous ones once all the clients
+	// use the new one, as shown by the MysqlServerStaticAuthMatches
+	// counter.
+	PreviousPasswords            []string
+	PreviousMysqlNativePasswords []string
+}
+
+// Secrets reported in the MysqlServerStaticAuthMatches counter.
+const (
+	staticSecretCurrent  = "Current"
+	staticSecretPrevious = "Previous"
+)
+
+var staticAuthMatches = stats.NewCountersWithMultiLabels("MysqlServerStaticAuthMatches", "Successful authentications with the static auth server, by user and by secret that matched", []string{"User", "Secret"})
+
+// recordStaticAuthMatch counts a successful authentication of user.
+// previous tells if it used one of the previous secrets of the entry.
+func recordStaticAuthMatch(user string, previous bool) {
+	secret := staticSecretCurrent
+	if previous {
+		secret = staticSecretPrevious
+	}
+	staticAuthMatches.Add([]string{user, secret}, 1)
+}
+
+// matchPassword returns if match accepts one of the plain text
+// passwords of the entry, and if that is a previous one.
+func (entry *AuthServerStaticEntry) matchPassword(match func(password []byte) bool) (ok, previous bool) {
+	if match([]byte(entry.Password)) {
+		return true, false
+	}
+	for _, password := range entry.PreviousPasswords {
+		if match([]byte(password)) {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// matchMysqlNativePassword returns if authResponse was computed from
+// salt and one of the secrets of the entry, and if that is a previous
+// one. The current secret is MysqlNativePassword if it is set, and
+// Password otherwise.
+func (entry *AuthServerStaticEntry) matchMysqlNativePassword(salt, authResponse []byte) (ok, previous bool, err error) {
+	matchHash := func(hexHash string) (bool, error) {
+		hash, err := DecodeMysqlNativePasswordHex(hexHash)
+		if err != nil {
+			return false, err
+		}
+		return VerifyHashedMysqlNativePassword(authResponse, salt, hash), nil
+	}
+	matchPassword := func(password []byte) bool {
+		return subtle.ConstantTimeCompare(authResponse, ScrambleMysqlNativePassword(salt, password)) == 1
+	}
+
+	if entry.MysqlNativePassword != "" {
+		if ok, err := matchHash(entry.MysqlNativePassword); ok || err != nil {
+			return ok, false, err
+		}
+	} else if matchPassword([]byte(entry.Password)) {
+		return true, false, nil
+	}
+	for _, hexHash := range entry.PreviousMysqlNativePasswords {
+		if ok, err := matchHash(hexHash); ok || err != nil {
+			return ok, true, err
+		}
+	}
+	for _, password := range entry.PreviousPasswords {
+		if matchPassword([]byte(password)) {
+			return true, true, nil
+		}
+	}
+	return false, false, nil
 }
 
 // InitAuthServerStatic Handles initializing the AuthServerStatic if necessary.
@@ -181,8 +260,14 @@ func (a *AuthServerStatic) UserEntryWithPassword(conn *Conn, user string, passwo
 	}
 
 	for _, entry := range entries {
+		if !MatchSourceHost(remoteAddr, entry.SourceHost) {
+			continue
+		}
 		// Validate the password.
-		if MatchSourceHost(remoteAddr, entry.SourceHost) && subtle.ConstantTimeCompare([]byte(password), []byte(entry.Password)) == 1 {
+		if ok, previous := entry.matchPassword(func(entryPassword []byte) bool {
+			return subtle.ConstantTimeCompare([]byte(password), entryPassword) == 1
+		}); ok {
+			recordStaticAuthMatch(user, previous)
 			return &StaticUserData{entry.UserData, entry.Groups}, nil
 		}
 	}
@@ -201,22 +286,13 @@ func (a *AuthServerStatic) UserEntryWithHash(conn *Conn, salt []byte, user strin
 	}
 
 	for _, entry := range entries {
-		if entry.MysqlNativePassword != "" {
-			hash, err := DecodeMysqlNativePasswordHex(entry.MysqlNativePassword)
-			if err != nil {
-				return &StaticUserData{entry.UserData, entry.Groups}, NewSQLError(ERAccessDeniedError, SSAccessDeniedError, "Access denied for user '%v'", user)
-			}
-
-			isPass := VerifyHashedMysqlNativePassword(authResponse, salt, hash)
-			if MatchSourceHost(remoteAddr, entry.SourceHost) && isPass {
-				return &StaticUserData{entry.UserData, entry.Groups}, nil
-			}
-		} else {
-			computedAuthResponse := ScrambleMysqlNativePassword(salt, []byte(entry.Password))
-			// Validate the password.
-			if MatchSourceHost(remoteAddr, entry.SourceHost) && subtle.ConstantTimeCompare(authResponse, computedAuthResponse) == 1 {
-				return &StaticUserData{entry.UserData, entry.Groups}, nil
-			}
+		ok, previous, err := entry.matchMysqlNativePassword(salt, authResponse)
+		if err != nil {
+			return &StaticUserData{entry.UserData, entry.Groups}, NewSQLError(ERAccessDeniedError, SSAccessDeniedError, "Access denied for user '%v'", user)
+		}
+		if ok && MatchSourceHost(remoteAddr, entry.SourceHost) {
+			recordStaticAuthMatch(user, previous)
+			return &StaticUserData{entry.UserData, entry.Groups}, nil
 		}
 	}
 	return &StaticUserData{}, NewSQLError(ERAccessDeniedError, SSAccessDeniedError, "Access denied for user '%v'", user)
@@ -234,10 +310,14 @@ func (a *AuthServerStatic) UserEntryWithCacheHash(conn *Conn, salt []byte, user
 	}
 
 	for _, entry := range entries {
-		computedAuthResponse := ScrambleCachingSha2Password(salt, []byte(entry.Password))
-
+		if !MatchSourceHost(remoteAddr, entry.SourceHost) {
+			continue
+		}
 		// Validate the password.
-		if MatchSourceHost(remoteAddr, entry.SourceHost) && subtle.ConstantTimeCompare(authResponse, computedAuthResponse) == 1 {
+		if ok, previous := entry.matchPassword(func(password []byte) bool {
+			return subtle.ConstantTimeCompare(authResponse, ScrambleCachingSha2Password(salt, password)) == 1
+		}); ok {
+			recordStaticAuthMatch(user, previous)
 			return &StaticUserData{entry.UserData, entry.Groups}, AuthAccepted, nil
 		}
 	}
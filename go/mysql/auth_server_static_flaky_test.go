@@ -286,3 +286,80 @@ func TestStaticPasswords(t *testing.T) {
 		})
 	}
 }
+
+func TestStaticPreviousPasswords(t *testing.T) {
+	jsonConfig := `
+{
+	"user01": [{ "Password": "new", "PreviousPasswords": ["old1", "old2"] }],
+	"user02": [{
+		"MysqlNativePassword": "*B3AD996B12F211BEA47A7C666CC136FB26DC96AF",
+		"PreviousMysqlNativePasswords": ["*211E0153B172BAED4352D5E4628BD76731AF83E7"],
+		"PreviousPasswords": ["old"]
+	}]
+}`
+
+	tests := []struct {
+		user     string
+		password string
+		success  bool
+		previous bool
+	}{
+		{"user01", "new", true, false},
+		{"user01", "old1", true, true},
+		{"user01", "old2", true, true},
+		{"user01", "other", false, false},
+		{"user02", "user02", true, false},
+		{"user02", "user03", true, true},
+		{"user02", "old", true, true},
+		{"user02", "other", false, false},
+	}
+
+	auth := NewAuthServerStatic("", jsonConfig, 0)
+	defer auth.close()
+	ip := net.ParseIP("127.0.0.1")
+	addr := &net.IPAddr{IP: ip, Zone: ""}
+
+	for _, c := range tests {
+		t.Run(fmt.Sprintf("%s-%s", c.user, c.password), func(t *testing.T) {
+			salt, err := newSalt()
+			if err != nil {
+				t.Fatalf("error generating salt: %v", err)
+			}
+
+			counts := staticAuthMatches.Counts()
+			current := counts[c.user+"."+staticSecretCurrent]
+			previous := counts[c.user+"."+staticSecretPrevious]
+
+			scrambled := ScrambleMysqlNativePassword(salt, []byte(c.password))
+			_, err = auth.UserEntryWithHash(nil, salt, c.user, scrambled, addr)
+			if c.success != (err == nil) {
+				t.Fatalf("UserEntryWithHash: got error %v, want success %v", err, c.success)
+			}
+
+			// The plain text passwords are also accepted by the other methods.
+			if c.user == "user01" {
+				_, err = auth.UserEntryWithPassword(nil, c.user, c.password, addr)
+				if c.success != (err == nil) {
+					t.Fatalf("UserEntryWithPassword: got error %v, want success %v", err, c.success)
+				}
+				_, state, _ := auth.UserEntryWithCacheHash(nil, salt, c.user, ScrambleCachingSha2Password(salt, []byte(c.password)), addr)
+				if c.success != (state == AuthAccepted) {
+					t.Fatalf("UserEntryWithCacheHash: got state %v, want success %v", state, c.success)
+				}
+			}
+
+			counts = staticAuthMatches.Counts()
+			current = counts[c.user+"."+staticSecretCurrent] - current
+			previous = counts[c.user+"."+staticSecretPrevious] - previous
+			if c.success && c.previous && (current != 0 || previous == 0) {
+				t.Fatalf("expected only previous secret matches, got %v current and %v previous", current, previous)
+			}
+			if c.success && !c.previous && (current == 0 || previous != 0) {
+				t.Fatalf("expected only current secret matches, got %v current and %v previous", current, previous)
+			}
+			if !c.success && (current != 0 || previous != 0) {
+				t.Fatalf("expected no match, got %v current and %v previous", current, previous)
+			}
+		})
+	}
+}
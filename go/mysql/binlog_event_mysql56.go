@@ -48,7 +48,7 @@ func (ev mysql56BinlogEvent) IsSemiSyncAckRequested() bool {
 
 // IsGTID implements BinlogEvent.IsGTID().
 func (ev mysql56BinlogEvent) IsGTID() bool {
-	return ev.Type() == eGTIDEvent
+	return ev.Type() == eGTIDEvent || ev.Type() == eGTIDTaggedEvent
 }
 
 // GTID implements BinlogEvent.GTID().
@@ -58,14 +58,104 @@ func (ev mysql56BinlogEvent) IsGTID() bool {
 //   1         flags
 //   16        SID (server UUID)
 //   8         GNO (sequence number, signed int)
+//
+// Tagged GTID events use another format, see taggedGTID.
 func (ev mysql56BinlogEvent) GTID(f BinlogFormat) (GTID, bool, error) {
 	data := ev.Bytes()[f.HeaderLength:]
+	if ev.Type() == eGTIDTaggedEvent {
+		gtid, err := taggedGTID(data)
+		return gtid, false /* hasBegin */, err
+	}
 	var sid SID
 	copy(sid[:], data[1:1+16])
 	gno := int64(binary.LittleEndian.Uint64(data[1+16 : 1+16+8]))
 	return Mysql56GTID{Server: sid, Sequence: gno}, false /* hasBegin */, nil
 }
 
+// The fields of a tagged GTID event that we read, see
+// Gtid_event::define_fields() in control_events.h.
+const (
+	taggedGTIDFieldFlags = 0
+	taggedGTIDFieldSID   = 1
+	taggedGTIDFieldGNO   = 2
+	taggedGTIDFieldTag   = 3
+)
+
+// taggedGTID returns the GTID of a MySQL 8.3 tagged GTID event.
+//
+// The event is a message of the MySQL 8.0 binary serialization library:
+// its size, the id of its last non-ignorable field, and then each field
+// id followed by its value, in order of field id. Integers use the
+// variable-length format, see varLenIntSize. The fields we need come
+// first:
+//   id   field
+//   0    flags (unsigned int)
+//   1    SID (16 bytes)
+//   2    GNO (signed int)
+//   3    tag (length as unsigned int, followed by the bytes)
+// The other fields (commit timestamps, transaction length...) are not
+// read.
+func taggedGTID(data []byte) (Mysql56GTID, error) {
+	var gtid Mysql56GTID
+	pos := 0
+	var ok bool
+	// Skip the message size and the last non-ignorable field id.
+	for i := 0; i < 2; i++ {
+		if _, pos, ok = readVarLenInt(data, pos); !ok {
+			return gtid, vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid tagged GTID event header: %v", data)
+		}
+	}
+
+	var hasSID, hasGNO bool
+	for pos < len(data) {
+		var id uint64
+		if id, pos, ok = readVarLenInt(data, pos); !ok || id > taggedGTIDFieldTag {
+			// Done with the fields we need.
+			break
+		}
+		switch id {
+		case taggedGTIDFieldFlags:
+			_, pos, ok = readVarLenInt(data, pos)
+		case taggedGTIDFieldSID:
+			var sid []byte
+			if sid, pos, ok = readBytes(data, pos, len(gtid.Server)); ok {
+				copy(gtid.Server[:], sid)
+				hasSID = true
+			}
+		case taggedGTIDFieldGNO:
+			gtid.Sequence, pos, ok = readVarLenSignedInt(data, pos)
+			hasGNO = ok
+		case taggedGTIDFieldTag:
+			var length uint64
+			var tag []byte
+			length, pos, ok = readVarLenInt(data, pos)
+			switch {
+			case !ok:
+			case length > 32:
+				ok = false
+			case length > 0:
+				if tag, pos, ok = readBytes(data, pos, int(length)); ok {
+					gtid.Tag = string(tag)
+				}
+			}
+		}
+		if !ok {
+			return gtid, vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid field %v in tagged GTID event: %v", id, data)
+		}
+	}
+	if !hasSID || !hasGNO {
+		return gtid, vterrors.Errorf(vtrpc.Code_INTERNAL, "missing SID or GNO in tagged GTID event: %v", data)
+	}
+	if gtid.Tag != "" {
+		tag, err := parseGTIDTag(gtid.Tag)
+		if err != nil {
+			return gtid, err
+		}
+		gtid.Tag = tag
+	}
+	return gtid, nil
+}
+
 // PreviousGTIDs implements BinlogEvent.PreviousGTIDs().
 func (ev mysql56BinlogEvent) PreviousGTIDs(f BinlogFormat) (Position, error) {
 	data := ev.Bytes()[f.HeaderLength:]
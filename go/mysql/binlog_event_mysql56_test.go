@@ -98,6 +98,49 @@ func TestMysql56GTID(t *testing.T) {
 	}
 }
 
+func TestMysql56TaggedGTID(t *testing.T) {
+	format := BinlogFormat{HeaderLength: 19}
+	header := []byte{0x0, 0x0, 0x0, 0x0, eGTIDTaggedEvent, 0x64, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+	body := []byte{
+		// message size, last non-ignorable field id
+		0x54, 0x0a,
+		// flags: 1
+		0x00, 0x02,
+		// SID
+		0x02, 0x43, 0x91, 0x92, 0xbd, 0xf3, 0x7c, 0x11, 0xe4, 0xbb, 0xeb, 0x2, 0x42, 0xac, 0x11, 0x3, 0x5a,
+		// GNO: 4
+		0x04, 0x10,
+		// tag: "Foo"
+		0x06, 0x06, 'F', 'o', 'o',
+		// last_committed: 0, not read
+		0x08, 0x00,
+	}
+	input := NewMysql56BinlogEvent(append(header, body...))
+	if !input.IsGTID() {
+		t.Fatalf("IsGTID() = false, want true")
+	}
+
+	want, _ := parseMysql56GTID("439192bd-f37c-11e4-bbeb-0242ac11035a:foo:4")
+	got, hasBegin, err := input.GTID(format)
+	if err != nil {
+		t.Fatalf("GTID() error: %v", err)
+	}
+	if hasBegin {
+		t.Errorf("GTID() returned hasBegin")
+	}
+	if got != want {
+		t.Errorf("GTID() = %#v, want %#v", got, want)
+	}
+
+	// Truncated events are rejected.
+	for _, n := range []int{1, 4, 20, 25} {
+		input := NewMysql56BinlogEvent(append(header, body[:n]...))
+		if _, _, err := input.GTID(format); err == nil {
+			t.Errorf("GTID() of event truncated to %v bytes returned no error", n)
+		}
+	}
+}
+
 func TestMysql56ParseGTID(t *testing.T) {
 	input := "00010203-0405-0607-0809-0A0B0C0D0E0F:56789"
 	want := Mysql56GTID{
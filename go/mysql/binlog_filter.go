@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"strings"
+
+	"vitess.io/vitess/go/stats"
+)
+
+var binlogFilterSkippedEvents = stats.NewCounter("BinlogFilterSkippedEvents", "Binlog events skipped by the filter of the binlog dump client")
+
+// BinlogFilter selects the databases and tables of the binlog events
+// returned by Conn.ReadBinlogEvent, similar to the replicate-do-db and
+// replicate-do-table options of MySQL replicas.
+//
+// The COM_BINLOG_DUMP commands have no way to ask the server to filter
+// the stream, so the filter is applied locally. It only parses the
+// headers of the events, and the TABLE_MAP_EVENTs that name the tables,
+// so the row events of the other tables are skipped without decoding
+// them.
+//
+// The TABLE_MAP_EVENTs and row events of the other tables are skipped,
+// as well as the QUERY_EVENTs that were run with another default
+// database, like replicate-do-db does for statement-based replication.
+// The QUERY_EVENTs run in the databases of Tables are kept.
+// The events that delimit the transactions (GTID, BEGIN, COMMIT, XID),
+// and the other events, are always returned, so positions can still be
+// tracked.
+type BinlogFilter struct {
+	// Databases are the databases to keep. Names are compared case
+	// insensitively.
+	Databases []string
+	// Tables are the tables to keep, as "database.table".
+	Tables []string
+}
+
+// binlogFilter is the state of a BinlogFilter on a binlog stream.
+type binlogFilter struct {
+	databases map[string]bool
+	tables    map[string]bool
+	// tableDatabases are the databases of tables.
+	tableDatabases map[string]bool
+
+	format BinlogFormat
+	// tableIDs tells if the tables found in the TABLE_MAP_EVENTs are kept.
+	tableIDs map[uint64]bool
+}
+
+func newBinlogFilter(filter *BinlogFilter) *binlogFilter {
+	f := &binlogFilter{
+		databases:      make(map[string]bool, len(filter.Databases)),
+		tables:         make(map[string]bool, len(filter.Tables)),
+		tableDatabases: make(map[string]bool, len(filter.Tables)),
+		tableIDs:       make(map[uint64]bool),
+	}
+	for _, db := range filter.Databases {
+		f.databases[strings.ToLower(db)] = true
+	}
+	for _, table := range filter.Tables {
+		table = strings.ToLower(table)
+		f.tables[table] = true
+		if i := strings.IndexByte(table, '.'); i >= 0 {
+			f.tableDatabases[table[:i]] = true
+		}
+	}
+	return f
+}
+
+// SetBinlogFilter sets the filter of the events returned by
+// ReadBinlogEvent. A nil filter returns all the events.
+func (c *Conn) SetBinlogFilter(filter *BinlogFilter) {
+	if filter == nil {
+		c.binlogFilter = nil
+		return
+	}
+	c.binlogFilter = newBinlogFilter(filter)
+}
+
+// keepTable returns true if the events of the table are kept.
+func (f *binlogFilter) keepTable(database, table string) bool {
+	database = strings.ToLower(database)
+	return f.databases[database] || f.tables[database+"."+strings.ToLower(table)]
+}
+
+// keep returns true if the event must be returned.
+func (f *binlogFilter) keep(ev BinlogEvent) (bool, error) {
+	if !ev.IsValid() || ev.IsSemiSyncAckRequested() {
+		// Let the caller deal with invalid events, and never skip the
+		// events the source waits an ack for.
+		return true, nil
+	}
+	switch {
+	case ev.IsFormatDescription():
+		format, err := ev.Format()
+		if err != nil {
+			return false, err
+		}
+		f.format = format
+		return true, nil
+	case ev.IsRotate():
+		// Table IDs are only valid within a binary log.
+		f.tableIDs = make(map[uint64]bool)
+		return true, nil
+	case f.format.IsZero():
+		return true, nil
+	case ev.IsTableMap():
+		ev, _, err := ev.StripChecksum(f.format)
+		if err != nil {
+			return false, err
+		}
+		tm, err := ev.TableMap(f.format)
+		if err != nil {
+			return false, err
+		}
+		keep := f.keepTable(tm.Database, tm.Name)
+		f.tableIDs[ev.TableID(f.format)] = keep
+		return keep, nil
+	case ev.IsWriteRows(), ev.IsUpdateRows(), ev.IsDeleteRows():
+		keep, ok := f.tableIDs[ev.TableID(f.format)]
+		// Keep the events of the tables we didn't see the map of.
+		return keep || !ok, nil
+	case ev.IsQuery():
+		ev, _, err := ev.StripChecksum(f.format)
+		if err != nil {
+			return false, err
+		}
+		q, err := ev.Query(f.format)
+		if err != nil {
+			return false, err
+		}
+		if isTransactionControl(q.SQL) {
+			return true, nil
+		}
+		// The statements can't be matched to tables without parsing
+		// them, so the statements of the databases of the tables are
+		// kept too.
+		database := strings.ToLower(q.Database)
+		return f.databases[database] || f.tableDatabases[database], nil
+	default:
+		return true, nil
+	}
+}
+
+// isTransactionControl returns true if the statement of a QUERY_EVENT
+// starts or ends a transaction.
+func isTransactionControl(sql string) bool {
+	sql = strings.TrimLeft(sql, " \t\r\n")
+	if len(sql) > len("ROLLBACK") {
+		sql = sql[:len("ROLLBACK")]
+	}
+	sql = strings.ToUpper(sql)
+	if sql == "BEGIN" || sql == "COMMIT" || sql == "ROLLBACK" {
+		return true
+	}
+	return strings.HasPrefix(sql, "XA ")
+}
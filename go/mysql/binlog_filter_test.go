@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinlogFilter(t *testing.T) {
+	f := NewMySQL56BinlogFormat()
+	s := NewFakeBinlogStream()
+
+	tableMap := func(tableID uint64, database, table string) BinlogEvent {
+		tm := &TableMap{
+			Database:  database,
+			Name:      table,
+			Types:     []byte{TypeLong},
+			CanBeNull: NewServerBitmap(1),
+			Metadata:  []uint16{0},
+		}
+		return NewTableMapEvent(f, s, tableID, tm)
+	}
+	writeRows := func(tableID uint64) BinlogEvent {
+		return NewWriteRowsEvent(f, s, tableID, Rows{
+			IdentifyColumns: NewServerBitmap(1),
+			DataColumns:     NewServerBitmap(1),
+			Rows: []Row{{
+				NullColumns: NewServerBitmap(1),
+				Data:        []byte{0x01, 0x00, 0x00, 0x00},
+			}},
+		})
+	}
+	query := func(database, sql string) BinlogEvent {
+		return NewQueryEvent(f, s, Query{Database: database, SQL: sql})
+	}
+
+	events := []struct {
+		name  string
+		event BinlogEvent
+		keep  bool
+	}{
+		{"format description", NewFormatDescriptionEvent(f, s), true},
+		{"begin", query("other_db", "BEGIN"), true},
+		{"table map of kept database", tableMap(1, "My_DB", "t1"), true},
+		{"rows of kept database", writeRows(1), true},
+		{"table map of kept table", tableMap(2, "tables_db", "T2"), true},
+		{"rows of kept table", writeRows(2), true},
+		{"table map of other table", tableMap(3, "tables_db", "t3"), false},
+		{"rows of other table", writeRows(3), false},
+		{"table map of other database", tableMap(4, "other_db", "t1"), false},
+		{"rows of other database", writeRows(4), false},
+		{"rows of unknown table", writeRows(5), true},
+		{"xid", NewXIDEvent(f, s), true},
+		{"query of kept database", query("my_db", "create table t5(id int)"), true},
+		{"query of database of kept table", query("tables_db", "alter table t2 add column c int"), true},
+		{"query of other database", query("other_db", "create table t5(id int)"), false},
+		{"commit", query("other_db", "COMMIT"), true},
+		{"xa commit", query("other_db", "XA COMMIT 'xid'"), true},
+		// Table IDs are reset by the rotation.
+		{"rotate", NewRotateEvent(f, s, 4, "binlog.000002"), true},
+		{"rows of forgotten table", writeRows(3), true},
+	}
+
+	filter := newBinlogFilter(&BinlogFilter{
+		Databases: []string{"my_db"},
+		Tables:    []string{"tables_db.t2"},
+	})
+	for _, e := range events {
+		keep, err := filter.keep(e.event)
+		require.NoError(t, err, e.name)
+		assert.Equal(t, e.keep, keep, e.name)
+	}
+}
+
+func TestSetBinlogFilter(t *testing.T) {
+	c := &Conn{}
+	c.SetBinlogFilter(&BinlogFilter{Databases: []string{"my_db"}})
+	require.NotNil(t, c.binlogFilter)
+	assert.True(t, c.binlogFilter.keepTable("MY_DB", "t1"))
+	c.SetBinlogFilter(nil)
+	assert.Nil(t, c.binlogFilter)
+}
+
+func TestIsTransactionControl(t *testing.T) {
+	for sql, want := range map[string]bool{
+		"BEGIN":                  true,
+		"begin":                  true,
+		" COMMIT":                true,
+		"ROLLBACK":               true,
+		"XA START 'xid'":         true,
+		"COMMITTED":              false,
+		"insert into t values()": false,
+		"":                       false,
+	} {
+		assert.Equal(t, want, isTransactionControl(sql), sql)
+	}
+}
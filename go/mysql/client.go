@@ -24,6 +24,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"vitess.io/vitess/go/mysql/collations"
@@ -46,12 +47,62 @@ type connectResult struct {
 //
 // FIXME(alainjobart) once we have more of a server side, add test cases
 // to cover all failure scenarios.
+//
+// If params has Endpoints, they are tried in turn until a connection
+// is established. See connectEndpoints. If params.Host starts with
+// "srv://", the rest of it is the name of DNS SRV records giving the
+// endpoints to use. See connectSRV.
 func Connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 	if params.ConnectTimeoutMs != 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(params.ConnectTimeoutMs)*time.Millisecond)
 		defer cancel()
 	}
+	if strings.HasPrefix(params.Host, srvScheme) && params.UnixSocket == "" {
+		return connectSRV(ctx, params)
+	}
+	if params.Endpoints != "" && params.UnixSocket == "" {
+		return connectEndpoints(ctx, params)
+	}
+	return connect(ctx, params)
+}
+
+// connectEndpoints connects to the first reachable endpoint of params.
+// It moves on to the next endpoint on connection errors, if the server
+// has too many connections, or if the attempt takes longer than
+// EndpointTimeoutMs. Other errors, like authentication failures, are
+// returned right away.
+func connectEndpoints(ctx context.Context, params *ConnParams) (*Conn, error) {
+	endpoints, err := params.endpointParams()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, endpoint := range endpoints {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if params.EndpointTimeoutMs != 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(params.EndpointTimeoutMs)*time.Millisecond)
+		}
+		c, err := connect(attemptCtx, endpoint)
+		cancel()
+		if err == nil {
+			return c, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != context.DeadlineExceeded && !IsConnErr(err) && !IsTooManyConnectionsErr(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// connect creates a connection to the server at params.Host and
+// params.Port, or params.UnixSocket, and handles the initial handshake.
+func connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 	netProto := "tcp"
 	addr := ""
 	if params.UnixSocket != "" {
@@ -68,6 +119,7 @@ func Connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 	// - a connectResult with an error and nothing else (when dial fails).
 	// - a connectResult with a *Conn and no error, then another one
 	//   with possibly an error.
+	connectTrace := ConnectTraceFromContext(ctx)
 	status := make(chan connectResult)
 	go func() {
 		defer close(status)
@@ -82,12 +134,15 @@ func Connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 		// Done() before timing out the Dial. That way we'll
 		// return the right error to the client (ctx.Err(), vs
 		// DialTimeout() error).
+		connectTrace.dialStart(netProto, addr)
+		dialStart := time.Now()
 		if deadline, ok := ctx.Deadline(); ok {
 			timeout := time.Until(deadline) + 5*time.Second
 			conn, err = net.DialTimeout(netProto, addr, timeout)
 		} else {
 			conn, err = net.Dial(netProto, addr)
 		}
+		connectTrace.dialDone(netProto, addr, dialStart, err)
 		if err != nil {
 			// If we get an error, the connection to a Unix socket
 			// should return a 2002, but for a TCP socket it
@@ -115,7 +170,7 @@ func Connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 		// make any read or write just return with an error
 		// right away.
 		status <- connectResult{
-			err: c.clientHandshake(params),
+			err: c.clientHandshake(params, connectTrace),
 		}
 	}()
 
@@ -173,7 +228,7 @@ func Connect(ctx context.Context, params *ConnParams) (*Conn, error) {
 // Ping implements mysql ping command.
 func (c *Conn) Ping() error {
 	// This is a new command, need to reset the sequence.
-	c.sequence = 0
+	c.resetSequence()
 	data, pos := c.startEphemeralPacketWithHeader(1)
 	data[pos] = ComPing
 
@@ -197,7 +252,7 @@ func (c *Conn) Ping() error {
 // clientHandshake handles the client side of the handshake.
 // Note the connection can be closed while this is running.
 // Returns a SQLError.
-func (c *Conn) clientHandshake(params *ConnParams) error {
+func (c *Conn) clientHandshake(params *ConnParams, connectTrace *ConnectTrace) error {
 	// if EnableQueryInfo is set, make sure that all queries starting with the handshake
 	// will actually process the INFO fields in QUERY_OK packets
 	if params.EnableQueryInfo {
@@ -273,18 +328,31 @@ func (c *Conn) clientHandshake(params *ConnParams) error {
 			return err
 		}
 
-		// Switch to SSL.
+		// Switch to SSL. The TLS handshake is done right away so it can
+		// be traced. If it fails, the write of the handshake response
+		// returns the same error below.
 		conn := tls.Client(c.conn, clientConfig)
+		connectTrace.tlsStart(serverName)
+		tlsStart := time.Now()
+		err = conn.Handshake()
+		connectTrace.tlsDone(serverName, tlsStart, err)
 		c.conn = conn
 		c.bufferedReader.Reset(conn)
 		c.Capabilities |= CapabilityClientSSL
 	}
 
 	// Password encryption.
+	c.authPluginName, err = handshakeAuthPlugin(c.authPluginName, params)
+	if err != nil {
+		return err
+	}
 	var scrambledPassword []byte
-	if c.authPluginName == CachingSha2Password {
+	switch c.authPluginName {
+	case CachingSha2Password:
 		scrambledPassword = ScrambleCachingSha2Password(salt, []byte(params.Pass))
-	} else {
+	case MysqlClearPassword:
+		// No data, the server asks for the password if it wants it.
+	default:
 		scrambledPassword = ScrambleMysqlNativePassword(salt, []byte(params.Pass))
 	}
 
@@ -299,16 +367,31 @@ func (c *Conn) clientHandshake(params *ConnParams) error {
 		return NewSQLError(CRSSLConnectionError, SSUnknownSQLState, "server doesn't support ClientSessionTrack but client asked for it")
 	}
 
+	// Compression. Like the 'mysql' client, fall back to the
+	// uncompressed protocol if the server doesn't support the codec.
+	if params.Compression != "" {
+		codec, err := GetCompressionCodec(params.Compression)
+		if err != nil {
+			return NewSQLError(CRUnknownError, SSUnknownSQLState, "%v", err)
+		}
+		if capabilities&codec.Capability() != 0 {
+			c.compression = codec
+		}
+	}
+
 	// Build and send our handshake response 41.
 	// Note this one will never have SSL flag on.
-	if err := c.writeHandshakeResponse41(capabilities, scrambledPassword, charset, params); err != nil {
-		return err
+	authStart := time.Now()
+	err = c.writeHandshakeResponse41(capabilities, scrambledPassword, charset, params)
+	if err == nil {
+		// Read the server response.
+		err = c.handleAuthResponse(params)
 	}
-
-	// Read the server response.
-	if err := c.handleAuthResponse(params); err != nil {
+	connectTrace.authDone(params.Uname, authStart, err)
+	if err != nil {
 		return err
 	}
+	c.enableCompression()
 
 	// If the server didn't support DbName in its handshake, set
 	// it now. This is what the 'mysql' client does.
@@ -542,6 +625,9 @@ func (c *Conn) writeHandshakeResponse41(capabilities uint32, scrambledPassword [
 		// If the server supported
 		// CapabilityClientSessionTrack, we also support it.
 		c.Capabilities&CapabilityClientSessionTrack
+	if c.compression != nil {
+		capabilityFlags |= c.compression.Capability()
+	}
 
 	// FIXME(alainjobart) add multi statement.
 
@@ -646,6 +732,25 @@ func (c *Conn) handleAuthResponse(params *ConnParams) error {
 	return nil
 }
 
+// handshakeAuthPlugin returns the auth plugin of the handshake response.
+// It is the default plugin of the server, unless it is not in the
+// allowed plugins, in which case it is the first supported plugin of
+// the allowed ones.
+// Returns a SQLError.
+func handshakeAuthPlugin(serverDefault AuthMethodDescription, params *ConnParams) (AuthMethodDescription, error) {
+	allowed := params.allowedAuthPlugins()
+	if allowed == nil || params.authPluginAllowed(serverDefault) {
+		return serverDefault, nil
+	}
+	for _, plugin := range allowed {
+		switch plugin {
+		case CachingSha2Password, MysqlNativePassword, MysqlClearPassword:
+			return plugin, nil
+		}
+	}
+	return "", NewSQLError(CRAuthPluginCannotLoad, SSUnknownSQLState, "none of the allowed auth plugins is supported: %v", params.AllowedAuthPlugins)
+}
+
 // handleAuthSwitchPacket scrambles password for the plugin requested by the server and retries authentication
 func (c *Conn) handleAuthSwitchPacket(params *ConnParams, response []byte) error {
 	var err error
@@ -657,6 +762,9 @@ func (c *Conn) handleAuthSwitchPacket(params *ConnParams, response []byte) error
 	if salt != nil {
 		c.salt = salt
 	}
+	if !params.authPluginAllowed(c.authPluginName) {
+		return NewSQLError(CRAuthPluginCannotLoad, SSUnknownSQLState, "server asked for auth method %v, which is not in the allowed auth plugins: %v", c.authPluginName, params.AllowedAuthPlugins)
+	}
 	switch c.authPluginName {
 	case MysqlClearPassword:
 		if err := c.writeClearTextPassword(params); err != nil {
@@ -672,8 +780,10 @@ func (c *Conn) handleAuthSwitchPacket(params *ConnParams, response []byte) error
 		if err := c.writeScrambledPassword(scrambledPassword); err != nil {
 			return err
 		}
+	case MysqlOldPassword:
+		return NewSQLError(CRAuthPluginCannotLoad, SSUnknownSQLState, "server asked for the pre-4.1 auth method %v, which is not supported: the password of the user must be rehashed", c.authPluginName)
 	default:
-		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "server asked for unsupported auth method: %v", c.authPluginName)
+		return NewSQLError(CRAuthPluginCannotLoad, SSUnknownSQLState, "server asked for unsupported auth method: %v", c.authPluginName)
 	}
 
 	// The response could be an OKPacket, AuthMoreDataPacket or ErrPacket
@@ -720,6 +830,11 @@ func (c *Conn) handleAuthMoreDataPacket(data byte, params *ConnParams) error {
 }
 
 func parseAuthSwitchRequest(data []byte) (AuthMethodDescription, []byte, error) {
+	// A request without payload is the old auth switch request of the
+	// servers that ask for mysql_old_password, with the initial salt.
+	if len(data) == 1 {
+		return MysqlOldPassword, nil, nil
+	}
 	pos := 1
 	pluginName, pos, ok := readNullString(data, pos)
 	if !ok {
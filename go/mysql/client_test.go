@@ -32,6 +32,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/vt/tlstest"
 	"vitess.io/vitess/go/vt/vttls"
 )
@@ -134,6 +135,172 @@ func TestConnectTimeout(t *testing.T) {
 	assertSQLError(t, err, CRConnectionError, SSUnknownSQLState, "connection refused", "", "net\\.Dial\\(([a-z0-9A-Z_\\/]*)\\) to local server failed:")
 }
 
+// TestConnectEndpoints checks Connect fails over to the next endpoint
+// when one is not reachable.
+func TestConnectEndpoints(t *testing.T) {
+	th := &testHandler{}
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{{
+		Password: "password1",
+	}}
+	defer authServer.close()
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, th, 0, 0, false)
+	require.NoError(t, err)
+	defer l.Close()
+	go l.Accept()
+	good := l.Addr().String()
+
+	// This one listens but never accepts, so the handshake hangs.
+	hanging, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer hanging.Close()
+
+	// This one refuses connections.
+	closed, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	refused := closed.Addr().String()
+	closed.Close()
+
+	params := &ConnParams{
+		Endpoints:         strings.Join([]string{refused, hanging.Addr().String(), good}, ","),
+		EndpointTimeoutMs: 100,
+		Uname:             "user1",
+		Pass:              "password1",
+	}
+	conn, err := Connect(context.Background(), params)
+	require.NoError(t, err)
+	conn.Close()
+
+	// Authentication errors are not retried on the other endpoints.
+	badPass := *params
+	badPass.Endpoints = good + "," + refused
+	badPass.Pass = "bad"
+	_, err = Connect(context.Background(), &badPass)
+	assertSQLError(t, err, ERAccessDeniedError, SSAccessDeniedError, "Access denied", "", "")
+
+	// If no endpoint works, the last error is returned.
+	unreachable := *params
+	unreachable.Endpoints = hanging.Addr().String() + "," + refused
+	_, err = Connect(context.Background(), &unreachable)
+	assertSQLError(t, err, CRConnHostError, SSUnknownSQLState, "connection refused", "", "")
+
+	// The overall timeout still applies.
+	unreachable.Endpoints = hanging.Addr().String() + "," + hanging.Addr().String()
+	unreachable.ConnectTimeoutMs = 150
+	_, err = Connect(context.Background(), &unreachable)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	invalid := *params
+	invalid.Endpoints = "localhost"
+	_, err = Connect(context.Background(), &invalid)
+	assertSQLError(t, err, CRUnknownHost, SSUnknownSQLState, "invalid endpoint", "", "")
+}
+
+func TestConnectTrace(t *testing.T) {
+	th := &testHandler{}
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{{
+		Password: "password1",
+	}}
+	defer authServer.close()
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, th, 0, 0, false)
+	require.NoError(t, err)
+	defer l.Close()
+	go l.Accept()
+
+	var phases []string
+	connectTrace := &ConnectTrace{
+		DialStart: func(network, addr string) {
+			phases = append(phases, "DialStart "+network+" "+addr)
+		},
+		DialDone: func(network, addr string, duration time.Duration, err error) {
+			phases = append(phases, fmt.Sprintf("DialDone %v", err == nil))
+		},
+		TLSStart: func(serverName string) {
+			phases = append(phases, "TLSStart")
+		},
+		AuthDone: func(user string, duration time.Duration, err error) {
+			phases = append(phases, fmt.Sprintf("AuthDone %v %v", user, err == nil))
+		},
+	}
+	ctx := WithConnectTrace(context.Background(), connectTrace)
+	assert.Equal(t, connectTrace, ConnectTraceFromContext(ctx))
+	assert.Nil(t, ConnectTraceFromContext(context.Background()))
+
+	params := &ConnParams{
+		Host:  "127.0.0.1",
+		Port:  l.Addr().(*net.TCPAddr).Port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+	conn, err := Connect(ctx, params)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{
+		"DialStart tcp " + l.Addr().String(),
+		"DialDone true",
+		"AuthDone user1 true",
+	}, phases)
+
+	// Failures are reported to the hooks, and to the stats.
+	timings := stats.NewTimings("TestConnectTraceTimings", "", "phase")
+	errors := stats.NewCountersWithSingleLabel("TestConnectTraceErrors", "", "phase")
+	ctx = WithConnectTrace(context.Background(), NewStatsConnectTrace(timings, errors))
+
+	badPass := *params
+	badPass.Pass = "bad"
+	_, err = Connect(ctx, &badPass)
+	require.Error(t, err)
+	assert.Equal(t, map[string]int64{"All": 2, "Dial": 1, "Auth": 1}, timings.Counts())
+	assert.Equal(t, map[string]int64{"Auth": 1}, errors.Counts())
+
+	closed, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	refused := *params
+	refused.Port = closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	_, err = Connect(ctx, &refused)
+	require.Error(t, err)
+	assert.Equal(t, map[string]int64{"All": 3, "Dial": 2, "Auth": 1}, timings.Counts())
+	assert.Equal(t, map[string]int64{"Dial": 1, "Auth": 1}, errors.Counts())
+}
+
+func TestEndpointParams(t *testing.T) {
+	params := &ConnParams{
+		Endpoints: "host1:3306, [::1]:3307,host3:3308",
+		Uname:     "user1",
+	}
+	endpoints, err := params.endpointParams()
+	require.NoError(t, err)
+	var got []string
+	for _, endpoint := range endpoints {
+		assert.Empty(t, endpoint.Endpoints)
+		assert.Equal(t, "user1", endpoint.Uname)
+		got = append(got, fmt.Sprintf("%v/%v", endpoint.Host, endpoint.Port))
+	}
+	assert.Equal(t, []string{"host1/3306", "::1/3307", "host3/3308"}, got)
+
+	params.EndpointPolicy = EndpointPolicyRandom
+	endpoints, err = params.endpointParams()
+	require.NoError(t, err)
+	got = nil
+	for _, endpoint := range endpoints {
+		got = append(got, fmt.Sprintf("%v/%v", endpoint.Host, endpoint.Port))
+	}
+	assert.ElementsMatch(t, []string{"host1/3306", "::1/3307", "host3/3308"}, got)
+
+	params.EndpointPolicy = "unknown"
+	_, err = params.endpointParams()
+	assert.Error(t, err)
+
+	params.Endpoints = " , "
+	params.EndpointPolicy = ""
+	_, err = params.endpointParams()
+	assert.Error(t, err)
+}
+
 // TestTLSClientDisabled creates a Server with TLS support, then connects
 // with a client with TLS disabled.
 func TestTLSClientDisabled(t *testing.T) {
@@ -266,8 +433,17 @@ func TestTLSClientPreferredDefault(t *testing.T) {
 		ServerName: "server.example.com",
 	}
 
-	conn, err := Connect(context.Background(), params)
+	var tlsServerName string
+	var tlsErr error
+	ctx := WithConnectTrace(context.Background(), &ConnectTrace{
+		TLSDone: func(serverName string, duration time.Duration, err error) {
+			tlsServerName, tlsErr = serverName, err
+		},
+	})
+	conn, err := Connect(ctx, params)
 	require.NoError(t, err)
+	assert.Equal(t, "server.example.com", tlsServerName)
+	assert.NoError(t, tlsErr)
 
 	// make sure this went through SSL
 	results, err := conn.ExecuteFetch("ssl echo", 1000, true)
@@ -499,3 +675,75 @@ func TestTLSClientVerifyIdentity(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Certificate revoked: CommonName=server.example.com")
 }
+
+// authSwitch runs the client handshake against a server that answers
+// the handshake response with the given auth switch request, and
+// returns the auth method of the handshake response and the error of
+// the client. A nil request expects the client to fail first.
+func authSwitch(t *testing.T, params *ConnParams, authSwitchRequest []byte) (AuthMethodDescription, error) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	clientErr := make(chan error, 1)
+	go func() {
+		clientErr <- cConn.clientHandshake(params, nil)
+	}()
+
+	authServer := NewAuthServerStatic("", "", 0)
+	defer authServer.close()
+	_, err := sConn.writeHandshakeV10("8.0.30", authServer, false)
+	require.NoError(t, err)
+	if authSwitchRequest == nil {
+		// The client gives up before writing its response.
+		return "", <-clientErr
+	}
+	response, err := sConn.readEphemeralPacketDirect()
+	require.NoError(t, err)
+	_, clientAuthMethod, _, err := (&Listener{}).parseClientHandshakePacket(sConn, true, response)
+	require.NoError(t, err)
+	sConn.recycleReadPacket()
+
+	data, pos := sConn.startEphemeralPacketWithHeader(len(authSwitchRequest))
+	copy(data[pos:], authSwitchRequest)
+	require.NoError(t, sConn.writeEphemeralPacket())
+	return clientAuthMethod, <-clientErr
+}
+
+func TestAuthPluginSwitch(t *testing.T) {
+	params := &ConnParams{Uname: "user1", Pass: "password1"}
+
+	// Servers with mysql_old_password accounts send an old auth switch
+	// request, with no payload.
+	method, err := authSwitch(t, params, []byte{AuthSwitchRequestPacket})
+	assert.Equal(t, MysqlNativePassword, method)
+	assertSQLError(t, err, CRAuthPluginCannotLoad, SSUnknownSQLState, "pre-4.1 auth method mysql_old_password", "", "")
+
+	_, err = authSwitch(t, params, append([]byte{AuthSwitchRequestPacket}, "sha256_password\x00salt"...))
+	assertSQLError(t, err, CRAuthPluginCannotLoad, SSUnknownSQLState, "unsupported auth method: sha256_password", "", "")
+
+	// The handshake response uses the first supported allowed plugin
+	// when the default of the server is not allowed.
+	params.AllowedAuthPlugins = "sha256_password, caching_sha2_password"
+	method, err = authSwitch(t, params, append([]byte{AuthSwitchRequestPacket}, "mysql_native_password\x00salt"...))
+	assert.Equal(t, CachingSha2Password, method)
+	assertSQLError(t, err, CRAuthPluginCannotLoad, SSUnknownSQLState, "auth method mysql_native_password, which is not in the allowed auth plugins", "", "")
+
+	params.AllowedAuthPlugins = "mysql_old_password"
+	_, err = authSwitch(t, params, nil)
+	assertSQLError(t, err, CRAuthPluginCannotLoad, SSUnknownSQLState, "none of the allowed auth plugins is supported", "", "")
+}
+
+func TestAllowedAuthPlugins(t *testing.T) {
+	params := &ConnParams{}
+	assert.Nil(t, params.allowedAuthPlugins())
+	assert.True(t, params.authPluginAllowed(MysqlClearPassword))
+
+	params.AllowedAuthPlugins = " caching_sha2_password,,mysql_native_password "
+	assert.Equal(t, []AuthMethodDescription{CachingSha2Password, MysqlNativePassword}, params.allowedAuthPlugins())
+	assert.True(t, params.authPluginAllowed(MysqlNativePassword))
+	assert.False(t, params.authPluginAllowed(MysqlClearPassword))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/trace"
+)
+
+// Connection phases reported by the ConnectTrace helpers.
+const (
+	connectPhaseDial = "Dial"
+	connectPhaseTLS  = "TLS"
+	connectPhaseAuth = "Auth"
+)
+
+// ConnectTrace is a set of hooks called by Connect while it establishes
+// a connection, so the time spent connecting can be broken down into
+// its phases. Any of the hooks can be nil.
+//
+// The hooks are called from the go routine doing the connection, not
+// the one calling Connect. With multiple endpoints, the hooks are called
+// for every attempt.
+type ConnectTrace struct {
+	// DialStart is called before dialing addr. The dial includes the
+	// resolution of the host name, if any.
+	DialStart func(network, addr string)
+
+	// DialDone is called when the dial of addr completes.
+	DialDone func(network, addr string, duration time.Duration, err error)
+
+	// TLSStart is called before the TLS handshake, if TLS is used.
+	TLSStart func(serverName string)
+
+	// TLSDone is called when the TLS handshake completes.
+	TLSDone func(serverName string, duration time.Duration, err error)
+
+	// AuthDone is called when the server accepted or rejected the
+	// credentials. The duration covers the exchange of the handshake
+	// response and the authentication packets.
+	AuthDone func(user string, duration time.Duration, err error)
+}
+
+type connectTraceKey struct{}
+
+// WithConnectTrace returns a context that makes Connect call the hooks
+// of connectTrace.
+func WithConnectTrace(ctx context.Context, connectTrace *ConnectTrace) context.Context {
+	return context.WithValue(ctx, connectTraceKey{}, connectTrace)
+}
+
+// ConnectTraceFromContext returns the ConnectTrace set with
+// WithConnectTrace, or nil.
+func ConnectTraceFromContext(ctx context.Context) *ConnectTrace {
+	connectTrace, _ := ctx.Value(connectTraceKey{}).(*ConnectTrace)
+	return connectTrace
+}
+
+// NewStatsConnectTrace returns a ConnectTrace that records the duration
+// of each phase in timings, and counts the failed phases in errors.
+// Both are labeled with the phase: "Dial", "TLS" or "Auth".
+func NewStatsConnectTrace(timings *stats.Timings, errors *stats.CountersWithSingleLabel) *ConnectTrace {
+	record := func(phase string, duration time.Duration, err error) {
+		timings.Add(phase, duration)
+		if err != nil {
+			errors.Add(phase, 1)
+		}
+	}
+	return &ConnectTrace{
+		DialDone: func(network, addr string, duration time.Duration, err error) {
+			record(connectPhaseDial, duration, err)
+		},
+		TLSDone: func(serverName string, duration time.Duration, err error) {
+			record(connectPhaseTLS, duration, err)
+		},
+		AuthDone: func(user string, duration time.Duration, err error) {
+			record(connectPhaseAuth, duration, err)
+		},
+	}
+}
+
+// NewSpanConnectTrace returns a ConnectTrace that annotates span with
+// the duration and the error, if any, of each phase.
+func NewSpanConnectTrace(span trace.Span) *ConnectTrace {
+	annotate := func(phase string, duration time.Duration, err error) {
+		span.Annotate(phase+"Duration", duration.String())
+		if err != nil {
+			span.Annotate(phase+"Error", err.Error())
+		}
+	}
+	return &ConnectTrace{
+		DialStart: func(network, addr string) {
+			span.Annotate("Addr", addr)
+		},
+		DialDone: func(network, addr string, duration time.Duration, err error) {
+			annotate(connectPhaseDial, duration, err)
+		},
+		TLSDone: func(serverName string, duration time.Duration, err error) {
+			annotate(connectPhaseTLS, duration, err)
+		},
+		AuthDone: func(user string, duration time.Duration, err error) {
+			annotate(connectPhaseAuth, duration, err)
+		},
+	}
+}
+
+// The following methods call the hooks, and are safe to use on a nil
+// ConnectTrace.
+
+func (ct *ConnectTrace) dialStart(network, addr string) {
+	if ct != nil && ct.DialStart != nil {
+		ct.DialStart(network, addr)
+	}
+}
+
+func (ct *ConnectTrace) dialDone(network, addr string, start time.Time, err error) {
+	if ct != nil && ct.DialDone != nil {
+		ct.DialDone(network, addr, time.Since(start), err)
+	}
+}
+
+func (ct *ConnectTrace) tlsStart(serverName string) {
+	if ct != nil && ct.TLSStart != nil {
+		ct.TLSStart(serverName)
+	}
+}
+
+func (ct *ConnectTrace) tlsDone(serverName string, start time.Time, err error) {
+	if ct != nil && ct.TLSDone != nil {
+		ct.TLSDone(serverName, time.Since(start), err)
+	}
+}
+
+func (ct *ConnectTrace) authDone(user string, start time.Time, err error) {
+	if ct != nil && ct.AuthDone != nil {
+		ct.AuthDone(user, time.Since(start), err)
+	}
+}
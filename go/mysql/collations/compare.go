@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collations
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Comparator compares strings the way MySQL does for the values of a
+// column with a given collation. It is meant for the code that sorts or
+// merges rows above the protocol layer, e.g. the results of several
+// shards, so the rows end up in the order MySQL would have returned
+// them, whichever collation the column uses.
+//
+// Unlike Collation.Collate, the comparisons of a Comparator implement
+// the PAD SPACE attribute of the collations: the shorter string is
+// compared as if it was padded with spaces, so "a" and "a " are equal.
+//
+// The strings must be encoded in the charset of the collation.
+type Comparator struct {
+	coll Collation
+	// space is the encoded space the strings are padded with, or nil
+	// if the collation is NO PAD.
+	space []byte
+}
+
+// NewComparator returns a Comparator for the given collation.
+func NewComparator(coll Collation) *Comparator {
+	coll.Init()
+	c := &Comparator{coll: coll}
+	if isPadSpace(coll) {
+		var buf [4]byte
+		if n := coll.Charset().EncodeRune(buf[:], ' '); n > 0 {
+			c.space = buf[:n]
+		}
+	}
+	return c
+}
+
+// Comparator returns the Comparator of the collation with the given ID,
+// or an error if the collation is not supported in this environment.
+func (env *Environment) Comparator(id ID) (*Comparator, error) {
+	coll := env.LookupByID(id)
+	if coll == nil {
+		return nil, fmt.Errorf("unsupported collation ID: %d", id)
+	}
+	return NewComparator(coll), nil
+}
+
+// ComparatorByName returns the Comparator of the collation with the
+// given name, e.g. "utf8mb4_0900_ai_ci", or an error if the collation
+// is not supported in this environment.
+func (env *Environment) ComparatorByName(name string) (*Comparator, error) {
+	coll := env.LookupByName(name)
+	if coll == nil {
+		return nil, fmt.Errorf("unsupported collation: %q", name)
+	}
+	return NewComparator(coll), nil
+}
+
+// isPadSpace returns true if the collation pads the strings it compares
+// with spaces. Only the UCA 9.0.0 collations of MySQL 8.0 and binary
+// are NO PAD.
+func isPadSpace(coll Collation) bool {
+	switch coll.(type) {
+	case *Collation_utf8mb4_uca_0900, *Collation_utf8mb4_0900_bin, *Collation_binary:
+		return false
+	default:
+		return true
+	}
+}
+
+// Collation returns the collation of the Comparator.
+func (c *Comparator) Collation() Collation {
+	return c.coll
+}
+
+// Compare returns <0 if left sorts before right, 0 if they are equal,
+// and >0 if left sorts after right.
+func (c *Comparator) Compare(left, right []byte) int {
+	if c.space != nil {
+		left, right = c.padToSameLength(left, right)
+	}
+	return c.coll.Collate(left, right, false)
+}
+
+// Equal returns true if left and right are equal for the collation,
+// e.g. "a" and "A" with a case insensitive collation.
+func (c *Comparator) Equal(left, right []byte) bool {
+	return c.Compare(left, right) == 0
+}
+
+// padToSameLength pads the shorter of left and right with spaces, so
+// they have the same number of codepoints.
+func (c *Comparator) padToSameLength(left, right []byte) ([]byte, []byte) {
+	leftLen, rightLen := c.length(left), c.length(right)
+	switch {
+	case leftLen < rightLen:
+		left = c.appendSpaces(left, rightLen-leftLen)
+	case rightLen < leftLen:
+		right = c.appendSpaces(right, leftLen-rightLen)
+	}
+	return left, right
+}
+
+// length returns the number of codepoints of s.
+func (c *Comparator) length(s []byte) int {
+	cs := c.coll.Charset()
+	n := 0
+	for len(s) > 0 {
+		_, size := cs.DecodeRune(s)
+		if size <= 0 {
+			size = 1
+		}
+		s = s[size:]
+		n++
+	}
+	return n
+}
+
+// appendSpaces returns a copy of s followed by n spaces.
+func (c *Comparator) appendSpaces(s []byte, n int) []byte {
+	padded := make([]byte, len(s), len(s)+n*len(c.space))
+	copy(padded, s)
+	for ; n > 0; n-- {
+		padded = append(padded, c.space...)
+	}
+	return padded
+}
+
+// WeightString appends the weight string of src to dst, like the
+// WEIGHT_STRING() function of MySQL for a VARCHAR value.
+//
+// The weight strings of PAD SPACE collations include the weights of the
+// trailing spaces, so they can't be compared byte-wise to sort values
+// that only differ by them. Use SortKey to build the keys of a sort.
+func (c *Comparator) WeightString(dst, src []byte) []byte {
+	return c.coll.WeightString(dst, src, 0)
+}
+
+// SortKey appends to dst a key for src, such that the byte-wise
+// comparison of the keys of two strings gives the same result as
+// Compare. maxCodepoints is the length of the longest of the strings
+// to compare, in codepoints: the keys of PAD SPACE collations are
+// padded with the weights of spaces as if the strings were stored in a
+// CHAR(maxCodepoints) column. The key of a longer src is truncated.
+func (c *Comparator) SortKey(dst, src []byte, maxCodepoints int) []byte {
+	if c.space == nil {
+		return c.coll.WeightString(dst, src, 0)
+	}
+	return c.coll.WeightString(dst, src, maxCodepoints)
+}
+
+// Sort sorts the values in place, in the order of the collation. The
+// order of equal values is preserved.
+func (c *Comparator) Sort(values [][]byte) {
+	sort.SliceStable(values, func(i, j int) bool {
+		return c.Compare(values[i], values[j]) < 0
+	})
+}
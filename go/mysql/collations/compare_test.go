@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collations
+
+import (
+	"bytes"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestComparator(t *testing.T) {
+	env := NewEnvironment("8.0.30")
+	var cases = []struct {
+		collation   string
+		left, right string
+		want        int
+	}{
+		{"utf8mb4_0900_ai_ci", "a", "A", 0},
+		{"utf8mb4_0900_ai_ci", "a", "á", 0},
+		{"utf8mb4_0900_ai_ci", "a", "a ", -1},
+		{"utf8mb4_0900_as_cs", "a", "A", -1},
+		{"utf8mb4_0900_as_cs", "a", "á", -1},
+		{"utf8mb4_0900_bin", "a", "a ", -1},
+		{"utf8mb4_general_ci", "a", "A", 0},
+		{"utf8mb4_general_ci", "a", "a ", 0},
+		{"utf8mb4_general_ci", "a\t", "a", -1},
+		{"utf8mb4_bin", "A", "a", -1},
+		{"utf8mb4_bin", "a", "a  ", 0},
+		{"utf8mb4_unicode_ci", "a", "á", 0},
+		{"utf8mb4_icelandic_ci", "a", "á", -1},
+		{"utf8mb4_icelandic_ci", "þ", "z", 1},
+		{"utf8mb4_is_0900_ai_ci", "þ", "z", 1},
+		{"utf8mb4_is_0900_ai_ci", "æ", "þ", 1},
+		{"latin1_swedish_ci", "a", "A ", 0},
+	}
+	for _, tc := range cases {
+		c, err := env.ComparatorByName(tc.collation)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, sign(c.Compare([]byte(tc.left), []byte(tc.right))), "%s: %q vs %q", tc.collation, tc.left, tc.right)
+		assert.Equal(t, tc.want == 0, c.Equal([]byte(tc.left), []byte(tc.right)))
+	}
+
+	_, err := env.ComparatorByName("utf8mb4_unknown_ci")
+	assert.EqualError(t, err, `unsupported collation: "utf8mb4_unknown_ci"`)
+	_, err = NewEnvironment("5.7.9").ComparatorByName("utf8mb4_0900_ai_ci")
+	assert.Error(t, err)
+	c, err := env.Comparator(CollationUtf8mb4ID)
+	require.NoError(t, err)
+	assert.Equal(t, "utf8mb4_0900_ai_ci", c.Collation().Name())
+}
+
+func TestComparatorSortKey(t *testing.T) {
+	env := NewEnvironment("8.0.30")
+	values := []string{"", " ", "a", "A", "a ", "a\t", "á", "ab", "Ab ", "b", "z", "þ", "æ", "ö", "ss", "ß", " ", "日本"}
+	maxCodepoints := 0
+	for _, v := range values {
+		if n := utf8.RuneCountInString(v); n > maxCodepoints {
+			maxCodepoints = n
+		}
+	}
+
+	for _, name := range []string{
+		"utf8mb4_0900_ai_ci", "utf8mb4_0900_as_cs", "utf8mb4_0900_bin", "utf8mb4_general_ci",
+		"utf8mb4_bin", "utf8mb4_unicode_ci", "utf8mb4_icelandic_ci", "utf8mb4_is_0900_ai_ci",
+	} {
+		c, err := env.ComparatorByName(name)
+		require.NoError(t, err)
+		for _, left := range values {
+			leftKey := c.SortKey(nil, []byte(left), maxCodepoints)
+			for _, right := range values {
+				rightKey := c.SortKey([]byte("prefix"), []byte(right), maxCodepoints)
+				want := sign(c.Compare([]byte(left), []byte(right)))
+				assert.Equal(t, want, sign(bytes.Compare(leftKey, rightKey[len("prefix"):])), "%s: %q vs %q", name, left, right)
+			}
+		}
+
+		sorted := make([][]byte, len(values))
+		for i, v := range values {
+			sorted[i] = []byte(v)
+		}
+		c.Sort(sorted)
+		for i := 1; i < len(sorted); i++ {
+			assert.LessOrEqual(t, c.Compare(sorted[i-1], sorted[i]), 0, name)
+		}
+	}
+}
+
+func TestComparatorWeightString(t *testing.T) {
+	c, err := NewEnvironment("8.0.30").ComparatorByName("utf8mb4_general_ci")
+	require.NoError(t, err)
+	// Like WEIGHT_STRING('aB ') in MySQL.
+	assert.Equal(t, []byte{0x00, 0x41, 0x00, 0x42, 0x00, 0x20}, c.WeightString(nil, []byte("aB ")))
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// CompressionCodec compresses the payloads of the compressed protocol.
+//
+// With the compressed protocol, the packets are sent in frames that
+// have a 7 bytes header: the length of the compressed payload (3 bytes),
+// a sequence number (1 byte), and the length of the payload before
+// compression (3 bytes, 0 if the payload is not compressed).
+//
+// The codecs are registered with RegisterCompressionCodec, usually in
+// an init function, and are negotiated with a capability flag during
+// the handshake. The zlib codec, negotiated with CLIENT_COMPRESS, is
+// always registered.
+type CompressionCodec interface {
+	// Name is the name used to select the codec, e.g. in
+	// ConnParams.Compression.
+	Name() string
+	// Capability is the capability flag that negotiates the codec in
+	// the handshake. It must not be used by another codec, nor by the
+	// protocol.
+	Capability() uint32
+	// Compress appends the compressed src to dst, and returns the
+	// updated slice. Callers reuse dst between calls.
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress appends the decompressed src to dst, and returns the
+	// updated slice. Callers reuse dst between calls.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+var (
+	compressionCodecsMu sync.Mutex
+	compressionCodecs   = make(map[string]CompressionCodec)
+)
+
+// RegisterCompressionCodec registers a CompressionCodec. It panics if
+// the name or the capability of the codec is already registered.
+func RegisterCompressionCodec(codec CompressionCodec) {
+	compressionCodecsMu.Lock()
+	defer compressionCodecsMu.Unlock()
+	for name, other := range compressionCodecs {
+		if name == codec.Name() || other.Capability() == codec.Capability() {
+			panic(fmt.Sprintf("compression codec %v conflicts with the registered %v", codec.Name(), name))
+		}
+	}
+	compressionCodecs[codec.Name()] = codec
+}
+
+// GetCompressionCodec returns the CompressionCodec registered with the
+// given name, or an error.
+func GetCompressionCodec(name string) (CompressionCodec, error) {
+	compressionCodecsMu.Lock()
+	defer compressionCodecsMu.Unlock()
+	codec, ok := compressionCodecs[name]
+	if !ok {
+		return nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "unknown compression codec %q", name)
+	}
+	return codec, nil
+}
+
+// negotiateCompression returns the first of the codecs negotiated by
+// the capabilities of the other side, if any.
+func negotiateCompression(codecs []CompressionCodec, capabilities uint32) CompressionCodec {
+	for _, codec := range codecs {
+		if capabilities&codec.Capability() != 0 {
+			return codec
+		}
+	}
+	return nil
+}
+
+// compressionCapabilities returns the capability flags of the codecs.
+func compressionCapabilities(codecs []CompressionCodec) uint32 {
+	var capabilities uint32
+	for _, codec := range codecs {
+		capabilities |= codec.Capability()
+	}
+	return capabilities
+}
+
+// Compression returns the name of the compression codec used by the
+// connection, or "" if it is not compressed.
+func (c *Conn) Compression() string {
+	if cc, ok := c.conn.(*compressedConn); ok {
+		return cc.codec.Name()
+	}
+	return ""
+}
+
+// enableCompression switches the connection to the compressed protocol
+// with the negotiated codec, if any. It is called once the handshake is
+// done, when no data is buffered.
+func (c *Conn) enableCompression() {
+	if c.compression == nil {
+		return
+	}
+	c.conn = newCompressedConn(c.conn, c.compression)
+	if c.bufferedReader != nil {
+		c.bufferedReader.Reset(c.conn)
+	}
+}
+
+// resetSequence resets the sequence numbers at the start of a command.
+func (c *Conn) resetSequence() {
+	c.sequence = 0
+	if cc, ok := c.conn.(*compressedConn); ok {
+		cc.sequence = 0
+	}
+}
+
+const (
+	// compressedHeaderSize is the size of the header of the frames of
+	// the compressed protocol.
+	compressedHeaderSize = 7
+
+	// minCompressLength is the length below which payloads are not
+	// compressed, like in MySQL.
+	minCompressLength = 50
+
+	// maxRetainedCompressionBuffer is the capacity above which the
+	// buffers of a compressedConn are released after use.
+	maxRetainedCompressionBuffer = 1024 * 1024
+)
+
+// compressedConn implements the compressed protocol on top of a
+// connection. The packets written are sent in frames of their own,
+// and the frames read are decompressed as they are read.
+type compressedConn struct {
+	net.Conn
+	codec CompressionCodec
+
+	// sequence is the sequence number of the next frame.
+	sequence uint8
+
+	header [compressedHeaderSize]byte
+	// payload is the frame read last, before decompression.
+	payload []byte
+	// readBuf holds the data of the frame read last, from readPos.
+	readBuf []byte
+	readPos int
+	// writeBuf is the frame being written.
+	writeBuf []byte
+}
+
+func newCompressedConn(conn net.Conn, codec CompressionCodec) *compressedConn {
+	return &compressedConn{
+		Conn:  conn,
+		codec: codec,
+	}
+}
+
+// Read is part of the net.Conn interface.
+func (cc *compressedConn) Read(b []byte) (int, error) {
+	for cc.readPos == len(cc.readBuf) {
+		if err := cc.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, cc.readBuf[cc.readPos:])
+	cc.readPos += n
+	if cc.readPos == len(cc.readBuf) && cap(cc.readBuf) > maxRetainedCompressionBuffer {
+		cc.readBuf, cc.readPos = nil, 0
+	}
+	return n, nil
+}
+
+func (cc *compressedConn) readFrame() error {
+	if _, err := io.ReadFull(cc.Conn, cc.header[:]); err != nil {
+		return err
+	}
+	length := int(uint32(cc.header[0]) | uint32(cc.header[1])<<8 | uint32(cc.header[2])<<16)
+	cc.sequence = cc.header[3] + 1
+	uncompressedLength := int(uint32(cc.header[4]) | uint32(cc.header[5])<<8 | uint32(cc.header[6])<<16)
+
+	if cap(cc.payload) < length {
+		cc.payload = make([]byte, length)
+	}
+	payload := cc.payload[:length]
+	if _, err := io.ReadFull(cc.Conn, payload); err != nil {
+		return err
+	}
+	if cap(cc.payload) > maxRetainedCompressionBuffer {
+		cc.payload = nil
+	}
+
+	cc.readPos = 0
+	if uncompressedLength == 0 {
+		cc.readBuf = append(cc.readBuf[:0], payload...)
+		return nil
+	}
+	readBuf, err := cc.codec.Decompress(cc.readBuf[:0], payload)
+	if err != nil {
+		cc.readBuf = cc.readBuf[:0]
+		return vterrors.Wrapf(err, "cannot decompress %v frame", cc.codec.Name())
+	}
+	cc.readBuf = readBuf
+	if len(cc.readBuf) != uncompressedLength {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "%v frame decompressed to %v bytes, expected %v", cc.codec.Name(), len(cc.readBuf), uncompressedLength)
+	}
+	return nil
+}
+
+// Write is part of the net.Conn interface.
+func (cc *compressedConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > MaxPacketSize {
+			chunk = chunk[:MaxPacketSize]
+		}
+		if err := cc.writeFrame(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+	return written, nil
+}
+
+func (cc *compressedConn) writeFrame(chunk []byte) error {
+	frame := append(cc.writeBuf[:0], cc.header[:]...)
+	uncompressedLength := 0
+	if len(chunk) >= minCompressLength {
+		compressed, err := cc.codec.Compress(frame, chunk)
+		if err != nil {
+			return vterrors.Wrapf(err, "cannot compress %v frame", cc.codec.Name())
+		}
+		frame = compressed
+		uncompressedLength = len(chunk)
+	}
+	// Don't send payloads that are larger compressed.
+	if uncompressedLength == 0 || len(frame)-compressedHeaderSize >= len(chunk) {
+		frame = append(frame[:compressedHeaderSize], chunk...)
+		uncompressedLength = 0
+	}
+
+	length := len(frame) - compressedHeaderSize
+	frame[0] = byte(length)
+	frame[1] = byte(length >> 8)
+	frame[2] = byte(length >> 16)
+	frame[3] = cc.sequence
+	frame[4] = byte(uncompressedLength)
+	frame[5] = byte(uncompressedLength >> 8)
+	frame[6] = byte(uncompressedLength >> 16)
+	cc.sequence++
+
+	cc.writeBuf = frame[:0]
+	if cap(cc.writeBuf) > maxRetainedCompressionBuffer {
+		cc.writeBuf = nil
+	}
+	_, err := cc.Conn.Write(frame)
+	return err
+}
+
+// zlibCodec is the CompressionCodec of CLIENT_COMPRESS.
+type zlibCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// Name is part of the CompressionCodec interface.
+func (*zlibCodec) Name() string {
+	return "zlib"
+}
+
+// Capability is part of the CompressionCodec interface.
+func (*zlibCodec) Capability() uint32 {
+	return CapabilityClientCompress
+}
+
+// Compress is part of the CompressionCodec interface.
+func (z *zlibCodec) Compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w, ok := z.writers.Get().(*zlib.Writer)
+	if ok {
+		w.Reset(buf)
+	} else {
+		w = zlib.NewWriter(buf)
+	}
+	defer z.writers.Put(w)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress is part of the CompressionCodec interface.
+func (z *zlibCodec) Decompress(dst, src []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	if pooled, ok := z.readers.Get().(io.ReadCloser); ok {
+		r = pooled
+		err = r.(zlib.Resetter).Reset(bytes.NewReader(src), nil)
+	} else {
+		r, err = zlib.NewReader(bytes.NewReader(src))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer z.readers.Put(r)
+	buf := bytes.NewBuffer(dst)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), r.Close()
+}
+
+func init() {
+	RegisterCompressionCodec(&zlibCodec{})
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/vttls"
+)
+
+func TestZlibCodec(t *testing.T) {
+	codec, err := GetCompressionCodec("zlib")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(CapabilityClientCompress), codec.Capability())
+
+	src := []byte(strings.Repeat("compressible ", 100))
+	compressed, err := codec.Compress([]byte("prefix"), src)
+	require.NoError(t, err)
+	assert.Equal(t, "prefix", string(compressed[:6]))
+	assert.Less(t, len(compressed), len(src))
+
+	decompressed, err := codec.Decompress([]byte("prefix"), compressed[6:])
+	require.NoError(t, err)
+	assert.Equal(t, "prefix"+string(src), string(decompressed))
+
+	// The pooled writers and readers are reset.
+	for i := 0; i < 3; i++ {
+		compressed, err = codec.Compress(nil, src)
+		require.NoError(t, err)
+		decompressed, err = codec.Decompress(nil, compressed)
+		require.NoError(t, err)
+		assert.Equal(t, src, decompressed)
+	}
+
+	_, err = codec.Decompress(nil, []byte("not zlib"))
+	assert.Error(t, err)
+}
+
+func TestCompressionCodecRegistry(t *testing.T) {
+	_, err := GetCompressionCodec("unknown")
+	assert.EqualError(t, err, `unknown compression codec "unknown"`)
+
+	assert.Panics(t, func() { RegisterCompressionCodec(&zlibCodec{}) })
+
+	codec, _ := GetCompressionCodec("zlib")
+	assert.Equal(t, codec, negotiateCompression([]CompressionCodec{codec}, CapabilityClientProtocol41|CapabilityClientCompress))
+	assert.Nil(t, negotiateCompression([]CompressionCodec{codec}, CapabilityClientProtocol41))
+	assert.Equal(t, uint32(CapabilityClientCompress), compressionCapabilities([]CompressionCodec{codec}))
+}
+
+func TestCompressedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	codec, _ := GetCompressionCodec("zlib")
+	cc, sc := newCompressedConn(client, codec), newCompressedConn(server, codec)
+
+	for _, payload := range [][]byte{
+		// Too small to be compressed.
+		[]byte("small"),
+		// Compressed.
+		[]byte(strings.Repeat("a", 1000)),
+		// Larger compressed, sent uncompressed.
+		[]byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+	} {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := cc.Write(payload)
+			errs <- err
+		}()
+		got := make([]byte, len(payload))
+		_, err := io.ReadFull(sc, got)
+		require.NoError(t, err)
+		require.NoError(t, <-errs)
+		assert.Equal(t, payload, got)
+	}
+	assert.EqualValues(t, 3, cc.sequence)
+	assert.EqualValues(t, 3, sc.sequence)
+}
+
+func TestCompressedConnection(t *testing.T) {
+	th := &testHandler{}
+
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{
+		{Password: "password1"},
+	}
+	defer authServer.close()
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, th, 0, 0, false)
+	require.NoError(t, err)
+	defer l.Close()
+	codec, _ := GetCompressionCodec("zlib")
+	l.CompressionCodecs = []CompressionCodec{codec}
+	go l.Accept()
+
+	params := &ConnParams{
+		Host:        l.Addr().(*net.TCPAddr).IP.String(),
+		Port:        l.Addr().(*net.TCPAddr).Port,
+		Uname:       "user1",
+		Pass:        "password1",
+		SslMode:     vttls.Disabled,
+		Compression: "zlib",
+	}
+	ctx := context.Background()
+	conn, err := Connect(ctx, params)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "zlib", conn.Compression())
+
+	result, err := conn.ExecuteFetch("select rows", 10000, true)
+	require.NoError(t, err)
+	assert.Equal(t, selectRowsResult.Rows, result.Rows)
+
+	// A query and a result large enough to be compressed.
+	query := benchmarkQueryPrefix + strings.Repeat("x", 100000)
+	result, err = conn.ExecuteFetch(query, 10000, false)
+	require.NoError(t, err)
+	assert.Equal(t, query, result.Rows[0][0].ToString())
+	require.NoError(t, conn.Ping())
+	conn.writeComQuit()
+
+	// Without the codec on the server, the connection is not compressed.
+	l.CompressionCodecs = nil
+	conn, err = Connect(ctx, params)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "", conn.Compression())
+	_, err = conn.ExecuteFetch("select rows", 10000, true)
+	require.NoError(t, err)
+	conn.writeComQuit()
+
+	params.Compression = "unknown"
+	_, err = Connect(ctx, params)
+	assert.ErrorContains(t, err, `unknown compression codec "unknown"`)
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -91,6 +92,11 @@ type Conn struct {
 	// salt is sent by the server during initial handshake to be used for authentication
 	salt []byte
 
+	// handshakeSalt is the buffer for the salt generated by the server
+	// during the initial handshake, including its trailing NULL. It is
+	// part of the Conn so the handshake doesn't need to allocate it.
+	handshakeSalt [21]byte
+
 	// authPluginName is the name of server's authentication plugin.
 	// It is set during the initial handshake.
 	authPluginName AuthMethodDescription
@@ -116,6 +122,14 @@ type Conn struct {
 	// connection. It is unused for server-side connections.
 	flavor flavor
 
+	// binlogFilter is set by SetBinlogFilter, to filter the events
+	// returned by ReadBinlogEvent.
+	binlogFilter *binlogFilter
+
+	// compression is the codec negotiated during the handshake, if
+	// any. Once the handshake is done, conn is a compressedConn.
+	compression CompressionCodec
+
 	// ServerVersion is set during Connect with the server
 	// version.  It is not changed afterwards. It is unused for
 	// server-side connections.
@@ -142,6 +156,9 @@ type Conn struct {
 	// currentEphemeralBuffer for tracking allocated temporary buffer for writes and reads respectively.
 	// It can be allocated from bufPool or heap and should be recycled in the same manner.
 	currentEphemeralBuffer *[]byte
+	// currentEphemeralMemory is the memory reserved for a read packet
+	// too large for bufPool. It is released by recycleReadPacket.
+	currentEphemeralMemory int64
 
 	listener *Listener
 
@@ -202,6 +219,24 @@ type Conn struct {
 	// enableQueryInfo controls whether we parse the INFO field in QUERY_OK packets
 	// See: ConnParams.EnableQueryInfo
 	enableQueryInfo bool
+
+	// memoryUsage is the number of bytes buffered by a server
+	// connection, accounted against the memory limits of its listener.
+	// It is only changed by reserveMemory and releaseMemory.
+	memoryUsage int64
+
+	// flushDeadlineConn is set on server connections when the listener
+	// has a FlushTimeout. It wraps the network connection.
+	flushDeadlineConn *flushDeadlineConn
+
+	// drainMu protects busy and drained, so a server connection is not
+	// drained by Listener.Drain while it runs a command.
+	drainMu sync.Mutex
+	// busy is true while the connection runs a command.
+	busy bool
+	// drained is true once the connection was sent the
+	// ERServerShutdown error of Listener.Drain.
+	drained bool
 }
 
 // splitStatementFunciton is the function that is used to split the statement in case of a multi-statement query.
@@ -286,6 +321,24 @@ func (c *Conn) endWriterBuffering() error {
 	}()
 
 	c.stopFlushTimer()
+	c.startFlush()
+	defer c.endFlush()
+	return c.bufferedWriter.Flush()
+}
+
+// FlushBuffer sends any data buffered for the other side right away,
+// without waiting for the flush timer or the end of the command.
+// It is a no-op when the connection is not buffering writes.
+func (c *Conn) FlushBuffer() error {
+	c.bufMu.Lock()
+	defer c.bufMu.Unlock()
+
+	if c.bufferedWriter == nil {
+		return nil
+	}
+	c.stopFlushTimer()
+	c.startFlush()
+	defer c.endFlush()
 	return c.bufferedWriter.Flush()
 }
 
@@ -317,6 +370,8 @@ func (c *Conn) startFlushTimer() {
 			return
 		}
 		c.stopFlushTimer()
+		c.startFlush()
+		defer c.endFlush()
 		c.bufferedWriter.Flush()
 	})
 }
@@ -407,6 +462,9 @@ func (c *Conn) readEphemeralPacket() ([]byte, error) {
 	// Much slower path, revert to allocating everything from scratch.
 	// We're going to concatenate a lot of data anyway, can't really
 	// optimize this code path easily.
+	if err := c.reserveEphemeralMemory(length); err != nil {
+		return nil, err
+	}
 	data := make([]byte, length)
 	if _, err := io.ReadFull(r, data); err != nil {
 		return nil, vterrors.Wrapf(err, "io.ReadFull(packet body of length %v) failed", length)
@@ -422,6 +480,9 @@ func (c *Conn) readEphemeralPacket() ([]byte, error) {
 			break
 		}
 
+		if err := c.reserveEphemeralMemory(len(next)); err != nil {
+			return nil, err
+		}
 		data = append(data, next...)
 		if len(next) < MaxPacketSize {
 			break
@@ -478,6 +539,8 @@ func (c *Conn) recycleReadPacket() {
 		bufPool.Put(c.currentEphemeralBuffer)
 		c.currentEphemeralBuffer = nil
 	}
+	c.releaseMemory(c.currentEphemeralMemory)
+	c.currentEphemeralMemory = 0
 	c.currentEphemeralPolicy = ephemeralUnused
 }
 
@@ -663,7 +726,7 @@ func (c *Conn) recycleWritePacket() {
 // Returns SQLError(CRServerGone) if it can't.
 func (c *Conn) writeComQuit() error {
 	// This is a new command, need to reset the sequence.
-	c.sequence = 0
+	c.resetSequence()
 
 	data, pos := c.startEphemeralPacketWithHeader(1)
 	data[pos] = ComQuit
@@ -865,9 +928,17 @@ func (c *Conn) writeEOFPacket(flags uint16, warnings uint16) error {
 // handleNextCommand is called in the server loop to process
 // incoming packets.
 func (c *Conn) handleNextCommand(handler Handler) bool {
-	c.sequence = 0
+	c.resetSequence()
 	data, err := c.readEphemeralPacket()
 	if err != nil {
+		if sqlErr, ok := err.(*SQLError); ok && sqlErr.Number() == EROutOfMemory {
+			// The rest of the packet can't be read, so the
+			// connection can't be used anymore. Tell the client
+			// why before closing it.
+			c.recycleReadPacket()
+			c.writeErrorPacketFromErrorAndLog(err)
+			return false
+		}
 		// Don't log EOF errors. They cause too much spam.
 		if err != io.EOF && !strings.Contains(err.Error(), "use of closed network connection") {
 			log.Errorf("Error reading packet from %s: %v", c, err)
@@ -877,6 +948,11 @@ func (c *Conn) handleNextCommand(handler Handler) bool {
 	if len(data) == 0 {
 		return false
 	}
+	if !c.startCommand() {
+		// The listener drained the connection while we were reading.
+		c.recycleReadPacket()
+		return false
+	}
 
 	switch data[0] {
 	case ComQuit:
@@ -891,6 +967,10 @@ func (c *Conn) handleNextCommand(handler Handler) bool {
 		return c.handleComQuery(handler, data)
 	case ComPing:
 		return c.handleComPing()
+	case ComStatistics:
+		return c.handleComStatistics(handler)
+	case ComDebug:
+		return c.handleComDebug()
 	case ComSetOption:
 		return c.handleComSetOption(data)
 	case ComPrepare:
@@ -911,10 +991,7 @@ func (c *Conn) handleNextCommand(handler Handler) bool {
 		c.handleComResetConnection(handler)
 		return true
 	case ComFieldList:
-		c.recycleReadPacket()
-		if !c.writeErrorAndLog(ERUnknownComError, SSNetError, "command handling not implemented yet: %v", data[0]) {
-			return false
-		}
+		return c.handleComFieldList(handler, data)
 	case ComBinlogDumpGTID:
 		return c.handleComBinlogDumpGTID(handler, data)
 	default:
@@ -949,6 +1026,34 @@ func (c *Conn) handleComBinlogDumpGTID(handler Handler, data []byte) (kontinue b
 	return true
 }
 
+func (c *Conn) handleComFieldList(handler Handler, data []byte) (kontinue bool) {
+	table, wildcard, ok := c.parseComFieldList(data)
+	c.recycleReadPacket()
+	if !ok {
+		log.Errorf("Got malformed COM_FIELD_LIST packet from client %v, returning error", c.ConnectionID)
+		return c.writeErrorAndLog(ERUnknownComError, SSNetError, "error handling packet: malformed COM_FIELD_LIST")
+	}
+
+	fields, err := handler.ComFieldList(c, table, wildcard)
+	if err != nil {
+		return c.writeErrorPacketFromErrorAndLog(err)
+	}
+
+	c.startWriterBuffering()
+	defer func() {
+		if err := c.endWriterBuffering(); err != nil {
+			log.Errorf("conn %v: flush() failed: %v", c.ID(), err)
+			kontinue = false
+		}
+	}()
+
+	if err := c.writeFieldList(fields); err != nil {
+		log.Errorf("Error writing COM_FIELD_LIST response to %s: %v", c, err)
+		return false
+	}
+	return true
+}
+
 func (c *Conn) handleComResetConnection(handler Handler) {
 	// Clean up and reset the connection
 	c.recycleReadPacket()
@@ -1056,6 +1161,17 @@ func (c *Conn) handleComStmtExecute(handler Handler, data []byte) (kontinue bool
 			return io.EOF
 		}
 
+		size := qr.CachedSize(true)
+		if err := c.reserveMemory(size); err != nil {
+			return err
+		}
+		defer c.releaseMemory(size)
+
+		// Bound the time we can be blocked by a client that doesn't
+		// read its results. If it expires, the error stops the query.
+		c.startFlush()
+		defer c.endFlush()
+
 		if !fieldSent {
 			fieldSent = true
 
@@ -1237,6 +1353,57 @@ func (c *Conn) handleComPing() bool {
 	return true
 }
 
+// handleComStatistics writes the human-readable status string MySQL
+// returns to COM_STATISTICS, as displayed by 'mysqladmin status'.
+// The response is a bare string, without any packet type header.
+func (c *Conn) handleComStatistics(handler Handler) bool {
+	c.recycleReadPacket()
+
+	var uptime int64
+	if c.listener != nil {
+		uptime = int64(time.Since(c.listener.startTime) / time.Second)
+	}
+	stats := append([]Statistic{
+		{Name: "Uptime", Value: strconv.FormatInt(uptime, 10)},
+		{Name: "Threads", Value: strconv.FormatInt(connCount.Get(), 10)},
+	}, handler.ComStatistics(c)...)
+
+	status := formatStatistics(stats)
+	data, pos := c.startEphemeralPacketWithHeader(len(status))
+	copy(data[pos:], status)
+	if err := c.writeEphemeralPacket(); err != nil {
+		log.Errorf("Error writing ComStatistics result to %s: %v", c, err)
+		return false
+	}
+	return true
+}
+
+// formatStatistics formats stats the way MySQL does, e.g.
+// "Uptime: 10  Threads: 1  Questions: 5".
+func formatStatistics(stats []Statistic) string {
+	var sb strings.Builder
+	for i, stat := range stats {
+		if i > 0 {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(stat.Name)
+		sb.WriteString(": ")
+		sb.WriteString(stat.Value)
+	}
+	return sb.String()
+}
+
+// handleComDebug answers COM_DEBUG. MySQL dumps debug information to
+// its error log, which has no equivalent here, so this is a no-op.
+func (c *Conn) handleComDebug() bool {
+	c.recycleReadPacket()
+	if err := c.writeOKPacket(&PacketOK{statusFlags: c.StatusFlags}); err != nil {
+		log.Errorf("Error writing ComDebug result to %s: %v", c, err)
+		return false
+	}
+	return true
+}
+
 var errEmptyStatement = NewSQLError(EREmptyQuery, SSClientError, "Query was empty")
 
 func (c *Conn) handleComQuery(handler Handler, data []byte) (kontinue bool) {
@@ -1298,6 +1465,20 @@ func (c *Conn) execQuery(query string, handler Handler, more bool) execResult {
 			return io.EOF
 		}
 
+		// Account for the result while it is written, so a client
+		// that doesn't read its results can't make us buffer an
+		// unbounded amount of them.
+		size := qr.CachedSize(true)
+		if err := c.reserveMemory(size); err != nil {
+			return err
+		}
+		defer c.releaseMemory(size)
+
+		// Bound the time we can be blocked by a client that doesn't
+		// read its results. If it expires, the error stops the query.
+		c.startFlush()
+		defer c.endFlush()
+
 		if !callbackCalled {
 			callbackCalled = true
 
@@ -1538,7 +1719,11 @@ func ParseErrorPacket(data []byte) error {
 
 // GetTLSClientCerts gets TLS certificates.
 func (c *Conn) GetTLSClientCerts() []*x509.Certificate {
-	if tlsConn, ok := c.conn.(*tls.Conn); ok {
+	conn := c.conn
+	if cc, ok := conn.(*compressedConn); ok {
+		conn = cc.Conn
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
 		return tlsConn.ConnectionState().PeerCertificates
 	}
 	return nil
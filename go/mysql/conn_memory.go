@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+)
+
+// Names of the limits reported in the MysqlServerMemoryLimitExceeded
+// counter.
+const (
+	memoryLimitConnection = "Connection"
+	memoryLimitGlobal     = "Global"
+)
+
+var (
+	// serverMemoryUsage is the number of bytes currently buffered by
+	// all the server connections of the process.
+	serverMemoryUsage sync2.AtomicInt64
+
+	_ = stats.NewGaugeFunc("MysqlServerMemoryUsage", "Bytes buffered by all the MySQL server connections", serverMemoryUsage.Get)
+
+	memoryLimitExceeded = stats.NewCountersWithSingleLabel("MysqlServerMemoryLimitExceeded", "Queries killed because a MySQL server connection exceeded a memory limit", "limit")
+)
+
+// reserveMemory accounts for n more bytes buffered by the server
+// connection. It returns an EROutOfMemory error, and accounts for
+// nothing, if that would exceed the ConnMemoryLimit or the
+// GlobalMemoryLimit of the listener. It is a no-op for client
+// connections.
+func (c *Conn) reserveMemory(n int64) error {
+	if c.listener == nil || n <= 0 {
+		return nil
+	}
+	if limit := c.listener.ConnMemoryLimit.Get(); limit > 0 && c.memoryUsage+n > limit {
+		memoryLimitExceeded.Add(memoryLimitConnection, 1)
+		return NewSQLError(EROutOfMemory, SSOutOfMemory, "connection %v needs %v more bytes but its buffers are limited to %v bytes (mysql_server_conn_memory_limit)", c.ConnectionID, n, limit)
+	}
+	total := serverMemoryUsage.Add(n)
+	if limit := c.listener.GlobalMemoryLimit.Get(); limit > 0 && total > limit {
+		serverMemoryUsage.Add(-n)
+		memoryLimitExceeded.Add(memoryLimitGlobal, 1)
+		return NewSQLError(EROutOfMemory, SSOutOfMemory, "connection %v needs %v more bytes but the buffers of all connections are limited to %v bytes (mysql_server_memory_limit)", c.ConnectionID, n, limit)
+	}
+	c.memoryUsage += n
+	return nil
+}
+
+// releaseMemory releases n bytes reserved with reserveMemory.
+func (c *Conn) releaseMemory(n int64) {
+	if c.listener == nil || n <= 0 {
+		return
+	}
+	c.memoryUsage -= n
+	serverMemoryUsage.Add(-n)
+}
+
+// reserveEphemeralMemory reserves n bytes for the packet being read,
+// until recycleReadPacket is called. If the reservation fails, the
+// memory reserved for the packet so far is released right away.
+func (c *Conn) reserveEphemeralMemory(n int) error {
+	if err := c.reserveMemory(int64(n)); err != nil {
+		c.releaseMemory(c.currentEphemeralMemory)
+		c.currentEphemeralMemory = 0
+		return err
+	}
+	c.currentEphemeralMemory += int64(n)
+	return nil
+}
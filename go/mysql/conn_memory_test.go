@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// memoryHandler returns a single row with a value of the size given
+// by the query.
+type memoryHandler struct {
+	testHandler
+}
+
+func (h *memoryHandler) ComQuery(c *Conn, query string, callback func(*sqltypes.Result) error) error {
+	return callback(&sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "value", Type: querypb.Type_VARCHAR}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewVarChar(strings.Repeat("x", len(query)))}},
+	})
+}
+
+func TestConnMemoryLimit(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+	sConn.listener = &Listener{}
+	sConn.listener.ConnMemoryLimit.Set(10000)
+	handler := &memoryHandler{}
+
+	query := func(size int) error {
+		require.NoError(t, cConn.WriteComQuery(strings.Repeat("q", size)))
+		require.True(t, sConn.handleNextCommand(handler))
+		_, _, _, err := cConn.ReadQueryResult(10, false)
+		return err
+	}
+
+	require.NoError(t, query(100))
+	assert.Zero(t, sConn.memoryUsage)
+	assert.Zero(t, serverMemoryUsage.Get())
+
+	before := memoryLimitExceeded.Counts()[memoryLimitConnection]
+	err := query(20000)
+	assertSQLError(t, err, EROutOfMemory, SSOutOfMemory, "mysql_server_conn_memory_limit", "", "")
+	assert.Equal(t, before+1, memoryLimitExceeded.Counts()[memoryLimitConnection])
+	assert.Zero(t, sConn.memoryUsage)
+
+	// The global limit applies to the memory used by all connections.
+	sConn.listener.ConnMemoryLimit.Set(0)
+	sConn.listener.GlobalMemoryLimit.Set(10000)
+	serverMemoryUsage.Add(9000)
+	err = query(1000)
+	serverMemoryUsage.Add(-9000)
+	assertSQLError(t, err, EROutOfMemory, SSOutOfMemory, "mysql_server_memory_limit", "", "")
+	assert.Zero(t, serverMemoryUsage.Get())
+
+	// The connection is still usable.
+	require.NoError(t, query(1000))
+}
+
+func TestConnMemoryLimitLargePacket(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+	sConn.listener = &Listener{}
+	sConn.listener.ConnMemoryLimit.Set(MaxPacketSize - 1)
+
+	// Write the header of a packet of MaxPacketSize bytes. The server
+	// gives up before reading the rest of it.
+	_, err := cConn.conn.Write([]byte{0xff, 0xff, 0xff, 0})
+	require.NoError(t, err)
+	require.False(t, sConn.handleNextCommand(&testHandler{}))
+	assert.Zero(t, sConn.memoryUsage)
+
+	cConn.sequence = 1
+	data, err := cConn.ReadPacket()
+	require.NoError(t, err)
+	assertSQLError(t, ParseErrorPacket(data), EROutOfMemory, SSOutOfMemory, "mysql_server_conn_memory_limit", "", "")
+}
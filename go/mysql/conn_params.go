@@ -17,9 +17,28 @@ limitations under the License.
 package mysql
 
 import (
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+
 	"vitess.io/vitess/go/vt/vttls"
 )
 
+// EndpointPolicy is the order in which the endpoints of a ConnParams are
+// tried by Connect.
+type EndpointPolicy string
+
+const (
+	// EndpointPolicyOrdered tries the endpoints in the order they are
+	// listed. It is the default.
+	EndpointPolicyOrdered EndpointPolicy = "ordered"
+
+	// EndpointPolicyRandom tries the endpoints in a random order, to
+	// spread the connections across them.
+	EndpointPolicyRandom EndpointPolicy = "random"
+)
+
 // ConnParams contains all the parameters to use to connect to mysql.
 type ConnParams struct {
 	Host       string `json:"host"`
@@ -47,6 +66,16 @@ type ConnParams struct {
 	ServerName       string        `json:"server_name"`
 	ConnectTimeoutMs uint64        `json:"connect_timeout_ms"`
 
+	// Endpoints is a comma-separated list of "host:port" addresses to
+	// connect to. If set, it is used instead of Host and Port, and Connect
+	// fails over to the next endpoint when one can't be reached.
+	// EndpointTimeoutMs limits the time spent on each attempt, while
+	// ConnectTimeoutMs still limits the whole Connect call. It is a string
+	// rather than a slice so ConnParams stays comparable.
+	Endpoints         string         `json:"endpoints,omitempty"`
+	EndpointTimeoutMs uint64         `json:"endpoint_timeout_ms,omitempty"`
+	EndpointPolicy    EndpointPolicy `json:"endpoint_policy,omitempty"`
+
 	// The following is only set when the deprecated "dbname" flags are
 	// supplied and will be removed.
 	DeprecatedDBName string
@@ -55,6 +84,20 @@ type ConnParams struct {
 	// using CapabilityClientDeprecateEOF
 	DisableClientDeprecateEOF bool
 
+	// AllowedAuthPlugins is a comma-separated list of the auth plugins
+	// the client may use, in order of preference, e.g.
+	// "caching_sha2_password,mysql_native_password". If the default
+	// plugin of the server is not allowed, the handshake response uses
+	// the first allowed one instead, and the server accepts it or asks
+	// for another one. Connect fails with a CRAuthPluginCannotLoad error
+	// if the server asks for a plugin that is not allowed. All the
+	// supported plugins are allowed if it is empty.
+	AllowedAuthPlugins string `json:"allowed_auth_plugins,omitempty"`
+
+	// Compression is the name of the CompressionCodec to use, if the
+	// server supports it. The connection is not compressed otherwise.
+	Compression string `json:"compression,omitempty"`
+
 	// EnableQueryInfo sets whether the results from queries performed by this
 	// connection should include the 'info' field that MySQL usually returns. This 'info'
 	// field usually contains a human-readable text description of the executed query
@@ -108,3 +151,69 @@ func (cp *ConnParams) EffectiveSslMode() vttls.SslMode {
 	}
 	return cp.SslMode
 }
+
+// endpointParams returns one ConnParams per endpoint, in the order they
+// should be tried according to the EndpointPolicy. Each of them has the
+// Host and Port of its endpoint and no Endpoints.
+func (cp *ConnParams) endpointParams() ([]*ConnParams, error) {
+	var result []*ConnParams
+	for _, endpoint := range strings.Split(cp.Endpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			return nil, NewSQLError(CRUnknownHost, SSUnknownSQLState, "invalid endpoint %v: %v", endpoint, err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, NewSQLError(CRUnknownHost, SSUnknownSQLState, "invalid port in endpoint %v: %v", endpoint, err)
+		}
+		params := *cp
+		params.Host = host
+		params.Port = p
+		params.Endpoints = ""
+		result = append(result, &params)
+	}
+	if len(result) == 0 {
+		return nil, NewSQLError(CRUnknownHost, SSUnknownSQLState, "no valid endpoint in %q", cp.Endpoints)
+	}
+
+	switch cp.EndpointPolicy {
+	case "", EndpointPolicyOrdered:
+	case EndpointPolicyRandom:
+		rand.Shuffle(len(result), func(i, j int) {
+			result[i], result[j] = result[j], result[i]
+		})
+	default:
+		return nil, NewSQLError(CRUnknownError, SSUnknownSQLState, "unknown endpoint policy %v", cp.EndpointPolicy)
+	}
+	return result, nil
+}
+
+// allowedAuthPlugins returns the parsed AllowedAuthPlugins, or nil if
+// all the plugins are allowed.
+func (cp *ConnParams) allowedAuthPlugins() []AuthMethodDescription {
+	var plugins []AuthMethodDescription
+	for _, plugin := range strings.Split(cp.AllowedAuthPlugins, ",") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, AuthMethodDescription(plugin))
+		}
+	}
+	return plugins
+}
+
+// authPluginAllowed returns true if the client may use the plugin.
+func (cp *ConnParams) authPluginAllowed(plugin AuthMethodDescription) bool {
+	allowed := cp.allowedAuthPlugins()
+	if allowed == nil {
+		return true
+	}
+	for _, p := range allowed {
+		if p == plugin {
+			return true
+		}
+	}
+	return false
+}
@@ -52,6 +52,11 @@ const (
 	// MysqlDialog uses the dialog plugin on the client side.
 	// It transmits data in the clear.
 	MysqlDialog = AuthMethodDescription("dialog")
+
+	// MysqlOldPassword is the pre-4.1 hash. Servers that still have
+	// accounts with such passwords ask for it with an old-style auth
+	// switch request. It is not supported.
+	MysqlOldPassword = AuthMethodDescription("mysql_old_password")
 )
 
 // Capability flags.
@@ -77,8 +82,11 @@ const (
 	// CLIENT_NO_SCHEMA 1 << 4
 	// Do not permit database.table.column. We do permit it.
 
-	// CLIENT_COMPRESS 1 << 5
-	// We do not support compression. CPU is usually our bottleneck.
+	// CapabilityClientCompress is CLIENT_COMPRESS.
+	// Use the compressed protocol, with zlib. It is only negotiated
+	// when enabled, as CPU is usually our bottleneck. See
+	// CompressionCodec.
+	CapabilityClientCompress = 1 << 5
 
 	// CLIENT_ODBC 1 << 6
 	// No special behavior since 3.22.
@@ -207,6 +215,12 @@ const (
 	// ComFieldList is COM_Field_List.
 	ComFieldList = 0x04
 
+	// ComStatistics is COM_STATISTICS.
+	ComStatistics = 0x09
+
+	// ComDebug is COM_DEBUG.
+	ComDebug = 0x0d
+
 	// ComPing is COM_PING.
 	ComPing = 0x0e
 
@@ -286,6 +300,10 @@ const (
 	// This is returned if a connection via a TCP socket fails.
 	CRConnHostError = 2003
 
+	// CRUnknownHost is CR_UNKNOWN_HOST
+	// This is returned if the host name can't be resolved or parsed.
+	CRUnknownHost = 2005
+
 	// CRServerGone is CR_SERVER_GONE_ERROR.
 	// This is returned if the client tries to send a command but it fails.
 	CRServerGone = 2006
@@ -321,6 +339,11 @@ const (
 
 	// CRMalformedPacket is CR_MALFORMED_PACKET
 	CRMalformedPacket = 2027
+
+	// CRAuthPluginCannotLoad is CR_AUTH_PLUGIN_CANNOT_LOAD
+	// This is returned if the server asks for an auth plugin the client
+	// doesn't support, or isn't allowed to use.
+	CRAuthPluginCannotLoad = 2059
 )
 
 // Error codes for server-side errors.
@@ -358,7 +381,8 @@ const (
 	ERUserLimitReached       = 1226
 
 	// deadline exceeded
-	ERLockWaitTimeout = 1205
+	ERNetWriteInterrupted = 1161
+	ERLockWaitTimeout     = 1205
 
 	// unavailable
 	ERServerShutdown = 1053
@@ -589,6 +613,9 @@ const (
 	// SSNoDB is ER_NO_DB_ERROR
 	SSNoDB = "3D000"
 
+	// SSOutOfMemory is ER_OUTOFMEMORY
+	SSOutOfMemory = "HY001"
+
 	// SSLockDeadlock is ER_LOCK_DEADLOCK
 	SSLockDeadlock = "40001"
 
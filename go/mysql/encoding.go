@@ -19,6 +19,7 @@ package mysql
 import (
 	"bytes"
 	"encoding/binary"
+	"math/bits"
 )
 
 // This file contains the data encoding and decoding functions.
@@ -76,6 +77,36 @@ func writeLenEncInt(data []byte, pos int, i uint64) int {
 	}
 }
 
+// varLenIntSize returns the number of bytes required to encode an
+// integer in the variable-length format of the MySQL 8.0 binary
+// serialization library (libs/mysql/serialization), used for instance
+// by tagged GTID events: the number of extra bytes is the number of
+// trailing 1 bits of the first byte, and the value is stored little
+// endian in the remaining bits.
+func varLenIntSize(i uint64) int {
+	for n := 1; n < 9; n++ {
+		if i < 1<<(7*n) {
+			return n
+		}
+	}
+	return 9
+}
+
+func writeVarLenInt(data []byte, pos int, i uint64) int {
+	n := varLenIntSize(i)
+	if n == 9 {
+		data[pos] = 0xff
+		return writeUint64(data, pos+1, i)
+	}
+	data[pos] = byte(1<<(n-1)-1) | byte(i<<n)
+	i >>= 8 - n
+	for j := 1; j < n; j++ {
+		data[pos+j] = byte(i)
+		i >>= 8
+	}
+	return pos + n
+}
+
 func lenNullString(value string) int {
 	return len(value) + 1
 }
@@ -246,6 +277,39 @@ func readLenEncInt(data []byte, pos int) (uint64, int, bool) {
 	return uint64(data[pos]), pos + 1, true
 }
 
+func readVarLenInt(data []byte, pos int) (uint64, int, bool) {
+	if pos >= len(data) {
+		return 0, 0, false
+	}
+	n := bits.TrailingZeros8(^data[pos]) + 1
+	if n == 9 {
+		return readUint64(data, pos+1)
+	}
+	if pos+n > len(data) {
+		return 0, 0, false
+	}
+	i := uint64(data[pos]) >> n
+	for j := 1; j < n; j++ {
+		i |= uint64(data[pos+j]) << (8*j - n)
+	}
+	return i, pos + n, true
+}
+
+// readVarLenSignedInt reads a signed integer in the variable-length
+// format of the MySQL 8.0 binary serialization library: the sign is
+// stored in the lowest bit, and the rest is the value, or its
+// complement if negative.
+func readVarLenSignedInt(data []byte, pos int) (int64, int, bool) {
+	i, pos, ok := readVarLenInt(data, pos)
+	if !ok {
+		return 0, 0, false
+	}
+	if i&1 != 0 {
+		return ^int64(i >> 1), pos, true
+	}
+	return int64(i >> 1), pos, true
+}
+
 func readLenEncString(data []byte, pos int) (string, int, bool) {
 	size, pos, ok := readLenEncInt(data, pos)
 	if !ok {
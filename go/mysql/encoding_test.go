@@ -83,6 +83,54 @@ func TestEncLenInt(t *testing.T) {
 	}
 }
 
+func TestEncVarLenInt(t *testing.T) {
+	tests := []struct {
+		value   uint64
+		encoded []byte
+	}{
+		{0x00, []byte{0x00}},
+		{0x01, []byte{0x02}},
+		{0x7f, []byte{0xfe}},
+		{0x80, []byte{0x01, 0x02}},
+		{0x3fff, []byte{0xfd, 0xff}},
+		{0x4000, []byte{0x03, 0x00, 0x02}},
+		{0x00ffffffffffffff, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{0xa0a1a2a3a4a5a6a7, []byte{0xff, 0xa7, 0xa6, 0xa5, 0xa4, 0xa3, 0xa2, 0xa1, 0xa0}},
+	}
+	for _, test := range tests {
+		if got := varLenIntSize(test.value); got != len(test.encoded) {
+			t.Errorf("varLenIntSize returned %v but expected %v for %x", got, len(test.encoded), test.value)
+		}
+
+		data := make([]byte, len(test.encoded)+1)
+		pos := writeVarLenInt(data, 1, test.value)
+		if pos != len(test.encoded)+1 {
+			t.Errorf("unexpected pos %v after writeVarLenInt(%x, 1), expected %v", pos, test.value, len(test.encoded)+1)
+		}
+		if !bytes.Equal(data[1:], test.encoded) {
+			t.Errorf("unexpected encoded value for %x, got %v expected %v", test.value, data[1:], test.encoded)
+		}
+
+		got, pos, ok := readVarLenInt(test.encoded, 0)
+		if !ok || got != test.value || pos != len(test.encoded) {
+			t.Errorf("readVarLenInt returned %x/%v/%v but expected %x/%v/%v", got, pos, ok, test.value, len(test.encoded), true)
+		}
+
+		_, _, ok = readVarLenInt(test.encoded[:len(test.encoded)-1], 0)
+		if ok {
+			t.Errorf("readVarLenInt returned ok=true for shorter value %x", test.value)
+		}
+	}
+
+	// Signed values have their sign in the lowest bit.
+	for encoded, want := range map[byte]int64{0x00: 0, 0x04: 1, 0x06: -2, 0x02: -1} {
+		got, _, ok := readVarLenSignedInt([]byte{encoded}, 0)
+		if !ok || got != want {
+			t.Errorf("readVarLenSignedInt(%x) returned %v/%v but expected %v", encoded, got, ok, want)
+		}
+	}
+}
+
 func TestEncUint16(t *testing.T) {
 	data := make([]byte, 10)
 
@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakesqldb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// ScriptStep is one step of a scripted conversation with the DB.
+// Once a script is set with AddScript, every query received by the DB
+// consumes the next step, in order. This makes it possible to reproduce
+// protocol edge cases like killed queries or partial results.
+type ScriptStep struct {
+	// Query is the query expected for this step. A trailing '*'
+	// matches any query starting with the given prefix, and an empty
+	// Query matches any query.
+	Query string
+
+	// Result and Error are returned for the query. Error takes
+	// precedence if both are set.
+	Result *sqltypes.Result
+	Error  error
+
+	// Respond, if set, is called with the actual query and its return
+	// values are used instead of Result and Error. It can be used to
+	// return different responses depending on the query or on the test
+	// state.
+	Respond func(query string) (*sqltypes.Result, error)
+
+	// Delay is waited for before responding, to simulate a slow query.
+	Delay time.Duration
+
+	// Disconnect closes the connection after sending the fields and the
+	// first RowsBeforeDisconnect rows of the result, simulating a server
+	// that goes away in the middle of a result set. If the result has no
+	// fields, the connection is closed without sending anything.
+	Disconnect           bool
+	RowsBeforeDisconnect int
+}
+
+// AddScript appends steps to the script of the DB. While a script is
+// set, it takes precedence over all the other ways of setting up
+// expected queries.
+func (db *DB) AddScript(steps ...ScriptStep) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.scripted = true
+	db.script = append(db.script, steps...)
+}
+
+// ResetScript removes the script and goes back to the other ways of
+// setting up expected queries.
+func (db *DB) ResetScript() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.scripted = false
+	db.script = nil
+	db.scriptIndex = 0
+}
+
+// comQueryScripted plays back the next step of the script for query.
+func (db *DB) comQueryScripted(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	// Same as for ordered queries, we skip the initial queries sent
+	// when a connection is created to ease the test readability.
+	if strings.HasPrefix(query, "SET collation_connection =") || strings.EqualFold(query, "use `fakesqldb`") {
+		return callback(&sqltypes.Result{})
+	}
+
+	db.mu.Lock()
+	index := db.scriptIndex
+	if index >= len(db.script) {
+		db.mu.Unlock()
+		db.t.Errorf("%v: got unexpected query past the end of the script (index=%v): %v", db.name, index, query)
+		return errors.New("unexpected query past the end of the script")
+	}
+	step := db.script[index]
+	db.scriptIndex++
+	db.querylog = append(db.querylog, strings.ToLower(query))
+	db.mu.Unlock()
+
+	// The rest is done without holding the lock, so a delayed or
+	// disconnecting step doesn't block the other connections.
+	if expected := step.Query; expected != "" {
+		if strings.HasSuffix(expected, "*") {
+			if !strings.HasPrefix(query, expected[0:len(expected)-1]) {
+				db.t.Errorf("%v: got unexpected query start (index=%v): %v != %v", db.name, index, query, expected)
+				return errors.New("unexpected query")
+			}
+		} else if query != expected {
+			db.t.Errorf("%v: got unexpected query (index=%v): %v != %v", db.name, index, query, expected)
+			return errors.New("unexpected query")
+		}
+	}
+
+	if step.Delay > 0 {
+		time.Sleep(step.Delay)
+	}
+
+	result, err := step.Result, step.Error
+	if step.Respond != nil {
+		result, err = step.Respond(query)
+	}
+
+	if step.Disconnect {
+		return disconnectMidResult(c, result, step.RowsBeforeDisconnect, callback)
+	}
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		result = &sqltypes.Result{}
+	}
+	return callback(result)
+}
+
+// disconnectMidResult sends the fields and the first rows of result to
+// the client, and closes the connection.
+func disconnectMidResult(c *mysql.Conn, result *sqltypes.Result, rows int, callback func(*sqltypes.Result) error) error {
+	if result != nil && len(result.Fields) > 0 {
+		if rows > len(result.Rows) {
+			rows = len(result.Rows)
+		}
+		partial := &sqltypes.Result{
+			Fields: result.Fields,
+			Rows:   result.Rows[:rows],
+		}
+		if err := callback(partial); err != nil {
+			return err
+		}
+		if err := c.FlushBuffer(); err != nil {
+			return err
+		}
+	}
+	c.Close()
+	return fmt.Errorf("fakesqldb: disconnected in the middle of the result set")
+}
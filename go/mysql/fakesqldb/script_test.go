@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakesqldb
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestScript(t *testing.T) {
+	db := New(t)
+	defer db.Close()
+
+	result := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id", "int64"), "1", "2", "3")
+	killed := mysql.NewSQLError(mysql.ERQueryInterrupted, mysql.SSQueryInterrupted, "Query execution was interrupted")
+	db.AddScript(
+		ScriptStep{Query: "select 1", Result: result},
+		ScriptStep{Query: "select * from t where id = *", Respond: func(query string) (*sqltypes.Result, error) {
+			if strings.HasSuffix(query, "= 2") {
+				return sqltypes.MakeTestResult(result.Fields, "2"), nil
+			}
+			return &sqltypes.Result{Fields: result.Fields}, nil
+		}},
+		ScriptStep{Query: "select sleep(1)", Delay: 10 * time.Millisecond, Error: killed},
+		ScriptStep{Query: "select * from t", Result: result, Disconnect: true, RowsBeforeDisconnect: 2},
+	)
+
+	ctx := context.Background()
+	params := db.ConnParams()
+	conn, err := params.Connect(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	qr, err := conn.ExecuteFetch("select 1", 10, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(qr.Rows))
+
+	qr, err = conn.ExecuteFetch("select * from t where id = 2", 10, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(qr.Rows))
+
+	start := time.Now()
+	_, err = conn.ExecuteFetch("select sleep(1)", 10, true)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok, "unexpected error type: %v", err)
+	assert.Equal(t, mysql.ERQueryInterrupted, sqlErr.Number())
+
+	require.NoError(t, conn.ExecuteStreamFetch("select * from t"))
+	_, err = conn.Fields()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		row, err := conn.FetchNext(nil)
+		require.NoError(t, err)
+		require.NotNil(t, row)
+	}
+	_, err = conn.FetchNext(nil)
+	require.Error(t, err)
+	assert.True(t, mysql.IsConnLostDuringQuery(err), "unexpected error: %v", err)
+
+	db.VerifyAllExecutedOrFail()
+	assert.Equal(t, "select 1;select * from t where id = 2;select sleep(1);select * from t", db.QueryLog())
+
+	// Once reset, the DB goes back to the regular expectations.
+	db.ResetScript()
+	db.AddQuery("select 2", result)
+	conn, err = params.Connect(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecuteFetch("select 2", 10, true)
+	require.NoError(t, err)
+}
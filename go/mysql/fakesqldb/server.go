@@ -114,6 +114,16 @@ type DB struct {
 	// should respond with the last entry from the list.
 	infinite bool
 
+	// This next set of fields is used when a script is set with AddScript().
+
+	// scripted is true when a script is set. It takes precedence over
+	// all the other ways of setting up expected queries.
+	scripted bool
+	// script is the list of steps to play back.
+	script []ScriptStep
+	// scriptIndex is the index of the next step to play back.
+	scriptIndex int
+
 	// connections tracks all open connections.
 	// The key for the map is the value of mysql.Conn.ConnectionID.
 	connections map[uint32]*mysql.Conn
@@ -342,6 +352,13 @@ func (db *DB) HandleQuery(c *mysql.Conn, query string, callback func(*sqltypes.R
 		return callback(&sqltypes.Result{})
 	}
 
+	db.mu.Lock()
+	scripted := db.scripted
+	db.mu.Unlock()
+	if scripted {
+		return db.comQueryScripted(c, query, callback)
+	}
+
 	if db.orderMatters {
 		result, err := db.comQueryOrdered(query)
 		if err != nil {
@@ -728,6 +745,9 @@ func (db *DB) VerifyAllExecutedOrFail() {
 	if db.expectedExecuteFetchIndex != len(db.expectedExecuteFetch) {
 		db.t.Errorf("%v: not all expected queries were executed. leftovers: %v", db.name, db.expectedExecuteFetch[db.expectedExecuteFetchIndex:])
 	}
+	if db.scriptIndex != len(db.script) {
+		db.t.Errorf("%v: not all script steps were played back. leftovers: %v", db.name, db.script[db.scriptIndex:])
+	}
 }
 
 func (db *DB) SetNeverFail(neverFail bool) {
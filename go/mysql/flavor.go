@@ -363,9 +363,23 @@ func (c *Conn) SendBinlogDumpCommand(serverID uint32, startPos Position) error {
 }
 
 // ReadBinlogEvent reads the next BinlogEvent. This must be used
-// in conjunction with SendBinlogDumpCommand.
+// in conjunction with SendBinlogDumpCommand. The events are filtered
+// by the filter set with SetBinlogFilter, if any.
 func (c *Conn) ReadBinlogEvent() (BinlogEvent, error) {
-	return c.flavor.readBinlogEvent(c)
+	for {
+		ev, err := c.flavor.readBinlogEvent(c)
+		if err != nil || c.binlogFilter == nil {
+			return ev, err
+		}
+		keep, err := c.binlogFilter.keep(ev)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			return ev, nil
+		}
+		binlogFilterSkippedEvents.Add(1)
+	}
 }
 
 // ResetReplicationCommands returns the commands to completely reset
@@ -124,14 +124,28 @@ func TestMysqlShouldGetRelayLogPosition(t *testing.T) {
 
 	sid, _ := ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
 	want := ReplicationStatus{
-		Position:         Position{GTIDSet: Mysql56GTIDSet{sid: []interval{{start: 1, end: 5}}}},
-		RelayLogPosition: Position{GTIDSet: Mysql56GTIDSet{sid: []interval{{start: 1, end: 9}}}},
+		Position:         Position{GTIDSet: Mysql56GTIDSet{sid: newIntervalTree([]interval{{start: 1, end: 5}})}},
+		RelayLogPosition: Position{GTIDSet: Mysql56GTIDSet{sid: newIntervalTree([]interval{{start: 1, end: 9}})}},
 	}
 	got, err := parseMysqlReplicationStatus(resultMap)
 	require.NoError(t, err)
 	assert.Equalf(t, got.RelayLogPosition.GTIDSet.String(), want.RelayLogPosition.GTIDSet.String(), "got RelayLogPosition: %v; want RelayLogPosition: %v", got.RelayLogPosition.GTIDSet, want.RelayLogPosition.GTIDSet)
 }
 
+func TestMysqlShouldGetTaggedRelayLogPosition(t *testing.T) {
+	resultMap := map[string]string{
+		"Executed_Gtid_Set":  "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:tag1:1-3,\n4e11fa47-71ca-11e1-9e33-c80aa9429562:tag2:1",
+		"Retrieved_Gtid_Set": "3e11fa47-71ca-11e1-9e33-c80aa9429562:6-9:tag1:4-5",
+	}
+
+	got, err := parseMysqlReplicationStatus(resultMap)
+	require.NoError(t, err)
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:tag1:1-3,4e11fa47-71ca-11e1-9e33-c80aa9429562:tag2:1", got.Position.GTIDSet.String())
+	assert.Equal(t, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-9:tag1:1-5,4e11fa47-71ca-11e1-9e33-c80aa9429562:tag2:1", got.RelayLogPosition.GTIDSet.String())
+	assert.True(t, got.RelayLogPosition.AtLeast(got.Position))
+	assert.False(t, got.Position.AtLeast(got.RelayLogPosition))
+}
+
 func TestMysqlShouldGetPosition(t *testing.T) {
 	resultMap := map[string]string{
 		"Executed_Gtid_Set": "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
@@ -141,7 +155,7 @@ func TestMysqlShouldGetPosition(t *testing.T) {
 
 	sid, _ := ParseSID("3e11fa47-71ca-11e1-9e33-c80aa9429562")
 	want := PrimaryStatus{
-		Position:     Position{GTIDSet: Mysql56GTIDSet{sid: []interval{{start: 1, end: 5}}}},
+		Position:     Position{GTIDSet: Mysql56GTIDSet{sid: newIntervalTree([]interval{{start: 1, end: 5}})}},
 		FilePosition: Position{GTIDSet: filePosGTID{file: "source-bin.000003", pos: 1307}},
 	}
 	got, err := parseMysqlPrimaryStatus(resultMap)
@@ -112,44 +112,40 @@ func (mysqlGRFlavor) setReplicationPositionCommands(pos Position) []string {
 // from replication_connection_status and the current processing txn's commit timestamp
 func (mysqlGRFlavor) status(c *Conn) (ReplicationStatus, error) {
 	res := ReplicationStatus{}
-	// Get primary node information
-	query := `SELECT
-		MEMBER_HOST,
-		MEMBER_PORT
-	FROM
-		performance_schema.replication_group_members
-	WHERE
-		MEMBER_ROLE='PRIMARY' AND MEMBER_STATE='ONLINE'`
-	err := fetchStatusForGroupReplication(c, query, func(values []sqltypes.Value) error {
-		parsePrimaryGroupMember(&res, values)
-		return nil
-	})
+	// Get the members of the group, to find the primary and the
+	// state of this node.
+	qr, err := c.ExecuteFetch(groupReplicationMembersQuery, 100, false /* wantfields */)
 	if err != nil {
 		return ReplicationStatus{}, err
 	}
-
-	query = `SELECT
-		MEMBER_STATE
-	FROM
-		performance_schema.replication_group_members
-	WHERE
-		MEMBER_HOST=convert(@@hostname using ascii) AND MEMBER_PORT=@@port`
-	var chanel string
-	err = fetchStatusForGroupReplication(c, query, func(values []sqltypes.Value) error {
-		state := values[0].ToString()
-		if state == "ONLINE" {
-			chanel = "group_replication_applier"
-		} else if state == "RECOVERING" {
-			chanel = "group_replication_recovery"
-		} else { // OFFLINE, ERROR, UNREACHABLE
-			// If the member is not in healthy state, use max int as lag
-			res.ReplicationLagSeconds = math.MaxUint32
-		}
-		return nil
-	})
+	group, err := parseGroupReplicationMembers(qr.Rows)
 	if err != nil {
 		return ReplicationStatus{}, err
 	}
+	primary, local := group.Primary(), group.LocalMember()
+	// if there is no primary or this node is not in the group, it means
+	// the group replication is not set up
+	if primary == nil || local == nil {
+		return ReplicationStatus{}, ErrNoGroupStatus
+	}
+	res.SourceHost = primary.Host
+	res.SourcePort = primary.Port
+	res.GroupReplication = group
+
+	var chanel string
+	switch local.State {
+	case GroupMemberStateOnline:
+		chanel = "group_replication_applier"
+	case GroupMemberStateRecovering:
+		chanel = "group_replication_recovery"
+	default: // OFFLINE, ERROR, UNREACHABLE
+		// If the member is not in healthy state, use max int as lag,
+		// and report the state of the member.
+		res.ReplicationLagSeconds = math.MaxUint32
+		res.IOState = local.ReplicationState()
+		res.SQLState = local.ReplicationState()
+		res.LastIOError = fmt.Sprintf("group replication member is %v", local.State)
+	}
 	// if chanel is not set, it means the state is not ONLINE or RECOVERING
 	// return partial result early
 	if chanel == "" {
@@ -157,7 +153,7 @@ func (mysqlGRFlavor) status(c *Conn) (ReplicationStatus, error) {
 	}
 
 	// Populate IOState from replication_connection_status
-	query = fmt.Sprintf(`SELECT SERVICE_STATE
+	query := fmt.Sprintf(`SELECT SERVICE_STATE
 		FROM performance_schema.replication_connection_status
 		WHERE CHANNEL_NAME='%s'`, chanel)
 	var connectionState ReplicationState
@@ -202,12 +198,6 @@ func (mysqlGRFlavor) status(c *Conn) (ReplicationStatus, error) {
 	return res, nil
 }
 
-func parsePrimaryGroupMember(res *ReplicationStatus, row []sqltypes.Value) {
-	res.SourceHost = row[0].ToString() /* MEMBER_HOST */
-	memberPort, _ := row[1].ToInt64()  /* MEMBER_PORT */
-	res.SourcePort = int(memberPort)
-}
-
 func parseReplicationApplierLag(res *ReplicationStatus, row []sqltypes.Value) {
 	lagSec, err := row[0].ToInt64()
 	// if the error is not nil, ReplicationLagSeconds will remain to be MaxUint32
@@ -24,17 +24,70 @@ import (
 	querypb "vitess.io/vitess/go/vt/proto/query"
 )
 
-func TestMysqlGRParsePrimaryGroupMember(t *testing.T) {
-	res := ReplicationStatus{}
-	rows := []sqltypes.Value{
-		sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("host1")),
-		sqltypes.MakeTrusted(querypb.Type_INT32, []byte("10")),
+func TestMysqlGRParseGroupReplicationMembers(t *testing.T) {
+	row := func(values ...string) []sqltypes.Value {
+		var result []sqltypes.Value
+		for i, v := range values {
+			switch {
+			case v == "NULL":
+				result = append(result, sqltypes.NULL)
+			case i == 2 || i == 5:
+				result = append(result, sqltypes.MakeTrusted(querypb.Type_INT64, []byte(v)))
+			case i > 5:
+				result = append(result, sqltypes.MakeTrusted(querypb.Type_UINT64, []byte(v)))
+			default:
+				result = append(result, sqltypes.NewVarChar(v))
+			}
+		}
+		return result
+	}
+	rows := [][]sqltypes.Value{
+		row("uuid1", "host1", "10", "ONLINE", "PRIMARY", "0", "1", "2", "100", "3"),
+		row("uuid2", "host2", "20", "RECOVERING", "SECONDARY", "1", "NULL", "NULL", "NULL", "NULL"),
+		row("uuid3", "host3", "30", "UNREACHABLE", "SECONDARY", "0", "0", "50", "90", "0"),
+	}
+	status, err := parseGroupReplicationMembers(rows)
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(status.Members))
+
+	primary := status.Primary()
+	assert.Equal(t, "host1", primary.Host)
+	assert.Equal(t, 10, primary.Port)
+	assert.Equal(t, ReplicationStateRunning, primary.ReplicationState())
+	assert.Equal(t, int64(1), primary.TransactionsInQueue)
+	assert.Equal(t, int64(2), primary.TransactionsRemoteInApplierQueue)
+	assert.Equal(t, int64(100), primary.TransactionsChecked)
+	assert.Equal(t, int64(3), primary.ConflictsDetected)
+
+	local := status.LocalMember()
+	assert.Equal(t, "uuid2", local.ID)
+	assert.Equal(t, ReplicationStateConnecting, local.ReplicationState())
+	assert.Equal(t, int64(0), local.TransactionsInQueue)
+
+	assert.Equal(t, ReplicationStateUnknown, status.Members[2].ReplicationState())
+	assert.Equal(t, int64(50), status.Members[2].TransactionsRemoteInApplierQueue)
+
+	// Without an ONLINE primary, there is no primary.
+	status, err = parseGroupReplicationMembers(rows[1:])
+	assert.NilError(t, err)
+	assert.Assert(t, status.Primary() == nil)
+
+	_, err = parseGroupReplicationMembers([][]sqltypes.Value{row("uuid1", "host1")})
+	assert.ErrorContains(t, err, "unexpected group replication member row")
+}
+
+func TestMysqlGRMemberReplicationState(t *testing.T) {
+	for state, want := range map[string]ReplicationState{
+		GroupMemberStateOnline:      ReplicationStateRunning,
+		GroupMemberStateRecovering:  ReplicationStateConnecting,
+		GroupMemberStateOffline:     ReplicationStateStopped,
+		GroupMemberStateError:       ReplicationStateStopped,
+		GroupMemberStateUnreachable: ReplicationStateUnknown,
+		"":                          ReplicationStateUnknown,
+	} {
+		member := &GroupMember{State: state}
+		assert.Equal(t, want, member.ReplicationState(), state)
 	}
-	parsePrimaryGroupMember(&res, rows)
-	assert.Equal(t, "host1", res.SourceHost)
-	assert.Equal(t, 10, res.SourcePort)
-	assert.Equal(t, ReplicationStateUnknown, res.IOState)
-	assert.Equal(t, ReplicationStateUnknown, res.SQLState)
 }
 
 func TestMysqlGRReplicationApplierLagParse(t *testing.T) {
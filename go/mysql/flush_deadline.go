@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+)
+
+var flushTimeouts = stats.NewCounter("MysqlServerFlushTimeouts", "Connections closed because the client did not read its results within the flush timeout")
+
+// flushDeadlineConn wraps the network connection of a server Conn when
+// its Listener has a FlushTimeout. While results are sent, the writes
+// fail if they are still blocked at the flush deadline, so a client
+// that stops reading can't block the go routine serving it forever.
+type flushDeadlineConn struct {
+	net.Conn
+	timeout time.Duration
+
+	mu sync.Mutex
+	// flushes is the number of flushes in progress. They can overlap
+	// when the flush timer fires while a result is written.
+	flushes int
+	// flushDeadline is set while flushes is non-zero.
+	flushDeadline time.Time
+	// writeDeadline is the deadline set with SetWriteDeadline, e.g.
+	// by a netutil.ConnWithTimeouts wrapping this one.
+	writeDeadline time.Time
+}
+
+func newFlushDeadlineConn(conn net.Conn, timeout time.Duration) *flushDeadlineConn {
+	return &flushDeadlineConn{
+		Conn:    conn,
+		timeout: timeout,
+	}
+}
+
+// startFlush sets the flush deadline, unless a flush is already in
+// progress.
+func (fc *flushDeadlineConn) startFlush() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.flushes == 0 {
+		fc.flushDeadline = time.Now().Add(fc.timeout)
+	}
+	fc.flushes++
+}
+
+// endFlush clears the flush deadline once all flushes are done.
+func (fc *flushDeadlineConn) endFlush() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.flushes--
+	if fc.flushes == 0 {
+		fc.flushDeadline = time.Time{}
+	}
+}
+
+// SetDeadline is part of the net.Conn interface.
+func (fc *flushDeadlineConn) SetDeadline(t time.Time) error {
+	if err := fc.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return fc.SetWriteDeadline(t)
+}
+
+// SetWriteDeadline is part of the net.Conn interface. The deadline is
+// applied by Write, along with the flush deadline.
+func (fc *flushDeadlineConn) SetWriteDeadline(t time.Time) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.writeDeadline = t
+	return nil
+}
+
+// Write is part of the net.Conn interface. It uses the earliest of the
+// write and flush deadlines, and returns an ERNetWriteInterrupted error
+// if the flush deadline expires.
+func (fc *flushDeadlineConn) Write(b []byte) (int, error) {
+	fc.mu.Lock()
+	deadline, flushing := fc.writeDeadline, false
+	if !fc.flushDeadline.IsZero() && (deadline.IsZero() || fc.flushDeadline.Before(deadline)) {
+		deadline, flushing = fc.flushDeadline, true
+	}
+	fc.mu.Unlock()
+
+	if err := fc.Conn.SetWriteDeadline(deadline); err != nil {
+		return 0, err
+	}
+	n, err := fc.Conn.Write(b)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && flushing {
+		flushTimeouts.Add(1)
+		return n, NewSQLError(ERNetWriteInterrupted, SSNetError, "client did not read its results for %v (mysql_server_flush_timeout), giving up: %v", fc.timeout, err)
+	}
+	return n, err
+}
+
+// startFlush bounds the time writes to the client can block, if the
+// listener has a FlushTimeout. It must be followed by endFlush.
+func (c *Conn) startFlush() {
+	if c.flushDeadlineConn != nil {
+		c.flushDeadlineConn.startFlush()
+	}
+}
+
+// endFlush ends what startFlush started.
+func (c *Conn) endFlush() {
+	if c.flushDeadlineConn != nil {
+		c.flushDeadlineConn.endFlush()
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// streamingHandler streams rows until the callback fails, and reports
+// the error.
+type streamingHandler struct {
+	testHandler
+	errors chan error
+}
+
+func (h *streamingHandler) ComQuery(c *Conn, query string, callback func(*sqltypes.Result) error) error {
+	fields := []*querypb.Field{{Name: "value", Type: querypb.Type_VARCHAR}}
+	row := []sqltypes.Value{sqltypes.NewVarChar(strings.Repeat("x", 64*1024))}
+	if err := callback(&sqltypes.Result{Fields: fields}); err != nil {
+		h.errors <- err
+		return err
+	}
+	for {
+		if err := callback(&sqltypes.Result{Rows: [][]sqltypes.Value{row}}); err != nil {
+			h.errors <- err
+			return err
+		}
+	}
+}
+
+func TestFlushTimeout(t *testing.T) {
+	handler := &streamingHandler{errors: make(chan error, 1)}
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{{
+		Password: "password1",
+	}}
+	defer authServer.close()
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, handler, 0, 0, false)
+	require.NoError(t, err)
+	defer l.Close()
+	l.FlushTimeout.Set(100 * time.Millisecond)
+	go l.Accept()
+
+	params := &ConnParams{
+		Host:  "127.0.0.1",
+		Port:  l.Addr().(*net.TCPAddr).Port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+	conn, err := Connect(context.Background(), params)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Send a query and never read its results.
+	before := flushTimeouts.Get()
+	require.NoError(t, conn.WriteComQuery("select value from t"))
+	select {
+	case err := <-handler.errors:
+		assertSQLError(t, vterrors.RootCause(err), ERNetWriteInterrupted, SSNetError, "did not read its results", "", "")
+	case <-time.After(10 * time.Second):
+		t.Fatal("the query was not cancelled")
+	}
+	assert.Equal(t, before+1, flushTimeouts.Get())
+}
+
+func TestFlushDeadlineConn(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	fc := newFlushDeadlineConn(sConn.conn, time.Hour)
+	fc.startFlush()
+	deadline := fc.flushDeadline
+	assert.False(t, deadline.IsZero())
+
+	// Nested flushes keep the first deadline until they are all done.
+	fc.startFlush()
+	assert.Equal(t, deadline, fc.flushDeadline)
+	fc.endFlush()
+	assert.Equal(t, deadline, fc.flushDeadline)
+	fc.endFlush()
+	assert.True(t, fc.flushDeadline.IsZero())
+
+	// Outside of flushes, writes are not bounded, unless a write
+	// deadline is set.
+	require.NoError(t, fc.SetWriteDeadline(time.Now().Add(-time.Second)))
+	_, err := fc.Write([]byte{1})
+	require.Error(t, err)
+	_, ok := err.(*SQLError)
+	assert.False(t, ok, "only flush timeouts should be reported as such: %v", err)
+
+	require.NoError(t, fc.SetWriteDeadline(time.Time{}))
+	_, err = fc.Write([]byte{1})
+	require.NoError(t, err)
+}
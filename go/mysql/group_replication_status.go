@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// Group Replication member states, as found in the MEMBER_STATE column
+// of performance_schema.replication_group_members.
+const (
+	GroupMemberStateOnline      = "ONLINE"
+	GroupMemberStateRecovering  = "RECOVERING"
+	GroupMemberStateOffline     = "OFFLINE"
+	GroupMemberStateError       = "ERROR"
+	GroupMemberStateUnreachable = "UNREACHABLE"
+)
+
+// Group Replication member roles, as found in the MEMBER_ROLE column
+// of performance_schema.replication_group_members.
+const (
+	GroupMemberRolePrimary   = "PRIMARY"
+	GroupMemberRoleSecondary = "SECONDARY"
+)
+
+// groupReplicationMembersQuery lists the members of the group, with
+// their stats, and tells which one is the server running the query.
+const groupReplicationMembersQuery = `SELECT
+		m.MEMBER_ID,
+		m.MEMBER_HOST,
+		m.MEMBER_PORT,
+		m.MEMBER_STATE,
+		m.MEMBER_ROLE,
+		m.MEMBER_HOST=convert(@@hostname using ascii) AND m.MEMBER_PORT=@@port,
+		s.COUNT_TRANSACTIONS_IN_QUEUE,
+		s.COUNT_TRANSACTIONS_REMOTE_IN_APPLIER_QUEUE,
+		s.COUNT_TRANSACTIONS_CHECKED,
+		s.COUNT_CONFLICTS_DETECTED
+	FROM
+		performance_schema.replication_group_members m
+		LEFT JOIN performance_schema.replication_group_member_stats s ON s.MEMBER_ID=m.MEMBER_ID`
+
+// GroupReplicationStatus holds the status of a Group Replication group,
+// as seen by one of its members.
+type GroupReplicationStatus struct {
+	Members []GroupMember
+}
+
+// GroupMember holds the status of a member of a Group Replication group,
+// from performance_schema.replication_group_members and
+// performance_schema.replication_group_member_stats.
+type GroupMember struct {
+	ID    string
+	Host  string
+	Port  int
+	State string
+	Role  string
+	// Local is set for the member the status was read from.
+	Local bool
+
+	// The flow control stats. Flow control throttles the writers of
+	// the group when the certifier or applier queue of a member grows
+	// beyond group_replication_flow_control_certifier_threshold or
+	// group_replication_flow_control_applier_threshold.
+
+	// TransactionsInQueue is the number of transactions waiting for
+	// certification.
+	TransactionsInQueue int64
+	// TransactionsRemoteInApplierQueue is the number of transactions
+	// received from the group waiting to be applied.
+	TransactionsRemoteInApplierQueue int64
+	// TransactionsChecked is the number of transactions certified.
+	TransactionsChecked int64
+	// ConflictsDetected is the number of transactions that failed
+	// certification.
+	ConflictsDetected int64
+}
+
+// Primary returns the ONLINE primary member of the group, or nil if
+// there is none.
+func (s *GroupReplicationStatus) Primary() *GroupMember {
+	for i := range s.Members {
+		if s.Members[i].Role == GroupMemberRolePrimary && s.Members[i].State == GroupMemberStateOnline {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// LocalMember returns the member the status was read from, or nil if
+// it is not a member of the group.
+func (s *GroupReplicationStatus) LocalMember() *GroupMember {
+	for i := range s.Members {
+		if s.Members[i].Local {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// ReplicationState maps the state of the member to a ReplicationState:
+// ONLINE is running, RECOVERING is connecting, OFFLINE and ERROR are
+// stopped. Any other state, like UNREACHABLE, is unknown.
+func (m *GroupMember) ReplicationState() ReplicationState {
+	switch m.State {
+	case GroupMemberStateOnline:
+		return ReplicationStateRunning
+	case GroupMemberStateRecovering:
+		return ReplicationStateConnecting
+	case GroupMemberStateOffline, GroupMemberStateError:
+		return ReplicationStateStopped
+	default:
+		return ReplicationStateUnknown
+	}
+}
+
+// parseGroupReplicationMembers parses the rows returned by
+// groupReplicationMembersQuery.
+func parseGroupReplicationMembers(rows [][]sqltypes.Value) (*GroupReplicationStatus, error) {
+	status := &GroupReplicationStatus{
+		Members: make([]GroupMember, 0, len(rows)),
+	}
+	for _, row := range rows {
+		if len(row) != 10 {
+			return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "unexpected group replication member row: %v", row)
+		}
+		port, err := row[2].ToInt64()
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "invalid MEMBER_PORT for group replication member %v", row[0].ToString())
+		}
+		local, _ := row[5].ToInt64()
+		member := GroupMember{
+			ID:    row[0].ToString(),
+			Host:  row[1].ToString(),
+			Port:  int(port),
+			State: row[3].ToString(),
+			Role:  row[4].ToString(),
+			Local: local == 1,
+		}
+		// The stats are NULL while the member is not ONLINE.
+		member.TransactionsInQueue, _ = row[6].ToInt64()
+		member.TransactionsRemoteInApplierQueue, _ = row[7].ToInt64()
+		member.TransactionsChecked, _ = row[8].ToInt64()
+		member.ConflictsDetected, _ = row[9].ToInt64()
+		status.Members = append(status.Members, member)
+	}
+	return status, nil
+}
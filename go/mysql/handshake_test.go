@@ -24,6 +24,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"vitess.io/vitess/go/test/utils"
 
 	"vitess.io/vitess/go/vt/tlstest"
@@ -210,3 +213,69 @@ func testSSLConnectionBasics(t *testing.T, params *ConnParams) {
 	// Send a ComQuit to avoid the error message on the server side.
 	conn.writeComQuit()
 }
+
+// recordingConn is a net.Conn that records everything written to it.
+type recordingConn struct {
+	net.Conn
+	written []byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.written = append(c.written[:0], b...)
+	return len(b), nil
+}
+
+func TestHandshakeV10Template(t *testing.T) {
+	l := &Listener{}
+	authServer := NewAuthServerNone()
+
+	rc := &recordingConn{}
+	c := newServerConn(rc, l)
+	c.ConnectionID = 42
+	c.StatusFlags = ServerStatusAutocommit
+
+	salt, err := c.writeHandshakeV10("8.0.30-Vitess", authServer, true)
+	require.NoError(t, err)
+	require.Len(t, salt, 21)
+	require.Zero(t, salt[20])
+
+	client := newConn(nil)
+	capabilities, clientSalt, err := client.parseInitialHandshakePacket(rc.written[packetHeaderSize:])
+	require.NoError(t, err)
+	assert.Equal(t, salt[:20], clientSalt)
+	assert.Equal(t, uint32(42), client.ConnectionID)
+	assert.Equal(t, "8.0.30-Vitess", client.ServerVersion)
+	assert.Equal(t, MysqlNativePassword, client.authPluginName)
+	assert.NotZero(t, capabilities&CapabilityClientSSL)
+
+	// A second connection reuses the template but gets its own salt.
+	first := l.handshake.Load()
+	c2 := newServerConn(rc, l)
+	c2.ConnectionID = 43
+	salt2, err := c2.writeHandshakeV10("8.0.30-Vitess", authServer, true)
+	require.NoError(t, err)
+	assert.True(t, first == l.handshake.Load())
+	assert.NotEqual(t, salt, salt2)
+
+	// Changing a parameter rebuilds the template.
+	_, err = c2.writeHandshakeV10("8.0.30-Vitess", authServer, false)
+	require.NoError(t, err)
+	assert.False(t, first == l.handshake.Load())
+	capabilities, _, err = client.parseInitialHandshakePacket(rc.written[packetHeaderSize:])
+	require.NoError(t, err)
+	assert.Zero(t, capabilities&CapabilityClientSSL)
+}
+
+func BenchmarkWriteHandshakeV10(b *testing.B) {
+	l := &Listener{}
+	authServer := NewAuthServerNone()
+	c := newServerConn(&recordingConn{}, l)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.writeHandshakeV10("8.0.30-Vitess", authServer, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
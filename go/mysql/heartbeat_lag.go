@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	"vitess.io/vitess/go/sqlescape"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// serverTimeQuery returns the clock of the server, in microseconds
+// since the epoch.
+const serverTimeQuery = "SELECT CAST(UNIX_TIMESTAMP(NOW(6))*1000000 AS SIGNED)"
+
+// heartbeatQuery returns the most recent heartbeat written by the
+// primary tablet in the heartbeat table of the sidecar database, in
+// nanoseconds since the epoch, along with the clock of the server.
+const heartbeatQuery = "SELECT ts, CAST(UNIX_TIMESTAMP(NOW(6))*1000000 AS SIGNED) FROM %s.heartbeat WHERE keyspaceShard=%s"
+
+// HeartbeatLag is the replication lag of a replica, computed from the
+// heartbeats the primary tablet writes in the heartbeat table.
+//
+// Unlike Seconds_Behind_Source, it doesn't depend on the timestamps of
+// the replicated events, so it is precise to the heartbeat interval, and
+// it keeps growing when the replica stops receiving events.
+type HeartbeatLag struct {
+	// Lag is the time elapsed since the primary tablet wrote the most
+	// recent heartbeat applied by the replica, by the local clock.
+	Lag time.Duration
+	// Heartbeat is the time of the most recent heartbeat, by the clock
+	// of the primary tablet.
+	Heartbeat time.Time
+	// ClockSkew is the offset of the clock of the replica from the local
+	// clock, measured at the midpoint of the query round trip.
+	ClockSkew time.Duration
+}
+
+// ReadClockSkew returns the offset of the clock of the server from the
+// local clock, measured at the midpoint of the query round trip. The
+// skew of the primary can be passed to ReadHeartbeatLag.
+func (c *Conn) ReadClockSkew() (time.Duration, error) {
+	before := time.Now()
+	qr, err := c.ExecuteFetch(serverTimeQuery, 1, false)
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+		return 0, vterrors.Errorf(vtrpc.Code_INTERNAL, "unexpected result for %v: %v", serverTimeQuery, qr.Rows)
+	}
+	serverTime, err := parseServerTime(qr.Rows[0][0])
+	if err != nil {
+		return 0, err
+	}
+	return serverTime.Sub(midpoint(before, after)), nil
+}
+
+// ReadHeartbeatLag reads the most recent heartbeat for keyspaceShard in
+// the heartbeat table of dbName (usually _vt), and returns the lag of
+// the server.
+//
+// The heartbeats are timestamped by the clock of the primary tablet.
+// To compensate for the skew between that clock and the local one,
+// primaryClockSkew can be set, e.g. with the ReadClockSkew of a
+// connection to the primary, as the primary tablet usually runs on the
+// same host as its MySQL.
+func (c *Conn) ReadHeartbeatLag(dbName, keyspaceShard string, primaryClockSkew time.Duration) (HeartbeatLag, error) {
+	query := fmt.Sprintf(heartbeatQuery, sqlescape.EscapeID(dbName), sqltypes.EncodeStringSQL(keyspaceShard))
+	before := time.Now()
+	qr, err := c.ExecuteFetch(query, 1, false)
+	if err != nil {
+		return HeartbeatLag{}, err
+	}
+	after := time.Now()
+	if len(qr.Rows) != 1 {
+		return HeartbeatLag{}, vterrors.Errorf(vtrpc.Code_NOT_FOUND, "no heartbeat for %v in %v.heartbeat", keyspaceShard, dbName)
+	}
+	return parseHeartbeatLag(qr.Rows[0], before, after, primaryClockSkew)
+}
+
+// ShowReplicationStatusWithHeartbeatLag returns the replication status,
+// like ShowReplicationStatus, with HeartbeatLag set from the heartbeat
+// table. See ReadHeartbeatLag for the parameters.
+func (c *Conn) ShowReplicationStatusWithHeartbeatLag(dbName, keyspaceShard string, primaryClockSkew time.Duration) (ReplicationStatus, error) {
+	status, err := c.ShowReplicationStatus()
+	if err != nil {
+		return ReplicationStatus{}, err
+	}
+	lag, err := c.ReadHeartbeatLag(dbName, keyspaceShard, primaryClockSkew)
+	if err != nil {
+		return ReplicationStatus{}, err
+	}
+	status.HeartbeatLag = &lag
+	return status, nil
+}
+
+// parseHeartbeatLag computes the HeartbeatLag from a row returned by
+// heartbeatQuery, sent at before and received at after.
+func parseHeartbeatLag(row []sqltypes.Value, before, after time.Time, primaryClockSkew time.Duration) (HeartbeatLag, error) {
+	if len(row) != 2 {
+		return HeartbeatLag{}, vterrors.Errorf(vtrpc.Code_INTERNAL, "unexpected heartbeat row: %v", row)
+	}
+	ts, err := row[0].ToInt64()
+	if err != nil {
+		return HeartbeatLag{}, vterrors.Wrapf(err, "invalid heartbeat timestamp %v", row[0].ToString())
+	}
+	serverTime, err := parseServerTime(row[1])
+	if err != nil {
+		return HeartbeatLag{}, err
+	}
+	now := midpoint(before, after)
+	heartbeat := time.Unix(0, ts)
+	lag := now.Sub(heartbeat.Add(-primaryClockSkew))
+	// The given skew may be off, but the replica can't be ahead of the
+	// primary.
+	if lag < 0 {
+		lag = 0
+	}
+	return HeartbeatLag{
+		Lag:       lag,
+		Heartbeat: heartbeat,
+		ClockSkew: serverTime.Sub(now),
+	}, nil
+}
+
+func parseServerTime(v sqltypes.Value) (time.Time, error) {
+	us, err := v.ToInt64()
+	if err != nil {
+		return time.Time{}, vterrors.Wrapf(err, "invalid server time %v", v.ToString())
+	}
+	return time.UnixMicro(us), nil
+}
+
+// midpoint returns the time halfway between before and after, which is
+// the best estimate of when a query was executed by the server.
+func midpoint(before, after time.Time) time.Time {
+	return before.Add(after.Sub(before) / 2)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestParseHeartbeatLag(t *testing.T) {
+	before := time.Unix(1000, 0)
+	after := before.Add(20 * time.Millisecond)
+	now := before.Add(10 * time.Millisecond)
+	heartbeat := now.Add(-2 * time.Second)
+
+	row := func(heartbeat, serverTime time.Time) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.NewInt64(heartbeat.UnixNano()),
+			sqltypes.NewInt64(serverTime.UnixMicro()),
+		}
+	}
+
+	testcases := []struct {
+		name             string
+		serverTime       time.Time
+		primaryClockSkew time.Duration
+		lag              time.Duration
+		clockSkew        time.Duration
+	}{{
+		name:       "synchronized clocks",
+		serverTime: now,
+		lag:        2 * time.Second,
+	}, {
+		name:       "replica clock ahead",
+		serverTime: now.Add(time.Second),
+		lag:        2 * time.Second,
+		clockSkew:  time.Second,
+	}, {
+		name:             "primary clock ahead",
+		serverTime:       now,
+		primaryClockSkew: 500 * time.Millisecond,
+		lag:              2500 * time.Millisecond,
+	}, {
+		name:             "primary clock behind",
+		serverTime:       now,
+		primaryClockSkew: -500 * time.Millisecond,
+		lag:              1500 * time.Millisecond,
+	}, {
+		name:             "skew overestimated",
+		serverTime:       now,
+		primaryClockSkew: -3 * time.Second,
+		lag:              0,
+	}}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseHeartbeatLag(row(heartbeat, tc.serverTime), before, after, tc.primaryClockSkew)
+			require.NoError(t, err)
+			assert.Equal(t, tc.lag, got.Lag)
+			assert.Equal(t, tc.clockSkew, got.ClockSkew)
+			assert.True(t, heartbeat.Equal(got.Heartbeat))
+		})
+	}
+
+	_, err := parseHeartbeatLag([]sqltypes.Value{sqltypes.NULL, sqltypes.NewInt64(0)}, before, after, 0)
+	assert.Error(t, err)
+	_, err = parseHeartbeatLag([]sqltypes.Value{sqltypes.NewInt64(0)}, before, after, 0)
+	assert.Error(t, err)
+}
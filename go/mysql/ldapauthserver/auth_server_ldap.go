@@ -46,7 +46,7 @@ func init() {
 	servenv.OnParseFor("vtgate", func(fs *pflag.FlagSet) {
 		fs.StringVar(&ldapAuthConfigFile, "mysql_ldap_auth_config_file", "", "JSON File from which to read LDAP server config.")
 		fs.StringVar(&ldapAuthConfigString, "mysql_ldap_auth_config_string", "", "JSON representation of LDAP server config.")
-		fs.StringVar(&ldapAuthMethod, "mysql_ldap_auth_method", string(mysql.MysqlClearPassword), "client-side authentication method to use. Supported values: mysql_clear_password, dialog.")
+		fs.StringVar(&ldapAuthMethod, "mysql_ldap_auth_method", string(mysql.MysqlClearPassword), "client-side authentication method to use. Supported values: mysql_clear_password, dialog, caching_sha2_password.")
 	})
 }
 
@@ -73,8 +73,10 @@ func Init() {
 		return
 	}
 
-	if ldapAuthMethod != string(mysql.MysqlClearPassword) && ldapAuthMethod != string(mysql.MysqlDialog) {
-		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password or dialog")
+	switch mysql.AuthMethodDescription(ldapAuthMethod) {
+	case mysql.MysqlClearPassword, mysql.MysqlDialog, mysql.CachingSha2Password:
+	default:
+		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password, dialog or caching_sha2_password")
 	}
 	ldapAuthServer := &AuthServerLdap{
 		Client:       &ClientImpl{},
@@ -99,8 +101,14 @@ func Init() {
 		authMethod = mysql.NewMysqlClearAuthMethod(ldapAuthServer, ldapAuthServer)
 	case mysql.MysqlDialog:
 		authMethod = mysql.NewMysqlDialogAuthMethod(ldapAuthServer, ldapAuthServer, "")
+	case mysql.CachingSha2Password:
+		storage, err := mysql.NewFastAuthCachingStorageFromFlags(ldapAuthServer)
+		if err != nil {
+			log.Exitf("Failed to configure the fast auth cache: %v", err)
+		}
+		authMethod = mysql.NewSha2CachingAuthMethod(storage, storage, ldapAuthServer)
 	default:
-		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password or dialog")
+		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password, dialog or caching_sha2_password")
 	}
 
 	ldapAuthServer.methods = []mysql.AuthMethod{authMethod}
@@ -33,8 +33,8 @@ const Mysql56FlavorID = "MySQL56"
 func parseMysql56GTID(s string) (GTID, error) {
 	// Split into parts.
 	parts := strings.Split(s, ":")
-	if len(parts) != 2 {
-		return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid MySQL 5.6 GTID (%v): expecting UUID:Sequence", s)
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid MySQL 5.6 GTID (%v): expecting UUID:Sequence or UUID:Tag:Sequence", s)
 	}
 
 	// Parse Server ID.
@@ -43,13 +43,23 @@ func parseMysql56GTID(s string) (GTID, error) {
 		return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID Server ID (%v)", parts[0])
 	}
 
+	// Parse Tag, if any.
+	var tag string
+	if len(parts) == 3 {
+		tag, err = parseGTIDTag(parts[1])
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID Tag (%v)", parts[1])
+		}
+	}
+
 	// Parse Sequence number.
-	seq, err := strconv.ParseInt(parts[1], 10, 64)
+	seqPart := parts[len(parts)-1]
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
 	if err != nil {
-		return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID Sequence number (%v)", parts[1])
+		return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID Sequence number (%v)", seqPart)
 	}
 
-	return Mysql56GTID{Server: sid, Sequence: seq}, nil
+	return Mysql56GTID{Server: sid, Tag: tag, Sequence: seq}, nil
 }
 
 // SID is the 16-byte unique ID of a MySQL 5.6 server.
@@ -90,6 +100,9 @@ func ParseSID(s string) (sid SID, err error) {
 type Mysql56GTID struct {
 	// Server is the SID of the server that originally committed the transaction.
 	Server SID
+	// Tag is the optional tag of the transaction, as introduced in
+	// MySQL 8.3. It is empty for untagged transactions.
+	Tag string
 	// Sequence is the sequence number of the transaction within a given Server's
 	// scope.
 	Sequence int64
@@ -97,6 +110,9 @@ type Mysql56GTID struct {
 
 // String implements GTID.String().
 func (gtid Mysql56GTID) String() string {
+	if gtid.Tag != "" {
+		return fmt.Sprintf("%s:%s:%d", gtid.Server, gtid.Tag, gtid.Sequence)
+	}
 	return fmt.Sprintf("%s:%d", gtid.Server, gtid.Sequence)
 }
 
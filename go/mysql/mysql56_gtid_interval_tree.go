@@ -0,0 +1,362 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// intervalTree is the set of GTID intervals of one SID in a
+// Mysql56GTIDSet. The intervals are sorted by tag, then by start, and
+// the intervals of a tag never overlap nor touch, e.g. 1-5 and 6-10 are
+// stored as 1-10.
+//
+// It is a treap: a binary search tree on the intervals that is also a
+// heap on a priority derived from the interval, which keeps it balanced
+// with a high probability. Since the priorities are not random, the
+// shape of the tree only depends on its intervals, so equal trees are
+// also deeply equal.
+//
+// Like GTIDSets, trees are immutable: operations copy the O(log n) nodes
+// they change and share the others with the original tree. This makes
+// adding a GTID to a set of many intervals O(log n) instead of O(n).
+// The zero value is the empty tree.
+type intervalTree struct {
+	root *intervalNode
+}
+
+type intervalNode struct {
+	iv          interval
+	priority    uint64
+	size        int
+	left, right *intervalNode
+}
+
+func newIntervalNode(iv interval, left, right *intervalNode) *intervalNode {
+	n := &intervalNode{
+		iv:       iv,
+		priority: intervalPriority(iv),
+		left:     left,
+		right:    right,
+	}
+	n.size = 1 + left.len() + right.len()
+	return n
+}
+
+// withChildren returns a copy of n with the given children.
+func (n *intervalNode) withChildren(left, right *intervalNode) *intervalNode {
+	c := *n
+	c.left, c.right = left, right
+	c.size = 1 + left.len() + right.len()
+	return &c
+}
+
+func (n *intervalNode) len() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+// intervalPriority hashes the key of the interval: the FNV-1a hash of
+// the tag, mixed with the start by the finalizer of SplitMix64, which
+// spreads consecutive starts well.
+func intervalPriority(iv interval) uint64 {
+	h := uint64(0xcbf29ce484222325)
+	for i := 0; i < len(iv.tag); i++ {
+		h = (h ^ uint64(iv.tag[i])) * 0x100000001b3
+	}
+	h ^= mix64(uint64(iv.start))
+	return mix64(h)
+}
+
+func mix64(h uint64) uint64 {
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
+// above returns true if n must be an ancestor of other in the tree. The
+// rare ties between priorities are broken by the intervals, so that the
+// shape of the tree stays unique.
+func (n *intervalNode) above(other *intervalNode) bool {
+	if n.priority != other.priority {
+		return n.priority > other.priority
+	}
+	return intervalLess(n.iv, other.iv)
+}
+
+// intervalLess orders the intervals by tag, then by start.
+func intervalLess(a, b interval) bool {
+	if a.tag != b.tag {
+		return a.tag < b.tag
+	}
+	return a.start < b.start
+}
+
+// newIntervalTree returns a tree of the given intervals, in any order.
+func newIntervalTree(intervals []interval) intervalTree {
+	sorted := make([]interval, len(intervals))
+	copy(sorted, intervals)
+	sort.Sort(intervalList(sorted))
+	return buildIntervalTree(normalizeIntervals(sorted))
+}
+
+// buildIntervalTree returns a tree of normalized intervals, as returned
+// by normalizeIntervals, in O(n).
+func buildIntervalTree(intervals []interval) intervalTree {
+	// Build the Cartesian tree of the priorities, with the rightmost
+	// path of the tree on a stack.
+	// The nodes are allocated at once.
+	nodes := make([]intervalNode, len(intervals))
+	var stack []*intervalNode
+	for i, iv := range intervals {
+		n := &nodes[i]
+		n.iv, n.priority = iv, intervalPriority(iv)
+		var last *intervalNode
+		for len(stack) > 0 && n.above(stack[len(stack)-1]) {
+			last = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		}
+		n.left = last
+		if len(stack) > 0 {
+			stack[len(stack)-1].right = n
+		}
+		stack = append(stack, n)
+	}
+	if len(stack) == 0 {
+		return intervalTree{}
+	}
+	root := stack[0]
+	root.computeSizes()
+	return intervalTree{root: root}
+}
+
+func (n *intervalNode) computeSizes() int {
+	if n == nil {
+		return 0
+	}
+	n.size = 1 + n.left.computeSizes() + n.right.computeSizes()
+	return n.size
+}
+
+// normalizeIntervals merges the overlapping and adjacent intervals of a
+// sorted list, in place.
+func normalizeIntervals(intervals []interval) []interval {
+	var normalized []interval
+	for _, iv := range intervals {
+		if len(normalized) > 0 {
+			last := &normalized[len(normalized)-1]
+			if last.tag == iv.tag && iv.start <= last.end+1 {
+				if iv.end > last.end {
+					last.end = iv.end
+				}
+				continue
+			}
+		}
+		normalized = append(intervals[:len(normalized)], iv)
+	}
+	return normalized
+}
+
+// len returns the number of intervals in the tree.
+func (t intervalTree) len() int {
+	return t.root.len()
+}
+
+// intervals returns the sorted intervals of the tree.
+func (t intervalTree) intervals() []interval {
+	if t.root == nil {
+		return nil
+	}
+	intervals := make([]interval, 0, t.len())
+	t.root.walk(func(iv interval) bool {
+		intervals = append(intervals, iv)
+		return true
+	})
+	return intervals
+}
+
+// walk calls f on the intervals of the tree of n, in order, until it
+// returns false. It returns false if it was stopped.
+func (n *intervalNode) walk(f func(interval) bool) bool {
+	for n != nil {
+		if !n.left.walk(f) || !f(n.iv) {
+			return false
+		}
+		n = n.right
+	}
+	return true
+}
+
+// last returns the last interval of the tree, if any.
+func (t intervalTree) last() (interval, bool) {
+	n := t.root.max()
+	if n == nil {
+		return interval{}, false
+	}
+	return n.iv, true
+}
+
+// floor returns the last interval that doesn't sort after iv.
+func (t intervalTree) floor(iv interval) (interval, bool) {
+	var found *intervalNode
+	for n := t.root; n != nil; {
+		if intervalLess(iv, n.iv) {
+			n = n.left
+		} else {
+			found = n
+			n = n.right
+		}
+	}
+	if found == nil {
+		return interval{}, false
+	}
+	return found.iv, true
+}
+
+// contains returns true if all the GTIDs of iv are in the tree.
+func (t intervalTree) contains(iv interval) bool {
+	floor, ok := t.floor(iv)
+	return ok && floor.contains(iv)
+}
+
+// containsAll returns true if all the GTIDs of other are in the tree.
+func (t intervalTree) containsAll(other intervalTree) bool {
+	return other.root.walk(t.contains)
+}
+
+// equal returns true if both trees have the same intervals.
+func (t intervalTree) equal(other intervalTree) bool {
+	if t.root == other.root {
+		return true
+	}
+	if t.len() != other.len() {
+		return false
+	}
+	intervals, otherIntervals := t.intervals(), other.intervals()
+	for i, iv := range intervals {
+		if iv != otherIntervals[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// insert returns a tree with the GTIDs of the tree and of iv, in
+// O(log n).
+func (t intervalTree) insert(iv interval) intervalTree {
+	// Remove the intervals that overlap or touch iv, and extend iv to
+	// cover them.
+	left, rest := splitIntervals(t.root, func(n interval) bool {
+		return intervalLess(n, iv)
+	})
+	if prev := left.max(); prev != nil && prev.iv.tag == iv.tag && prev.iv.end+1 >= iv.start {
+		iv.start = prev.iv.start
+		if prev.iv.end > iv.end {
+			iv.end = prev.iv.end
+		}
+		left, _ = splitIntervals(left, func(n interval) bool {
+			return intervalLess(n, prev.iv)
+		})
+	}
+	merged, right := splitIntervals(rest, func(n interval) bool {
+		return n.tag == iv.tag && n.start <= iv.end+1
+	})
+	if last := merged.max(); last != nil && last.iv.end > iv.end {
+		iv.end = last.iv.end
+	}
+	return intervalTree{root: joinIntervals(joinIntervals(left, newIntervalNode(iv, nil, nil)), right)}
+}
+
+// union returns a tree with the GTIDs of both trees.
+func (t intervalTree) union(other intervalTree) intervalTree {
+	small, large := other, t
+	if small.len() > large.len() {
+		small, large = large, small
+	}
+	if small.len() == 0 {
+		return large
+	}
+	// Inserting the intervals of the small tree one by one is
+	// O(m log n), merging the lists of intervals is O(n + m).
+	if small.len()*bits.Len(uint(large.len())) < large.len() {
+		small.root.walk(func(iv interval) bool {
+			large = large.insert(iv)
+			return true
+		})
+		return large
+	}
+	return buildIntervalTree(normalizeIntervals(mergeIntervals(t.intervals(), other.intervals())))
+}
+
+// mergeIntervals merges two sorted lists of intervals.
+func mergeIntervals(a, b []interval) []interval {
+	merged := make([]interval, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if intervalLess(b[0], a[0]) {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+func (n *intervalNode) max() *intervalNode {
+	if n == nil {
+		return nil
+	}
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// splitIntervals splits the tree of n in the intervals for which inLeft
+// is true, and the others. inLeft must be true for a prefix of the
+// intervals.
+func splitIntervals(n *intervalNode, inLeft func(interval) bool) (left, right *intervalNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if inLeft(n.iv) {
+		l, r := splitIntervals(n.right, inLeft)
+		return n.withChildren(n.left, l), r
+	}
+	l, r := splitIntervals(n.left, inLeft)
+	return l, n.withChildren(r, n.right)
+}
+
+// joinIntervals joins two trees, where all the intervals of left sort
+// before the intervals of right.
+func joinIntervals(left, right *intervalNode) *intervalNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.above(right):
+		return left.withChildren(left.left, joinIntervals(left.right, right))
+	default:
+		return right.withChildren(joinIntervals(left, right.left), right.right)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gtidModel is a naive representation of the GTIDs of one SID.
+type gtidModel map[interval]bool
+
+func (m gtidModel) add(iv interval) {
+	for seq := iv.start; seq <= iv.end; seq++ {
+		m[interval{start: seq, end: seq, tag: iv.tag}] = true
+	}
+}
+
+func (m gtidModel) intervals() []interval {
+	var intervals []interval
+	for iv := range m {
+		intervals = append(intervals, iv)
+	}
+	return newIntervalTree(intervals).intervals()
+}
+
+func randomIntervals(r *rand.Rand, n int) []interval {
+	tags := []string{"", "", "a", "b"}
+	intervals := make([]interval, n)
+	for i := range intervals {
+		start := r.Int63n(200) + 1
+		intervals[i] = interval{start: start, end: start + r.Int63n(5), tag: tags[r.Intn(len(tags))]}
+	}
+	return intervals
+}
+
+// checkIntervalTree checks the invariants of the tree.
+func checkIntervalTree(t *testing.T, tree intervalTree) {
+	t.Helper()
+	var check func(n *intervalNode) int
+	check = func(n *intervalNode) int {
+		if n == nil {
+			return 0
+		}
+		for _, child := range []*intervalNode{n.left, n.right} {
+			if child != nil {
+				require.True(t, n.above(child), "heap order of %v and %v", n.iv, child.iv)
+			}
+		}
+		size := 1 + check(n.left) + check(n.right)
+		require.Equal(t, size, n.size, "size")
+		return size
+	}
+	check(tree.root)
+
+	intervals := tree.intervals()
+	for i := 1; i < len(intervals); i++ {
+		prev, iv := intervals[i-1], intervals[i]
+		require.True(t, intervalLess(prev, iv), "order of %v and %v", prev, iv)
+		if prev.tag == iv.tag {
+			require.Greater(t, iv.start, prev.end+1, "%v and %v are not merged", prev, iv)
+		}
+	}
+}
+
+func TestIntervalTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		a, b := randomIntervals(r, r.Intn(40)), randomIntervals(r, r.Intn(40))
+		modelA, modelAB := gtidModel{}, gtidModel{}
+		for _, iv := range a {
+			modelA.add(iv)
+			modelAB.add(iv)
+		}
+		for _, iv := range b {
+			modelAB.add(iv)
+		}
+
+		treeA, treeB := newIntervalTree(a), newIntervalTree(b)
+		checkIntervalTree(t, treeA)
+		assert.Equal(t, modelA.intervals(), treeA.intervals())
+
+		// Both ways of computing the union, and adding the intervals
+		// one by one, give the same tree.
+		union := treeA.union(treeB)
+		checkIntervalTree(t, union)
+		assert.Equal(t, modelAB.intervals(), union.intervals())
+		assert.Equal(t, union, buildIntervalTree(normalizeIntervals(mergeIntervals(treeA.intervals(), treeB.intervals()))))
+		inserted := treeA
+		for _, iv := range b {
+			inserted = inserted.insert(iv)
+			checkIntervalTree(t, inserted)
+		}
+		assert.Equal(t, union, inserted)
+		assert.True(t, union.equal(inserted))
+
+		// The original trees are not modified.
+		assert.Equal(t, modelA.intervals(), treeA.intervals())
+
+		assert.True(t, union.containsAll(treeA))
+		assert.True(t, union.containsAll(treeB))
+		assert.Equal(t, len(modelA) == len(modelAB), treeA.containsAll(union))
+		for seq := int64(1); seq < 210; seq++ {
+			for _, tag := range []string{"", "a", "b"} {
+				iv := interval{start: seq, end: seq, tag: tag}
+				assert.Equal(t, modelAB[iv], union.contains(iv))
+			}
+		}
+	}
+}
+
+func makeLargeGTIDSet(sid SID, n int64) Mysql56GTIDSet {
+	intervals := make([]interval, n)
+	for i := range intervals {
+		intervals[i] = interval{start: int64(i)*10 + 1, end: int64(i)*10 + 5}
+	}
+	return Mysql56GTIDSet{sid: newIntervalTree(intervals)}
+}
+
+func BenchmarkMysql56GTIDSet(b *testing.B) {
+	sid := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	for _, n := range []int64{10, 1000, 100000} {
+		set := makeLargeGTIDSet(sid, n)
+		gtid := Mysql56GTID{Server: sid, Sequence: n * 5}
+		small := Mysql56GTIDSet{sid: newIntervalTree([]interval{{start: n * 5, end: n * 5}})}
+		other := makeLargeGTIDSet(sid, n).AddGTID(Mysql56GTID{Server: sid, Sequence: n*10 + 2})
+
+		b.Run(fmt.Sprintf("AddGTID/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				set.AddGTID(Mysql56GTID{Server: sid, Sequence: int64(i%int(n))*10 + 7})
+			}
+		})
+		b.Run(fmt.Sprintf("ContainsGTID/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set.ContainsGTID(gtid)
+			}
+		})
+		b.Run(fmt.Sprintf("Contains/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set.Contains(small)
+			}
+		})
+		b.Run(fmt.Sprintf("UnionSmall/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				set.Union(small)
+			}
+		})
+		b.Run(fmt.Sprintf("UnionLarge/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				set.Union(other)
+			}
+		})
+		b.Run(fmt.Sprintf("String/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = set.String()
+			}
+		})
+	}
+}
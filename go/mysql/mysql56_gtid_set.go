@@ -19,6 +19,8 @@ package mysql
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+	"math/bits"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,10 +31,13 @@ import (
 
 type interval struct {
 	start, end int64
+	// tag is the tag of the GTIDs in the interval, as introduced in
+	// MySQL 8.3. It is empty for untagged GTIDs.
+	tag string
 }
 
 func (iv interval) contains(other interval) bool {
-	return iv.start <= other.start && other.end <= iv.end
+	return iv.tag == other.tag && iv.start <= other.start && other.end <= iv.end
 }
 
 type intervalList []interval
@@ -40,8 +45,15 @@ type intervalList []interval
 // Len implements sort.Interface.
 func (s intervalList) Len() int { return len(s) }
 
-// Less implements sort.Interface.
-func (s intervalList) Less(i, j int) bool { return s[i].start < s[j].start }
+// Less implements sort.Interface. Intervals are sorted by tag first, so
+// the untagged intervals come first and the intervals of each tag are
+// contiguous.
+func (s intervalList) Less(i, j int) bool {
+	if s[i].tag != s[j].tag {
+		return s[i].tag < s[j].tag
+	}
+	return s[i].start < s[j].start
+}
 
 // Swap implements sort.Interface.
 func (s intervalList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -83,7 +95,7 @@ func parseMysql56GTIDSet(s string) (GTIDSet, error) {
 			continue
 		}
 
-		// uuid_set: uuid:interval[:interval]...
+		// uuid_set: uuid:[tag:]interval[:[tag:]interval]...
 		parts := strings.Split(uuidSet, ":")
 		if len(parts) < 2 {
 			return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid MySQL 5.6 GTID set (%q): expected uuid:interval", s)
@@ -95,13 +107,23 @@ func parseMysql56GTIDSet(s string) (GTIDSet, error) {
 			return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID set (%q)", s)
 		}
 
-		// Parse Intervals.
+		// Parse Intervals. A tag applies to all the intervals after it,
+		// until the next tag.
+		var tag string
 		intervals := make([]interval, 0, len(parts)-1)
 		for _, part := range parts[1:] {
+			if isGTIDTag(part) {
+				tag, err = parseGTIDTag(part)
+				if err != nil {
+					return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID set (%q)", s)
+				}
+				continue
+			}
 			iv, err := parseInterval(part)
 			if err != nil {
 				return nil, vterrors.Wrapf(err, "invalid MySQL 5.6 GTID set (%q)", s)
 			}
+			iv.tag = tag
 			if iv.end < iv.start {
 				// According to MySQL 5.6 code:
 				//   "The end of an interval may be 0, but any interval that has an
@@ -115,16 +137,74 @@ func parseMysql56GTIDSet(s string) (GTIDSet, error) {
 			continue
 		}
 
-		// Internally we expect intervals to be stored in order.
-		sort.Sort(intervalList(intervals))
-		set[sid] = intervals
+		// The same SID may be listed more than once, for instance
+		// once for its untagged GTIDs and once for each tag.
+		set[sid] = set[sid].union(newIntervalTree(intervals))
 	}
 
 	return set, nil
 }
 
+// isGTIDTag returns true if s looks like a GTID tag rather than an
+// interval. Intervals always start with a digit.
+func isGTIDTag(s string) bool {
+	return s != "" && (s[0] < '0' || s[0] > '9')
+}
+
+// parseGTIDTag parses the tag of a tagged GTID, as introduced in
+// MySQL 8.3. Tags are case insensitive, so they are returned in lower
+// case, the same way MySQL normalizes them.
+func parseGTIDTag(s string) (string, error) {
+	if len(s) == 0 || len(s) > 32 {
+		return "", vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid GTID tag (%q): expected 1 to 32 characters", s)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return "", vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid GTID tag (%q): expected letters, digits and underscores, not starting with a digit", s)
+		}
+	}
+	return strings.ToLower(s), nil
+}
+
+// splitTag returns the leading intervals of s that have the given tag,
+// and the rest of s.
+func splitTag(s []interval, tag string) (run, rest []interval) {
+	i := 0
+	for i < len(s) && s[i].tag == tag {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// forEachTag calls f once for each tag found in a or b, in order, with
+// the intervals of a and b that have this tag. a and b must be sorted.
+func forEachTag(a, b []interval, f func(a, b []interval)) {
+	for len(a) > 0 || len(b) > 0 {
+		var tag string
+		switch {
+		case len(a) == 0:
+			tag = b[0].tag
+		case len(b) == 0:
+			tag = a[0].tag
+		case a[0].tag <= b[0].tag:
+			tag = a[0].tag
+		default:
+			tag = b[0].tag
+		}
+
+		var runA, runB []interval
+		runA, a = splitTag(a, tag)
+		runB, b = splitTag(b, tag)
+		f(runA, runB)
+	}
+}
+
 // Mysql56GTIDSet implements GTIDSet for MySQL 5.6.
-type Mysql56GTIDSet map[SID][]interval
+type Mysql56GTIDSet map[SID]intervalTree
 
 // SIDs returns a sorted list of SIDs in the set.
 func (set Mysql56GTIDSet) SIDs() []SID {
@@ -150,6 +230,7 @@ func (s sidList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 // String implements GTIDSet.
 func (set Mysql56GTIDSet) String() string {
 	buf := &bytes.Buffer{}
+	var scratch [20]byte
 
 	for i, sid := range set.SIDs() {
 		if i != 0 {
@@ -157,15 +238,22 @@ func (set Mysql56GTIDSet) String() string {
 		}
 		buf.WriteString(sid.String())
 
-		for _, interval := range set[sid] {
+		tag := ""
+		set[sid].root.walk(func(interval interval) bool {
+			if interval.tag != tag {
+				tag = interval.tag
+				buf.WriteByte(':')
+				buf.WriteString(tag)
+			}
 			buf.WriteByte(':')
-			buf.WriteString(strconv.FormatInt(interval.start, 10))
+			buf.Write(strconv.AppendInt(scratch[:0], interval.start, 10))
 
 			if interval.end != interval.start {
 				buf.WriteByte('-')
-				buf.WriteString(strconv.FormatInt(interval.end, 10))
+				buf.Write(strconv.AppendInt(scratch[:0], interval.end, 10))
 			}
-		}
+			return true
+		})
 	}
 
 	return buf.String()
@@ -180,10 +268,12 @@ func (set Mysql56GTIDSet) Last() string {
 	if len(set.SIDs()) > 0 {
 		sid := set.SIDs()[len(set.SIDs())-1]
 		buf.WriteString(sid.String())
-		sequences := set[sid]
-		if len(sequences) > 0 {
+		if lastInterval, ok := set[sid].last(); ok {
 			buf.WriteByte(':')
-			lastInterval := sequences[len(sequences)-1]
+			if lastInterval.tag != "" {
+				buf.WriteString(lastInterval.tag)
+				buf.WriteByte(':')
+			}
 			buf.WriteString(strconv.FormatInt(lastInterval.end, 10))
 		}
 	}
@@ -201,18 +291,11 @@ func (set Mysql56GTIDSet) ContainsGTID(gtid GTID) bool {
 		return false
 	}
 
-	for _, iv := range set[gtid56.Server] {
-		if iv.start > gtid56.Sequence {
-			// We assume intervals are sorted, so we can skip the rest.
-			return false
-		}
-		if gtid56.Sequence <= iv.end {
-			// Now we know that: start <= Sequence <= end.
-			return true
-		}
-	}
-	// Server wasn't in the set, or no interval contained gtid.
-	return false
+	return set[gtid56.Server].contains(interval{
+		start: gtid56.Sequence,
+		end:   gtid56.Sequence,
+		tag:   gtid56.Tag,
+	})
 }
 
 // Contains implements GTIDSet.
@@ -228,26 +311,8 @@ func (set Mysql56GTIDSet) Contains(other GTIDSet) bool {
 
 	// Check each SID in the other set.
 	for sid, otherIntervals := range other56 {
-		i := 0
-		intervals := set[sid]
-		count := len(intervals)
-
-		// Check each interval for this SID in the other set.
-		for _, iv := range otherIntervals {
-			// Check that interval against each of our intervals.
-			// Intervals are monotonically increasing,
-			// so we don't need to reset the index each time.
-			for {
-				if i >= count {
-					// We ran out of intervals to check against.
-					return false
-				}
-				if intervals[i].contains(iv) {
-					// Yes it's covered. Go on to the next one.
-					break
-				}
-				i++
-			}
+		if !set[sid].containsAll(otherIntervals) {
+			return false
 		}
 	}
 
@@ -269,20 +334,9 @@ func (set Mysql56GTIDSet) Equal(other GTIDSet) bool {
 
 	// Compare each SID.
 	for sid, intervals := range set {
-		otherIntervals := other56[sid]
-
-		// Check for same number of intervals.
-		if len(intervals) != len(otherIntervals) {
+		if !intervals.equal(other56[sid]) {
 			return false
 		}
-
-		// Compare each interval.
-		// Since intervals are sorted, they have to be in the same order.
-		for i, iv := range intervals {
-			if iv != otherIntervals[i] {
-				return false
-			}
-		}
 	}
 
 	// No discrepancies were found.
@@ -304,56 +358,17 @@ func (set Mysql56GTIDSet) AddGTID(gtid GTID) GTIDSet {
 
 	// Make a copy and add the new GTID in the proper place.
 	// This function is not supposed to modify the original set.
-	newSet := make(Mysql56GTIDSet)
-
-	added := false
-
+	// The intervals of the other SIDs are shared, which is safe
+	// because GTIDSets are immutable.
+	newSet := make(Mysql56GTIDSet, len(set)+1)
 	for sid, intervals := range set {
-		newIntervals := make([]interval, 0, len(intervals))
-
-		if sid == gtid56.Server {
-			// Look for the right place to add this GTID.
-			for _, iv := range intervals {
-				if !added {
-					switch {
-					case gtid56.Sequence == iv.start-1:
-						// Expand the interval at the beginning.
-						iv.start = gtid56.Sequence
-						added = true
-					case gtid56.Sequence == iv.end+1:
-						// Expand the interval at the end.
-						iv.end = gtid56.Sequence
-						added = true
-					case gtid56.Sequence < iv.start-1:
-						// The next interval is beyond the new GTID, but it can't
-						// be expanded, so we have to insert a new interval.
-						newIntervals = append(newIntervals, interval{start: gtid56.Sequence, end: gtid56.Sequence})
-						added = true
-					}
-				}
-				// Check if this interval can be merged with the previous one.
-				count := len(newIntervals)
-				if count != 0 && iv.start == newIntervals[count-1].end+1 {
-					// Merge instead of appending.
-					newIntervals[count-1].end = iv.end
-				} else {
-					// Can't be merged.
-					newIntervals = append(newIntervals, iv)
-				}
-			}
-		} else {
-			// Just copy everything.
-			newIntervals = append(newIntervals, intervals...)
-		}
-
-		newSet[sid] = newIntervals
-	}
-
-	if !added {
-		// There wasn't any place to insert the new GTID, so just append it
-		// as a new interval.
-		newSet[gtid56.Server] = append(newSet[gtid56.Server], interval{start: gtid56.Sequence, end: gtid56.Sequence})
+		newSet[sid] = intervals
 	}
+	newSet[gtid56.Server] = set[gtid56.Server].insert(interval{
+		start: gtid56.Sequence,
+		end:   gtid56.Sequence,
+		tag:   gtid56.Tag,
+	})
 
 	return newSet
 }
@@ -384,37 +399,7 @@ func (set Mysql56GTIDSet) Union(other GTIDSet) GTIDSet {
 		}
 
 		// Found server id match between sets, so now we need to add each interval.
-		s1 := intervals
-		s2 := otherIntervals
-		var nextInterval interval
-		var newIntervals []interval
-
-		// While our stacks have intervals to process, do work.
-		for popInterval(&nextInterval, &s1, &s2) {
-			if len(newIntervals) == 0 {
-				newIntervals = append(newIntervals, nextInterval)
-				continue
-			}
-
-			activeInterval := &newIntervals[len(newIntervals)-1]
-
-			if nextInterval.end <= activeInterval.end {
-				// We hit an interval whose start was after or equal to the previous interval's start, but whose
-				// end is prior to the active intervals end. Skip to next interval.
-				continue
-			}
-
-			if nextInterval.start > activeInterval.end+1 {
-				// We found a gap, so we need to start a new interval.
-				newIntervals = append(newIntervals, nextInterval)
-				continue
-			}
-
-			// Extend our active interval.
-			activeInterval.end = nextInterval.end
-		}
-
-		newSet[otherSID] = newIntervals
+		newSet[otherSID] = intervals.union(otherIntervals)
 	}
 
 	// Add any intervals from SIDs that exist in caller set, but don't exist in other set.
@@ -431,20 +416,54 @@ func (set Mysql56GTIDSet) Union(other GTIDSet) GTIDSet {
 // by internal commands that refer to an "SID block".
 //
 // e.g. https://dev.mysql.com/doc/internals/en/com-binlog-dump-gtid.html
+//
+// If the set has tagged GTIDs, as introduced in MySQL 8.3, it uses the
+// tagged format of Gtid_set::encode() in rpl_gtid_set.cc instead: the
+// number of SIDs is framed by format markers, and there is one entry
+// per SID and tag, with the tag after the SID.
 func (set Mysql56GTIDSet) SIDBlock() []byte {
 	buf := &bytes.Buffer{}
 
+	type tsid struct {
+		sid       SID
+		intervals []interval
+	}
+	var tsids []tsid
+	tagged := false
+	for _, sid := range set.SIDs() {
+		intervals := set[sid].intervals()
+		for len(intervals) > 0 {
+			var run []interval
+			run, intervals = splitTag(intervals, intervals[0].tag)
+			tsids = append(tsids, tsid{sid: sid, intervals: run})
+			if run[0].tag != "" {
+				tagged = true
+			}
+		}
+	}
+
 	// Number of SIDs.
-	binary.Write(buf, binary.LittleEndian, uint64(len(set)))
+	if tagged {
+		binary.Write(buf, binary.LittleEndian, sidBlockTaggedFormat|uint64(len(tsids))<<8|sidBlockTaggedFormat<<56)
+	} else {
+		binary.Write(buf, binary.LittleEndian, uint64(len(tsids)))
+	}
 
-	for _, sid := range set.SIDs() {
-		buf.Write(sid[:])
+	for _, ts := range tsids {
+		buf.Write(ts.sid[:])
+
+		if tagged {
+			tag := ts.intervals[0].tag
+			data := make([]byte, varLenIntSize(uint64(len(tag))))
+			writeVarLenInt(data, 0, uint64(len(tag)))
+			buf.Write(data)
+			buf.WriteString(tag)
+		}
 
 		// Number of intervals.
-		intervals := set[sid]
-		binary.Write(buf, binary.LittleEndian, uint64(len(intervals)))
+		binary.Write(buf, binary.LittleEndian, uint64(len(ts.intervals)))
 
-		for _, iv := range intervals {
+		for _, iv := range ts.intervals {
 			binary.Write(buf, binary.LittleEndian, iv.start)
 			// MySQL's internal form for intervals adds 1 to the end value.
 			// See Gtid_set::add_gtid_text() in rpl_gtid_set.cc for example.
@@ -455,6 +474,10 @@ func (set Mysql56GTIDSet) SIDBlock() []byte {
 	return buf.Bytes()
 }
 
+// sidBlockTaggedFormat is the format marker of a tagged SID block. It
+// is stored in the first and last bytes of the number of SIDs.
+const sidBlockTaggedFormat uint64 = 1
+
 // Difference will supply the difference between the receiver and supplied Mysql56GTIDSets, and supply the result
 // as a Mysql56GTIDSet.
 func (set Mysql56GTIDSet) Difference(other Mysql56GTIDSet) Mysql56GTIDSet {
@@ -476,111 +499,121 @@ func (set Mysql56GTIDSet) Difference(other Mysql56GTIDSet) Mysql56GTIDSet {
 
 		// Found server id match between sets, so now we need to subtract each interval.
 		var diffIntervals []interval
-		advance := func() bool {
-			if len(intervals) == 0 {
-				return false
-			}
-			diffIntervals = append(diffIntervals, intervals[0])
-			intervals = intervals[1:]
-			return true
-		}
+		forEachTag(intervals.intervals(), otherIntervals.intervals(), func(intervals, otherIntervals []interval) {
+			diffIntervals = append(diffIntervals, differenceIntervals(intervals, otherIntervals)...)
+		})
 
-		var otherInterval interval
-		advanceOther := func() bool {
-			if len(otherIntervals) == 0 {
-				return false
-			}
-			otherInterval = otherIntervals[0]
-			otherIntervals = otherIntervals[1:]
-			return true
+		if len(diffIntervals) == 0 {
+			delete(differenceSet, sid)
+		} else {
+			differenceSet[sid] = buildIntervalTree(diffIntervals)
 		}
+	}
 
-		if !advance() {
-			continue
+	return differenceSet
+}
+
+// differenceIntervals returns the intervals of intervals that are not in
+// otherIntervals. Both lists must be sorted and have the same tag.
+func differenceIntervals(intervals, otherIntervals []interval) []interval {
+	var diffIntervals []interval
+	advance := func() bool {
+		if len(intervals) == 0 {
+			return false
 		}
-		if !advanceOther() {
-			differenceSet[sid] = intervals
-			continue
+		diffIntervals = append(diffIntervals, intervals[0])
+		intervals = intervals[1:]
+		return true
+	}
+
+	var otherInterval interval
+	advanceOther := func() bool {
+		if len(otherIntervals) == 0 {
+			return false
 		}
+		otherInterval = otherIntervals[0]
+		otherIntervals = otherIntervals[1:]
+		return true
+	}
 
-	diffLoop:
-		for {
-			iv := diffIntervals[len(diffIntervals)-1]
+	if !advance() {
+		return nil
+	}
+	if !advanceOther() {
+		return append(diffIntervals, intervals...)
+	}
 
-			switch {
-			case iv.end < otherInterval.start:
-				// [1, 2] - [3, 5]
-				// Need to skip to next s1 interval. This one is completely before otherInterval even starts. It's a diff in whole.
-				if !advance() {
-					break diffLoop
-				}
+diffLoop:
+	for {
+		iv := diffIntervals[len(diffIntervals)-1]
 
-			case iv.start > otherInterval.end:
-				// [3, 5] - [1, 2]
-				// Interval is completely past other interval. We need a valid other to compare against.
-				if !advanceOther() {
-					break diffLoop
-				}
+		switch {
+		case iv.end < otherInterval.start:
+			// [1, 2] - [3, 5]
+			// Need to skip to next s1 interval. This one is completely before otherInterval even starts. It's a diff in whole.
+			if !advance() {
+				break diffLoop
+			}
 
-			case iv.start >= otherInterval.start && iv.end <= otherInterval.end:
-				// [3, 4] - [1, 5]
-				// Interval is completed contained. Pop off diffIntervals, and advance to next s1.
-				diffIntervals = diffIntervals[:len(diffIntervals)-1]
-				if !advance() {
-					break diffLoop
-				}
+		case iv.start > otherInterval.end:
+			// [3, 5] - [1, 2]
+			// Interval is completely past other interval. We need a valid other to compare against.
+			if !advanceOther() {
+				break diffLoop
+			}
 
-			case iv.start < otherInterval.start && iv.end >= otherInterval.start && iv.end <= otherInterval.end:
-				// [1, 4] - [3, 5]
-				// We have a unique interval prior to where otherInterval starts and should adjust end to match this piece.
-				diffIntervals[len(diffIntervals)-1].end = otherInterval.start - 1
+		case iv.start >= otherInterval.start && iv.end <= otherInterval.end:
+			// [3, 4] - [1, 5]
+			// Interval is completed contained. Pop off diffIntervals, and advance to next s1.
+			diffIntervals = diffIntervals[:len(diffIntervals)-1]
+			if !advance() {
+				break diffLoop
+			}
 
-				if !advance() {
-					break diffLoop
-				}
+		case iv.start < otherInterval.start && iv.end >= otherInterval.start && iv.end <= otherInterval.end:
+			// [1, 4] - [3, 5]
+			// We have a unique interval prior to where otherInterval starts and should adjust end to match this piece.
+			diffIntervals[len(diffIntervals)-1].end = otherInterval.start - 1
 
-			case iv.start >= otherInterval.start && iv.start <= otherInterval.end && iv.end > otherInterval.end:
-				// [3, 7] - [1, 5]
-				// We have an end piece to deal with.
-				diffIntervals[len(diffIntervals)-1].start = otherInterval.end + 1
+			if !advance() {
+				break diffLoop
+			}
 
-				// We need to pop s2 at this point. s1's new interval is fully past otherInterval, so no point in comparing
-				// this one next round.
-				if !advanceOther() {
-					break diffLoop
-				}
+		case iv.start >= otherInterval.start && iv.start <= otherInterval.end && iv.end > otherInterval.end:
+			// [3, 7] - [1, 5]
+			// We have an end piece to deal with.
+			diffIntervals[len(diffIntervals)-1].start = otherInterval.end + 1
 
-			case iv.start < otherInterval.start && iv.end > otherInterval.end:
-				// [1, 7] - [3, 4]
-				// End is strictly greater. In this case we need to create an extra diff interval. We'll deal with any necessary trimming of it next round.
-				diffIntervals[len(diffIntervals)-1].end = otherInterval.start - 1
-				diffIntervals = append(diffIntervals, interval{start: otherInterval.end + 1, end: iv.end})
+			// We need to pop s2 at this point. s1's new interval is fully past otherInterval, so no point in comparing
+			// this one next round.
+			if !advanceOther() {
+				break diffLoop
+			}
 
-				// We need to pop s2 at this point. s1's new interval is fully past otherInterval, so no point in comparing
-				// this one next round.
-				if !advanceOther() {
-					break diffLoop
-				}
+		case iv.start < otherInterval.start && iv.end > otherInterval.end:
+			// [1, 7] - [3, 4]
+			// End is strictly greater. In this case we need to create an extra diff interval. We'll deal with any necessary trimming of it next round.
+			diffIntervals[len(diffIntervals)-1].end = otherInterval.start - 1
+			diffIntervals = append(diffIntervals, interval{start: otherInterval.end + 1, end: iv.end, tag: iv.tag})
 
-			default:
-				panic("This should never happen.")
+			// We need to pop s2 at this point. s1's new interval is fully past otherInterval, so no point in comparing
+			// this one next round.
+			if !advanceOther() {
+				break diffLoop
 			}
-		}
 
-		if len(intervals) != 0 {
-			// If we've gotten to this point, then we have intervals that exist beyond the bounds of any intervals in otherIntervals, and they
-			// are all diffs and should be added in whole.
-			diffIntervals = append(diffIntervals, intervals...)
+		default:
+			panic("This should never happen.")
 		}
+	}
 
-		if len(diffIntervals) == 0 {
-			delete(differenceSet, sid)
-		} else {
-			differenceSet[sid] = diffIntervals
-		}
+	if len(intervals) != 0 {
+		// If we've gotten to this point, then we have intervals that exist beyond the bounds of any intervals in otherIntervals, and they
+		// are all diffs and should be added in whole.
+		diffIntervals = append(diffIntervals, intervals...)
 	}
 
-	return differenceSet
+	return diffIntervals
 }
 
 // NewMysql56GTIDSetFromSIDBlock builds a Mysql56GTIDSet from parsing a SID Block.
@@ -597,20 +630,32 @@ func (set Mysql56GTIDSet) Difference(other Mysql56GTIDSet) Mysql56GTIDSet {
 //   8       end
 func NewMysql56GTIDSetFromSIDBlock(data []byte) (Mysql56GTIDSet, error) {
 	buf := bytes.NewReader(data)
-	var set Mysql56GTIDSet = make(map[SID][]interval)
+	set := make(Mysql56GTIDSet)
 	var nSIDs uint64
 	if err := binary.Read(buf, binary.LittleEndian, &nSIDs); err != nil {
 		return nil, vterrors.Wrapf(err, "cannot read nSIDs")
 	}
+	tagged := nSIDs&0xff == sidBlockTaggedFormat && nSIDs>>56 == sidBlockTaggedFormat
+	if tagged {
+		nSIDs = nSIDs >> 8 & (1<<48 - 1)
+	}
 	for i := uint64(0); i < nSIDs; i++ {
 		var sid SID
 		if c, err := buf.Read(sid[:]); err != nil || c != 16 {
 			return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "cannot read SID %v: %v %v", i, err, c)
 		}
+		var tag string
+		if tagged {
+			var err error
+			if tag, err = readSIDBlockTag(buf); err != nil {
+				return nil, vterrors.Wrapf(err, "cannot read tag %v", i)
+			}
+		}
 		var nIntervals uint64
 		if err := binary.Read(buf, binary.LittleEndian, &nIntervals); err != nil {
 			return nil, vterrors.Wrapf(err, "cannot read nIntervals %v", i)
 		}
+		var intervals []interval
 		for j := uint64(0); j < nIntervals; j++ {
 			var start, end uint64
 			if err := binary.Read(buf, binary.LittleEndian, &start); err != nil {
@@ -619,35 +664,46 @@ func NewMysql56GTIDSetFromSIDBlock(data []byte) (Mysql56GTIDSet, error) {
 			if err := binary.Read(buf, binary.LittleEndian, &end); err != nil {
 				return nil, vterrors.Wrapf(err, "cannot read end %v/%v", i, j)
 			}
-			set[sid] = append(set[sid], interval{
+			intervals = append(intervals, interval{
 				start: int64(start),
 				end:   int64(end - 1),
+				tag:   tag,
 			})
 		}
+		if len(intervals) > 0 {
+			set[sid] = set[sid].union(newIntervalTree(intervals))
+		}
 	}
 	return set, nil
 }
 
-// popInterval will look at the two pre-sorted interval stacks supplied, and if at least one of the stacks is non-empty
-// will mutate the destination interval with the next earliest interval based on start sequence.
-// popInterval will return true if we were able to pop, or false if both stacks are now empty.
-func popInterval(dst *interval, s1, s2 *[]interval) bool {
-	if len(*s1) == 0 && len(*s2) == 0 {
-		return false
+// readSIDBlockTag reads the tag of an entry of a tagged SID block: its
+// length as a variable-length integer, and its bytes.
+func readSIDBlockTag(buf *bytes.Reader) (string, error) {
+	first, err := buf.ReadByte()
+	if err != nil {
+		return "", err
 	}
-
-	// Find which intervals list has earliest start.
-	if len(*s2) == 0 || (len(*s1) != 0 && (*s1)[0].start <= (*s2)[0].start) {
-		*dst = (*s1)[0]
-		// Progress pointer since this stack has earliest.
-		*s1 = (*s1)[1:]
-	} else {
-		*dst = (*s2)[0]
-		// Progress pointer since this stack has earliest.
-		*s2 = (*s2)[1:]
+	data := make([]byte, bits.TrailingZeros8(^first)+1)
+	data[0] = first
+	if _, err := io.ReadFull(buf, data[1:]); err != nil {
+		return "", err
 	}
-
-	return true
+	length, _, ok := readVarLenInt(data, 0)
+	if !ok {
+		return "", vterrors.Errorf(vtrpc.Code_INTERNAL, "cannot read tag length")
+	}
+	if length == 0 {
+		return "", nil
+	}
+	if length > 32 {
+		return "", vterrors.Errorf(vtrpc.Code_INTERNAL, "invalid tag length %v", length)
+	}
+	tag := make([]byte, length)
+	if _, err := io.ReadFull(buf, tag); err != nil {
+		return "", err
+	}
+	return parseGTIDTag(string(tag))
 }
 
 func init() {
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSortSIDList(t *testing.T) {
@@ -57,38 +58,38 @@ func TestParseMysql56GTIDSet(t *testing.T) {
 		"": {},
 		// Simple case
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5": {
-			sid1: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 		// Capital hex chars
 		"00010203-0405-0607-0809-0A0B0C0D0E0F:1-5": {
-			sid1: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 		// Interval with same start and end
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:12": {
-			sid1: []interval{{12, 12}},
+			sid1: newIntervalTree([]interval{{start: 12, end: 12}}),
 		},
 		// Multiple intervals
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:10-20": {
-			sid1: []interval{{1, 5}, {10, 20}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
 		},
 		// Multiple intervals, out of order
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:10-20:1-5": {
-			sid1: []interval{{1, 5}, {10, 20}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
 		},
 		// Intervals with end < start are discarded by MySQL 5.6
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:8-7": {},
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:8-7:10-20": {
-			sid1: []interval{{1, 5}, {10, 20}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
 		},
 		// Multiple SIDs
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:10-20,00010203-0405-0607-0809-0a0b0c0d0eff:1-5:50": {
-			sid1: []interval{{1, 5}, {10, 20}},
-			sid2: []interval{{1, 5}, {50, 50}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}}),
 		},
 		// Multiple SIDs with space around the comma
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:10-20, 00010203-0405-0607-0809-0a0b0c0d0eff:1-5:50": {
-			sid1: []interval{{1, 5}, {10, 20}},
-			sid2: []interval{{1, 5}, {50, 50}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}}),
 		},
 	}
 
@@ -132,20 +133,20 @@ func TestMysql56GTIDSetString(t *testing.T) {
 	table := map[string]Mysql56GTIDSet{
 		// Simple case
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5": {
-			sid1: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 		// Interval with same start and end
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:12": {
-			sid1: []interval{{12, 12}},
+			sid1: newIntervalTree([]interval{{start: 12, end: 12}}),
 		},
 		// Multiple intervals
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:10-20": {
-			sid1: []interval{{1, 5}, {10, 20}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
 		},
 		// Multiple SIDs
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:10-20,00010203-0405-0607-0809-0a0b0c0d0eff:1-5:50": {
-			sid1: []interval{{1, 5}, {10, 20}},
-			sid2: []interval{{1, 5}, {50, 50}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}}),
 		},
 	}
 
@@ -170,26 +171,26 @@ func TestMysql56GTIDSetContainsGTID(t *testing.T) {
 	sid3 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 17}
 
 	set := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}},
-		sid2: []interval{{1, 5}, {50, 50}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}}),
 	}
 
 	table := map[GTID]bool{
 		fakeGTID{}: false,
 
-		Mysql56GTID{sid1, 1}:  false,
-		Mysql56GTID{sid1, 19}: false,
-		Mysql56GTID{sid1, 20}: true,
-		Mysql56GTID{sid1, 23}: true,
-		Mysql56GTID{sid1, 30}: true,
-		Mysql56GTID{sid1, 31}: false,
+		Mysql56GTID{Server: sid1, Sequence: 1}:  false,
+		Mysql56GTID{Server: sid1, Sequence: 19}: false,
+		Mysql56GTID{Server: sid1, Sequence: 20}: true,
+		Mysql56GTID{Server: sid1, Sequence: 23}: true,
+		Mysql56GTID{Server: sid1, Sequence: 30}: true,
+		Mysql56GTID{Server: sid1, Sequence: 31}: false,
 
-		Mysql56GTID{sid2, 1}:  true,
-		Mysql56GTID{sid2, 10}: false,
-		Mysql56GTID{sid2, 50}: true,
-		Mysql56GTID{sid2, 51}: false,
+		Mysql56GTID{Server: sid2, Sequence: 1}:  true,
+		Mysql56GTID{Server: sid2, Sequence: 10}: false,
+		Mysql56GTID{Server: sid2, Sequence: 50}: true,
+		Mysql56GTID{Server: sid2, Sequence: 51}: false,
 
-		Mysql56GTID{sid3, 1}: false,
+		Mysql56GTID{Server: sid3, Sequence: 1}: false,
 	}
 
 	for input, want := range table {
@@ -206,8 +207,8 @@ func TestMysql56GTIDSetContains(t *testing.T) {
 
 	// The set to test against.
 	set := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}},
-		sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 	}
 
 	// Test cases that should return Contains() = true.
@@ -218,13 +219,13 @@ func TestMysql56GTIDSetContains(t *testing.T) {
 		{},
 
 		// Simple case
-		{sid1: []interval{{25, 30}}},
+		{sid1: newIntervalTree([]interval{{start: 25, end: 30}})},
 		// Multiple intervals
-		{sid2: []interval{{1, 2}, {4, 5}, {60, 70}}},
+		{sid2: newIntervalTree([]interval{{start: 1, end: 2}, {start: 4, end: 5}, {start: 60, end: 70}})},
 		// Multiple SIDs
 		{
-			sid1: []interval{{25, 30}, {35, 37}},
-			sid2: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 25, end: 30}, {start: 35, end: 37}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 	}
 
@@ -240,22 +241,22 @@ func TestMysql56GTIDSetContains(t *testing.T) {
 		fakeGTID{},
 
 		// Simple cases
-		Mysql56GTIDSet{sid1: []interval{{1, 5}}},
-		Mysql56GTIDSet{sid1: []interval{{10, 19}}},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 1, end: 5}})},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 10, end: 19}})},
 		// Overlapping intervals
-		Mysql56GTIDSet{sid1: []interval{{10, 20}}},
-		Mysql56GTIDSet{sid1: []interval{{10, 25}}},
-		Mysql56GTIDSet{sid1: []interval{{25, 31}}},
-		Mysql56GTIDSet{sid1: []interval{{30, 31}}},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 10, end: 20}})},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 10, end: 25}})},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 25, end: 31}})},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 30, end: 31}})},
 		// Multiple intervals
-		Mysql56GTIDSet{sid1: []interval{{20, 30}, {34, 34}}},
+		Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 34, end: 34}})},
 		// Multiple SIDs
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {36, 36}},
-			sid2: []interval{{3, 5}, {55, 60}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 36, end: 36}}),
+			sid2: newIntervalTree([]interval{{start: 3, end: 5}, {start: 55, end: 60}}),
 		},
 		// SID is missing entirely
-		Mysql56GTIDSet{sid3: []interval{{1, 5}}},
+		Mysql56GTIDSet{sid3: newIntervalTree([]interval{{start: 1, end: 5}})},
 	}
 
 	for _, other := range notContained {
@@ -272,8 +273,8 @@ func TestMysql56GTIDSetEqual(t *testing.T) {
 
 	// The set to test against.
 	set := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}},
-		sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 	}
 
 	// Test cases that should return Equal() = true.
@@ -282,8 +283,8 @@ func TestMysql56GTIDSetEqual(t *testing.T) {
 		set,
 		// Different instance, same data
 		{
-			sid1: []interval{{20, 30}, {35, 40}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 	}
 
@@ -305,33 +306,33 @@ func TestMysql56GTIDSetEqual(t *testing.T) {
 		Mysql56GTIDSet{},
 		// Interval changed
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 31}, {35, 40}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 31}, {start: 35, end: 40}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// Interval added
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {32, 33}, {35, 40}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 32, end: 33}, {start: 35, end: 40}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// Interval removed
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {35, 40}},
-			sid2: []interval{{1, 5}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 60, end: 70}}),
 		},
 		// Different SID, same intervals
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {35, 40}},
-			sid3: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+			sid3: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// SID added
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {35, 40}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
-			sid3: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
+			sid3: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 		// SID removed
 		Mysql56GTIDSet{
-			sid1: []interval{{20, 30}, {35, 40}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
 		},
 	}
 
@@ -353,8 +354,8 @@ func TestMysql56GTIDSetAddGTID(t *testing.T) {
 
 	// The set to test against.
 	set := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-		sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 	}
 
 	table := map[GTID]Mysql56GTIDSet{
@@ -363,52 +364,52 @@ func TestMysql56GTIDSetAddGTID(t *testing.T) {
 
 		// Adding GTIDs that are already in the set
 		Mysql56GTID{Server: sid1, Sequence: 20}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		Mysql56GTID{Server: sid1, Sequence: 30}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		Mysql56GTID{Server: sid1, Sequence: 25}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// New interval beginning
 		Mysql56GTID{Server: sid1, Sequence: 1}: {
-			sid1: []interval{{1, 1}, {20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 1}, {start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// New interval middle
 		Mysql56GTID{Server: sid1, Sequence: 32}: {
-			sid1: []interval{{20, 30}, {32, 32}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 32, end: 32}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// New interval end
 		Mysql56GTID{Server: sid1, Sequence: 50}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}, {50, 50}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}, {start: 50, end: 50}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// Extend interval start
 		Mysql56GTID{Server: sid2, Sequence: 49}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {49, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 49, end: 50}, {start: 60, end: 70}}),
 		},
 		// Extend interval end
 		Mysql56GTID{Server: sid2, Sequence: 51}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 51}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 51}, {start: 60, end: 70}}),
 		},
 		// Merge intervals
 		Mysql56GTID{Server: sid1, Sequence: 41}: {
-			sid1: []interval{{20, 30}, {35, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
 		},
 		// Different SID
 		Mysql56GTID{Server: sid3, Sequence: 1}: {
-			sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-			sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
-			sid3: []interval{{1, 1}},
+			sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}, {start: 60, end: 70}}),
+			sid3: newIntervalTree([]interval{{start: 1, end: 1}}),
 		},
 	}
 
@@ -425,22 +426,22 @@ func TestMysql56GTIDSetUnion(t *testing.T) {
 	sid3 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 17}
 
 	set1 := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
-		sid2: []interval{{1, 5}, {20, 50}, {60, 70}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}, {start: 42, end: 45}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 20, end: 50}, {start: 60, end: 70}}),
 	}
 
 	set2 := Mysql56GTIDSet{
-		sid1: []interval{{20, 31}, {35, 37}, {41, 46}},
-		sid2: []interval{{3, 6}, {22, 49}, {67, 72}},
-		sid3: []interval{{1, 45}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 31}, {start: 35, end: 37}, {start: 41, end: 46}}),
+		sid2: newIntervalTree([]interval{{start: 3, end: 6}, {start: 22, end: 49}, {start: 67, end: 72}}),
+		sid3: newIntervalTree([]interval{{start: 1, end: 45}}),
 	}
 
 	got := set1.Union(set2)
 
 	want := Mysql56GTIDSet{
-		sid1: []interval{{20, 31}, {35, 46}},
-		sid2: []interval{{1, 6}, {20, 50}, {60, 72}},
-		sid3: []interval{{1, 45}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 31}, {start: 35, end: 46}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 6}, {start: 20, end: 50}, {start: 60, end: 72}}),
+		sid3: newIntervalTree([]interval{{start: 1, end: 45}}),
 	}
 
 	if !got.Equal(want) {
@@ -456,26 +457,26 @@ func TestMysql56GTIDSetDifference(t *testing.T) {
 	sid5 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 19}
 
 	set1 := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 39}, {40, 53}, {55, 75}},
-		sid2: []interval{{1, 7}, {20, 50}, {60, 70}},
-		sid4: []interval{{1, 30}},
-		sid5: []interval{{1, 7}, {20, 30}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 39}, {start: 40, end: 53}, {start: 55, end: 75}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 7}, {start: 20, end: 50}, {start: 60, end: 70}}),
+		sid4: newIntervalTree([]interval{{start: 1, end: 30}}),
+		sid5: newIntervalTree([]interval{{start: 1, end: 7}, {start: 20, end: 30}}),
 	}
 
 	set2 := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 37}, {50, 60}},
-		sid2: []interval{{3, 5}, {22, 25}, {32, 37}, {67, 70}},
-		sid3: []interval{{1, 45}},
-		sid5: []interval{{2, 6}, {15, 40}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 37}, {start: 50, end: 60}}),
+		sid2: newIntervalTree([]interval{{start: 3, end: 5}, {start: 22, end: 25}, {start: 32, end: 37}, {start: 67, end: 70}}),
+		sid3: newIntervalTree([]interval{{start: 1, end: 45}}),
+		sid5: newIntervalTree([]interval{{start: 2, end: 6}, {start: 15, end: 40}}),
 	}
 
 	got := set1.Difference(set2)
 
 	want := Mysql56GTIDSet{
-		sid1: []interval{{38, 39}, {40, 49}, {61, 75}},
-		sid2: []interval{{1, 2}, {6, 7}, {20, 21}, {26, 31}, {38, 50}, {60, 66}},
-		sid4: []interval{{1, 30}},
-		sid5: []interval{{1, 1}, {7, 7}},
+		sid1: newIntervalTree([]interval{{start: 38, end: 39}, {start: 40, end: 49}, {start: 61, end: 75}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 2}, {start: 6, end: 7}, {start: 20, end: 21}, {start: 26, end: 31}, {start: 38, end: 50}, {start: 60, end: 66}}),
+		sid4: newIntervalTree([]interval{{start: 1, end: 30}}),
+		sid5: newIntervalTree([]interval{{start: 1, end: 1}, {start: 7, end: 7}}),
 	}
 
 	if !got.Equal(want) {
@@ -485,10 +486,10 @@ func TestMysql56GTIDSetDifference(t *testing.T) {
 	sid10 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
 	sid11 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
 	set10 := Mysql56GTIDSet{
-		sid10: []interval{{1, 30}},
+		sid10: newIntervalTree([]interval{{start: 1, end: 30}}),
 	}
 	set11 := Mysql56GTIDSet{
-		sid11: []interval{{1, 30}},
+		sid11: newIntervalTree([]interval{{start: 1, end: 30}}),
 	}
 	got = set10.Difference(set11)
 	want = Mysql56GTIDSet{}
@@ -502,8 +503,8 @@ func TestMysql56GTIDSetSIDBlock(t *testing.T) {
 	sid2 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 16}
 
 	input := Mysql56GTIDSet{
-		sid1: []interval{{20, 30}, {35, 40}},
-		sid2: []interval{{1, 5}},
+		sid1: newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 40}}),
+		sid2: newIntervalTree([]interval{{start: 1, end: 5}}),
 	}
 	want := []byte{
 		// n_sids
@@ -544,6 +545,47 @@ func TestMysql56GTIDSetSIDBlock(t *testing.T) {
 	}
 }
 
+func TestMysql56GTIDSetTaggedSIDBlock(t *testing.T) {
+	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	input := Mysql56GTIDSet{
+		sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 20, end: 30, tag: "ab"}}),
+	}
+	want := []byte{
+		// format, n_sids, format
+		1, 2, 0, 0, 0, 0, 0, 1,
+		// sid1
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		// sid1: no tag
+		0,
+		// sid1: n_intervals
+		1, 0, 0, 0, 0, 0, 0, 0,
+		// sid1: interval 1 start
+		1, 0, 0, 0, 0, 0, 0, 0,
+		// sid1: interval 1 end
+		6, 0, 0, 0, 0, 0, 0, 0,
+		// sid1
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		// sid1: tag length and tag
+		4, 'a', 'b',
+		// sid1:ab: n_intervals
+		1, 0, 0, 0, 0, 0, 0, 0,
+		// sid1:ab: interval 1 start
+		20, 0, 0, 0, 0, 0, 0, 0,
+		// sid1:ab: interval 1 end
+		31, 0, 0, 0, 0, 0, 0, 0,
+	}
+	assert.Equal(t, want, input.SIDBlock())
+
+	set, err := NewMysql56GTIDSetFromSIDBlock(want)
+	require.NoError(t, err)
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:ab:20-30", set.String())
+
+	// Truncated tags are rejected.
+	_, err = NewMysql56GTIDSetFromSIDBlock(want[:67])
+	assert.Error(t, err)
+}
+
 func TestMySQL56GTIDSetLast(t *testing.T) {
 	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
 	sid2 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
@@ -551,23 +593,23 @@ func TestMySQL56GTIDSetLast(t *testing.T) {
 	table := map[string]Mysql56GTIDSet{
 		// Simple case
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:5": {
-			sid1: []interval{{1, 5}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}}),
 		},
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:3": {
-			sid1: []interval{{end: 3}},
+			sid1: newIntervalTree([]interval{{end: 3}}),
 		},
 		// Interval with same start and end
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:12": {
-			sid1: []interval{{12, 12}},
+			sid1: newIntervalTree([]interval{{start: 12, end: 12}}),
 		},
 		// Multiple intervals
 		"00010203-0405-0607-0809-0a0b0c0d0e0f:20": {
-			sid1: []interval{{1, 5}, {10, 20}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
 		},
 		// Multiple SIDs
 		"00010203-0405-0607-0809-0a0b0c0d0eff:50": {
-			sid1: []interval{{1, 5}, {10, 20}},
-			sid2: []interval{{1, 5}, {50, 50}},
+			sid1: newIntervalTree([]interval{{start: 1, end: 5}, {start: 10, end: 20}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 5}, {start: 50, end: 50}}),
 		},
 	}
 
@@ -576,3 +618,99 @@ func TestMySQL56GTIDSetLast(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestParseMysql56GTIDSetTagged(t *testing.T) {
+	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	sid2 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+
+	table := map[string]Mysql56GTIDSet{
+		// Tag only
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:tag1:1-5": {
+			sid1: newIntervalTree([]interval{{start: 1, end: 5, tag: "tag1"}}),
+		},
+		// Untagged and tagged intervals, tags are normalized to lower case
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:Tag_B:3:7-9:tag_a:1-2": {
+			sid1: newIntervalTree([]interval{
+				{start: 1, end: 5},
+				{start: 1, end: 2, tag: "tag_a"},
+				{start: 3, end: 3, tag: "tag_b"},
+				{start: 7, end: 9, tag: "tag_b"},
+			}),
+		},
+		// Same SID listed several times
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:1-5,00010203-0405-0607-0809-0a0b0c0d0e0f:tag1:1-5,00010203-0405-0607-0809-0a0b0c0d0e0f:6-7": {
+			sid1: newIntervalTree([]interval{{start: 1, end: 7}, {start: 1, end: 5, tag: "tag1"}}),
+		},
+		// Multiple SIDs
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:tag1:1-5,00010203-0405-0607-0809-0a0b0c0d0eff:3-4:tag2:1": {
+			sid1: newIntervalTree([]interval{{start: 1, end: 5, tag: "tag1"}}),
+			sid2: newIntervalTree([]interval{{start: 3, end: 4}, {start: 1, end: 1, tag: "tag2"}}),
+		},
+	}
+
+	for input, want := range table {
+		t.Run(input, func(t *testing.T) {
+			got, err := parseMysql56GTIDSet(input)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	for _, input := range []string{
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:tag-1:1-5",
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:_123456789012345678901234567890123:1-5",
+		"00010203-0405-0607-0809-0a0b0c0d0e0f:tag1:a-5",
+	} {
+		_, err := parseMysql56GTIDSet(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestMysql56GTIDSetTaggedOperations(t *testing.T) {
+	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	set, err := parseMysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:tag1:1-10:tag2:1-3")
+	assert.NoError(t, err)
+	set56 := set.(Mysql56GTIDSet)
+
+	// String preserves the tags.
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:tag1:1-10:tag2:1-3", set.String())
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:tag2:3", set56.Last())
+
+	// ContainsGTID compares sequences of the same tag only.
+	assert.True(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Sequence: 5}))
+	assert.False(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Sequence: 6}))
+	assert.True(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Tag: "tag1", Sequence: 6}))
+	assert.False(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Tag: "tag2", Sequence: 6}))
+	assert.False(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Tag: "tag0", Sequence: 1}))
+	assert.False(t, set.ContainsGTID(Mysql56GTID{Server: sid1, Tag: "tag3", Sequence: 1}))
+
+	// Contains and Equal.
+	subset, err := parseMysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:2-3:tag1:5-10")
+	assert.NoError(t, err)
+	assert.True(t, set.Contains(subset))
+	assert.False(t, subset.Contains(set))
+	notSubset, err := parseMysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:tag2:5-10")
+	assert.NoError(t, err)
+	assert.False(t, set.Contains(notSubset))
+	assert.False(t, set.Equal(subset))
+
+	// AddGTID merges into the intervals of the same tag only.
+	got := set.AddGTID(Mysql56GTID{Server: sid1, Tag: "tag2", Sequence: 4})
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:tag1:1-10:tag2:1-4", got.String())
+	got = set.AddGTID(Mysql56GTID{Server: sid1, Tag: "a", Sequence: 6})
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:a:6:tag1:1-10:tag2:1-3", got.String())
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:tag1:1-10:tag2:1-3", set.String())
+
+	// Union and Difference.
+	other, err := parseMysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:6-7:tag2:4-8:tag3:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-7:tag1:1-10:tag2:1-8:tag3:1", set.Union(other).String())
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5:tag1:1-10:tag2:1-3", set56.Difference(other.(Mysql56GTIDSet)).String())
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:6-7:tag2:4-8:tag3:1", other.(Mysql56GTIDSet).Difference(set56).String())
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:1:4-5:tag1:1-4:tag2:1-3", set56.Difference(subset.(Mysql56GTIDSet)).String())
+
+	// The SID block of a tagged set uses the tagged format.
+	block, err := NewMysql56GTIDSetFromSIDBlock(set56.SIDBlock())
+	assert.NoError(t, err)
+	assert.True(t, set.Equal(block))
+}
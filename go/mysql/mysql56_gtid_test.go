@@ -19,6 +19,9 @@ package mysql
 import (
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseMysql56GTID(t *testing.T) {
@@ -141,8 +144,26 @@ func TestMysql56SequenceNumber(t *testing.T) {
 func TestMysql56GTIDGTIDSet(t *testing.T) {
 	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
 	input := Mysql56GTID{Server: sid1, Sequence: 5432}
-	want := Mysql56GTIDSet{sid1: []interval{{5432, 5432}}}
+	want := Mysql56GTIDSet{sid1: newIntervalTree([]interval{{start: 5432, end: 5432}})}
 	if got := input.GTIDSet(); !got.Equal(want) {
 		t.Errorf("%#v.GTIDSet() = %#v, want %#v", input, got, want)
 	}
 }
+
+func TestParseMysql56GTIDTagged(t *testing.T) {
+	input := "00010203-0405-0607-0809-0A0B0C0D0E0F:My_Tag:56789"
+	want := Mysql56GTID{
+		Server:   SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+		Tag:      "my_tag",
+		Sequence: 56789,
+	}
+
+	got, err := parseMysql56GTID(input)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, "00010203-0405-0607-0809-0a0b0c0d0e0f:my_tag:56789", got.String())
+	assert.Equal(t, Mysql56GTIDSet{want.Server: newIntervalTree([]interval{{start: 56789, end: 56789, tag: "my_tag"}})}, got.GTIDSet())
+
+	_, err = parseMysql56GTID("00010203-0405-0607-0809-0A0B0C0D0E0F:1tag:56789")
+	assert.Error(t, err)
+}
@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 
+	"vitess.io/vitess/go/hack"
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/vterrors"
@@ -40,7 +41,7 @@ import (
 // Returns SQLError(CRServerGone) if it can't.
 func (c *Conn) WriteComQuery(query string) error {
 	// This is a new command, need to reset the sequence.
-	c.sequence = 0
+	c.resetSequence()
 
 	data, pos := c.startEphemeralPacketWithHeader(len(query) + 1)
 	data[pos] = ComQuery
@@ -79,6 +80,23 @@ func (c *Conn) writeComSetOption(operation uint16) error {
 	return nil
 }
 
+// writeComFieldList requests the column definitions of a table.
+// Client -> Server.
+// Returns SQLError(CRServerGone) if it can't.
+func (c *Conn) writeComFieldList(table, wildcard string) error {
+	// This is a new command, need to reset the sequence.
+	c.resetSequence()
+
+	data, pos := c.startEphemeralPacketWithHeader(1 + len(table) + 1 + len(wildcard))
+	pos = writeByte(data, pos, ComFieldList)
+	pos = writeNullString(data, pos, table)
+	copy(data[pos:], wildcard)
+	if err := c.writeEphemeralPacket(); err != nil {
+		return NewSQLError(CRServerGone, SSUnknownSQLState, err.Error())
+	}
+	return nil
+}
+
 // readColumnDefinition reads the next Column Definition packet.
 // Returns a SQLError.
 func (c *Conn) readColumnDefinition(field *querypb.Field, index int) error {
@@ -887,6 +905,17 @@ func (c *Conn) parseComInitDB(data []byte) string {
 	return string(data[1:])
 }
 
+// parseComFieldList returns the table name and the column wildcard of
+// a COM_FIELD_LIST packet. The table name is NUL-terminated, and the
+// wildcard is the rest of the packet.
+func (c *Conn) parseComFieldList(data []byte) (string, string, bool) {
+	table, pos, ok := readNullString(data, 1)
+	if !ok {
+		return "", "", false
+	}
+	return table, string(data[pos:]), true
+}
+
 func (c *Conn) sendColumnCount(count uint64) error {
 	length := lenEncIntSize(count)
 	data, pos := c.startEphemeralPacketWithHeader(length)
@@ -895,6 +924,14 @@ func (c *Conn) sendColumnCount(count uint64) error {
 }
 
 func (c *Conn) writeColumnDefinition(field *querypb.Field) error {
+	return c.writeColumnDefinitionPacket(field, false)
+}
+
+// writeColumnDefinitionPacket writes a Column Definition packet. If
+// withDefault is set, the packet ends with the column default value, as
+// expected in a COM_FIELD_LIST response. Fields don't carry the default
+// value, so it is always sent as NULL.
+func (c *Conn) writeColumnDefinitionPacket(field *querypb.Field, withDefault bool) error {
 	length := 4 + // lenEncStringSize("def")
 		lenEncStringSize(field.Database) +
 		lenEncStringSize(field.Table) +
@@ -908,6 +945,9 @@ func (c *Conn) writeColumnDefinition(field *querypb.Field) error {
 		2 + // flags
 		1 + // decimals
 		2 // filler
+	if withDefault {
+		length++ // NULL default value
+	}
 
 	// Get the type and the flags back. If the Field contains
 	// non-zero flags, we use them. Otherwise use the flags we
@@ -932,6 +972,9 @@ func (c *Conn) writeColumnDefinition(field *querypb.Field) error {
 	pos = writeUint16(data, pos, uint16(flags))
 	pos = writeByte(data, pos, byte(field.Decimals))
 	pos = writeUint16(data, pos, uint16(0x0000))
+	if withDefault {
+		pos = writeByte(data, pos, NullValue)
+	}
 
 	if pos != len(data) {
 		return vterrors.Errorf(vtrpc.Code_INTERNAL, "packing of column definition used %v bytes instead of %v", pos, len(data))
@@ -1000,6 +1043,18 @@ func (c *Conn) writeRows(result *sqltypes.Result) error {
 	return nil
 }
 
+// writeFieldList writes the response to a COM_FIELD_LIST: one Column
+// Definition packet per field, followed by an EOF packet (or an OK
+// packet with an EOF header if CapabilityClientDeprecateEOF is set).
+func (c *Conn) writeFieldList(fields []*querypb.Field) error {
+	for _, field := range fields {
+		if err := c.writeColumnDefinitionPacket(field, true); err != nil {
+			return err
+		}
+	}
+	return c.writeEndResult(false, 0, 0, 0)
+}
+
 // writeEndResult concludes the sending of a Result.
 // if more is set to true, then it means there are more results afterwords
 func (c *Conn) writeEndResult(more bool, affectedRows, lastInsertID uint64, warnings uint16) error {
@@ -1109,41 +1164,15 @@ func (c *Conn) writePrepare(fld []*querypb.Field, prepare *PrepareData) error {
 }
 
 func (c *Conn) writeBinaryRow(fields []*querypb.Field, row []sqltypes.Value) error {
-	length := 0
-	nullBitMapLen := (len(fields) + 7 + 2) / 8
-	for _, val := range row {
-		if !val.IsNull() {
-			l, err := val2MySQLLen(val)
-			if err != nil {
-				return fmt.Errorf("internal value %v get MySQL value length error: %v", val, err)
-			}
-			length += l
-		}
+	length, err := binaryRowLen(fields, row)
+	if err != nil {
+		return err
 	}
 
-	length += nullBitMapLen + 1
-
 	data, pos := c.startEphemeralPacketWithHeader(length)
-
-	pos = writeByte(data, pos, 0x00)
-
-	for i := 0; i < nullBitMapLen; i++ {
-		pos = writeByte(data, pos, 0x00)
-	}
-
-	for i, val := range row {
-		if val.IsNull() {
-			bytePos := (i+2)/8 + 1 + packetHeaderSize
-			bitPos := (i + 2) % 8
-			data[bytePos] |= 1 << uint(bitPos)
-		} else {
-			v, err := val2MySQL(val)
-			if err != nil {
-				c.recycleWritePacket()
-				return fmt.Errorf("internal value %v to MySQL value error: %v", val, err)
-			}
-			pos += copy(data[pos:], v)
-		}
+	if _, err := writeBinaryRowData(data, pos, fields, row); err != nil {
+		c.recycleWritePacket()
+		return err
 	}
 
 	return c.writeEphemeralPacket()
@@ -1159,314 +1188,304 @@ func (c *Conn) writeBinaryRows(result *sqltypes.Result) error {
 	return nil
 }
 
+// binaryRowLen returns the exact number of bytes needed to encode
+// row with writeBinaryRowData.
+func binaryRowLen(fields []*querypb.Field, row []sqltypes.Value) (int, error) {
+	length := 1 + binaryRowNullBitMapLen(len(fields))
+	for _, val := range row {
+		if val.IsNull() {
+			continue
+		}
+		l, err := val2MySQLLen(val)
+		if err != nil {
+			return 0, fmt.Errorf("internal value %v get MySQL value length error: %v", val, err)
+		}
+		length += l
+	}
+	return length, nil
+}
+
+// binaryRowNullBitMapLen returns the length of the NULL bitmap of a
+// binary protocol row. The bitmap has an offset of 2 bits.
+func binaryRowNullBitMapLen(numFields int) int {
+	return (numFields + 7 + 2) / 8
+}
+
+// writeBinaryRowData encodes row in the binary protocol row format
+// directly into data, starting at pos. data must be at least
+// binaryRowLen(fields, row) bytes long after pos. It returns the
+// position after the row.
+func writeBinaryRowData(data []byte, pos int, fields []*querypb.Field, row []sqltypes.Value) (int, error) {
+	start := pos
+	pos = writeByte(data, pos, 0x00)
+	pos = writeZeroes(data, pos, binaryRowNullBitMapLen(len(fields)))
+
+	var err error
+	for i, val := range row {
+		if val.IsNull() {
+			bytePos := start + 1 + (i+2)/8
+			bitPos := (i + 2) % 8
+			data[bytePos] |= 1 << uint(bitPos)
+			continue
+		}
+		if pos, err = writeBinaryValue(data, pos, val); err != nil {
+			return 0, fmt.Errorf("internal value %v to MySQL value error: %v", val, err)
+		}
+	}
+	return pos, nil
+}
+
+// val2MySQL returns the binary protocol encoding of v in a newly
+// allocated slice. The row writers use writeBinaryValue instead.
 func val2MySQL(v sqltypes.Value) ([]byte, error) {
-	var out []byte
-	pos := 0
+	length, err := val2MySQLLen(v)
+	if err != nil {
+		return []byte{}, err
+	}
+	out := make([]byte, length)
+	if _, err := writeBinaryValue(out, 0, v); err != nil {
+		return []byte{}, err
+	}
+	return out, nil
+}
+
+// writeBinaryValue encodes v in the binary protocol format directly into
+// data, starting at pos, and returns the position after the value.
+// data must be at least val2MySQLLen(v) bytes long after pos.
+func writeBinaryValue(data []byte, pos int, v sqltypes.Value) (int, error) {
+	raw := v.Raw()
 	switch v.Type() {
 	case sqltypes.Null:
 		// no-op
 	case sqltypes.Int8:
-		val, err := strconv.ParseInt(v.ToString(), 10, 8)
+		val, err := strconv.ParseInt(hack.String(raw), 10, 8)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 1)
-		writeByte(out, pos, uint8(val))
+		pos = writeByte(data, pos, uint8(val))
 	case sqltypes.Uint8:
-		val, err := strconv.ParseUint(v.ToString(), 10, 8)
+		val, err := strconv.ParseUint(hack.String(raw), 10, 8)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 1)
-		writeByte(out, pos, uint8(val))
+		pos = writeByte(data, pos, uint8(val))
 	case sqltypes.Uint16:
-		val, err := strconv.ParseUint(v.ToString(), 10, 16)
+		val, err := strconv.ParseUint(hack.String(raw), 10, 16)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 2)
-		writeUint16(out, pos, uint16(val))
+		pos = writeUint16(data, pos, uint16(val))
 	case sqltypes.Int16, sqltypes.Year:
-		val, err := strconv.ParseInt(v.ToString(), 10, 16)
+		val, err := strconv.ParseInt(hack.String(raw), 10, 16)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 2)
-		writeUint16(out, pos, uint16(val))
+		pos = writeUint16(data, pos, uint16(val))
 	case sqltypes.Uint24, sqltypes.Uint32:
-		val, err := strconv.ParseUint(v.ToString(), 10, 32)
+		val, err := strconv.ParseUint(hack.String(raw), 10, 32)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 4)
-		writeUint32(out, pos, uint32(val))
+		pos = writeUint32(data, pos, uint32(val))
 	case sqltypes.Int24, sqltypes.Int32:
-		val, err := strconv.ParseInt(v.ToString(), 10, 32)
+		val, err := strconv.ParseInt(hack.String(raw), 10, 32)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 4)
-		writeUint32(out, pos, uint32(val))
+		pos = writeUint32(data, pos, uint32(val))
 	case sqltypes.Float32:
-		val, err := strconv.ParseFloat(v.ToString(), 32)
+		val, err := strconv.ParseFloat(hack.String(raw), 32)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		bits := math.Float32bits(float32(val))
-		out = make([]byte, 4)
-		writeUint32(out, pos, bits)
+		pos = writeUint32(data, pos, math.Float32bits(float32(val)))
 	case sqltypes.Uint64:
-		val, err := strconv.ParseUint(v.ToString(), 10, 64)
+		val, err := strconv.ParseUint(hack.String(raw), 10, 64)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 8)
-		writeUint64(out, pos, uint64(val))
+		pos = writeUint64(data, pos, val)
 	case sqltypes.Int64:
-		val, err := strconv.ParseInt(v.ToString(), 10, 64)
+		val, err := strconv.ParseInt(hack.String(raw), 10, 64)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		out = make([]byte, 8)
-		writeUint64(out, pos, uint64(val))
+		pos = writeUint64(data, pos, uint64(val))
 	case sqltypes.Float64:
-		val, err := strconv.ParseFloat(v.ToString(), 64)
+		val, err := strconv.ParseFloat(hack.String(raw), 64)
 		if err != nil {
-			return []byte{}, err
+			return 0, err
 		}
-		bits := math.Float64bits(val)
-		out = make([]byte, 8)
-		writeUint64(out, pos, bits)
+		pos = writeUint64(data, pos, math.Float64bits(val))
 	case sqltypes.Timestamp, sqltypes.Date, sqltypes.Datetime:
-		if len(v.Raw()) > 19 {
-			out = make([]byte, 1+11)
-			out[pos] = 0x0b
-			pos++
-			year, err := strconv.ParseUint(string(v.Raw()[0:4]), 10, 16)
-			if err != nil {
-				return []byte{}, err
-			}
-			month, err := strconv.ParseUint(string(v.Raw()[5:7]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			day, err := strconv.ParseUint(string(v.Raw()[8:10]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			hour, err := strconv.ParseUint(string(v.Raw()[11:13]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			minute, err := strconv.ParseUint(string(v.Raw()[14:16]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			second, err := strconv.ParseUint(string(v.Raw()[17:19]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			val := make([]byte, 6)
-			count := copy(val, v.Raw()[20:])
-			for i := 0; i < (6 - count); i++ {
-				val[count+i] = 0x30
-			}
-			microSecond, err := strconv.ParseUint(string(val), 10, 32)
-			if err != nil {
-				return []byte{}, err
-			}
-			pos = writeUint16(out, pos, uint16(year))
-			pos = writeByte(out, pos, byte(month))
-			pos = writeByte(out, pos, byte(day))
-			pos = writeByte(out, pos, byte(hour))
-			pos = writeByte(out, pos, byte(minute))
-			pos = writeByte(out, pos, byte(second))
-			writeUint32(out, pos, uint32(microSecond))
-		} else if len(v.Raw()) > 10 {
-			out = make([]byte, 1+7)
-			out[pos] = 0x07
-			pos++
-			year, err := strconv.ParseUint(string(v.Raw()[0:4]), 10, 16)
-			if err != nil {
-				return []byte{}, err
-			}
-			month, err := strconv.ParseUint(string(v.Raw()[5:7]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			day, err := strconv.ParseUint(string(v.Raw()[8:10]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			hour, err := strconv.ParseUint(string(v.Raw()[11:13]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			minute, err := strconv.ParseUint(string(v.Raw()[14:16]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			second, err := strconv.ParseUint(string(v.Raw()[17:]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			pos = writeUint16(out, pos, uint16(year))
-			pos = writeByte(out, pos, byte(month))
-			pos = writeByte(out, pos, byte(day))
-			pos = writeByte(out, pos, byte(hour))
-			pos = writeByte(out, pos, byte(minute))
-			writeByte(out, pos, byte(second))
-		} else if len(v.Raw()) > 0 {
-			out = make([]byte, 1+4)
-			out[pos] = 0x04
-			pos++
-			year, err := strconv.ParseUint(string(v.Raw()[0:4]), 10, 16)
-			if err != nil {
-				return []byte{}, err
-			}
-			month, err := strconv.ParseUint(string(v.Raw()[5:7]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			day, err := strconv.ParseUint(string(v.Raw()[8:]), 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			pos = writeUint16(out, pos, uint16(year))
-			pos = writeByte(out, pos, byte(month))
-			writeByte(out, pos, byte(day))
-		} else {
-			out = make([]byte, 1)
-			out[pos] = 0x00
-		}
+		return writeBinaryDatetime(data, pos, hack.String(raw))
 	case sqltypes.Time:
-		if string(v.Raw()) == "00:00:00" {
-			out = make([]byte, 1)
-			out[pos] = 0x00
-		} else if strings.Contains(string(v.Raw()), ".") {
-			out = make([]byte, 1+12)
-			out[pos] = 0x0c
-			pos++
-
-			sub1 := strings.Split(string(v.Raw()), ":")
-			if len(sub1) != 3 {
-				err := fmt.Errorf("incorrect time value, ':' is not found")
-				return []byte{}, err
-			}
-			sub2 := strings.Split(sub1[2], ".")
-			if len(sub2) != 2 {
-				err := fmt.Errorf("incorrect time value, '.' is not found")
-				return []byte{}, err
-			}
+		return writeBinaryTime(data, pos, hack.String(raw))
+	case sqltypes.Decimal, sqltypes.Text, sqltypes.Blob, sqltypes.VarChar,
+		sqltypes.VarBinary, sqltypes.Char, sqltypes.Bit, sqltypes.Enum,
+		sqltypes.Set, sqltypes.Geometry, sqltypes.Binary, sqltypes.TypeJSON:
+		pos = writeLenEncInt(data, pos, uint64(len(raw)))
+		pos += copy(data[pos:], raw)
+	default:
+		pos += copy(data[pos:], raw)
+	}
+	return pos, nil
+}
 
-			var total []byte
-			if strings.HasPrefix(sub1[0], "-") {
-				out[pos] = 0x01
-				total = []byte(sub1[0])
-				total = total[1:]
-			} else {
-				out[pos] = 0x00
-				total = []byte(sub1[0])
-			}
-			pos++
+// writeBinaryDatetime encodes a DATE, DATETIME or TIMESTAMP value in
+// its text form 'YYYY-MM-DD[ hh:mm:ss[.ffffff]]'.
+func writeBinaryDatetime(data []byte, pos int, s string) (int, error) {
+	if len(s) == 0 {
+		return writeByte(data, pos, 0x00), nil
+	}
 
-			h, err := strconv.ParseUint(string(total), 10, 32)
-			if err != nil {
-				return []byte{}, err
-			}
+	var length byte
+	switch {
+	case len(s) > 19:
+		length = 0x0b
+	case len(s) > 10:
+		length = 0x07
+	default:
+		length = 0x04
+	}
 
-			days := uint32(h) / 24
-			hours := uint32(h) % 24
-			minute := sub1[1]
-			second := sub2[0]
-			microSecond := sub2[1]
+	year, err := strconv.ParseUint(s[0:4], 10, 16)
+	if err != nil {
+		return 0, err
+	}
+	month, err := strconv.ParseUint(s[5:7], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	dayEnd := 10
+	if length == 0x04 {
+		dayEnd = len(s)
+	}
+	day, err := strconv.ParseUint(s[8:dayEnd], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	pos = writeByte(data, pos, length)
+	pos = writeUint16(data, pos, uint16(year))
+	pos = writeByte(data, pos, byte(month))
+	pos = writeByte(data, pos, byte(day))
+	if length == 0x04 {
+		return pos, nil
+	}
 
-			minutes, err := strconv.ParseUint(minute, 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
+	hour, err := strconv.ParseUint(s[11:13], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	minute, err := strconv.ParseUint(s[14:16], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	secondEnd := 19
+	if length == 0x07 {
+		secondEnd = len(s)
+	}
+	second, err := strconv.ParseUint(s[17:secondEnd], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	pos = writeByte(data, pos, byte(hour))
+	pos = writeByte(data, pos, byte(minute))
+	pos = writeByte(data, pos, byte(second))
+	if length == 0x07 {
+		return pos, nil
+	}
 
-			seconds, err := strconv.ParseUint(second, 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			pos = writeUint32(out, pos, uint32(days))
-			pos = writeByte(out, pos, byte(hours))
-			pos = writeByte(out, pos, byte(minutes))
-			pos = writeByte(out, pos, byte(seconds))
-
-			val := make([]byte, 6)
-			count := copy(val, microSecond)
-			for i := 0; i < (6 - count); i++ {
-				val[count+i] = 0x30
-			}
-			microSeconds, err := strconv.ParseUint(string(val), 10, 32)
-			if err != nil {
-				return []byte{}, err
-			}
-			writeUint32(out, pos, uint32(microSeconds))
-		} else if len(v.Raw()) > 0 {
-			out = make([]byte, 1+8)
-			out[pos] = 0x08
-			pos++
+	microSecond, err := parseMicroseconds(s[20:])
+	if err != nil {
+		return 0, err
+	}
+	return writeUint32(data, pos, microSecond), nil
+}
 
-			sub1 := strings.Split(string(v.Raw()), ":")
-			if len(sub1) != 3 {
-				err := fmt.Errorf("incorrect time value, ':' is not found")
-				return []byte{}, err
-			}
+// writeBinaryTime encodes a TIME value in its text form
+// '[-]hhh:mm:ss[.ffffff]'.
+func writeBinaryTime(data []byte, pos int, s string) (int, error) {
+	if s == "00:00:00" {
+		return writeByte(data, pos, 0x00), nil
+	}
+	if len(s) == 0 {
+		return 0, fmt.Errorf("incorrect time value")
+	}
 
-			var total []byte
-			if strings.HasPrefix(sub1[0], "-") {
-				out[pos] = 0x01
-				total = []byte(sub1[0])
-				total = total[1:]
-			} else {
-				out[pos] = 0x00
-				total = []byte(sub1[0])
-			}
-			pos++
+	hasFraction := strings.IndexByte(s, '.') >= 0
+	total, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("incorrect time value, ':' is not found")
+	}
+	minute, second, ok := strings.Cut(rest, ":")
+	if !ok || strings.IndexByte(second, ':') >= 0 {
+		return 0, fmt.Errorf("incorrect time value, ':' is not found")
+	}
+	var microSecond string
+	if hasFraction {
+		second, microSecond, ok = strings.Cut(second, ".")
+		if !ok || strings.IndexByte(microSecond, '.') >= 0 {
+			return 0, fmt.Errorf("incorrect time value, '.' is not found")
+		}
+	}
 
-			h, err := strconv.ParseUint(string(total), 10, 32)
-			if err != nil {
-				return []byte{}, err
-			}
+	var negative byte
+	if strings.HasPrefix(total, "-") {
+		negative = 0x01
+		total = total[1:]
+	}
+	h, err := strconv.ParseUint(total, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseUint(minute, 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseUint(second, 10, 8)
+	if err != nil {
+		return 0, err
+	}
 
-			days := uint32(h) / 24
-			hours := uint32(h) % 24
-			minute := sub1[1]
-			second := sub1[2]
+	if hasFraction {
+		pos = writeByte(data, pos, 0x0c)
+	} else {
+		pos = writeByte(data, pos, 0x08)
+	}
+	pos = writeByte(data, pos, negative)
+	pos = writeUint32(data, pos, uint32(h)/24)
+	pos = writeByte(data, pos, byte(uint32(h)%24))
+	pos = writeByte(data, pos, byte(minutes))
+	pos = writeByte(data, pos, byte(seconds))
+	if !hasFraction {
+		return pos, nil
+	}
 
-			minutes, err := strconv.ParseUint(minute, 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
+	microSeconds, err := parseMicroseconds(microSecond)
+	if err != nil {
+		return 0, err
+	}
+	return writeUint32(data, pos, microSeconds), nil
+}
 
-			seconds, err := strconv.ParseUint(second, 10, 8)
-			if err != nil {
-				return []byte{}, err
-			}
-			pos = writeUint32(out, pos, uint32(days))
-			pos = writeByte(out, pos, byte(hours))
-			pos = writeByte(out, pos, byte(minutes))
-			writeByte(out, pos, byte(seconds))
-		} else {
-			err := fmt.Errorf("incorrect time value")
-			return []byte{}, err
-		}
-	case sqltypes.Decimal, sqltypes.Text, sqltypes.Blob, sqltypes.VarChar,
-		sqltypes.VarBinary, sqltypes.Char, sqltypes.Bit, sqltypes.Enum,
-		sqltypes.Set, sqltypes.Geometry, sqltypes.Binary, sqltypes.TypeJSON:
-		l := len(v.Raw())
-		length := lenEncIntSize(uint64(l)) + l
-		out = make([]byte, length)
-		pos = writeLenEncInt(out, pos, uint64(l))
-		copy(out[pos:], v.Raw())
-	default:
-		out = make([]byte, len(v.Raw()))
-		copy(out, v.Raw())
+// parseMicroseconds parses the fractional part of a temporal value,
+// right-padding it with zeroes (or truncating it) to 6 digits.
+func parseMicroseconds(frac string) (uint32, error) {
+	if len(frac) > 6 {
+		frac = frac[:6]
 	}
-	return out, nil
+	if len(frac) == 0 {
+		return 0, nil
+	}
+	val, err := strconv.ParseUint(frac, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(frac); i < 6; i++ {
+		val *= 10
+	}
+	return uint32(val), nil
 }
 
 func val2MySQLLen(v sqltypes.Value) (int, error) {
@@ -1495,9 +1514,9 @@ func val2MySQLLen(v sqltypes.Value) (int, error) {
 			length = 1
 		}
 	case sqltypes.Time:
-		if string(v.Raw()) == "00:00:00" {
+		if hack.String(v.Raw()) == "00:00:00" {
 			length = 1
-		} else if strings.Contains(string(v.Raw()), ".") {
+		} else if strings.Contains(hack.String(v.Raw()), ".") {
 			length = 13
 		} else if len(v.Raw()) > 0 {
 			length = 9
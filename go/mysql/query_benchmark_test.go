@@ -24,6 +24,10 @@ import (
 	"testing"
 
 	"context"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
 )
 
 var testReadConnBufferSize = connBufferSize
@@ -117,3 +121,38 @@ func BenchmarkParallelMediumQueries(b *testing.B) {
 func BenchmarkParallelRandomQueries(b *testing.B) {
 	benchmarkQuery(b, 10, "")
 }
+
+func BenchmarkWriteBinaryRow(b *testing.B) {
+	fields := []*querypb.Field{
+		{Name: "id", Type: querypb.Type_INT64},
+		{Name: "score", Type: querypb.Type_FLOAT64},
+		{Name: "name", Type: querypb.Type_VARCHAR},
+		{Name: "created", Type: querypb.Type_DATETIME},
+		{Name: "duration", Type: querypb.Type_TIME},
+		{Name: "deleted", Type: querypb.Type_DATETIME},
+	}
+	row := []sqltypes.Value{
+		sqltypes.NewInt64(1234567),
+		sqltypes.NewFloat64(3.14),
+		sqltypes.NewVarChar("some reasonably sized varchar value"),
+		sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2021-02-03 04:05:06.123456")),
+		sqltypes.MakeTrusted(querypb.Type_TIME, []byte("-26:05:06")),
+		sqltypes.NULL,
+	}
+	length, err := binaryRowLen(fields, row)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, packetHeaderSize+length)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := binaryRowLen(fields, row); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := writeBinaryRowData(data, packetHeaderSize, fields, row); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
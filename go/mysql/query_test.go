@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 
@@ -96,6 +97,143 @@ func TestComInitDB(t *testing.T) {
 	}
 }
 
+type fieldListHandler struct {
+	testHandler
+	table, wildcard string
+	fields          []*querypb.Field
+}
+
+func (h *fieldListHandler) ComFieldList(c *Conn, table, wildcard string) ([]*querypb.Field, error) {
+	h.table, h.wildcard = table, wildcard
+	return h.fields, nil
+}
+
+func TestComFieldList(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	handler := &fieldListHandler{
+		fields: []*querypb.Field{{
+			Name:     "id",
+			Type:     querypb.Type_INT64,
+			Table:    "t",
+			OrgTable: "t",
+			Database: "db",
+			OrgName:  "id",
+		}, {
+			Name:     "id2",
+			Type:     querypb.Type_VARCHAR,
+			Table:    "t",
+			OrgTable: "t",
+			Database: "db",
+			OrgName:  "id2",
+		}},
+	}
+
+	for _, capabilities := range []uint32{0, CapabilityClientDeprecateEOF} {
+		sConn.Capabilities = capabilities
+		cConn.Capabilities = capabilities
+
+		require.NoError(t, cConn.writeComFieldList("t", "id%"))
+		require.True(t, sConn.handleNextCommand(handler))
+		assert.Equal(t, "t", handler.table)
+		assert.Equal(t, "id%", handler.wildcard)
+
+		for i, want := range handler.fields {
+			got := &querypb.Field{}
+			require.NoError(t, cConn.readColumnDefinition(got, i))
+			assert.True(t, proto.Equal(want, got), "field %d: got %v, want %v", i, got, want)
+		}
+		data, err := cConn.ReadPacket()
+		require.NoError(t, err)
+		assert.True(t, cConn.isEOFPacket(data), "expected EOF packet, got %v", data)
+	}
+
+	// A table name without the NUL terminator is rejected.
+	cConn.sequence = 0
+	data, pos := cConn.startEphemeralPacketWithHeader(2)
+	writeByte(data, pos, ComFieldList)
+	data[pos+1] = 't'
+	require.NoError(t, cConn.writeEphemeralPacket())
+	require.True(t, sConn.handleNextCommand(handler))
+	data, err := cConn.ReadPacket()
+	require.NoError(t, err)
+	require.True(t, isErrorPacket(data))
+	assert.Equal(t, ERUnknownComError, ParseErrorPacket(data).(*SQLError).Number())
+}
+
+func TestComFieldListUnimplemented(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	require.NoError(t, cConn.writeComFieldList("t", ""))
+	require.True(t, sConn.handleNextCommand(&testHandler{}))
+	data, err := cConn.ReadPacket()
+	require.NoError(t, err)
+	require.True(t, isErrorPacket(data))
+	assert.Equal(t, ERUnknownComError, ParseErrorPacket(data).(*SQLError).Number())
+}
+
+type statisticsHandler struct {
+	testHandler
+}
+
+func (h *statisticsHandler) ComStatistics(c *Conn) []Statistic {
+	return []Statistic{{Name: "Questions", Value: "5"}, {Name: "Slow queries", Value: "0"}}
+}
+
+func TestComStatistics(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+	sConn.listener = &Listener{startTime: time.Now().Add(-10 * time.Second)}
+
+	for _, handler := range []Handler{&testHandler{}, &statisticsHandler{}} {
+		cConn.sequence = 0
+		data, pos := cConn.startEphemeralPacketWithHeader(1)
+		writeByte(data, pos, ComStatistics)
+		require.NoError(t, cConn.writeEphemeralPacket())
+		require.True(t, sConn.handleNextCommand(handler))
+
+		data, err := cConn.ReadPacket()
+		require.NoError(t, err)
+		want := fmt.Sprintf("Uptime: 10  Threads: %d", connCount.Get())
+		if _, ok := handler.(*statisticsHandler); ok {
+			want += "  Questions: 5  Slow queries: 0"
+		}
+		assert.Equal(t, want, string(data))
+	}
+}
+
+func TestComDebug(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	data, pos := cConn.startEphemeralPacketWithHeader(1)
+	writeByte(data, pos, ComDebug)
+	require.NoError(t, cConn.writeEphemeralPacket())
+	require.True(t, sConn.handleNextCommand(&testHandler{}))
+
+	data, err := cConn.ReadPacket()
+	require.NoError(t, err)
+	assert.True(t, data[0] == OKPacket, "expected OK packet, got %v", data)
+}
+
 func TestComSetOption(t *testing.T) {
 	listener, sConn, cConn := createSocketPair(t)
 	defer func() {
@@ -758,6 +896,40 @@ func checkQueryInternal(t *testing.T, query string, sConn, cConn *Conn, result *
 	}
 }
 
+func TestQueryStatusFlags(t *testing.T) {
+	listener, sConn, cConn := createSocketPair(t)
+	defer func() {
+		listener.Close()
+		sConn.Close()
+		cConn.Close()
+	}()
+
+	result := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id", "int64"), "1", "2")
+	sConn.StatusFlags = ServerStatusAutocommit | ServerQueryWasSlow | ServerStatusNoIndexUsed
+
+	for _, capabilities := range []uint32{0, CapabilityClientDeprecateEOF} {
+		sConn.Capabilities = capabilities
+		cConn.Capabilities = capabilities
+
+		// With a result set, the flags come from the final EOF / OK packet.
+		require.NoError(t, writeResult(sConn, result))
+		got, more, _, err := cConn.ReadQueryResult(10, true)
+		require.NoError(t, err)
+		assert.False(t, more)
+		assert.Equal(t, 2, len(got.Rows))
+		assert.True(t, got.IsQueryWasSlow(), "capabilities %v", capabilities)
+		assert.True(t, got.IsNoIndexUsed(), "capabilities %v", capabilities)
+		assert.False(t, got.IsNoGoodIndexUsed(), "capabilities %v", capabilities)
+
+		// Without a result set, they come from the OK packet.
+		require.NoError(t, writeResult(sConn, &sqltypes.Result{RowsAffected: 1}))
+		got, _, _, err = cConn.ReadQueryResult(10, true)
+		require.NoError(t, err)
+		assert.True(t, got.IsQueryWasSlow(), "capabilities %v", capabilities)
+		assert.True(t, got.IsNoIndexUsed(), "capabilities %v", capabilities)
+	}
+}
+
 //nolint
 func writeResult(conn *Conn, result *sqltypes.Result) error {
 	if len(result.Fields) == 0 {
@@ -785,3 +957,118 @@ func RowString(row []sqltypes.Value) string {
 	}
 	return result
 }
+
+func TestWriteBinaryValue(t *testing.T) {
+	tcases := []struct {
+		val  sqltypes.Value
+		want []byte
+	}{{
+		val:  sqltypes.MakeTrusted(querypb.Type_INT8, []byte("-2")),
+		want: []byte{0xfe},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_UINT8, []byte("200")),
+		want: []byte{0xc8},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_INT16, []byte("-2")),
+		want: []byte{0xfe, 0xff},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_YEAR, []byte("2021")),
+		want: []byte{0xe5, 0x07},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_UINT32, []byte("16909060")),
+		want: []byte{0x04, 0x03, 0x02, 0x01},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_INT64, []byte("-1")),
+		want: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte("1.5")),
+		want: []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_FLOAT32, []byte("1.5")),
+		want: []byte{0, 0, 0xc0, 0x3f},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_DATE, []byte("2021-02-03")),
+		want: []byte{0x04, 0xe5, 0x07, 0x02, 0x03},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2021-02-03 04:05:06")),
+		want: []byte{0x07, 0xe5, 0x07, 0x02, 0x03, 0x04, 0x05, 0x06},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2021-02-03 04:05:06.123")),
+		want: []byte{0x0b, 0xe5, 0x07, 0x02, 0x03, 0x04, 0x05, 0x06, 0x78, 0xe0, 0x01, 0x00},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_TIMESTAMP, []byte("")),
+		want: []byte{0x00},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_TIME, []byte("00:00:00")),
+		want: []byte{0x00},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_TIME, []byte("-26:05:06")),
+		want: []byte{0x08, 0x01, 0x01, 0x00, 0x00, 0x00, 0x02, 0x05, 0x06},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_TIME, []byte("26:05:06.5")),
+		want: []byte{0x0c, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x05, 0x06, 0x20, 0xa1, 0x07, 0x00},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("abc")),
+		want: []byte{0x03, 'a', 'b', 'c'},
+	}, {
+		val:  sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("1.25")),
+		want: []byte{0x04, '1', '.', '2', '5'},
+	}}
+
+	for _, tcase := range tcases {
+		t.Run(tcase.val.String(), func(t *testing.T) {
+			got, err := val2MySQL(tcase.val)
+			require.NoError(t, err)
+			assert.Equal(t, tcase.want, got)
+
+			length, err := val2MySQLLen(tcase.val)
+			require.NoError(t, err)
+			assert.Equal(t, len(tcase.want), length)
+		})
+	}
+
+	for _, val := range []sqltypes.Value{
+		sqltypes.MakeTrusted(querypb.Type_INT8, []byte("300")),
+		sqltypes.MakeTrusted(querypb.Type_TIME, []byte("")),
+		sqltypes.MakeTrusted(querypb.Type_TIME, []byte("01:02")),
+		sqltypes.MakeTrusted(querypb.Type_TIME, []byte("01:02:03.4.5")),
+	} {
+		_, err := val2MySQL(val)
+		assert.Error(t, err, val.String())
+	}
+}
+
+func TestWriteBinaryRowData(t *testing.T) {
+	fields := []*querypb.Field{
+		{Name: "id", Type: querypb.Type_INT64},
+		{Name: "name", Type: querypb.Type_VARCHAR},
+		{Name: "created", Type: querypb.Type_DATETIME},
+	}
+	row := []sqltypes.Value{
+		sqltypes.NewInt64(1),
+		sqltypes.NULL,
+		sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2021-02-03 04:05:06")),
+	}
+
+	length, err := binaryRowLen(fields, row)
+	require.NoError(t, err)
+	require.Equal(t, 1+1+8+8, length)
+
+	data := make([]byte, packetHeaderSize+length)
+	pos, err := writeBinaryRowData(data, packetHeaderSize, fields, row)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), pos)
+	assert.Equal(t, []byte{
+		0x00,                   // header
+		0x01 << 3,              // NULL bitmap, with an offset of 2 bits
+		1, 0, 0, 0, 0, 0, 0, 0, // id
+		0x07, 0xe5, 0x07, 0x02, 0x03, 0x04, 0x05, 0x06, // created
+	}, data[packetHeaderSize:])
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := writeBinaryRowData(data, packetHeaderSize, fields, row); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Zero(t, allocs)
+}
@@ -210,6 +210,9 @@ const (
 	// Transaction_payload_event when binlog compression is turned on
 	eCompressedEvent = 40
 
+	// MySQL 8.3 Gtid_tagged_log_event, for transactions with a tagged GTID.
+	eGTIDTaggedEvent = 42
+
 	// MariaDB specific values. They start at 160.
 	//eMariaAnnotateRowsEvent = 160
 	// Unused
@@ -64,6 +64,12 @@ type ReplicationStatus struct {
 	UsingGTID             bool
 	HasReplicationFilters bool
 	SSLAllowed            bool
+	// GroupReplication is the status of the group, for the MysqlGR
+	// flavor. It is not part of the proto.
+	GroupReplication *GroupReplicationStatus
+	// HeartbeatLag is the lag computed from the heartbeat table, set by
+	// ShowReplicationStatusWithHeartbeatLag. It is not part of the proto.
+	HeartbeatLag *HeartbeatLag
 }
 
 // Running returns true if both the IO and SQL threads are running.
@@ -63,24 +63,24 @@ func TestFindErrantGTIDs(t *testing.T) {
 	sourceSID := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 19}
 
 	set1 := Mysql56GTIDSet{
-		sid1:      []interval{{20, 30}, {35, 39}, {40, 53}, {55, 75}},
-		sid2:      []interval{{1, 7}, {20, 50}, {60, 70}},
-		sid4:      []interval{{1, 30}},
-		sourceSID: []interval{{1, 7}, {20, 30}},
+		sid1:      newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 39}, {start: 40, end: 53}, {start: 55, end: 75}}),
+		sid2:      newIntervalTree([]interval{{start: 1, end: 7}, {start: 20, end: 50}, {start: 60, end: 70}}),
+		sid4:      newIntervalTree([]interval{{start: 1, end: 30}}),
+		sourceSID: newIntervalTree([]interval{{start: 1, end: 7}, {start: 20, end: 30}}),
 	}
 
 	set2 := Mysql56GTIDSet{
-		sid1:      []interval{{20, 30}, {35, 37}, {50, 60}},
-		sid2:      []interval{{3, 5}, {22, 25}, {32, 37}, {67, 70}},
-		sid3:      []interval{{1, 45}},
-		sourceSID: []interval{{2, 6}, {15, 40}},
+		sid1:      newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 37}, {start: 50, end: 60}}),
+		sid2:      newIntervalTree([]interval{{start: 3, end: 5}, {start: 22, end: 25}, {start: 32, end: 37}, {start: 67, end: 70}}),
+		sid3:      newIntervalTree([]interval{{start: 1, end: 45}}),
+		sourceSID: newIntervalTree([]interval{{start: 2, end: 6}, {start: 15, end: 40}}),
 	}
 
 	set3 := Mysql56GTIDSet{
-		sid1:      []interval{{20, 30}, {35, 38}, {50, 70}},
-		sid2:      []interval{{3, 5}, {22, 25}, {32, 37}, {67, 70}},
-		sid3:      []interval{{1, 45}},
-		sourceSID: []interval{{2, 6}, {15, 45}},
+		sid1:      newIntervalTree([]interval{{start: 20, end: 30}, {start: 35, end: 38}, {start: 50, end: 70}}),
+		sid2:      newIntervalTree([]interval{{start: 3, end: 5}, {start: 22, end: 25}, {start: 32, end: 37}, {start: 67, end: 70}}),
+		sid3:      newIntervalTree([]interval{{start: 1, end: 45}}),
+		sourceSID: newIntervalTree([]interval{{start: 2, end: 6}, {start: 15, end: 45}}),
 	}
 
 	testcases := []struct {
@@ -94,9 +94,9 @@ func TestFindErrantGTIDs(t *testing.T) {
 			{SourceUUID: sourceSID, RelayLogPosition: Position{GTIDSet: set3}},
 		},
 		want: Mysql56GTIDSet{
-			sid1: []interval{{39, 39}, {40, 49}, {71, 75}},
-			sid2: []interval{{1, 2}, {6, 7}, {20, 21}, {26, 31}, {38, 50}, {60, 66}},
-			sid4: []interval{{1, 30}},
+			sid1: newIntervalTree([]interval{{start: 39, end: 39}, {start: 40, end: 49}, {start: 71, end: 75}}),
+			sid2: newIntervalTree([]interval{{start: 1, end: 2}, {start: 6, end: 7}, {start: 20, end: 21}, {start: 26, end: 31}, {start: 38, end: 50}, {start: 60, end: 66}}),
+			sid4: newIntervalTree([]interval{{start: 1, end: 30}}),
 		},
 	}, {
 		mainRepStatus:    &ReplicationStatus{SourceUUID: sourceSID, RelayLogPosition: Position{GTIDSet: set1}},
@@ -0,0 +1,250 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secretmanager implements a mysql.AuthServer that loads the
+// credentials of the users from a cloud secret manager: AWS Secrets
+// Manager or GCP Secret Manager.
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+)
+
+var (
+	secretManagerProvider        string
+	secretManagerSecret          string
+	secretManagerAWSRegion       string
+	secretManagerRefreshInterval time.Duration
+	secretManagerTimeout         time.Duration
+)
+
+func init() {
+	servenv.OnParseFor("vtgate", func(fs *pflag.FlagSet) {
+		fs.StringVar(&secretManagerProvider, "mysql_auth_secret_manager_provider", "", "Secret manager to load the users/passwords from. Options: aws, gcp.")
+		fs.StringVar(&secretManagerSecret, "mysql_auth_secret_manager_secret", "", "Secret holding the users/passwords, in the format of --mysql_auth_server_static_string. For aws, the name or ARN of the secret. For gcp, the resource name of the secret version, e.g.: projects/my-project/secrets/vtgatecreds/versions/latest")
+		fs.StringVar(&secretManagerAWSRegion, "mysql_auth_secret_manager_aws_region", "", "AWS region of the secret; by default, the region configured in the environment")
+		fs.DurationVar(&secretManagerRefreshInterval, "mysql_auth_secret_manager_refresh_interval", 5*time.Minute, "How often to reload the users/passwords from the secret manager")
+		fs.DurationVar(&secretManagerTimeout, "mysql_auth_secret_manager_timeout", 10*time.Second, "Timeout for secret manager API operations")
+	})
+}
+
+var refreshes = stats.NewCountersWithSingleLabel("MysqlAuthSecretManagerRefreshes", "Reloads of the users/passwords from the secret manager, by result", "result")
+
+// Results of a refresh, as reported in the MysqlAuthSecretManagerRefreshes
+// counter.
+const (
+	refreshUnchanged = "Unchanged"
+	refreshChanged   = "Changed"
+	refreshError     = "Error"
+)
+
+// SecretFetcher fetches the value of the secret holding the
+// credentials.
+type SecretFetcher interface {
+	// FetchSecret returns the current value of the secret.
+	FetchSecret(ctx context.Context) ([]byte, error)
+
+	// Close releases the resources of the fetcher.
+	Close() error
+}
+
+// AuthServerSecretManager implements AuthServer with a config loaded
+// from a secret manager. The secret uses the same JSON format as
+// --mysql_auth_server_static_string.
+type AuthServerSecretManager struct {
+	methods         []mysql.AuthMethod
+	fetcher         SecretFetcher
+	refreshInterval time.Duration
+	timeout         time.Duration
+
+	mu sync.Mutex
+	// static validates the credentials of the current secret.
+	static *mysql.AuthServerStatic
+	// secret is the current value of the secret.
+	secret    []byte
+	listeners []func()
+
+	done chan struct{}
+}
+
+// InitAuthServerSecretManager is the entrypoint for the initialization
+// of the secret manager AuthServer implementation.
+func InitAuthServerSecretManager() {
+	if secretManagerProvider == "" {
+		log.Infof("Not configuring AuthServerSecretManager, as --mysql_auth_secret_manager_provider is empty.")
+		return
+	}
+	if secretManagerSecret == "" {
+		log.Exitf("If using the secret manager auth server, --mysql_auth_secret_manager_secret is required.")
+	}
+
+	fetcher, err := newSecretFetcher(secretManagerProvider, secretManagerSecret, secretManagerAWSRegion)
+	if err != nil {
+		log.Exitf("%s", err)
+	}
+	authServer, err := NewAuthServerSecretManager(fetcher, secretManagerRefreshInterval, secretManagerTimeout)
+	if err != nil {
+		log.Exitf("%s", err)
+	}
+	mysql.RegisterAuthServer("secretmanager", authServer)
+}
+
+func newSecretFetcher(provider, secret, awsRegion string) (SecretFetcher, error) {
+	switch provider {
+	case "aws":
+		return NewAWSSecretFetcher(secret, awsRegion)
+	case "gcp":
+		return NewGCPSecretFetcher(secret)
+	default:
+		return nil, fmt.Errorf("unknown --mysql_auth_secret_manager_provider %q, options are: aws, gcp", provider)
+	}
+}
+
+// NewAuthServerSecretManager returns an AuthServerSecretManager that
+// loads the credentials with fetcher, and reloads them every
+// refreshInterval. It fails if the credentials can't be loaded
+// initially. Afterwards, a failed reload keeps the previous
+// credentials.
+func NewAuthServerSecretManager(fetcher SecretFetcher, refreshInterval, timeout time.Duration) (*AuthServerSecretManager, error) {
+	a := &AuthServerSecretManager{
+		fetcher:         fetcher,
+		refreshInterval: refreshInterval,
+		timeout:         timeout,
+		done:            make(chan struct{}),
+	}
+	a.methods = []mysql.AuthMethod{mysql.NewMysqlNativeAuthMethod(a, a)}
+
+	if _, err := a.refresh(); err != nil {
+		return nil, err
+	}
+	if refreshInterval > 0 {
+		go a.refreshLoop()
+	}
+	return a, nil
+}
+
+// AuthMethods returns the list of registered auth methods
+// implemented by this auth server.
+func (a *AuthServerSecretManager) AuthMethods() []mysql.AuthMethod {
+	return a.methods
+}
+
+// DefaultAuthMethodDescription returns MysqlNativePassword as the default
+// authentication method for the auth server implementation.
+func (a *AuthServerSecretManager) DefaultAuthMethodDescription() mysql.AuthMethodDescription {
+	return mysql.MysqlNativePassword
+}
+
+// HandleUser is part of the Validator interface. We
+// handle any user here since we don't check up front.
+func (a *AuthServerSecretManager) HandleUser(user string) bool {
+	return true
+}
+
+// UserEntryWithHash is called when mysql_native_password is used.
+func (a *AuthServerSecretManager) UserEntryWithHash(conn *mysql.Conn, salt []byte, user string, authResponse []byte, remoteAddr net.Addr) (mysql.Getter, error) {
+	a.mu.Lock()
+	static := a.static
+	a.mu.Unlock()
+	return static.UserEntryWithHash(conn, salt, user, authResponse, remoteAddr)
+}
+
+// OnChange registers a function called after the credentials changed
+// in the secret manager, and were reloaded.
+func (a *AuthServerSecretManager) OnChange(f func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.listeners = append(a.listeners, f)
+}
+
+// Close stops the periodic reloads, and closes the fetcher.
+func (a *AuthServerSecretManager) Close() error {
+	close(a.done)
+	return a.fetcher.Close()
+}
+
+func (a *AuthServerSecretManager) refreshLoop() {
+	ticker := time.NewTicker(a.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			if _, err := a.refresh(); err != nil {
+				log.Errorf("Failed to reload the credentials from the secret manager, keeping the previous ones: %v", err)
+			}
+		}
+	}
+}
+
+// refresh fetches the secret, and switches to its credentials if it
+// changed. It returns whether they changed.
+func (a *AuthServerSecretManager) refresh() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	secret, err := a.fetcher.FetchSecret(ctx)
+	if err != nil {
+		refreshes.Add(refreshError, 1)
+		return false, fmt.Errorf("error fetching vtgate credentials from the secret manager: %v", err)
+	}
+
+	a.mu.Lock()
+	unchanged := a.static != nil && bytes.Equal(secret, a.secret)
+	a.mu.Unlock()
+	if unchanged {
+		refreshes.Add(refreshUnchanged, 1)
+		return false, nil
+	}
+
+	// Validate the config before using it, as AuthServerStatic just
+	// logs parsing errors.
+	entries := make(map[string][]*mysql.AuthServerStaticEntry)
+	if err := mysql.ParseConfig(secret, &entries); err != nil {
+		refreshes.Add(refreshError, 1)
+		return false, fmt.Errorf("error parsing vtgate credentials from the secret manager: %v", err)
+	}
+	if len(entries) == 0 {
+		refreshes.Add(refreshError, 1)
+		return false, fmt.Errorf("vtgate credentials from the secret manager are empty")
+	}
+	static := mysql.NewAuthServerStatic("", string(secret), 0)
+
+	a.mu.Lock()
+	a.static = static
+	a.secret = secret
+	listeners := a.listeners
+	a.mu.Unlock()
+
+	refreshes.Add(refreshChanged, 1)
+	log.Infof("Loaded the credentials of %d users from the secret manager", len(entries))
+	for _, f := range listeners {
+		f()
+	}
+	return true, nil
+}
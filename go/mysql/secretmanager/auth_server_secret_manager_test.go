@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql"
+)
+
+type fakeSecretFetcher struct {
+	mu     sync.Mutex
+	secret string
+	err    error
+}
+
+func (f *fakeSecretFetcher) set(secret string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secret = secret
+	f.err = err
+}
+
+func (f *fakeSecretFetcher) FetchSecret(ctx context.Context) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(f.secret), nil
+}
+
+func (f *fakeSecretFetcher) Close() error {
+	return nil
+}
+
+func authenticate(a *AuthServerSecretManager, user, password string) error {
+	salt := []byte("01234567890123456789")
+	_, err := a.UserEntryWithHash(nil, salt, user, mysql.ScrambleMysqlNativePassword(salt, []byte(password)), &net.IPAddr{IP: net.ParseIP("127.0.0.1")})
+	return err
+}
+
+func TestAuthServerSecretManager(t *testing.T) {
+	fetcher := &fakeSecretFetcher{}
+
+	fetcher.set("", errors.New("unavailable"))
+	_, err := NewAuthServerSecretManager(fetcher, 0, time.Second)
+	require.ErrorContains(t, err, "unavailable")
+
+	fetcher.set(`{"user": [{"Password": "password1"}]}`, nil)
+	a, err := NewAuthServerSecretManager(fetcher, 0, time.Second)
+	require.NoError(t, err)
+	defer a.Close()
+	require.NoError(t, authenticate(a, "user", "password1"))
+	require.Error(t, authenticate(a, "user", "password2"))
+
+	changes := 0
+	a.OnChange(func() { changes++ })
+
+	changed, err := a.refresh()
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 0, changes)
+
+	fetcher.set(`{"user": [{"Password": "password2"}]}`, nil)
+	changed, err = a.refresh()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 1, changes)
+	require.Error(t, authenticate(a, "user", "password1"))
+	require.NoError(t, authenticate(a, "user", "password2"))
+
+	// Invalid or unavailable credentials don't replace the previous ones.
+	for _, secret := range []string{`{"user": "password3"}`, `{}`} {
+		fetcher.set(secret, nil)
+		_, err = a.refresh()
+		require.Error(t, err)
+	}
+	fetcher.set("", errors.New("unavailable"))
+	_, err = a.refresh()
+	require.Error(t, err)
+	assert.Equal(t, 1, changes)
+	require.NoError(t, authenticate(a, "user", "password2"))
+}
+
+func TestAuthServerSecretManagerRefreshLoop(t *testing.T) {
+	fetcher := &fakeSecretFetcher{secret: `{"user": [{"Password": "password1"}]}`}
+	a, err := NewAuthServerSecretManager(fetcher, 10*time.Millisecond, time.Second)
+	require.NoError(t, err)
+	defer a.Close()
+
+	changed := make(chan struct{}, 1)
+	a.OnChange(func() { changed <- struct{}{} })
+	fetcher.set(`{"user": [{"Password": "password2"}]}`, nil)
+	select {
+	case <-changed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("credentials were not reloaded")
+	}
+	require.NoError(t, authenticate(a, "user", "password2"))
+}
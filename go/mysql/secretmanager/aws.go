@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretmanager
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// AWSSecretFetcher fetches a secret from AWS Secrets Manager.
+type AWSSecretFetcher struct {
+	client   *secretsmanager.SecretsManager
+	secretID string
+}
+
+// NewAWSSecretFetcher returns an AWSSecretFetcher for the current
+// version of the secret with the given name or ARN. The credentials are
+// found as usual with the AWS SDK. If region is empty, the one of the
+// environment is used.
+func NewAWSSecretFetcher(secretID, region string) (*AWSSecretFetcher, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	config := aws.NewConfig()
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	return &AWSSecretFetcher{
+		client:   secretsmanager.New(sess, config),
+		secretID: secretID,
+	}, nil
+}
+
+// FetchSecret is part of the SecretFetcher interface.
+func (f *AWSSecretFetcher) FetchSecret(ctx context.Context) ([]byte, error) {
+	output, err := f.client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(f.secretID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if output.SecretString != nil {
+		return []byte(*output.SecretString), nil
+	}
+	return output.SecretBinary, nil
+}
+
+// Close is part of the SecretFetcher interface.
+func (f *AWSSecretFetcher) Close() error {
+	return nil
+}
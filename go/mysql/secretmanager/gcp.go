@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretmanager
+
+import (
+	"context"
+
+	gcpsecretmanager "cloud.google.com/go/secretmanager/apiv1"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// GCPSecretFetcher fetches a secret version from GCP Secret Manager.
+type GCPSecretFetcher struct {
+	client *gcpsecretmanager.Client
+	name   string
+}
+
+// NewGCPSecretFetcher returns a GCPSecretFetcher for the secret
+// version with the given resource name, e.g.
+// "projects/my-project/secrets/vtgatecreds/versions/latest". The
+// credentials are found as usual with the Google Cloud client
+// libraries.
+func NewGCPSecretFetcher(name string) (*GCPSecretFetcher, error) {
+	client, err := gcpsecretmanager.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &GCPSecretFetcher{
+		client: client,
+		name:   name,
+	}, nil
+}
+
+// FetchSecret is part of the SecretFetcher interface.
+func (f *GCPSecretFetcher) FetchSecret(ctx context.Context) ([]byte, error) {
+	response, err := f.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: f.name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.GetPayload().GetData(), nil
+}
+
+// Close is part of the SecretFetcher interface.
+func (f *GCPSecretFetcher) Close() error {
+	return f.client.Close()
+}
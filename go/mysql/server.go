@@ -22,6 +22,7 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -127,6 +128,24 @@ type Handler interface {
 	WarningCount(c *Conn) uint16
 
 	ComResetConnection(c *Conn)
+
+	// ComFieldList is called when a connection receives a COM_FIELD_LIST
+	// request. It returns the fields of the table matching the
+	// wildcard, which uses the LIKE syntax and is empty to match all
+	// the columns.
+	ComFieldList(c *Conn, table, wildcard string) ([]*querypb.Field, error)
+
+	// ComStatistics is called when a connection receives a
+	// COM_STATISTICS request. The returned statistics are appended to
+	// the uptime and thread count the Listener always reports.
+	ComStatistics(c *Conn) []Statistic
+}
+
+// Statistic is a name / value pair reported in the response to
+// COM_STATISTICS, e.g. {"Questions", "1234"}.
+type Statistic struct {
+	Name  string
+	Value string
 }
 
 // UnimplementedHandler implemnts all of the optional callbacks so as to satisy
@@ -140,6 +159,15 @@ func (UnimplementedHandler) ConnectionReady(*Conn)    {}
 func (UnimplementedHandler) ConnectionClosed(*Conn)   {}
 func (UnimplementedHandler) ComResetConnection(*Conn) {}
 
+// ComFieldList returns an unknown command error, which is what clients
+// got before COM_FIELD_LIST was routed to the Handler.
+func (UnimplementedHandler) ComFieldList(*Conn, string, string) ([]*querypb.Field, error) {
+	return nil, NewSQLError(ERUnknownComError, SSNetError, "command handling not implemented yet: %v", ComFieldList)
+}
+
+// ComStatistics doesn't report any statistic on top of the default ones.
+func (UnimplementedHandler) ComStatistics(*Conn) []Statistic { return nil }
+
 // Listener is the MySQL server protocol listener.
 type Listener struct {
 	// Construction parameters, set by NewListener.
@@ -175,11 +203,38 @@ type Listener struct {
 	// beyond which a warning is logged to identify the slow connection
 	SlowConnectWarnThreshold sync2.AtomicDuration
 
+	// ConnMemoryLimit if non-zero is the maximum number of bytes a
+	// connection can buffer, for the results it is sending and the
+	// large packets it is receiving. A query that would exceed it is
+	// killed with an EROutOfMemory error.
+	ConnMemoryLimit sync2.AtomicInt64
+
+	// GlobalMemoryLimit if non-zero is the maximum number of bytes
+	// all the server connections of the process can buffer together.
+	// It is enforced like ConnMemoryLimit.
+	GlobalMemoryLimit sync2.AtomicInt64
+
+	// FlushTimeout if non-zero is the maximum time the server waits for
+	// a client to read the results sent to it. If a client stops
+	// reading for longer, the query is cancelled and the connection is
+	// closed with an ERNetWriteInterrupted error. It is read when a
+	// connection is accepted.
+	FlushTimeout sync2.AtomicDuration
+
+	// CompressionCodecs are the codecs the server advertises, in order
+	// of preference. A client that supports one of them gets a
+	// compressed connection.
+	CompressionCodecs []CompressionCodec
+
 	// The following parameters are changed by the Accept routine.
 
 	// Incrementing ID for connection id.
 	connectionID uint32
 
+	// startTime is when the listener was created. It is used to
+	// report the uptime to COM_STATISTICS.
+	startTime time.Time
+
 	// Read timeout on a given connection
 	connReadTimeout time.Duration
 	// Write timeout on a given connection
@@ -191,6 +246,18 @@ type Listener struct {
 	// shutdown indicates that Shutdown method was called.
 	shutdown sync2.AtomicBool
 
+	// draining indicates that Drain method was called.
+	draining sync2.AtomicBool
+
+	// conns are the connections that finished their handshake, for
+	// Drain.
+	connsMu sync.Mutex
+	conns   map[*Conn]struct{}
+
+	// handshake caches the *handshakeTemplate used to build the
+	// Initial Handshake Packet of new connections.
+	handshake atomic.Value
+
 	// RequireSecureTransport configures the server to reject connections from insecure clients
 	RequireSecureTransport bool
 
@@ -262,6 +329,7 @@ func NewListenerWithConfig(cfg ListenerConfig) (*Listener, error) {
 		listener:           l,
 		ServerVersion:      servenv.AppVersion.MySQLVersion(),
 		connectionID:       1,
+		startTime:          time.Now(),
 		connReadTimeout:    cfg.ConnReadTimeout,
 		connWriteTimeout:   cfg.ConnWriteTimeout,
 		connReadBufferSize: cfg.ConnReadBufferSize,
@@ -310,11 +378,17 @@ func (l *Listener) Accept() {
 // handle is called in a go routine for each client connection.
 // FIXME(alainjobart) handle per-connection logs in a way that makes sense.
 func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Time) {
+	var flushDeadlineConn *flushDeadlineConn
+	if timeout := l.FlushTimeout.Get(); timeout != 0 {
+		flushDeadlineConn = newFlushDeadlineConn(conn, timeout)
+		conn = flushDeadlineConn
+	}
 	if l.connReadTimeout != 0 || l.connWriteTimeout != 0 {
 		conn = netutil.NewConnWithTimeouts(conn, l.connReadTimeout, l.connWriteTimeout)
 	}
 	c := newServerConn(conn, l)
 	c.ConnectionID = connectionID
+	c.flushDeadlineConn = flushDeadlineConn
 
 	// Catch panics, and close the connection in any case.
 	defer func() {
@@ -325,6 +399,10 @@ func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Ti
 		// startWriterBuffering is called
 		c.endWriterBuffering()
 
+		// Release what a query that didn't complete may still
+		// have reserved.
+		c.releaseMemory(c.memoryUsage)
+
 		conn.Close()
 	}()
 
@@ -478,6 +556,7 @@ func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Ti
 		log.Errorf("Cannot write OK packet to %s: %v", c, err)
 		return
 	}
+	c.enableCompression()
 
 	// Record how long we took to establish the connection
 	timings.Record(connectTimingKey, acceptTime)
@@ -493,9 +572,14 @@ func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Ti
 	// process commands.
 	l.handler.ConnectionReady(c)
 
+	l.addConn(c)
+	defer l.removeConn(c)
+	if !c.endCommand() {
+		return
+	}
 	for {
 		kontinue := c.handleNextCommand(l.handler)
-		if !kontinue {
+		if !kontinue || !c.endCommand() {
 			return
 		}
 	}
@@ -518,9 +602,33 @@ func (l *Listener) isShutdown() bool {
 	return l.shutdown.Get()
 }
 
-// writeHandshakeV10 writes the Initial Handshake Packet, server side.
-// It returns the salt data.
-func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, enableTLS bool) ([]byte, error) {
+// handshakeTemplate is a pre-built Initial Handshake Packet payload.
+// Only the connection ID, the salt and the status flags change from
+// one connection to the next, so they are patched in at fixed offsets
+// and everything else is built once per Listener. The template is
+// rebuilt when any of the parameters it was built from changes.
+type handshakeTemplate struct {
+	serverVersion string
+	authMethod    AuthMethodDescription
+	enableTLS     bool
+	charset       uint8
+	compression   uint32
+
+	data            []byte
+	connectionIDPos int
+	saltPos1        int
+	saltPos2        int
+	statusFlagsPos  int
+}
+
+func (t *handshakeTemplate) matches(serverVersion string, authMethod AuthMethodDescription, enableTLS bool, charset uint8, compression uint32) bool {
+	return t.serverVersion == serverVersion && t.authMethod == authMethod && t.enableTLS == enableTLS && t.charset == charset && t.compression == compression
+}
+
+// newHandshakeTemplate builds the Initial Handshake Packet payload for the
+// given parameters, without the packet header.
+// The compression capabilities are the flags of the codecs advertised.
+func newHandshakeTemplate(serverVersion string, authMethod AuthMethodDescription, enableTLS bool, charset uint8, compression uint32) *handshakeTemplate {
 	capabilities := CapabilityClientLongPassword |
 		CapabilityClientFoundRows |
 		CapabilityClientLongFlag |
@@ -533,23 +641,12 @@ func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, en
 		CapabilityClientPluginAuth |
 		CapabilityClientPluginAuthLenencClientData |
 		CapabilityClientDeprecateEOF |
-		CapabilityClientConnAttr
+		CapabilityClientConnAttr |
+		compression
 	if enableTLS {
 		capabilities |= CapabilityClientSSL
 	}
 
-	// Grab the default auth method. This can only be either
-	// mysql_native_password or caching_sha2_password. Both
-	// need the salt as well to be present too.
-	//
-	// Any other auth method will cause clients to throw a
-	// handshake error.
-	authMethod := authServer.DefaultAuthMethodDescription()
-
-	if authMethod != MysqlNativePassword && authMethod != CachingSha2Password {
-		authMethod = MysqlNativePassword
-	}
-
 	length :=
 		1 + // protocol version
 			lenNullString(serverVersion) +
@@ -565,7 +662,16 @@ func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, en
 			13 + // auth-plugin-data
 			lenNullString(string(authMethod)) // auth-plugin-name
 
-	data, pos := c.startEphemeralPacketWithHeader(length)
+	t := &handshakeTemplate{
+		serverVersion: serverVersion,
+		authMethod:    authMethod,
+		enableTLS:     enableTLS,
+		charset:       charset,
+		compression:   compression,
+		data:          make([]byte, length),
+	}
+	data := t.data
+	pos := 0
 
 	// Protocol version.
 	pos = writeByte(data, pos, protocolVersion)
@@ -573,20 +679,13 @@ func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, en
 	// Copy server version.
 	pos = writeNullString(data, pos, serverVersion)
 
-	// Add connectionID in.
-	pos = writeUint32(data, pos, c.ConnectionID)
+	// Connection ID, filled in per connection.
+	t.connectionIDPos = pos
+	pos += 4
 
-	// Generate the salt as the plugin data. Will be reused
-	// later on if no auth method switch happens and the real
-	// auth method is also mysql_native_password or caching_sha2_password.
-	pluginData, err := newSalt()
-	if err != nil {
-		return nil, err
-	}
-	// Plugin data is always defined as having a trailing NULL
-	pluginData = append(pluginData, 0)
-
-	pos += copy(data[pos:], pluginData[:8])
+	// First part of the salt, filled in per connection.
+	t.saltPos1 = pos
+	pos += 8
 
 	// One filler byte, always 0.
 	pos = writeByte(data, pos, 0)
@@ -595,10 +694,11 @@ func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, en
 	pos = writeUint16(data, pos, uint16(capabilities))
 
 	// Character set.
-	pos = writeByte(data, pos, collations.Local().DefaultConnectionCharset())
+	pos = writeByte(data, pos, charset)
 
-	// Status flag.
-	pos = writeUint16(data, pos, c.StatusFlags)
+	// Status flag, filled in per connection.
+	t.statusFlagsPos = pos
+	pos += 2
 
 	// Upper part of the capability flags.
 	pos = writeUint16(data, pos, uint16(capabilities>>16))
@@ -610,17 +710,67 @@ func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, en
 	// Reserved 10 bytes: all 0
 	pos = writeZeroes(data, pos, 10)
 
-	// Second part of auth plugin data.
-	pos += copy(data[pos:], pluginData[8:])
+	// Second part of the salt and its trailing NULL, filled in
+	// per connection.
+	t.saltPos2 = pos
+	pos += 13
 
 	// Copy authPluginName. We always start with the first
 	// registered auth method name.
-	pos = writeNullString(data, pos, string(authMethod))
+	writeNullString(data, pos, string(authMethod))
 
-	// Sanity check.
-	if pos != len(data) {
-		return nil, vterrors.Errorf(vtrpc.Code_INTERNAL, "error building Handshake packet: got %v bytes expected %v", pos, len(data))
+	return t
+}
+
+// getHandshakeTemplate returns the cached handshake template for the
+// given parameters, building and caching a new one if they changed.
+// It is safe to call on a nil Listener, in which case nothing is cached.
+func (l *Listener) getHandshakeTemplate(serverVersion string, authMethod AuthMethodDescription, enableTLS bool, charset uint8) *handshakeTemplate {
+	if l == nil {
+		return newHandshakeTemplate(serverVersion, authMethod, enableTLS, charset, 0)
+	}
+	compression := compressionCapabilities(l.CompressionCodecs)
+	if t, ok := l.handshake.Load().(*handshakeTemplate); ok && t.matches(serverVersion, authMethod, enableTLS, charset, compression) {
+		return t
 	}
+	t := newHandshakeTemplate(serverVersion, authMethod, enableTLS, charset, compression)
+	l.handshake.Store(t)
+	return t
+}
+
+// writeHandshakeV10 writes the Initial Handshake Packet, server side.
+// It returns the salt data.
+func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, enableTLS bool) ([]byte, error) {
+	// Grab the default auth method. This can only be either
+	// mysql_native_password or caching_sha2_password. Both
+	// need the salt as well to be present too.
+	//
+	// Any other auth method will cause clients to throw a
+	// handshake error.
+	authMethod := authServer.DefaultAuthMethodDescription()
+
+	if authMethod != MysqlNativePassword && authMethod != CachingSha2Password {
+		authMethod = MysqlNativePassword
+	}
+
+	t := c.listener.getHandshakeTemplate(serverVersion, authMethod, enableTLS, collations.Local().DefaultConnectionCharset())
+
+	// Generate the salt as the plugin data. Will be reused
+	// later on if no auth method switch happens and the real
+	// auth method is also mysql_native_password or caching_sha2_password.
+	// Plugin data is always defined as having a trailing NULL, which
+	// is the last byte of the buffer and always 0.
+	pluginData := c.handshakeSalt[:]
+	if err := fillSalt(pluginData[:len(pluginData)-1]); err != nil {
+		return nil, err
+	}
+
+	data, pos := c.startEphemeralPacketWithHeader(len(t.data))
+	copy(data[pos:], t.data)
+	writeUint32(data, pos+t.connectionIDPos, c.ConnectionID)
+	copy(data[pos+t.saltPos1:], pluginData[:8])
+	writeUint16(data, pos+t.statusFlagsPos, c.StatusFlags)
+	copy(data[pos+t.saltPos2:], pluginData[8:])
 
 	if err := c.writeEphemeralPacket(); err != nil {
 		if strings.HasSuffix(err.Error(), "write: connection reset by peer") {
@@ -689,6 +839,9 @@ func (l *Listener) parseClientHandshakePacket(c *Conn, firstTime bool, data []by
 		return "", "", nil, nil
 	}
 
+	// Compression is enabled once the handshake is done.
+	c.compression = negotiateCompression(l.CompressionCodecs, clientFlags)
+
 	// username
 	username, pos, ok := readNullString(data, pos)
 	if !ok {
@@ -0,0 +1,183 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/log"
+)
+
+var (
+	connDrained      = stats.NewCounter("MysqlServerConnDrained", "Connections closed when idle by a drain of the MySQL server")
+	connDrainTimeout = stats.NewCounter("MysqlServerConnDrainTimeout", "Connections still busy when a drain of the MySQL server timed out")
+)
+
+// drainPollInterval is how often Drain checks if all the connections
+// are closed.
+var drainPollInterval = 10 * time.Millisecond
+
+// Drain gracefully shuts the listener down, e.g. for a rolling restart.
+// It stops accepting connections, like Shutdown, then closes each
+// connection as soon as it is idle: not running a command, nor in a
+// transaction. The connections are sent an ERServerShutdown error
+// before being closed, like MySQL does, so the clients know they have
+// to reconnect elsewhere.
+//
+// Drain returns once all the connections are closed. The connections
+// still busy when ctx is done are closed anyway, which aborts their
+// queries and transactions, and their number is returned.
+func (l *Listener) Drain(ctx context.Context) int {
+	l.draining.Set(true)
+	l.Shutdown()
+	for _, c := range l.connections() {
+		c.drainIfIdle()
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		conns := l.connections()
+		if len(conns) == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			log.Warningf("Closing %d busy connections after draining the MySQL server: %v", len(conns), ctx.Err())
+			for _, c := range conns {
+				c.Close()
+			}
+			connDrainTimeout.Add(int64(len(conns)))
+			return len(conns)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Listener) isDraining() bool {
+	return l.draining.Get()
+}
+
+// addConn tracks a connection that finished its handshake.
+func (l *Listener) addConn(c *Conn) {
+	l.connsMu.Lock()
+	defer l.connsMu.Unlock()
+	if l.conns == nil {
+		l.conns = make(map[*Conn]struct{})
+	}
+	l.conns[c] = struct{}{}
+}
+
+func (l *Listener) removeConn(c *Conn) {
+	l.connsMu.Lock()
+	defer l.connsMu.Unlock()
+	delete(l.conns, c)
+}
+
+// connections returns the tracked connections.
+func (l *Listener) connections() []*Conn {
+	l.connsMu.Lock()
+	defer l.connsMu.Unlock()
+	conns := make([]*Conn, 0, len(l.conns))
+	for c := range l.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// startCommand marks the connection busy, before it runs a command.
+// It returns false if the connection was drained in the meantime, and
+// the command must not run.
+func (c *Conn) startCommand() bool {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+	if c.drained {
+		return false
+	}
+	c.busy = true
+	return true
+}
+
+// endCommand marks the connection idle, after it ran a command. If the
+// listener is draining, the connection is drained, and endCommand
+// returns false.
+func (c *Conn) endCommand() bool {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+	c.busy = false
+	if c.listener != nil && c.listener.isDraining() && !c.inTransaction() {
+		c.drainLocked()
+		return false
+	}
+	return true
+}
+
+// drainIfIdle drains the connection if it is idle. A busy connection is
+// drained when its command ends.
+func (c *Conn) drainIfIdle() {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+	if c.busy || c.drained || c.inTransaction() {
+		return
+	}
+	c.drainLocked()
+}
+
+// drainLocked sends the ERServerShutdown error to the client, and closes
+// the connection. The goroutine serving the connection may be waiting
+// for the next command, so the packet is written directly, without
+// using the buffers and the sequence numbers of the connection.
+func (c *Conn) drainLocked() {
+	c.drained = true
+	if err := c.writeShutdownError(); err != nil {
+		log.Warningf("Cannot write shutdown error to %s: %v", c, err)
+	}
+	connDrained.Add(1)
+	c.Close()
+}
+
+// writeShutdownError writes an unsolicited ERServerShutdown error packet,
+// like MySQL sends to its idle connections when it shuts down.
+func (c *Conn) writeShutdownError() error {
+	const message = "Server shutdown in progress"
+	code := uint16(ERServerShutdown)
+	packet := make([]byte, packetHeaderSize, packetHeaderSize+1+2+1+len(SSNetError)+len(message))
+	packet = append(packet, ErrPacket, byte(code), byte(code>>8), '#')
+	packet = append(packet, SSNetError...)
+	packet = append(packet, message...)
+	length := len(packet) - packetHeaderSize
+	packet[0], packet[1], packet[2], packet[3] = byte(length), byte(length>>8), byte(length>>16), 0
+
+	conn := c.conn
+	if cc, ok := conn.(*compressedConn); ok {
+		// A frame of its own, not compressed.
+		frame := make([]byte, compressedHeaderSize, compressedHeaderSize+len(packet))
+		frame[0], frame[1], frame[2] = byte(len(packet)), byte(len(packet)>>8), byte(len(packet)>>16)
+		packet = append(frame, packet...)
+		conn = cc.Conn
+	}
+	_, err := conn.Write(packet)
+	return err
+}
+
+// inTransaction returns true if the handler reported an open
+// transaction in the status flags of the connection.
+func (c *Conn) inTransaction() bool {
+	return c.StatusFlags&ServerStatusInTrans != 0
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttls"
+)
+
+// drainHandler runs transactions, and queries that block until they
+// are released.
+type drainHandler struct {
+	testHandler
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *drainHandler) ComQuery(c *Conn, query string, callback func(*sqltypes.Result) error) error {
+	switch query {
+	case "begin":
+		c.StatusFlags |= ServerStatusInTrans
+	case "commit":
+		c.StatusFlags &= NoServerStatusInTrans
+	case "block":
+		h.started <- struct{}{}
+		<-h.release
+	default:
+		return h.testHandler.ComQuery(c, query, callback)
+	}
+	return callback(&sqltypes.Result{})
+}
+
+func newDrainListener(t *testing.T) (*Listener, *drainHandler, *ConnParams) {
+	h := &drainHandler{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{{Password: "password1"}}
+	t.Cleanup(authServer.close)
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, h, 0, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(l.Close)
+	go l.Accept()
+
+	params := &ConnParams{
+		Host:    l.Addr().(*net.TCPAddr).IP.String(),
+		Port:    l.Addr().(*net.TCPAddr).Port,
+		Uname:   "user1",
+		Pass:    "password1",
+		SslMode: vttls.Disabled,
+	}
+	return l, h, params
+}
+
+// assertShutdownError reads the error the server sent to an idle
+// connection it drained.
+func assertShutdownError(t *testing.T, c *Conn) {
+	t.Helper()
+	c.sequence = 0
+	data, err := c.readPacket()
+	require.NoError(t, err)
+	assertSQLError(t, ParseErrorPacket(data), ERServerShutdown, SSNetError, "Server shutdown in progress", "", "")
+}
+
+func TestListenerDrain(t *testing.T) {
+	l, h, params := newDrainListener(t)
+	ctx := context.Background()
+
+	idle, err := Connect(ctx, params)
+	require.NoError(t, err)
+	defer idle.Close()
+	inTransaction, err := Connect(ctx, params)
+	require.NoError(t, err)
+	defer inTransaction.Close()
+	_, err = inTransaction.ExecuteFetch("begin", 1, false)
+	require.NoError(t, err)
+	busy, err := Connect(ctx, params)
+	require.NoError(t, err)
+	defer busy.Close()
+	busyErr := make(chan error, 1)
+	go func() {
+		_, err := busy.ExecuteFetch("block", 1, false)
+		busyErr <- err
+	}()
+	<-h.started
+
+	drained := make(chan int, 1)
+	go func() {
+		drained <- l.Drain(ctx)
+	}()
+
+	// The idle connection is drained right away.
+	assertShutdownError(t, idle)
+
+	// New connections are refused.
+	_, err = Connect(ctx, params)
+	require.Error(t, err)
+
+	// The transaction and the query can finish, then their
+	// connections are drained.
+	_, err = inTransaction.ExecuteFetch("commit", 1, false)
+	require.NoError(t, err)
+	assertShutdownError(t, inTransaction)
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while a query was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	h.release <- struct{}{}
+	require.NoError(t, <-busyErr)
+	assertShutdownError(t, busy)
+
+	assert.Equal(t, 0, <-drained)
+}
+
+func TestListenerDrainTimeout(t *testing.T) {
+	l, _, params := newDrainListener(t)
+
+	conn, err := Connect(context.Background(), params)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.ExecuteFetch("begin", 1, false)
+	require.NoError(t, err)
+
+	// The transaction never ends, so its connection is closed when
+	// the drain times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 1, l.Drain(ctx))
+	_, err = conn.ExecuteFetch("commit", 1, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+)
+
+// srvScheme is the prefix of a ConnParams.Host that is the name of DNS
+// SRV records to resolve, e.g. "srv://_mysql._tcp.db.example.com".
+const srvScheme = "srv://"
+
+// srvLookuper is the part of net.Resolver used to resolve SRV records.
+type srvLookuper interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// srvCache caches the SRV records resolved for srv:// hosts.
+//
+// The Go resolver doesn't expose the TTL of the records, so they are
+// kept for ttl. If a refresh fails, the expired records are used until
+// the next successful lookup, so a DNS outage doesn't prevent new
+// connections to servers that are still up.
+type srvCache struct {
+	resolver srvLookuper
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*srvCacheEntry
+}
+
+type srvCacheEntry struct {
+	records []*net.SRV
+	expires time.Time
+}
+
+// srvRecords is the cache used by Connect.
+var srvRecords = &srvCache{
+	resolver: net.DefaultResolver,
+	ttl:      30 * time.Second,
+	entries:  make(map[string]*srvCacheEntry),
+}
+
+// lookup returns the SRV records for name, from the cache if they are
+// fresh enough.
+func (sc *srvCache) lookup(ctx context.Context, name string) ([]*net.SRV, error) {
+	sc.mu.Lock()
+	entry := sc.entries[name]
+	sc.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return entry.records, nil
+	}
+
+	_, records, err := sc.resolver.LookupSRV(ctx, "", "", name)
+	if err == nil && len(records) == 0 {
+		err = NewSQLError(CRUnknownHost, SSUnknownSQLState, "no SRV records for %v", name)
+	}
+	if err != nil {
+		if entry != nil {
+			log.Warningf("Failed to refresh SRV records for %v, using the previous ones: %v", name, err)
+			return entry.records, nil
+		}
+		if _, ok := err.(*SQLError); ok {
+			return nil, err
+		}
+		return nil, NewSQLError(CRUnknownHost, SSUnknownSQLState, "SRV lookup of %v failed: %v", name, err)
+	}
+
+	sc.mu.Lock()
+	sc.entries[name] = &srvCacheEntry{
+		records: records,
+		expires: time.Now().Add(sc.ttl),
+	}
+	sc.mu.Unlock()
+	return records, nil
+}
+
+// orderSRV returns the order in which records should be tried, as
+// described in RFC 2782: by increasing priority, and in a weighted
+// random order among records of the same priority.
+func orderSRV(records []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	result := make([]*net.SRV, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		result = append(result, weightedShuffle(sorted[start:end])...)
+		start = end
+	}
+	return result
+}
+
+// weightedShuffle orders records so each one is picked next with a
+// probability proportional to its weight. Records with a zero weight
+// come last, unless all of them have a zero weight.
+func weightedShuffle(records []*net.SRV) []*net.SRV {
+	remaining := make([]*net.SRV, len(records))
+	copy(remaining, records)
+	result := make([]*net.SRV, 0, len(records))
+	for len(remaining) > 0 {
+		total := 0
+		for _, record := range remaining {
+			total += int(record.Weight)
+		}
+		index := 0
+		if total == 0 {
+			index = rand.Intn(len(remaining))
+		} else {
+			n := rand.Intn(total)
+			for i, record := range remaining {
+				n -= int(record.Weight)
+				if n < 0 {
+					index = i
+					break
+				}
+			}
+		}
+		result = append(result, remaining[index])
+		remaining = append(remaining[:index], remaining[index+1:]...)
+	}
+	return result
+}
+
+// connectSRV resolves the srv:// host of params, and connects to the
+// targets of the records in turn, in the order given by orderSRV.
+func connectSRV(ctx context.Context, params *ConnParams) (*Conn, error) {
+	records, err := srvRecords.lookup(ctx, strings.TrimPrefix(params.Host, srvScheme))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]string, 0, len(records))
+	for _, record := range orderSRV(records) {
+		host := strings.TrimSuffix(record.Target, ".")
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+
+	resolved := *params
+	resolved.Host = ""
+	resolved.Port = 0
+	resolved.Endpoints = strings.Join(endpoints, ",")
+	resolved.EndpointPolicy = EndpointPolicyOrdered
+	return connectEndpoints(ctx, &resolved)
+}
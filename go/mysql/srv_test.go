@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSRVLookuper struct {
+	mu      sync.Mutex
+	records map[string][]*net.SRV
+	err     error
+	lookups int
+}
+
+func (f *fakeSRVLookuper) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lookups++
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	return name, f.records[name], nil
+}
+
+func TestConnectSRV(t *testing.T) {
+	th := &testHandler{}
+	authServer := NewAuthServerStatic("", "", 0)
+	authServer.entries["user1"] = []*AuthServerStaticEntry{{
+		Password: "password1",
+	}}
+	defer authServer.close()
+
+	l, err := NewListener("tcp", "127.0.0.1:", authServer, th, 0, 0, false)
+	require.NoError(t, err)
+	defer l.Close()
+	go l.Accept()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+
+	// This one refuses connections.
+	closed, err := net.Listen("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	refusedPort := uint16(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	resolver := &fakeSRVLookuper{
+		records: map[string][]*net.SRV{
+			"_mysql._tcp.db.example.com": {
+				{Target: "127.0.0.1.", Port: port, Priority: 20, Weight: 1},
+				{Target: "127.0.0.1.", Port: refusedPort, Priority: 10, Weight: 1},
+			},
+		},
+	}
+	saved := srvRecords
+	defer func() { srvRecords = saved }()
+	srvRecords = &srvCache{
+		resolver: resolver,
+		ttl:      time.Hour,
+		entries:  make(map[string]*srvCacheEntry),
+	}
+
+	params := &ConnParams{
+		Host:  "srv://_mysql._tcp.db.example.com",
+		Uname: "user1",
+		Pass:  "password1",
+	}
+	for i := 0; i < 2; i++ {
+		conn, err := Connect(context.Background(), params)
+		require.NoError(t, err)
+		conn.Close()
+	}
+	assert.Equal(t, 1, resolver.lookups, "records should be cached")
+
+	// Once expired, the records are looked up again, and the previous
+	// ones are used if that fails.
+	srvRecords.entries["_mysql._tcp.db.example.com"].expires = time.Now()
+	resolver.err = errors.New("no DNS")
+	conn, err := Connect(context.Background(), params)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, 2, resolver.lookups)
+
+	params.Host = "srv://_mysql._tcp.unknown.example.com"
+	_, err = Connect(context.Background(), params)
+	assertSQLError(t, err, CRUnknownHost, SSUnknownSQLState, "no DNS", "", "")
+
+	resolver.err = nil
+	_, err = Connect(context.Background(), params)
+	assertSQLError(t, err, CRUnknownHost, SSUnknownSQLState, "no SRV records", "", "")
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 10},
+		{Target: "a1", Priority: 10, Weight: 0},
+		{Target: "a2", Priority: 10, Weight: 30},
+		{Target: "a3", Priority: 10, Weight: 70},
+		{Target: "b", Priority: 15, Weight: 0},
+	}
+
+	firsts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		ordered := orderSRV(records)
+		require.Len(t, ordered, 5)
+		// The weighted ones come first, then the zero weight one.
+		assert.Contains(t, []string{"a2", "a3"}, ordered[0].Target)
+		assert.Contains(t, []string{"a2", "a3"}, ordered[1].Target)
+		assert.Equal(t, "a1", ordered[2].Target)
+		assert.Equal(t, "b", ordered[3].Target)
+		assert.Equal(t, "c", ordered[4].Target)
+		firsts[ordered[0].Target]++
+	}
+	// a3 has more than twice the weight of a2.
+	assert.Greater(t, firsts["a3"], firsts["a2"])
+
+	// With only zero weights, all records are still returned.
+	ordered := orderSRV([]*net.SRV{{Target: "x"}, {Target: "y"}})
+	assert.Len(t, ordered, 2)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"fmt"
+	"time"
+
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/timer"
+	"vitess.io/vitess/go/vt/log"
+)
+
+type (
+	// AutoscaledPool is the part of a pool an Autoscaler needs.
+	// ResourcePool implements it.
+	AutoscaledPool interface {
+		Capacity() int64
+		MaxCap() int64
+		InUse() int64
+		WaitCount() int64
+		WaitTime() time.Duration
+		Waiters() int64
+		SetCapacity(capacity int) error
+	}
+
+	// AutoscalerConfig configures an Autoscaler.
+	AutoscalerConfig struct {
+		// Interval is how often the pool is evaluated.
+		Interval time.Duration
+		// Step is the number of resources the capacity grows or
+		// shrinks by at a time.
+		Step int
+		// MinCapacity is the capacity the pool doesn't shrink below.
+		MinCapacity int
+		// WaitCountThreshold is the number of callers that must have
+		// waited for a resource during an interval, or still be
+		// waiting at its end, for the pool to grow. 0 disables this
+		// threshold.
+		WaitCountThreshold int64
+		// WaitTimeThreshold is the total time the callers must have
+		// waited for a resource during an interval for the pool to
+		// grow. 0 disables this threshold.
+		WaitTimeThreshold time.Duration
+		// ShrinkAfter is the number of consecutive idle intervals
+		// after which the pool shrinks. An interval is idle if no
+		// caller waited, and if the pool would still have Step unused
+		// resources after shrinking, so it doesn't need to grow again
+		// right away.
+		ShrinkAfter int
+	}
+
+	// Autoscaler grows the capacity of a pool, up to its max capacity,
+	// when the callers wait for resources, and shrinks it back when the
+	// resources are not needed anymore.
+	Autoscaler struct {
+		// stats. Atomic fields must remain at the top in order to prevent panics on certain architectures.
+		grown  sync2.AtomicInt64
+		shrunk sync2.AtomicInt64
+
+		pool   AutoscaledPool
+		config AutoscalerConfig
+		timer  *timer.Timer
+
+		// The following fields are only used by scale.
+		lastWaitCount int64
+		lastWaitTime  time.Duration
+		idleIntervals int
+	}
+)
+
+var _ AutoscaledPool = (*ResourcePool[Resource])(nil)
+
+// NewAutoscaler creates an Autoscaler for the pool. Start must be
+// called for it to scale the pool.
+func NewAutoscaler(pool AutoscaledPool, config AutoscalerConfig) (*Autoscaler, error) {
+	switch {
+	case config.Interval <= 0:
+		return nil, fmt.Errorf("invalid autoscaler interval: %v", config.Interval)
+	case config.Step <= 0:
+		return nil, fmt.Errorf("invalid autoscaler step: %d", config.Step)
+	case config.MinCapacity <= 0 || int64(config.MinCapacity) > pool.MaxCap():
+		return nil, fmt.Errorf("autoscaler min capacity %d is out of range", config.MinCapacity)
+	case config.WaitCountThreshold <= 0 && config.WaitTimeThreshold <= 0:
+		return nil, fmt.Errorf("the autoscaler needs a wait count or a wait time threshold")
+	case config.ShrinkAfter <= 0:
+		return nil, fmt.Errorf("invalid autoscaler shrink after: %d", config.ShrinkAfter)
+	}
+	return &Autoscaler{
+		pool:          pool,
+		config:        config,
+		timer:         timer.NewTimer(config.Interval),
+		lastWaitCount: pool.WaitCount(),
+		lastWaitTime:  pool.WaitTime(),
+	}, nil
+}
+
+// Start starts scaling the pool.
+func (as *Autoscaler) Start() {
+	as.timer.Start(as.scale)
+}
+
+// Stop stops scaling the pool. It must be called before the pool is
+// closed.
+func (as *Autoscaler) Stop() {
+	as.timer.Stop()
+}
+
+// scale evaluates the pool, and grows or shrinks its capacity.
+func (as *Autoscaler) scale() {
+	waitCount, waitTime := as.pool.WaitCount(), as.pool.WaitTime()
+	waited, waitedTime := waitCount-as.lastWaitCount, waitTime-as.lastWaitTime
+	as.lastWaitCount, as.lastWaitTime = waitCount, waitTime
+	// The waits are only recorded once they end, so the callers still
+	// waiting are counted too.
+	waited += as.pool.Waiters()
+
+	capacity := as.pool.Capacity()
+	step := int64(as.config.Step)
+	switch {
+	case as.config.WaitCountThreshold > 0 && waited >= as.config.WaitCountThreshold,
+		as.config.WaitTimeThreshold > 0 && waitedTime >= as.config.WaitTimeThreshold:
+		as.idleIntervals = 0
+		newCapacity := capacity + step
+		if maxCap := as.pool.MaxCap(); newCapacity > maxCap {
+			newCapacity = maxCap
+		}
+		if newCapacity > capacity {
+			as.setCapacity(newCapacity, &as.grown)
+		}
+	case waited == 0 && as.pool.InUse()+step <= capacity-step:
+		as.idleIntervals++
+		if as.idleIntervals < as.config.ShrinkAfter {
+			return
+		}
+		as.idleIntervals = 0
+		newCapacity := capacity - step
+		if minCap := int64(as.config.MinCapacity); newCapacity < minCap {
+			newCapacity = minCap
+		}
+		if newCapacity < capacity {
+			as.setCapacity(newCapacity, &as.shrunk)
+		}
+	default:
+		as.idleIntervals = 0
+	}
+}
+
+func (as *Autoscaler) setCapacity(capacity int64, counter *sync2.AtomicInt64) {
+	if err := as.pool.SetCapacity(int(capacity)); err != nil {
+		log.Warningf("Autoscaler failed to set the pool capacity to %d: %v", capacity, err)
+		return
+	}
+	counter.Add(1)
+}
+
+// Grown returns the number of times the autoscaler grew the pool.
+func (as *Autoscaler) Grown() int64 {
+	return as.grown.Get()
+}
+
+// Shrunk returns the number of times the autoscaler shrunk the pool.
+func (as *Autoscaler) Shrunk() int64 {
+	return as.shrunk.Get()
+}
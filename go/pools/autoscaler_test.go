@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAutoscaledPool struct {
+	capacity, maxCap, inUse, waitCount, waiters int64
+	waitTime                                    time.Duration
+}
+
+func (p *fakeAutoscaledPool) Capacity() int64         { return p.capacity }
+func (p *fakeAutoscaledPool) MaxCap() int64           { return p.maxCap }
+func (p *fakeAutoscaledPool) InUse() int64            { return p.inUse }
+func (p *fakeAutoscaledPool) WaitCount() int64        { return p.waitCount }
+func (p *fakeAutoscaledPool) WaitTime() time.Duration { return p.waitTime }
+func (p *fakeAutoscaledPool) Waiters() int64          { return p.waiters }
+func (p *fakeAutoscaledPool) SetCapacity(capacity int) error {
+	p.capacity = int64(capacity)
+	return nil
+}
+
+func TestAutoscaler(t *testing.T) {
+	pool := &fakeAutoscaledPool{capacity: 4, maxCap: 10}
+	as, err := NewAutoscaler(pool, AutoscalerConfig{
+		Interval:           time.Hour,
+		Step:               2,
+		MinCapacity:        2,
+		WaitCountThreshold: 5,
+		WaitTimeThreshold:  time.Second,
+		ShrinkAfter:        3,
+	})
+	require.NoError(t, err)
+
+	// Too few waits.
+	pool.inUse, pool.waitCount = 4, 4
+	as.scale()
+	assert.EqualValues(t, 4, pool.capacity)
+
+	// The wait count threshold is exceeded.
+	pool.waitCount += 5
+	as.scale()
+	assert.EqualValues(t, 6, pool.capacity)
+
+	// The wait time threshold is exceeded.
+	pool.waitCount++
+	pool.waitTime += time.Second
+	as.scale()
+	assert.EqualValues(t, 8, pool.capacity)
+
+	// The pool doesn't grow beyond its max capacity.
+	for i := 0; i < 3; i++ {
+		pool.waitCount += 5
+		as.scale()
+	}
+	assert.EqualValues(t, 10, pool.capacity)
+	assert.EqualValues(t, 3, as.Grown())
+
+	// The pool isn't idle as long as it would need to grow right
+	// after shrinking.
+	pool.inUse = 7
+	for i := 0; i < 5; i++ {
+		as.scale()
+	}
+	assert.EqualValues(t, 10, pool.capacity)
+
+	// It shrinks after enough idle intervals, but not below the min
+	// capacity.
+	pool.inUse = 0
+	as.scale()
+	as.scale()
+	assert.EqualValues(t, 10, pool.capacity)
+	as.scale()
+	assert.EqualValues(t, 8, pool.capacity)
+	for i := 0; i < 12; i++ {
+		as.scale()
+	}
+	assert.EqualValues(t, 2, pool.capacity)
+	assert.EqualValues(t, 4, as.Shrunk())
+
+	// A wait resets the idle intervals.
+	pool.capacity = 6
+	as.scale()
+	as.scale()
+	pool.waitCount++
+	as.scale()
+	as.scale()
+	as.scale()
+	assert.EqualValues(t, 6, pool.capacity)
+	as.scale()
+	assert.EqualValues(t, 4, pool.capacity)
+
+	// So does a caller that is still waiting.
+	as.scale()
+	as.scale()
+	pool.waiters = 1
+	as.scale()
+	pool.waiters = 0
+	as.scale()
+	as.scale()
+	assert.EqualValues(t, 4, pool.capacity)
+	as.scale()
+	assert.EqualValues(t, 2, pool.capacity)
+}
+
+func TestAutoscalerConfig(t *testing.T) {
+	pool := &fakeAutoscaledPool{capacity: 4, maxCap: 10}
+	valid := AutoscalerConfig{Interval: time.Second, Step: 1, MinCapacity: 1, WaitCountThreshold: 1, ShrinkAfter: 1}
+	_, err := NewAutoscaler(pool, valid)
+	require.NoError(t, err)
+
+	config := valid
+	config.Step = 0
+	_, err = NewAutoscaler(pool, config)
+	assert.EqualError(t, err, "invalid autoscaler step: 0")
+	config = valid
+	config.MinCapacity = 11
+	_, err = NewAutoscaler(pool, config)
+	assert.EqualError(t, err, "autoscaler min capacity 11 is out of range")
+	config = valid
+	config.WaitCountThreshold = 0
+	_, err = NewAutoscaler(pool, config)
+	assert.EqualError(t, err, "the autoscaler needs a wait count or a wait time threshold")
+}
+
+func TestAutoscalerResourcePool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 3, 0, 0, 0, nil, nil, 0)
+	defer p.Close()
+	as, err := NewAutoscaler(p, AutoscalerConfig{
+		Interval:           5 * time.Millisecond,
+		Step:               1,
+		MinCapacity:        1,
+		WaitCountThreshold: 1,
+		ShrinkAfter:        1,
+	})
+	require.NoError(t, err)
+	as.Start()
+	defer as.Stop()
+
+	// A caller waits, so the pool grows.
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, p.Capacity())
+	p.Put(r)
+	p.Put(r2)
+
+	// Then it shrinks back.
+	assert.Eventually(t, func() bool { return p.Capacity() == 1 }, time.Second, time.Millisecond)
+}
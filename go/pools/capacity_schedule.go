@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/timer"
+	"vitess.io/vitess/go/vt/log"
+)
+
+// capacityScheduleInterval is how often a capacity schedule is
+// evaluated.
+const capacityScheduleInterval = 10 * time.Second
+
+const day = 24 * time.Hour
+
+type (
+	// CapacityWindow is a daily time window during which a pool has
+	// another capacity, e.g. a background pool that is shrunk during
+	// the peak hours. Start and End are the times of the day, in the
+	// local time zone, as durations since midnight. A window with an
+	// End before its Start spans midnight.
+	CapacityWindow struct {
+		Start    time.Duration
+		End      time.Duration
+		Capacity int
+	}
+
+	// capacityScheduledPool is the part of a pool a capacitySchedule
+	// needs.
+	capacityScheduledPool interface {
+		Capacity() int64
+		MaxCap() int64
+		SetCapacity(capacity int) error
+	}
+
+	// capacitySchedule changes the capacity of a pool by time of day.
+	capacitySchedule struct {
+		pool  capacityScheduledPool
+		now   func() time.Time
+		timer *timer.Timer
+
+		mu         sync.Mutex
+		windows    []CapacityWindow
+		transition time.Duration
+		// base is the capacity of the pool outside of the windows,
+		// which is its capacity when the schedule was set.
+		base int
+		// applied is the last capacity set by the schedule. The
+		// schedule only sets the capacity when it changes, so the
+		// capacity set by SetCapacity meanwhile is kept until then.
+		applied int
+	}
+)
+
+func newCapacitySchedule(pool capacityScheduledPool, now func() time.Time) *capacitySchedule {
+	return &capacitySchedule{
+		pool:  pool,
+		now:   now,
+		timer: timer.NewTimer(capacityScheduleInterval),
+	}
+}
+
+// set replaces the windows of the schedule, and applies them at once.
+// No windows removes the schedule, and restores the capacity the pool
+// had when it was set.
+func (cs *capacitySchedule) set(windows []CapacityWindow, transition time.Duration) error {
+	if transition < 0 {
+		return fmt.Errorf("invalid capacity schedule transition: %v", transition)
+	}
+	maxCap := cs.pool.MaxCap()
+	for _, w := range windows {
+		switch {
+		case w.Start < 0 || w.Start >= day || w.End < 0 || w.End >= day || w.Start == w.End:
+			return fmt.Errorf("invalid capacity window: %v-%v", w.Start, w.End)
+		case w.Capacity <= 0 || int64(w.Capacity) > maxCap:
+			return fmt.Errorf("capacity window capacity %d is out of range", w.Capacity)
+		}
+	}
+
+	cs.timer.Stop()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.windows) == 0 {
+		cs.base = int(cs.pool.Capacity())
+		cs.applied = cs.base
+	}
+	cs.windows = append([]CapacityWindow(nil), windows...)
+	cs.transition = transition
+	if len(cs.windows) == 0 {
+		return cs.pool.SetCapacity(cs.base)
+	}
+	if err := cs.applyLocked(cs.now()); err != nil {
+		return err
+	}
+	cs.timer.Start(cs.apply)
+	return nil
+}
+
+// stop stops the schedule. It must be called before the pool is closed.
+func (cs *capacitySchedule) stop() {
+	cs.timer.Stop()
+}
+
+// apply sets the capacity of the pool for the current time.
+func (cs *capacitySchedule) apply() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.applyLocked(cs.now()); err != nil {
+		log.Warningf("Capacity schedule failed to set the pool capacity: %v", err)
+	}
+}
+
+// applyLocked sets the capacity of the pool for now, if it changed
+// since the last time. cs.mu must be held.
+func (cs *capacitySchedule) applyLocked(now time.Time) error {
+	capacity := cs.capacityAt(now)
+	if capacity == cs.applied {
+		return nil
+	}
+	if err := cs.pool.SetCapacity(capacity); err != nil {
+		return err
+	}
+	cs.applied = capacity
+	return nil
+}
+
+// capacityAt returns the capacity of the pool at now. After each start
+// or end of a window, the capacity changes linearly over the
+// transition, so the resources are not all opened or closed at once.
+// cs.mu must be held.
+func (cs *capacitySchedule) capacityAt(now time.Time) int {
+	hour, minute, sec := now.Clock()
+	at := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec)*time.Second + time.Duration(now.Nanosecond())
+	capacity := cs.levelAt(at)
+	if cs.transition <= 0 {
+		return capacity
+	}
+
+	// Find the last start or end of a window.
+	since := time.Duration(-1)
+	var boundary time.Duration
+	for _, w := range cs.windows {
+		for _, edge := range []time.Duration{w.Start, w.End} {
+			if d := (at - edge + day) % day; since < 0 || d < since {
+				since, boundary = d, edge
+			}
+		}
+	}
+	if since >= cs.transition {
+		return capacity
+	}
+	from := cs.levelAt((boundary - 1 + day) % day)
+	return from + int(int64(capacity-from)*int64(since)/int64(cs.transition))
+}
+
+// levelAt returns the capacity of the first window that contains the
+// time of the day at, or the base capacity. cs.mu must be held.
+func (cs *capacitySchedule) levelAt(at time.Duration) int {
+	for _, w := range cs.windows {
+		if w.Start < w.End && at >= w.Start && at < w.End ||
+			w.Start > w.End && (at >= w.Start || at < w.End) {
+			return w.Capacity
+		}
+	}
+	return cs.base
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapacityScheduleCapacityAt(t *testing.T) {
+	cs := &capacitySchedule{
+		windows: []CapacityWindow{
+			{Start: 9 * time.Hour, End: 17 * time.Hour, Capacity: 2},
+			{Start: 22 * time.Hour, End: 2 * time.Hour, Capacity: 8},
+		},
+		transition: time.Hour,
+		base:       4,
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2022, 6, 1, hour, minute, 0, 0, time.Local)
+	}
+	tcases := []struct {
+		at   time.Time
+		want int
+	}{
+		{at(8, 0), 4},
+		{at(9, 0), 4},
+		{at(9, 30), 3},
+		{at(10, 0), 2},
+		{at(16, 59), 2},
+		{at(17, 30), 3},
+		{at(18, 0), 4},
+		{at(22, 30), 6},
+		{at(0, 0), 8},
+		{at(2, 15), 7},
+		{at(3, 0), 4},
+	}
+	for _, tcase := range tcases {
+		assert.Equal(t, tcase.want, cs.capacityAt(tcase.at), "at %v", tcase.at)
+	}
+
+	cs.transition = 0
+	assert.Equal(t, 2, cs.capacityAt(at(9, 0)))
+	assert.Equal(t, 4, cs.capacityAt(at(17, 0)))
+}
+
+func TestSetCapacitySchedule(t *testing.T) {
+	p := NewResourcePool(PoolFactory, 4, 10, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	err := p.SetCapacitySchedule([]CapacityWindow{{Start: time.Hour, End: time.Hour, Capacity: 2}}, 0)
+	assert.EqualError(t, err, "invalid capacity window: 1h0m0s-1h0m0s")
+	err = p.SetCapacitySchedule([]CapacityWindow{{Start: 0, End: time.Hour, Capacity: 11}}, 0)
+	assert.EqualError(t, err, "capacity window capacity 11 is out of range")
+	assert.EqualValues(t, 4, p.Capacity())
+
+	// The windows cover the whole day.
+	windows := []CapacityWindow{
+		{Start: 0, End: 12 * time.Hour, Capacity: 2},
+		{Start: 12 * time.Hour, End: 0, Capacity: 2},
+	}
+	require.NoError(t, p.SetCapacitySchedule(windows, 0))
+	assert.EqualValues(t, 2, p.Capacity())
+
+	// Removing the schedule restores the capacity.
+	require.NoError(t, p.SetCapacitySchedule(nil, 0))
+	assert.EqualValues(t, 4, p.Capacity())
+
+	sp := NewShardedResourcePool(TypedPoolFactory, 2, 4, 10, 0, 0, 0, logWait, nil, 0)
+	defer sp.Close()
+	require.NoError(t, sp.SetCapacitySchedule(windows, 0))
+	assert.EqualValues(t, 2, sp.Capacity())
+	require.NoError(t, sp.SetCapacitySchedule(nil, 0))
+	assert.EqualValues(t, 4, sp.Capacity())
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Clock tells the time to a pool: when its resources were last used
+	// or checked, how long it has been exhausted, or when a dial failed.
+	// The pools use the real time by default. Tests and simulations can
+	// set a FakeClock with SetClock, to control the idle timeouts
+	// without sleeping. The waits of the callers of Get are still
+	// measured in real time, since they really block.
+	Clock interface {
+		Now() time.Time
+	}
+
+	realClock struct{}
+
+	// clockHolder holds a Clock, since an atomic.Value only stores
+	// values of the same concrete type.
+	clockHolder struct {
+		clock Clock
+	}
+
+	// poolClock is the Clock of a pool, the real time until it's set.
+	poolClock struct {
+		holder atomic.Value
+	}
+
+	// FakeClock is a Clock whose time only changes when it's advanced
+	// or set.
+	FakeClock struct {
+		mu  sync.Mutex
+		now time.Time
+	}
+)
+
+// Now is part of the Clock interface.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// set replaces the clock. A nil clock restores the real time.
+func (pc *poolClock) set(clock Clock) {
+	if clock == nil {
+		clock = realClock{}
+	}
+	pc.holder.Store(clockHolder{clock: clock})
+}
+
+// now returns the current time of the clock.
+func (pc *poolClock) now() time.Time {
+	if holder, ok := pc.holder.Load().(clockHolder); ok {
+		return holder.clock.Now()
+	}
+	return time.Now()
+}
+
+// since returns the time elapsed since t on the clock.
+func (pc *poolClock) since(t time.Time) time.Duration {
+	return pc.now().Sub(t)
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now is part of the Clock interface.
+func (fc *FakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+// Advance moves the time of the clock forward by d.
+func (fc *FakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+// Set sets the time of the clock.
+func (fc *FakeClock) Set(now time.Time) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = now
+}
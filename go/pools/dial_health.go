@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"time"
+)
+
+// dialErrorWindow is the period over which the recent dial errors are
+// counted, in seconds.
+const dialErrorWindow = 60
+
+// dialHealth records the outcome of the creation of the resources of a
+// pool, so a caller can tell a backend that is unreachable from a pool
+// that is exhausted.
+type dialHealth struct {
+	mu          sync.Mutex
+	errors      int64
+	lastErr     error
+	lastErrTime time.Time
+	lastSuccess time.Time
+	// recent counts the errors of each of the last dialErrorWindow
+	// seconds, indexed by the second modulo dialErrorWindow.
+	recent [dialErrorWindow]struct {
+		second int64
+		count  int64
+	}
+}
+
+// record records the outcome of a creation.
+func (dh *dialHealth) record(err error, now time.Time) {
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+	if err == nil {
+		dh.lastSuccess = now
+		return
+	}
+	dh.errors++
+	dh.lastErr, dh.lastErrTime = err, now
+	second := now.Unix()
+	bucket := &dh.recent[second%dialErrorWindow]
+	if bucket.second != second {
+		bucket.second, bucket.count = second, 0
+	}
+	bucket.count++
+}
+
+// recentErrors returns the number of errors of the last
+// dialErrorWindow seconds. dh.mu must be held.
+func (dh *dialHealth) recentErrors(now time.Time) (count int64) {
+	second := now.Unix()
+	for _, bucket := range dh.recent {
+		if second-bucket.second < dialErrorWindow {
+			count += bucket.count
+		}
+	}
+	return count
+}
+
+// fill fills the dial fields of the stats.
+func (dh *dialHealth) fill(stats *Stats, now time.Time) {
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+	stats.DialErrors = dh.errors
+	stats.RecentDialErrors = dh.recentErrors(now)
+	if dh.lastErr != nil {
+		stats.LastDialError = dh.lastErr.Error()
+	}
+	stats.LastDialErrorTime = dh.lastErrTime
+	stats.LastDialSuccessTime = dh.lastSuccess
+}
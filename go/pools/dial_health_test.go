@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialHealth(t *testing.T) {
+	var dh dialHealth
+	start := time.Unix(1000, 0)
+	dh.record(nil, start)
+	dh.record(errors.New("refused"), start.Add(time.Second))
+	dh.record(errors.New("unreachable"), start.Add(30*time.Second))
+
+	var stats Stats
+	dh.fill(&stats, start.Add(45*time.Second))
+	assert.EqualValues(t, 2, stats.DialErrors)
+	assert.EqualValues(t, 2, stats.RecentDialErrors)
+	assert.Equal(t, "unreachable", stats.LastDialError)
+	assert.Equal(t, start.Add(30*time.Second), stats.LastDialErrorTime)
+	assert.Equal(t, start, stats.LastDialSuccessTime)
+
+	// The errors older than a minute are not recent anymore, even if
+	// their bucket is not reused.
+	dh.fill(&stats, start.Add(61*time.Second))
+	assert.EqualValues(t, 1, stats.RecentDialErrors)
+	dh.record(errors.New("refused"), start.Add(61*time.Second))
+	dh.fill(&stats, start.Add(61*time.Second))
+	assert.EqualValues(t, 3, stats.DialErrors)
+	assert.EqualValues(t, 2, stats.RecentDialErrors)
+	dh.fill(&stats, start.Add(2*time.Minute))
+	assert.EqualValues(t, 1, stats.RecentDialErrors)
+}
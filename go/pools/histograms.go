@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+)
+
+// poolHistograms records the distribution of the waits for a resource,
+// and of the time the resources are held per checkout, in nanoseconds.
+type poolHistograms struct {
+	enabled sync2.AtomicBool
+
+	mu    sync.Mutex
+	wait  *stats.Histogram
+	held  *stats.Histogram
+	taken map[any]time.Time
+}
+
+// set sets the histograms. Either of them can be nil.
+func (ph *poolHistograms) set(wait, held *stats.Histogram) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	ph.wait = wait
+	ph.held = held
+	ph.taken = nil
+	if held != nil {
+		ph.taken = make(map[any]time.Time)
+	}
+	ph.enabled.Set(wait != nil || held != nil)
+}
+
+// recordWait records a wait for a resource.
+func (ph *poolHistograms) recordWait(wait time.Duration) {
+	if !ph.enabled.Get() {
+		return
+	}
+	ph.mu.Lock()
+	h := ph.wait
+	ph.mu.Unlock()
+	if h != nil {
+		h.Add(int64(wait))
+	}
+}
+
+// checkout records that the resource was taken from the pool.
+func (ph *poolHistograms) checkout(resource any) {
+	if !ph.enabled.Get() {
+		return
+	}
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if ph.taken != nil {
+		ph.taken[resource] = time.Now()
+	}
+}
+
+// checkin records the time the resource was held, when it's returned to
+// the pool.
+func (ph *poolHistograms) checkin(resource any) {
+	if !ph.enabled.Get() {
+		return
+	}
+	ph.mu.Lock()
+	taken, ok := ph.taken[resource]
+	delete(ph.taken, resource)
+	h := ph.held
+	ph.mu.Unlock()
+	if ok {
+		h.Add(int64(time.Since(taken)))
+	}
+}
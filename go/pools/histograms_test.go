@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/stats"
+)
+
+func TestHistograms(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	cutoffs := []int64{int64(10 * time.Millisecond), int64(time.Second)}
+	wait := stats.NewHistogram("", "", cutoffs)
+	held := stats.NewHistogram("", "", cutoffs)
+	p.SetHistograms(wait, held)
+
+	// A resource held for a short time, without a wait.
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	assert.EqualValues(t, 0, wait.Count())
+	assert.Equal(t, []int64{1, 0, 0}, held.Buckets())
+
+	// A resource held while another caller waits for it.
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r, err := p.Get(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		p.Discard(r)
+	}()
+	require.Eventually(t, func() bool { return p.Waiters() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	p.Put(r)
+	<-done
+	assert.Equal(t, []int64{0, 1, 0}, wait.Buckets())
+	assert.Equal(t, p.WaitTime().Nanoseconds(), wait.Total())
+	assert.Equal(t, []int64{2, 1, 0}, held.Buckets())
+
+	// Nothing is recorded once the histograms are unset.
+	p.SetHistograms(nil, nil)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	assert.EqualValues(t, 3, held.Count())
+}
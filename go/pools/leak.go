@@ -0,0 +1,196 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/timer"
+	"vitess.io/vitess/go/vt/log"
+)
+
+type (
+	// Checkout describes a resource taken from a pool, and not returned
+	// yet.
+	Checkout struct {
+		// Purpose is the purpose set on the context of the Get with
+		// WithPurpose.
+		Purpose string
+		// Time is when the resource was taken.
+		Time time.Time
+		// Stack is the stack of the caller of Get.
+		Stack string
+	}
+
+	checkout struct {
+		purpose  string
+		time     time.Time
+		pcs      []uintptr
+		reported bool
+	}
+
+	// leakTracker tracks the checkouts of a pool, and reports those
+	// that last longer than a threshold.
+	leakTracker struct {
+		// stats. Atomic fields must remain at the top in order to prevent panics on certain architectures.
+		leaked  sync2.AtomicInt64
+		enabled sync2.AtomicBool
+
+		mu        sync.Mutex
+		threshold time.Duration
+		checkouts map[any]*checkout
+		timer     *timer.Timer
+	}
+
+	purposeKey struct{}
+)
+
+// WithPurpose returns a context that sets the purpose of the resources
+// taken with it, as shown by the leak detection.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	return context.WithValue(ctx, purposeKey{}, purpose)
+}
+
+// setThreshold enables the tracking if threshold is not 0, and
+// disables it otherwise.
+func (lt *leakTracker) setThreshold(threshold time.Duration) {
+	// The timer is stopped outside of the lock, since it waits for
+	// report, which takes it.
+	lt.stop()
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.threshold = threshold
+	lt.checkouts = nil
+	lt.timer = nil
+	lt.enabled.Set(threshold > 0)
+	if threshold <= 0 {
+		return
+	}
+	lt.checkouts = make(map[any]*checkout)
+	lt.timer = timer.NewTimer(threshold)
+	lt.timer.Start(lt.report)
+}
+
+// stop stops the reports.
+func (lt *leakTracker) stop() {
+	lt.mu.Lock()
+	timer := lt.timer
+	lt.mu.Unlock()
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// checkout records that the resource was taken from the pool. skip is
+// the number of stack frames to skip to get to the caller of Get.
+func (lt *leakTracker) checkout(ctx context.Context, resource any, skip int) {
+	if !lt.enabled.Get() {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.checkouts == nil {
+		return
+	}
+	purpose, _ := ctx.Value(purposeKey{}).(string)
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(skip+2, pcs)]
+	lt.checkouts[resource] = &checkout{purpose: purpose, time: time.Now(), pcs: pcs}
+}
+
+// checkin records that the resource was returned to the pool.
+func (lt *leakTracker) checkin(resource any) {
+	if !lt.enabled.Get() {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.checkouts != nil {
+		delete(lt.checkouts, resource)
+	}
+}
+
+// renew restarts the checkout of the resource, if it is tracked.
+func (lt *leakTracker) renew(resource any) {
+	if !lt.enabled.Get() {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if co, ok := lt.checkouts[resource]; ok {
+		co.time = time.Now()
+		co.reported = false
+	}
+}
+
+// report logs the checkouts that last longer than the threshold, once
+// each.
+func (lt *leakTracker) report() {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for _, co := range lt.checkouts {
+		if co.reported || time.Since(co.time) < lt.threshold {
+			continue
+		}
+		co.reported = true
+		lt.leaked.Add(1)
+		log.Warningf("Resource pool: a resource taken %v ago for %q was not returned yet, it was taken by:\n%s", time.Since(co.time).Round(time.Second), co.purpose, formatStack(co.pcs))
+	}
+}
+
+// list returns the checkouts, the oldest first.
+func (lt *leakTracker) list() []Checkout {
+	lt.mu.Lock()
+	checkouts := make([]Checkout, 0, len(lt.checkouts))
+	var pcs [][]uintptr
+	for _, co := range lt.checkouts {
+		checkouts = append(checkouts, Checkout{Purpose: co.purpose, Time: co.time})
+		pcs = append(pcs, co.pcs)
+	}
+	lt.mu.Unlock()
+
+	// The stacks are formatted outside of the lock.
+	for i := range checkouts {
+		checkouts[i].Stack = formatStack(pcs[i])
+	}
+	sort.Slice(checkouts, func(i, j int) bool {
+		return checkouts[i].Time.Before(checkouts[j].Time)
+	})
+	return checkouts
+}
+
+func formatStack(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeakDetection(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 3, 3, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	// Nothing is tracked by default.
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, p.Checkouts())
+	p.Put(r)
+
+	p.SetLeakThreshold(20 * time.Millisecond)
+	leaked, err := p.Get(WithPurpose(ctx, "leak"))
+	require.NoError(t, err)
+	returned, err := p.Get(ctx)
+	require.NoError(t, err)
+	discarded, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	checkouts := p.Checkouts()
+	require.Len(t, checkouts, 3)
+	assert.Equal(t, "leak", checkouts[0].Purpose)
+	assert.Contains(t, checkouts[0].Stack, "pools.TestLeakDetection")
+	assert.NotContains(t, checkouts[0].Stack, "pools.(*ResourcePool[...]).Get")
+
+	p.Put(returned)
+	discarded.Close()
+	p.Discard(discarded)
+	checkouts = p.Checkouts()
+	require.Len(t, checkouts, 1)
+	assert.Equal(t, "leak", checkouts[0].Purpose)
+
+	// The resource that is not returned is reported once.
+	assert.Eventually(t, func() bool { return p.Leaked() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 1, p.Leaked())
+	p.Put(leaked)
+	assert.Empty(t, p.Checkouts())
+
+	p.SetLeakThreshold(0)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, p.Checkouts())
+	p.Put(r)
+}
+
+func TestLeakRenew(t *testing.T) {
+	ctx := context.Background()
+	p := NewTypedResourcePool(TypedPoolFactory, 2, 2, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	p.SetLeakThreshold(100 * time.Millisecond)
+
+	renewed, err := p.Get(ctx)
+	require.NoError(t, err)
+	stuck, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// The resource that is renewed is not reported, unlike the one that
+	// is stuck.
+	for i := 0; i < 20; i++ {
+		time.Sleep(10 * time.Millisecond)
+		p.Renew(renewed)
+	}
+	assert.Eventually(t, func() bool { return p.Leaked() == 1 }, time.Second, time.Millisecond)
+	checkouts := p.Checkouts()
+	require.Len(t, checkouts, 2)
+	assert.Less(t, time.Since(checkouts[1].Time), 100*time.Millisecond)
+	assert.EqualValues(t, 1, p.Leaked())
+	p.Put(renewed)
+	p.Put(stuck)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"sync"
+	"time"
+)
+
+// lifetimeTracker remembers when the resources taken from a pool were
+// created, so the pool can tell if they outlived its max lifetime when
+// they are returned. The unused resources carry their creation time in
+// their wrapper instead.
+type lifetimeTracker struct {
+	mu      sync.Mutex
+	created map[any]time.Time
+}
+
+// checkout records the creation time of a resource taken from the pool.
+func (lt *lifetimeTracker) checkout(resource any, created time.Time) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.created == nil {
+		lt.created = make(map[any]time.Time)
+	}
+	lt.created[resource] = created
+}
+
+// checkin returns the creation time of a resource returned to the pool,
+// and forgets it. ok is false if the resource was not tracked.
+func (lt *lifetimeTracker) checkin(resource any) (created time.Time, ok bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	created, ok = lt.created[resource]
+	delete(lt.created, resource)
+	return created, ok
+}
+
+// prune forgets the resources created before the given time. They are
+// expired, which is also what checkin reports for untracked resources,
+// so this only drops the resources that will never be checked in.
+func (lt *lifetimeTracker) prune(before time.Time) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for resource, created := range lt.created {
+		if created.Before(before) {
+			delete(lt.created, resource)
+		}
+	}
+}
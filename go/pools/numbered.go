@@ -17,29 +17,72 @@ limitations under the License.
 package pools
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"vitess.io/vitess/go/cache"
+	"vitess.io/vitess/go/sync2"
 )
 
-// Numbered allows you to manage resources by tracking them with numbers.
-// There are no interface restrictions on what you can track.
-type Numbered struct {
+const (
+	// numberedShards is the number of shards of a Numbered.
+	numberedShards = 32
+	// recentlyUnregisteredSize is the number of unregistered resources
+	// a Numbered remembers, for the errors of Get.
+	recentlyUnregisteredSize = 1000
+)
+
+// Numbered allows you to manage resources of type T by tracking them with
+// numbers. There are no interface restrictions on what you can track.
+// The resources are split in shards by number, each with its own lock,
+// so that the operations on different resources don't contend, and the
+// operations that go through all of them, like ForEach, only hold up
+// the other ones for a shard at a time.
+type Numbered[T any] struct {
+	// stats. Atomic fields must remain at the top in order to prevent panics on certain architectures.
+	size sync2.AtomicInt64
+
+	shards [numberedShards]numberedShard[T]
+
+	// mu protects onExpire, and is the lock of empty.
+	mu       sync.Mutex
+	empty    *sync.Cond // Broadcast when pool becomes empty
+	onExpire ExpireFunc[T]
+
+	// clock is the Clock set by SetClock.
+	clock poolClock
+}
+
+type numberedShard[T any] struct {
 	mu                   sync.Mutex
-	empty                *sync.Cond // Broadcast when pool becomes empty
-	resources            map[int64]*numberedWrapper
+	resources            map[int64]*numberedWrapper[T]
 	recentlyUnregistered *cache.LRUCache
 }
 
-type numberedWrapper struct {
-	val            any
+// ExpireFunc is called for every resource harvested by GetOutdated or
+// GetIdle, with the purpose they were given as reason, and the time
+// the resource has been unused.
+type ExpireFunc[T any] func(val T, reason string, age time.Duration)
+
+// UntypedNumbered is a Numbered of untyped resources.
+//
+// Deprecated: use Numbered[T] with the type of the resources instead.
+type UntypedNumbered = Numbered[any]
+
+type numberedWrapper[T any] struct {
+	val            T
 	inUse          bool
 	purpose        string
 	timeCreated    time.Time
 	timeUsed       time.Time
 	enforceTimeout bool
+	// timeout overrides the age of GetOutdated if it's not 0.
+	timeout time.Duration
 }
 
 type unregistered struct {
@@ -47,61 +90,94 @@ type unregistered struct {
 	timeUnregistered time.Time
 }
 
-//NewNumbered creates a new numbered
-func NewNumbered() *Numbered {
-	n := &Numbered{
-		resources: make(map[int64]*numberedWrapper),
-		recentlyUnregistered: cache.NewLRUCache(1000, func(_ any) int64 {
+// NewNumbered creates a new Numbered of untyped resources.
+//
+// Deprecated: use NewTypedNumbered instead.
+func NewNumbered() *UntypedNumbered {
+	return NewTypedNumbered[any]()
+}
+
+// NewTypedNumbered creates a new Numbered of resources of type T.
+func NewTypedNumbered[T any]() *Numbered[T] {
+	n := &Numbered[T]{}
+	for i := range n.shards {
+		n.shards[i].resources = make(map[int64]*numberedWrapper[T])
+		n.shards[i].recentlyUnregistered = cache.NewLRUCache(recentlyUnregisteredSize/numberedShards, func(_ any) int64 {
 			return 1
-		}),
+		})
 	}
 	n.empty = sync.NewCond(&n.mu)
 	return n
 }
 
+// shard returns the shard of the resource of the id.
+func (nu *Numbered[T]) shard(id int64) *numberedShard[T] {
+	return &nu.shards[uint64(id)%numberedShards]
+}
+
 // Register starts tracking a resource by the supplied id.
 // It does not lock the object.
 // It returns an error if the id already exists.
-func (nu *Numbered) Register(id int64, val any, enforceTimeout bool) error {
+func (nu *Numbered[T]) Register(id int64, val T, enforceTimeout bool) error {
+	return nu.register(id, val, enforceTimeout, 0)
+}
+
+// RegisterWithTimeout is like Register for a resource that has its own
+// timeout: GetOutdated returns it once it is unused for longer than
+// timeout, rather than for longer than the age GetOutdated is given.
+func (nu *Numbered[T]) RegisterWithTimeout(id int64, val T, timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("invalid timeout: %v", timeout)
+	}
+	return nu.register(id, val, true, timeout)
+}
+
+func (nu *Numbered[T]) register(id int64, val T, enforceTimeout bool, timeout time.Duration) error {
 	// Optimistically assume we're not double registering.
-	now := time.Now()
-	resource := &numberedWrapper{
+	now := nu.clock.now()
+	resource := &numberedWrapper[T]{
 		val:            val,
 		timeCreated:    now,
 		timeUsed:       now,
 		enforceTimeout: enforceTimeout,
+		timeout:        timeout,
 	}
 
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
+	shard := nu.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
-	_, ok := nu.resources[id]
+	_, ok := shard.resources[id]
 	if ok {
 		return fmt.Errorf("already present")
 	}
-	nu.resources[id] = resource
+	shard.resources[id] = resource
+	nu.size.Add(1)
 	return nil
 }
 
 // Unregister forgets the specified resource.  If the resource is not present, it's ignored.
-func (nu *Numbered) Unregister(id int64, reason string) {
+func (nu *Numbered[T]) Unregister(id int64, reason string) {
 	success := nu.unregister(id)
 	if success {
-		nu.recentlyUnregistered.Set(
-			fmt.Sprintf("%v", id), &unregistered{reason: reason, timeUnregistered: time.Now()})
+		nu.shard(id).recentlyUnregistered.Set(
+			strconv.FormatInt(id, 10), &unregistered{reason: reason, timeUnregistered: nu.clock.now()})
 	}
 }
 
 // unregister forgets the resource, if it exists. Returns whether or not the resource existed at
 // time of Unregister.
-func (nu *Numbered) unregister(id int64) bool {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
+func (nu *Numbered[T]) unregister(id int64) bool {
+	shard := nu.shard(id)
+	shard.mu.Lock()
+	_, ok := shard.resources[id]
+	delete(shard.resources, id)
+	shard.mu.Unlock()
 
-	_, ok := nu.resources[id]
-	delete(nu.resources, id)
-	if len(nu.resources) == 0 {
+	if ok && nu.size.Add(-1) == 0 {
+		nu.mu.Lock()
 		nu.empty.Broadcast()
+		nu.mu.Unlock()
 	}
 	return ok
 }
@@ -109,19 +185,20 @@ func (nu *Numbered) unregister(id int64) bool {
 // Get locks the resource for use. It accepts a purpose as a string.
 // If it cannot be found, it returns a "not found" error. If in use,
 // it returns a "in use: purpose" error.
-func (nu *Numbered) Get(id int64, purpose string) (val any, err error) {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	nw, ok := nu.resources[id]
+func (nu *Numbered[T]) Get(id int64, purpose string) (val T, err error) {
+	shard := nu.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	nw, ok := shard.resources[id]
 	if !ok {
-		if val, ok := nu.recentlyUnregistered.Get(fmt.Sprintf("%v", id)); ok {
-			unreg := val.(*unregistered)
-			return nil, fmt.Errorf("ended at %v (%v)", unreg.timeUnregistered.Format("2006-01-02 15:04:05.000 MST"), unreg.reason)
+		if unreg, ok := shard.recentlyUnregistered.Get(strconv.FormatInt(id, 10)); ok {
+			unreg := unreg.(*unregistered)
+			return val, fmt.Errorf("ended at %v (%v)", unreg.timeUnregistered.Format("2006-01-02 15:04:05.000 MST"), unreg.reason)
 		}
-		return nil, fmt.Errorf("not found")
+		return val, fmt.Errorf("not found")
 	}
 	if nw.inUse {
-		return nil, fmt.Errorf("in use: %s", nw.purpose)
+		return val, fmt.Errorf("in use: %s", nw.purpose)
 	}
 	nw.inUse = true
 	nw.purpose = purpose
@@ -129,103 +206,240 @@ func (nu *Numbered) Get(id int64, purpose string) (val any, err error) {
 }
 
 // Put unlocks a resource for someone else to use.
-func (nu *Numbered) Put(id int64, updateTime bool) {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	if nw, ok := nu.resources[id]; ok {
+func (nu *Numbered[T]) Put(id int64, updateTime bool) {
+	shard := nu.shard(id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if nw, ok := shard.resources[id]; ok {
 		nw.inUse = false
 		nw.purpose = ""
 		if updateTime {
-			nw.timeUsed = time.Now()
+			nw.timeUsed = nu.clock.now()
 		}
 	}
 }
 
-// GetAll returns the list of all resources in the pool.
-func (nu *Numbered) GetAll() (vals []any) {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	vals = make([]any, 0, len(nu.resources))
-	for _, nw := range nu.resources {
-		vals = append(vals, nw.val)
-	}
+// GetAll returns the list of all resources in the pool. It's a snapshot
+// taken a shard at a time: the resources registered or unregistered
+// meanwhile may or may not be in it.
+func (nu *Numbered[T]) GetAll() (vals []T) {
+	vals = make([]T, 0, nu.size.Get())
+	nu.ForEach(func(val T) bool {
+		vals = append(vals, val)
+		return true
+	})
 	return vals
 }
 
+// ForEach calls f for all the resources in the pool, whether they are
+// in use or not, until it returns false. The resources of a shard are
+// copied under its lock, and f is called outside of it, so f can use
+// the pool, and doesn't hold up the other operations. Like GetAll, it
+// may or may not see the resources registered or unregistered
+// meanwhile.
+func (nu *Numbered[T]) ForEach(f func(val T) bool) {
+	var vals []T
+	for i := range nu.shards {
+		shard := &nu.shards[i]
+		vals = vals[:0]
+		shard.mu.Lock()
+		for _, nw := range shard.resources {
+			vals = append(vals, nw.val)
+		}
+		shard.mu.Unlock()
+		for _, val := range vals {
+			if !f(val) {
+				return
+			}
+		}
+	}
+}
+
 // GetByFilter returns a list of resources that match the filter.
 // It does not return any resources that are already locked.
-func (nu *Numbered) GetByFilter(purpose string, match func(val any) bool) (vals []any) {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	for _, nw := range nu.resources {
-		if nw.inUse || !nw.enforceTimeout {
-			continue
-		}
-		if match(nw.val) {
-			nw.inUse = true
-			nw.purpose = purpose
-			vals = append(vals, nw.val)
+func (nu *Numbered[T]) GetByFilter(purpose string, match func(val T) bool) (vals []T) {
+	for i := range nu.shards {
+		shard := &nu.shards[i]
+		shard.mu.Lock()
+		for _, nw := range shard.resources {
+			if nw.inUse || !nw.enforceTimeout {
+				continue
+			}
+			if match(nw.val) {
+				nw.inUse = true
+				nw.purpose = purpose
+				vals = append(vals, nw.val)
+			}
 		}
+		shard.mu.Unlock()
 	}
 	return vals
 }
 
 // GetOutdated returns a list of resources that are older than age, and locks them.
+// The resources registered with their own timeout are returned once they
+// are older than it instead.
 // It does not return any resources that are already locked.
-func (nu *Numbered) GetOutdated(age time.Duration, purpose string) (vals []any) {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	now := time.Now()
-	for _, nw := range nu.resources {
-		if nw.inUse || !nw.enforceTimeout {
-			continue
-		}
-		if nw.timeUsed.Add(age).Sub(now) <= 0 {
-			nw.inUse = true
-			nw.purpose = purpose
-			vals = append(vals, nw.val)
+func (nu *Numbered[T]) GetOutdated(age time.Duration, purpose string) (vals []T) {
+	return nu.harvest(purpose, func(nw *numberedWrapper[T], now time.Time) bool {
+		timeout := age
+		if nw.timeout != 0 {
+			timeout = nw.timeout
 		}
-	}
-	return vals
+		return nw.enforceTimeout && nw.timeUsed.Add(timeout).Sub(now) <= 0
+	})
 }
 
 // GetIdle returns a list of resurces that have been idle for longer
 // than timeout, and locks them. It does not return any resources that
 // are already locked.
-func (nu *Numbered) GetIdle(timeout time.Duration, purpose string) (vals []any) {
+func (nu *Numbered[T]) GetIdle(timeout time.Duration, purpose string) (vals []T) {
+	return nu.harvest(purpose, func(nw *numberedWrapper[T], now time.Time) bool {
+		return nw.timeUsed.Add(timeout).Sub(now) <= 0
+	})
+}
+
+// harvest locks the resources that are not in use and that are expired,
+// and calls the onExpire function for them outside of the lock.
+func (nu *Numbered[T]) harvest(purpose string, expired func(nw *numberedWrapper[T], now time.Time) bool) (vals []T) {
+	var ages []time.Duration
 	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	now := time.Now()
-	for _, nw := range nu.resources {
-		if nw.inUse {
-			continue
-		}
-		if nw.timeUsed.Add(timeout).Sub(now) <= 0 {
+	onExpire := nu.onExpire
+	nu.mu.Unlock()
+	now := nu.clock.now()
+	for i := range nu.shards {
+		shard := &nu.shards[i]
+		shard.mu.Lock()
+		for _, nw := range shard.resources {
+			if nw.inUse || !expired(nw, now) {
+				continue
+			}
 			nw.inUse = true
 			nw.purpose = purpose
 			vals = append(vals, nw.val)
+			ages = append(ages, now.Sub(nw.timeUsed))
+		}
+		shard.mu.Unlock()
+	}
+
+	if onExpire != nil {
+		for i, val := range vals {
+			onExpire(val, purpose, ages[i])
 		}
 	}
 	return vals
 }
 
+// SetClock sets the Clock that tells when the resources were registered
+// and last used, e.g. a FakeClock for the tests of GetOutdated and
+// GetIdle. A nil clock restores the real time.
+func (nu *Numbered[T]) SetClock(clock Clock) {
+	nu.clock.set(clock)
+}
+
+// SetOnExpire sets the function called for every resource harvested by
+// GetOutdated or GetIdle. It's called outside of the lock, so it can use
+// the pool, after the resource is locked for the purpose, and before
+// GetOutdated or GetIdle returns.
+func (nu *Numbered[T]) SetOnExpire(onExpire ExpireFunc[T]) {
+	nu.mu.Lock()
+	defer nu.mu.Unlock()
+	nu.onExpire = onExpire
+}
+
 // WaitForEmpty returns as soon as the pool becomes empty
-func (nu *Numbered) WaitForEmpty() {
+func (nu *Numbered[T]) WaitForEmpty() {
 	nu.mu.Lock()
 	defer nu.mu.Unlock()
-	for len(nu.resources) != 0 {
+	for nu.size.Get() != 0 {
 		nu.empty.Wait()
 	}
 }
 
+// WaitForEmptyCtx is like WaitForEmpty, but it gives up when the context
+// is done. It then returns the ids of the resources that are still in the
+// pool, in order, and the error of the context.
+func (nu *Numbered[T]) WaitForEmptyCtx(ctx context.Context) ([]int64, error) {
+	// The waiters are woken up when the context is done.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			nu.mu.Lock()
+			nu.empty.Broadcast()
+			nu.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	nu.mu.Lock()
+	for nu.size.Get() != 0 {
+		if err := ctx.Err(); err != nil {
+			nu.mu.Unlock()
+			return nu.ids(), err
+		}
+		nu.empty.Wait()
+	}
+	nu.mu.Unlock()
+	return nil, nil
+}
+
+// ids returns the ids of the resources in the pool, in order.
+func (nu *Numbered[T]) ids() []int64 {
+	ids := make([]int64, 0, nu.size.Get())
+	for i := range nu.shards {
+		shard := &nu.shards[i]
+		shard.mu.Lock()
+		for id := range shard.resources {
+			ids = append(ids, id)
+		}
+		shard.mu.Unlock()
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// NumberedStats are the stats of the resources of a Numbered.
+type NumberedStats struct {
+	// Size is the number of resources.
+	Size int64
+	// InUse is the number of resources in use, by purpose.
+	InUse map[string]int64
+	// OldestAge is the time since the oldest resource was registered.
+	OldestAge time.Duration
+}
+
+// Stats returns the stats of the resources. Like GetAll, it's a snapshot
+// taken a shard at a time.
+func (nu *Numbered[T]) Stats() NumberedStats {
+	stats := NumberedStats{InUse: make(map[string]int64)}
+	now := nu.clock.now()
+	for i := range nu.shards {
+		shard := &nu.shards[i]
+		shard.mu.Lock()
+		for _, nw := range shard.resources {
+			stats.Size++
+			if nw.inUse {
+				stats.InUse[nw.purpose]++
+			}
+			if age := now.Sub(nw.timeCreated); age > stats.OldestAge {
+				stats.OldestAge = age
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return stats
+}
+
 //StatsJSON returns stats in JSON format
-func (nu *Numbered) StatsJSON() string {
-	return fmt.Sprintf("{\"Size\": %v}", nu.Size())
+func (nu *Numbered[T]) StatsJSON() string {
+	stats := nu.Stats()
+	inUse, _ := json.Marshal(stats.InUse)
+	return fmt.Sprintf("{\"Size\": %v, \"InUse\": %s, \"OldestAge\": %v}", stats.Size, inUse, stats.OldestAge.Seconds())
 }
 
 //Size returns the current size
-func (nu *Numbered) Size() int64 {
-	nu.mu.Lock()
-	defer nu.mu.Unlock()
-	return int64(len(nu.resources))
+func (nu *Numbered[T]) Size() int64 {
+	return nu.size.Get()
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package pools
 
 import (
+	"context"
 	"math/rand"
 	"strings"
 	"testing"
@@ -24,6 +25,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/sync2"
 )
 
 func TestNumberedGeneral(t *testing.T) {
@@ -45,8 +48,9 @@ func TestNumberedGeneral(t *testing.T) {
 	assert.Contains(t, "in use: test", err.Error())
 
 	p.Put(id, true)
-	_, err = p.Get(1, "test2")
+	v, err = p.Get(1, "test2")
 	assert.Contains(t, "not found", err.Error())
+	assert.Nil(t, v)
 	p.Unregister(1, "test") // Should not fail
 	p.Unregister(0, "test")
 	// p is now empty
@@ -106,19 +110,143 @@ func TestNumberedGeneral(t *testing.T) {
 }
 
 func TestNumberedGetByFilter(t *testing.T) {
-	p := NewNumbered()
+	p := NewTypedNumbered[int]()
 	p.Register(1, 1, true)
 	p.Register(2, 2, true)
 	p.Register(3, 3, true)
 	p.Get(1, "locked")
 
-	vals := p.GetByFilter("filtered", func(v any) bool {
-		return v.(int) <= 2
+	vals := p.GetByFilter("filtered", func(v int) bool {
+		return v <= 2
 	})
-	want := []any{2}
+	want := []int{2}
 	assert.Equal(t, want, vals)
 }
 
+func TestNumberedOnExpire(t *testing.T) {
+	p := NewTypedNumbered[int]()
+	var expired []int
+	p.SetOnExpire(func(val int, reason string, age time.Duration) {
+		assert.Equal(t, "expired", reason)
+		assert.GreaterOrEqual(t, age, 20*time.Millisecond)
+		// The pool can be used, and the resource is locked.
+		_, err := p.Get(int64(val), "again")
+		assert.EqualError(t, err, "in use: expired")
+		expired = append(expired, val)
+	})
+	p.Register(1, 1, true)
+	p.Register(2, 2, false)
+	time.Sleep(20 * time.Millisecond)
+	p.Register(3, 3, true)
+
+	vals := p.GetOutdated(20*time.Millisecond, "expired")
+	assert.Equal(t, []int{1}, vals)
+	assert.Equal(t, []int{1}, expired)
+	p.Put(1, true)
+
+	expired = nil
+	vals = p.GetIdle(20*time.Millisecond, "expired")
+	assert.Equal(t, []int{2}, vals)
+	assert.Equal(t, []int{2}, expired)
+
+	// GetByFilter doesn't expire the resources.
+	expired = nil
+	vals = p.GetByFilter("filtered", func(int) bool { return true })
+	assert.ElementsMatch(t, []int{1, 3}, vals)
+	assert.Empty(t, expired)
+}
+
+func TestNumberedRegisterWithTimeout(t *testing.T) {
+	p := NewTypedNumbered[int]()
+	require.NoError(t, p.Register(1, 1, true))
+	require.NoError(t, p.RegisterWithTimeout(2, 2, 10*time.Millisecond))
+	require.NoError(t, p.RegisterWithTimeout(3, 3, time.Hour))
+	assert.EqualError(t, p.RegisterWithTimeout(4, 4, 0), "invalid timeout: 0s")
+	assert.EqualError(t, p.RegisterWithTimeout(1, 1, time.Second), "already present")
+	time.Sleep(20 * time.Millisecond)
+
+	// The resources that have their own timeout don't get the age of
+	// GetOutdated.
+	assert.Equal(t, []int{2}, p.GetOutdated(time.Minute, "outdated"))
+	p.Put(2, false)
+	assert.ElementsMatch(t, []int{1, 2}, p.GetOutdated(10*time.Millisecond, "outdated"))
+}
+
+func TestNumberedWaitForEmptyCtx(t *testing.T) {
+	p := NewTypedNumbered[int]()
+	ids, err := p.WaitForEmptyCtx(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	for id := int64(3); id > 0; id-- {
+		p.Register(id, int(id), true)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ids, err = p.WaitForEmptyCtx(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+
+	go func() {
+		for id := int64(1); id <= 3; id++ {
+			p.Unregister(id, "done")
+		}
+	}()
+	ids, err = p.WaitForEmptyCtx(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestNumberedStats(t *testing.T) {
+	p := NewTypedNumbered[int]()
+	assert.Equal(t, `{"Size": 0, "InUse": {}, "OldestAge": 0}`, p.StatsJSON())
+
+	p.Register(1, 1, true)
+	time.Sleep(10 * time.Millisecond)
+	p.Register(2, 2, true)
+	p.Register(3, 3, true)
+	p.Get(2, "for query")
+	p.Get(3, "for query")
+	p.Get(1, "for query kill")
+	p.Put(3, true)
+
+	stats := p.Stats()
+	assert.EqualValues(t, 3, stats.Size)
+	assert.Equal(t, map[string]int64{"for query": 1, "for query kill": 1}, stats.InUse)
+	assert.GreaterOrEqual(t, stats.OldestAge, 10*time.Millisecond)
+	assert.Contains(t, p.StatsJSON(), `"InUse": {"for query":1,"for query kill":1}`)
+}
+
+func TestNumberedForEach(t *testing.T) {
+	p := NewTypedNumbered[int64]()
+	for id := int64(0); id < 100; id++ {
+		require.NoError(t, p.Register(id, id, true))
+	}
+	_, err := p.Get(5, "locked")
+	require.NoError(t, err)
+
+	// All the resources are seen, even those in use, and the pool can be
+	// used meanwhile.
+	seen := make(map[int64]bool)
+	p.ForEach(func(val int64) bool {
+		seen[val] = true
+		if val%2 == 0 {
+			p.Unregister(val, "even")
+		}
+		return true
+	})
+	assert.Len(t, seen, 100)
+	assert.EqualValues(t, 50, p.Size())
+	assert.Len(t, p.GetAll(), 50)
+
+	calls := 0
+	p.ForEach(func(val int64) bool {
+		calls++
+		return calls < 3
+	})
+	assert.Equal(t, 3, calls)
+}
+
 /*
 go test --test.run=XXX --test.bench=. --test.benchtime=10s
 
@@ -129,7 +257,7 @@ BenchmarkRegisterUnregister-8             667           596           -10.64%
 BenchmarkRegisterUnregisterParallel-8     2430          1752          -27.90%
 */
 func BenchmarkRegisterUnregister(b *testing.B) {
-	p := NewNumbered()
+	p := NewTypedNumbered[string]()
 	id := int64(1)
 	val := "foobarbazdummyval"
 	for i := 0; i < b.N; i++ {
@@ -138,8 +266,34 @@ func BenchmarkRegisterUnregister(b *testing.B) {
 	}
 }
 
+func BenchmarkRegisterWhileIterating(b *testing.B) {
+	p := NewTypedNumbered[string]()
+	val := "foobarbazdummyval"
+	for id := int64(0); id < 50000; id++ {
+		p.Register(-id, val, false)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				p.ForEach(func(string) bool { return true })
+			}
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := int64(i + 1)
+		p.Register(id, val, false)
+		p.Unregister(id, "some reason")
+	}
+}
+
 func BenchmarkRegisterUnregisterParallel(b *testing.B) {
-	p := NewNumbered()
+	p := NewTypedNumbered[string]()
 	val := "foobarbazdummyval"
 	b.SetParallelism(200)
 	b.RunParallel(func(pb *testing.PB) {
@@ -150,3 +304,36 @@ func BenchmarkRegisterUnregisterParallel(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkRegisterGetPutParallel(b *testing.B) {
+	p := NewTypedNumbered[string]()
+	val := "foobarbazdummyval"
+	var lastID sync2.AtomicInt64
+	b.SetParallelism(200)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := lastID.Add(1)
+			p.Register(id, val, true)
+			p.Get(id, "query")
+			p.Put(id, true)
+			p.Unregister(id, "some reason")
+		}
+	})
+}
+
+func TestNumberedFakeClock(t *testing.T) {
+	p := NewTypedNumbered[int64]()
+	clock := NewFakeClock(time.Now())
+	p.SetClock(clock)
+	require.NoError(t, p.Register(0, 0, true))
+	clock.Advance(time.Minute)
+	require.NoError(t, p.Register(1, 1, true))
+	clock.Advance(30 * time.Second)
+
+	assert.Equal(t, []int64{0}, p.GetOutdated(time.Minute, "by outdated"))
+	p.Put(0, true)
+	assert.Empty(t, p.GetIdle(time.Minute, "by idle"))
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, []int64{1}, p.GetIdle(time.Minute, "by idle"))
+	assert.Equal(t, 2*time.Minute, p.Stats().OldestAge)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import "time"
+
+// CloseReason is the reason why a pool closed one of its resources.
+type CloseReason int
+
+const (
+	// CloseReasonIdle is for the resources unused for longer than the
+	// idle timeout.
+	CloseReasonIdle CloseReason = iota
+	// CloseReasonLifetime is for the resources that outlived the max
+	// lifetime.
+	CloseReasonLifetime
+	// CloseReasonEviction is for the resources closed because the pool
+	// shrinks, is drained or is closed.
+	CloseReasonEviction
+	// CloseReasonError is for the resources that failed the health
+	// check, or that could not be changed to the setting of a Get.
+	CloseReasonError
+	// CloseReasonServerError is for the resources put back with
+	// PutServerError.
+	CloseReasonServerError
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CloseReasonIdle:
+		return "idle"
+	case CloseReasonLifetime:
+		return "lifetime"
+	case CloseReasonEviction:
+		return "eviction"
+	case CloseReasonError:
+		return "error"
+	case CloseReasonServerError:
+		return "server error"
+	}
+	return "unknown"
+}
+
+// Observer is notified of the lifecycle of the resources of a pool, so
+// the metrics and the logs of all the pools of a process can be produced
+// the same way. The callbacks are called synchronously, so they must be
+// fast, and must not use the pool. Embed NoopObserver to implement only
+// some of them.
+type Observer interface {
+	// ResourceCreated is called when the pool opened a new resource.
+	ResourceCreated()
+	// ResourceClosed is called when the pool closed one of its
+	// resources. The resources that the callers of Get close themselves
+	// are not reported.
+	ResourceClosed(reason CloseReason)
+	// WaitStarted is called when a caller of Get has to wait for a
+	// resource.
+	WaitStarted()
+	// WaitEnded is called at the end of the wait. acquired is false if
+	// the caller gave up, or if the pool was closed.
+	WaitEnded(wait time.Duration, acquired bool)
+	// CapacityChanged is called when the capacity of the pool changed,
+	// including when it's closed or reopened.
+	CapacityChanged(oldCap, newCap int)
+	// PoolExhausted is called when the last available resource of the
+	// pool is taken, and PoolRecovered when one is available again,
+	// with the duration of the exhaustion, so the alerts can fire on a
+	// sustained saturation.
+	PoolExhausted()
+	PoolRecovered(exhaustion time.Duration)
+}
+
+// NoopObserver is an Observer that does nothing.
+type NoopObserver struct{}
+
+var _ Observer = NoopObserver{}
+
+// ResourceCreated is part of the Observer interface.
+func (NoopObserver) ResourceCreated() {}
+
+// ResourceClosed is part of the Observer interface.
+func (NoopObserver) ResourceClosed(CloseReason) {}
+
+// WaitStarted is part of the Observer interface.
+func (NoopObserver) WaitStarted() {}
+
+// WaitEnded is part of the Observer interface.
+func (NoopObserver) WaitEnded(time.Duration, bool) {}
+
+// CapacityChanged is part of the Observer interface.
+func (NoopObserver) CapacityChanged(int, int) {}
+
+// PoolExhausted is part of the Observer interface.
+func (NoopObserver) PoolExhausted() {}
+
+// PoolRecovered is part of the Observer interface.
+func (NoopObserver) PoolRecovered(time.Duration) {}
+
+// observerHolder is what ResourcePool stores in an atomic.Value, which
+// needs the same concrete type every time.
+type observerHolder struct {
+	observer Observer
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (ro *recordingObserver) record(format string, args ...any) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.events = append(ro.events, fmt.Sprintf(format, args...))
+}
+
+func (ro *recordingObserver) take() []string {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	events := ro.events
+	ro.events = nil
+	return events
+}
+
+func (ro *recordingObserver) ResourceCreated() { ro.record("created") }
+
+func (ro *recordingObserver) ResourceClosed(reason CloseReason) { ro.record("closed %v", reason) }
+
+func (ro *recordingObserver) WaitStarted() { ro.record("wait started") }
+
+func (ro *recordingObserver) WaitEnded(_ time.Duration, acquired bool) {
+	ro.record("wait ended %v", acquired)
+}
+
+func (ro *recordingObserver) CapacityChanged(oldCap, newCap int) {
+	ro.record("capacity %d -> %d", oldCap, newCap)
+}
+
+func (ro *recordingObserver) PoolExhausted() { ro.record("exhausted") }
+
+func (ro *recordingObserver) PoolRecovered(time.Duration) { ro.record("recovered") }
+
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 2, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	ro := &recordingObserver{}
+	p.SetObserver(ro)
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	// The pool of 1 resource is exhausted.
+	assert.Equal(t, []string{"created", "exhausted"}, ro.take())
+
+	// A wait that times out, then one that gets the resource.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(tctx)
+	assert.Equal(t, ErrTimeout, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r, err := p.Get(ctx)
+		if assert.NoError(t, err) {
+			p.Put(r)
+		}
+	}()
+	require.Eventually(t, func() bool { return p.Waiters() == 1 }, time.Second, time.Millisecond)
+	p.Put(r)
+	<-done
+	// The pool is exhausted until the waiter puts the resource back.
+	assert.Equal(t, []string{"wait started", "wait ended false", "wait started", "wait ended true", "recovered"}, ro.take())
+
+	// A resource that fails the health check is replaced.
+	p.SetCheckFunc(func(*TestResource) error { return errors.New("unhealthy") }, 0)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	p.SetCheckFunc(nil, 0)
+	p.Put(r)
+	assert.Equal(t, []string{"closed error", "created", "exhausted", "recovered"}, ro.take())
+
+	require.NoError(t, p.SetCapacity(2))
+	require.NoError(t, p.SetCapacity(1))
+	// Shrinking the pool evicts the resource it takes back.
+	assert.Equal(t, []string{"capacity 1 -> 2", "capacity 2 -> 1", "closed eviction"}, ro.take())
+
+	// The resources closed by the caller are not reported, only their
+	// replacement.
+	p.SetObserver(nil)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	p.SetObserver(ro)
+	r.Close()
+	p.Put(nil)
+	require.NoError(t, p.SetCapacity(0))
+	assert.Equal(t, []string{"created", "recovered", "capacity 1 -> 0", "closed eviction"}, ro.take())
+}
+
+func TestObserverLifetime(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePoolWithOptions(TypedPoolFactory, 1, 1, 0, 0, logWait, nil, 0, ResourcePoolOptions{MaxLifetime: time.Hour})
+	defer p.Close()
+	clock := NewFakeClock(time.Now())
+	p.SetClock(clock)
+	ro := &recordingObserver{}
+	p.SetObserver(ro)
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	clock.Advance(2 * time.Hour)
+	p.Put(r)
+	assert.Equal(t, []string{"created", "exhausted", "closed lifetime", "created", "recovered"}, ro.take())
+}
+
+type exhaustionObserver struct {
+	NoopObserver
+	exhaustions chan time.Duration
+}
+
+func (eo exhaustionObserver) PoolRecovered(exhaustion time.Duration) {
+	eo.exhaustions <- exhaustion
+}
+
+func TestObserverExhaustion(t *testing.T) {
+	ctx := context.Background()
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	eo := exhaustionObserver{exhaustions: make(chan time.Duration, 1)}
+	p.SetObserver(eo)
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	p.Put(r)
+	assert.GreaterOrEqual(t, <-eo.exhaustions, 20*time.Millisecond)
+}
+
+func TestShardedObserver(t *testing.T) {
+	ctx := context.Background()
+	p := NewShardedResourcePool(TypedPoolFactory, 2, 2, 4, 0, 0, 0, nil, nil, 0)
+	defer p.Close()
+	ro := &recordingObserver{}
+	p.SetObserver(ro)
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	require.NoError(t, p.SetCapacity(4))
+	assert.Equal(t, []string{"created", "capacity 2 -> 4"}, ro.take())
+}
+
+func TestPutWithReason(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	ro := &recordingObserver{}
+	p.SetObserver(ro)
+
+	// The resources put back after a success or a client error are
+	// reused.
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.PutWithReason(r, PutOK)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+	p.PutWithReason(r, PutClientError)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+	assert.Equal(t, []string{"created", "exhausted", "recovered", "exhausted", "recovered", "exhausted"}, ro.take())
+
+	// A resource put back after a server error is replaced.
+	p.PutWithReason(r, PutServerError)
+	assert.True(t, r.closed)
+	assert.EqualValues(t, 1, p.Available())
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	p.Put(r)
+	assert.Equal(t, []string{"closed server error", "created", "recovered", "exhausted", "recovered"}, ro.take())
+}
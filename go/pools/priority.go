@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import "context"
+
+// Priority is the priority of a caller waiting for a resource. When a
+// pool is exhausted, the resources that are returned to it go to the
+// waiters that have the highest priority first.
+type Priority int
+
+const (
+	// PriorityLow is for background work, e.g. vreplication. See
+	// ResourcePool.SetLowPriorityMaxWait.
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of the callers that don't set one.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for latency sensitive work, e.g. OLTP queries.
+	PriorityHigh Priority = 1
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context that sets the priority of the callers
+// waiting for a resource with it.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority set on the context, or
+// PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityNormal
+}
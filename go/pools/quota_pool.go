@@ -0,0 +1,225 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type (
+	// QuotaPool is the parent of pools that share its capacity, e.g. the
+	// pools of the users or of the workloads of a multi-tenant vttablet.
+	// Each child is guaranteed its minimum, and borrows the capacity that
+	// is not reserved by the minimums of the children up to its maximum,
+	// so the children are isolated without partitioning the capacity.
+	// The quota limits the resources in use, the idle resources of the
+	// children are closed by their idle timeout.
+	QuotaPool struct {
+		mu       sync.Mutex
+		capacity int
+		// reserved is the sum of the minimums of the children.
+		reserved int
+		// borrowed is the capacity the children use above their
+		// minimums.
+		borrowed int
+		// released is closed, and replaced, every time some quota is
+		// released, to wake up the callers that wait for it.
+		released chan struct{}
+	}
+
+	// QuotaChild is a pool that draws from the capacity of a QuotaPool.
+	QuotaChild struct {
+		parent   *QuotaPool
+		pool     IResourcePool
+		min, max int
+		// inUse is guarded by the mutex of the parent.
+		inUse  int
+		closed bool
+	}
+)
+
+// NewQuotaPool creates a QuotaPool with the given capacity.
+func NewQuotaPool(capacity int) *QuotaPool {
+	return &QuotaPool{
+		capacity: capacity,
+		released: make(chan struct{}),
+	}
+}
+
+// NewChild adds a child that gets its resources from pool, and can have
+// between min and max of them in use. The capacity of pool should be
+// max. The minimums of all the children can't exceed the capacity of
+// the parent.
+func (qp *QuotaPool) NewChild(pool IResourcePool, min, max int) (*QuotaChild, error) {
+	if min < 0 || max <= 0 || min > max {
+		return nil, fmt.Errorf("invalid quota child min %d and max %d", min, max)
+	}
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	if qp.reserved+min > qp.capacity {
+		return nil, fmt.Errorf("quota child min %d exceeds the %d unreserved capacity", min, qp.capacity-qp.reserved)
+	}
+	qp.reserved += min
+	return &QuotaChild{
+		parent: qp,
+		pool:   pool,
+		min:    min,
+		max:    max,
+	}, nil
+}
+
+// SetCapacity changes the capacity shared by the children. It can't be
+// lower than the sum of their minimums. If the children borrowed more
+// than the new capacity allows, they can't borrow again until they
+// return enough resources.
+func (qp *QuotaPool) SetCapacity(capacity int) error {
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	if capacity < qp.reserved {
+		return fmt.Errorf("quota capacity %d is lower than the %d reserved by the children", capacity, qp.reserved)
+	}
+	qp.capacity = capacity
+	qp.broadcast()
+	return nil
+}
+
+// Capacity returns the capacity shared by the children.
+func (qp *QuotaPool) Capacity() int64 {
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	return int64(qp.capacity)
+}
+
+// Reserved returns the sum of the minimums of the children.
+func (qp *QuotaPool) Reserved() int64 {
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	return int64(qp.reserved)
+}
+
+// Borrowed returns the capacity the children use above their minimums.
+func (qp *QuotaPool) Borrowed() int64 {
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	return int64(qp.borrowed)
+}
+
+// broadcast wakes up the callers that wait for some quota. qp.mu must
+// be held.
+func (qp *QuotaPool) broadcast() {
+	close(qp.released)
+	qp.released = make(chan struct{})
+}
+
+// acquire waits until the child can have one more resource in use.
+func (qc *QuotaChild) acquire(ctx context.Context) error {
+	qp := qc.parent
+	for {
+		qp.mu.Lock()
+		switch {
+		case qc.closed:
+			qp.mu.Unlock()
+			return ErrClosed
+		case qc.inUse < qc.min:
+			qc.inUse++
+			qp.mu.Unlock()
+			return nil
+		case qc.inUse < qc.max && qp.reserved+qp.borrowed < qp.capacity:
+			qc.inUse++
+			qp.borrowed++
+			qp.mu.Unlock()
+			return nil
+		}
+		released := qp.released
+		qp.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ErrTimeout
+		}
+	}
+}
+
+// release returns the quota of a resource of the child.
+func (qc *QuotaChild) release() {
+	qp := qc.parent
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	if qc.inUse > qc.min {
+		qp.borrowed--
+	}
+	qc.inUse--
+	qp.broadcast()
+}
+
+// Get waits for the quota of the child, and returns a resource of its
+// pool.
+func (qc *QuotaChild) Get(ctx context.Context) (Resource, error) {
+	if err := qc.acquire(ctx); err != nil {
+		return nil, err
+	}
+	r, err := qc.pool.Get(ctx)
+	if err != nil {
+		qc.release()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Put returns a resource to the pool of the child, and its quota to
+// the parent. Like for ResourcePool, a nil resource frees its slot.
+func (qc *QuotaChild) Put(resource Resource) {
+	qc.pool.Put(resource)
+	qc.release()
+}
+
+// InUse returns the number of resources of the child in use.
+func (qc *QuotaChild) InUse() int64 {
+	qc.parent.mu.Lock()
+	defer qc.parent.mu.Unlock()
+	return int64(qc.inUse)
+}
+
+// Pool returns the pool of the child.
+func (qc *QuotaChild) Pool() IResourcePool {
+	return qc.pool
+}
+
+// Close removes the child from its parent, which frees its minimum, and
+// closes its pool. It waits for all its resources to be returned.
+func (qc *QuotaChild) Close() {
+	qp := qc.parent
+	qp.mu.Lock()
+	if !qc.closed {
+		qc.closed = true
+		qp.reserved -= qc.min
+		// The resources still in use are borrowed until they are
+		// returned.
+		if qc.inUse < qc.min {
+			qp.borrowed += qc.inUse
+		} else {
+			qp.borrowed += qc.min
+		}
+		qc.min = 0
+		qp.broadcast()
+	}
+	qp.mu.Unlock()
+	qc.pool.Close()
+}
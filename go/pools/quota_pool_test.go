@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaPool(t *testing.T) {
+	ctx := context.Background()
+	qp := NewQuotaPool(4)
+	a, err := qp.NewChild(NewResourcePool(PoolFactory, 3, 3, 0, 0, logWait, nil, 0), 1, 3)
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := qp.NewChild(NewResourcePool(PoolFactory, 3, 3, 0, 0, logWait, nil, 0), 2, 3)
+	require.NoError(t, err)
+	defer b.Close()
+	_, err = qp.NewChild(NewResourcePool(PoolFactory, 1, 1, 0, 0, logWait, nil, 0), 2, 1)
+	assert.EqualError(t, err, "invalid quota child min 2 and max 1")
+	_, err = qp.NewChild(NewResourcePool(PoolFactory, 3, 3, 0, 0, logWait, nil, 0), 2, 3)
+	assert.EqualError(t, err, "quota child min 2 exceeds the 1 unreserved capacity")
+	assert.EqualValues(t, 3, qp.Reserved())
+
+	// a borrows the capacity that is not reserved.
+	var resources []Resource
+	for i := 0; i < 2; i++ {
+		r, err := a.Get(ctx)
+		require.NoError(t, err)
+		resources = append(resources, r)
+	}
+	assert.EqualValues(t, 1, qp.Borrowed())
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = a.Get(tctx)
+	assert.Equal(t, ErrTimeout, err)
+
+	// b still gets its minimum.
+	for i := 0; i < 2; i++ {
+		r, err := b.Get(ctx)
+		require.NoError(t, err)
+		defer b.Put(r)
+	}
+	assert.EqualValues(t, 2, b.InUse())
+
+	// A waiter gets the quota that is returned.
+	done := make(chan Resource)
+	go func() {
+		r, err := a.Get(ctx)
+		assert.NoError(t, err)
+		done <- r
+	}()
+	time.Sleep(10 * time.Millisecond)
+	a.Put(resources[1])
+	a.Put(<-done)
+	a.Put(resources[0])
+	assert.Zero(t, qp.Borrowed())
+
+	assert.EqualError(t, qp.SetCapacity(2), "quota capacity 2 is lower than the 3 reserved by the children")
+	require.NoError(t, qp.SetCapacity(3))
+
+	// Closing a child frees its minimum.
+	a.Close()
+	assert.EqualValues(t, 2, qp.Reserved())
+	_, err = a.Get(ctx)
+	assert.Equal(t, ErrClosed, err)
+}
@@ -33,9 +33,17 @@ type (
 	poolRefresh struct {
 		refreshCheck    RefreshCheck
 		refreshInterval time.Duration
-		refreshTicker   *time.Ticker
-		refreshStop     chan struct{}
-		refreshWg       sync.WaitGroup
+
+		// mu protects the ticker, since the refresh is stopped both by
+		// reopen and by the Close of the pool, which can run at the
+		// same time.
+		mu            sync.Mutex
+		refreshTicker *time.Ticker
+		refreshStop   chan struct{}
+		refreshWg     sync.WaitGroup
+		// closed is set once the pool is closed, so the refresh is not
+		// restarted by a reopen that was already running.
+		closed bool
 
 		pool refreshPool
 	}
@@ -64,14 +72,20 @@ func (pr *poolRefresh) startRefreshTicker() {
 	if pr == nil {
 		return
 	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.closed || pr.refreshTicker != nil {
+		return
+	}
 	pr.refreshTicker = time.NewTicker(pr.refreshInterval)
 	pr.refreshStop = make(chan struct{})
+	ticker, stop := pr.refreshTicker, pr.refreshStop
 	pr.refreshWg.Add(1)
 	go func() {
 		defer pr.refreshWg.Done()
 		for {
 			select {
-			case <-pr.refreshTicker.C:
+			case <-ticker.C:
 				val, err := pr.refreshCheck()
 				if err != nil {
 					log.Info(err)
@@ -80,18 +94,37 @@ func (pr *poolRefresh) startRefreshTicker() {
 					go pr.pool.reopen()
 					return
 				}
-			case <-pr.refreshStop:
+			case <-stop:
 				return
 			}
 		}
 	}()
 }
 
+// stop stops the refresh until it's started again. It can be called
+// several times.
 func (pr *poolRefresh) stop() {
-	if pr == nil || pr.refreshTicker == nil {
+	if pr == nil {
 		return
 	}
-	pr.refreshTicker.Stop()
-	close(pr.refreshStop)
+	pr.mu.Lock()
+	if pr.refreshTicker != nil {
+		pr.refreshTicker.Stop()
+		close(pr.refreshStop)
+		pr.refreshTicker = nil
+		pr.refreshStop = nil
+	}
+	pr.mu.Unlock()
 	pr.refreshWg.Wait()
 }
+
+// close stops the refresh for good, when the pool is closed.
+func (pr *poolRefresh) close() {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	pr.closed = true
+	pr.mu.Unlock()
+	pr.stop()
+}
@@ -20,11 +20,17 @@ package pools
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/timer"
 	"vitess.io/vitess/go/trace"
@@ -40,8 +46,27 @@ type (
 		Name() string
 		Get(ctx context.Context) (resource Resource, err error)
 		Put(resource Resource)
+		PutWithIdleTimeout(resource Resource, idleTimeout time.Duration)
+		PutWithReason(resource Resource, reason PutReason)
 		SetCapacity(capacity int) error
+		SetMaxCap(maxCap int) error
+		SetMaxConcurrentDials(maxDials int)
+		SetCapacitySchedule(windows []CapacityWindow, transition time.Duration) error
+		Pause()
+		Resume()
+		Flush()
+		EvictIdle(count int) int
+		Drain(ctx context.Context) error
 		SetIdleTimeout(idleTimeout time.Duration)
+		SetIdleCloseJitter(jitter time.Duration)
+		SetMaxIdleCloses(maxCloses int)
+		SetCheckFunc(check CheckFunc[Resource], checkInterval time.Duration)
+		SetObserver(observer Observer)
+		SetLIFO(lifo bool)
+		SetReusePolicy(policy ReusePolicy)
+		SetFreelist(freelist bool)
+		WaitForPrefill(ctx context.Context) error
+		Stats() Stats
 		StatsJSON() string
 		Capacity() int64
 		Available() int64
@@ -52,6 +77,9 @@ type (
 		WaitTime() time.Duration
 		IdleTimeout() time.Duration
 		IdleClosed() int64
+		MaxLifetime() time.Duration
+		MaxLifetimeClosed() int64
+		CheckFailed() int64
 		Exhausted() int64
 	}
 
@@ -65,13 +93,60 @@ type (
 	// Factory is a function that can be used to create a resource.
 	Factory func(context.Context) (Resource, error)
 
-	resourceWrapper struct {
-		resource Resource
-		timeUsed time.Time
+	// TypedFactory is a function that can be used to create a resource
+	// of type T.
+	TypedFactory[T Resource] func(context.Context) (T, error)
+
+	// CheckFunc is a function that checks the health of a resource,
+	// e.g. by pinging a connection. It returns an error if the resource
+	// can't be used anymore.
+	CheckFunc[T Resource] func(resource T) error
+
+	healthCheck[T Resource] struct {
+		check    CheckFunc[T]
+		interval time.Duration
+	}
+
+	resourceWrapper[T Resource] struct {
+		resource    T
+		timeCreated time.Time
+		timeUsed    time.Time
+		timeChecked time.Time
+		// idleJitter extends the idle timeout of the resource, so
+		// the resources that became idle together are not all closed
+		// at once.
+		idleJitter time.Duration
+		// idleTimeout overrides the idle timeout of the pool for the
+		// resource if it's not 0, see PutWithIdleTimeout.
+		idleTimeout time.Duration
+		// fingerprint is the fingerprint of the setting applied to the
+		// resource in a SettingsPool.
+		fingerprint string
+	}
+
+	waiter[T Resource] struct {
+		ch       chan resourceWrapper[T]
+		priority Priority
 	}
 
-	// ResourcePool allows you to use a pool of resources.
-	ResourcePool struct {
+	// idleSweep holds the state of a scan of the pool for idle
+	// resources.
+	idleSweep struct {
+		// now is the time of the scan on the clock of the pool.
+		now         time.Time
+		idleTimeout time.Duration
+		// closesLeft is the number of idle resources the scan may
+		// still close, or -1 for no limit.
+		closesLeft int
+	}
+
+	// ResourcePool allows you to use a pool of resources of type T.
+	// T must be comparable: it is usually a pointer, and its zero value
+	// stands for a missing resource, like nil for Put.
+	//
+	// ResourcePool[Resource], as returned by NewResourcePool, implements
+	// IResourcePool for the callers that still use the untyped API.
+	ResourcePool[T Resource] struct {
 		// stats. Atomic fields must remain at the top in order to prevent panics on certain architectures.
 		available  sync2.AtomicInt64
 		active     sync2.AtomicInt64
@@ -81,19 +156,119 @@ type (
 		idleClosed sync2.AtomicInt64
 		exhausted  sync2.AtomicInt64
 
+		maxLifetimeClosed sync2.AtomicInt64
+		checkFailed       sync2.AtomicInt64
+		shed              sync2.AtomicInt64
+		repaired          sync2.AtomicInt64
+		extraClosed       sync2.AtomicInt64
+
+		// repairsPending is the number of slots emptied because the
+		// factory failed, which the repair loop refills while
+		// repairing is set.
+		repairsPending sync2.AtomicInt64
+		repairing      sync2.AtomicBool
+
+		// leaks tracks the resources taken from the pool, when the
+		// leak detection is enabled.
+		leaks leakTracker
+
+		// dials records the errors and the successes of the factory.
+		dials dialHealth
+
+		// exhaustedSince is the start of the current exhaustion of the
+		// pool, zero if it's not exhausted.
+		exhaustionMu   sync.Mutex
+		exhaustedSince time.Time
+
+		// histograms records the distribution of the waits and of the
+		// checkouts, when they are set.
+		histograms poolHistograms
+
 		capacity    sync2.AtomicInt64
+		maxCap      sync2.AtomicInt64
 		idleTimeout sync2.AtomicDuration
+		idleJitter  sync2.AtomicDuration
+		// shortestIdleTimeout is the shortest idle timeout a resource
+		// was put back with, so the idle sweeps are frequent enough
+		// for it.
+		shortestIdleTimeout sync2.AtomicDuration
+		maxCloses           sync2.AtomicInt64
+		maxLifetime         time.Duration
+		lifo                sync2.AtomicBool
+		freelist            sync2.AtomicBool
+
+		// lifetimes tracks the creation time of the resources taken
+		// from the pool, when there is a max lifetime.
+		lifetimes lifetimeTracker
+
+		// statsTags register the pool in a StatsRegistry while it's
+		// open.
+		statsTags StatsTags
+
+		// lowPriorityMaxWait is how long the low priority callers wait
+		// at most for a resource.
+		lowPriorityMaxWait sync2.AtomicDuration
+
+		// repairMinBackoff and repairMaxBackoff bound the wait of the
+		// repair loop between two attempts to open a resource.
+		repairMinBackoff time.Duration
+		repairMaxBackoff time.Duration
 
-		resources chan resourceWrapper
-		factory   Factory
+		// slots holds the unused slots of the pool, up to maxCap. It is
+		// replaced by SetMaxCap, SetFreelist and the reopen of
+		// SetCapacity, so it must only be used while waitMu is held.
+		slots     slotStore[T]
+		factory   TypedFactory[T]
 		idleTimer *timer.Timer
 		logWait   func(time.Time)
 
+		// healthCheck holds the healthCheck[T] set by SetCheckFunc.
+		healthCheck atomic.Value
+		// observer holds the observerHolder set by SetObserver.
+		observer atomic.Value
+		// dialLimit holds the *sync2.Semaphore set by
+		// SetMaxConcurrentDials, nil if there is no limit.
+		dialLimit atomic.Value
+
+		// prefillProgress receives the results of the prefill, and
+		// prefillDone is closed once it's done, after prefillErr is set.
+		prefillProgress chan error
+		prefillDone     chan struct{}
+		prefillErr      error
+		prefillCancel   context.CancelFunc
+
+		// idle is the stack of the unused resources in LIFO mode, the
+		// most recently used one on top. resources then only holds
+		// empty wrappers, for the slots of the pool.
+		idleMu sync.Mutex
+		idle   []resourceWrapper[T]
+
+		// waiters are the callers waiting for a resource, by priority,
+		// then in order of arrival. While there are waiters, the
+		// resources that are returned to the pool are handed over to
+		// them, and the new callers queue up behind them.
+		waitMu  sync.Mutex
+		waiters []waiter[T]
+
+		// paused is set by Pause: the waiters then get nothing until
+		// Resume, and slotReturned is signaled when a slot is returned.
+		paused       bool
+		slotReturned *sync.Cond
+
 		reopenMutex sync.Mutex
 		refresh     *poolRefresh
+
+		// schedule changes the capacity by time of day, see
+		// SetCapacitySchedule.
+		schedule *capacitySchedule
+
+		// clock is the Clock set by SetClock.
+		clock poolClock
 	}
 )
 
+var _ IResourcePool = (*ResourcePool[Resource])(nil)
+
 var (
 	// ErrClosed is returned if ResourcePool is used when it's closed.
 	ErrClosed = errors.New("resource pool is closed")
@@ -105,187 +280,566 @@ var (
 	ErrCtxTimeout = vterrors.New(vtrpcpb.Code_DEADLINE_EXCEEDED, "resource pool context already expired")
 
 	prefillTimeout = 30 * time.Second
+
+	// reopenDrainTimeout is how long a refresh waits for the resources
+	// in use to be returned, so they are closed too. The callers of Get
+	// wait meanwhile.
+	reopenDrainTimeout = 30 * time.Second
+
+	// freelistByDefault makes the new pools use a freelist, as if
+	// SetFreelist(true) was called, so the tests can run with both
+	// stores.
+	freelistByDefault = false
+)
+
+const (
+	// defaultRepairMinBackoff and defaultRepairMaxBackoff bound the wait
+	// of the repair loop between two attempts to open a resource.
+	defaultRepairMinBackoff = 100 * time.Millisecond
+	defaultRepairMaxBackoff = 10 * time.Second
 )
 
-// NewResourcePool creates a new ResourcePool pool.
+// ResourcePoolOptions are the optional settings of a ResourcePool, see
+// NewTypedResourcePoolWithOptions.
+type ResourcePoolOptions struct {
+	// MaxLifetime is how long a resource can be used after it was
+	// created. An older resource is closed and replaced when it's
+	// returned to the pool, or when it's found unused in the pool, even
+	// if it's not idle. 0 means that resources are never too old.
+	MaxLifetime time.Duration
+	// Stats tags the pool in a StatsRegistry, which exports its stats
+	// until it's closed.
+	Stats StatsTags
+}
+
+// NewResourcePool creates a new ResourcePool of untyped resources.
+// See NewTypedResourcePool for the meaning of its arguments.
+func NewResourcePool(factory Factory, capacity, maxCap int, idleTimeout time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration) *ResourcePool[Resource] {
+	return NewTypedResourcePool(TypedFactory[Resource](factory), capacity, maxCap, idleTimeout, 0, prefillParallelism, logWait, refreshCheck, refreshInterval)
+}
+
+// NewTypedResourcePool creates a new ResourcePool of resources of type T.
 // capacity is the number of possible resources in the pool:
 // there can be up to 'capacity' of these at a given time.
 // maxCap specifies the extent to which the pool can be resized
 // in the future through the SetCapacity function.
-// You cannot resize the pool beyond maxCap.
+// You cannot resize the pool beyond maxCap, unless it's raised
+// with SetMaxCap.
 // If a resource is unused beyond idleTimeout, it's replaced
 // with a new one.
 // An idleTimeout of 0 means that there is no timeout.
-// A non-zero value of prefillParallelism causes the pool to be pre-filled.
+// maxLifetime is the MaxLifetime of ResourcePoolOptions.
+// A non-zero value of prefillParallelism causes the pool to be pre-filled
+// in the background, see WaitForPrefill.
 // The value specifies how many resources can be opened in parallel.
 // refreshCheck is a function we consult at refreshInterval
 // intervals to determine if the pool should be drained and reopened
-func NewResourcePool(factory Factory, capacity, maxCap int, idleTimeout time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration) *ResourcePool {
+func NewTypedResourcePool[T Resource](factory TypedFactory[T], capacity, maxCap int, idleTimeout, maxLifetime time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration) *ResourcePool[T] {
+	return NewTypedResourcePoolWithOptions(factory, capacity, maxCap, idleTimeout, prefillParallelism, logWait, refreshCheck, refreshInterval, ResourcePoolOptions{MaxLifetime: maxLifetime})
+}
+
+// NewTypedResourcePoolWithOptions creates a new ResourcePool of
+// resources of type T, like NewTypedResourcePool, with the optional
+// settings of opts.
+func NewTypedResourcePoolWithOptions[T Resource](factory TypedFactory[T], capacity, maxCap int, idleTimeout time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration, opts ResourcePoolOptions) *ResourcePool[T] {
 	if capacity <= 0 || maxCap <= 0 || capacity > maxCap {
 		panic(errors.New("invalid/out of range capacity"))
 	}
-	rp := &ResourcePool{
-		resources:   make(chan resourceWrapper, maxCap),
+	rp := &ResourcePool[T]{
+		slots:       newSlotStore[T](maxCap, freelistByDefault),
+		freelist:    sync2.NewAtomicBool(freelistByDefault),
 		factory:     factory,
 		available:   sync2.NewAtomicInt64(int64(capacity)),
 		capacity:    sync2.NewAtomicInt64(int64(capacity)),
+		maxCap:      sync2.NewAtomicInt64(int64(maxCap)),
 		idleTimeout: sync2.NewAtomicDuration(idleTimeout),
+		maxLifetime: opts.MaxLifetime,
 		logWait:     logWait,
+
+		repairMinBackoff: defaultRepairMinBackoff,
+		repairMaxBackoff: defaultRepairMaxBackoff,
 	}
 	for i := 0; i < capacity; i++ {
-		rp.resources <- resourceWrapper{}
+		rp.slots.put(resourceWrapper[T]{})
 	}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), prefillTimeout)
-	defer cancel()
+	rp.prefillProgress = make(chan error, capacity)
+	rp.prefillDone = make(chan struct{})
 	if prefillParallelism != 0 {
-		sem := sync2.NewSemaphore(prefillParallelism, 0 /* timeout */)
-		var wg sync.WaitGroup
-		for i := 0; i < capacity; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				_ = sem.Acquire()
-				defer sem.Release()
-
-				// If context has expired, give up.
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-
-				r, err := rp.Get(ctx)
-				if err != nil {
-					return
-				}
-				rp.Put(r)
-			}()
-		}
-		wg.Wait()
+		var ctx context.Context
+		ctx, rp.prefillCancel = context.WithTimeout(context.TODO(), prefillTimeout)
+		go rp.prefill(ctx, capacity, prefillParallelism)
+	} else {
+		close(rp.prefillProgress)
+		close(rp.prefillDone)
 	}
 
-	if idleTimeout != 0 {
-		rp.idleTimer = timer.NewTimer(idleTimeout / 10)
+	if idleTimeout != 0 || opts.MaxLifetime != 0 {
+		rp.idleTimer = timer.NewTimer(rp.sweepInterval())
 		rp.idleTimer.Start(rp.closeIdleResources)
 	}
 
+	rp.slotReturned = sync.NewCond(&rp.waitMu)
 	rp.refresh = newPoolRefresh(rp, refreshCheck, refreshInterval)
 	rp.refresh.startRefreshTicker()
+	rp.schedule = newCapacitySchedule(rp, rp.clock.now)
+	rp.statsTags = opts.Stats
+	rp.statsTags.register(rp)
 
 	return rp
 }
 
-func (rp *ResourcePool) Name() string {
+// prefill opens the resources of the pool, parallelism at a time, until
+// ctx is done.
+func (rp *ResourcePool[T]) prefill(ctx context.Context, capacity, parallelism int) {
+	defer rp.prefillCancel()
+	sem := sync2.NewSemaphore(parallelism, 0 /* timeout */)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	for i := 0; i < capacity; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = sem.Acquire()
+			defer sem.Release()
+
+			r, err := rp.Get(ctx)
+			if err == nil {
+				rp.Put(r)
+			} else {
+				errOnce.Do(func() { rp.prefillErr = err })
+			}
+			rp.prefillProgress <- err
+		}()
+	}
+	wg.Wait()
+	close(rp.prefillProgress)
+	close(rp.prefillDone)
+}
+
+// WaitForPrefill waits until the prefill of the pool is done, and returns
+// the first error it got opening a resource, if any. It returns
+// ctx.Err() if ctx is done first. It returns nil right away if the
+// pool is not prefilled.
+func (rp *ResourcePool[T]) WaitForPrefill(ctx context.Context) error {
+	select {
+	case <-rp.prefillDone:
+		return rp.prefillErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PrefillProgress returns a channel that receives the result of the
+// opening of every resource of the prefill: nil, or the error it got.
+// The channel is closed when the prefill is done.
+func (rp *ResourcePool[T]) PrefillProgress() <-chan error {
+	return rp.prefillProgress
+}
+
+func (rp *ResourcePool[T]) Name() string {
 	return "ResourcePool"
 }
 
 // Close empties the pool calling Close on all its resources.
+// It stops the prefill if it's still running.
 // You can call Close while there are outstanding resources.
 // It waits for all resources to be returned (Put).
 // After a Close, Get is not allowed.
-func (rp *ResourcePool) Close() {
+func (rp *ResourcePool[T]) Close() {
+	if rp.prefillCancel != nil {
+		rp.prefillCancel()
+		<-rp.prefillDone
+	}
 	if rp.idleTimer != nil {
 		rp.idleTimer.Stop()
 	}
-	rp.refresh.stop()
+	rp.leaks.stop()
+	rp.refresh.close()
+	rp.schedule.stop()
+	rp.statsTags.unregister(rp)
+	rp.Resume()
 	_ = rp.SetCapacity(0)
 }
 
-// closeIdleResources scans the pool for idle resources
-func (rp *ResourcePool) closeIdleResources() {
+// closeIdleResources scans the pool for idle resources, for resources
+// that outlived the max lifetime, and for resources that fail the
+// health check.
+func (rp *ResourcePool[T]) closeIdleResources() {
 	available := int(rp.Available())
-	idleTimeout := rp.IdleTimeout()
+	sweep := &idleSweep{now: rp.clock.now(), idleTimeout: rp.IdleTimeout(), closesLeft: -1}
+	if maxCloses := rp.maxCloses.Get(); maxCloses > 0 {
+		sweep.closesLeft = int(maxCloses)
+	}
+	rp.closeIdleStack(sweep)
+	if rp.maxLifetime > 0 {
+		// The resources discarded with Put(nil) are never checked in.
+		rp.lifetimes.prune(sweep.now.Add(-rp.maxLifetime))
+	}
 
 	for i := 0; i < available; i++ {
-		var wrapper resourceWrapper
-		select {
-		case wrapper = <-rp.resources:
-		default:
+		wrapper, ok := rp.tryAcquire()
+		if !ok {
 			// stop early if we don't get anything new from the pool
 			return
 		}
 
 		func() {
-			defer func() { rp.resources <- wrapper }()
+			defer func() { rp.release(wrapper) }()
 
-			if wrapper.resource != nil && idleTimeout > 0 && time.Until(wrapper.timeUsed.Add(idleTimeout)) < 0 {
-				wrapper.resource.Close()
-				rp.idleClosed.Add(1)
-				rp.reopenResource(&wrapper)
+			if !isNil(wrapper.resource) && !rp.keepIdle(&wrapper, sweep) {
+				rp.replaceResource(&wrapper)
 			}
 		}()
 
 	}
 }
 
+// closeIdleStack scans the stack of the unused resources of the LIFO
+// mode. The resources it closes are not replaced, so the pool shrinks
+// back to the resources that are actually used.
+func (rp *ResourcePool[T]) closeIdleStack(sweep *idleSweep) {
+	// The stack is scanned outside of the lock, since the health check
+	// may be slow. Meanwhile, Get creates new resources if needed.
+	rp.idleMu.Lock()
+	idle := rp.idle
+	rp.idle = nil
+	rp.idleMu.Unlock()
+
+	kept := idle[:0]
+	for _, wrapper := range idle {
+		if rp.keepIdle(&wrapper, sweep) {
+			kept = append(kept, wrapper)
+			continue
+		}
+		rp.active.Add(-1)
+	}
+
+	// The scanned resources were unused before those that were put
+	// back meanwhile, so they go to the bottom of the stack.
+	rp.idleMu.Lock()
+	rp.idle = append(kept, rp.idle...)
+	rp.idleMu.Unlock()
+}
+
+// keepIdle returns true if the unused resource of the wrapper can be
+// kept in the pool. Otherwise, it closes the resource.
+func (rp *ResourcePool[T]) keepIdle(wrapper *resourceWrapper[T], sweep *idleSweep) bool {
+	var reason CloseReason
+	switch {
+	case sweep.closeIdle(wrapper.timeUsed.Add(wrapper.idleJitter), wrapper.idleTimeout):
+		rp.idleClosed.Add(1)
+		reason = CloseReasonIdle
+	case rp.expired(wrapper.timeCreated):
+		rp.maxLifetimeClosed.Add(1)
+		reason = CloseReasonLifetime
+	case !rp.healthy(wrapper):
+		reason = CloseReasonError
+	default:
+		return true
+	}
+	wrapper.resource.Close()
+	rp.observe().ResourceClosed(reason)
+	return false
+}
+
+// closeIdle returns true if a resource last used at timeUsed outlived
+// the idle timeout, and the sweep can still close it. idleTimeout
+// overrides the idle timeout of the sweep if it's not 0.
+func (sweep *idleSweep) closeIdle(timeUsed time.Time, idleTimeout time.Duration) bool {
+	if idleTimeout <= 0 {
+		idleTimeout = sweep.idleTimeout
+	}
+	if idleTimeout <= 0 || sweep.closesLeft == 0 || timeUsed.Add(idleTimeout).Sub(sweep.now) >= 0 {
+		return false
+	}
+	if sweep.closesLeft > 0 {
+		sweep.closesLeft--
+	}
+	return true
+}
+
 // reopen drains and reopens the connection pool
-func (rp *ResourcePool) reopen() {
+func (rp *ResourcePool[T]) reopen() {
 	rp.reopenMutex.Lock() // Avoid race, since we can refresh asynchronously
 	defer rp.reopenMutex.Unlock()
-	capacity := int(rp.capacity.Get())
-	log.Infof("Draining and reopening resource pool with capacity %d by request", capacity)
-	rp.Close()
-	_ = rp.SetCapacity(capacity)
-	if rp.idleTimer != nil {
-		rp.idleTimer.Start(rp.closeIdleResources)
+	log.Infof("Draining resource pool with capacity %d by request", rp.capacity.Get())
+	rp.refresh.stop()
+	ctx, cancel := context.WithTimeout(context.Background(), reopenDrainTimeout)
+	defer cancel()
+	switch err := rp.Drain(ctx); err {
+	case nil:
+	case ErrClosed:
+		return
+	default:
+		log.Warningf("Resource pool drain on refresh did not complete, the resources in use are not closed: %v", err)
 	}
 	rp.refresh.startRefreshTicker()
 }
 
+// Pause stops handing out resources: the callers of Get wait, until
+// Resume or until their ctx is done, and the resources that are put back
+// stay in the pool. SetCapacity also waits to shrink the pool until
+// Resume, while Close resumes it. Pausing a paused pool does nothing.
+func (rp *ResourcePool[T]) Pause() {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	rp.paused = true
+}
+
+// Resume resumes a paused pool: the unused slots are handed over to the
+// callers that waited, in order. Resuming a pool that is not paused does
+// nothing.
+func (rp *ResourcePool[T]) Resume() {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	rp.paused = false
+	// Wake up Drain, in case the pool is resumed by Close.
+	rp.slotReturned.Broadcast()
+	for len(rp.waiters) > 0 {
+		wrapper, ok, empty := rp.slots.take()
+		if empty || !ok {
+			return
+		}
+		first := rp.waiters[0]
+		rp.waiters[0] = waiter[T]{}
+		rp.waiters = rp.waiters[1:]
+		first.ch <- wrapper
+	}
+}
+
+// Flush closes the unused resources of the pool. Their slots stay in
+// the pool, so it creates new resources as they are needed. The
+// resources that are taken are left alone.
+func (rp *ResourcePool[T]) Flush() {
+	var flushed []T
+	rp.waitMu.Lock()
+	for n := rp.slots.len(); n > 0; n-- {
+		wrapper, ok, empty := rp.slots.take()
+		if empty || !ok {
+			break
+		}
+		if !isNil(wrapper.resource) {
+			flushed = append(flushed, wrapper.resource)
+		}
+		rp.slots.put(resourceWrapper[T]{})
+	}
+	rp.waitMu.Unlock()
+	for {
+		wrapper, ok := rp.popIdle("")
+		if !ok {
+			break
+		}
+		flushed = append(flushed, wrapper.resource)
+	}
+
+	for _, resource := range flushed {
+		resource.Close()
+		rp.active.Add(-1)
+		rp.observe().ResourceClosed(CloseReasonEviction)
+	}
+}
+
+// EvictIdle closes up to count unused resources, the least recently
+// used first, and returns how many it closed. Their slots are left
+// empty, so new resources are only created when they are needed. It
+// lets a process under memory pressure shed the buffers of its
+// resources without restarting the pool.
+func (rp *ResourcePool[T]) EvictIdle(count int) int {
+	if count <= 0 {
+		return 0
+	}
+	var evicted []T
+	rp.waitMu.Lock()
+	rp.idleMu.Lock()
+	wrappers := make([]resourceWrapper[T], 0, rp.slots.len())
+	for n := rp.slots.len(); n > 0; n-- {
+		wrapper, ok, empty := rp.slots.take()
+		if empty || !ok {
+			break
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+	var candidates []*resourceWrapper[T]
+	for i := range wrappers {
+		if !isNil(wrappers[i].resource) {
+			candidates = append(candidates, &wrappers[i])
+		}
+	}
+	for i := range rp.idle {
+		candidates = append(candidates, &rp.idle[i])
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].timeUsed.Before(candidates[j].timeUsed)
+	})
+	if len(candidates) > count {
+		candidates = candidates[:count]
+	}
+	for _, wrapper := range candidates {
+		evicted = append(evicted, wrapper.resource)
+		*wrapper = resourceWrapper[T]{}
+	}
+	// The evicted resources of the LIFO stack are removed from it, and
+	// the slots are put back in the same order.
+	kept := rp.idle[:0]
+	for _, wrapper := range rp.idle {
+		if !isNil(wrapper.resource) {
+			kept = append(kept, wrapper)
+		}
+	}
+	for i := len(kept); i < len(rp.idle); i++ {
+		rp.idle[i] = resourceWrapper[T]{}
+	}
+	rp.idle = kept
+	for _, wrapper := range wrappers {
+		rp.slots.put(wrapper)
+	}
+	rp.idleMu.Unlock()
+	rp.waitMu.Unlock()
+
+	for _, resource := range evicted {
+		resource.Close()
+		rp.active.Add(-1)
+		rp.observe().ResourceClosed(CloseReasonEviction)
+	}
+	return len(evicted)
+}
+
+// Drain closes all the resources of the pool, and leaves it open with
+// the same capacity, so it creates new resources as they are needed. It
+// pauses the pool while it waits for the resources that are taken to be
+// returned, so the callers of Get wait until the drain is done, then
+// flushes and resumes it. If ctx is done first, Drain returns ctx.Err():
+// the unused resources are closed, and those that are still taken are
+// left alone.
+func (rp *ResourcePool[T]) Drain(ctx context.Context) error {
+	if rp.capacity.Get() == 0 {
+		return ErrClosed
+	}
+	rp.Pause()
+	defer rp.Resume()
+	err := rp.waitForSlots(ctx)
+	rp.Flush()
+	return err
+}
+
+// waitForSlots waits until all the slots of the paused pool are
+// returned, or until ctx is done.
+func (rp *ResourcePool[T]) waitForSlots(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rp.waitMu.Lock()
+			rp.slotReturned.Broadcast()
+			rp.waitMu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	for rp.paused && int64(rp.slots.len()) < rp.capacity.Get() && ctx.Err() == nil {
+		rp.slotReturned.Wait()
+	}
+	return ctx.Err()
+}
+
 // Get will return the next available resource. If capacity
 // has not been reached, it will create a new one using the factory. Otherwise,
 // it will wait till the next resource becomes available or a timeout.
 // A timeout of 0 is an indefinite wait.
-func (rp *ResourcePool) Get(ctx context.Context) (resource Resource, err error) {
+func (rp *ResourcePool[T]) Get(ctx context.Context) (resource T, err error) {
 	span, ctx := trace.NewSpan(ctx, "ResourcePool.Get")
 	span.Annotate("capacity", rp.capacity.Get())
 	span.Annotate("in_use", rp.inUse.Get())
 	span.Annotate("available", rp.available.Get())
 	span.Annotate("active", rp.active.Get())
 	defer span.Finish()
-	return rp.get(ctx)
+	resource, err = rp.get(ctx, "")
+	if err == nil {
+		rp.leaks.checkout(ctx, resource, 1)
+		rp.histograms.checkout(resource)
+	}
+	return resource, err
 }
 
-func (rp *ResourcePool) get(ctx context.Context) (resource Resource, err error) {
+// get returns the next available resource. In LIFO mode, it prefers the
+// most recently used resource that has the setting of the fingerprint.
+func (rp *ResourcePool[T]) get(ctx context.Context, fingerprint string) (resource T, err error) {
 	// If ctx has already expired, avoid racing with rp's resource channel.
 	select {
 	case <-ctx.Done():
-		return nil, ErrCtxTimeout
+		return resource, ErrCtxTimeout
 	default:
 	}
 
 	// Fetch
-	var wrapper resourceWrapper
-	var ok bool
-	select {
-	case wrapper, ok = <-rp.resources:
-	default:
-		startTime := time.Now()
-		select {
-		case wrapper, ok = <-rp.resources:
-		case <-ctx.Done():
-			return nil, ErrTimeout
-		}
-		rp.recordWait(startTime)
+	wrapper, ok, err := rp.acquire(ctx, true)
+	if err != nil {
+		return resource, err
 	}
 	if !ok {
-		return nil, ErrClosed
+		return resource, ErrClosed
+	}
+	return rp.unwrap(ctx, wrapper, fingerprint)
+}
+
+// tryGet returns the next available resource if there is one right away.
+// ok is false if it would have to wait, or if the pool is closed.
+func (rp *ResourcePool[T]) tryGet(ctx context.Context) (resource T, ok bool, err error) {
+	wrapper, ok := rp.tryAcquire()
+	if !ok {
+		return resource, false, nil
+	}
+	resource, err = rp.unwrap(ctx, wrapper, "")
+	return resource, true, err
+}
+
+// unwrap returns the resource of a wrapper taken from the pool. It
+// creates a new resource if the wrapper is empty, or if its resource is
+// not healthy.
+func (rp *ResourcePool[T]) unwrap(ctx context.Context, wrapper resourceWrapper[T], fingerprint string) (resource T, err error) {
+	if isNil(wrapper.resource) {
+		wrapper, _ = rp.popIdle(fingerprint)
+	}
+
+	// Check
+	if !isNil(wrapper.resource) && rp.expired(wrapper.timeCreated) {
+		wrapper.resource.Close()
+		wrapper = resourceWrapper[T]{}
+		rp.active.Add(-1)
+		rp.maxLifetimeClosed.Add(1)
+		rp.observe().ResourceClosed(CloseReasonLifetime)
+	}
+	if !isNil(wrapper.resource) && !rp.healthy(&wrapper) {
+		wrapper.resource.Close()
+		wrapper = resourceWrapper[T]{}
+		rp.active.Add(-1)
+		rp.observe().ResourceClosed(CloseReasonError)
 	}
 
 	// Unwrap
-	if wrapper.resource == nil {
+	if isNil(wrapper.resource) {
 		span, _ := trace.NewSpan(ctx, "ResourcePool.factory")
-		wrapper.resource, err = rp.factory(ctx)
+		wrapper.resource, err = rp.dial(ctx)
 		span.Finish()
 		if err != nil {
-			rp.resources <- resourceWrapper{}
-			return nil, err
+			rp.release(resourceWrapper[T]{})
+			rp.noteExhaustion()
+			return resource, err
 		}
+		wrapper.timeCreated = rp.clock.now()
 		rp.active.Add(1)
+		rp.observe().ResourceCreated()
+	}
+	if rp.maxLifetime > 0 {
+		rp.lifetimes.checkout(wrapper.resource, wrapper.timeCreated)
 	}
 	if rp.available.Add(-1) <= 0 {
 		rp.exhausted.Add(1)
+		rp.noteExhaustion()
 	}
 	rp.inUse.Add(1)
 	return wrapper.resource, err
@@ -294,44 +848,581 @@ func (rp *ResourcePool) get(ctx context.Context) (resource Resource, err error)
 // Put will return a resource to the pool. For every successful Get,
 // a corresponding Put is required. If you no longer need a resource,
 // you will need to call Put(nil) instead of returning the closed resource.
-// This will cause a new resource to be created in its place.
-func (rp *ResourcePool) Put(resource Resource) {
-	var wrapper resourceWrapper
-	if resource != nil {
-		wrapper = resourceWrapper{
-			resource: resource,
-			timeUsed: time.Now(),
+// This will cause a new resource to be created in its place, unless the
+// pool is in LIFO mode.
+// A resource that outlived the max lifetime is closed and replaced too.
+// Put panics if the pool is full, e.g. because a resource is put back
+// twice, unless the pool has a freelist (see SetFreelist): then the
+// resource is closed and counted by ExtraClosed.
+func (rp *ResourcePool[T]) Put(resource T) {
+	rp.put(resource, "", 0)
+}
+
+// PutWithIdleTimeout returns a resource to the pool like Put, with an
+// idle timeout that overrides the one of the pool for it until it's
+// taken again, e.g. so the resources that hold expensive state are
+// closed sooner. The idle timeouts are only enforced if the pool was
+// created with an idle timeout or a max lifetime.
+func (rp *ResourcePool[T]) PutWithIdleTimeout(resource T, idleTimeout time.Duration) {
+	rp.noteIdleTimeout(idleTimeout)
+	rp.put(resource, "", idleTimeout)
+}
+
+// PutReason classifies how the last use of a resource ended, so the pool
+// can decide whether to reuse it.
+type PutReason int
+
+const (
+	// PutOK is for the resources whose last use succeeded.
+	PutOK PutReason = iota
+	// PutClientError is for the resources whose last use failed because
+	// of the caller, e.g. a syntax error or a duplicate key. They are
+	// still usable.
+	PutClientError
+	// PutServerError is for the resources whose last use failed in a
+	// way that leaves them in an unknown state, e.g. a lost connection
+	// or an interrupted protocol exchange. They are closed, and their
+	// slot is given back.
+	PutServerError
+)
+
+// PutWithReason returns a resource to the pool like Put, or closes it
+// and discards it if the reason is PutServerError, which is reported to
+// the Observer with CloseReasonServerError. This replaces closing the
+// resource and putting back nil, so the pool can tell why its resources
+// are churned.
+func (rp *ResourcePool[T]) PutWithReason(resource T, reason PutReason) {
+	if reason != PutServerError || isNil(resource) {
+		rp.Put(resource)
+		return
+	}
+	resource.Close()
+	rp.observe().ResourceClosed(CloseReasonServerError)
+	rp.Discard(resource)
+}
+
+// noteIdleTimeout makes the idle sweeps frequent enough for the idle
+// timeout of a resource.
+func (rp *ResourcePool[T]) noteIdleTimeout(idleTimeout time.Duration) {
+	if idleTimeout <= 0 || rp.idleTimer == nil {
+		return
+	}
+	for {
+		shortest := rp.shortestIdleTimeout.Get()
+		if shortest != 0 && shortest <= idleTimeout {
+			return
+		}
+		if rp.shortestIdleTimeout.CompareAndSwap(shortest, idleTimeout) {
+			rp.idleTimer.SetInterval(rp.sweepInterval())
+			return
+		}
+	}
+}
+
+// put returns a resource that has the setting of the fingerprint to the
+// pool. idleTimeout overrides the idle timeout of the pool for it if
+// it's not 0.
+func (rp *ResourcePool[T]) put(resource T, fingerprint string, idleTimeout time.Duration) {
+	if !rp.claimInUse() {
+		if !rp.freelist.Get() {
+			panic(errors.New("attempt to Put into a full ResourcePool"))
+		}
+		rp.closeExtra(resource)
+		return
+	}
+	var wrapper resourceWrapper[T]
+	if !isNil(resource) {
+		rp.leaks.checkin(resource)
+		rp.histograms.checkin(resource)
+		wrapper = resourceWrapper[T]{
+			resource:    resource,
+			timeCreated: rp.timeCreated(resource),
+			timeUsed:    rp.clock.now(),
+			idleJitter:  rp.newIdleJitter(),
+			idleTimeout: idleTimeout,
+			fingerprint: fingerprint,
+		}
+		if rp.expired(wrapper.timeCreated) {
+			resource.Close()
+			rp.maxLifetimeClosed.Add(1)
+			rp.observe().ResourceClosed(CloseReasonLifetime)
+			rp.replaceResource(&wrapper)
 		}
 	} else {
-		rp.reopenResource(&wrapper)
+		rp.replaceResource(&wrapper)
+	}
+	if rp.lifo.Get() && !isNil(wrapper.resource) {
+		rp.pushIdle(wrapper)
+		wrapper = resourceWrapper[T]{}
+	}
+	handedOver := rp.release(wrapper)
+	// The pool stays exhausted if a waiter takes the slot.
+	if rp.available.Add(1) == 1 && !handedOver {
+		rp.noteExhaustion()
+	}
+}
+
+// claimInUse takes a resource put back off the count of the resources
+// in use. It returns false if there is none in use, so the resource is
+// one too many for the pool.
+func (rp *ResourcePool[T]) claimInUse() bool {
+	for {
+		inUse := rp.inUse.Get()
+		if inUse <= 0 {
+			return false
+		}
+		if rp.inUse.CompareAndSwap(inUse, inUse-1) {
+			return true
+		}
+	}
+}
+
+// closeExtra closes a resource that can't go back to a pool with a
+// freelist because it's full, e.g. because it was put back twice: the
+// freelist grows instead of being full, so it would be overfilled.
+func (rp *ResourcePool[T]) closeExtra(resource T) {
+	rp.extraClosed.Add(1)
+	log.Errorf("Resource put into a full %s, closing it", rp.Name())
+	if !isNil(resource) {
+		resource.Close()
+	}
+}
+
+// Discard gives back the slot of a resource taken with Get that is not
+// returned to the pool, e.g. because it was closed. It's the same as
+// Put(nil), but it also ends the checkout of the resource for the leak
+// detection and the held histogram.
+func (rp *ResourcePool[T]) Discard(resource T) {
+	rp.leaks.checkin(resource)
+	rp.histograms.checkin(resource)
+	rp.timeCreated(resource)
+	var zero T
+	rp.put(zero, "", 0)
+}
+
+// SetLeakThreshold enables the leak detection: the pool keeps track of
+// the resources that are taken, with the stack and the purpose (see
+// WithPurpose) of their Get, and logs a warning for those that are not
+// returned within the threshold. The resources must be comparable, e.g.
+// pointers, and those that are not returned to the pool must be
+// discarded with Discard. A threshold of 0 disables it.
+func (rp *ResourcePool[T]) SetLeakThreshold(threshold time.Duration) {
+	rp.leaks.setThreshold(threshold)
+}
+
+// Renew extends the lease of a resource taken with Get: the leak
+// detection counts the time it is held from now on. A holder that makes
+// progress, e.g. a long streaming query, can renew it so it isn't
+// reported as leaked, while a holder that is stuck still is.
+func (rp *ResourcePool[T]) Renew(resource T) {
+	rp.leaks.renew(resource)
+}
+
+// Checkouts returns the resources that are taken from the pool, the
+// oldest first, if the leak detection is enabled.
+func (rp *ResourcePool[T]) Checkouts() []Checkout {
+	return rp.leaks.list()
+}
+
+// Leaked returns the number of resources that were not returned within
+// the threshold of the leak detection.
+func (rp *ResourcePool[T]) Leaked() int64 {
+	return rp.leaks.leaked.Get()
+}
+
+// SetHistograms sets the histograms in which the pool records the waits
+// for a resource, and the time the resources are held per checkout, in
+// nanoseconds. Either of them can be nil. For the held histogram, the
+// resources must be comparable, e.g. pointers, and those that are not
+// returned to the pool must be discarded with Discard.
+func (rp *ResourcePool[T]) SetHistograms(wait, held *stats.Histogram) {
+	rp.histograms.set(wait, held)
+}
+
+// acquire takes a wrapper from the pool. If there is none, it waits for
+// one in line behind the callers that were already waiting with the same
+// priority or a higher one, until ctx is done. ok is false if the pool
+// is closed.
+func (rp *ResourcePool[T]) acquire(ctx context.Context, recordWait bool) (wrapper resourceWrapper[T], ok bool, err error) {
+	rp.waitMu.Lock()
+	if len(rp.waiters) == 0 && !rp.paused {
+		var empty bool
+		if wrapper, ok, empty = rp.slots.take(); !empty {
+			rp.waitMu.Unlock()
+			return wrapper, ok, nil
+		}
+	}
+	w := waiter[T]{ch: make(chan resourceWrapper[T], 1), priority: PriorityFromContext(ctx)}
+	rp.addWaiter(w)
+	rp.waitMu.Unlock()
+
+	var shed <-chan time.Time
+	if maxWait := rp.lowPriorityMaxWait.Get(); maxWait > 0 && w.priority < PriorityNormal {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		shed = timer.C
+	}
+
+	startTime := time.Now()
+	if recordWait {
+		rp.observe().WaitStarted()
 	}
 	select {
-	case rp.resources <- wrapper:
-	default:
+	case wrapper, ok = <-w.ch:
+	case <-ctx.Done():
+		rp.abandon(w)
+		err = ErrTimeout
+	case <-shed:
+		rp.abandon(w)
+		rp.shed.Add(1)
+		err = ErrTimeout
+	}
+	if recordWait {
+		if err == nil {
+			rp.recordWait(startTime)
+		}
+		rp.observe().WaitEnded(time.Since(startTime), ok)
+	}
+	return wrapper, ok, err
+}
+
+// addWaiter queues a waiter behind those that have the same priority or
+// a higher one. waitMu must be held.
+func (rp *ResourcePool[T]) addWaiter(w waiter[T]) {
+	i := len(rp.waiters)
+	for i > 0 && rp.waiters[i-1].priority < w.priority {
+		i--
+	}
+	rp.waiters = append(rp.waiters, waiter[T]{})
+	copy(rp.waiters[i+1:], rp.waiters[i:])
+	rp.waiters[i] = w
+}
+
+// abandon stops the wait of a waiter.
+func (rp *ResourcePool[T]) abandon(w waiter[T]) {
+	if !rp.removeWaiter(w.ch) {
+		// The wrapper was handed over meanwhile: pass it on.
+		if wrapper, ok := <-w.ch; ok {
+			rp.release(wrapper)
+		}
+	}
+}
+
+// tryAcquire takes a wrapper from the pool if there is one, and if no
+// caller is waiting for one.
+func (rp *ResourcePool[T]) tryAcquire() (wrapper resourceWrapper[T], ok bool) {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	if len(rp.waiters) > 0 || rp.paused {
+		return wrapper, false
+	}
+	wrapper, ok, _ = rp.slots.take()
+	return wrapper, ok
+}
+
+// removeWaiter removes the waiter from the queue, and returns false if
+// it was not in it anymore.
+func (rp *ResourcePool[T]) removeWaiter(waiter chan resourceWrapper[T]) bool {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	for i, w := range rp.waiters {
+		if w.ch == waiter {
+			rp.waiters = append(rp.waiters[:i], rp.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release returns a wrapper to the pool, or hands it over to the first
+// waiter unless the pool is paused. It returns true if it handed it
+// over.
+func (rp *ResourcePool[T]) release(wrapper resourceWrapper[T]) (handedOver bool) {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	if len(rp.waiters) > 0 && !rp.paused {
+		first := rp.waiters[0]
+		rp.waiters[0] = waiter[T]{}
+		rp.waiters = rp.waiters[1:]
+		first.ch <- wrapper
+		return true
+	}
+	if !rp.slots.put(wrapper) {
 		panic(errors.New("attempt to Put into a full ResourcePool"))
 	}
-	rp.inUse.Add(-1)
-	rp.available.Add(1)
+	if rp.paused {
+		rp.slotReturned.Broadcast()
+	}
+	return false
 }
 
-func (rp *ResourcePool) reopenResource(wrapper *resourceWrapper) {
-	if r, err := rp.factory(context.TODO()); err == nil {
+// replaceResource replaces the closed resource of the wrapper: with a new
+// resource, or in LIFO mode with nothing, so the pool can shrink.
+func (rp *ResourcePool[T]) replaceResource(wrapper *resourceWrapper[T]) {
+	if rp.lifo.Get() {
+		*wrapper = resourceWrapper[T]{}
+		rp.active.Add(-1)
+		return
+	}
+	rp.reopenResource(wrapper)
+}
+
+func (rp *ResourcePool[T]) reopenResource(wrapper *resourceWrapper[T]) {
+	if r, err := rp.dial(context.TODO()); err == nil {
+		rp.observe().ResourceCreated()
 		wrapper.resource = r
-		wrapper.timeUsed = time.Now()
+		wrapper.timeCreated = rp.clock.now()
+		wrapper.timeUsed = rp.clock.now()
+		wrapper.idleJitter = rp.newIdleJitter()
+		wrapper.idleTimeout = 0
 	} else {
-		wrapper.resource = nil
+		var zero T
+		wrapper.resource = zero
 		rp.active.Add(-1)
+		rp.scheduleRepair()
+	}
+}
+
+// scheduleRepair has the repair loop refill a slot that was emptied
+// because the factory failed, so the pool doesn't stay short of
+// resources until the slot is used again.
+func (rp *ResourcePool[T]) scheduleRepair() {
+	rp.repairsPending.Add(1)
+	if rp.repairing.CompareAndSwap(false, true) {
+		go rp.repair()
 	}
 }
 
+// repair opens resources for the emptied slots, retrying with an
+// exponential backoff while the factory fails, until none is left. It
+// stops if the pool is closed, or in LIFO mode, where the pool doesn't
+// refill the emptied slots.
+func (rp *ResourcePool[T]) repair() {
+	backoff := rp.repairMinBackoff
+	for {
+		time.Sleep(backoff)
+		if rp.Capacity() == 0 || rp.lifo.Get() {
+			rp.repairsPending.Set(0)
+		}
+		if rp.repairsPending.Get() <= 0 {
+			rp.repairing.Set(false)
+			// Go on if a repair was scheduled meanwhile, unless another
+			// loop was started for it.
+			if rp.repairsPending.Get() <= 0 || !rp.repairing.CompareAndSwap(false, true) {
+				return
+			}
+			continue
+		}
+
+		r, err := rp.dial(context.TODO())
+		if err != nil {
+			if backoff *= 2; backoff > rp.repairMaxBackoff {
+				backoff = rp.repairMaxBackoff
+			}
+			continue
+		}
+		rp.observe().ResourceCreated()
+		backoff = rp.repairMinBackoff
+		rp.repairsPending.Add(-1)
+		if !rp.fillEmptySlot(r) {
+			// The slots were refilled by Get meanwhile.
+			r.Close()
+			rp.observe().ResourceClosed(CloseReasonEviction)
+		}
+	}
+}
+
+// fillEmptySlot puts the resource in an unused slot of the pool that is
+// empty, and returns false if there is none.
+func (rp *ResourcePool[T]) fillEmptySlot(resource T) bool {
+	for i := rp.Available(); i > 0; i-- {
+		wrapper, ok := rp.tryAcquire()
+		if !ok {
+			return false
+		}
+		if isNil(wrapper.resource) {
+			rp.active.Add(1)
+			rp.repaired.Add(1)
+			rp.release(resourceWrapper[T]{
+				resource:    resource,
+				timeCreated: rp.clock.now(),
+				timeUsed:    rp.clock.now(),
+				idleJitter:  rp.newIdleJitter(),
+			})
+			return true
+		}
+		rp.release(wrapper)
+	}
+	return false
+}
+
+// SetLIFO sets the order in which the unused resources are reused. By
+// default, the pool is FIFO: Get returns the least recently used
+// resource, so all the resources of the pool are kept warm. In LIFO
+// mode, Get returns the most recently used resource, so after a burst
+// the resources that are not needed anymore become idle and are closed
+// by the idle timeout: the pool shrinks back to a small warm set.
+func (rp *ResourcePool[T]) SetLIFO(lifo bool) {
+	rp.lifo.Set(lifo)
+}
+
+// ReusePolicy is the order in which a pool reuses its unused resources.
+type ReusePolicy int
+
+const (
+	// ReuseLRU hands out the least recently used resource, so all the
+	// resources are used, and none is closed by a server-side timeout.
+	// It's the default, the FIFO mode.
+	ReuseLRU ReusePolicy = iota
+	// ReuseMRU hands out the most recently used resource, so the
+	// caches of the resources that are used the most stay warm, and
+	// the others are closed by the idle timeout. It's the LIFO mode.
+	ReuseMRU
+)
+
+func (p ReusePolicy) String() string {
+	switch p {
+	case ReuseLRU:
+		return "lru"
+	case ReuseMRU:
+		return "mru"
+	}
+	return "unknown"
+}
+
+// ParseReusePolicy parses the name of a ReusePolicy, lru or mru. An empty
+// name is the default, lru.
+func ParseReusePolicy(name string) (ReusePolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "lru":
+		return ReuseLRU, nil
+	case "mru":
+		return ReuseMRU, nil
+	}
+	return ReuseLRU, fmt.Errorf("invalid reuse policy: %q", name)
+}
+
+// SetReusePolicy sets the order in which the unused resources are
+// reused. It's the same as SetLIFO(policy == ReuseMRU).
+func (rp *ResourcePool[T]) SetReusePolicy(policy ReusePolicy) {
+	rp.SetLIFO(policy == ReuseMRU)
+}
+
+// ReusePolicy returns the order in which the unused resources are
+// reused.
+func (rp *ResourcePool[T]) ReusePolicy() ReusePolicy {
+	if rp.lifo.Get() {
+		return ReuseMRU
+	}
+	return ReuseLRU
+}
+
+func (rp *ResourcePool[T]) pushIdle(wrapper resourceWrapper[T]) {
+	rp.idleMu.Lock()
+	rp.idle = append(rp.idle, wrapper)
+	rp.idleMu.Unlock()
+}
+
+// popIdle pops a resource from the stack of the LIFO mode: the most
+// recently used one that has the setting of the fingerprint, otherwise
+// the most recently used one with no setting, otherwise the top one.
+func (rp *ResourcePool[T]) popIdle(fingerprint string) (wrapper resourceWrapper[T], ok bool) {
+	rp.idleMu.Lock()
+	defer rp.idleMu.Unlock()
+	if len(rp.idle) == 0 {
+		return wrapper, false
+	}
+	i, found := len(rp.idle)-1, false
+	for j := len(rp.idle) - 1; j >= 0 && !found; j-- {
+		switch rp.idle[j].fingerprint {
+		case fingerprint:
+			i, found = j, true
+		case "":
+			if rp.idle[i].fingerprint != "" {
+				i = j
+			}
+		}
+	}
+	wrapper = rp.idle[i]
+	copy(rp.idle[i:], rp.idle[i+1:])
+	rp.idle[len(rp.idle)-1] = resourceWrapper[T]{}
+	rp.idle = rp.idle[:len(rp.idle)-1]
+	return wrapper, true
+}
+
+// SetCheckFunc sets the function that checks the health of the
+// resources. The resources are checked when they are handed out by Get,
+// and while they are unused in the pool. Those that fail the check are
+// closed and replaced with new ones. A resource isn't checked again if
+// it was checked or used less than checkInterval ago: a checkInterval
+// of 0 means that every Get checks the resource. A nil check disables
+// the health checks.
+func (rp *ResourcePool[T]) SetCheckFunc(check CheckFunc[T], checkInterval time.Duration) {
+	rp.healthCheck.Store(healthCheck[T]{check: check, interval: checkInterval})
+}
+
+// SetObserver sets the Observer notified of the lifecycle of the
+// resources of the pool. A nil observer removes it.
+func (rp *ResourcePool[T]) SetObserver(observer Observer) {
+	rp.observer.Store(observerHolder{observer: observer})
+}
+
+// observe returns the Observer of the pool, or a NoopObserver if it has
+// none.
+func (rp *ResourcePool[T]) observe() Observer {
+	if holder, _ := rp.observer.Load().(observerHolder); holder.observer != nil {
+		return holder.observer
+	}
+	return NoopObserver{}
+}
+
+// healthy returns false if the resource of the wrapper fails the health
+// check.
+func (rp *ResourcePool[T]) healthy(wrapper *resourceWrapper[T]) bool {
+	hc, _ := rp.healthCheck.Load().(healthCheck[T])
+	if hc.check == nil {
+		return true
+	}
+	lastChecked := wrapper.timeUsed
+	if wrapper.timeChecked.After(lastChecked) {
+		lastChecked = wrapper.timeChecked
+	}
+	if hc.interval > 0 && rp.clock.since(lastChecked) < hc.interval {
+		return true
+	}
+	if err := hc.check(wrapper.resource); err != nil {
+		rp.checkFailed.Add(1)
+		return false
+	}
+	wrapper.timeChecked = rp.clock.now()
+	return true
+}
+
+// expired returns true if a resource created at timeCreated outlived
+// the max lifetime.
+func (rp *ResourcePool[T]) expired(timeCreated time.Time) bool {
+	return rp.maxLifetime > 0 && rp.clock.since(timeCreated) > rp.maxLifetime
+}
+
+// timeCreated returns the creation time of a resource taken from the
+// pool, and stops tracking it. It returns the zero time, which is
+// always expired, if the resource is not tracked anymore.
+func (rp *ResourcePool[T]) timeCreated(resource T) time.Time {
+	if rp.maxLifetime <= 0 {
+		return time.Time{}
+	}
+	timeCreated, _ := rp.lifetimes.checkin(resource)
+	return timeCreated
+}
+
 // SetCapacity changes the capacity of the pool.
 // You can use it to shrink or expand, but not beyond
 // the max capacity. If the change requires the pool
 // to be shrunk, SetCapacity waits till the necessary
 // number of resources are returned to the pool.
 // A SetCapacity of 0 is equivalent to closing the ResourcePool.
-func (rp *ResourcePool) SetCapacity(capacity int) error {
-	if capacity < 0 || capacity > cap(rp.resources) {
+func (rp *ResourcePool[T]) SetCapacity(capacity int) error {
+	if capacity < 0 || int64(capacity) > rp.maxCap.Get() {
 		return fmt.Errorf("capacity %d is out of range", capacity)
 	}
 
@@ -341,7 +1432,9 @@ func (rp *ResourcePool) SetCapacity(capacity int) error {
 		oldcap = int(rp.capacity.Get())
 		if oldcap == 0 && capacity > 0 {
 			// Closed this before, re-open the channel
-			rp.resources = make(chan resourceWrapper, cap(rp.resources))
+			rp.waitMu.Lock()
+			rp.slots = newSlotStore[T](int(rp.maxCap.Get()), rp.freelist.Get())
+			rp.waitMu.Unlock()
 		}
 		if oldcap == capacity {
 			return nil
@@ -350,31 +1443,122 @@ func (rp *ResourcePool) SetCapacity(capacity int) error {
 			break
 		}
 	}
+	rp.observe().CapacityChanged(oldcap, capacity)
 
 	if capacity < oldcap {
 		for i := 0; i < oldcap-capacity; i++ {
-			wrapper := <-rp.resources
-			if wrapper.resource != nil {
+			wrapper, _, _ := rp.acquire(context.Background(), false)
+			if isNil(wrapper.resource) {
+				wrapper, _ = rp.popIdle("")
+			}
+			if !isNil(wrapper.resource) {
 				wrapper.resource.Close()
 				rp.active.Add(-1)
+				rp.observe().ResourceClosed(CloseReasonEviction)
 			}
 			rp.available.Add(-1)
 		}
 	} else {
 		for i := 0; i < capacity-oldcap; i++ {
-			rp.resources <- resourceWrapper{}
+			rp.release(resourceWrapper[T]{})
 			rp.available.Add(1)
 		}
 	}
 	if capacity == 0 {
-		close(rp.resources)
+		// The callers still waiting get ErrClosed.
+		rp.waitMu.Lock()
+		rp.slots.close()
+		for _, w := range rp.waiters {
+			close(w.ch)
+		}
+		rp.waiters = nil
+		rp.waitMu.Unlock()
+		for {
+			wrapper, ok := rp.popIdle("")
+			if !ok {
+				break
+			}
+			wrapper.resource.Close()
+			rp.active.Add(-1)
+			rp.observe().ResourceClosed(CloseReasonEviction)
+		}
+	}
+	rp.noteExhaustion()
+	return nil
+}
+
+// noteExhaustion reports the start or the end of an exhaustion of the
+// pool, if the number of available resources crossed 0. A closed pool
+// is not exhausted.
+func (rp *ResourcePool[T]) noteExhaustion() {
+	rp.exhaustionMu.Lock()
+	defer rp.exhaustionMu.Unlock()
+	exhausted := rp.available.Get() <= 0 && rp.capacity.Get() > 0
+	switch {
+	case exhausted && rp.exhaustedSince.IsZero():
+		rp.exhaustedSince = rp.clock.now()
+		rp.observe().PoolExhausted()
+	case !exhausted && !rp.exhaustedSince.IsZero():
+		exhaustion := rp.clock.since(rp.exhaustedSince)
+		rp.exhaustedSince = time.Time{}
+		rp.observe().PoolRecovered(exhaustion)
+	}
+}
+
+// SetMaxCap raises the max capacity of the pool, so SetCapacity can
+// then grow it further than the maxCap it was created with. The
+// resources of the pool are kept: only the storage of its slots is
+// replaced. The max capacity can't be lowered.
+func (rp *ResourcePool[T]) SetMaxCap(maxCap int) error {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	if int64(maxCap) < rp.maxCap.Get() {
+		return fmt.Errorf("max capacity %d is lower than %d", maxCap, rp.maxCap.Get())
 	}
+	rp.replaceSlots(maxCap, rp.freelist.Get())
+	rp.maxCap.Set(int64(maxCap))
 	return nil
 }
 
-func (rp *ResourcePool) recordWait(start time.Time) {
+// SetFreelist sets the store of the unused slots of the pool: a
+// freelist, which is never full and avoids the synchronization of a
+// channel under the lock of the pool, or by default a buffered channel.
+// The resources of the pool are kept.
+func (rp *ResourcePool[T]) SetFreelist(freelist bool) {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	if rp.freelist.Get() == freelist {
+		return
+	}
+	rp.freelist.Set(freelist)
+	rp.replaceSlots(int(rp.maxCap.Get()), freelist)
+}
+
+// replaceSlots moves the unused slots of the pool to a new store.
+// waitMu must be held.
+func (rp *ResourcePool[T]) replaceSlots(maxCap int, freelist bool) {
+	slots := newSlotStore[T](maxCap, freelist)
+	for {
+		wrapper, ok, empty := rp.slots.take()
+		if empty {
+			break
+		}
+		if !ok {
+			// The pool is closed, and stays so until SetCapacity
+			// reopens it.
+			slots.close()
+			break
+		}
+		slots.put(wrapper)
+	}
+	rp.slots = slots
+}
+
+func (rp *ResourcePool[T]) recordWait(start time.Time) {
+	wait := time.Since(start)
 	rp.waitCount.Add(1)
-	rp.waitTime.Add(time.Since(start))
+	rp.waitTime.Add(wait)
+	rp.histograms.recordWait(wait)
 	if rp.logWait != nil {
 		rp.logWait(start)
 	}
@@ -382,78 +1566,296 @@ func (rp *ResourcePool) recordWait(start time.Time) {
 
 // SetIdleTimeout sets the idle timeout. It can only be used if there was an
 // idle timeout set when the pool was created.
-func (rp *ResourcePool) SetIdleTimeout(idleTimeout time.Duration) {
+func (rp *ResourcePool[T]) SetIdleTimeout(idleTimeout time.Duration) {
 	if rp.idleTimer == nil {
 		panic("SetIdleTimeout called when timer not initialized")
 	}
 
 	rp.idleTimeout.Set(idleTimeout)
-	rp.idleTimer.SetInterval(idleTimeout / 10)
+	rp.idleTimer.SetInterval(rp.sweepInterval())
+}
+
+// SetLowPriorityMaxWait sets how long the callers with a priority below
+// PriorityNormal wait at most for a resource. They give up with
+// ErrTimeout after that, so they are shed early when the pool is
+// exhausted. A maxWait of 0 means that they wait like the others.
+func (rp *ResourcePool[T]) SetLowPriorityMaxWait(maxWait time.Duration) {
+	rp.lowPriorityMaxWait.Set(maxWait)
+}
+
+// SetIdleCloseJitter sets the maximum jitter of the idle timeout. Every
+// resource that is put back in the pool is kept idle for a random
+// duration between the idle timeout and the idle timeout plus jitter,
+// so the resources that were used together, e.g. during a burst, are
+// not all closed at once and reopened in a reconnect storm. The change
+// applies to the resources put back from then on.
+func (rp *ResourcePool[T]) SetIdleCloseJitter(jitter time.Duration) {
+	rp.idleJitter.Set(jitter)
+}
+
+// SetMaxIdleCloses sets the maximum number of idle resources closed
+// every time the pool is scanned. The others are closed by the
+// following scans, which spreads the reconnections. A maxCloses of 0
+// means that there is no limit.
+func (rp *ResourcePool[T]) SetMaxIdleCloses(maxCloses int) {
+	rp.maxCloses.Set(int64(maxCloses))
+}
+
+// SetClock sets the Clock of the pool, e.g. a FakeClock for the tests of
+// the idle timeouts. A nil clock restores the real time. The times
+// already recorded are kept, so it should be set before the pool is
+// used.
+func (rp *ResourcePool[T]) SetClock(clock Clock) {
+	rp.clock.set(clock)
+}
+
+// SetCapacitySchedule has the pool change its capacity during the given
+// daily windows, e.g. to shrink a background pool during the peak
+// hours. Outside of the windows, the pool has the capacity it has when
+// the schedule is set. After each start or end of a window, the
+// capacity changes gradually over the transition. No windows removes
+// the schedule, and restores that capacity.
+func (rp *ResourcePool[T]) SetCapacitySchedule(windows []CapacityWindow, transition time.Duration) error {
+	return rp.schedule.set(windows, transition)
+}
+
+// SetMaxConcurrentDials limits the number of resources the pool creates
+// at the same time, independently of its capacity, so that after a mass
+// disconnect the resources are reopened at a controlled rate instead of
+// all at once. The callers of Get wait for their turn until their ctx
+// is done. A maxDials of 0 means that there is no limit.
+func (rp *ResourcePool[T]) SetMaxConcurrentDials(maxDials int) {
+	var limit *sync2.Semaphore
+	if maxDials > 0 {
+		limit = sync2.NewSemaphore(maxDials, 0)
+	}
+	rp.dialLimit.Store(limit)
+}
+
+// dial creates a new resource once the limit of concurrent dials allows
+// it. If ctx is done before the factory returns, dial returns right
+// away, so the caller gets its slot back, and the resource is closed
+// once the factory returns it, in case the factory ignores ctx.
+func (rp *ResourcePool[T]) dial(ctx context.Context) (resource T, err error) {
+	limit, _ := rp.dialLimit.Load().(*sync2.Semaphore)
+	if limit != nil {
+		if !limit.AcquireContext(ctx) {
+			return resource, ErrTimeout
+		}
+	}
+	if ctx.Done() == nil {
+		// ctx can't be cancelled.
+		if limit != nil {
+			defer limit.Release()
+		}
+		resource, err = rp.factory(ctx)
+		rp.dials.record(err, rp.clock.now())
+		return resource, err
+	}
+
+	var r T
+	var dialErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if limit != nil {
+			defer limit.Release()
+		}
+		r, dialErr = rp.factory(ctx)
+		rp.dials.record(dialErr, rp.clock.now())
+	}()
+	select {
+	case <-done:
+		return r, dialErr
+	case <-ctx.Done():
+		go func() {
+			<-done
+			if dialErr == nil && !isNil(r) {
+				r.Close()
+			}
+		}()
+		return resource, ErrTimeout
+	}
+}
+
+func (rp *ResourcePool[T]) newIdleJitter() time.Duration {
+	jitter := rp.idleJitter.Get()
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// sweepInterval returns how often closeIdleResources scans the pool:
+// a tenth of the shortest of the idle timeout and the max lifetime.
+func (rp *ResourcePool[T]) sweepInterval() time.Duration {
+	interval := rp.IdleTimeout()
+	if shortest := rp.shortestIdleTimeout.Get(); shortest != 0 && (interval == 0 || shortest < interval) {
+		interval = shortest
+	}
+	if interval == 0 || (rp.maxLifetime != 0 && rp.maxLifetime < interval) {
+		interval = rp.maxLifetime
+	}
+	return interval / 10
+}
+
+// Stats are the stats of a pool.
+type Stats struct {
+	Capacity    int64
+	Available   int64
+	Active      int64
+	InUse       int64
+	MaxCapacity int64
+	WaitCount   int64
+	WaitTime    time.Duration
+	// Waiters is the number of callers waiting for a resource.
+	Waiters     int64
+	IdleTimeout time.Duration
+	IdleClosed  int64
+	Exhausted   int64
+	// DialErrors is the number of times the pool failed to create a
+	// resource, and RecentDialErrors the number of failures of the
+	// last minute. LastDialError is the last failure, at
+	// LastDialErrorTime, and LastDialSuccessTime the time the pool last
+	// created a resource. A pool that is exhausted and fails to create
+	// resources is likely cut off from its backend.
+	DialErrors          int64
+	RecentDialErrors    int64
+	LastDialError       string `json:",omitempty"`
+	LastDialErrorTime   time.Time
+	LastDialSuccessTime time.Time
+	// Shards is the number of shards of a ShardedResourcePool.
+	Shards int `json:",omitempty"`
+}
+
+// Stats returns the stats of the pool.
+func (rp *ResourcePool[T]) Stats() Stats {
+	stats := Stats{
+		Capacity:    rp.Capacity(),
+		Available:   rp.Available(),
+		Active:      rp.Active(),
+		InUse:       rp.InUse(),
+		MaxCapacity: rp.MaxCap(),
+		WaitCount:   rp.WaitCount(),
+		WaitTime:    rp.WaitTime(),
+		Waiters:     rp.Waiters(),
+		IdleTimeout: rp.IdleTimeout(),
+		IdleClosed:  rp.IdleClosed(),
+		Exhausted:   rp.Exhausted(),
+	}
+	rp.dials.fill(&stats, rp.clock.now())
+	return stats
 }
 
 // StatsJSON returns the stats in JSON format.
-func (rp *ResourcePool) StatsJSON() string {
-	return fmt.Sprintf(`{"Capacity": %v, "Available": %v, "Active": %v, "InUse": %v, "MaxCapacity": %v, "WaitCount": %v, "WaitTime": %v, "IdleTimeout": %v, "IdleClosed": %v, "Exhausted": %v}`,
-		rp.Capacity(),
-		rp.Available(),
-		rp.Active(),
-		rp.InUse(),
-		rp.MaxCap(),
-		rp.WaitCount(),
-		rp.WaitTime().Nanoseconds(),
-		rp.IdleTimeout().Nanoseconds(),
-		rp.IdleClosed(),
-		rp.Exhausted(),
-	)
+func (rp *ResourcePool[T]) StatsJSON() string {
+	return statsJSON(rp.Stats())
+}
+
+func statsJSON(stats Stats) string {
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
 }
 
 // Capacity returns the capacity.
-func (rp *ResourcePool) Capacity() int64 {
+func (rp *ResourcePool[T]) Capacity() int64 {
 	return rp.capacity.Get()
 }
 
 // Available returns the number of currently unused and available resources.
-func (rp *ResourcePool) Available() int64 {
+func (rp *ResourcePool[T]) Available() int64 {
 	return rp.available.Get()
 }
 
 // Active returns the number of active (i.e. non-nil) resources either in the
 // pool or claimed for use
-func (rp *ResourcePool) Active() int64 {
+func (rp *ResourcePool[T]) Active() int64 {
 	return rp.active.Get()
 }
 
 // InUse returns the number of claimed resources from the pool
-func (rp *ResourcePool) InUse() int64 {
+func (rp *ResourcePool[T]) InUse() int64 {
 	return rp.inUse.Get()
 }
 
 // MaxCap returns the max capacity.
-func (rp *ResourcePool) MaxCap() int64 {
-	return int64(cap(rp.resources))
+func (rp *ResourcePool[T]) MaxCap() int64 {
+	return rp.maxCap.Get()
 }
 
 // WaitCount returns the total number of waits.
-func (rp *ResourcePool) WaitCount() int64 {
+func (rp *ResourcePool[T]) WaitCount() int64 {
 	return rp.waitCount.Get()
 }
 
 // WaitTime returns the total wait time.
-func (rp *ResourcePool) WaitTime() time.Duration {
+func (rp *ResourcePool[T]) WaitTime() time.Duration {
 	return rp.waitTime.Get()
 }
 
+// Waiters returns the number of callers currently waiting for a
+// resource.
+func (rp *ResourcePool[T]) Waiters() int64 {
+	rp.waitMu.Lock()
+	defer rp.waitMu.Unlock()
+	return int64(len(rp.waiters))
+}
+
 // IdleTimeout returns the idle timeout.
-func (rp *ResourcePool) IdleTimeout() time.Duration {
+func (rp *ResourcePool[T]) IdleTimeout() time.Duration {
 	return rp.idleTimeout.Get()
 }
 
 // IdleClosed returns the count of resources closed due to idle timeout.
-func (rp *ResourcePool) IdleClosed() int64 {
+func (rp *ResourcePool[T]) IdleClosed() int64 {
 	return rp.idleClosed.Get()
 }
 
+// MaxLifetime returns the max lifetime of the resources.
+func (rp *ResourcePool[T]) MaxLifetime() time.Duration {
+	return rp.maxLifetime
+}
+
+// MaxLifetimeClosed returns the count of resources closed because they
+// outlived the max lifetime.
+func (rp *ResourcePool[T]) MaxLifetimeClosed() int64 {
+	return rp.maxLifetimeClosed.Get()
+}
+
+// Repaired returns the number of resources opened by the repair loop, for
+// the slots emptied because the factory failed.
+func (rp *ResourcePool[T]) Repaired() int64 {
+	return rp.repaired.Get()
+}
+
+// Shed returns the number of low priority callers that gave up waiting
+// after the low priority max wait.
+func (rp *ResourcePool[T]) Shed() int64 {
+	return rp.shed.Get()
+}
+
+// CheckFailed returns the count of resources closed because they failed
+// the health check.
+func (rp *ResourcePool[T]) CheckFailed() int64 {
+	return rp.checkFailed.Get()
+}
+
+// ExtraClosed returns the number of resources closed because they were
+// put into a full pool with a freelist.
+func (rp *ResourcePool[T]) ExtraClosed() int64 {
+	return rp.extraClosed.Get()
+}
+
 // Exhausted returns the number of times Available dropped below 1
-func (rp *ResourcePool) Exhausted() int64 {
+func (rp *ResourcePool[T]) Exhausted() int64 {
 	return rp.exhausted.Get()
 }
+
+// isNil returns true if r is the zero value of T, e.g. a nil pointer.
+func isNil[T Resource](r T) bool {
+	var zero T
+	return any(r) == any(zero)
+}
@@ -18,6 +18,7 @@ package pools
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -44,6 +45,10 @@ func (tr *TestResource) Close() {
 	}
 }
 
+func (tr *TestResource) IsClosed() bool {
+	return tr.closed
+}
+
 func logWait(start time.Time) {
 	waitStarts = append(waitStarts, start)
 }
@@ -62,6 +67,14 @@ func SlowFailFactory(ctx context.Context) (Resource, error) {
 	return nil, errors.New("Failed")
 }
 
+// poolStats returns the stats of the pool without the times of the
+// dials, which the tests can't predict.
+func poolStats(p *ResourcePool[Resource]) Stats {
+	stats := p.Stats()
+	stats.LastDialErrorTime, stats.LastDialSuccessTime = time.Time{}, time.Time{}
+	return stats
+}
+
 func TestOpen(t *testing.T) {
 	ctx := context.Background()
 	lastID.Set(0)
@@ -163,14 +176,24 @@ func TestOpen(t *testing.T) {
 }
 
 func TestPrefill(t *testing.T) {
+	ctx := context.Background()
 	lastID.Set(0)
 	count.Set(0)
 	p := NewResourcePool(PoolFactory, 5, 5, time.Second, 1, logWait, nil, 0)
 	defer p.Close()
+	require.NoError(t, p.WaitForPrefill(ctx))
 	assert.EqualValues(t, 5, p.Active())
 	p = NewResourcePool(FailFactory, 5, 5, time.Second, 1, logWait, nil, 0)
 	defer p.Close()
+	assert.EqualError(t, p.WaitForPrefill(ctx), "Failed")
 	assert.EqualValues(t, 0, p.Active())
+
+	// Without a prefill, there is nothing to wait for.
+	p = NewResourcePool(PoolFactory, 5, 5, time.Second, 0, logWait, nil, 0)
+	defer p.Close()
+	require.NoError(t, p.WaitForPrefill(ctx))
+	_, ok := <-p.PrefillProgress()
+	assert.False(t, ok)
 }
 
 func TestPrefillTimeout(t *testing.T) {
@@ -183,12 +206,55 @@ func TestPrefillTimeout(t *testing.T) {
 	start := time.Now()
 	p := NewResourcePool(SlowFailFactory, 5, 5, time.Second, 1, logWait, nil, 0)
 	defer p.Close()
+	assert.Error(t, p.WaitForPrefill(context.Background()))
 	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
 		t.Errorf("elapsed: %v, should be around 10ms", elapsed)
 	}
 	assert.Zero(t, p.Active())
 }
 
+func TestPrefillBackground(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	release := make(chan struct{})
+	factory := func(ctx context.Context) (*TestResource, error) {
+		<-release
+		return TypedPoolFactory(ctx)
+	}
+
+	// The pool is returned while it's prefilled.
+	p := NewTypedResourcePool(factory, 3, 3, time.Second, 0, 3, logWait, nil, 0)
+	defer p.Close()
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.WaitForPrefill(waitCtx))
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-p.PrefillProgress())
+	}
+	_, ok := <-p.PrefillProgress()
+	assert.False(t, ok)
+	require.NoError(t, p.WaitForPrefill(ctx))
+	assert.EqualValues(t, 3, p.Active())
+}
+
+func TestPrefillClose(t *testing.T) {
+	lastID.Set(0)
+	count.Set(0)
+	factory := func(ctx context.Context) (*TestResource, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	// Close stops the prefill.
+	p := NewTypedResourcePool(factory, 3, 3, time.Second, 0, 1, logWait, nil, 0)
+	p.Close()
+	assert.Error(t, p.WaitForPrefill(context.Background()))
+	assert.Zero(t, p.Active())
+}
+
 func TestShrinking(t *testing.T) {
 	ctx := context.Background()
 	lastID.Set(0)
@@ -196,6 +262,7 @@ func TestShrinking(t *testing.T) {
 	waitStarts = waitStarts[:0]
 
 	p := NewResourcePool(PoolFactory, 5, 5, time.Second, 0, logWait, nil, 0)
+	defer p.Close()
 	var resources [10]Resource
 	// Leave one empty slot in the pool
 	for i := 0; i < 4; i++ {
@@ -208,13 +275,13 @@ func TestShrinking(t *testing.T) {
 		p.SetCapacity(3)
 		done <- true
 	}()
-	expected := `{"Capacity": 3, "Available": 0, "Active": 4, "InUse": 4, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 0}`
+	expected := Stats{Capacity: 3, Available: 0, Active: 4, InUse: 4, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, Waiters: 1, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 0}
 	for i := 0; i < 10; i++ {
 		time.Sleep(10 * time.Millisecond)
-		stats := p.StatsJSON()
+		stats := poolStats(p)
 		if stats != expected {
 			if i == 9 {
-				t.Errorf(`expecting '%s', received '%s'`, expected, stats)
+				t.Errorf(`expecting %+v, received %+v`, expected, stats)
 			}
 		}
 	}
@@ -226,8 +293,8 @@ func TestShrinking(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		p.Put(resources[i])
 	}
-	stats := p.StatsJSON()
-	expected = `{"Capacity": 3, "Available": 3, "Active": 3, "InUse": 0, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 0}`
+	stats := poolStats(p)
+	expected = Stats{Capacity: 3, Available: 3, Active: 3, InUse: 0, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 0}
 	assert.Equal(t, expected, stats)
 	assert.EqualValues(t, 3, count.Get())
 
@@ -324,8 +391,8 @@ func TestClosing(t *testing.T) {
 
 	// Wait for goroutine to call Close
 	time.Sleep(10 * time.Millisecond)
-	stats := p.StatsJSON()
-	expected := `{"Capacity": 0, "Available": 0, "Active": 5, "InUse": 5, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 1}`
+	stats := poolStats(p)
+	expected := Stats{Capacity: 0, Available: 0, Active: 5, InUse: 5, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, Waiters: 1, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 1}
 	assert.Equal(t, expected, stats)
 
 	// Put is allowed when closing
@@ -336,8 +403,8 @@ func TestClosing(t *testing.T) {
 	// Wait for Close to return
 	<-ch
 
-	stats = p.StatsJSON()
-	expected = `{"Capacity": 0, "Available": 0, "Active": 0, "InUse": 0, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 1}`
+	stats = poolStats(p)
+	expected = Stats{Capacity: 0, Available: 0, Active: 0, InUse: 0, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 1}
 	assert.Equal(t, expected, stats)
 	assert.EqualValues(t, 5, lastID.Get())
 	assert.EqualValues(t, 0, count.Get())
@@ -359,8 +426,8 @@ func TestReopen(t *testing.T) {
 	}
 
 	time.Sleep(10 * time.Millisecond)
-	stats := p.StatsJSON()
-	expected := `{"Capacity": 5, "Available": 0, "Active": 5, "InUse": 5, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 1}`
+	stats := poolStats(p)
+	expected := Stats{Capacity: 5, Available: 0, Active: 5, InUse: 5, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 1}
 	assert.Equal(t, expected, stats)
 
 	time.Sleep(650 * time.Millisecond)
@@ -368,13 +435,73 @@ func TestReopen(t *testing.T) {
 		p.Put(resources[i])
 	}
 	time.Sleep(50 * time.Millisecond)
-	stats = p.StatsJSON()
-	expected = `{"Capacity": 5, "Available": 5, "Active": 0, "InUse": 0, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 1}`
+	stats = poolStats(p)
+	expected = Stats{Capacity: 5, Available: 5, Active: 0, InUse: 0, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 1}
 	assert.Equal(t, expected, stats)
 	assert.EqualValues(t, 5, lastID.Get())
 	assert.EqualValues(t, 0, count.Get())
 }
 
+func TestReopenDuringClose(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	refreshCheck := func() (bool, error) {
+		return true, nil
+	}
+	p := NewResourcePool(PoolFactory, 1, 1, 0, 0, logWait, refreshCheck, 10*time.Millisecond)
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// The refresh drains the pool, and waits for the resource.
+	require.Eventually(t, func() bool {
+		p.waitMu.Lock()
+		defer p.waitMu.Unlock()
+		return p.paused
+	}, time.Second, time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		p.Close()
+	}()
+	p.Put(r)
+	<-closed
+
+	// The refresh is not restarted once the pool is closed.
+	time.Sleep(30 * time.Millisecond)
+	p.refresh.mu.Lock()
+	defer p.refresh.mu.Unlock()
+	assert.Nil(t, p.refresh.refreshTicker)
+	assert.EqualValues(t, 0, count.Get())
+}
+
+func TestReopenDrainTimeout(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	saveTimeout := reopenDrainTimeout
+	reopenDrainTimeout = 10 * time.Millisecond
+	defer func() { reopenDrainTimeout = saveTimeout }()
+	var refreshes sync2.AtomicInt64
+	refreshCheck := func() (bool, error) {
+		return refreshes.Add(1) == 1, nil
+	}
+	p := NewResourcePool(PoolFactory, 2, 2, 0, 0, logWait, refreshCheck, 10*time.Millisecond)
+	defer p.Close()
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// The drain gives up on the resource in use, and the pool is usable
+	// again.
+	require.Eventually(t, func() bool { return refreshes.Get() > 1 }, time.Second, time.Millisecond)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r2)
+	p.Put(r)
+	assert.EqualValues(t, 2, p.Available())
+}
+
 func TestIdleTimeout(t *testing.T) {
 	ctx := context.Background()
 	lastID.Set(0)
@@ -437,6 +564,42 @@ func TestIdleTimeout(t *testing.T) {
 	assert.EqualValues(t, 2, p.IdleClosed())
 }
 
+func TestIdleTimeoutFakeClock(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	// The idle timer doesn't fire during the test, the sweeps are run
+	// by hand.
+	p := NewResourcePool(PoolFactory, 1, 1, time.Hour, 0, logWait, nil, 0)
+	defer p.Close()
+	clock := NewFakeClock(time.Now())
+	p.SetClock(clock)
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	clock.Advance(59 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 0, p.IdleClosed())
+
+	clock.Advance(2 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 1, p.IdleClosed())
+	// The idle resource is replaced.
+	assert.EqualValues(t, 2, lastID.Get())
+	assert.EqualValues(t, 1, count.Get())
+
+	// The resource is used again, so it's not idle anymore.
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	clock.Advance(2 * time.Hour)
+	p.Put(r)
+	clock.Advance(30 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 1, p.IdleClosed())
+	assert.EqualValues(t, 2, lastID.Get())
+}
+
 func TestIdleTimeoutCreateFail(t *testing.T) {
 	ctx := context.Background()
 	lastID.Set(0)
@@ -454,6 +617,217 @@ func TestIdleTimeoutCreateFail(t *testing.T) {
 	assert.Zero(t, p.Active())
 }
 
+func TestPutWithIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 2, 2, time.Hour, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r1, err := p.Get(ctx)
+	require.NoError(t, err)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r1)
+	p.PutWithIdleTimeout(r2, 10*time.Millisecond)
+
+	// Only the resource put back with the short idle timeout is closed,
+	// and its replacement gets the idle timeout of the pool.
+	require.Eventually(t, func() bool { return p.IdleClosed() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	assert.EqualValues(t, 1, p.IdleClosed())
+	assert.EqualValues(t, 3, lastID.Get())
+	assert.EqualValues(t, 2, count.Get())
+}
+
+func TestMaxIdleCloses(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	// The sweeper is driven by hand: its interval is longer than the test.
+	p := NewTypedResourcePool(TypedPoolFactory, 5, 5, time.Hour, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	p.SetLIFO(true)
+	p.SetMaxIdleCloses(2)
+
+	var resources []*TestResource
+	for i := 0; i < 5; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources = append(resources, r)
+	}
+	for _, r := range resources {
+		p.Put(r)
+	}
+	p.idleTimeout.Set(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// The idle resources are closed a few at a time, the least recently
+	// used first.
+	p.closeIdleResources()
+	assert.EqualValues(t, 3, count.Get())
+	assert.EqualValues(t, 2, p.IdleClosed())
+	assert.True(t, resources[0].closed)
+	assert.True(t, resources[1].closed)
+	assert.False(t, resources[2].closed)
+	p.closeIdleResources()
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 4, p.IdleClosed())
+
+	// 0 means that there is no limit.
+	p.SetMaxIdleCloses(0)
+	for i := 0; i < 3; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources[i] = r
+	}
+	for _, r := range resources[:3] {
+		p.Put(r)
+	}
+	time.Sleep(5 * time.Millisecond)
+	p.closeIdleResources()
+	assert.EqualValues(t, 0, count.Get())
+	assert.EqualValues(t, 7, p.IdleClosed())
+	assert.EqualValues(t, 5, p.Available())
+}
+
+func TestIdleCloseJitter(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 5, 5, time.Hour, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	p.SetLIFO(true)
+	p.SetIdleCloseJitter(time.Hour)
+
+	var resources []*TestResource
+	for i := 0; i < 5; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources = append(resources, r)
+	}
+	for _, r := range resources {
+		p.Put(r)
+	}
+
+	// Every resource gets its own jitter.
+	jitters := map[time.Duration]bool{}
+	for _, wrapper := range p.idle {
+		assert.GreaterOrEqual(t, wrapper.idleJitter, time.Duration(0))
+		assert.Less(t, wrapper.idleJitter, time.Hour)
+		jitters[wrapper.idleJitter] = true
+	}
+	assert.Greater(t, len(jitters), 1)
+
+	// The jitter extends the idle timeout.
+	p.idleTimeout.Set(time.Millisecond)
+	p.idle[0].idleJitter = time.Hour
+	p.idle[1].idleJitter = 0
+	time.Sleep(5 * time.Millisecond)
+	p.closeIdleResources()
+	assert.False(t, resources[0].closed)
+	assert.True(t, resources[1].closed)
+	assert.EqualValues(t, 1, p.IdleClosed())
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	var failing sync2.AtomicBool
+	var attempts sync2.AtomicInt64
+	factory := func(ctx context.Context) (*TestResource, error) {
+		attempts.Add(1)
+		if failing.Get() {
+			return nil, errors.New("Failed")
+		}
+		return TypedPoolFactory(ctx)
+	}
+	p := NewTypedResourcePool(factory, 2, 2, 0, 0, 0, logWait, nil, 0)
+	p.repairMinBackoff, p.repairMaxBackoff = time.Millisecond, 4*time.Millisecond
+	defer p.Close()
+
+	r1, err := p.Get(ctx)
+	require.NoError(t, err)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r2)
+
+	// The slot is emptied when the resource can't be reopened...
+	failing.Set(true)
+	r1.Close()
+	p.Put(nil)
+	assert.EqualValues(t, 1, p.Active())
+
+	// ...and refilled in the background once the factory recovers.
+	require.Eventually(t, func() bool { return attempts.Get() >= 5 }, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, p.Active())
+	failing.Set(false)
+	require.Eventually(t, func() bool { return p.Active() == 2 }, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, p.Repaired())
+	assert.EqualValues(t, 2, count.Get())
+	assert.EqualValues(t, 2, p.Available())
+	require.Eventually(t, func() bool { return !p.repairing.Get() }, time.Second, time.Millisecond)
+}
+
+func TestMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	// The idle timer doesn't fire during the test, the sweeps are run
+	// by hand.
+	p := NewTypedResourcePoolWithOptions(PoolFactory, 1, 1, 0, 0, logWait, nil, 0, ResourcePoolOptions{MaxLifetime: time.Hour})
+	defer p.Close()
+	clock := NewFakeClock(time.Now())
+	p.SetClock(clock)
+	assert.Equal(t, time.Hour, p.MaxLifetime())
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	assert.EqualValues(t, 1, lastID.Get())
+	assert.EqualValues(t, 0, p.MaxLifetimeClosed())
+
+	// A resource that outlived the max lifetime is replaced when it's put
+	// back, even if it's in use while the sweeper runs.
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	clock.Advance(61 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 1, lastID.Get())
+	p.Put(r)
+	assert.True(t, r.(*TestResource).closed)
+	assert.EqualValues(t, 2, lastID.Get())
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 1, p.MaxLifetimeClosed())
+
+	// An unused resource is replaced by the sweeper.
+	clock.Advance(59 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 2, lastID.Get())
+	clock.Advance(2 * time.Minute)
+	p.closeIdleResources()
+	assert.EqualValues(t, 3, lastID.Get())
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 2, p.MaxLifetimeClosed())
+
+	// An expired resource is not handed out, even before a sweep.
+	clock.Advance(61 * time.Minute)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, r.(*TestResource).num)
+	assert.EqualValues(t, 3, p.MaxLifetimeClosed())
+
+	// The resources put back as nil are forgotten by the sweeper.
+	r.Close()
+	p.Put(nil)
+	assert.Len(t, p.lifetimes.created, 1)
+	clock.Advance(61 * time.Minute)
+	p.closeIdleResources()
+	assert.Empty(t, p.lifetimes.created)
+	assert.Zero(t, p.IdleClosed())
+}
+
 func TestCreateFail(t *testing.T) {
 	ctx := context.Background()
 	lastID.Set(0)
@@ -463,9 +837,11 @@ func TestCreateFail(t *testing.T) {
 	if _, err := p.Get(ctx); err.Error() != "Failed" {
 		t.Errorf("Expecting Failed, received %v", err)
 	}
-	stats := p.StatsJSON()
-	expected := `{"Capacity": 5, "Available": 5, "Active": 0, "InUse": 0, "MaxCapacity": 5, "WaitCount": 0, "WaitTime": 0, "IdleTimeout": 1000000000, "IdleClosed": 0, "Exhausted": 0}`
-	assert.Equal(t, expected, stats)
+	stats := p.Stats()
+	assert.WithinDuration(t, time.Now(), stats.LastDialErrorTime, time.Second)
+	assert.Zero(t, stats.LastDialSuccessTime)
+	expected := Stats{Capacity: 5, Available: 5, Active: 0, InUse: 0, MaxCapacity: 5, WaitCount: 0, WaitTime: 0, IdleTimeout: time.Second, IdleClosed: 0, Exhausted: 0, DialErrors: 1, RecentDialErrors: 1, LastDialError: "Failed"}
+	assert.Equal(t, expected, poolStats(p))
 }
 
 func TestCreateFailOnPut(t *testing.T) {
@@ -529,3 +905,677 @@ func TestExpired(t *testing.T) {
 	cancel()
 	assert.EqualError(t, err, "resource pool context already expired")
 }
+
+func TypedPoolFactory(ctx context.Context) (*TestResource, error) {
+	count.Add(1)
+	return &TestResource{lastID.Add(1), false}, nil
+}
+
+func TestTypedResourcePool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, time.Second, 0, 0, nil, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+	p.Put(r)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+
+	// A nil Put of the resource type causes the resource to be reopened.
+	r.Close()
+	p.Put(nil)
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 2, lastID.Get())
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	p.Put(r)
+	assert.EqualValues(t, 1, p.Available())
+	assert.EqualValues(t, 1, p.Active())
+
+	newctx, cancel := context.WithDeadline(ctx, time.Now().Add(-1*time.Second))
+	defer cancel()
+	r, err = p.Get(newctx)
+	assert.EqualError(t, err, "resource pool context already expired")
+	assert.Nil(t, r)
+}
+
+func TestPutIntoFullPool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	assert.Panics(t, func() { p.Put(r) })
+
+	// With a freelist, a resource that doesn't come from the pool, e.g.
+	// because it's put back twice, is closed instead of overfilling it.
+	p.SetFreelist(true)
+	extra := &TestResource{num: 100}
+	p.Put(extra)
+	assert.True(t, extra.closed)
+	p.Put(nil)
+	assert.EqualValues(t, 2, p.ExtraClosed())
+	assert.False(t, r.closed)
+	assert.EqualValues(t, 1, p.Available())
+	assert.EqualValues(t, 0, p.InUse())
+}
+
+func TestCheckFunc(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	var failing sync2.AtomicInt64
+	check := func(r *TestResource) error {
+		if r.num == failing.Get() {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+
+	// The unhealthy resource is replaced on Get.
+	p.SetCheckFunc(check, 0)
+	failing.Set(1)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	assert.EqualValues(t, 1, p.CheckFailed())
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 1, p.Active())
+	p.Put(r)
+
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	p.Put(r)
+
+	// A resource used recently isn't checked.
+	p.SetCheckFunc(check, time.Hour)
+	failing.Set(2)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	assert.EqualValues(t, 1, p.CheckFailed())
+	p.Put(r)
+
+	// Without a check, nothing is checked.
+	p.SetCheckFunc(nil, 0)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	p.Put(r)
+}
+
+func TestCheckFuncIdle(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 100*time.Millisecond, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+
+	// The sweeper replaces the unhealthy resource.
+	p.SetCheckFunc(func(r *TestResource) error {
+		if r.num == 1 {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}, 0)
+	time.Sleep(30 * time.Millisecond)
+	assert.EqualValues(t, 2, lastID.Get())
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 1, p.CheckFailed())
+	assert.Zero(t, p.IdleClosed())
+
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r.num)
+	p.Put(r)
+}
+
+func TestLIFO(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 3, 3, 50*time.Millisecond, 0, 0, logWait, nil, 0)
+
+	getAll := func() (resources []*TestResource) {
+		for i := 0; i < 3; i++ {
+			r, err := p.Get(ctx)
+			require.NoError(t, err)
+			resources = append(resources, r)
+		}
+		return resources
+	}
+	for _, r := range getAll() {
+		p.Put(r)
+	}
+
+	// FIFO returns the least recently used resource.
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+	p.Put(r)
+
+	// LIFO returns the most recently used resource.
+	p.SetLIFO(true)
+	resources := getAll()
+	for _, r := range resources {
+		p.Put(r)
+	}
+	for i := 0; i < 3; i++ {
+		r, err = p.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, resources[2], r)
+		p.Put(r)
+	}
+	assert.EqualValues(t, 3, lastID.Get())
+
+	// The resources that are not used anymore are closed, and not
+	// replaced.
+	for i := 0; i < 10; i++ {
+		r, err = p.Get(ctx)
+		require.NoError(t, err)
+		p.Put(r)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.EqualValues(t, 3, lastID.Get())
+	assert.EqualValues(t, 1, count.Get())
+	assert.EqualValues(t, 1, p.Active())
+	assert.EqualValues(t, 2, p.IdleClosed())
+	assert.EqualValues(t, 3, p.Available())
+
+	// A nil Put doesn't reopen the resource either.
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	r.Close()
+	p.Put(nil)
+	assert.EqualValues(t, 3, lastID.Get())
+	assert.EqualValues(t, 0, p.Active())
+
+	for _, r := range getAll() {
+		p.Put(r)
+	}
+	assert.EqualValues(t, 3, p.Active())
+	p.Close()
+	assert.EqualValues(t, 0, count.Get())
+	assert.EqualValues(t, 0, p.Active())
+}
+
+func TestFairWaiters(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	waiters := func() int {
+		p.waitMu.Lock()
+		defer p.waitMu.Unlock()
+		return len(p.waiters)
+	}
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// The waiters are served in order of arrival.
+	order := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		ctx := ctx
+		if i == 2 {
+			// This one gives up while waiting.
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+		}
+		go func(i int) {
+			r, err := p.Get(ctx)
+			if err != nil {
+				assert.Equal(t, ErrTimeout, err)
+				order <- -1
+				return
+			}
+			order <- i
+			p.Put(r)
+		}(i)
+		require.Eventually(t, func() bool { return waiters() == i+1 }, time.Second, time.Millisecond)
+	}
+	assert.Equal(t, -1, <-order)
+	assert.Equal(t, 4, waiters())
+	p.Put(r)
+	for _, want := range []int{0, 1, 3, 4} {
+		assert.Equal(t, want, <-order)
+	}
+	assert.Zero(t, waiters())
+	assert.EqualValues(t, 4, p.WaitCount())
+	assert.EqualValues(t, 1, p.Available())
+}
+
+func TestPriorityWaiters(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// The waiters are served by priority, then in order of arrival.
+	priorities := []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal, PriorityHigh}
+	order := make(chan int, len(priorities))
+	for i, priority := range priorities {
+		go func(i int, ctx context.Context) {
+			r, err := p.Get(ctx)
+			assert.NoError(t, err)
+			order <- i
+			p.Put(r)
+		}(i, WithPriority(ctx, priority))
+		require.Eventually(t, func() bool { return p.Waiters() == int64(i+1) }, time.Second, time.Millisecond)
+	}
+	p.Put(r)
+	for _, want := range []int{2, 4, 1, 3, 0} {
+		assert.Equal(t, want, <-order)
+	}
+
+	// The low priority callers are shed after the max wait.
+	p.SetLowPriorityMaxWait(10 * time.Millisecond)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	_, err = p.Get(WithPriority(ctx, PriorityLow))
+	assert.Equal(t, ErrTimeout, err)
+	assert.EqualValues(t, 1, p.Shed())
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = p.Get(timeoutCtx)
+	assert.Equal(t, ErrTimeout, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.EqualValues(t, 1, p.Shed())
+	p.Put(r)
+}
+
+func TestWaitersClosed(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	waiters := func() int {
+		p.waitMu.Lock()
+		defer p.waitMu.Unlock()
+		return len(p.waiters)
+	}
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+
+	// Close waits in line for the resource, and the callers behind it
+	// get ErrClosed.
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	require.Eventually(t, func() bool { return waiters() == 1 }, time.Second, time.Millisecond)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx)
+		errs <- err
+	}()
+	require.Eventually(t, func() bool { return waiters() == 2 }, time.Second, time.Millisecond)
+
+	p.Put(r)
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("the waiter was not woken up")
+	}
+	<-closed
+	assert.EqualValues(t, 0, count.Get())
+}
+
+func TestDrain(t *testing.T) {
+	for _, lifo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lifo=%v", lifo), func(t *testing.T) {
+			ctx := context.Background()
+			lastID.Set(0)
+			count.Set(0)
+			p := NewTypedResourcePool(TypedPoolFactory, 2, 2, 0, 0, 0, logWait, nil, 0)
+			defer p.Close()
+			p.SetLIFO(lifo)
+
+			r1, err := p.Get(ctx)
+			require.NoError(t, err)
+			r2, err := p.Get(ctx)
+			require.NoError(t, err)
+			p.Put(r2)
+
+			// Drain waits for the taken resource, and the callers of Get
+			// wait for the drain.
+			drained := make(chan error, 1)
+			go func() {
+				drained <- p.Drain(ctx)
+			}()
+			require.Eventually(t, func() bool {
+				p.waitMu.Lock()
+				defer p.waitMu.Unlock()
+				return p.paused
+			}, time.Second, time.Millisecond)
+			got := make(chan *TestResource, 1)
+			go func() {
+				r, err := p.Get(ctx)
+				if assert.NoError(t, err) {
+					got <- r
+				}
+			}()
+			require.Eventually(t, func() bool { return p.Waiters() == 1 }, time.Second, time.Millisecond)
+
+			p.Put(r1)
+			require.NoError(t, <-drained)
+			r := <-got
+			assert.EqualValues(t, 3, r.num)
+			assert.EqualValues(t, 1, count.Get())
+			assert.EqualValues(t, 1, p.Active())
+			assert.EqualValues(t, 2, p.Capacity())
+			p.Put(r)
+
+			// A drain that times out closes the unused resources only.
+			r, err = p.Get(ctx)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			assert.Equal(t, context.DeadlineExceeded, p.Drain(ctx))
+			assert.EqualValues(t, 1, count.Get())
+			assert.EqualValues(t, 1, p.Active())
+			p.Put(r)
+			assert.EqualValues(t, 2, p.Available())
+		})
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	for _, lifo := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lifo=%v", lifo), func(t *testing.T) {
+			ctx := context.Background()
+			lastID.Set(0)
+			count.Set(0)
+			p := NewTypedResourcePool(TypedPoolFactory, 3, 3, 0, 0, 0, logWait, nil, 0)
+			defer p.Close()
+			p.SetLIFO(lifo)
+
+			var resources []*TestResource
+			for i := 0; i < 3; i++ {
+				r, err := p.Get(ctx)
+				require.NoError(t, err)
+				resources = append(resources, r)
+			}
+			for _, i := range []int{1, 0, 2} {
+				p.Put(resources[i])
+				time.Sleep(time.Millisecond)
+			}
+			assert.Zero(t, p.EvictIdle(0))
+
+			// The least recently used resources are closed first.
+			assert.Equal(t, 2, p.EvictIdle(2))
+			assert.True(t, resources[1].closed)
+			assert.True(t, resources[0].closed)
+			assert.False(t, resources[2].closed)
+			assert.EqualValues(t, 1, p.Active())
+			assert.EqualValues(t, 1, count.Get())
+			assert.EqualValues(t, 3, p.Available())
+
+			assert.Equal(t, 1, p.EvictIdle(5))
+			assert.Zero(t, p.Active())
+			r, err := p.Get(ctx)
+			require.NoError(t, err)
+			assert.EqualValues(t, 4, r.num)
+			p.Put(r)
+		})
+	}
+}
+
+func TestSetMaxCap(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 2, 2, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+
+	assert.Error(t, p.SetCapacity(4))
+	assert.Error(t, p.SetMaxCap(1))
+	require.NoError(t, p.SetMaxCap(4))
+	assert.EqualValues(t, 4, p.MaxCap())
+
+	// The pool grows and keeps its resources, including the one that is
+	// taken.
+	require.NoError(t, p.SetCapacity(4))
+	assert.EqualValues(t, 4, p.Available()+p.InUse())
+	p.Put(r)
+	var resources []*TestResource
+	for i := 0; i < 4; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources = append(resources, r)
+	}
+	assert.EqualValues(t, 4, lastID.Get())
+	assert.EqualValues(t, 4, count.Get())
+	for _, r := range resources {
+		p.Put(r)
+	}
+
+	// A closed pool stays closed until it's reopened.
+	require.NoError(t, p.SetCapacity(0))
+	require.NoError(t, p.SetMaxCap(5))
+	_, err = p.Get(ctx)
+	assert.Equal(t, ErrClosed, err)
+	require.NoError(t, p.SetCapacity(5))
+	assert.EqualValues(t, 5, p.Available())
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+}
+
+func TestMaxConcurrentDials(t *testing.T) {
+	ctx := context.Background()
+	var dialing, maxDialing sync2.AtomicInt64
+	release := make(chan struct{})
+	factory := func(context.Context) (*TestResource, error) {
+		n := dialing.Add(1)
+		defer dialing.Add(-1)
+		for {
+			m := maxDialing.Get()
+			if n <= m || maxDialing.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		return &TestResource{}, nil
+	}
+	p := NewTypedResourcePool(factory, 5, 5, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	p.SetMaxConcurrentDials(2)
+
+	done := make(chan *TestResource)
+	for i := 0; i < 4; i++ {
+		go func() {
+			r, err := p.Get(ctx)
+			assert.NoError(t, err)
+			done <- r
+		}()
+	}
+	require.Eventually(t, func() bool { return dialing.Get() == 2 }, time.Second, time.Millisecond)
+
+	// A caller that can't wait for its turn gives up, and frees its
+	// slot.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := p.Get(tctx)
+	assert.Equal(t, ErrTimeout, err)
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		p.Put(<-done)
+	}
+	assert.EqualValues(t, 2, maxDialing.Get())
+	assert.EqualValues(t, 4, p.Active())
+	assert.EqualValues(t, 5, p.Available())
+}
+
+func TestDialCancel(t *testing.T) {
+	ctx := context.Background()
+	count.Set(0)
+	release := make(chan struct{})
+	// The factory ignores its ctx.
+	factory := func(context.Context) (*TestResource, error) {
+		<-release
+		count.Add(1)
+		return &TestResource{}, nil
+	}
+	p := NewTypedResourcePool(factory, 1, 1, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	p.SetMaxConcurrentDials(1)
+
+	// The caller gets its slot back as soon as its ctx is done.
+	tctx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := p.Get(tctx)
+	assert.Equal(t, ErrTimeout, err)
+	assert.EqualValues(t, 1, p.Available())
+	assert.Zero(t, p.Active())
+
+	// The resource that is dialed anyway is closed, and the next dial
+	// waits for it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r, err := p.Get(ctx)
+		if assert.NoError(t, err) {
+			p.Put(r)
+		}
+	}()
+	close(release)
+	<-done
+	require.Eventually(t, func() bool { return count.Get() == 1 }, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, p.Active())
+}
+
+func TestPauseResume(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 2, 2, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r1, err := p.Get(ctx)
+	require.NoError(t, err)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r2)
+
+	// While paused, nothing is handed out, and the resources put back
+	// stay in the pool.
+	p.Pause()
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(tctx)
+	assert.Equal(t, ErrTimeout, err)
+	got := make(chan *TestResource, 1)
+	go func() {
+		r, err := p.Get(ctx)
+		if assert.NoError(t, err) {
+			got <- r
+		}
+	}()
+	require.Eventually(t, func() bool { return p.Waiters() == 1 }, time.Second, time.Millisecond)
+	p.Put(r1)
+	assert.EqualValues(t, 2, p.Available())
+	assert.EqualValues(t, 1, p.Waiters())
+
+	// Flush closes the unused resources, and keeps their slots.
+	p.Flush()
+	assert.EqualValues(t, 0, count.Get())
+	assert.EqualValues(t, 0, p.Active())
+	assert.EqualValues(t, 2, p.Available())
+
+	// Resume hands the slots over to the waiters.
+	p.Resume()
+	r := <-got
+	assert.EqualValues(t, 3, r.num)
+	assert.EqualValues(t, 0, p.Waiters())
+	p.Put(r)
+
+	// A paused pool can be closed.
+	p.Pause()
+	p.Close()
+	_, err = p.Get(ctx)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestReusePolicy(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 2, 2, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+	assert.Equal(t, ReuseLRU, p.ReusePolicy())
+
+	getBoth := func() {
+		a, err := p.Get(ctx)
+		require.NoError(t, err)
+		b, err := p.Get(ctx)
+		require.NoError(t, err)
+		p.Put(a)
+		p.Put(b)
+	}
+	getBoth()
+	r, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r.num)
+	p.Put(r)
+
+	p.SetReusePolicy(ReuseMRU)
+	assert.Equal(t, ReuseMRU, p.ReusePolicy())
+	getBoth()
+	r, err = p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, r, r2)
+	p.Put(r2)
+
+	for name, want := range map[string]ReusePolicy{"": ReuseLRU, "lru": ReuseLRU, "MRU": ReuseMRU} {
+		policy, err := ParseReusePolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, policy)
+	}
+	_, err = ParseReusePolicy("fifo")
+	assert.EqualError(t, err, `invalid reuse policy: "fifo"`)
+}
@@ -18,6 +18,7 @@ package pools
 
 import (
 	"context"
+	"runtime"
 	"strconv"
 	"testing"
 )
@@ -25,10 +26,9 @@ import (
 func BenchmarkGetPut(b *testing.B) {
 	for _, size := range []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024} {
 		parallelism := (size + 1) / 2
-		var pool IResourcePool
-		for _, f := range []func(int, int) IResourcePool{getResourcePool} {
-			pool = f(size, parallelism)
-			b.Run(pool.Name()+"size="+strconv.Itoa(size), func(b *testing.B) {
+		for _, bp := range benchPools {
+			pool := bp.new(size, parallelism)
+			b.Run(bp.name+"size="+strconv.Itoa(size), func(b *testing.B) {
 				for i := 0; i < b.N; i++ {
 					ctx := context.Background()
 					if _, err := pool.Get(ctx); err != nil {
@@ -42,10 +42,54 @@ func BenchmarkGetPut(b *testing.B) {
 	}
 }
 
+// BenchmarkGetPutParallel measures the contention on the pool when all
+// the CPUs use it.
+func BenchmarkGetPutParallel(b *testing.B) {
+	for _, size := range []int{16, 64, 256, 1024} {
+		for _, bp := range benchPools {
+			pool := bp.new(size, size)
+			b.Run(bp.name+"size="+strconv.Itoa(size), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					ctx := context.Background()
+					for pb.Next() {
+						r, err := pool.Get(ctx)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						pool.Put(r)
+					}
+				})
+			})
+			pool.Close()
+		}
+	}
+}
+
+// benchPools are the pools the benchmarks compare.
+var benchPools = []struct {
+	name string
+	new  func(size, parallelism int) IResourcePool
+}{
+	{"ResourcePool", getResourcePool},
+	{"FreelistResourcePool", getFreelistResourcePool},
+	{"ShardedResourcePool", getShardedResourcePool},
+}
+
 func getResourcePool(size, parallelism int) IResourcePool {
 	return NewResourcePool(testResourceFactory, size, size, 0, parallelism, nil, nil, 0)
 }
 
+func getFreelistResourcePool(size, parallelism int) IResourcePool {
+	pool := NewResourcePool(testResourceFactory, size, size, 0, parallelism, nil, nil, 0)
+	pool.SetFreelist(true)
+	return pool
+}
+
+func getShardedResourcePool(size, parallelism int) IResourcePool {
+	return NewShardedResourcePool(testResourceFactory, runtime.GOMAXPROCS(0), size, size, 0, 0, parallelism, nil, nil, 0)
+}
+
 func testResourceFactory(context.Context) (Resource, error) {
 	return &TestResource{}, nil
 }
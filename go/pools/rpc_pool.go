@@ -32,7 +32,7 @@ import (
 // one method of acquisition, Acquire(context.Context), which always uses the
 // lower of the pool-global timeout or the context deadline.
 type RPCPool struct {
-	rp          IResourcePool
+	rp          *ResourcePool[*_rpc]
 	waitTimeout time.Duration
 }
 
@@ -44,7 +44,7 @@ type RPCPool struct {
 // will not be called).
 func NewRPCPool(size int, waitTimeout time.Duration, logWait func(time.Time)) *RPCPool {
 	return &RPCPool{
-		rp:          NewResourcePool(rpcResourceFactory, size, size, 0, size, logWait, nil, 0),
+		rp:          NewTypedResourcePool(rpcResourceFactory, size, size, 0, 0, size, logWait, nil, 0),
 		waitTimeout: waitTimeout,
 	}
 }
@@ -90,4 +90,4 @@ func (*_rpc) Close() {}
 
 // we only ever return the same rpc pointer. it's used as a sentinel and is
 // only used internally so using the same one over and over doesn't matter.
-func rpcResourceFactory(ctx context.Context) (Resource, error) { return rpc, nil }
+func rpcResourceFactory(ctx context.Context) (*_rpc, error) { return rpc, nil }
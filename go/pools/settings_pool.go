@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"time"
+
+	"vitess.io/vitess/go/sync2"
+)
+
+type (
+	// Setting is a set of session settings, e.g. system variables. The
+	// pool only uses its fingerprint, which is opaque to it: resources
+	// that have settings with the same fingerprint are interchangeable.
+	// Query and ResetQuery are for the resources to apply the settings
+	// and to restore the defaults.
+	Setting struct {
+		Fingerprint string
+		Query       string
+		ResetQuery  string
+	}
+
+	// SettingsResource is a resource whose session settings can be
+	// changed.
+	SettingsResource interface {
+		Resource
+		// Setting returns the setting applied to the resource, or nil
+		// if it has the default settings.
+		Setting() *Setting
+		// ApplySetting applies the setting to the resource.
+		ApplySetting(ctx context.Context, setting *Setting) error
+		// ResetSetting restores the default settings of the resource.
+		ResetSetting(ctx context.Context) error
+	}
+
+	// SettingsPool is a ResourcePool of resources that can have
+	// different settings. Its unused resources are kept by setting, so
+	// Get returns a resource that already has the requested setting
+	// when there is one, and otherwise applies it to another resource.
+	// A SettingsPool is always in LIFO mode.
+	SettingsPool[T SettingsResource] struct {
+		// stats. Atomic fields must remain at the top in order to prevent panics on certain architectures.
+		settingMatched sync2.AtomicInt64
+		settingApplied sync2.AtomicInt64
+		settingReset   sync2.AtomicInt64
+
+		*ResourcePool[T]
+	}
+)
+
+// NewSettingsPool creates a new SettingsPool. The arguments are the
+// same as for NewTypedResourcePool.
+func NewSettingsPool[T SettingsResource](factory TypedFactory[T], capacity, maxCap int, idleTimeout, maxLifetime time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration) *SettingsPool[T] {
+	return NewSettingsPoolWithOptions(factory, capacity, maxCap, idleTimeout, prefillParallelism, logWait, refreshCheck, refreshInterval, ResourcePoolOptions{MaxLifetime: maxLifetime})
+}
+
+// NewSettingsPoolWithOptions creates a new SettingsPool. The arguments
+// are the same as for NewTypedResourcePoolWithOptions.
+func NewSettingsPoolWithOptions[T SettingsResource](factory TypedFactory[T], capacity, maxCap int, idleTimeout time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration, opts ResourcePoolOptions) *SettingsPool[T] {
+	rp := NewTypedResourcePoolWithOptions(factory, capacity, maxCap, idleTimeout, prefillParallelism, logWait, refreshCheck, refreshInterval, opts)
+	rp.SetLIFO(true)
+	return &SettingsPool[T]{ResourcePool: rp}
+}
+
+// Get returns a resource that has the setting, or the default settings
+// if setting is nil. It prefers an unused resource that already has the
+// setting. Otherwise, it resets the setting of the resource it gets, and
+// applies the requested one.
+func (sp *SettingsPool[T]) Get(ctx context.Context, setting *Setting) (resource T, err error) {
+	resource, err = sp.ResourcePool.get(ctx, fingerprint(setting))
+	if err != nil {
+		return resource, err
+	}
+	sp.leaks.checkout(ctx, resource, 1)
+	sp.histograms.checkout(resource)
+	current := resource.Setting()
+	if fingerprint(current) == fingerprint(setting) {
+		if current != nil {
+			sp.settingMatched.Add(1)
+		}
+		return resource, nil
+	}
+	if current != nil {
+		if err := resource.ResetSetting(ctx); err != nil {
+			return sp.discard(resource, err)
+		}
+		sp.settingReset.Add(1)
+	}
+	if setting != nil {
+		if err := resource.ApplySetting(ctx, setting); err != nil {
+			return sp.discard(resource, err)
+		}
+		sp.settingApplied.Add(1)
+	}
+	return resource, nil
+}
+
+// discard closes a resource whose setting could not be changed, and
+// gives its slot back to the pool.
+func (sp *SettingsPool[T]) discard(resource T, err error) (T, error) {
+	resource.Close()
+	sp.observe().ResourceClosed(CloseReasonError)
+	sp.Discard(resource)
+	var zero T
+	return zero, err
+}
+
+// Put returns a resource to the pool, with the setting it has. Like for
+// ResourcePool, a closed resource must be put back as nil, or discarded
+// with Discard.
+func (sp *SettingsPool[T]) Put(resource T) {
+	sp.PutWithIdleTimeout(resource, 0)
+}
+
+// PutWithIdleTimeout returns a resource to the pool like Put, with an
+// idle timeout that overrides the one of the pool for it. See
+// ResourcePool.PutWithIdleTimeout.
+func (sp *SettingsPool[T]) PutWithIdleTimeout(resource T, idleTimeout time.Duration) {
+	if isNil(resource) {
+		sp.ResourcePool.Put(resource)
+		return
+	}
+	sp.noteIdleTimeout(idleTimeout)
+	sp.ResourcePool.put(resource, fingerprint(resource.Setting()), idleTimeout)
+}
+
+// PutWithReason returns a resource to the pool like Put, or closes it
+// and discards it if the reason is PutServerError. See
+// ResourcePool.PutWithReason.
+func (sp *SettingsPool[T]) PutWithReason(resource T, reason PutReason) {
+	if reason != PutServerError || isNil(resource) {
+		sp.Put(resource)
+		return
+	}
+	sp.ResourcePool.PutWithReason(resource, reason)
+}
+
+// SetLIFO does nothing: a SettingsPool is always in LIFO mode, since its
+// unused resources are kept by setting in the LIFO stack.
+func (sp *SettingsPool[T]) SetLIFO(bool) {}
+
+// SetReusePolicy does nothing: a SettingsPool always reuses the most
+// recently used resource that has the setting of the Get.
+func (sp *SettingsPool[T]) SetReusePolicy(ReusePolicy) {}
+
+// SettingMatched returns the number of resources returned by Get that
+// already had the requested setting.
+func (sp *SettingsPool[T]) SettingMatched() int64 {
+	return sp.settingMatched.Get()
+}
+
+// SettingApplied returns the number of settings applied by Get.
+func (sp *SettingsPool[T]) SettingApplied() int64 {
+	return sp.settingApplied.Get()
+}
+
+// SettingReset returns the number of settings reset by Get.
+func (sp *SettingsPool[T]) SettingReset() int64 {
+	return sp.settingReset.Get()
+}
+
+func fingerprint(setting *Setting) string {
+	if setting == nil {
+		return ""
+	}
+	return setting.Fingerprint
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type settingsResource struct {
+	TestResource
+	setting  *Setting
+	applied  int
+	failNext bool
+}
+
+func (sr *settingsResource) Setting() *Setting {
+	return sr.setting
+}
+
+func (sr *settingsResource) ApplySetting(ctx context.Context, setting *Setting) error {
+	if sr.failNext {
+		return errors.New("apply failed")
+	}
+	sr.setting = setting
+	sr.applied++
+	return nil
+}
+
+func (sr *settingsResource) ResetSetting(ctx context.Context) error {
+	sr.setting = nil
+	return nil
+}
+
+func settingsFactory(ctx context.Context) (*settingsResource, error) {
+	count.Add(1)
+	return &settingsResource{TestResource: TestResource{num: lastID.Add(1)}}, nil
+}
+
+func TestSettingsPool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewSettingsPool(settingsFactory, 3, 3, time.Second, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	sqlMode := &Setting{Fingerprint: "sql_mode", Query: "set sql_mode = ''", ResetQuery: "set sql_mode = default"}
+	timeZone := &Setting{Fingerprint: "time_zone", Query: "set time_zone = '+00:00'", ResetQuery: "set time_zone = default"}
+
+	// A new resource gets the setting.
+	r1, err := p.Get(ctx, sqlMode)
+	require.NoError(t, err)
+	assert.Equal(t, sqlMode, r1.Setting())
+	r2, err := p.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Nil(t, r2.Setting())
+	p.Put(r2)
+	p.Put(r1)
+
+	// The resource that has the setting is reused, even if it's not the
+	// most recently used one.
+	r, err := p.Get(ctx, sqlMode)
+	require.NoError(t, err)
+	assert.Equal(t, r1, r)
+	assert.Equal(t, 1, r.applied)
+	p.Put(r)
+	r, err = p.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, r2, r)
+	p.Put(r)
+	assert.EqualValues(t, 1, p.SettingMatched())
+
+	// Another setting is applied to a resource with the default
+	// settings rather than to one that would need a reset.
+	r, err = p.Get(ctx, timeZone)
+	require.NoError(t, err)
+	assert.Equal(t, r2, r)
+	assert.Equal(t, timeZone, r.Setting())
+	p.Put(r)
+	assert.EqualValues(t, 0, p.SettingReset())
+
+	// When there is no such resource, the setting is reset first.
+	r, err = p.Get(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, r2, r)
+	assert.Nil(t, r.Setting())
+	p.Put(r)
+	assert.EqualValues(t, 1, p.SettingReset())
+	assert.EqualValues(t, 2, p.SettingApplied())
+	assert.EqualValues(t, 2, lastID.Get())
+
+	// A resource whose setting can't be applied is closed.
+	r, err = p.Get(ctx, nil)
+	require.NoError(t, err)
+	r.failNext = true
+	p.Put(r)
+	_, err = p.Get(ctx, timeZone)
+	assert.EqualError(t, err, "apply failed")
+	assert.True(t, r.closed)
+	assert.EqualValues(t, 1, p.Active())
+	assert.EqualValues(t, 3, p.Available())
+	assert.EqualValues(t, 1, count.Get())
+
+	// SetLIFO can't turn the LIFO mode off.
+	p.SetLIFO(false)
+	assert.True(t, p.lifo.Get())
+}
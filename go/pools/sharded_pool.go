@@ -0,0 +1,656 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/trace"
+	"vitess.io/vitess/go/vt/log"
+)
+
+type (
+	// ShardedResourcePool is a pool made of several ResourcePools, the
+	// shards, to reduce the contention on the pool when it's used by a
+	// lot of CPUs. Every caller has a home shard, which depends on the
+	// CPU it runs on. Get takes a resource from the home shard if it can,
+	// otherwise it steals one from another shard, and only waits if all
+	// the shards are busy. The capacity is split between the shards.
+	//
+	// ShardedResourcePool[Resource] implements IResourcePool.
+	ShardedResourcePool[T Resource] struct {
+		shards []*poolShard[T]
+
+		// homes holds the indexes of the home shards. Since a
+		// sync.Pool has a cache per CPU, the callers that run on
+		// the same CPU tend to get the same home shard.
+		homes sync.Pool
+		// nextHome is the home shard of the next index homes creates.
+		nextHome sync2.AtomicInt64
+
+		// histograms records the time the resources are held, since
+		// they don't always go back to the shard they came from. The
+		// waits are recorded by the shards.
+		histograms poolHistograms
+
+		// observer holds the observerHolder set by SetObserver. The
+		// shards notify it, except for their capacity changes.
+		observer atomic.Value
+
+		// schedule changes the capacity by time of day, see
+		// SetCapacitySchedule.
+		schedule *capacitySchedule
+
+		// extraClosed counts the resources closed because no shard
+		// had a resource taken for them to go back to.
+		extraClosed sync2.AtomicInt64
+	}
+
+	poolShard[T Resource] struct {
+		// borrowed is the number of resources taken from the shard,
+		// which can be put back in it.
+		borrowed sync2.AtomicInt64
+		// waiting is the number of callers waiting for a resource of
+		// the shard.
+		waiting sync2.AtomicInt64
+		pool    *ResourcePool[T]
+
+		// pad keeps the counters of the shards on separate cache
+		// lines.
+		_ [64]byte
+	}
+)
+
+var _ IResourcePool = (*ShardedResourcePool[Resource])(nil)
+
+// NewShardedResourcePool creates a pool of shards ResourcePools,
+// e.g. one per CPU. The capacity, the max capacity and the prefill
+// parallelism are split between the shards, and the other arguments are
+// the same as for NewTypedResourcePool. There are no more shards than
+// the capacity.
+func NewShardedResourcePool[T Resource](factory TypedFactory[T], shards, capacity, maxCap int, idleTimeout, maxLifetime time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration) *ShardedResourcePool[T] {
+	return NewShardedResourcePoolWithOptions(factory, shards, capacity, maxCap, idleTimeout, prefillParallelism, logWait, refreshCheck, refreshInterval, ResourcePoolOptions{MaxLifetime: maxLifetime})
+}
+
+// NewShardedResourcePoolWithOptions creates a pool of shards
+// ResourcePools, like NewShardedResourcePool, with the optional
+// settings of opts.
+func NewShardedResourcePoolWithOptions[T Resource](factory TypedFactory[T], shards, capacity, maxCap int, idleTimeout time.Duration, prefillParallelism int, logWait func(time.Time), refreshCheck RefreshCheck, refreshInterval time.Duration, opts ResourcePoolOptions) *ShardedResourcePool[T] {
+	if capacity <= 0 || maxCap <= 0 || capacity > maxCap {
+		panic(errors.New("invalid/out of range capacity"))
+	}
+	if shards > capacity {
+		shards = capacity
+	}
+	if shards <= 0 {
+		shards = 1
+	}
+	sp := &ShardedResourcePool[T]{shards: make([]*poolShard[T], shards)}
+	for i := range sp.shards {
+		parallelism := splitCount(prefillParallelism, shards, i)
+		if prefillParallelism > 0 && parallelism == 0 {
+			parallelism = 1
+		}
+		sp.shards[i] = &poolShard[T]{
+			pool: NewTypedResourcePoolWithOptions(factory, splitCount(capacity, shards, i), splitCount(maxCap, shards, i), idleTimeout, parallelism, logWait, refreshCheck, refreshInterval, opts),
+		}
+	}
+	sp.homes.New = func() any {
+		home := int(sp.nextHome.Add(1)-1) % len(sp.shards)
+		return &home
+	}
+	sp.schedule = newCapacitySchedule(sp, time.Now)
+	return sp
+}
+
+// splitCount returns the part of count of the shard i of n.
+func splitCount(count, n, i int) int {
+	part := count / n
+	if i < count%n {
+		part++
+	}
+	return part
+}
+
+// home returns the index of the home shard of the caller.
+func (sp *ShardedResourcePool[T]) home() int {
+	home := sp.homes.Get().(*int)
+	defer sp.homes.Put(home)
+	return *home
+}
+
+// Name returns the name of the pool.
+func (sp *ShardedResourcePool[T]) Name() string {
+	return "ShardedResourcePool"
+}
+
+// Close closes all the shards. Like ResourcePool.Close, it waits for
+// all the resources to be returned.
+func (sp *ShardedResourcePool[T]) Close() {
+	sp.schedule.stop()
+	for _, shard := range sp.shards {
+		shard.pool.Close()
+	}
+}
+
+// Get returns a resource: from the home shard if it has one available,
+// otherwise from another shard. If none has one, Get waits for one in
+// the first shard that is open, starting from the home shard.
+func (sp *ShardedResourcePool[T]) Get(ctx context.Context) (resource T, err error) {
+	span, ctx := trace.NewSpan(ctx, "ShardedResourcePool.Get")
+	span.Annotate("capacity", sp.Capacity())
+	span.Annotate("shards", len(sp.shards))
+	defer span.Finish()
+
+	select {
+	case <-ctx.Done():
+		return resource, ErrCtxTimeout
+	default:
+	}
+
+	home := sp.home()
+	if resource, ok, err := sp.steal(ctx, home); ok {
+		if err == nil {
+			sp.histograms.checkout(resource)
+		}
+		return resource, err
+	}
+	for {
+		shard := sp.openShard(home)
+		if shard == nil {
+			return resource, ErrClosed
+		}
+		// The callers that put a resource back hand it over to the
+		// shards that have waiters, so the shards are checked again
+		// once this one counts as waiting: a resource that was put back
+		// meanwhile is not missed.
+		shard.waiting.Add(1)
+		resource, ok, err := sp.steal(ctx, home)
+		if !ok {
+			resource, err = shard.pool.get(ctx, "")
+			if err == nil {
+				shard.borrowed.Add(1)
+			}
+		}
+		shard.waiting.Add(-1)
+		if err == ErrClosed && sp.Capacity() > 0 {
+			// The shard was shrunk to nothing while waiting.
+			continue
+		}
+		if err == nil {
+			sp.histograms.checkout(resource)
+		}
+		return resource, err
+	}
+}
+
+// steal takes a resource from the first shard that has one available,
+// starting from the home shard. ok is false if there is none.
+func (sp *ShardedResourcePool[T]) steal(ctx context.Context, home int) (resource T, ok bool, err error) {
+	for i := range sp.shards {
+		shard := sp.shards[(home+i)%len(sp.shards)]
+		resource, ok, err = shard.pool.tryGet(ctx)
+		if !ok {
+			continue
+		}
+		if err == nil {
+			shard.borrowed.Add(1)
+		}
+		return resource, true, err
+	}
+	return resource, false, nil
+}
+
+// openShard returns the first shard that has a capacity, starting from
+// the home shard, or nil if the pool is closed.
+func (sp *ShardedResourcePool[T]) openShard(home int) *poolShard[T] {
+	for i := range sp.shards {
+		if shard := sp.shards[(home+i)%len(sp.shards)]; shard.pool.Capacity() > 0 {
+			return shard
+		}
+	}
+	return nil
+}
+
+// Put returns a resource to the pool. The resources are interchangeable,
+// so it doesn't need to go back to the shard it came from: it goes to a
+// shard that has waiters, otherwise to the home shard, or to any shard
+// it can go back to.
+func (sp *ShardedResourcePool[T]) Put(resource T) {
+	sp.PutWithIdleTimeout(resource, 0)
+}
+
+// PutWithIdleTimeout returns a resource to the pool like Put, with an
+// idle timeout that overrides the one of the pool for it. See
+// ResourcePool.PutWithIdleTimeout.
+func (sp *ShardedResourcePool[T]) PutWithIdleTimeout(resource T, idleTimeout time.Duration) {
+	if shard := sp.putShard(resource); shard != nil {
+		shard.pool.PutWithIdleTimeout(resource, idleTimeout)
+	}
+}
+
+// PutWithReason returns a resource to the pool like Put, or closes it
+// and discards it if the reason is PutServerError. See
+// ResourcePool.PutWithReason.
+func (sp *ShardedResourcePool[T]) PutWithReason(resource T, reason PutReason) {
+	if shard := sp.putShard(resource); shard != nil {
+		shard.pool.PutWithReason(resource, reason)
+	}
+}
+
+// putShard returns the shard a resource goes back to, with the slot of
+// one of its borrowed resources claimed. If no shard has a resource
+// taken, the pool is full: putShard panics, or if the shards have a
+// freelist, it closes the resource and returns nil.
+func (sp *ShardedResourcePool[T]) putShard(resource T) *poolShard[T] {
+	if !isNil(resource) {
+		sp.histograms.checkin(resource)
+	}
+	home := sp.home()
+	for i := range sp.shards {
+		if shard := sp.shards[(home+i)%len(sp.shards)]; shard.waiting.Get() > 0 && shard.claim() {
+			return shard
+		}
+	}
+	for i := range sp.shards {
+		if shard := sp.shards[(home+i)%len(sp.shards)]; shard.claim() {
+			return shard
+		}
+	}
+	if !sp.shards[0].pool.freelist.Get() {
+		panic(errors.New("attempt to Put into a full ResourcePool"))
+	}
+	sp.extraClosed.Add(1)
+	log.Errorf("Resource put into a full %s, closing it", sp.Name())
+	if !isNil(resource) {
+		resource.Close()
+	}
+	return nil
+}
+
+// claim reserves the slot of a borrowed resource of the shard, for a
+// resource to be put back. It returns false if the shard has no
+// borrowed resource.
+func (shard *poolShard[T]) claim() bool {
+	for {
+		borrowed := shard.borrowed.Get()
+		if borrowed <= 0 {
+			return false
+		}
+		if shard.borrowed.CompareAndSwap(borrowed, borrowed-1) {
+			return true
+		}
+	}
+}
+
+// SetCapacity changes the capacity of the pool, split between the
+// shards. Like ResourcePool.SetCapacity, it waits for the resources to
+// be returned if the pool shrinks. A SetCapacity of 0 is equivalent to
+// closing the pool.
+func (sp *ShardedResourcePool[T]) SetCapacity(capacity int) error {
+	if capacity < 0 || int64(capacity) > sp.MaxCap() {
+		return fmt.Errorf("capacity %d is out of range", capacity)
+	}
+	oldcap := int(sp.Capacity())
+	for i, shard := range sp.shards {
+		if err := shard.pool.SetCapacity(splitCount(capacity, len(sp.shards), i)); err != nil {
+			return err
+		}
+	}
+	if holder, _ := sp.observer.Load().(observerHolder); holder.observer != nil && oldcap != capacity {
+		holder.observer.CapacityChanged(oldcap, capacity)
+	}
+	return nil
+}
+
+// SetMaxCap raises the max capacity of the pool, split between the
+// shards like the capacity. See ResourcePool.SetMaxCap.
+func (sp *ShardedResourcePool[T]) SetMaxCap(maxCap int) error {
+	if int64(maxCap) < sp.MaxCap() {
+		return fmt.Errorf("max capacity %d is lower than %d", maxCap, sp.MaxCap())
+	}
+	for i, shard := range sp.shards {
+		if err := shard.pool.SetMaxCap(splitCount(maxCap, len(sp.shards), i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pause pauses all the shards. See ResourcePool.Pause.
+func (sp *ShardedResourcePool[T]) Pause() {
+	for _, shard := range sp.shards {
+		shard.pool.Pause()
+	}
+}
+
+// Resume resumes all the shards. See ResourcePool.Resume.
+func (sp *ShardedResourcePool[T]) Resume() {
+	for _, shard := range sp.shards {
+		shard.pool.Resume()
+	}
+}
+
+// Flush closes the unused resources of all the shards. See
+// ResourcePool.Flush.
+func (sp *ShardedResourcePool[T]) Flush() {
+	for _, shard := range sp.shards {
+		shard.pool.Flush()
+	}
+}
+
+// Drain drains all the shards, like ResourcePool.Drain, and returns the
+// first error it got.
+func (sp *ShardedResourcePool[T]) Drain(ctx context.Context) error {
+	var firstErr error
+	for _, shard := range sp.shards {
+		if err := shard.pool.Drain(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// EvictIdle closes up to count unused resources, the least recently
+// used first in each shard, starting with the first shard.
+func (sp *ShardedResourcePool[T]) EvictIdle(count int) (evicted int) {
+	for _, shard := range sp.shards {
+		if evicted >= count {
+			break
+		}
+		evicted += shard.pool.EvictIdle(count - evicted)
+	}
+	return evicted
+}
+
+// SetIdleTimeout sets the idle timeout of all the shards.
+func (sp *ShardedResourcePool[T]) SetIdleTimeout(idleTimeout time.Duration) {
+	for _, shard := range sp.shards {
+		shard.pool.SetIdleTimeout(idleTimeout)
+	}
+}
+
+// SetIdleCloseJitter sets the maximum jitter of the idle timeout of all
+// the shards.
+func (sp *ShardedResourcePool[T]) SetIdleCloseJitter(jitter time.Duration) {
+	for _, shard := range sp.shards {
+		shard.pool.SetIdleCloseJitter(jitter)
+	}
+}
+
+// SetMaxIdleCloses sets the maximum number of idle resources every shard
+// closes every time it is scanned.
+func (sp *ShardedResourcePool[T]) SetMaxIdleCloses(maxCloses int) {
+	for _, shard := range sp.shards {
+		shard.pool.SetMaxIdleCloses(maxCloses)
+	}
+}
+
+// SetCapacitySchedule has the pool change its capacity by time of day,
+// which is split across the shards like for SetCapacity. See
+// ResourcePool.SetCapacitySchedule.
+func (sp *ShardedResourcePool[T]) SetCapacitySchedule(windows []CapacityWindow, transition time.Duration) error {
+	return sp.schedule.set(windows, transition)
+}
+
+// SetMaxConcurrentDials splits the limit of the resources created at the
+// same time across the shards, with at least one per shard.
+func (sp *ShardedResourcePool[T]) SetMaxConcurrentDials(maxDials int) {
+	for i, shard := range sp.shards {
+		shardDials := splitCount(maxDials, len(sp.shards), i)
+		if maxDials > 0 && shardDials == 0 {
+			shardDials = 1
+		}
+		shard.pool.SetMaxConcurrentDials(shardDials)
+	}
+}
+
+// SetLowPriorityMaxWait sets how long the low priority callers wait at
+// most for a resource of a shard.
+func (sp *ShardedResourcePool[T]) SetLowPriorityMaxWait(maxWait time.Duration) {
+	for _, shard := range sp.shards {
+		shard.pool.SetLowPriorityMaxWait(maxWait)
+	}
+}
+
+// SetHistograms sets the histograms in which the pool records the waits
+// for a resource, and the time the resources are held per checkout, like
+// ResourcePool.SetHistograms. The shards record their waits in the same
+// histogram.
+func (sp *ShardedResourcePool[T]) SetHistograms(wait, held *stats.Histogram) {
+	for _, shard := range sp.shards {
+		shard.pool.SetHistograms(wait, nil)
+	}
+	sp.histograms.set(nil, held)
+}
+
+// SetCheckFunc sets the function that checks the health of the
+// resources of all the shards.
+func (sp *ShardedResourcePool[T]) SetCheckFunc(check CheckFunc[T], checkInterval time.Duration) {
+	for _, shard := range sp.shards {
+		shard.pool.SetCheckFunc(check, checkInterval)
+	}
+}
+
+// SetObserver sets the Observer notified of the lifecycle of the
+// resources of all the shards, and of the capacity changes of the pool.
+// A nil observer removes it.
+func (sp *ShardedResourcePool[T]) SetObserver(observer Observer) {
+	sp.observer.Store(observerHolder{observer: observer})
+	var forShards Observer
+	if observer != nil {
+		forShards = shardObserver{observer}
+	}
+	for _, shard := range sp.shards {
+		shard.pool.SetObserver(forShards)
+	}
+}
+
+// shardObserver is the Observer of a shard, which doesn't report the
+// capacity changes of the shard, only those of the whole pool. Nor
+// does it report the exhaustion of the shard, since the callers then
+// take the resources of the other shards.
+type shardObserver struct {
+	Observer
+}
+
+// CapacityChanged is part of the Observer interface.
+func (shardObserver) CapacityChanged(int, int) {}
+
+// PoolExhausted is part of the Observer interface.
+func (shardObserver) PoolExhausted() {}
+
+// PoolRecovered is part of the Observer interface.
+func (shardObserver) PoolRecovered(time.Duration) {}
+
+// SetFreelist sets the store of the unused slots of all the shards. See
+// ResourcePool.SetFreelist.
+func (sp *ShardedResourcePool[T]) SetFreelist(freelist bool) {
+	for _, shard := range sp.shards {
+		shard.pool.SetFreelist(freelist)
+	}
+}
+
+// SetLIFO sets the order in which the shards reuse their resources.
+func (sp *ShardedResourcePool[T]) SetLIFO(lifo bool) {
+	for _, shard := range sp.shards {
+		shard.pool.SetLIFO(lifo)
+	}
+}
+
+// SetReusePolicy sets the order in which the shards reuse their
+// resources.
+func (sp *ShardedResourcePool[T]) SetReusePolicy(policy ReusePolicy) {
+	for _, shard := range sp.shards {
+		shard.pool.SetReusePolicy(policy)
+	}
+}
+
+// WaitForPrefill waits until the prefill of all the shards is done, and
+// returns the first error one of them got.
+func (sp *ShardedResourcePool[T]) WaitForPrefill(ctx context.Context) error {
+	var firstErr error
+	for _, shard := range sp.shards {
+		if err := shard.pool.WaitForPrefill(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats returns the stats of the pool, summed across the shards. The
+// last dial error and success are the latest of the shards.
+func (sp *ShardedResourcePool[T]) Stats() Stats {
+	stats := Stats{Shards: len(sp.shards)}
+	for _, shard := range sp.shards {
+		shardStats := shard.pool.Stats()
+		stats.Capacity += shardStats.Capacity
+		stats.Available += shardStats.Available
+		stats.Active += shardStats.Active
+		stats.InUse += shardStats.InUse
+		stats.MaxCapacity += shardStats.MaxCapacity
+		stats.WaitCount += shardStats.WaitCount
+		stats.WaitTime += shardStats.WaitTime
+		stats.Waiters += shardStats.Waiters
+		stats.IdleClosed += shardStats.IdleClosed
+		stats.Exhausted += shardStats.Exhausted
+		stats.DialErrors += shardStats.DialErrors
+		stats.RecentDialErrors += shardStats.RecentDialErrors
+		if shardStats.LastDialErrorTime.After(stats.LastDialErrorTime) {
+			stats.LastDialError = shardStats.LastDialError
+			stats.LastDialErrorTime = shardStats.LastDialErrorTime
+		}
+		if shardStats.LastDialSuccessTime.After(stats.LastDialSuccessTime) {
+			stats.LastDialSuccessTime = shardStats.LastDialSuccessTime
+		}
+	}
+	stats.IdleTimeout = sp.IdleTimeout()
+	return stats
+}
+
+// StatsJSON returns the stats in JSON format.
+func (sp *ShardedResourcePool[T]) StatsJSON() string {
+	return statsJSON(sp.Stats())
+}
+
+// sum returns the sum of a stat of the shards.
+func (sp *ShardedResourcePool[T]) sum(stat func(*ResourcePool[T]) int64) (total int64) {
+	for _, shard := range sp.shards {
+		total += stat(shard.pool)
+	}
+	return total
+}
+
+// Capacity returns the capacity.
+func (sp *ShardedResourcePool[T]) Capacity() int64 {
+	return sp.sum((*ResourcePool[T]).Capacity)
+}
+
+// Available returns the number of currently unused and available resources.
+func (sp *ShardedResourcePool[T]) Available() int64 {
+	return sp.sum((*ResourcePool[T]).Available)
+}
+
+// Active returns the number of active (i.e. non-nil) resources either in the
+// pool or claimed for use
+func (sp *ShardedResourcePool[T]) Active() int64 {
+	return sp.sum((*ResourcePool[T]).Active)
+}
+
+// InUse returns the number of claimed resources from the pool
+func (sp *ShardedResourcePool[T]) InUse() int64 {
+	return sp.sum((*ResourcePool[T]).InUse)
+}
+
+// MaxCap returns the max capacity.
+func (sp *ShardedResourcePool[T]) MaxCap() int64 {
+	return sp.sum((*ResourcePool[T]).MaxCap)
+}
+
+// WaitCount returns the total number of waits.
+func (sp *ShardedResourcePool[T]) WaitCount() int64 {
+	return sp.sum((*ResourcePool[T]).WaitCount)
+}
+
+// WaitTime returns the total wait time.
+func (sp *ShardedResourcePool[T]) WaitTime() time.Duration {
+	return time.Duration(sp.sum(func(rp *ResourcePool[T]) int64 { return int64(rp.WaitTime()) }))
+}
+
+// Waiters returns the number of callers currently waiting for a
+// resource.
+func (sp *ShardedResourcePool[T]) Waiters() int64 {
+	return sp.sum((*ResourcePool[T]).Waiters)
+}
+
+// IdleTimeout returns the idle timeout.
+func (sp *ShardedResourcePool[T]) IdleTimeout() time.Duration {
+	return sp.shards[0].pool.IdleTimeout()
+}
+
+// IdleClosed returns the count of resources closed due to idle timeout.
+func (sp *ShardedResourcePool[T]) IdleClosed() int64 {
+	return sp.sum((*ResourcePool[T]).IdleClosed)
+}
+
+// MaxLifetime returns the max lifetime of the resources.
+func (sp *ShardedResourcePool[T]) MaxLifetime() time.Duration {
+	return sp.shards[0].pool.MaxLifetime()
+}
+
+// MaxLifetimeClosed returns the count of resources closed because they
+// outlived the max lifetime.
+func (sp *ShardedResourcePool[T]) MaxLifetimeClosed() int64 {
+	return sp.sum((*ResourcePool[T]).MaxLifetimeClosed)
+}
+
+// CheckFailed returns the count of resources closed because they failed
+// the health check.
+func (sp *ShardedResourcePool[T]) CheckFailed() int64 {
+	return sp.sum((*ResourcePool[T]).CheckFailed)
+}
+
+// ExtraClosed returns the number of resources closed because they were
+// put into a full pool with a freelist.
+func (sp *ShardedResourcePool[T]) ExtraClosed() int64 {
+	return sp.extraClosed.Get() + sp.sum((*ResourcePool[T]).ExtraClosed)
+}
+
+// Repaired returns the number of resources opened by the repair loops of
+// the shards.
+func (sp *ShardedResourcePool[T]) Repaired() int64 {
+	return sp.sum((*ResourcePool[T]).Repaired)
+}
+
+// Shed returns the number of low priority callers that gave up waiting
+// after the low priority max wait.
+func (sp *ShardedResourcePool[T]) Shed() int64 {
+	return sp.sum((*ResourcePool[T]).Shed)
+}
+
+// Exhausted returns the number of times Available dropped below 1 in a
+// shard.
+func (sp *ShardedResourcePool[T]) Exhausted() int64 {
+	return sp.sum((*ResourcePool[T]).Exhausted)
+}
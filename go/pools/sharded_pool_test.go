@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedResourcePool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewShardedResourcePool(TypedPoolFactory, 4, 6, 10, time.Second, 0, 0, logWait, nil, 0)
+	assert.Len(t, p.shards, 4)
+	assert.EqualValues(t, 6, p.Capacity())
+	assert.EqualValues(t, 10, p.MaxCap())
+
+	// The resources of the other shards are stolen before waiting.
+	var resources []*TestResource
+	for i := 0; i < 6; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources = append(resources, r)
+	}
+	assert.EqualValues(t, 6, p.InUse())
+	assert.EqualValues(t, 0, p.Available())
+	assert.EqualValues(t, 0, p.WaitCount())
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := p.Get(timeoutCtx)
+	assert.Equal(t, ErrTimeout, err)
+
+	// A waiter gets the resource that is put back, whatever its shard.
+	done := make(chan *TestResource)
+	go func() {
+		r, err := p.Get(ctx)
+		assert.NoError(t, err)
+		done <- r
+	}()
+	for p.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	p.Put(resources[0])
+	resources[0] = <-done
+	assert.EqualValues(t, 1, p.WaitCount())
+
+	for _, r := range resources {
+		p.Put(r)
+	}
+	assert.EqualValues(t, 0, p.InUse())
+	assert.EqualValues(t, 6, p.Available())
+	assert.EqualValues(t, 6, p.Active())
+	assert.EqualValues(t, 6, lastID.Get())
+
+	// The capacity is split between the shards, even when some get
+	// none.
+	require.NoError(t, p.SetCapacity(2))
+	assert.EqualValues(t, 2, p.Capacity())
+	assert.EqualValues(t, 2, count.Get())
+	for i := 0; i < 2; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		resources[i] = r
+	}
+	timeoutCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(timeoutCtx)
+	assert.Equal(t, ErrTimeout, err)
+	p.Put(resources[0])
+	p.Put(resources[1])
+	assert.EqualError(t, p.SetCapacity(11), "capacity 11 is out of range")
+
+	p.Close()
+	assert.EqualValues(t, 0, p.Capacity())
+	assert.EqualValues(t, 0, count.Get())
+	_, err = p.Get(ctx)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestShardedResourcePoolSetMaxCap(t *testing.T) {
+	p := NewShardedResourcePool(TypedPoolFactory, 2, 4, 4, 0, 0, 0, nil, nil, 0)
+	defer p.Close()
+
+	assert.Error(t, p.SetCapacity(6))
+	assert.Error(t, p.SetMaxCap(3))
+	require.NoError(t, p.SetMaxCap(6))
+	require.NoError(t, p.SetCapacity(6))
+	assert.EqualValues(t, 6, p.MaxCap())
+	assert.EqualValues(t, 3, p.shards[0].pool.Capacity())
+	assert.EqualValues(t, 3, p.shards[1].pool.Capacity())
+}
+
+func TestShardedResourcePoolPutIntoFullPool(t *testing.T) {
+	p := NewShardedResourcePool(TypedPoolFactory, 2, 2, 2, 0, 0, 0, nil, nil, 0)
+	defer p.Close()
+
+	r, err := p.Get(context.Background())
+	require.NoError(t, err)
+	p.Put(r)
+	assert.Panics(t, func() { p.Put(r) })
+
+	p.SetFreelist(true)
+	extra := &TestResource{num: 100}
+	p.Put(extra)
+	assert.True(t, extra.closed)
+	assert.False(t, r.closed)
+	assert.EqualValues(t, 1, p.ExtraClosed())
+	assert.EqualValues(t, 2, p.Available())
+}
+
+func TestShardedResourcePoolShards(t *testing.T) {
+	// There are no more shards than the capacity.
+	p := NewShardedResourcePool(TypedPoolFactory, 8, 3, 3, 0, 0, 0, nil, nil, 0)
+	defer p.Close()
+	assert.Len(t, p.shards, 3)
+	assert.Equal(t, `{"Capacity":3,"Available":3,"Active":0,"InUse":0,"MaxCapacity":3,"WaitCount":0,"WaitTime":0,"Waiters":0,"IdleTimeout":0,"IdleClosed":0,"Exhausted":0,"DialErrors":0,"RecentDialErrors":0,"LastDialErrorTime":"0001-01-01T00:00:00Z","LastDialSuccessTime":"0001-01-01T00:00:00Z","Shards":3}`, p.StatsJSON())
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import "errors"
+
+// slotStore holds the unused slots of a ResourcePool, in the order they
+// were returned. It's only used while the waitMu of the pool is held.
+type slotStore[T Resource] interface {
+	// take takes the least recently returned slot. empty is true if
+	// there is none, and ok is false if the store is closed.
+	take() (wrapper resourceWrapper[T], ok, empty bool)
+	// put returns a slot, and returns false if the store is full.
+	put(wrapper resourceWrapper[T]) bool
+	// close closes the store: take then returns ok false.
+	close()
+	// len returns the number of slots in the store.
+	len() int
+}
+
+// newSlotStore returns an empty store for up to maxCap slots: a freelist
+// if freelist is set, otherwise a buffered channel.
+func newSlotStore[T Resource](maxCap int, freelist bool) slotStore[T] {
+	if freelist {
+		return &freelistSlots[T]{buf: make([]resourceWrapper[T], maxCap)}
+	}
+	return make(chanSlots[T], maxCap)
+}
+
+// chanSlots is the original store of the pool, a buffered channel of
+// maxCap slots.
+type chanSlots[T Resource] chan resourceWrapper[T]
+
+func (s chanSlots[T]) take() (wrapper resourceWrapper[T], ok, empty bool) {
+	select {
+	case wrapper, ok = <-s:
+		return wrapper, ok, false
+	default:
+		return wrapper, false, true
+	}
+}
+
+func (s chanSlots[T]) put(wrapper resourceWrapper[T]) bool {
+	select {
+	case s <- wrapper:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s chanSlots[T]) close() {
+	close(s)
+}
+
+func (s chanSlots[T]) len() int {
+	return len(s)
+}
+
+// freelistSlots is a store without a channel: a ring buffer, which grows
+// if needed, so it's never full. Since the pool already holds waitMu, it
+// avoids the synchronization of the channel.
+type freelistSlots[T Resource] struct {
+	buf    []resourceWrapper[T]
+	head   int
+	n      int
+	closed bool
+}
+
+func (s *freelistSlots[T]) take() (wrapper resourceWrapper[T], ok, empty bool) {
+	if s.closed {
+		return wrapper, false, false
+	}
+	if s.n == 0 {
+		return wrapper, false, true
+	}
+	wrapper = s.buf[s.head]
+	s.buf[s.head] = resourceWrapper[T]{}
+	if s.head++; s.head == len(s.buf) {
+		s.head = 0
+	}
+	s.n--
+	return wrapper, true, false
+}
+
+func (s *freelistSlots[T]) put(wrapper resourceWrapper[T]) bool {
+	if s.closed {
+		// Like a send on the closed channel of chanSlots.
+		panic(errors.New("attempt to Put into a closed ResourcePool"))
+	}
+	if s.n == len(s.buf) {
+		size := 2 * len(s.buf)
+		if size == 0 {
+			size = 1
+		}
+		buf := make([]resourceWrapper[T], size)
+		copy(buf, s.buf[s.head:])
+		copy(buf[len(s.buf)-s.head:], s.buf[:s.head])
+		s.buf, s.head = buf, 0
+	}
+	tail := s.head + s.n
+	if tail >= len(s.buf) {
+		tail -= len(s.buf)
+	}
+	s.buf[tail] = wrapper
+	s.n++
+	return true
+}
+
+func (s *freelistSlots[T]) close() {
+	s.closed = true
+	s.buf, s.head, s.n = nil, 0, 0
+}
+
+func (s *freelistSlots[T]) len() int {
+	return s.n
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotStores(t *testing.T) {
+	for _, freelist := range []bool{false, true} {
+		s := newSlotStore[*TestResource](2, freelist)
+		_, _, empty := s.take()
+		assert.True(t, empty)
+
+		// The slots are taken in the order they were put, across the
+		// wraparound of the freelist.
+		for i := int64(1); i <= 2; i++ {
+			require.True(t, s.put(resourceWrapper[*TestResource]{resource: &TestResource{num: i}}))
+		}
+		w, ok, _ := s.take()
+		require.True(t, ok)
+		assert.EqualValues(t, 1, w.resource.num)
+		require.True(t, s.put(resourceWrapper[*TestResource]{resource: &TestResource{num: 3}}))
+		if freelist {
+			// The freelist grows instead of being full.
+			assert.True(t, s.put(resourceWrapper[*TestResource]{resource: &TestResource{num: 4}}))
+		} else {
+			assert.False(t, s.put(resourceWrapper[*TestResource]{}))
+		}
+		for i := int64(2); i <= 3; i++ {
+			w, ok, _ = s.take()
+			require.True(t, ok)
+			assert.EqualValues(t, i, w.resource.num)
+		}
+
+		s.close()
+		_, ok, empty = s.take()
+		assert.False(t, ok)
+		assert.False(t, empty)
+	}
+}
+
+func TestSetFreelist(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	p := NewTypedResourcePool(TypedPoolFactory, 3, 3, 0, 0, 0, logWait, nil, 0)
+	defer p.Close()
+
+	r1, err := p.Get(ctx)
+	require.NoError(t, err)
+	r2, err := p.Get(ctx)
+	require.NoError(t, err)
+	p.Put(r1)
+
+	// The pool keeps its slots and its resources when the store is
+	// replaced.
+	p.SetFreelist(true)
+	assert.EqualValues(t, 2, p.Available())
+	p.Put(r2)
+	for i := 0; i < 3; i++ {
+		r, err := p.Get(ctx)
+		require.NoError(t, err)
+		defer p.Put(r)
+	}
+	assert.EqualValues(t, 3, lastID.Get())
+	assert.EqualValues(t, 3, count.Get())
+}
+
+// TestFreelist runs the tests of the pools with a freelist, so they
+// behave the same with both stores. TestReopen is left out: the pool it
+// leaves open keeps refreshing in the background, so it can only run
+// once per process.
+func TestFreelist(t *testing.T) {
+	freelistByDefault = true
+	defer func() { freelistByDefault = false }()
+
+	for _, test := range []struct {
+		name string
+		run  func(*testing.T)
+	}{
+		{"Open", TestOpen},
+		{"Prefill", TestPrefill},
+		{"PrefillTimeout", TestPrefillTimeout},
+		{"PrefillBackground", TestPrefillBackground},
+		{"PrefillClose", TestPrefillClose},
+		{"Shrinking", TestShrinking},
+		{"Closing", TestClosing},
+		{"IdleTimeout", TestIdleTimeout},
+		{"IdleTimeoutCreateFail", TestIdleTimeoutCreateFail},
+		{"MaxIdleCloses", TestMaxIdleCloses},
+		{"IdleCloseJitter", TestIdleCloseJitter},
+		{"Repair", TestRepair},
+		{"MaxLifetime", TestMaxLifetime},
+		{"CreateFail", TestCreateFail},
+		{"CreateFailOnPut", TestCreateFailOnPut},
+		{"SlowCreateFail", TestSlowCreateFail},
+		{"Timeout", TestTimeout},
+		{"Expired", TestExpired},
+		{"TypedResourcePool", TestTypedResourcePool},
+		{"CheckFunc", TestCheckFunc},
+		{"CheckFuncIdle", TestCheckFuncIdle},
+		{"LIFO", TestLIFO},
+		{"FairWaiters", TestFairWaiters},
+		{"PriorityWaiters", TestPriorityWaiters},
+		{"WaitersClosed", TestWaitersClosed},
+		{"Drain", TestDrain},
+		{"EvictIdle", TestEvictIdle},
+		{"PauseResume", TestPauseResume},
+		{"SetMaxCap", TestSetMaxCap},
+		{"ShardedResourcePool", TestShardedResourcePool},
+		{"ShardedResourcePoolShards", TestShardedResourcePoolShards},
+		{"SettingsPool", TestSettingsPool},
+		{"Observer", TestObserver},
+		{"LeakDetection", TestLeakDetection},
+		{"Histograms", TestHistograms},
+	} {
+		t.Run(test.name, test.run)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoStandby is returned by Failover when there is no standby pool.
+var ErrNoStandby = errors.New("no standby pool")
+
+// StandbyPool hands out the resources of an active pool, and keeps a
+// second, usually smaller, pool dialed to a standby target, e.g. the
+// candidate to become the new primary. On a failover, the standby pool
+// is swapped in at once, so the traffic doesn't stall on the creation
+// of new resources. The standby pool should be created with a prefill,
+// so it's warm by the time it's needed.
+// The resources must be comparable, like pointers, since StandbyPool
+// keeps track of the pool each resource was taken from.
+type StandbyPool struct {
+	mu      sync.Mutex
+	active  IResourcePool
+	standby IResourcePool
+	// taken is the pool of each resource in use, so it's returned to
+	// the pool it came from after a failover.
+	taken map[Resource]IResourcePool
+	// retiring counts the previous active pools that are being closed.
+	retiring sync.WaitGroup
+}
+
+// NewStandbyPool creates a StandbyPool. standby can be nil, and set
+// later with SetStandby.
+func NewStandbyPool(active, standby IResourcePool) *StandbyPool {
+	return &StandbyPool{
+		active:  active,
+		standby: standby,
+		taken:   make(map[Resource]IResourcePool),
+	}
+}
+
+// Get returns a resource of the active pool.
+func (sp *StandbyPool) Get(ctx context.Context) (Resource, error) {
+	pool := sp.Active()
+	r, err := pool.Get(ctx)
+	if err != nil || r == nil {
+		return r, err
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.taken[r] = pool
+	return r, nil
+}
+
+// Put returns a resource to the pool it was taken from, which is not
+// the active pool anymore if there was a failover in the meantime.
+// Unlike for the other pools, Put(nil) panics: the slot of a resource
+// that is not returned must be given back with Discard, since only the
+// resource tells which pool the slot belongs to.
+func (sp *StandbyPool) Put(resource Resource) {
+	if resource == nil {
+		panic(errors.New("StandbyPool: Put(nil) can't tell the pool of the slot, use Discard(resource)"))
+	}
+	sp.takenFrom(resource).Put(resource)
+}
+
+// Discard frees the slot of a resource that is not returned, e.g.
+// because it was closed, in the pool it was taken from.
+func (sp *StandbyPool) Discard(resource Resource) {
+	sp.takenFrom(resource).Put(nil)
+}
+
+// takenFrom returns the pool a resource was taken from, and forgets it.
+func (sp *StandbyPool) takenFrom(resource Resource) IResourcePool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	pool, ok := sp.taken[resource]
+	if !ok {
+		panic(fmt.Errorf("StandbyPool: resource %v was not taken from the pool", resource))
+	}
+	delete(sp.taken, resource)
+	return pool
+}
+
+// Active returns the active pool.
+func (sp *StandbyPool) Active() IResourcePool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.active
+}
+
+// Standby returns the standby pool, or nil if there is none.
+func (sp *StandbyPool) Standby() IResourcePool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.standby
+}
+
+// SetStandby replaces the standby pool, e.g. when another target
+// becomes the candidate for a failover. The previous standby pool is
+// closed.
+func (sp *StandbyPool) SetStandby(standby IResourcePool) {
+	sp.mu.Lock()
+	previous := sp.standby
+	sp.standby = standby
+	sp.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// Failover swaps the standby pool in: it becomes the active pool, with
+// the capacity of the previous one, and the following calls to Get use
+// it. The previous active pool is closed in the background, once all
+// its resources are returned. The standby pool has to be set again
+// for the next failover.
+func (sp *StandbyPool) Failover() error {
+	sp.mu.Lock()
+	if sp.standby == nil {
+		sp.mu.Unlock()
+		return ErrNoStandby
+	}
+	previous := sp.active
+	sp.active, sp.standby = sp.standby, nil
+	active := sp.active
+	sp.mu.Unlock()
+
+	// The standby pool is only grown once it's active, so it serves
+	// the traffic with its warm resources while the others are created.
+	capacity := previous.Capacity()
+	sp.retiring.Add(1)
+	go func() {
+		defer sp.retiring.Done()
+		previous.Close()
+	}()
+	if capacity <= active.Capacity() {
+		return nil
+	}
+	if capacity > active.MaxCap() {
+		if err := active.SetMaxCap(int(capacity)); err != nil {
+			return err
+		}
+	}
+	return active.SetCapacity(int(capacity))
+}
+
+// Drain drains the active pool, like ResourcePool.Drain. The standby
+// pool is left warm.
+func (sp *StandbyPool) Drain(ctx context.Context) error {
+	return sp.Active().Drain(ctx)
+}
+
+// Close closes the active and the standby pools. Like the Close of a
+// ResourcePool, it waits for all the resources to be returned, including
+// those taken from the pools that were active before a failover.
+func (sp *StandbyPool) Close() {
+	sp.mu.Lock()
+	active, standby := sp.active, sp.standby
+	sp.standby = nil
+	sp.mu.Unlock()
+	if standby != nil {
+		standby.Close()
+	}
+	active.Close()
+	sp.retiring.Wait()
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandbyPool(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	active := NewResourcePool(PoolFactory, 3, 3, 0, 0, logWait, nil, 0)
+	sp := NewStandbyPool(active, nil)
+	defer sp.Close()
+	assert.Equal(t, ErrNoStandby, sp.Failover())
+
+	r1, err := sp.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, r1.(*TestResource).num)
+
+	// The standby pool is warm before the failover.
+	standby := NewResourcePool(PoolFactory, 1, 1, 0, 1, logWait, nil, 0)
+	require.NoError(t, standby.WaitForPrefill(ctx))
+	sp.SetStandby(standby)
+	assert.EqualValues(t, 2, lastID.Get())
+
+	require.NoError(t, sp.Failover())
+	assert.Equal(t, standby, sp.Active())
+	assert.Nil(t, sp.Standby())
+	assert.EqualValues(t, 3, standby.Capacity())
+	assert.EqualValues(t, 3, standby.MaxCap())
+	r2, err := sp.Get(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, r2.(*TestResource).num)
+
+	// The previous active pool is closed once its resource is returned.
+	sp.Put(r1)
+	require.Eventually(t, func() bool { return active.Capacity() == 0 && active.Active() == 0 }, time.Second, time.Millisecond)
+	assert.True(t, r1.(*TestResource).closed)
+	sp.Put(r2)
+	assert.EqualValues(t, 3, standby.Available())
+	assert.EqualValues(t, 1, count.Get())
+}
+
+func TestStandbyPoolCloseAfterFailover(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	active := NewResourcePool(PoolFactory, 2, 2, 0, 0, logWait, nil, 0)
+	sp := NewStandbyPool(active, NewResourcePool(PoolFactory, 2, 2, 0, 0, logWait, nil, 0))
+
+	r1, err := sp.Get(ctx)
+	require.NoError(t, err)
+	r2, err := sp.Get(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sp.Failover())
+	r3, err := sp.Get(ctx)
+	require.NoError(t, err)
+	r4, err := sp.Get(ctx)
+	require.NoError(t, err)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		sp.Close()
+	}()
+
+	// The resources go back to their own pool, whether they are put back
+	// or discarded, so both pools can close.
+	r4.Close()
+	sp.Discard(r4)
+	sp.Put(r3)
+	sp.Put(r2)
+	r1.Close()
+	sp.Discard(r1)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	assert.Empty(t, sp.taken)
+	assert.EqualValues(t, 0, count.Get())
+	assert.EqualValues(t, 0, active.Active())
+}
+
+func TestStandbyPoolDrain(t *testing.T) {
+	ctx := context.Background()
+	lastID.Set(0)
+	count.Set(0)
+	standby := NewResourcePool(PoolFactory, 1, 1, 0, 1, logWait, nil, 0)
+	require.NoError(t, standby.WaitForPrefill(ctx))
+	active := NewResourcePool(PoolFactory, 2, 2, 0, 0, logWait, nil, 0)
+	sp := NewStandbyPool(active, standby)
+	defer sp.Close()
+
+	r, err := sp.Get(ctx)
+	require.NoError(t, err)
+	sp.Put(r)
+
+	// Only the active pool is drained.
+	require.NoError(t, sp.Drain(ctx))
+	assert.True(t, r.(*TestResource).closed)
+	assert.EqualValues(t, 0, active.Active())
+	assert.EqualValues(t, 1, standby.Active())
+}
+
+func TestStandbyPoolPutNil(t *testing.T) {
+	ctx := context.Background()
+	active := NewResourcePool(PoolFactory, 1, 1, 0, 0, logWait, nil, 0)
+	sp := NewStandbyPool(active, NewResourcePool(PoolFactory, 1, 1, 0, 0, logWait, nil, 0))
+	defer sp.Close()
+
+	r1, err := sp.Get(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sp.Failover())
+	r2, err := sp.Get(ctx)
+	require.NoError(t, err)
+
+	// The pool of the slot is unknown without the resource.
+	assert.Panics(t, func() { sp.Put(nil) })
+	assert.Len(t, sp.taken, 2)
+
+	// The slot of a discarded resource goes back to its own pool, so
+	// the previous active pool can close while r2 is still in use.
+	r1.Close()
+	sp.Discard(r1)
+	require.Eventually(t, func() bool { return active.Capacity() == 0 }, time.Second, time.Millisecond)
+	assert.EqualValues(t, 1, sp.Active().Active())
+	r2.Close()
+	sp.Discard(r2)
+	assert.Empty(t, sp.taken)
+}
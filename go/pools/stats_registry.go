@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"vitess.io/vitess/go/stats"
+)
+
+type (
+	// StatsSource is a pool whose stats a StatsRegistry exports.
+	// IResourcePool and ResourcePool implement it.
+	StatsSource interface {
+		Stats() Stats
+	}
+
+	// StatsRegistry exports the stats of many pools with go/stats, as
+	// one variable per stat, labeled by the name of the pool and by
+	// static labels, e.g. its keyspace and purpose. The consumers of
+	// the pools then only register them, instead of exporting each of
+	// their stats.
+	StatsRegistry struct {
+		labels []string
+
+		mu sync.Mutex
+		// pools are the registered pools, by the joined values of
+		// their labels.
+		pools map[string]StatsSource
+	}
+
+	// StatsTags tag a pool with a name and the values of the labels of
+	// a StatsRegistry. A pool created with StatsTags, see
+	// ResourcePoolOptions, is registered until it's closed.
+	StatsTags struct {
+		Registry    *StatsRegistry
+		Name        string
+		LabelValues []string
+	}
+
+	registryStat struct {
+		name  string
+		help  string
+		gauge bool
+		value func(Stats) int64
+	}
+)
+
+var registryStats = []registryStat{
+	{"Capacity", "Pool capacity", true, func(s Stats) int64 { return s.Capacity }},
+	{"Available", "Pool available resources", true, func(s Stats) int64 { return s.Available }},
+	{"Active", "Pool active resources", true, func(s Stats) int64 { return s.Active }},
+	{"InUse", "Pool resources in use", true, func(s Stats) int64 { return s.InUse }},
+	{"MaxCap", "Pool max capacity", true, func(s Stats) int64 { return s.MaxCapacity }},
+	{"Waiters", "Pool callers waiting for a resource", true, func(s Stats) int64 { return s.Waiters }},
+	{"WaitCount", "Pool wait count", false, func(s Stats) int64 { return s.WaitCount }},
+	{"WaitTime", "Pool wait time, in nanoseconds", false, func(s Stats) int64 { return int64(s.WaitTime) }},
+	{"IdleTimeout", "Pool idle timeout, in nanoseconds", true, func(s Stats) int64 { return int64(s.IdleTimeout) }},
+	{"IdleClosed", "Pool resources closed by the idle timeout", false, func(s Stats) int64 { return s.IdleClosed }},
+	{"Exhausted", "Number of times the pool had zero available slots", false, func(s Stats) int64 { return s.Exhausted }},
+	{"DialErrors", "Pool failures to open a resource", false, func(s Stats) int64 { return s.DialErrors }},
+}
+
+// NewStatsRegistry creates a StatsRegistry, and publishes its variables
+// as prefix followed by the name of each stat, e.g. prefix+"Capacity".
+// Their labels are "Pool", then the given labels.
+func NewStatsRegistry(prefix string, labels ...string) *StatsRegistry {
+	sr := &StatsRegistry{
+		labels: append([]string{"Pool"}, labels...),
+		pools:  make(map[string]StatsSource),
+	}
+	for _, stat := range registryStats {
+		value := stat.value
+		f := func() map[string]int64 { return sr.values(value) }
+		if stat.gauge {
+			stats.NewGaugesFuncWithMultiLabels(prefix+stat.name, stat.help, sr.labels, f)
+		} else {
+			stats.NewCountersFuncWithMultiLabels(prefix+stat.name, stat.help, sr.labels, f)
+		}
+	}
+	return sr
+}
+
+// Register exports the stats of the pool under its name and the values
+// of the labels of the registry, until it's unregistered.
+func (sr *StatsRegistry) Register(pool StatsSource, name string, labelValues ...string) error {
+	if len(labelValues) != len(sr.labels)-1 {
+		return fmt.Errorf("got %d label values for the labels %v", len(labelValues), sr.labels[1:])
+	}
+	key := joinLabelValues(name, labelValues)
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if _, ok := sr.pools[key]; ok {
+		return fmt.Errorf("pool %s is already registered", key)
+	}
+	sr.pools[key] = pool
+	return nil
+}
+
+// Unregister stops exporting the stats of the pool registered under the
+// name and the label values, e.g. when it's closed.
+func (sr *StatsRegistry) Unregister(name string, labelValues ...string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	delete(sr.pools, joinLabelValues(name, labelValues))
+}
+
+// register registers the pool under its tags, if any. It replaces the
+// pool registered under them, e.g. when a pool is reopened before the
+// previous one is closed.
+func (tags StatsTags) register(pool StatsSource) {
+	if tags.Registry == nil {
+		return
+	}
+	sr := tags.Registry
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.pools[joinLabelValues(tags.Name, tags.LabelValues)] = pool
+}
+
+// unregister unregisters the pool from its tags, unless another pool
+// was registered under them since.
+func (tags StatsTags) unregister(pool StatsSource) {
+	if tags.Registry == nil {
+		return
+	}
+	key := joinLabelValues(tags.Name, tags.LabelValues)
+	sr := tags.Registry
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.pools[key] == pool {
+		delete(sr.pools, key)
+	}
+}
+
+// values returns a stat of the registered pools.
+func (sr *StatsRegistry) values(value func(Stats) int64) map[string]int64 {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	values := make(map[string]int64, len(sr.pools))
+	for key, pool := range sr.pools {
+		values[key] = value(pool.Stats())
+	}
+	return values
+}
+
+// joinLabelValues joins the label values like go/stats does for the
+// variables with multiple labels.
+func joinLabelValues(name string, labelValues []string) string {
+	values := make([]string, 0, len(labelValues)+1)
+	for _, value := range append([]string{name}, labelValues...) {
+		values = append(values, strings.ReplaceAll(value, ".", "_"))
+	}
+	return strings.Join(values, ".")
+}
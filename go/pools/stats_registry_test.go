@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pools
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+)
+
+// registryRuns makes the names of the variables of the tests unique, as
+// go/stats can't publish a name twice, e.g. with -count.
+var registryRuns sync2.AtomicInt64
+
+func newTestStatsRegistry(labels ...string) (*StatsRegistry, string) {
+	prefix := fmt.Sprintf("TestRegistry%d", registryRuns.Add(1))
+	return NewStatsRegistry(prefix, labels...), prefix
+}
+
+func TestStatsRegistry(t *testing.T) {
+	sr, prefix := newTestStatsRegistry("Keyspace", "Purpose")
+	a := NewResourcePool(PoolFactory, 2, 2, 0, 0, logWait, nil, 0)
+	defer a.Close()
+	b := NewResourcePool(PoolFactory, 3, 3, 0, 0, logWait, nil, 0)
+	defer b.Close()
+	require.NoError(t, sr.Register(a, "query", "commerce", "oltp"))
+	require.NoError(t, sr.Register(b, "stream", "commerce.v2", "olap"))
+	assert.EqualError(t, sr.Register(b, "stream", "commerce.v2", "olap"), "pool stream.commerce_v2.olap is already registered")
+	assert.EqualError(t, sr.Register(b, "stream", "commerce"), "got 1 label values for the labels [Keyspace Purpose]")
+
+	r, err := a.Get(context.Background())
+	require.NoError(t, err)
+	defer a.Put(r)
+
+	capacity := expvar.Get(prefix + "Capacity").(*stats.GaugesFuncWithMultiLabels)
+	assert.Equal(t, []string{"Pool", "Keyspace", "Purpose"}, capacity.Labels())
+	assert.Equal(t, map[string]int64{"query.commerce.oltp": 2, "stream.commerce_v2.olap": 3}, capacity.Counts())
+	inUse := expvar.Get(prefix + "InUse").(*stats.GaugesFuncWithMultiLabels)
+	assert.Equal(t, map[string]int64{"query.commerce.oltp": 1, "stream.commerce_v2.olap": 0}, inUse.Counts())
+
+	sr.Unregister("stream", "commerce.v2", "olap")
+	assert.Equal(t, map[string]int64{"query.commerce.oltp": 2}, capacity.Counts())
+	_, ok := expvar.Get(prefix + "WaitCount").(*stats.CountersFuncWithMultiLabels)
+	assert.True(t, ok)
+}
+
+func TestStatsRegistryTags(t *testing.T) {
+	sr, prefix := newTestStatsRegistry("Purpose")
+	tags := StatsTags{Registry: sr, Name: "query", LabelValues: []string{"oltp"}}
+	a := NewTypedResourcePoolWithOptions(PoolFactory, 2, 2, 0, 0, logWait, nil, 0, ResourcePoolOptions{Stats: tags})
+	capacity := expvar.Get(prefix + "Capacity").(*stats.GaugesFuncWithMultiLabels)
+	assert.Equal(t, map[string]int64{"query.oltp": 2}, capacity.Counts())
+
+	// A pool reopened under the same tags replaces the previous one,
+	// even if it's created before the previous one is closed.
+	b := NewTypedResourcePoolWithOptions(PoolFactory, 3, 3, 0, 0, logWait, nil, 0, ResourcePoolOptions{Stats: tags})
+	a.Close()
+	assert.Equal(t, map[string]int64{"query.oltp": 3}, capacity.Counts())
+	b.Close()
+	assert.Equal(t, map[string]int64{}, capacity.Counts())
+}
@@ -92,6 +92,7 @@ func (result *Result) Copy() *Result {
 	out := &Result{
 		InsertID:     result.InsertID,
 		RowsAffected: result.RowsAffected,
+		StatusFlags:  result.StatusFlags,
 	}
 	if result.Fields != nil {
 		out.Fields = make([]*querypb.Field, len(result.Fields))
@@ -320,3 +321,21 @@ func (result *Result) IsMoreResultsExists() bool {
 func (result *Result) IsInTransaction() bool {
 	return result.StatusFlags&ServerStatusInTrans == ServerStatusInTrans
 }
+
+// IsQueryWasSlow returns true if the status flag has SERVER_QUERY_WAS_SLOW set,
+// i.e. the query took longer than long_query_time on the server.
+func (result *Result) IsQueryWasSlow() bool {
+	return result.StatusFlags&ServerQueryWasSlow == ServerQueryWasSlow
+}
+
+// IsNoIndexUsed returns true if the status flag has SERVER_STATUS_NO_INDEX_USED set,
+// i.e. the query did a full table scan.
+func (result *Result) IsNoIndexUsed() bool {
+	return result.StatusFlags&ServerStatusNoIndexUsed == ServerStatusNoIndexUsed
+}
+
+// IsNoGoodIndexUsed returns true if the status flag has SERVER_STATUS_NO_GOOD_INDEX_USED set,
+// i.e. the server could not find a good index to use for the query.
+func (result *Result) IsNoGoodIndexUsed() bool {
+	return result.StatusFlags&ServerStatusNoGoodIndexUsed == ServerStatusNoGoodIndexUsed
+}
@@ -20,6 +20,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"vitess.io/vitess/go/test/utils"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
@@ -63,11 +65,29 @@ func TestCopy(t *testing.T) {
 			{TestValue(Int64, "2"), MakeTrusted(VarChar, nil)},
 			{TestValue(Int64, "3"), TestValue(VarChar, "")},
 		},
+		StatusFlags: ServerQueryWasSlow,
 	}
 	out := in.Copy()
 	utils.MustMatch(t, in, out)
 }
 
+func TestStatusFlags(t *testing.T) {
+	result := &Result{}
+	assert.False(t, result.IsQueryWasSlow())
+	assert.False(t, result.IsNoIndexUsed())
+	assert.False(t, result.IsNoGoodIndexUsed())
+
+	result.StatusFlags = ServerStatusAutocommit | ServerQueryWasSlow | ServerStatusNoIndexUsed
+	assert.True(t, result.IsQueryWasSlow())
+	assert.True(t, result.IsNoIndexUsed())
+	assert.False(t, result.IsNoGoodIndexUsed())
+
+	result.StatusFlags = ServerStatusNoGoodIndexUsed
+	assert.False(t, result.IsQueryWasSlow())
+	assert.False(t, result.IsNoIndexUsed())
+	assert.True(t, result.IsNoGoodIndexUsed())
+}
+
 func TestTruncate(t *testing.T) {
 	in := &Result{
 		Fields: []*querypb.Field{{
@@ -32,26 +32,22 @@ import (
 	"context"
 
 	"vitess.io/vitess/go/pools"
-	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/vt/dbconfigs"
 )
 
 var (
 	// ErrConnPoolClosed is returned if the connection pool is closed.
 	ErrConnPoolClosed = errors.New("connection pool is closed")
-	// usedNames is for preventing expvar from panicking. Tests
-	// create pool objects multiple time. If a name was previously
-	// used, expvar initialization is skipped.
-	// TODO(sougou): Find a way to still crash if this happened
-	// through non-test code.
-	usedNames = make(map[string]bool)
+	// poolStats exports the stats of the named pools, e.g.
+	// ConnectionPoolCapacity{Pool="DbaConnPool"}.
+	poolStats = pools.NewStatsRegistry("ConnectionPool")
 )
 
 // ConnectionPool re-exposes ResourcePool as a pool of
 // PooledDBConnection objects.
 type ConnectionPool struct {
 	mu                  sync.Mutex
-	connections         pools.IResourcePool
+	connections         *pools.ResourcePool[*PooledDBConnection]
 	capacity            int
 	idleTimeout         time.Duration
 	resolutionFrequency time.Duration
@@ -64,25 +60,10 @@ type ConnectionPool struct {
 // NewConnectionPool creates a new ConnectionPool. The name is used
 // to publish stats only.
 func NewConnectionPool(name string, capacity int, idleTimeout time.Duration, dnsResolutionFrequency time.Duration) *ConnectionPool {
-	cp := &ConnectionPool{name: name, capacity: capacity, idleTimeout: idleTimeout, resolutionFrequency: dnsResolutionFrequency}
-	if name == "" || usedNames[name] {
-		return cp
-	}
-	usedNames[name] = true
-	stats.NewGaugeFunc(name+"Capacity", "Connection pool capacity", cp.Capacity)
-	stats.NewGaugeFunc(name+"Available", "Connection pool available", cp.Available)
-	stats.NewGaugeFunc(name+"Active", "Connection pool active", cp.Active)
-	stats.NewGaugeFunc(name+"InUse", "Connection pool in-use", cp.InUse)
-	stats.NewGaugeFunc(name+"MaxCap", "Connection pool max cap", cp.MaxCap)
-	stats.NewCounterFunc(name+"WaitCount", "Connection pool wait count", cp.WaitCount)
-	stats.NewCounterDurationFunc(name+"WaitTime", "Connection pool wait time", cp.WaitTime)
-	stats.NewGaugeDurationFunc(name+"IdleTimeout", "Connection pool idle timeout", cp.IdleTimeout)
-	stats.NewGaugeFunc(name+"IdleClosed", "Connection pool idle closed", cp.IdleClosed)
-	stats.NewCounterFunc(name+"Exhausted", "Number of times pool had zero available slots", cp.Exhausted)
-	return cp
+	return &ConnectionPool{name: name, capacity: capacity, idleTimeout: idleTimeout, resolutionFrequency: dnsResolutionFrequency}
 }
 
-func (cp *ConnectionPool) pool() (p pools.IResourcePool) {
+func (cp *ConnectionPool) pool() (p *pools.ResourcePool[*PooledDBConnection]) {
 	cp.mu.Lock()
 	p = cp.connections
 	cp.mu.Unlock()
@@ -107,11 +88,15 @@ func (cp *ConnectionPool) Open(info dbconfigs.Connector) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 	cp.info = info
-	cp.connections = pools.NewResourcePool(cp.connect, cp.capacity, cp.capacity, cp.idleTimeout, 0, nil, refreshCheck, cp.resolutionFrequency)
+	var opts pools.ResourcePoolOptions
+	if cp.name != "" {
+		opts.Stats = pools.StatsTags{Registry: poolStats, Name: cp.name}
+	}
+	cp.connections = pools.NewTypedResourcePoolWithOptions(cp.connect, cp.capacity, cp.capacity, cp.idleTimeout, 0, nil, refreshCheck, cp.resolutionFrequency, opts)
 }
 
 // connect is used by the resource pool to create a new Resource.
-func (cp *ConnectionPool) connect(ctx context.Context) (pools.Resource, error) {
+func (cp *ConnectionPool) connect(ctx context.Context) (*PooledDBConnection, error) {
 	c, err := NewDBConnection(ctx, cp.info)
 	if err != nil {
 		return nil, err
@@ -144,12 +129,7 @@ func (cp *ConnectionPool) Get(ctx context.Context) (*PooledDBConnection, error)
 	if p == nil {
 		return nil, ErrConnPoolClosed
 	}
-	r, err := p.Get(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return r.(*PooledDBConnection), nil
+	return p.Get(ctx)
 }
 
 // Put puts a connection into the pool.
@@ -158,13 +138,6 @@ func (cp *ConnectionPool) Put(conn *PooledDBConnection) {
 	if p == nil {
 		panic(ErrConnPoolClosed)
 	}
-	if conn == nil {
-		// conn has a type, if we just Put(conn), we end up
-		// putting an interface with a nil value, that is not
-		// equal to a nil value. So just put a plain nil.
-		p.Put(nil)
-		return
-	}
 	p.Put(conn)
 }
 
@@ -0,0 +1,437 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbconnpool
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// errOpenByName is returned by the Driver of the DBs returned by OpenDB,
+// whose connections can only come from their pool.
+var errOpenByName = errors.New("dbconnpool: the connections of a pool can only be opened with ConnectionPool.OpenDB")
+
+// OpenDB returns a database/sql DB whose connections are taken from the
+// pool, so the tools written against database/sql share its capacity,
+// its stats and its handling of the broken connections. The DB keeps no
+// idle connection of its own: a connection goes back to the pool as soon
+// as the DB releases it. The queries can have ? or :name placeholders,
+// which are bound before the query is sent, since MySQL connections of
+// the pool don't use prepared statements. A query fails if it returns
+// more than maxRows rows.
+func (cp *ConnectionPool) OpenDB(maxRows int) *sql.DB {
+	db := sql.OpenDB(&sqlConnector{pool: cp, maxRows: maxRows})
+	db.SetMaxIdleConns(0)
+	return db
+}
+
+type (
+	// sqlConnector is the driver.Connector of the DBs returned by
+	// OpenDB.
+	sqlConnector struct {
+		pool    *ConnectionPool
+		maxRows int
+	}
+
+	sqlDriver struct{}
+
+	// sqlConn is a connection of the pool lent to database/sql.
+	sqlConn struct {
+		conn    *PooledDBConnection
+		maxRows int
+		// inTx is true when the connection may have an open
+		// transaction, which is rolled back before the connection goes
+		// back to the pool.
+		inTx bool
+	}
+
+	sqlStmt struct {
+		c     *sqlConn
+		query string
+	}
+
+	sqlTx struct {
+		c *sqlConn
+	}
+
+	sqlResult struct {
+		insertID, rowsAffected int64
+	}
+
+	sqlRows struct {
+		qr    *sqltypes.Result
+		index int
+	}
+)
+
+// Connect is part of the driver.Connector interface.
+func (sc *sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sc.pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlConn{conn: conn, maxRows: sc.maxRows}, nil
+}
+
+// Driver is part of the driver.Connector interface.
+func (sc *sqlConnector) Driver() driver.Driver {
+	return sqlDriver{}
+}
+
+// Open is part of the driver.Driver interface.
+func (sqlDriver) Open(string) (driver.Conn, error) {
+	return nil, errOpenByName
+}
+
+// Prepare is part of the driver.Conn interface.
+func (c *sqlConn) Prepare(query string) (driver.Stmt, error) {
+	return &sqlStmt{c: c, query: query}, nil
+}
+
+// Close returns the connection to the pool, which discards it if it's
+// broken. An open transaction is rolled back first, and the connection
+// is discarded if that fails, so the pool never lends a connection in
+// the middle of a transaction.
+func (c *sqlConn) Close() error {
+	if c.inTx && !c.conn.IsClosed() {
+		if _, err := c.conn.ExecuteFetch("rollback", 1, false); err != nil {
+			c.conn.Close()
+		}
+	}
+	c.conn.Recycle()
+	return nil
+}
+
+// Begin is part of the driver.Conn interface.
+func (c *sqlConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx is part of the driver.ConnBeginTx interface.
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if sql.IsolationLevel(opts.Isolation) != sql.LevelDefault {
+		return nil, fmt.Errorf("isolation level %v is not supported", sql.IsolationLevel(opts.Isolation))
+	}
+	query := "begin"
+	if opts.ReadOnly {
+		query = "start transaction read only"
+	}
+	c.inTx = true
+	if _, err := c.execute(ctx, query, nil); err != nil {
+		return nil, err
+	}
+	return &sqlTx{c: c}, nil
+}
+
+// ExecContext is part of the driver.ExecerContext interface.
+func (c *sqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	qr, err := c.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return sqlResult{insertID: int64(qr.InsertID), rowsAffected: int64(qr.RowsAffected)}, nil
+}
+
+// QueryContext is part of the driver.QueryerContext interface.
+func (c *sqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qr, err := c.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlRows{qr: qr}, nil
+}
+
+// IsValid is part of the driver.Validator interface: the connections
+// closed because of an error are not reused.
+func (c *sqlConn) IsValid() bool {
+	return !c.conn.IsClosed()
+}
+
+// execute binds the args to the query, and executes it. A connection
+// that is already broken returns driver.ErrBadConn, so database/sql
+// retries with another connection, since the query was not sent. The
+// connection is closed if ctx is done before the query returns, which
+// interrupts it, and then discarded by the pool.
+func (c *sqlConn) execute(ctx context.Context, query string, args []driver.NamedValue) (*sqltypes.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.conn.IsClosed() {
+		return nil, driver.ErrBadConn
+	}
+	query, err := bindQuery(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.conn.Close()
+			case <-done:
+			}
+		}()
+	}
+	qr, err := c.conn.ExecuteFetch(query, c.maxRows, true)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if qr.StatusFlags&mysql.ServerStatusInTrans != 0 {
+		c.inTx = true
+	}
+	return qr, nil
+}
+
+// bindQuery substitutes the args to the placeholders of the query: ?,
+// which stands for the next unnamed arg, or :name for the named args,
+// with :v1, :v2, etc. for the unnamed ones. The rest of the query,
+// including its comments and its optimizer hints, is sent as is: the
+// quoted strings, the quoted identifiers and the comments are copied
+// without looking for placeholders in them.
+func bindQuery(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	bindVars := make(map[string]*querypb.BindVariable, len(args))
+	for _, arg := range args {
+		bv, err := sqltypes.BuildBindVariable(arg.Value)
+		if err != nil {
+			return "", err
+		}
+		name := arg.Name
+		if name == "" {
+			name = fmt.Sprintf("v%d", arg.Ordinal)
+		}
+		bindVars[name] = bv
+	}
+
+	var buf strings.Builder
+	bind := func(name string) error {
+		bv, ok := bindVars[name]
+		if !ok {
+			return fmt.Errorf("missing bind var %s", name)
+		}
+		sqlparser.EncodeValue(&buf, bv)
+		return nil
+	}
+	positional := 0
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := skipQuoted(query, i)
+			buf.WriteString(query[i:end])
+			i = end
+		case ch == '#' || strings.HasPrefix(query[i:], "-- ") || query[i:] == "--":
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query)
+			} else {
+				end += i
+			}
+			buf.WriteString(query[i:end])
+			i = end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				end = len(query)
+			} else {
+				end += i + 4
+			}
+			buf.WriteString(query[i:end])
+			i = end
+		case ch == '?':
+			positional++
+			if err := bind(fmt.Sprintf("v%d", positional)); err != nil {
+				return "", err
+			}
+			i++
+		case ch == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			end := i + 2
+			for end < len(query) && isNamePart(query[end]) {
+				end++
+			}
+			if err := bind(query[i+1 : end]); err != nil {
+				return "", err
+			}
+			i = end
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
+	}
+	return buf.String(), nil
+}
+
+// skipQuoted returns the end of the string or the identifier quoted at
+// the start of query[i:]. The quote is escaped by doubling it, or with
+// a backslash outside of the identifiers.
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
+
+func isNamePart(ch byte) bool {
+	return isNameStart(ch) || ('0' <= ch && ch <= '9')
+}
+
+// Close is part of the driver.Stmt interface.
+func (s *sqlStmt) Close() error {
+	return nil
+}
+
+// NumInput is part of the driver.Stmt interface. -1 means that
+// database/sql doesn't check the number of args.
+func (s *sqlStmt) NumInput() int {
+	return -1
+}
+
+// Exec is part of the driver.Stmt interface.
+func (s *sqlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+// ExecContext is part of the driver.StmtExecContext interface.
+func (s *sqlStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+// Query is part of the driver.Stmt interface.
+func (s *sqlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+// QueryContext is part of the driver.StmtQueryContext interface.
+func (s *sqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, 0, len(args))
+	for i, arg := range args {
+		named = append(named, driver.NamedValue{Ordinal: i + 1, Value: arg})
+	}
+	return named
+}
+
+// Commit is part of the driver.Tx interface.
+func (tx *sqlTx) Commit() error {
+	return tx.end("commit")
+}
+
+// Rollback is part of the driver.Tx interface.
+func (tx *sqlTx) Rollback() error {
+	return tx.end("rollback")
+}
+
+// end ends the transaction with query. The transaction is still
+// considered open if that fails.
+func (tx *sqlTx) end(query string) error {
+	if _, err := tx.c.execute(context.Background(), query, nil); err != nil {
+		return err
+	}
+	tx.c.inTx = false
+	return nil
+}
+
+// LastInsertId is part of the driver.Result interface.
+func (r sqlResult) LastInsertId() (int64, error) {
+	return r.insertID, nil
+}
+
+// RowsAffected is part of the driver.Result interface.
+func (r sqlResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// Columns is part of the driver.Rows interface.
+func (r *sqlRows) Columns() []string {
+	cols := make([]string, 0, len(r.qr.Fields))
+	for _, field := range r.qr.Fields {
+		cols = append(cols, field.Name)
+	}
+	return cols
+}
+
+// Close is part of the driver.Rows interface.
+func (r *sqlRows) Close() error {
+	return nil
+}
+
+// Next is part of the driver.Rows interface.
+func (r *sqlRows) Next(dest []driver.Value) (err error) {
+	if r.index == len(r.qr.Rows) {
+		return io.EOF
+	}
+	for i, v := range r.qr.Rows[r.index] {
+		if dest[i], err = toNative(v); err != nil {
+			return err
+		}
+	}
+	r.index++
+	return nil
+}
+
+// toNative converts a value to one of the types of driver.Value, or to
+// uint64 for the unsigned integers.
+func toNative(v sqltypes.Value) (driver.Value, error) {
+	switch {
+	case v.IsNull():
+		return nil, nil
+	case v.IsSigned():
+		return v.ToInt64()
+	case v.IsUnsigned():
+		return v.ToUint64()
+	case v.IsFloat():
+		return v.ToFloat64()
+	}
+	return v.ToBytes()
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dbconnpool
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestOpenDB(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	db.AddQuery("select id, name from t where id = 1", sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields("id|name", "int64|varchar"),
+		"1|a",
+	))
+	db.AddQuery("update t set name = 'b' where id = 1", &sqltypes.Result{RowsAffected: 1})
+	db.AddQuery("begin", &sqltypes.Result{})
+	db.AddQuery("commit", &sqltypes.Result{})
+
+	cp := NewConnectionPool("", 1, time.Minute, 0)
+	cp.Open(db.ConnParams())
+	defer cp.Close()
+	sqlDB := cp.OpenDB(10)
+	defer sqlDB.Close()
+	ctx := context.Background()
+
+	var id int64
+	var name string
+	require.NoError(t, sqlDB.QueryRowContext(ctx, "select id, name from t where id = ?", 1).Scan(&id, &name))
+	assert.EqualValues(t, 1, id)
+	assert.Equal(t, "a", name)
+	// The connection went back to the pool.
+	assert.EqualValues(t, 1, cp.Available())
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, cp.Available())
+	_, err = tx.ExecContext(ctx, "update t set name = :name where id = :id", "b", 1)
+	assert.EqualError(t, err, "missing bind var name")
+	result, err := tx.ExecContext(ctx, "update t set name = ? where id = ?", "b", 1)
+	require.NoError(t, err)
+	rowsAffected, err := result.RowsAffected()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, rowsAffected)
+	require.NoError(t, tx.Commit())
+	assert.EqualValues(t, 1, cp.Available())
+	assert.EqualValues(t, 1, cp.Active())
+}
+
+func TestBindQuery(t *testing.T) {
+	args := []driver.NamedValue{
+		{Ordinal: 1, Value: int64(1)},
+		{Ordinal: 2, Value: "it's"},
+		{Name: "name", Ordinal: 3, Value: []byte("b")},
+	}
+	testcases := []struct {
+		query, want, err string
+	}{{
+		query: "select /*+ MAX_EXECUTION_TIME(1000) */ a from t where id = ? and b = ? -- ?",
+		want:  "select /*+ MAX_EXECUTION_TIME(1000) */ a from t where id = 1 and b = 'it\\'s' -- ?",
+	}, {
+		query: "select ':name', \"?\", `:name?` /* :name */ from t where c = :name # ?",
+		want:  "select ':name', \"?\", `:name?` /* :name */ from t where c = 'b' # ?",
+	}, {
+		query: "select 'a''?', 'b\\'?' from t where c = :v2 and @x := :v1",
+		want:  "select 'a''?', 'b\\'?' from t where c = 'it\\'s' and @x := 1",
+	}, {
+		query: "select ? from t where a = ? and b = ? and c = ?",
+		err:   "missing bind var v3",
+	}, {
+		query: "select :other from t",
+		err:   "missing bind var other",
+	}}
+	for _, tc := range testcases {
+		got, err := bindQuery(tc.query, args)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, tc.query)
+			continue
+		}
+		require.NoError(t, err, tc.query)
+		assert.Equal(t, tc.want, got)
+	}
+
+	// A query without args is sent as is.
+	got, err := bindQuery("select '?' -- :name", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "select '?' -- :name", got)
+}
+
+func TestOpenDBContext(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	db.AddQuery("select sleep(10)", &sqltypes.Result{})
+	// The query returns after the client gave up on it.
+	db.SetBeforeFunc("select sleep(10)", func() {
+		<-ctx.Done()
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	cp := NewConnectionPool("", 1, time.Minute, 0)
+	cp.Open(db.ConnParams())
+	defer cp.Close()
+	sqlDB := cp.OpenDB(10)
+	defer sqlDB.Close()
+
+	pc, err := cp.Get(context.Background())
+	require.NoError(t, err)
+	id := pc.ConnectionID
+	pc.Recycle()
+
+	// The query is interrupted by the timeout, and its connection is
+	// replaced.
+	_, err = sqlDB.ExecContext(ctx, "select sleep(10)")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 1, cp.Available())
+	pc, err = cp.Get(context.Background())
+	require.NoError(t, err)
+	assert.NotEqual(t, id, pc.ConnectionID)
+	pc.Recycle()
+}
+
+func TestSQLConnCloseInTransaction(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	db.AddQuery("begin", &sqltypes.Result{})
+	db.AddQuery("update t set a = 1", &sqltypes.Result{RowsAffected: 1})
+	db.AddQuery("rollback", &sqltypes.Result{})
+
+	cp := NewConnectionPool("", 1, time.Minute, 0)
+	cp.Open(db.ConnParams())
+	defer cp.Close()
+	ctx := context.Background()
+
+	// A connection released in the middle of a transaction is rolled
+	// back before it goes back to the pool.
+	pc, err := cp.Get(ctx)
+	require.NoError(t, err)
+	c := &sqlConn{conn: pc, maxRows: 10}
+	_, err = c.BeginTx(ctx, driver.TxOptions{})
+	require.NoError(t, err)
+	_, err = c.ExecContext(ctx, "update t set a = 1", nil)
+	require.NoError(t, err)
+	db.ResetQueryLog()
+	require.NoError(t, c.Close())
+	assert.Equal(t, "rollback", db.QueryLog())
+	assert.EqualValues(t, 1, cp.Available())
+	assert.EqualValues(t, 1, cp.Active())
+
+	// The connection is replaced if the rollback fails.
+	db.DeleteQuery("rollback")
+	db.AddRejectedQuery("rollback", errors.New("rollback failed"))
+	pc, err = cp.Get(ctx)
+	require.NoError(t, err)
+	id := pc.ConnectionID
+	c = &sqlConn{conn: pc, maxRows: 10}
+	_, err = c.BeginTx(ctx, driver.TxOptions{})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	assert.EqualValues(t, 1, cp.Available())
+	pc, err = cp.Get(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, pc.ConnectionID)
+	pc.Recycle()
+}
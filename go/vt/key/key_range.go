@@ -0,0 +1,263 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package key
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// This file contains the helpers for the key ranges of any width, like
+// a layout of shards mixing -80, 80-c0 and c000-c080: the bounds of a
+// key range are compared as if they were padded with zeros, so 80 and
+// 8000 are the same bound. A nil KeyRange covers the whole keyspace,
+// like an empty one.
+
+// KeyRangeNormalize returns a copy of kr without the trailing zeros of
+// its bounds, so two key ranges covering the same keyspace ids are
+// equal, whatever the width of their bounds: 8000-c000 becomes 80-c0.
+// A nil kr is returned as an empty KeyRange.
+func KeyRangeNormalize(kr *topodatapb.KeyRange) *topodatapb.KeyRange {
+	if kr == nil {
+		return &topodatapb.KeyRange{}
+	}
+	return &topodatapb.KeyRange{
+		Start: trimTrailingZeros(kr.Start),
+		End:   trimTrailingZeros(kr.End),
+	}
+}
+
+// trimTrailingZeros returns a copy of b without its trailing zeros.
+func trimTrailingZeros(b []byte) []byte {
+	b = bytes.TrimRight(b, "\x00")
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// KeyRangeValidate returns an error if kr covers no keyspace id, that
+// is if its end is set and not strictly greater than its start.
+func KeyRangeValidate(kr *topodatapb.KeyRange) error {
+	if kr == nil || len(kr.End) == 0 {
+		return nil
+	}
+	if compareBounds(kr.Start, kr.End) >= 0 {
+		return fmt.Errorf("out of order keys: %v is not strictly smaller than %v", hex.EncodeToString(kr.Start), hex.EncodeToString(kr.End))
+	}
+	return nil
+}
+
+// compareBounds compares two bounds of key ranges, as if they were
+// padded with zeros. An empty bound is the lowest one: the ends must be
+// compared with compareEnds.
+func compareBounds(a, b []byte) int {
+	return bytes.Compare(bytes.TrimRight(a, "\x00"), bytes.TrimRight(b, "\x00"))
+}
+
+// compareEnds compares two ends of key ranges. An empty end is the
+// highest one.
+func compareEnds(a, b []byte) int {
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return 1
+	case len(b) == 0:
+		return -1
+	}
+	return compareBounds(a, b)
+}
+
+// sortedKeyRanges returns the normalized krs, sorted by start then end.
+func sortedKeyRanges(krs []*topodatapb.KeyRange) []*topodatapb.KeyRange {
+	sorted := make([]*topodatapb.KeyRange, len(krs))
+	for i, kr := range krs {
+		sorted[i] = KeyRangeNormalize(kr)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if c := compareBounds(sorted[i].Start, sorted[j].Start); c != 0 {
+			return c < 0
+		}
+		return compareEnds(sorted[i].End, sorted[j].End) < 0
+	})
+	return sorted
+}
+
+// KeyRangeGapsAndOverlaps returns the parts of the keyspace covered by
+// none of krs, and the parts covered by more than one of them, as
+// normalized key ranges in order. A set of shards is a valid partition
+// of the keyspace if it has neither.
+func KeyRangeGapsAndOverlaps(krs []*topodatapb.KeyRange) (gaps, overlaps []*topodatapb.KeyRange) {
+	// The part of the keyspace covered so far goes from its beginning
+	// to covered, or to its end if coveredAll.
+	var covered []byte
+	coveredAll := false
+	for _, kr := range sortedKeyRanges(krs) {
+		if coveredAll {
+			overlaps = appendKeyRange(overlaps, kr)
+			continue
+		}
+
+		switch c := compareBounds(kr.Start, covered); {
+		case c > 0:
+			gaps = append(gaps, &topodatapb.KeyRange{Start: covered, End: kr.Start})
+		case c < 0:
+			end := covered
+			if len(kr.End) != 0 && compareBounds(kr.End, covered) < 0 {
+				end = kr.End
+			}
+			overlaps = appendKeyRange(overlaps, &topodatapb.KeyRange{Start: kr.Start, End: end})
+		}
+
+		if len(kr.End) == 0 {
+			coveredAll = true
+		} else if compareBounds(kr.End, covered) > 0 {
+			covered = kr.End
+		}
+	}
+	if !coveredAll {
+		gaps = append(gaps, &topodatapb.KeyRange{Start: covered})
+	}
+	return gaps, overlaps
+}
+
+// KeyRangesUnion returns the parts of the keyspace covered by at least
+// one of krs, as the smallest list of normalized key ranges, in order.
+func KeyRangesUnion(krs []*topodatapb.KeyRange) []*topodatapb.KeyRange {
+	var union []*topodatapb.KeyRange
+	for _, kr := range sortedKeyRanges(krs) {
+		union = appendKeyRange(union, kr)
+	}
+	return union
+}
+
+// KeyRangesSubtract returns the parts of the keyspace covered by krs,
+// but not by removed, as the smallest list of normalized key ranges,
+// in order.
+func KeyRangesSubtract(krs, removed []*topodatapb.KeyRange) []*topodatapb.KeyRange {
+	removed = KeyRangesUnion(removed)
+	var result []*topodatapb.KeyRange
+	for _, kr := range KeyRangesUnion(krs) {
+		// start is the beginning of the part of kr left to subtract
+		// from, none if done.
+		start := kr.Start
+		done := false
+		for _, r := range removed {
+			if len(r.End) != 0 && compareBounds(r.End, start) <= 0 {
+				// r is before what is left of kr.
+				continue
+			}
+			if len(kr.End) != 0 && compareBounds(r.Start, kr.End) >= 0 {
+				// r and the next ones are after kr.
+				break
+			}
+			if compareBounds(r.Start, start) > 0 {
+				result = append(result, &topodatapb.KeyRange{Start: start, End: r.Start})
+			}
+			if len(r.End) == 0 || (len(kr.End) != 0 && compareBounds(r.End, kr.End) >= 0) {
+				done = true
+				break
+			}
+			start = r.End
+		}
+		if !done {
+			result = append(result, &topodatapb.KeyRange{Start: start, End: kr.End})
+		}
+	}
+	return result
+}
+
+// KeyRangesCover returns true if krs together cover all of kr, whatever
+// the width of their bounds.
+func KeyRangesCover(krs []*topodatapb.KeyRange, kr *topodatapb.KeyRange) bool {
+	return len(KeyRangesSubtract([]*topodatapb.KeyRange{kr}, krs)) == 0
+}
+
+// KeyRangesEqual returns true if left and right cover the same keyspace
+// ids, however they are split: -40,40-80 is equal to -80.
+func KeyRangesEqual(left, right []*topodatapb.KeyRange) bool {
+	l, r := KeyRangesUnion(left), KeyRangesUnion(right)
+	if len(l) != len(r) {
+		return false
+	}
+	for i := range l {
+		if !bytes.Equal(l[i].Start, r[i].Start) || !bytes.Equal(l[i].End, r[i].End) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendKeyRange appends kr to the ordered list of disjoint key ranges
+// krs, merging it with the last one if they intersect or are adjacent.
+// kr must not start before the last one.
+func appendKeyRange(krs []*topodatapb.KeyRange, kr *topodatapb.KeyRange) []*topodatapb.KeyRange {
+	if len(krs) > 0 {
+		last := krs[len(krs)-1]
+		if len(last.End) == 0 || compareBounds(kr.Start, last.End) <= 0 {
+			if compareEnds(kr.End, last.End) > 0 {
+				last.End = kr.End
+			}
+			return krs
+		}
+	}
+	return append(krs, &topodatapb.KeyRange{Start: kr.Start, End: kr.End})
+}
+
+// PlanShardRanges returns the names of the shards to create so the
+// keyspace is split evenly in count shards, see GenerateShardRanges,
+// leaving out the existing ones. The existing shards can have bounds of
+// any width: 8000-c000 is the same shard as 80-c0. The names of the
+// existing shards that are not key ranges, like "0", are ignored.
+func PlanShardRanges(count int, existing []string) ([]string, error) {
+	shards, err := GenerateShardRanges(count)
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, shard := range existing {
+		if !IsKeyRange(shard) {
+			continue
+		}
+		parts := strings.Split(shard, "-")
+		kr, err := ParseKeyRangeParts(parts[0], parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid existing shard %v: %v", shard, err)
+		}
+		exists[KeyRangeString(KeyRangeNormalize(kr))] = true
+	}
+
+	var result []string
+	for _, shard := range shards {
+		parts := strings.Split(shard, "-")
+		kr, err := ParseKeyRangeParts(parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if !exists[KeyRangeString(KeyRangeNormalize(kr))] {
+			result = append(result, shard)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package key
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// parseKeyRanges parses key ranges like "40-80".
+func parseKeyRanges(t *testing.T, krs ...string) []*topodatapb.KeyRange {
+	t.Helper()
+	var result []*topodatapb.KeyRange
+	for _, kr := range krs {
+		parts := strings.Split(kr, "-")
+		require.Len(t, parts, 2, kr)
+		parsed, err := ParseKeyRangeParts(parts[0], parts[1])
+		require.NoError(t, err)
+		result = append(result, parsed)
+	}
+	return result
+}
+
+// keyRangeStrings returns the key ranges like "40-80".
+func keyRangeStrings(krs []*topodatapb.KeyRange) []string {
+	var result []string
+	for _, kr := range krs {
+		result = append(result, KeyRangeString(kr))
+	}
+	return result
+}
+
+func TestKeyRangeNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"-":         "-",
+		"8000-c000": "80-c0",
+		"00-80":     "-80",
+		"0080-":     "0080-",
+		"c00010-":   "c00010-",
+	} {
+		got := KeyRangeNormalize(parseKeyRanges(t, in)[0])
+		assert.Equal(t, want, KeyRangeString(got), in)
+	}
+	assert.Equal(t, "-", KeyRangeString(KeyRangeNormalize(nil)))
+}
+
+func TestKeyRangeValidate(t *testing.T) {
+	for kr, valid := range map[string]bool{
+		"-":       true,
+		"80-":     true,
+		"-80":     true,
+		"80-8001": true,
+		"80-8000": false,
+		"80-40":   false,
+		"00-":     true,
+	} {
+		err := KeyRangeValidate(parseKeyRanges(t, kr)[0])
+		assert.Equal(t, valid, err == nil, "%v: %v", kr, err)
+	}
+	assert.NoError(t, KeyRangeValidate(nil))
+}
+
+func TestKeyRangeGapsAndOverlaps(t *testing.T) {
+	testcases := []struct {
+		krs      []string
+		gaps     []string
+		overlaps []string
+	}{{
+		krs:  nil,
+		gaps: []string{"-"},
+	}, {
+		krs: []string{"-"},
+	}, {
+		krs: []string{"-80", "80-"},
+	}, {
+		// Any width, in any order.
+		krs: []string{"c000-c080", "80-c0", "c080-", "-8000"},
+	}, {
+		krs:  []string{"-40", "80-c0"},
+		gaps: []string{"40-80", "c0-"},
+	}, {
+		krs:  []string{"40-80", "c0-"},
+		gaps: []string{"-40", "80-c0"},
+	}, {
+		krs:      []string{"-80", "40-c0", "80-"},
+		overlaps: []string{"40-c0"},
+	}, {
+		krs:      []string{"-", "80-c0"},
+		overlaps: []string{"80-c0"},
+	}, {
+		krs:      []string{"-80", "-80", "20-40", "c0-"},
+		gaps:     []string{"80-c0"},
+		overlaps: []string{"-80"},
+	}}
+	for _, tcase := range testcases {
+		gaps, overlaps := KeyRangeGapsAndOverlaps(parseKeyRanges(t, tcase.krs...))
+		assert.Equal(t, tcase.gaps, keyRangeStrings(gaps), "gaps of %v", tcase.krs)
+		assert.Equal(t, tcase.overlaps, keyRangeStrings(overlaps), "overlaps of %v", tcase.krs)
+	}
+}
+
+func TestKeyRangesUnion(t *testing.T) {
+	testcases := []struct {
+		krs   []string
+		union []string
+	}{{
+		krs:   nil,
+		union: nil,
+	}, {
+		krs:   []string{"-80", "8000-"},
+		union: []string{"-"},
+	}, {
+		krs:   []string{"c0-", "-40", "20-60"},
+		union: []string{"-60", "c0-"},
+	}, {
+		krs:   []string{"40-80", "-", "90-a0"},
+		union: []string{"-"},
+	}}
+	for _, tcase := range testcases {
+		union := KeyRangesUnion(parseKeyRanges(t, tcase.krs...))
+		assert.Equal(t, tcase.union, keyRangeStrings(union), "union of %v", tcase.krs)
+	}
+}
+
+func TestPlanShardRanges(t *testing.T) {
+	testcases := []struct {
+		count    int
+		existing []string
+		want     []string
+		err      bool
+	}{{
+		count: 1,
+		want:  []string{"-"},
+	}, {
+		count: 3,
+		want:  []string{"-55", "55-aa", "aa-"},
+	}, {
+		count:    4,
+		existing: []string{"0", "-40", "8000-c000", "c0-e0"},
+		want:     []string{"40-80", "c0-"},
+	}, {
+		count:    2,
+		existing: []string{"-80", "80-"},
+		want:     nil,
+	}, {
+		count:    2,
+		existing: []string{"-8"},
+		err:      true,
+	}, {
+		count: 0,
+		err:   true,
+	}}
+	for _, tcase := range testcases {
+		got, err := PlanShardRanges(tcase.count, tcase.existing)
+		if tcase.err {
+			assert.Error(t, err, "%v %v", tcase.count, tcase.existing)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tcase.want, got, "%v %v", tcase.count, tcase.existing)
+	}
+}
+
+func TestKeyRangesSubtract(t *testing.T) {
+	testcases := []struct {
+		krs     []string
+		removed []string
+		want    []string
+	}{{
+		krs:     []string{"-"},
+		removed: nil,
+		want:    []string{"-"},
+	}, {
+		krs:     []string{"-"},
+		removed: []string{"-"},
+		want:    nil,
+	}, {
+		krs:     []string{"-"},
+		removed: []string{"40-80", "c000-"},
+		want:    []string{"-40", "80-c0"},
+	}, {
+		krs:     []string{"-40", "60-"},
+		removed: []string{"20-70"},
+		want:    []string{"-20", "70-"},
+	}, {
+		krs:     []string{"40-80"},
+		removed: []string{"-40", "80-"},
+		want:    []string{"40-80"},
+	}, {
+		krs:     []string{"40-80"},
+		removed: []string{"-50", "60-"},
+		want:    []string{"50-60"},
+	}, {
+		krs:     nil,
+		removed: []string{"-80"},
+		want:    nil,
+	}}
+	for _, tcase := range testcases {
+		got := KeyRangesSubtract(parseKeyRanges(t, tcase.krs...), parseKeyRanges(t, tcase.removed...))
+		assert.Equal(t, tcase.want, keyRangeStrings(got), "%v - %v", tcase.krs, tcase.removed)
+	}
+}
+
+func TestKeyRangesCover(t *testing.T) {
+	testcases := []struct {
+		krs  []string
+		kr   string
+		want bool
+	}{{
+		krs:  []string{"-80", "8000-"},
+		kr:   "-",
+		want: true,
+	}, {
+		krs:  []string{"-80", "c0-"},
+		kr:   "-",
+		want: false,
+	}, {
+		krs:  []string{"40-60", "5000-8000"},
+		kr:   "40-80",
+		want: true,
+	}, {
+		krs:  []string{"40-60", "5000-8000"},
+		kr:   "40-8001",
+		want: false,
+	}, {
+		krs:  nil,
+		kr:   "40-80",
+		want: false,
+	}}
+	for _, tcase := range testcases {
+		got := KeyRangesCover(parseKeyRanges(t, tcase.krs...), parseKeyRanges(t, tcase.kr)[0])
+		assert.Equal(t, tcase.want, got, "%v cover %v", tcase.krs, tcase.kr)
+	}
+	assert.True(t, KeyRangesCover(parseKeyRanges(t, "-"), nil))
+}
+
+func TestKeyRangesEqual(t *testing.T) {
+	assert.True(t, KeyRangesEqual(parseKeyRanges(t, "-40", "40-80"), parseKeyRanges(t, "-8000")))
+	assert.True(t, KeyRangesEqual(nil, nil))
+	assert.False(t, KeyRangesEqual(parseKeyRanges(t, "-40", "60-80"), parseKeyRanges(t, "-80")))
+	assert.False(t, KeyRangesEqual(parseKeyRanges(t, "-80"), nil))
+}
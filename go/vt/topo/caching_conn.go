@@ -0,0 +1,341 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"container/list"
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+)
+
+var _ Conn = (*CachingConn)(nil)
+
+var (
+	topoCachingConnHits = stats.NewCountersWithSingleLabel(
+		"TopologyCacheHits",
+		"TopologyCacheHits reads served from the topology read cache per cell",
+		"Cell")
+
+	topoCachingConnMisses = stats.NewCountersWithSingleLabel(
+		"TopologyCacheMisses",
+		"TopologyCacheMisses reads of cached records sent to the topology server per cell",
+		"Cell")
+
+	topoCachingConnEntries = stats.NewGaugesWithSingleLabel(
+		"TopologyCacheEntries",
+		"TopologyCacheEntries records kept up to date by a watch per cell",
+		"Cell")
+
+	topoCachingConnEvictions = stats.NewCountersWithSingleLabel(
+		"TopologyCacheEvictions",
+		"TopologyCacheEvictions records dropped from the topology read cache, and their watch stopped, to stay within its max entries per cell",
+		"Cell")
+)
+
+// CachingConn is a wrapper for a Conn that serves the reads of the
+// Keyspace, Shard and Tablet records from memory. The first read of a
+// record goes to the underlying Conn, and starts a watch that keeps the
+// cached copy up to date. The writes made through the CachingConn drop
+// the cached copy, so they are seen by the next read.
+//
+// A cached record that didn't change for maxStaleness is read again, so
+// a watch that silently stopped delivering changes can't serve stale
+// data for longer than that.
+//
+// At most maxEntries records are cached, if it's non-zero: beyond that,
+// the least recently read record is dropped, and its watch stopped, so
+// a process that reads a lot of records doesn't keep as many watches
+// open on the topology server.
+type CachingConn struct {
+	cell         string
+	maxStaleness time.Duration
+	maxEntries   int
+
+	// connMu protects conn, which Server.SetRetryPolicy wraps while
+	// the connection is in use.
+	connMu sync.RWMutex
+	conn   Conn
+
+	// ctx is the parent of the contexts of the watches, it is
+	// canceled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu protects the following fields.
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// lru has the paths of the entries, the most recently read first.
+	lru    *list.List
+	closed bool
+}
+
+// cacheEntry is a record watched by a CachingConn.
+type cacheEntry struct {
+	cancel context.CancelFunc
+	// elem is the element of the entry in CachingConn.lru.
+	elem *list.Element
+
+	// The following fields are protected by CachingConn.mu.
+	// ready is false until the watch returned the first value.
+	ready     bool
+	contents  []byte
+	version   Version
+	refreshed time.Time
+}
+
+// NewCachingConn returns a CachingConn. A maxEntries of 0 means that
+// the number of cached records is not limited.
+func NewCachingConn(cell string, conn Conn, maxStaleness time.Duration, maxEntries int) *CachingConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CachingConn{
+		cell:         cell,
+		conn:         conn,
+		maxStaleness: maxStaleness,
+		maxEntries:   maxEntries,
+		ctx:          ctx,
+		cancel:       cancel,
+		entries:      make(map[string]*cacheEntry),
+		lru:          list.New(),
+	}
+}
+
+// underlying returns the wrapped Conn.
+func (c *CachingConn) underlying() Conn {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.conn
+}
+
+// wrapConn replaces the wrapped Conn with wrap(conn).
+func (c *CachingConn) wrapConn(wrap func(Conn) Conn) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.conn = wrap(c.conn)
+}
+
+// isCached returns true if the reads of filePath are served from the cache.
+func isCached(filePath string) bool {
+	switch path.Base(filePath) {
+	case KeyspaceFile, ShardFile, TabletFile:
+		return true
+	}
+	return false
+}
+
+// ListDir is part of the Conn interface
+func (c *CachingConn) ListDir(ctx context.Context, dirPath string, full bool) ([]DirEntry, error) {
+	return c.underlying().ListDir(ctx, dirPath, full)
+}
+
+// Create is part of the Conn interface
+func (c *CachingConn) Create(ctx context.Context, filePath string, contents []byte) (Version, error) {
+	defer c.invalidate(filePath)
+	return c.underlying().Create(ctx, filePath, contents)
+}
+
+// Update is part of the Conn interface
+func (c *CachingConn) Update(ctx context.Context, filePath string, contents []byte, version Version) (Version, error) {
+	defer c.invalidate(filePath)
+	return c.underlying().Update(ctx, filePath, contents, version)
+}
+
+// Get is part of the Conn interface
+func (c *CachingConn) Get(ctx context.Context, filePath string) ([]byte, Version, error) {
+	if !isCached(filePath) {
+		return c.underlying().Get(ctx, filePath)
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[filePath]
+	if ok && e.ready {
+		if time.Since(e.refreshed) < c.maxStaleness {
+			c.lru.MoveToFront(e.elem)
+			contents, version := e.contents, e.version
+			c.mu.Unlock()
+			topoCachingConnHits.Add(c.cell, 1)
+			return contents, version, nil
+		}
+		// The record is too old, read it again with a new watch.
+		c.removeLocked(filePath, e)
+		ok = false
+	}
+	if !ok && !c.closed {
+		c.watchLocked(filePath)
+	}
+	c.mu.Unlock()
+
+	topoCachingConnMisses.Add(c.cell, 1)
+	return c.underlying().Get(ctx, filePath)
+}
+
+// List is part of the Conn interface
+func (c *CachingConn) List(ctx context.Context, filePathPrefix string) ([]KVInfo, error) {
+	return c.underlying().List(ctx, filePathPrefix)
+}
+
+// Delete is part of the Conn interface
+func (c *CachingConn) Delete(ctx context.Context, filePath string, version Version) error {
+	defer c.invalidate(filePath)
+	return c.underlying().Delete(ctx, filePath, version)
+}
+
+// Txn is part of the Conn interface
+func (c *CachingConn) Txn(ctx context.Context, ops []TxnOp) ([]Version, error) {
+	defer func() {
+		for _, op := range ops {
+			c.invalidate(op.Path)
+		}
+	}()
+	return c.underlying().Txn(ctx, ops)
+}
+
+// Lock is part of the Conn interface
+func (c *CachingConn) Lock(ctx context.Context, dirPath, contents string) (LockDescriptor, error) {
+	return c.underlying().Lock(ctx, dirPath, contents)
+}
+
+// LockWithTTL is part of the LeaseConn interface
+func (c *CachingConn) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (LockDescriptor, error) {
+	return lockWithTTL(ctx, c.underlying(), dirPath, contents, ttl)
+}
+
+// LockHolder is part of the LockInspectorConn interface
+func (c *CachingConn) LockHolder(ctx context.Context, dirPath string) (string, Version, error) {
+	return lockHolder(ctx, c.underlying(), dirPath)
+}
+
+// BreakLock is part of the LockInspectorConn interface
+func (c *CachingConn) BreakLock(ctx context.Context, dirPath string, version Version) error {
+	return breakLock(ctx, c.underlying(), dirPath, version)
+}
+
+// Watch is part of the Conn interface
+func (c *CachingConn) Watch(ctx context.Context, filePath string) (current *WatchData, changes <-chan *WatchData, err error) {
+	return c.underlying().Watch(ctx, filePath)
+}
+
+// WatchFrom is part of the Conn interface
+func (c *CachingConn) WatchFrom(ctx context.Context, filePath string, version Version) (<-chan *WatchData, error) {
+	return c.underlying().WatchFrom(ctx, filePath, version)
+}
+
+// WatchRecursive is part of the Conn interface
+func (c *CachingConn) WatchRecursive(ctx context.Context, path string) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error) {
+	return c.underlying().WatchRecursive(ctx, path)
+}
+
+// NewLeaderParticipation is part of the Conn interface
+func (c *CachingConn) NewLeaderParticipation(name, id string) (LeaderParticipation, error) {
+	return c.underlying().NewLeaderParticipation(name, id)
+}
+
+// Close is part of the Conn interface. It stops the watches before
+// closing the underlying Conn.
+func (c *CachingConn) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.cancel()
+	c.wg.Wait()
+	c.underlying().Close()
+}
+
+// watchLocked starts the watch that fills the entry of filePath.
+// c.mu must be held.
+func (c *CachingConn) watchLocked(filePath string) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	e := &cacheEntry{cancel: cancel}
+	e.elem = c.lru.PushFront(filePath)
+	c.entries[filePath] = e
+	topoCachingConnEntries.Add(c.cell, 1)
+	if c.maxEntries > 0 && len(c.entries) > c.maxEntries {
+		oldest := c.lru.Back().Value.(string)
+		c.removeLocked(oldest, c.entries[oldest])
+		topoCachingConnEvictions.Add(c.cell, 1)
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.remove(filePath, e)
+
+		current, changes, err := c.underlying().Watch(ctx, filePath)
+		if err != nil {
+			return
+		}
+		c.set(filePath, e, current)
+		for wd := range changes {
+			if wd.Err != nil {
+				// The watch is done, the channel will be
+				// closed right after this. The next read
+				// will start a new one.
+				c.remove(filePath, e)
+				continue
+			}
+			c.set(filePath, e, wd)
+		}
+	}()
+}
+
+// set updates the entry of filePath, unless it was replaced.
+func (c *CachingConn) set(filePath string, e *cacheEntry, wd *WatchData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[filePath] != e {
+		return
+	}
+	e.ready = true
+	e.contents = wd.Contents
+	e.version = wd.Version
+	e.refreshed = time.Now()
+}
+
+// remove drops the entry of filePath and stops its watch, unless it
+// was replaced.
+func (c *CachingConn) remove(filePath string, e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(filePath, e)
+}
+
+// removeLocked is remove with c.mu held.
+func (c *CachingConn) removeLocked(filePath string, e *cacheEntry) {
+	if c.entries[filePath] != e {
+		return
+	}
+	delete(c.entries, filePath)
+	c.lru.Remove(e.elem)
+	topoCachingConnEntries.Add(c.cell, -1)
+	e.cancel()
+}
+
+// invalidate drops the entry of filePath after a write.
+func (c *CachingConn) invalidate(filePath string) {
+	if !isCached(filePath) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[filePath]; ok {
+		c.removeLocked(filePath, e)
+	}
+}
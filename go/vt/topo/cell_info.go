@@ -170,6 +170,9 @@ func (ts *Server) DeleteCellInfo(ctx context.Context, cell string, force bool) e
 		}
 	}
 
+	if err := ts.deleteCellHeartbeat(ctx, cell); err != nil {
+		return err
+	}
 	filePath := pathForCellInfo(cell)
 	return ts.globalCell.Delete(ctx, filePath, nil)
 }
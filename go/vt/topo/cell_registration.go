@@ -0,0 +1,153 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// This file contains the self-registration of the cells: a process of
+// a cell can register the CellInfo of its cell in the global topology
+// server, instead of an operator running AddCellInfo, and update the
+// heartbeat of the cell periodically so the cells that stopped
+// updating it can be found with GetStaleCells. See the cellregistrar
+// package.
+//
+// The cells added with AddCellInfo have no heartbeat, and are never
+// stale.
+
+// CellHeartbeat is the last liveness update of a registered cell.
+// It needs to be public as we JSON-serialize it.
+type CellHeartbeat struct {
+	// HostName is the host of the process that updated it.
+	HostName string
+
+	// Time is when it was updated.
+	Time time.Time
+}
+
+func pathForCellHeartbeat(cell string) string {
+	return path.Join(CellHeartbeatsPath, cell, CellHeartbeatFile)
+}
+
+// RegisterCell registers the CellInfo of a cell, and updates its
+// heartbeat. It is a no-op if the cell already exists with the same
+// server address and root, and it fails if they are different: a
+// registration never changes the CellInfo of an existing cell.
+func (ts *Server) RegisterCell(ctx context.Context, cell string, ci *topodatapb.CellInfo) error {
+	err := ts.CreateCellInfo(ctx, cell, ci)
+	switch {
+	case IsErrType(err, NodeExists):
+		existing, err := ts.GetCellInfo(ctx, cell, true /*strongRead*/)
+		if err != nil {
+			return err
+		}
+		if existing.ServerAddress != ci.ServerAddress || existing.Root != ci.Root {
+			return vterrors.Errorf(vtrpcpb.Code_FAILED_PRECONDITION, "cell %v is already registered with a different CellInfo: %v", cell, existing)
+		}
+	case err != nil:
+		return err
+	}
+	return ts.writeCellHeartbeat(ctx, cell, nil)
+}
+
+// UpdateCellHeartbeat updates the heartbeat of a registered cell. The
+// update is conditional on the version of the heartbeat it read, so a
+// cell deleted meanwhile is not registered again: it returns NoNode if
+// the cell is not registered, and BadVersion if the heartbeat changed
+// in between.
+func (ts *Server) UpdateCellHeartbeat(ctx context.Context, cell string) error {
+	_, version, err := ts.globalCell.Get(ctx, pathForCellHeartbeat(cell))
+	if err != nil {
+		return err
+	}
+	return ts.writeCellHeartbeat(ctx, cell, version)
+}
+
+// writeCellHeartbeat writes the heartbeat of a cell, if it still has
+// the given version, or unconditionally if version is nil.
+func (ts *Server) writeCellHeartbeat(ctx context.Context, cell string, version Version) error {
+	hb := &CellHeartbeat{
+		HostName: "unknown",
+		Time:     time.Now(),
+	}
+	if h, err := os.Hostname(); err == nil {
+		hb.HostName = h
+	}
+	data, err := json.MarshalIndent(hb, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = ts.globalCell.Update(ctx, pathForCellHeartbeat(cell), data, version)
+	return err
+}
+
+// GetCellHeartbeat returns the heartbeat of a cell. It returns NoNode
+// if the cell was not registered with RegisterCell.
+func (ts *Server) GetCellHeartbeat(ctx context.Context, cell string) (*CellHeartbeat, error) {
+	filePath := pathForCellHeartbeat(cell)
+	data, _, err := ts.globalCell.Get(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	hb := &CellHeartbeat{}
+	if err := json.Unmarshal(data, hb); err != nil {
+		return nil, vterrors.Wrapf(err, "bad cell heartbeat in %v", filePath)
+	}
+	return hb, nil
+}
+
+// deleteCellHeartbeat deletes the heartbeat of a cell, if any.
+func (ts *Server) deleteCellHeartbeat(ctx context.Context, cell string) error {
+	err := ts.globalCell.Delete(ctx, pathForCellHeartbeat(cell), nil)
+	if err != nil && !IsErrType(err, NoNode) {
+		return err
+	}
+	return nil
+}
+
+// GetStaleCells returns the registered cells whose heartbeat was not
+// updated for more than maxAge, sorted by name.
+func (ts *Server) GetStaleCells(ctx context.Context, maxAge time.Duration) ([]string, error) {
+	cells, err := ts.GetCellInfoNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, cell := range cells {
+		hb, err := ts.GetCellHeartbeat(ctx, cell)
+		switch {
+		case IsErrType(err, NoNode):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if time.Since(hb.Time) > maxAge {
+			stale = append(stale, cell)
+		}
+	}
+	return stale, nil
+}
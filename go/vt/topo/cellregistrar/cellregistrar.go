@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cellregistrar registers the cell of a process in the global
+// topology server, with the address and root of the topology server
+// of the cell, so a new cell doesn't need an AddCellInfo. It then
+// updates the heartbeat of the cell periodically, so the cells that
+// are gone can be found with topo.Server.GetStaleCells.
+package cellregistrar
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/topo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	cell          = flag.String("topo_register_cell", "", "if set, register this cell in the global topology server, with the address and root of its topology server, and update its heartbeat periodically. Disabled if empty.")
+	serverAddress = flag.String("topo_register_cell_server_address", "", "the address of the topology server of the cell registered with --topo_register_cell")
+	root          = flag.String("topo_register_cell_root", "", "the root of the topology server of the cell registered with --topo_register_cell")
+	interval      = flag.Duration("topo_register_cell_heartbeat_interval", time.Minute, "how often to update the heartbeat of the cell registered with --topo_register_cell")
+)
+
+// Registrar registers a cell, then updates its heartbeat, until it is
+// stopped.
+type Registrar struct {
+	ts       *topo.Server
+	cell     string
+	cellInfo *topodatapb.CellInfo
+	interval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Init starts registering the cell set with --topo_register_cell in
+// ts, the topology server of the process. It returns nil if the flag
+// is not set. The Registrar must be stopped before ts is closed.
+func Init(ts *topo.Server) *Registrar {
+	if *cell == "" {
+		return nil
+	}
+	return Start(ts, *cell, &topodatapb.CellInfo{
+		ServerAddress: *serverAddress,
+		Root:          *root,
+	}, *interval)
+}
+
+// Start returns a Registrar registering the cell with the given
+// CellInfo, then updating its heartbeat every interval. The
+// registration is retried at the same interval until it succeeds.
+// Stop must be called to stop it.
+func Start(ts *topo.Server, cell string, ci *topodatapb.CellInfo, interval time.Duration) *Registrar {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Registrar{
+		ts:       ts,
+		cell:     cell,
+		cellInfo: ci,
+		interval: interval,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Stop stops updating the heartbeat of the cell. The cell stays
+// registered.
+func (r *Registrar) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *Registrar) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	registered := false
+	for {
+		if registered {
+			r.heartbeat(ctx)
+		} else {
+			registered = r.register(ctx)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// register registers the cell, and returns true if it succeeded.
+func (r *Registrar) register(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, *topo.RemoteOperationTimeout)
+	defer cancel()
+	if err := r.ts.RegisterCell(ctx, r.cell, r.cellInfo); err != nil {
+		log.Errorf("Cannot register cell %v: %v", r.cell, err)
+		return false
+	}
+	log.Infof("Registered cell %v: %v", r.cell, r.cellInfo)
+	return true
+}
+
+// heartbeat updates the heartbeat of the cell, unless it was deleted:
+// an operator deleting the cell is not overridden.
+func (r *Registrar) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, *topo.RemoteOperationTimeout)
+	defer cancel()
+	err := r.ts.UpdateCellHeartbeat(ctx, r.cell)
+	switch {
+	case topo.IsErrType(err, topo.NoNode):
+		log.Warningf("Cell %v was deleted, not updating its heartbeat", r.cell)
+	case topo.IsErrType(err, topo.BadVersion):
+		// Another process of the cell updated it in the meantime.
+	case err != nil:
+		log.Warningf("Cannot update the heartbeat of cell %v: %v", r.cell, err)
+	}
+}
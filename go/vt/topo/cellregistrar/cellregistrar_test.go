@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cellregistrar
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestRegistrar(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	r := Start(ts, "cell2", &topodatapb.CellInfo{ServerAddress: "cell2-topo:2379", Root: "/vitess/cell2"}, 10*time.Millisecond)
+	defer r.Stop()
+
+	// The cell is registered, and its heartbeat is updated.
+	var first time.Time
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		hb, err := ts.GetCellHeartbeat(ctx, "cell2")
+		if err != nil {
+			continue
+		}
+		if first.IsZero() {
+			first = hb.Time
+			continue
+		}
+		if hb.Time.After(first) {
+			break
+		}
+	}
+	hb, err := ts.GetCellHeartbeat(ctx, "cell2")
+	require.NoError(t, err)
+	assert.True(t, hb.Time.After(first), "heartbeat was not updated")
+	ci, err := ts.GetCellInfo(ctx, "cell2", true /*strongRead*/)
+	require.NoError(t, err)
+	assert.Equal(t, "/vitess/cell2", ci.Root)
+
+	// Once the cell is deleted, its heartbeat is not updated anymore.
+	require.NoError(t, ts.DeleteCellInfo(ctx, "cell2", true /*force*/))
+	time.Sleep(50 * time.Millisecond)
+	_, err = ts.GetCellHeartbeat(ctx, "cell2")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
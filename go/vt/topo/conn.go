@@ -19,6 +19,7 @@ package topo
 import (
 	"context"
 	"sort"
+	"time"
 )
 
 // Conn defines the interface that must be implemented by topology
@@ -92,6 +93,18 @@ type Conn interface {
 	// Returns ErrBadVersion if the provided version is not current.
 	Delete(ctx context.Context, filePath string, version Version) error
 
+	// Txn applies the operations atomically: either all of them
+	// are applied, or none is. See TxnOp for the conditions of
+	// each operation. A path can only appear once in ops.
+	// It returns the new Version of each file created or updated,
+	// and nil for the other operations, in the order of ops.
+	// If a condition doesn't hold, it returns the error of
+	// the operation as Create, Update or Delete would:
+	// ErrNodeExists, ErrNoNode or ErrBadVersion.
+	// Returns ErrNoImplementation if the backend doesn't support
+	// transactions.
+	Txn(ctx context.Context, ops []TxnOp) ([]Version, error)
+
 	//
 	// Locks
 	//
@@ -155,6 +168,22 @@ type Conn interface {
 	// filePath is a path relative to the root directory of the cell.
 	Watch(ctx context.Context, filePath string) (current *WatchData, changes <-chan *WatchData, err error)
 
+	// WatchFrom resumes a watch of a file, for instance after the
+	// previous one failed because of a disconnection. version is
+	// the Version of the last value the caller received, which
+	// acts as a resume token: there is no need to read the file
+	// again. The 'changes' channel has the same contract as the
+	// one of Watch, and starts with the changes that happened
+	// after version, if any. The implementations that keep the
+	// history of the files replay all of them, the others send
+	// the current value. If the file was deleted since, the first
+	// record has Err = ErrNoNode. A nil version starts from the
+	// current value, like Watch.
+	// The backends without history can use EmulateWatchFrom.
+	//
+	// filePath is a path relative to the root directory of the cell.
+	WatchFrom(ctx context.Context, filePath string, version Version) (changes <-chan *WatchData, err error)
+
 	// WatchRecursive starts watching a file prefix in the provided cell. It
 	// returns all the current values for existing files with the given
 	// prefix, a 'changes' channel  to read the changes from and an error.
@@ -190,6 +219,9 @@ type Conn interface {
 	// eventually converge. Vitess doesn't explicitly depend on the data
 	// being correct quickly, as long as it eventually gets there.
 	//
+	// The backends that can't watch a prefix natively can use
+	// EmulateWatchRecursive.
+	//
 	// path is a path relative to the root directory of the cell.
 	WatchRecursive(ctx context.Context, path string) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error)
 
@@ -283,6 +315,61 @@ type LockDescriptor interface {
 	Unlock(ctx context.Context) error
 }
 
+// LeaseConn is implemented by the Conn that can take locks with a given
+// lease: a lock whose holder stops renewing it, like after a crash, is
+// released when its lease expires.
+type LeaseConn interface {
+	// LockWithTTL is like Lock, with a lease of ttl instead of
+	// the default one of the implementation.
+	LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (LockDescriptor, error)
+}
+
+// lockWithTTL takes a lock on conn with a lease of ttl if conn is a
+// LeaseConn, and with the default lease of the implementation
+// otherwise.
+func lockWithTTL(ctx context.Context, conn Conn, dirPath, contents string, ttl time.Duration) (LockDescriptor, error) {
+	if lc, ok := conn.(LeaseConn); ok && ttl > 0 {
+		ld, err := lc.LockWithTTL(ctx, dirPath, contents, ttl)
+		if !IsErrType(err, NoImplementation) {
+			return ld, err
+		}
+	}
+	return conn.Lock(ctx, dirPath, contents)
+}
+
+// LockInspectorConn is implemented by the Conn that can report the
+// holder of a lock, and break it when the holder is stuck.
+type LockInspectorConn interface {
+	// LockHolder returns the contents of the lock on dirPath, as
+	// given to Lock by its holder, and the version of this holding
+	// of the lock. It returns NoNode if dirPath is not locked.
+	LockHolder(ctx context.Context, dirPath string) (string, Version, error)
+
+	// BreakLock releases the lock on dirPath, if it is still held
+	// with the version returned by LockHolder. The next waiter, if
+	// any, gets the lock. It returns NoNode if dirPath is not
+	// locked, and BadVersion if it was locked again since.
+	BreakLock(ctx context.Context, dirPath string, version Version) error
+}
+
+// lockHolder calls LockHolder on conn if it is a LockInspectorConn,
+// and returns NoImplementation otherwise.
+func lockHolder(ctx context.Context, conn Conn, dirPath string) (string, Version, error) {
+	if lic, ok := conn.(LockInspectorConn); ok {
+		return lic.LockHolder(ctx, dirPath)
+	}
+	return "", nil, NewError(NoImplementation, dirPath)
+}
+
+// breakLock calls BreakLock on conn if it is a LockInspectorConn,
+// and returns NoImplementation otherwise.
+func breakLock(ctx context.Context, conn Conn, dirPath string, version Version) error {
+	if lic, ok := conn.(LockInspectorConn); ok {
+		return lic.BreakLock(ctx, dirPath, version)
+	}
+	return NewError(NoImplementation, dirPath)
+}
+
 // CancelFunc is returned by the Watch method.
 type CancelFunc func()
 
@@ -167,3 +167,89 @@ func (s *Server) Delete(ctx context.Context, filePath string, version topo.Versi
 	}
 	return nil
 }
+
+// Txn is part of the topo.Conn interface.
+func (s *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	// Like in Delete, a Get comes before the operations that need
+	// the node to exist, so we know if a rolled back transaction
+	// failed because a node didn't exist, or because it had a bad
+	// version. failures has the error of each consul operation,
+	// in case it fails.
+	var txnOps api.KVTxnOps
+	var failures []error
+	for _, op := range ops {
+		nodePath := path.Join(s.root, op.Path)
+		if op.Type != topo.TxnCreate && (op.Type != topo.TxnUpdate || op.Version != nil) {
+			txnOps = append(txnOps, &api.KVTxnOp{
+				Verb: api.KVGet,
+				Key:  nodePath,
+			})
+			failures = append(failures, topo.NewError(topo.NoNode, nodePath))
+		}
+
+		txnOp := &api.KVTxnOp{Key: nodePath}
+		failure := topo.NewError(topo.BadVersion, nodePath)
+		switch op.Type {
+		case topo.TxnCreate:
+			txnOp.Verb = api.KVCAS
+			txnOp.Value = op.Contents
+			failure = topo.NewError(topo.NodeExists, nodePath)
+		case topo.TxnUpdate:
+			txnOp.Verb = api.KVSet
+			txnOp.Value = op.Contents
+			if op.Version != nil {
+				txnOp.Verb = api.KVCAS
+				txnOp.Index = uint64(op.Version.(ConsulVersion))
+			}
+		case topo.TxnDelete:
+			txnOp.Verb = api.KVDelete
+			if op.Version != nil {
+				txnOp.Verb = api.KVDeleteCAS
+				txnOp.Index = uint64(op.Version.(ConsulVersion))
+			}
+		case topo.TxnCheck:
+			txnOp.Verb = api.KVCheckIndex
+			txnOp.Index = uint64(op.Version.(ConsulVersion))
+		}
+		txnOps = append(txnOps, txnOp)
+		failures = append(failures, failure)
+	}
+
+	ok, resp, _, err := s.kv.Txn(txnOps, nil)
+	if err != nil {
+		// Communication error.
+		return nil, convertError(err, s.root)
+	}
+	if !ok {
+		// Transaction was rolled back, see which operation failed.
+		if len(resp.Errors) == 0 || resp.Errors[0].OpIndex < 0 || resp.Errors[0].OpIndex >= len(failures) {
+			return nil, ErrBadResponse
+		}
+		return nil, failures[resp.Errors[0].OpIndex]
+	}
+
+	// The deletes have no result, so we find the results of the
+	// writes by their keys. A write comes after the Get of its key.
+	indexes := make(map[string]uint64, len(resp.Results))
+	for _, result := range resp.Results {
+		if result != nil {
+			indexes[result.Key] = result.ModifyIndex
+		}
+	}
+	versions := make([]topo.Version, len(ops))
+	for i, op := range ops {
+		if op.Type != topo.TxnCreate && op.Type != topo.TxnUpdate {
+			continue
+		}
+		index, ok := indexes[path.Join(s.root, op.Path)]
+		if !ok {
+			return nil, ErrBadResponse
+		}
+		versions[i] = ConsulVersion(index)
+	}
+	return versions, nil
+}
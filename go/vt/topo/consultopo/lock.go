@@ -121,6 +121,77 @@ func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockD
 	}, nil
 }
 
+// consulLockVersion is the version of a holding of a lock: the
+// session of the holder.
+// It implements topo.Version.
+type consulLockVersion string
+
+// String is part of the topo.Version interface.
+func (v consulLockVersion) String() string {
+	return string(v)
+}
+
+// lockHolderPair returns the key of the lock on dirPath, if it is held
+// by a session.
+func (s *Server) lockHolderPair(ctx context.Context, dirPath string) (*api.KVPair, error) {
+	lockPath := path.Join(s.root, dirPath, locksFilename)
+	pair, _, err := s.kv.Get(lockPath, (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
+	if err != nil {
+		return nil, convertError(err, dirPath)
+	}
+	if pair == nil || pair.Session == "" {
+		return nil, topo.NewError(topo.NoNode, dirPath)
+	}
+	return pair, nil
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (s *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	pair, err := s.lockHolderPair(ctx, dirPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(pair.Value), consulLockVersion(pair.Session), nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It releases the key of the lock if it is still held by the session of
+// the version, then destroys the session, so the holder loses the lock.
+func (s *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(consulLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	pair, err := s.lockHolderPair(ctx, dirPath)
+	if err != nil {
+		return err
+	}
+	if pair.Session != string(v) {
+		return topo.NewError(topo.BadVersion, dirPath)
+	}
+
+	// Release only succeeds if the key is still held by the session.
+	writeOpts := (&api.WriteOptions{}).WithContext(ctx)
+	released, _, err := s.kv.Release(pair, writeOpts)
+	if err != nil {
+		return convertError(err, dirPath)
+	}
+	if !released {
+		// The holder released the lock: it is not locked, or it
+		// was locked again.
+		if _, err := s.lockHolderPair(ctx, dirPath); err != nil {
+			return err
+		}
+		return topo.NewError(topo.BadVersion, dirPath)
+	}
+
+	if _, err := s.client.Session().Destroy(string(v), writeOpts); err != nil {
+		// The lock is released, the holder only notices it later.
+		log.Warningf("Destroy(%v) of the session of the broken lock on %v failed: %v", v, dirPath, err)
+	}
+	return nil
+}
+
 // Check is part of the topo.LockDescriptor interface.
 func (ld *consulLockDescriptor) Check(ctx context.Context) error {
 	select {
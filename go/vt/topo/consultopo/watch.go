@@ -129,11 +129,17 @@ func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <
 	return wd, notifications, nil
 }
 
+// WatchFrom is part of the topo.Conn interface.
+func (s *Server) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, s, filePath, version)
+}
+
 // WatchRecursive is part of the topo.Conn interface.
-func (s *Server) WatchRecursive(_ context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
-	// This isn't implemented yet, but likely can be implemented using List
-	// with blocking logic like how we use Get with blocking for regular Watch.
+func (s *Server) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
+	// This is emulated with a watch per file for now, but likely can be
+	// implemented natively using List with blocking logic like how we use
+	// Get with blocking for regular Watch.
 	// See also how https://www.consul.io/docs/dynamic-app-config/watches#keyprefix
 	// works under the hood.
-	return nil, nil, topo.NewError(topo.NoImplementation, path)
+	return topo.EmulateWatchRecursive(ctx, s, path, topo.WatchRecursivePollInterval)
 }
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// ListDir is part of the topo.Conn interface.
+func (s *Server) ListDir(ctx context.Context, dirPath string, full bool) ([]topo.DirEntry, error) {
+	nodePath := path.Join("/", dirPath) + "/"
+	if nodePath == "//" {
+		// Special case where dirPath is "/", we would end up
+		// with "//". in that case, we want "/".
+		nodePath = "/"
+	}
+
+	var keys []string
+	err := s.queryPrefix(ctx, nodePath, func(item map[string]*dynamodb.AttributeValue) error {
+		keys = append(keys, aws.StringValue(item[pathAttr].S))
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err, nodePath)
+	}
+	if len(keys) == 0 {
+		// No file starts with this prefix, means the directory
+		// doesn't exist.
+		return nil, topo.NewError(topo.NoNode, nodePath)
+	}
+
+	prefixLen := len(nodePath)
+	var result []topo.DirEntry
+	for _, p := range keys {
+		// Remove the prefix, base path.
+		p = p[prefixLen:]
+
+		// Keep only the part until the first '/'.
+		t := topo.TypeFile
+		if i := strings.Index(p, "/"); i >= 0 {
+			p = p[:i]
+			t = topo.TypeDirectory
+		}
+
+		// Remove duplicates, add to list. The files of a
+		// directory are next to each other, as the paths are
+		// sorted.
+		if len(result) == 0 || result[len(result)-1].Name != p {
+			e := topo.DirEntry{
+				Name: p,
+			}
+			if full {
+				e.Type = t
+			}
+			result = append(result, e)
+		}
+	}
+
+	// A file like 'a.b' is sorted between the directory 'a' and its
+	// files, so we sort the names again.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// Errors specific to this package.
+var (
+	// ErrBadResponse is returned from this package if an item
+	// returned by DynamoDB doesn't have the attributes we wrote.
+	ErrBadResponse = errors.New("dynamodb request returned success, but the item is missing required data")
+)
+
+// convertError converts a context error into a topo error. All errors
+// are either AWS errors, or context errors.
+func convertError(err error, nodePath string) error {
+	// The AWS client wraps the context errors.
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == request.CanceledErrorCode {
+		if awsErr.OrigErr() != nil {
+			err = awsErr.OrigErr()
+		}
+	}
+
+	switch err {
+	case context.Canceled:
+		return topo.NewError(topo.Interrupted, nodePath)
+	case context.DeadlineExceeded:
+		return topo.NewError(topo.Timeout, nodePath)
+	}
+	return err
+}
+
+// isConditionalCheckFailed returns true if err is the failure of the
+// condition of a write.
+func isConditionalCheckFailed(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
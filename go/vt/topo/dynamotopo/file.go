@@ -0,0 +1,350 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"path"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// Create is part of the topo.Conn interface.
+func (s *Server) Create(ctx context.Context, filePath string, contents []byte) (topo.Version, error) {
+	nodePath := path.Join("/", filePath)
+
+	version, err := s.nextVersions(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(s.table),
+		Item:                     s.fileItem(nodePath, contents, version),
+		ConditionExpression:      aws.String("attribute_not_exists(#p)"),
+		ExpressionAttributeNames: map[string]*string{"#p": aws.String(pathAttr)},
+	})
+	if isConditionalCheckFailed(err) {
+		return nil, topo.NewError(topo.NodeExists, nodePath)
+	}
+	if err != nil {
+		return nil, convertError(err, nodePath)
+	}
+	return version, nil
+}
+
+// Update is part of the topo.Conn interface.
+func (s *Server) Update(ctx context.Context, filePath string, contents []byte, version topo.Version) (topo.Version, error) {
+	nodePath := path.Join("/", filePath)
+
+	newVersion, err := s.nextVersions(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      s.fileItem(nodePath, contents, newVersion),
+	}
+	if version != nil {
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = versionCondition(version)
+	}
+	if _, err := s.client.PutItemWithContext(ctx, input); err != nil {
+		if isConditionalCheckFailed(err) {
+			return nil, s.conditionError(ctx, nodePath)
+		}
+		return nil, convertError(err, nodePath)
+	}
+	return newVersion, nil
+}
+
+// Get is part of the topo.Conn interface.
+func (s *Server) Get(ctx context.Context, filePath string) ([]byte, topo.Version, error) {
+	nodePath := path.Join("/", filePath)
+
+	out, err := s.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            s.key(nodePath),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, nil, convertError(err, nodePath)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil, topo.NewError(topo.NoNode, nodePath)
+	}
+	contents, version, err := parseFileItem(out.Item)
+	if err != nil {
+		return nil, nil, err
+	}
+	return contents, version, nil
+}
+
+// List is part of the topo.Conn interface.
+func (s *Server) List(ctx context.Context, filePathPrefix string) ([]topo.KVInfo, error) {
+	nodePathPrefix := path.Join("/", filePathPrefix)
+
+	var results []topo.KVInfo
+	err := s.queryPrefix(ctx, nodePathPrefix, func(item map[string]*dynamodb.AttributeValue) error {
+		contents, version, err := parseFileItem(item)
+		if err != nil {
+			return err
+		}
+		results = append(results, topo.KVInfo{
+			Key:     []byte(path.Join(s.root, aws.StringValue(item[pathAttr].S))),
+			Value:   contents,
+			Version: version,
+		})
+		return nil
+	})
+	if err != nil {
+		return []topo.KVInfo{}, convertError(err, nodePathPrefix)
+	}
+	if len(results) == 0 {
+		return []topo.KVInfo{}, topo.NewError(topo.NoNode, nodePathPrefix)
+	}
+	return results, nil
+}
+
+// Delete is part of the topo.Conn interface.
+func (s *Server) Delete(ctx context.Context, filePath string, version topo.Version) error {
+	nodePath := path.Join("/", filePath)
+
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key:       s.key(nodePath),
+	}
+	if version != nil {
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = versionCondition(version)
+	} else {
+		input.ConditionExpression = aws.String("attribute_exists(#p)")
+		input.ExpressionAttributeNames = map[string]*string{"#p": aws.String(pathAttr)}
+	}
+	if _, err := s.client.DeleteItemWithContext(ctx, input); err != nil {
+		if isConditionalCheckFailed(err) {
+			return s.conditionError(ctx, nodePath)
+		}
+		return convertError(err, nodePath)
+	}
+	return nil
+}
+
+// Txn is part of the topo.Conn interface.
+func (s *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	// Take a version for each created or updated file.
+	writes := 0
+	for _, op := range ops {
+		if op.Type == topo.TxnCreate || op.Type == topo.TxnUpdate {
+			writes++
+		}
+	}
+	var next DynamoVersion
+	if writes > 0 {
+		var err error
+		if next, err = s.nextVersions(ctx, writes); err != nil {
+			return nil, err
+		}
+	}
+
+	versions := make([]topo.Version, len(ops))
+	items := make([]*dynamodb.TransactWriteItem, len(ops))
+	for i, op := range ops {
+		nodePath := path.Join("/", op.Path)
+		switch op.Type {
+		case topo.TxnCreate:
+			version := next
+			next++
+			items[i] = &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+				TableName:                           aws.String(s.table),
+				Item:                                s.fileItem(nodePath, op.Contents, version),
+				ConditionExpression:                 aws.String("attribute_not_exists(#p)"),
+				ExpressionAttributeNames:            map[string]*string{"#p": aws.String(pathAttr)},
+				ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			}}
+			versions[i] = version
+		case topo.TxnUpdate:
+			version := next
+			next++
+			put := &dynamodb.Put{
+				TableName:                           aws.String(s.table),
+				Item:                                s.fileItem(nodePath, op.Contents, version),
+				ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			}
+			if op.Version != nil {
+				put.ConditionExpression, put.ExpressionAttributeNames, put.ExpressionAttributeValues = versionCondition(op.Version)
+			}
+			items[i] = &dynamodb.TransactWriteItem{Put: put}
+			versions[i] = version
+		case topo.TxnDelete:
+			del := &dynamodb.Delete{
+				TableName:                           aws.String(s.table),
+				Key:                                 s.key(nodePath),
+				ConditionExpression:                 aws.String("attribute_exists(#p)"),
+				ExpressionAttributeNames:            map[string]*string{"#p": aws.String(pathAttr)},
+				ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			}
+			if op.Version != nil {
+				del.ConditionExpression, del.ExpressionAttributeNames, del.ExpressionAttributeValues = versionCondition(op.Version)
+			}
+			items[i] = &dynamodb.TransactWriteItem{Delete: del}
+		case topo.TxnCheck:
+			check := &dynamodb.ConditionCheck{
+				TableName:                           aws.String(s.table),
+				Key:                                 s.key(nodePath),
+				ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+			}
+			check.ConditionExpression, check.ExpressionAttributeNames, check.ExpressionAttributeValues = versionCondition(op.Version)
+			items[i] = &dynamodb.TransactWriteItem{ConditionCheck: check}
+		}
+	}
+
+	_, err := s.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if canceled, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		// The reasons are in the order of the items, the failed
+		// conditions have the code ConditionalCheckFailed.
+		for i, reason := range canceled.CancellationReasons {
+			if i >= len(ops) || aws.StringValue(reason.Code) != "ConditionalCheckFailed" {
+				continue
+			}
+			nodePath := path.Join("/", ops[i].Path)
+			switch {
+			case ops[i].Type == topo.TxnCreate:
+				return nil, topo.NewError(topo.NodeExists, nodePath)
+			case len(reason.Item) == 0:
+				return nil, topo.NewError(topo.NoNode, nodePath)
+			default:
+				return nil, topo.NewError(topo.BadVersion, nodePath)
+			}
+		}
+	}
+	if err != nil {
+		return nil, convertError(err, s.root)
+	}
+	return versions, nil
+}
+
+// key returns the primary key of the item of a file or lock.
+func (s *Server) key(nodePath string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		cellAttr: {S: aws.String(s.root)},
+		pathAttr: {S: aws.String(nodePath)},
+	}
+}
+
+// fileItem returns the item of a file.
+func (s *Server) fileItem(nodePath string, contents []byte, version DynamoVersion) map[string]*dynamodb.AttributeValue {
+	item := s.key(nodePath)
+	// An empty binary attribute is rejected by some DynamoDB
+	// versions, so an empty file has no contents attribute.
+	if len(contents) > 0 {
+		item[contentsAttr] = &dynamodb.AttributeValue{B: contents}
+	}
+	item[versionAttr] = versionValue(version)
+	return item
+}
+
+// parseFileItem returns the contents and version of the item of a file.
+func parseFileItem(item map[string]*dynamodb.AttributeValue) ([]byte, DynamoVersion, error) {
+	v, ok := item[versionAttr]
+	if !ok || v.N == nil {
+		return nil, 0, ErrBadResponse
+	}
+	version, err := strconv.ParseUint(*v.N, 10, 64)
+	if err != nil {
+		return nil, 0, ErrBadResponse
+	}
+	var contents []byte
+	if c, ok := item[contentsAttr]; ok {
+		contents = c.B
+	}
+	return contents, DynamoVersion(version), nil
+}
+
+// versionValue returns the attribute value of a version.
+func versionValue(version DynamoVersion) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(version.String())}
+}
+
+// versionCondition returns the condition expression of a write that
+// requires the file to have the given version.
+func versionCondition(version topo.Version) (*string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	return aws.String("#v = :v"),
+		map[string]*string{"#v": aws.String(versionAttr)},
+		map[string]*dynamodb.AttributeValue{":v": versionValue(version.(DynamoVersion))}
+}
+
+// conditionError returns the error of a write with a failed condition:
+// ErrNoNode if the file doesn't exist, and ErrBadVersion if it has
+// another version.
+func (s *Server) conditionError(ctx context.Context, nodePath string) error {
+	out, err := s.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(s.table),
+		Key:                  s.key(nodePath),
+		ConsistentRead:       aws.Bool(true),
+		ProjectionExpression: aws.String("#p"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String(pathAttr),
+		},
+	})
+	if err != nil {
+		return convertError(err, nodePath)
+	}
+	if len(out.Item) == 0 {
+		return topo.NewError(topo.NoNode, nodePath)
+	}
+	return topo.NewError(topo.BadVersion, nodePath)
+}
+
+// queryPrefix calls fn on each item of a file whose path starts with
+// prefix, sorted by path. Locks are not returned, as their path starts
+// with "lock:".
+func (s *Server) queryPrefix(ctx context.Context, prefix string, fn func(map[string]*dynamodb.AttributeValue) error) error {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("#c = :c AND begins_with(#p, :p)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#c": aws.String(cellAttr),
+			"#p": aws.String(pathAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":c": {S: aws.String(s.root)},
+			":p": {S: aws.String(prefix)},
+		},
+	}
+	var fnErr error
+	err := s.client.QueryPagesWithContext(ctx, input, func(out *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range out.Items {
+			if fnErr = fn(item); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
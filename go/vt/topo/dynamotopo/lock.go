@@ -0,0 +1,348 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+const (
+	// lockPrefix starts the path of the items of the locks, so they
+	// are not files.
+	lockPrefix = "lock:"
+)
+
+// lockRetryInterval is the time between two attempts to get a lock
+// held by someone else.
+var lockRetryInterval = 100 * time.Millisecond
+
+// dynamoLockDescriptor implements topo.LockDescriptor.
+type dynamoLockDescriptor struct {
+	s        *Server
+	lockPath string
+	owner    string
+	ttl      time.Duration
+
+	// stop is closed by Unlock, to stop renewing the lease.
+	stop chan struct{}
+	// done is closed when the lease is not renewed any more.
+	done chan struct{}
+	// lost is closed if the lease expired before it was renewed.
+	lost chan struct{}
+}
+
+// Lock is part of the topo.Conn interface.
+func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockDescriptor, error) {
+	return s.LockWithTTL(ctx, dirPath, contents, s.lockTTL)
+}
+
+// LockWithTTL is part of the topo.LeaseConn interface.
+func (s *Server) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (topo.LockDescriptor, error) {
+	// We list the directory first to make sure it exists.
+	if _, err := s.ListDir(ctx, dirPath, false /*full*/); err != nil {
+		return nil, convertError(err, dirPath)
+	}
+
+	lockPath := lockPrefix + path.Join("/", dirPath)
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.lock(ctx, lockPath, contents, owner, ttl); err != nil {
+		return nil, err
+	}
+	return s.newLockDescriptor(lockPath, owner, ttl), nil
+}
+
+// dynamoLockVersion is the version of a holding of a lock: the owner
+// of its item.
+// It implements topo.Version.
+type dynamoLockVersion string
+
+// String is part of the topo.Version interface.
+func (v dynamoLockVersion) String() string {
+	return string(v)
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (s *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	lockPath := lockPrefix + path.Join("/", dirPath)
+	item, err := s.lockItem(ctx, lockPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if item == nil {
+		return "", nil, topo.NewError(topo.NoNode, dirPath)
+	}
+	return aws.StringValue(item[contentsAttr].S), dynamoLockVersion(aws.StringValue(item[ownerAttr].S)), nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It deletes the item of the lock if it still has the owner of the
+// version. The holder then fails to renew its lease.
+func (s *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(dynamoLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	lockPath := lockPrefix + path.Join("/", dirPath)
+	_, err := s.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(s.table),
+		Key:                      s.key(lockPath),
+		ConditionExpression:      aws.String("#o = :o"),
+		ExpressionAttributeNames: map[string]*string{"#o": aws.String(ownerAttr)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":o": {S: aws.String(string(v))},
+		},
+	})
+	if !isConditionalCheckFailed(err) {
+		return convertError(err, dirPath)
+	}
+
+	// The holder released the lock: it is not locked, or it was
+	// locked again.
+	item, err := s.lockItem(ctx, lockPath)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return topo.NewError(topo.NoNode, dirPath)
+	}
+	return topo.NewError(topo.BadVersion, dirPath)
+}
+
+// newLockOwner returns a random identifier for the holder of a lock.
+func newLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// lock waits until it can write the item of lockPath, or until ctx is
+// done. The item can be written if it doesn't exist, or if its lease
+// expired.
+func (s *Server) lock(ctx context.Context, lockPath, contents, owner string, ttl time.Duration) error {
+	for {
+		now := time.Now()
+		item := s.key(lockPath)
+		item[contentsAttr] = &dynamodb.AttributeValue{S: aws.String(contents)}
+		item[ownerAttr] = &dynamodb.AttributeValue{S: aws.String(owner)}
+		for name, value := range leaseValues(now, ttl) {
+			item[name] = value
+		}
+		_, err := s.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(s.table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(#p) OR #e < :now"),
+			ExpressionAttributeNames: map[string]*string{
+				"#p": aws.String(pathAttr),
+				"#e": aws.String(expiresAttr),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":now": millisValue(now),
+			},
+		})
+		if err == nil {
+			return nil
+		}
+		if !isConditionalCheckFailed(err) {
+			return convertError(err, lockPath)
+		}
+
+		// Someone else has the lock.
+		select {
+		case <-ctx.Done():
+			return convertError(ctx.Err(), lockPath)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// leaseValues returns the attributes of a lease of ttl taken or
+// renewed at now: its expiration time in milliseconds, and the same time in
+// seconds for the TTL of the table.
+func leaseValues(now time.Time, ttl time.Duration) map[string]*dynamodb.AttributeValue {
+	expires := now.Add(ttl)
+	return map[string]*dynamodb.AttributeValue{
+		expiresAttr: millisValue(expires),
+		ttlAttr:     {N: aws.String(strconv.FormatInt(expires.Unix()+1, 10))},
+	}
+}
+
+// millisValue returns the attribute value of a time, in milliseconds.
+func millisValue(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.UnixMilli(), 10))}
+}
+
+// newLockDescriptor returns the descriptor of a lock we hold, and
+// starts renewing its lease.
+func (s *Server) newLockDescriptor(lockPath, owner string, ttl time.Duration) *dynamoLockDescriptor {
+	ld := &dynamoLockDescriptor{
+		s:        s,
+		lockPath: lockPath,
+		owner:    owner,
+		ttl:      ttl,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	go ld.renew()
+	return ld
+}
+
+// renew renews the lease of the lock every third of its duration,
+// until Unlock is called or the lock is lost.
+func (ld *dynamoLockDescriptor) renew() {
+	defer close(ld.done)
+
+	ticker := time.NewTicker(ld.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ld.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ld.s.mu.Lock()
+		closed := ld.s.closed
+		ld.s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		lease := leaseValues(time.Now(), ld.ttl)
+		ctx, cancel := context.WithTimeout(context.Background(), *topo.RemoteOperationTimeout)
+		_, err := ld.s.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(ld.s.table),
+			Key:                 ld.s.key(ld.lockPath),
+			UpdateExpression:    aws.String("SET #e = :e, #t = :t"),
+			ConditionExpression: aws.String("#o = :o"),
+			ExpressionAttributeNames: map[string]*string{
+				"#e": aws.String(expiresAttr),
+				"#t": aws.String(ttlAttr),
+				"#o": aws.String(ownerAttr),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":e": lease[expiresAttr],
+				":t": lease[ttlAttr],
+				":o": {S: aws.String(ld.owner)},
+			},
+		})
+		cancel()
+		switch {
+		case isConditionalCheckFailed(err):
+			log.Errorf("lost lock %v, its lease expired", ld.lockPath)
+			close(ld.lost)
+			return
+		case err != nil:
+			// We will try again at the next tick, the lease
+			// may not be expired yet.
+			log.Warningf("failed to renew the lease of lock %v: %v", ld.lockPath, err)
+		}
+	}
+}
+
+// Check is part of the topo.LockDescriptor interface.
+func (ld *dynamoLockDescriptor) Check(ctx context.Context) error {
+	select {
+	case <-ld.lost:
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.lockPath)
+	default:
+	}
+
+	owner, err := ld.s.lockAttribute(ctx, ld.lockPath, ownerAttr)
+	if err != nil {
+		return err
+	}
+	if owner != ld.owner {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.lockPath)
+	}
+	return nil
+}
+
+// Unlock is part of the topo.LockDescriptor interface.
+func (ld *dynamoLockDescriptor) Unlock(ctx context.Context) error {
+	close(ld.stop)
+	<-ld.done
+
+	_, err := ld.s.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(ld.s.table),
+		Key:                      ld.s.key(ld.lockPath),
+		ConditionExpression:      aws.String("#o = :o"),
+		ExpressionAttributeNames: map[string]*string{"#o": aws.String(ownerAttr)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":o": {S: aws.String(ld.owner)},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "unlock: lock %v not held", ld.lockPath)
+	}
+	return convertError(err, ld.lockPath)
+}
+
+// lockAttribute returns the given string attribute of the item of a lock,
+// or "" if the lock is not held.
+func (s *Server) lockAttribute(ctx context.Context, lockPath, attr string) (string, error) {
+	item, err := s.lockItem(ctx, lockPath)
+	if err != nil || item == nil {
+		return "", err
+	}
+	return aws.StringValue(item[attr].S), nil
+}
+
+// lockItem returns the item of a lock, or nil if the lock is not held.
+func (s *Server) lockItem(ctx context.Context, lockPath string) (map[string]*dynamodb.AttributeValue, error) {
+	out, err := s.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            s.key(lockPath),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, convertError(err, lockPath)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	e, ok := out.Item[expiresAttr]
+	if !ok || e.N == nil {
+		return nil, ErrBadResponse
+	}
+	expires, err := strconv.ParseInt(*e.N, 10, 64)
+	if err != nil {
+		return nil, ErrBadResponse
+	}
+	if expires < time.Now().UnixMilli() {
+		return nil, nil
+	}
+	return out.Item, nil
+}
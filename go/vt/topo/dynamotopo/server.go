@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package dynamotopo implements topo.Server with an Amazon DynamoDB table
+as the backend.
+
+The server address of a cell is the name of its table, and its root is
+the partition key of its items, so cells can share a table. The table
+has the string partition key "cell" and the string sort key "path".
+
+The files are the items whose path is the path of the file, starting
+with '/'. Like with consul, directories only exist through the files
+they contain: listing a directory is a query of the paths that start
+with its path. The versions of the files are taken from an atomic
+counter item of the cell, and checked by conditional writes. Txn uses a DynamoDB transaction.
+
+Watches read the stream of the table, which must be enabled with the
+NEW_AND_OLD_IMAGES view type. A process reads the stream of a table
+once, for all the watches of its servers. Locks and elections are items with a
+lease renewed by their holder. Their path starts with "lock:", so they
+are not files. The TTL of the table can be enabled on the "ttl"
+attribute, to clean up the expired ones.
+
+AWS access credentials are configured via standard AWS means, like for
+the S3 backup storage.
+*/
+package dynamotopo
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+var (
+	dynamoRegion   = flag.String("topo_dynamodb_region", "", "AWS region of the DynamoDB topology server, the default one of the AWS configuration if empty")
+	dynamoEndpoint = flag.String("topo_dynamodb_endpoint", "", "endpoint of the DynamoDB and DynamoDB Streams APIs, the default ones of the region if empty")
+	dynamoLockTTL  = flag.Duration("topo_dynamodb_lock_ttl", 30*time.Second, "lease of the locks of the DynamoDB topology server, renewed by their holder every third of it")
+)
+
+// The attributes of the items.
+const (
+	cellAttr     = "cell"
+	pathAttr     = "path"
+	contentsAttr = "contents"
+	versionAttr  = "version"
+	ownerAttr    = "owner"
+	expiresAttr  = "expires"
+	ttlAttr      = "ttl"
+)
+
+// Factory is the DynamoDB topo.Factory implementation.
+type Factory struct{}
+
+// HasGlobalReadOnlyCell is part of the topo.Factory interface.
+func (f Factory) HasGlobalReadOnlyCell(serverAddr, root string) bool {
+	return false
+}
+
+// Create is part of the topo.Factory interface.
+func (f Factory) Create(cell, serverAddr, root string) (topo.Conn, error) {
+	return NewServer(serverAddr, root)
+}
+
+// Server is the implementation of topo.Server for DynamoDB.
+type Server struct {
+	client  dynamodbiface.DynamoDBAPI
+	streams dynamodbstreamsiface.DynamoDBStreamsAPI
+
+	// table is the name of the DynamoDB table.
+	table string
+
+	// root is the partition key of the items of this client.
+	root string
+
+	// lockTTL is the lease of the locks.
+	lockTTL time.Duration
+
+	// mu protects closed.
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewServer returns a new dynamotopo.Server, on the given table.
+func NewServer(table, root string) (*Server, error) {
+	cfg := aws.NewConfig()
+	if *dynamoRegion != "" {
+		cfg = cfg.WithRegion(*dynamoRegion)
+	}
+	if *dynamoEndpoint != "" {
+		cfg = cfg.WithEndpoint(*dynamoEndpoint)
+	}
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		// The partition key can't be empty.
+		root = "/"
+	}
+
+	return &Server{
+		client:  dynamodb.New(sess),
+		streams: dynamodbstreams.New(sess),
+		table:   table,
+		root:    root,
+		lockTTL: *dynamoLockTTL,
+	}, nil
+}
+
+// Close implements topo.Server.Close.
+// It ends the watches of the server, and stops the reader of the
+// stream if they were the last ones of the table.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.removeWatchers()
+}
+
+func init() {
+	topo.RegisterFactory("dynamodb", Factory{})
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/test"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// createTable uses the DynamoDB Local server of the
+// DYNAMODB_LOCAL_ENDPOINT environment variable, and creates a table on
+// it. It returns the name of the table. It sets the flags of the
+// endpoint and region, the caller restores them.
+func createTable(t *testing.T) string {
+	endpoint := os.Getenv("DYNAMODB_LOCAL_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_LOCAL_ENDPOINT is not set")
+	}
+	*dynamoEndpoint = endpoint
+	*dynamoRegion = "us-east-1"
+	// DynamoDB Local accepts any credentials.
+	t.Setenv("AWS_ACCESS_KEY_ID", "vitess")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "vitess")
+
+	s, err := NewServer("", "")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	table := fmt.Sprintf("vt_topo_%v", time.Now().UnixNano())
+	if _, err := s.client.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(cellAttr), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String(pathAttr), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(cellAttr), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String(pathAttr), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		StreamSpecification: &dynamodb.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+		},
+	}); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := s.client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)}); err != nil {
+			t.Errorf("DeleteTable failed: %v", err)
+		}
+	})
+	return table
+}
+
+func TestDynamoTopo(t *testing.T) {
+	defer func(e, r string) { *dynamoEndpoint, *dynamoRegion = e, r }(*dynamoEndpoint, *dynamoRegion)
+	table := createTable(t)
+
+	// Short polls, so the watch tests don't wait too long.
+	defer func(d time.Duration) { *streamPollDuration = d }(*streamPollDuration)
+	*streamPollDuration = 100 * time.Millisecond
+
+	testIndex := 0
+	newServer := func() *topo.Server {
+		// Each test will use its own partitions.
+		testRoot := fmt.Sprintf("/test-%v", testIndex)
+		testIndex++
+
+		// Create the server on the new root.
+		ts, err := topo.OpenServer("dynamodb", table, path.Join(testRoot, topo.GlobalCell))
+		if err != nil {
+			t.Fatalf("OpenServer() failed: %v", err)
+		}
+
+		// Create the CellInfo.
+		if err := ts.CreateCellInfo(context.Background(), test.LocalCellName, &topodatapb.CellInfo{
+			ServerAddress: table,
+			Root:          path.Join(testRoot, test.LocalCellName),
+		}); err != nil {
+			t.Fatalf("CreateCellInfo() failed: %v", err)
+		}
+
+		return ts
+	}
+
+	// Run the TopoServerTestSuite tests.
+	test.TopoServerTestSuite(t, func() *topo.Server {
+		return newServer()
+	})
+}
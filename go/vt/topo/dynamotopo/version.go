@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// counterPath is the path of the item of the version counter of a
+// cell. It doesn't start with '/', so it is not a file.
+const counterPath = "counter:version"
+
+// DynamoVersion is the version of a file, stored in its item.
+// It implements topo.Version.
+//
+// The versions are taken from an atomic counter of the cell, like the
+// revisions of etcd, so the versions of a file increase even if it is
+// deleted and created again.
+type DynamoVersion uint64
+
+// String is part of the topo.Version interface.
+func (v DynamoVersion) String() string {
+	return fmt.Sprintf("%v", uint64(v))
+}
+
+// nextVersions increments the version counter of the cell by n, and
+// returns the first of the n new versions.
+func (s *Server) nextVersions(ctx context.Context, n int) (DynamoVersion, error) {
+	out, err := s.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(s.table),
+		Key:                      s.key(counterPath),
+		UpdateExpression:         aws.String("ADD #v :n"),
+		ExpressionAttributeNames: map[string]*string{"#v": aws.String(versionAttr)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":n": {N: aws.String(strconv.Itoa(n))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		return 0, convertError(err, counterPath)
+	}
+	_, last, err := parseFileItem(out.Attributes)
+	if err != nil {
+		return 0, err
+	}
+	return last - DynamoVersion(n) + 1, nil
+}
@@ -0,0 +1,518 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamotopo
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+var (
+	streamPollDuration = flag.Duration("topo_dynamodb_stream_poll_duration", time.Second, "time between two reads of an idle shard of the stream of the DynamoDB topology server")
+)
+
+// Watch is part of the topo.Conn interface.
+func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-chan *topo.WatchData, error) {
+	nodePath := path.Join("/", filePath)
+
+	// Register the watcher first, so the changes made after the
+	// initial get are read from the stream.
+	w := &dynamoWatcher{
+		s:      s,
+		key:    watchKey{root: s.root, nodePath: nodePath},
+		signal: make(chan struct{}, 1),
+	}
+	r, err := s.addWatcher(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	select {
+	case <-ctx.Done():
+		s.removeWatcher(r, w)
+		return nil, nil, convertError(ctx.Err(), nodePath)
+	case <-r.ready:
+	}
+	if r.err != nil {
+		s.removeWatcher(r, w)
+		return nil, nil, r.err
+	}
+
+	// Initial get.
+	initialCtx, initialCancel := context.WithTimeout(ctx, *topo.RemoteOperationTimeout)
+	defer initialCancel()
+
+	contents, version, err := s.Get(initialCtx, filePath)
+	if err != nil {
+		s.removeWatcher(r, w)
+		return nil, nil, err
+	}
+
+	// Initial value to return.
+	wd := &topo.WatchData{
+		Contents: contents,
+		Version:  version,
+	}
+
+	// Create the notifications channel, and send the changes read
+	// from the stream.
+	notifications := make(chan *topo.WatchData, 10)
+	go func() {
+		defer close(notifications)
+		defer s.removeWatcher(r, w)
+
+		last := version.(DynamoVersion)
+		for {
+			select {
+			case <-ctx.Done():
+				notifications <- &topo.WatchData{
+					Err: convertError(ctx.Err(), nodePath),
+				}
+				return
+			case <-w.signal:
+			}
+
+			for _, e := range w.take() {
+				switch {
+				case e.err != nil:
+					// The stream can't be read any more.
+					notifications <- &topo.WatchData{
+						Err: e.err,
+					}
+					return
+				case e.deleted:
+					// A deletion of an older version was
+					// already followed by the initial get.
+					if e.version >= last {
+						notifications <- &topo.WatchData{
+							Err: topo.NewError(topo.NoNode, nodePath),
+						}
+						return
+					}
+				case e.version > last:
+					last = e.version
+					notifications <- &topo.WatchData{
+						Contents: e.contents,
+						Version:  e.version,
+					}
+				}
+			}
+		}
+	}()
+
+	return wd, notifications, nil
+}
+
+// WatchFrom is part of the topo.Conn interface.
+func (s *Server) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, s, filePath, version)
+}
+
+// WatchRecursive is part of the topo.Conn interface.
+func (s *Server) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
+	return topo.EmulateWatchRecursive(ctx, s, path, topo.WatchRecursivePollInterval)
+}
+
+// streamEvent is a change of a watched file, or an error of the stream.
+type streamEvent struct {
+	contents []byte
+	version  DynamoVersion
+	deleted  bool
+	err      error
+}
+
+// dynamoWatcher receives the changes of a file from the streamReader.
+type dynamoWatcher struct {
+	s   *Server
+	key watchKey
+
+	// signal has a value when events were added.
+	signal chan struct{}
+
+	// mu protects events. It is never full, so the reader never
+	// waits for a watcher.
+	mu     sync.Mutex
+	events []*streamEvent
+}
+
+// push adds an event for the watcher.
+func (w *dynamoWatcher) push(e *streamEvent) {
+	w.mu.Lock()
+	w.events = append(w.events, e)
+	w.mu.Unlock()
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the events added since the last call.
+func (w *dynamoWatcher) take() []*streamEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	events := w.events
+	w.events = nil
+	return events
+}
+
+// watchKey is the key of the item of a watched file.
+type watchKey struct {
+	root     string
+	nodePath string
+}
+
+var (
+	// readersMu protects readers, and the watchers of the readers.
+	readersMu sync.Mutex
+	// readers are the readers of the streams by table. The servers
+	// of a process share one reader per table, started by the first
+	// watch and stopped by the last one.
+	readers = make(map[string]*streamReader)
+)
+
+// streamReader reads all the shards of the stream of a table, and
+// sends the changes of the watched files to their watchers.
+type streamReader struct {
+	client  dynamodbiface.DynamoDBAPI
+	streams dynamodbstreamsiface.DynamoDBStreamsAPI
+	table   string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// ready is closed when the reader gets the position of all the
+	// open shards, or fails to. err is set before it is closed.
+	ready chan struct{}
+	err   error
+
+	// streamArn is the ARN of the stream. It is set before ready is
+	// closed.
+	streamArn *string
+
+	// watchers are the watchers by file. They are protected by
+	// readersMu.
+	watchers map[watchKey]map[*dynamoWatcher]bool
+
+	// mu protects shards, the IDs of the shards already read.
+	mu     sync.Mutex
+	shards map[string]bool
+}
+
+// addWatcher adds a watcher to the reader of the table, and starts the
+// reader if it is the first one.
+func (s *Server) addWatcher(w *dynamoWatcher) (*streamReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, topo.NewError(topo.Interrupted, w.key.nodePath)
+	}
+
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	r := readers[s.table]
+	if r == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		r = &streamReader{
+			client:   s.client,
+			streams:  s.streams,
+			table:    s.table,
+			ctx:      ctx,
+			cancel:   cancel,
+			ready:    make(chan struct{}),
+			watchers: make(map[watchKey]map[*dynamoWatcher]bool),
+			shards:   make(map[string]bool),
+		}
+		readers[s.table] = r
+		go r.start()
+	}
+	if r.watchers[w.key] == nil {
+		r.watchers[w.key] = make(map[*dynamoWatcher]bool)
+	}
+	r.watchers[w.key][w] = true
+	return r, nil
+}
+
+// removeWatcher removes a watcher from its reader, and stops the
+// reader if it was the last one.
+func (s *Server) removeWatcher(r *streamReader, w *dynamoWatcher) {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	r.removeWatcherLocked(w)
+}
+
+// removeWatchers ends the watches of the server, with ErrInterrupted.
+func (s *Server) removeWatchers() {
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	r := readers[s.table]
+	if r == nil {
+		return
+	}
+	for _, watchers := range r.watchers {
+		for w := range watchers {
+			if w.s == s {
+				w.push(&streamEvent{err: topo.NewError(topo.Interrupted, w.key.nodePath)})
+				r.removeWatcherLocked(w)
+			}
+		}
+	}
+}
+
+// removeWatcherLocked removes a watcher, and stops the reader if it was
+// the last one. readersMu must be held.
+func (r *streamReader) removeWatcherLocked(w *dynamoWatcher) {
+	delete(r.watchers[w.key], w)
+	if len(r.watchers[w.key]) == 0 {
+		delete(r.watchers, w.key)
+	}
+	if len(r.watchers) == 0 && readers[r.table] == r {
+		r.cancel()
+		delete(readers, r.table)
+	}
+}
+
+// fail stops the reader after an error, and sends it to the watchers,
+// so the next watch starts a new reader.
+func (r *streamReader) fail(err error) {
+	if r.ctx.Err() != nil {
+		// The reader was stopped, the error is the cancellation.
+		return
+	}
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	if readers[r.table] == r {
+		delete(readers, r.table)
+	}
+	r.cancel()
+	err = convertError(err, "watch")
+	for _, watchers := range r.watchers {
+		for w := range watchers {
+			w.push(&streamEvent{err: err})
+		}
+	}
+	r.watchers = make(map[watchKey]map[*dynamoWatcher]bool)
+}
+
+// start gets the position of the open shards of the stream, and
+// starts reading them from there.
+func (r *streamReader) start() {
+	iterators, err := r.openShards()
+	r.err = err
+	close(r.ready)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	for shardID, iterator := range iterators {
+		go r.readShard(shardID, iterator)
+	}
+}
+
+// openShards returns the iterators at the end of the open shards of
+// the stream.
+func (r *streamReader) openShards() (map[string]*string, error) {
+	out, err := r.client.DescribeTableWithContext(r.ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(r.table),
+	})
+	if err != nil {
+		return nil, convertError(err, r.table)
+	}
+	if out.Table == nil || out.Table.LatestStreamArn == nil {
+		return nil, fmt.Errorf("the stream of DynamoDB table %v is not enabled", r.table)
+	}
+	r.streamArn = out.Table.LatestStreamArn
+
+	shards, err := r.describeShards()
+	if err != nil {
+		return nil, err
+	}
+	iterators := make(map[string]*string)
+	for _, shard := range shards {
+		if shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+			// The shard is closed.
+			continue
+		}
+		shardID := aws.StringValue(shard.ShardId)
+		iterator, err := r.shardIterator(shardID, dynamodbstreams.ShardIteratorTypeLatest)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.shards[shardID] = true
+		r.mu.Unlock()
+		iterators[shardID] = iterator
+	}
+	return iterators, nil
+}
+
+// describeShards returns all the shards of the stream.
+func (r *streamReader) describeShards() ([]*dynamodbstreams.Shard, error) {
+	var shards []*dynamodbstreams.Shard
+	input := &dynamodbstreams.DescribeStreamInput{
+		StreamArn: r.streamArn,
+	}
+	for {
+		out, err := r.streams.DescribeStreamWithContext(r.ctx, input)
+		if err != nil {
+			return nil, convertError(err, r.table)
+		}
+		if out.StreamDescription == nil {
+			return nil, ErrBadResponse
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// shardIterator returns an iterator of a shard.
+func (r *streamReader) shardIterator(shardID, iteratorType string) (*string, error) {
+	out, err := r.streams.GetShardIteratorWithContext(r.ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         r.streamArn,
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(iteratorType),
+	})
+	if err != nil {
+		return nil, convertError(err, r.table)
+	}
+	return out.ShardIterator, nil
+}
+
+// readShard reads a shard until it is closed, then reads its children.
+func (r *streamReader) readShard(shardID string, iterator *string) {
+	for iterator != nil {
+		out, err := r.streams.GetRecordsWithContext(r.ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		for _, record := range out.Records {
+			r.dispatch(record)
+		}
+		iterator = out.NextShardIterator
+
+		if len(out.Records) == 0 && iterator != nil {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(*streamPollDuration):
+			}
+		}
+	}
+
+	// The shard is closed, its children have the next changes.
+	r.readChildren(shardID)
+}
+
+// readChildren waits for the children of a closed shard, and reads them
+// from their beginning.
+func (r *streamReader) readChildren(parentID string) {
+	for {
+		shards, err := r.describeShards()
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		found := false
+		for _, shard := range shards {
+			if aws.StringValue(shard.ParentShardId) != parentID {
+				continue
+			}
+			found = true
+			shardID := aws.StringValue(shard.ShardId)
+			r.mu.Lock()
+			known := r.shards[shardID]
+			r.shards[shardID] = true
+			r.mu.Unlock()
+			if known {
+				continue
+			}
+			iterator, err := r.shardIterator(shardID, dynamodbstreams.ShardIteratorTypeTrimHorizon)
+			if err != nil {
+				r.fail(err)
+				return
+			}
+			go r.readShard(shardID, iterator)
+		}
+		if found {
+			return
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(*streamPollDuration):
+		}
+	}
+}
+
+// dispatch sends a record of the stream to the watchers of its file.
+func (r *streamReader) dispatch(record *dynamodbstreams.Record) {
+	if record.Dynamodb == nil {
+		return
+	}
+	keys := record.Dynamodb.Keys
+	if keys[cellAttr] == nil || keys[pathAttr] == nil {
+		return
+	}
+	key := watchKey{
+		root:     aws.StringValue(keys[cellAttr].S),
+		nodePath: aws.StringValue(keys[pathAttr].S),
+	}
+
+	e := &streamEvent{}
+	switch aws.StringValue(record.EventName) {
+	case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+		contents, version, err := parseFileItem(record.Dynamodb.NewImage)
+		if err != nil {
+			// Not a file, like a lock.
+			return
+		}
+		e.contents = contents
+		e.version = version
+	case dynamodbstreams.OperationTypeRemove:
+		_, version, err := parseFileItem(record.Dynamodb.OldImage)
+		if err != nil {
+			return
+		}
+		e.version = version
+		e.deleted = true
+	default:
+		return
+	}
+
+	readersMu.Lock()
+	defer readersMu.Unlock()
+	for w := range r.watchers[key] {
+		w.push(e)
+	}
+}
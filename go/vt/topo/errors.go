@@ -19,6 +19,10 @@ package topo
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 )
 
 // ErrorCode is the error code for topo errors.
@@ -36,6 +40,7 @@ const (
 	NoUpdateNeeded
 	NoImplementation
 	NoReadOnlyImplementation
+	ReadOnly
 )
 
 // Error represents a topo error.
@@ -68,6 +73,8 @@ func NewError(code ErrorCode, node string) error {
 		message = fmt.Sprintf("no such topology implementation %s", node)
 	case NoReadOnlyImplementation:
 		message = fmt.Sprintf("no read-only topology implementation %s", node)
+	case ReadOnly:
+		message = fmt.Sprintf("cannot perform %s as the topology server connection is read-only", node)
 	default:
 		message = fmt.Sprintf("unknown code: %s", node)
 	}
@@ -82,6 +89,52 @@ func (e Error) Error() string {
 	return e.message
 }
 
+// ErrorCode returns the vtrpc code of the error, for vterrors.Code: the
+// ReadOnly errors are READ_ONLY, so the callers of the RPCs get it.
+func (e Error) ErrorCode() vtrpcpb.Code {
+	if e.code == ReadOnly {
+		return vtrpcpb.Code_READ_ONLY
+	}
+	return vtrpcpb.Code_UNKNOWN
+}
+
+// PartialResultError is returned by the functions that read several
+// cells, when some of them could not be read. IsErrType(err,
+// PartialResult) is true for it, and it lists the cells that failed,
+// so callers can decide whether they matter.
+type PartialResultError struct {
+	// Node is the object that was read, usually the shard name.
+	Node string
+
+	// FailedCells maps each cell that could not be read to the
+	// underlying error.
+	FailedCells map[string]error
+}
+
+// Error satisfies error.
+func (e *PartialResultError) Error() string {
+	failures := make([]string, 0, len(e.FailedCells))
+	for _, cell := range e.Cells() {
+		failures = append(failures, fmt.Sprintf("%v: %v", cell, e.FailedCells[cell]))
+	}
+	return fmt.Sprintf("partial result: %s: failed cells: %s", e.Node, strings.Join(failures, ", "))
+}
+
+// Unwrap returns the PartialResult topo error, so IsErrType works.
+func (e *PartialResultError) Unwrap() error {
+	return NewError(PartialResult, e.Node)
+}
+
+// Cells returns the sorted list of the cells that could not be read.
+func (e *PartialResultError) Cells() []string {
+	cells := make([]string, 0, len(e.FailedCells))
+	for cell := range e.FailedCells {
+		cells = append(cells, cell)
+	}
+	sort.Strings(cells)
+	return cells
+}
+
 // IsErrType returns true if the error has the specified ErrorCode.
 func IsErrType(err error, code ErrorCode) bool {
 	var e Error
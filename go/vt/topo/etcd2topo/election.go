@@ -19,6 +19,7 @@ package etcd2topo
 import (
 	"context"
 	"path"
+	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
 
@@ -91,7 +92,7 @@ func (mp *etcdLeaderParticipation) WaitForLeadership() (context.Context, error)
 
 	// Try to get the primaryship, by getting a lock.
 	var err error
-	ld, err = mp.s.lock(lockCtx, electionPath, mp.id)
+	ld, err = mp.s.lock(lockCtx, electionPath, mp.id, time.Duration(*leaseTTL)*time.Second)
 	if err != nil {
 		// It can be that we were interrupted.
 		return nil, err
@@ -21,6 +21,7 @@ import (
 
 	"context"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"vitess.io/vitess/go/vt/topo"
@@ -150,3 +151,88 @@ func (s *Server) Delete(ctx context.Context, filePath string, version topo.Versi
 	}
 	return nil
 }
+
+// Txn is part of the topo.Conn interface.
+func (s *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	// The transaction applies the operations if all their
+	// conditions hold. Otherwise it gets all the files, so we know
+	// which condition failed.
+	var cmps []clientv3.Cmp
+	var thenOps, elseOps []clientv3.Op
+	for _, op := range ops {
+		nodePath := path.Join(s.root, op.Path)
+		switch op.Type {
+		case topo.TxnCreate:
+			cmps = append(cmps, clientv3.Compare(clientv3.Version(nodePath), "=", 0))
+			thenOps = append(thenOps, clientv3.OpPut(nodePath, string(op.Contents)))
+		case topo.TxnUpdate:
+			if op.Version != nil {
+				cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(nodePath), "=", int64(op.Version.(EtcdVersion))))
+			}
+			thenOps = append(thenOps, clientv3.OpPut(nodePath, string(op.Contents)))
+		case topo.TxnDelete:
+			if op.Version != nil {
+				cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(nodePath), "=", int64(op.Version.(EtcdVersion))))
+			} else {
+				cmps = append(cmps, clientv3.Compare(clientv3.Version(nodePath), ">", 0))
+			}
+			thenOps = append(thenOps, clientv3.OpDelete(nodePath))
+		case topo.TxnCheck:
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(nodePath), "=", int64(op.Version.(EtcdVersion))))
+		}
+		elseOps = append(elseOps, clientv3.OpGet(nodePath))
+	}
+	txnresp, err := s.cli.Txn(ctx).
+		If(cmps...).
+		Then(thenOps...).
+		Else(elseOps...).
+		Commit()
+	if err != nil {
+		return nil, convertError(err, s.root)
+	}
+	if !txnresp.Succeeded {
+		return nil, s.txnError(ops, txnresp)
+	}
+
+	versions := make([]topo.Version, len(ops))
+	for i, op := range ops {
+		if op.Type == topo.TxnCreate || op.Type == topo.TxnUpdate {
+			versions[i] = EtcdVersion(txnresp.Header.Revision)
+		}
+	}
+	return versions, nil
+}
+
+// txnError returns the error of the first operation whose condition
+// failed, from the files the transaction got instead of applying them.
+func (s *Server) txnError(ops []topo.TxnOp, txnresp *clientv3.TxnResponse) error {
+	for i, op := range ops {
+		nodePath := path.Join(s.root, op.Path)
+		var kvs []*mvccpb.KeyValue
+		if i < len(txnresp.Responses) {
+			kvs = txnresp.Responses[i].GetResponseRange().Kvs
+		}
+		if op.Type == topo.TxnCreate {
+			if len(kvs) > 0 {
+				return topo.NewError(topo.NodeExists, nodePath)
+			}
+			continue
+		}
+		if op.Version == nil && op.Type == topo.TxnUpdate {
+			continue
+		}
+		if len(kvs) == 0 {
+			return topo.NewError(topo.NoNode, nodePath)
+		}
+		if op.Version != nil && kvs[0].ModRevision != int64(op.Version.(EtcdVersion)) {
+			return topo.NewError(topo.BadVersion, nodePath)
+		}
+	}
+	// This should not happen, since the files are read in the
+	// same transaction.
+	return topo.NewError(topo.BadVersion, s.root)
+}
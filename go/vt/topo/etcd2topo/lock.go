@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"path"
+	"time"
 
 	"context"
 
@@ -123,6 +124,12 @@ type etcdLockDescriptor struct {
 
 // Lock is part of the topo.Conn interface.
 func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockDescriptor, error) {
+	return s.LockWithTTL(ctx, dirPath, contents, time.Duration(*leaseTTL)*time.Second)
+}
+
+// LockWithTTL is part of the topo.LeaseConn interface.
+// The lease of etcd is in seconds, so ttl is rounded up to a second.
+func (s *Server) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (topo.LockDescriptor, error) {
 	// We list the directory first to make sure it exists.
 	if _, err := s.ListDir(ctx, dirPath, false /*full*/); err != nil {
 		// We need to return the right error codes, like
@@ -133,15 +140,15 @@ func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockD
 		return nil, convertError(err, dirPath)
 	}
 
-	return s.lock(ctx, dirPath, contents)
+	return s.lock(ctx, dirPath, contents, ttl)
 }
 
 // lock is used by both Lock() and primary election.
-func (s *Server) lock(ctx context.Context, nodePath, contents string) (topo.LockDescriptor, error) {
+func (s *Server) lock(ctx context.Context, nodePath, contents string, ttl time.Duration) (topo.LockDescriptor, error) {
 	nodePath = path.Join(s.root, nodePath, locksPath)
 
 	// Get a lease, set its KeepAlive.
-	lease, err := s.cli.Grant(ctx, int64(*leaseTTL))
+	lease, err := s.cli.Grant(ctx, int64((ttl+time.Second-1)/time.Second))
 	if err != nil {
 		return nil, convertError(err, nodePath)
 	}
@@ -201,3 +208,74 @@ func (ld *etcdLockDescriptor) Unlock(ctx context.Context) error {
 	}
 	return nil
 }
+
+// lockHolderKV returns the key of the holder of the lock on dirPath:
+// the oldest one in its locks directory.
+func (s *Server) lockHolderKV(ctx context.Context, dirPath string) (*mvccpb.KeyValue, error) {
+	nodePath := path.Join(s.root, dirPath, locksPath)
+	resp, err := s.cli.Get(ctx, nodePath+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return nil, convertError(err, nodePath)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, topo.NewError(topo.NoNode, dirPath)
+	}
+	return resp.Kvs[0], nil
+}
+
+// etcdLockVersion is the version of a holding of a lock: the key of
+// the holder in the locks directory, and its revision.
+// It implements topo.Version.
+type etcdLockVersion struct {
+	key      string
+	revision int64
+}
+
+// String is part of the topo.Version interface.
+func (v etcdLockVersion) String() string {
+	return fmt.Sprintf("%v@%v", v.key, v.revision)
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (s *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	kv, err := s.lockHolderKV(ctx, dirPath)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(kv.Value), etcdLockVersion{key: string(kv.Key), revision: kv.ModRevision}, nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It deletes the key of the holder if it still has the revision of the
+// version, then revokes its lease, so it fails to renew it.
+func (s *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(etcdLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	resp, err := s.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(v.key), "=", v.revision)).
+		Then(clientv3.OpDelete(v.key, clientv3.WithPrevKV())).
+		Commit()
+	if err != nil {
+		return convertError(err, dirPath)
+	}
+	if !resp.Succeeded {
+		// The holder released the lock: it is not locked, or it
+		// was locked again.
+		if _, err := s.lockHolderKV(ctx, dirPath); err != nil {
+			return err
+		}
+		return topo.NewError(topo.BadVersion, dirPath)
+	}
+
+	deleteResp := resp.Responses[0].GetResponseDeleteRange()
+	if deleteResp == nil || len(deleteResp.PrevKvs) == 0 || deleteResp.PrevKvs[0].Lease == 0 {
+		return nil
+	}
+	if _, err := s.cli.Revoke(ctx, clientv3.LeaseID(deleteResp.PrevKvs[0].Lease)); err != nil {
+		// The lock is released, the holder only notices it later.
+		log.Warningf("Revoke(%d) of the broken lock on %v failed: %v", deleteResp.PrevKvs[0].Lease, dirPath, err)
+	}
+	return nil
+}
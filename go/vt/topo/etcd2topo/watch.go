@@ -37,42 +37,79 @@ func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <
 	nodePath := path.Join(s.root, filePath)
 
 	// Get the initial version of the file
+	wd, revision, err := s.getWatchData(ctx, nodePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// We start watching from the response we got, not from the
+	// file original version, as the server may not have that much
+	// history.
+	notifications, err := s.watch(ctx, nodePath, revision)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wd, notifications, nil
+}
+
+// WatchFrom is part of the topo.Conn interface. etcd keeps the history
+// of the files, so all the changes after version are replayed, unless
+// this history was compacted: the current value is then sent instead.
+// Without a version, the watch starts from the current value.
+func (s *Server) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	if version == nil {
+		return topo.EmulateWatchFrom(ctx, s, filePath, nil)
+	}
+	etcdVersion, ok := version.(EtcdVersion)
+	if !ok {
+		return nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad version type %T for etcd", version)
+	}
+	nodePath := path.Join(s.root, filePath)
+	return s.watch(ctx, nodePath, int64(etcdVersion)+1)
+}
+
+// getWatchData returns the current value of a file, and the revision
+// of the store it was read at.
+func (s *Server) getWatchData(ctx context.Context, nodePath string) (*topo.WatchData, int64, error) {
 	initialCtx, initialCancel := context.WithTimeout(ctx, *topo.RemoteOperationTimeout)
 	defer initialCancel()
 	initial, err := s.cli.Get(initialCtx, nodePath)
 	if err != nil {
 		// Generic error.
-		return nil, nil, convertError(err, nodePath)
+		return nil, 0, convertError(err, nodePath)
 	}
 
 	if len(initial.Kvs) != 1 {
 		// Node doesn't exist.
-		return nil, nil, topo.NewError(topo.NoNode, nodePath)
+		return nil, 0, topo.NewError(topo.NoNode, nodePath)
 	}
 	wd := &topo.WatchData{
 		Contents: initial.Kvs[0].Value,
 		Version:  EtcdVersion(initial.Kvs[0].ModRevision),
 	}
+	return wd, initial.Header.Revision, nil
+}
 
+// watch sends the changes of a file from a revision of the store to the
+// returned channel.
+func (s *Server) watch(ctx context.Context, nodePath string, revision int64) (<-chan *topo.WatchData, error) {
 	// Create a context, will be used to cancel the watch on retry.
 	watchCtx, watchCancel := context.WithCancel(ctx)
 
-	// Create the Watcher.  We start watching from the response we
-	// got, not from the file original version, as the server may
-	// not have that much history.
-	watcher := s.cli.Watch(watchCtx, nodePath, clientv3.WithRev(initial.Header.Revision))
+	// Create the Watcher.
+	watcher := s.cli.Watch(watchCtx, nodePath, clientv3.WithRev(revision))
 	if watcher == nil {
 		watchCancel()
-		return nil, nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "Watch failed")
+		return nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "Watch failed")
 	}
 
 	// Create the notifications channel, send updates to it.
 	notifications := make(chan *topo.WatchData, 10)
 	go func() {
 		defer close(notifications)
-		defer watchCancel()
+		defer func() { watchCancel() }()
 
-		var currVersion = initial.Header.Revision
+		var currVersion = revision
 		var watchRetries int
 		for {
 			select {
@@ -110,6 +147,23 @@ func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <
 
 				watchRetries = 0
 
+				if wresp.CompactRevision != 0 {
+					// The changes since currVersion were
+					// compacted. Send the current value
+					// instead, and watch from there.
+					wd, revision, err := s.getWatchData(ctx, nodePath)
+					if err != nil {
+						notifications <- &topo.WatchData{Err: err}
+						return
+					}
+					notifications <- wd
+					currVersion = revision + 1
+					watchCancel()
+					watchCtx, watchCancel = context.WithCancel(ctx)
+					watcher = s.cli.Watch(watchCtx, nodePath, clientv3.WithRev(currVersion))
+					continue
+				}
+
 				if wresp.Canceled {
 					// Final notification.
 					notifications <- &topo.WatchData{
@@ -125,7 +179,7 @@ func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <
 					case mvccpb.PUT:
 						notifications <- &topo.WatchData{
 							Contents: ev.Kv.Value,
-							Version:  EtcdVersion(ev.Kv.Version),
+							Version:  EtcdVersion(ev.Kv.ModRevision),
 						}
 					case mvccpb.DELETE:
 						// Node is gone, send a final notice.
@@ -144,7 +198,7 @@ func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <
 		}
 	}()
 
-	return wd, notifications, nil
+	return notifications, nil
 }
 
 // WatchRecursive is part of the topo.Conn interface.
@@ -166,7 +220,7 @@ func (s *Server) WatchRecursive(ctx context.Context, dirpath string) ([]*topo.Wa
 		var wd topo.WatchDataRecursive
 		wd.Path = string(kv.Key)
 		wd.Contents = kv.Value
-		wd.Version = EtcdVersion(initial.Kvs[0].ModRevision)
+		wd.Version = EtcdVersion(kv.ModRevision)
 		initialwd = append(initialwd, &wd)
 	}
 
@@ -244,7 +298,7 @@ func (s *Server) WatchRecursive(ctx context.Context, dirpath string) ([]*topo.Wa
 							Path: string(ev.Kv.Key),
 							WatchData: topo.WatchData{
 								Contents: ev.Kv.Value,
-								Version:  EtcdVersion(ev.Kv.Version),
+								Version:  EtcdVersion(ev.Kv.ModRevision),
 							},
 						}
 					case mvccpb.DELETE:
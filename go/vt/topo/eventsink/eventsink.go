@@ -0,0 +1,454 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventsink implements an optional plugin that publishes the
+// topology change events (see the topo/events package) to an external
+// system, so it can react to the changes of the topology.
+//
+// The events are dispatched in-process by the topo.Server. This plugin
+// listens to them, and queues them for a background writer, so the
+// topology calls don't wait for the disk. The writer stores them in a
+// spool: in memory, or synced to a directory so they survive restarts.
+// A Sink publishes them from the spool. A Sink that fails is retried
+// with a backoff, so no event is lost while it is unavailable. When the
+// spool and the queue are full, the topology calls wait for the events
+// to be published, rather than dropping them.
+//
+// The "stdout", "webhook" and "kafka" sinks are built in. Other sinks
+// can be added by a plugin calling RegisterSink.
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/event"
+	"vitess.io/vitess/go/json2"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/topo/events"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+)
+
+var (
+	sinkName      = flag.String("topo_event_sink", "", "the sink to publish the topology change events to: stdout, webhook, kafka, or a sink registered by a plugin. Disabled if empty.")
+	sinkAddress   = flag.String("topo_event_sink_address", "", "the address of the topology change event sink, for instance the URL of the webhook, or of the Kafka REST Proxy")
+	spoolDir      = flag.String("topo_event_sink_spool_dir", "", "if set, the topology change events that are not published yet are kept in this directory, so they are not lost on restart. They are kept in memory otherwise.")
+	spoolSize     = flag.Int("topo_event_sink_queue_size", 10000, "how many topology change events can wait to be published. When as many are waiting, the topology changes wait for them to be published.")
+	maxRetryDelay = flag.Duration("topo_event_sink_max_retry_delay", time.Minute, "the maximum delay between two attempts to publish a topology change event")
+)
+
+// minRetryDelay is the delay before the first retry to publish an event.
+var minRetryDelay = 100 * time.Millisecond
+
+// The kinds of events.
+const (
+	KindKeyspace              = "keyspace"
+	KindShard                 = "shard"
+	KindTablet                = "tablet"
+	KindMetadata              = "metadata"
+	KindExternalVitessCluster = "external_vitess_cluster"
+)
+
+// Event is a topology change event, as it is published.
+type Event struct {
+	// Time is when the event was dispatched.
+	Time time.Time `json:"time"`
+
+	// Kind is the kind of the record that changed, one of the Kind
+	// constants.
+	Kind string `json:"kind"`
+
+	// Keyspace, Shard, Tablet and Name identify the record. Only the
+	// ones that apply to the kind of record are set: Tablet is the
+	// tablet alias, and Name the metadata key or the cluster name.
+	Keyspace string `json:"keyspace,omitempty"`
+	Shard    string `json:"shard,omitempty"`
+	Tablet   string `json:"tablet,omitempty"`
+	Name     string `json:"name,omitempty"`
+
+	// Status describes the change, for instance "created".
+	Status string `json:"status"`
+
+	// Value is the record after the change, in JSON, if any.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Sink publishes events to an external system.
+type Sink interface {
+	// Publish publishes an event. It returns once the event is
+	// durably stored by the external system. If it fails, it is
+	// called again later with the same event.
+	Publish(ctx context.Context, ev *Event) error
+
+	// Close releases the resources of the Sink.
+	Close() error
+}
+
+// SinkFactory creates a Sink publishing to the given address.
+type SinkFactory func(address string) (Sink, error)
+
+var sinkFactories = make(map[string]SinkFactory)
+
+// RegisterSink registers a SinkFactory for the sink with the given
+// name. It is meant to be called in the init() of the plugins.
+func RegisterSink(name string, factory SinkFactory) {
+	if sinkFactories[name] != nil {
+		log.Fatalf("Duplicate eventsink.SinkFactory registration for %v", name)
+	}
+	sinkFactories[name] = factory
+}
+
+// Publisher publishes the topology change events to a Sink, in the
+// order they were dispatched.
+type Publisher struct {
+	sink  Sink
+	spool spool
+	// size is the maximum number of events of the spool.
+	size int
+
+	// queue has the events to add to the spool.
+	queue chan *Event
+	// notify is signaled when an event is added to the spool.
+	notify chan struct{}
+	// room is signaled when an event is removed from the spool.
+	room   chan struct{}
+	cancel context.CancelFunc
+
+	// closed is set by Close, so Add doesn't queue more events.
+	// adding counts the calls to Add that are queuing an event, which
+	// the writer still takes after Close.
+	addMu  sync.RWMutex
+	closed bool
+	adding sync.WaitGroup
+
+	// writerDone and done are closed when the writer and the
+	// publishing loop stop.
+	writerDone chan struct{}
+	done       chan struct{}
+}
+
+// NewPublisher returns a Publisher to the given Sink. If dir is not
+// empty, the events not published yet are stored in this directory,
+// and the ones left by a previous Publisher are published first.
+// Otherwise they are kept in memory. At most size events wait in the
+// spool, and as many in the queue of Add.
+func NewPublisher(sink Sink, dir string, size int) (*Publisher, error) {
+	var s spool
+	if dir != "" {
+		ds, err := newDirSpool(dir)
+		if err != nil {
+			return nil, err
+		}
+		s = ds
+	} else {
+		s = newMemorySpool()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		sink:       sink,
+		spool:      s,
+		size:       size,
+		queue:      make(chan *Event, size),
+		notify:     make(chan struct{}, 1),
+		room:       make(chan struct{}, 1),
+		cancel:     cancel,
+		writerDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go p.write(ctx)
+	go p.run(ctx)
+	return p, nil
+}
+
+// Add queues an event to publish, without waiting for it to be added
+// to the spool. If the queue is full, it waits for room, so the events
+// are not dropped when the Sink is slower than the changes. The events
+// added after Close are dropped.
+func (p *Publisher) Add(ev *Event) {
+	p.addMu.RLock()
+	if p.closed {
+		p.addMu.RUnlock()
+		log.Errorf("Dropping topology change event %v %v: the publisher is closed", ev.Kind, ev.Status)
+		return
+	}
+	p.adding.Add(1)
+	p.addMu.RUnlock()
+	defer p.adding.Done()
+
+	p.queue <- ev
+}
+
+// Close stops publishing the events, and closes the Sink. The events
+// not published yet stay in the spool directory, if any.
+func (p *Publisher) Close() {
+	p.addMu.Lock()
+	p.closed = true
+	p.addMu.Unlock()
+
+	// The writer takes the events of the calls to Add that are
+	// waiting, until they all returned.
+	p.cancel()
+	<-p.writerDone
+	<-p.done
+	if n := p.spool.len(); n > 0 {
+		log.Warningf("%v topology change events were not published", n)
+	}
+	if err := p.sink.Close(); err != nil {
+		log.Errorf("Cannot close the topology change event sink: %v", err)
+	}
+}
+
+// write adds the queued events to the spool until ctx is canceled,
+// waiting for room in the spool. Then it adds the ones left in the
+// queue, and those of the calls to Add that are waiting, regardless of
+// the size of the spool.
+func (p *Publisher) write(ctx context.Context) {
+	defer close(p.writerDone)
+	for {
+		select {
+		case ev := <-p.queue:
+			p.waitForRoom(ctx)
+			p.addToSpool(ctx, ev)
+		case <-ctx.Done():
+			added := make(chan struct{})
+			go func() {
+				p.adding.Wait()
+				close(added)
+			}()
+			for {
+				select {
+				case ev := <-p.queue:
+					p.addToSpool(ctx, ev)
+				case <-added:
+					for {
+						select {
+						case ev := <-p.queue:
+							p.addToSpool(ctx, ev)
+						default:
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// waitForRoom waits until the spool has less than size events, or ctx
+// is canceled.
+func (p *Publisher) waitForRoom(ctx context.Context) {
+	for p.spool.len() >= p.size {
+		select {
+		case <-p.room:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// addToSpool adds an event to the spool, and signals it to run. If the
+// spool cannot store it, e.g. because the disk is full, it is retried
+// with a backoff until ctx is canceled.
+func (p *Publisher) addToSpool(ctx context.Context, ev *Event) {
+	delay := minRetryDelay
+	for {
+		err := p.spool.add(ev)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			log.Errorf("Dropping topology change event %v %v: %v", ev.Kind, ev.Status, err)
+			return
+		}
+		log.Warningf("Cannot spool topology change event %v %v, retrying in %v: %v", ev.Kind, ev.Status, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		delay *= 2
+		if delay > *maxRetryDelay {
+			delay = *maxRetryDelay
+		}
+	}
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// signalRoom signals the writer that an event was removed from the
+// spool.
+func (p *Publisher) signalRoom() {
+	select {
+	case p.room <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the events of the spool until ctx is canceled.
+func (p *Publisher) run(ctx context.Context) {
+	defer close(p.done)
+	delay := minRetryDelay
+	for {
+		ev, err := p.spool.next()
+		switch {
+		case err != nil:
+			// The event cannot be read, skip it.
+			log.Errorf("Dropping a topology change event: %v", err)
+			if err := p.spool.remove(); err != nil {
+				log.Errorf("Cannot remove a topology change event: %v", err)
+			}
+			p.signalRoom()
+			continue
+		case ev == nil:
+			select {
+			case <-p.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := p.sink.Publish(ctx, ev); err != nil {
+			log.Warningf("Cannot publish topology change event %v %v, retrying in %v: %v", ev.Kind, ev.Status, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			delay *= 2
+			if delay > *maxRetryDelay {
+				delay = *maxRetryDelay
+			}
+			continue
+		}
+		delay = minRetryDelay
+		if err := p.spool.remove(); err != nil {
+			log.Errorf("Cannot remove a published topology change event: %v", err)
+		}
+		p.signalRoom()
+	}
+}
+
+// The publisher the events are added to, if any.
+var (
+	mu        sync.Mutex
+	publisher *Publisher
+)
+
+func addEvent(ev *Event, value proto.Message) {
+	mu.Lock()
+	p := publisher
+	mu.Unlock()
+	if p == nil {
+		return
+	}
+
+	ev.Time = time.Now()
+	if value != nil && value.ProtoReflect().IsValid() {
+		data, err := json2.MarshalPB(value)
+		if err != nil {
+			log.Errorf("Cannot marshal topology change event %v %v: %v", ev.Kind, ev.Status, err)
+			return
+		}
+		ev.Value = data
+	}
+	p.Add(ev)
+}
+
+// Init starts publishing the topology change events to the sink with
+// the given name, and returns the Publisher. Close must be called to
+// stop it.
+func Init(name, address, dir string, size int) (*Publisher, error) {
+	factory, ok := sinkFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown topology change event sink %v", name)
+	}
+	sink, err := factory(address)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPublisher(sink, dir, size)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if publisher != nil {
+		p.Close()
+		return nil, fmt.Errorf("topology change events are already published")
+	}
+	publisher = p
+	return p, nil
+}
+
+// stop stops adding the events to the publisher started by Init.
+func stop(p *Publisher) {
+	mu.Lock()
+	if publisher == p {
+		publisher = nil
+	}
+	mu.Unlock()
+	p.Close()
+}
+
+func init() {
+	event.AddListener(func(ev *events.KeyspaceChange) {
+		addEvent(&Event{Kind: KindKeyspace, Keyspace: ev.KeyspaceName, Status: ev.Status}, ev.Keyspace)
+	})
+	event.AddListener(func(ev *events.ShardChange) {
+		addEvent(&Event{Kind: KindShard, Keyspace: ev.KeyspaceName, Shard: ev.ShardName, Status: ev.Status}, ev.Shard)
+	})
+	event.AddListener(func(ev *events.TabletChange) {
+		if ev.Tablet == nil {
+			return
+		}
+		addEvent(&Event{
+			Kind:     KindTablet,
+			Keyspace: ev.Tablet.Keyspace,
+			Shard:    ev.Tablet.Shard,
+			Tablet:   topoproto.TabletAliasString(ev.Tablet.Alias),
+			Status:   ev.Status,
+		}, ev.Tablet)
+	})
+	event.AddListener(func(ev *events.MetadataChange) {
+		addEvent(&Event{Kind: KindMetadata, Name: ev.Key, Status: ev.Status}, nil)
+	})
+	event.AddListener(func(ev *events.ExternalVitessClusterChange) {
+		addEvent(&Event{Kind: KindExternalVitessCluster, Name: ev.ClusterName, Status: ev.Status}, ev.ExternalVitessCluster)
+	})
+
+	servenv.OnRun(func() {
+		if *sinkName == "" {
+			return
+		}
+		p, err := Init(*sinkName, *sinkAddress, *spoolDir, *spoolSize)
+		if err != nil {
+			log.Exitf("Cannot publish the topology change events: %v", err)
+		}
+		servenv.OnClose(func() { stop(p) })
+	})
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// fakeSink records the published events. The first calls to Publish
+// fail, as many as failures.
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	events   []*Event
+}
+
+func (s *fakeSink) Publish(ctx context.Context, ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("sink unavailable")
+	}
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	return nil
+}
+
+// waitForEvents waits until the sink has published n events, and
+// returns them.
+func (s *fakeSink) waitForEvents(t *testing.T, n int) []*Event {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		s.mu.Lock()
+		events := s.events
+		s.mu.Unlock()
+		if len(events) >= n {
+			return events
+		}
+	}
+	t.Fatalf("timed out waiting for %v events", n)
+	return nil
+}
+
+func init() {
+	minRetryDelay = time.Millisecond
+}
+
+func TestPublisherRetries(t *testing.T) {
+	sink := &fakeSink{failures: 3}
+	p, err := NewPublisher(sink, "", 10)
+	require.NoError(t, err)
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		p.Add(&Event{Kind: KindShard, Shard: fmt.Sprint(i), Status: "updated"})
+	}
+	events := sink.waitForEvents(t, 3)
+	for i, ev := range events {
+		assert.Equal(t, fmt.Sprint(i), ev.Shard)
+	}
+}
+
+func TestPublisherBlocksWhenFull(t *testing.T) {
+	sink := &fakeSink{failures: 1 << 30}
+	p, err := NewPublisher(sink, "", 2)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// The spool and the queue are full long before all the events
+	// are added, so Add waits for the sink.
+	const n = 20
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for i := 0; i < n; i++ {
+			p.Add(&Event{Kind: KindShard, Shard: fmt.Sprint(i)})
+		}
+	}()
+	select {
+	case <-added:
+		t.Fatal("Add did not wait for room in the spool")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.LessOrEqual(t, p.spool.len(), 2)
+
+	// Once the sink works, every event is published, in order.
+	sink.mu.Lock()
+	sink.failures = 0
+	sink.mu.Unlock()
+	select {
+	case <-added:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Add is still waiting")
+	}
+	events := sink.waitForEvents(t, n)
+	require.Len(t, events, n)
+	for i, ev := range events {
+		assert.Equal(t, fmt.Sprint(i), ev.Shard)
+	}
+}
+
+func TestPublisherCloseKeepsWaitingEvents(t *testing.T) {
+	dir := t.TempDir()
+
+	// The calls to Add that wait when the publisher is closed still
+	// have their events spooled.
+	p, err := NewPublisher(&fakeSink{failures: 1 << 30}, dir, 1)
+	require.NoError(t, err)
+	const n = 5
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.Add(&Event{Kind: KindShard, Shard: fmt.Sprint(i)})
+		}(i)
+	}
+	assert.Eventually(t, func() bool { return len(p.queue) == 1 }, 10*time.Second, time.Millisecond)
+	p.Close()
+	wg.Wait()
+
+	sink := &fakeSink{}
+	p, err = NewPublisher(sink, dir, 1)
+	require.NoError(t, err)
+	defer p.Close()
+	assert.Len(t, sink.waitForEvents(t, n), n)
+}
+
+func TestPublisherSpoolDir(t *testing.T) {
+	dir := t.TempDir()
+
+	// The events cannot be published, and stay in the directory.
+	p, err := NewPublisher(&fakeSink{failures: 1 << 30}, dir, 10)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		p.Add(&Event{Kind: KindKeyspace, Keyspace: fmt.Sprint(i), Status: "created"})
+	}
+	p.Close()
+
+	// A new publisher publishes them, in order, then the new ones.
+	sink := &fakeSink{}
+	p, err = NewPublisher(sink, dir, 10)
+	require.NoError(t, err)
+	defer p.Close()
+	p.Add(&Event{Kind: KindKeyspace, Keyspace: "3", Status: "created"})
+
+	events := sink.waitForEvents(t, 4)
+	for i, ev := range events {
+		assert.Equal(t, fmt.Sprint(i), ev.Keyspace)
+		assert.Equal(t, "created", ev.Status)
+	}
+	for start := time.Now(); p.spool.len() > 0 && time.Since(start) < 10*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, p.spool.len())
+}
+
+func TestTopoEvents(t *testing.T) {
+	sink := &fakeSink{}
+	RegisterSink("fake", func(address string) (Sink, error) {
+		return sink, nil
+	})
+	defer delete(sinkFactories, "fake")
+	p, err := Init("fake", "", "", 10)
+	require.NoError(t, err)
+	defer stop(p)
+
+	_, err = Init("fake", "", "", 10)
+	require.Error(t, err)
+
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{DurabilityPolicy: "none"}))
+	require.NoError(t, ts.CreateShard(ctx, "ks", "0"))
+
+	events := sink.waitForEvents(t, 2)
+	assert.Equal(t, KindKeyspace, events[0].Kind)
+	assert.Equal(t, "ks", events[0].Keyspace)
+	assert.Equal(t, "created", events[0].Status)
+	value := map[string]any{}
+	require.NoError(t, json.Unmarshal(events[0].Value, &value))
+	assert.Equal(t, "none", value["durabilityPolicy"])
+
+	assert.Equal(t, KindShard, events[1].Kind)
+	assert.Equal(t, "ks", events[1].Keyspace)
+	assert.Equal(t, "0", events[1].Shard)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*Event
+		fail     = true
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ev := &Event{}
+		if err := json.NewDecoder(r.Body).Decode(ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, ev)
+	}))
+	defer server.Close()
+
+	sink, err := sinkFactories["webhook"](server.URL)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := &Event{Kind: KindTablet, Tablet: "cell1-0000000100", Status: "deleted"}
+	require.Error(t, sink.Publish(context.Background(), ev))
+	require.NoError(t, sink.Publish(context.Background(), ev))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "cell1-0000000100", received[0].Tablet)
+
+	_, err = sinkFactories["webhook"]("")
+	assert.Error(t, err)
+}
+
+func TestKafkaSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []kafkaRecord
+		fail     = true
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/topics/topo_events" || r.Header.Get("Content-Type") != kafkaContentType {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		records := &kafkaRecords{}
+		if err := json.NewDecoder(r.Body).Decode(records); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", kafkaAccept)
+		if fail {
+			// A record the proxy could not produce.
+			fail = false
+			fmt.Fprint(w, `{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"not enough replicas"}]}`)
+			return
+		}
+		received = append(received, records.Records...)
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":7,"error_code":null,"error":null}]}`)
+	}))
+	defer server.Close()
+
+	sink, err := newKafkaSink(server.URL+"/", "topo_events", time.Second)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ev := &Event{Kind: KindShard, Keyspace: "ks", Shard: "-80", Status: "updated"}
+	require.Error(t, sink.Publish(context.Background(), ev))
+	require.NoError(t, sink.Publish(context.Background(), ev))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "shard/ks/-80", received[0].Key)
+	assert.Equal(t, "-80", received[0].Value.Shard)
+
+	_, err = sinkFactories["kafka"]("")
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	kafkaTopic   = flag.String("topo_event_sink_kafka_topic", "vitess_topo_events", "the Kafka topic of the kafka topology change event sink")
+	kafkaTimeout = flag.Duration("topo_event_sink_kafka_timeout", 10*time.Second, "the timeout of the requests of the kafka topology change event sink to the Kafka REST Proxy")
+)
+
+// The content types of the v2 API of the Kafka REST Proxy, with the
+// records in JSON.
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+)
+
+// kafkaSink produces the events to a Kafka topic, through a Kafka REST
+// Proxy (the v2 API of the Confluent REST Proxy), so it doesn't need a
+// Kafka client. The events of a record have the same key, so they go
+// to the same partition, in order. An event is published once all the
+// in-sync replicas have it, if the producer of the proxy is configured
+// with acks=all.
+type kafkaSink struct {
+	url    string
+	client *http.Client
+}
+
+// kafkaRecords is the body of a produce request.
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value *Event `json:"value"`
+}
+
+// kafkaOffsets is the body of the response of a produce request, with
+// the result of each record.
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// newKafkaSink returns a kafkaSink to the topic, through the REST Proxy
+// at address.
+func newKafkaSink(address, topic string, timeout time.Duration) (*kafkaSink, error) {
+	if address == "" {
+		return nil, fmt.Errorf("the kafka topology change event sink needs the URL of the Kafka REST Proxy as address")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("the kafka topology change event sink needs a topic")
+	}
+	return &kafkaSink{
+		url:    strings.TrimSuffix(address, "/") + "/topics/" + url.PathEscape(topic),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Publish is part of the Sink interface.
+func (s *kafkaSink) Publish(ctx context.Context, ev *Event) error {
+	data, err := json.Marshal(&kafkaRecords{
+		Records: []kafkaRecord{{Key: kafkaKey(ev), Value: ev}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka REST proxy %v returned %v: %s", s.url, resp.Status, body)
+	}
+
+	offsets := &kafkaOffsets{}
+	if err := json.Unmarshal(body, offsets); err != nil {
+		return fmt.Errorf("bad response of kafka REST proxy %v: %v", s.url, err)
+	}
+	if len(offsets.Offsets) != 1 {
+		return fmt.Errorf("kafka REST proxy %v returned %v offsets for 1 record", s.url, len(offsets.Offsets))
+	}
+	if o := offsets.Offsets[0]; o.ErrorCode != nil {
+		return fmt.Errorf("kafka REST proxy %v failed to produce the record: %v (%v)", s.url, o.Error, *o.ErrorCode)
+	}
+	return nil
+}
+
+// Close is part of the Sink interface.
+func (s *kafkaSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// kafkaKey returns the key of the record of an event: the kind and the
+// name of the record that changed.
+func kafkaKey(ev *Event) string {
+	switch ev.Kind {
+	case KindKeyspace:
+		return ev.Kind + "/" + ev.Keyspace
+	case KindShard:
+		return ev.Kind + "/" + ev.Keyspace + "/" + ev.Shard
+	case KindTablet:
+		return ev.Kind + "/" + ev.Tablet
+	}
+	return ev.Kind + "/" + ev.Name
+}
+
+func init() {
+	RegisterSink("kafka", func(address string) (Sink, error) {
+		return newKafkaSink(address, *kafkaTopic, *kafkaTimeout)
+	})
+}
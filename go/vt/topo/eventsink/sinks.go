@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var webhookTimeout = flag.Duration("topo_event_sink_webhook_timeout", 10*time.Second, "the timeout of the requests of the webhook topology change event sink")
+
+// writerSink writes the events to a writer, one JSON object per line.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Publish is part of the Sink interface.
+func (s *writerSink) Publish(ctx context.Context, ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close is part of the Sink interface.
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// webhookSink posts the events in JSON to a URL. Any status code but
+// 2xx is an error.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// Publish is part of the Sink interface.
+func (s *webhookSink) Publish(ctx context.Context, ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %v returned %v", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Close is part of the Sink interface.
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func init() {
+	RegisterSink("stdout", func(address string) (Sink, error) {
+		return &writerSink{w: os.Stdout}, nil
+	})
+	RegisterSink("webhook", func(address string) (Sink, error) {
+		if address == "" {
+			return nil, fmt.Errorf("the webhook topology change event sink needs the URL of the webhook as address")
+		}
+		return &webhookSink{
+			url:    address,
+			client: &http.Client{Timeout: *webhookTimeout},
+		}, nil
+	})
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"vitess.io/vitess/go/vt/log"
+)
+
+// spool holds the events that are not published yet, in order.
+// It is safe to use from multiple goroutines.
+type spool interface {
+	// add adds an event at the end. The Publisher bounds the number
+	// of events, see len.
+	add(ev *Event) error
+
+	// next returns the first event, or nil if there is none.
+	next() (*Event, error)
+
+	// remove removes the first event, once it is published.
+	remove() error
+
+	// len returns the number of events.
+	len() int
+}
+
+// memorySpool is a spool in memory.
+type memorySpool struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func newMemorySpool() *memorySpool {
+	return &memorySpool{}
+}
+
+func (s *memorySpool) add(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func (s *memorySpool) next() (*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		return nil, nil
+	}
+	return s.events[0], nil
+}
+
+func (s *memorySpool) remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) > 0 {
+		s.events[0] = nil
+		s.events = s.events[1:]
+	}
+	return nil
+}
+
+func (s *memorySpool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// dirSpool is a spool in a directory, with one file per event. The
+// files are named by the sequence number of their event, so they sort
+// in order.
+type dirSpool struct {
+	mu    sync.Mutex
+	dir   string
+	seq   uint64
+	files []string
+}
+
+// spoolFileSuffix is the suffix of the files of the events.
+const spoolFileSuffix = ".json"
+
+// newDirSpool opens the spool in dir, with the events left in it.
+func newDirSpool(dir string) (*dirSpool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &dirSpool{dir: dir}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, spoolFileSuffix) {
+			// A temporary file of an event that was not added.
+			os.Remove(path.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolFileSuffix), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected file %v in the event spool %v", name, dir)
+		}
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+		s.files = append(s.files, name)
+	}
+	sort.Strings(s.files)
+	return s, nil
+}
+
+func (s *dirSpool) add(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write a temporary file and rename it, so the file of an event
+	// is always complete. Both are synced, so the event survives a
+	// crash once it is added.
+	name := fmt.Sprintf("%020d%s", s.seq, spoolFileSuffix)
+	tmp := path.Join(s.dir, name+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.seq++
+	s.files = append(s.files, name)
+	if err := syncDir(s.dir); err != nil {
+		log.Warningf("Cannot sync the event spool %v: %v", s.dir, err)
+	}
+	return nil
+}
+
+func (s *dirSpool) next() (*Event, error) {
+	s.mu.Lock()
+	if len(s.files) == 0 {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	name := path.Join(s.dir, s.files[0])
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	ev := &Event{}
+	if err := json.Unmarshal(data, ev); err != nil {
+		return nil, fmt.Errorf("bad event in %v: %v", name, err)
+	}
+	return ev, nil
+}
+
+func (s *dirSpool) remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return nil
+	}
+	name := s.files[0]
+	s.files = s.files[1:]
+	if err := os.Remove(path.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *dirSpool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files)
+}
+
+// writeFileSync writes a file, and syncs it to the disk.
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs a directory to the disk, so the files created or
+// renamed in it are durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -259,6 +259,11 @@ func (f *FakeConn) List(ctx context.Context, filePathPrefix string) ([]topo.KVIn
 	return nil, topo.NewError(topo.NoImplementation, "List not supported in fake topo")
 }
 
+// Txn implements the Conn interface
+func (f *FakeConn) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	return nil, topo.NewError(topo.NoImplementation, "Txn not supported in fake topo")
+}
+
 // Delete implements the Conn interface
 func (f *FakeConn) Delete(ctx context.Context, filePath string, version topo.Version) error {
 	panic("implement me")
@@ -320,6 +325,11 @@ func (f *FakeConn) Watch(ctx context.Context, filePath string) (*topo.WatchData,
 	return current, notifications, nil
 }
 
+// WatchFrom implements the Conn interface
+func (f *FakeConn) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, f, filePath, version)
+}
+
 func (f *FakeConn) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
 	panic("implement me")
 }
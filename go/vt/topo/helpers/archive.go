@@ -0,0 +1,421 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/json2"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+// TopologyArchiveVersion is the version of the format of the archives
+// written by WriteTopologyArchive. ReadTopologyArchive rejects the
+// archives of other versions.
+const TopologyArchiveVersion = 1
+
+// TopologyArchive is a dump of the records of a topology server that
+// are not derived from other records. The serving graph (SrvKeyspace
+// and SrvVSchema) is not in it: it is rebuilt after an import.
+type TopologyArchive struct {
+	Cells        map[string]*topodatapb.CellInfo
+	CellsAliases map[string]*topodatapb.CellsAlias
+	Keyspaces    []*KeyspaceArchive
+	Tablets      []*topodatapb.Tablet
+	RoutingRules *vschemapb.RoutingRules
+}
+
+// KeyspaceArchive is the dump of a keyspace in a TopologyArchive.
+type KeyspaceArchive struct {
+	Name     string
+	Keyspace *topodatapb.Keyspace
+	// VSchema is nil if the keyspace has no VSchema.
+	VSchema *vschemapb.Keyspace
+	Shards  map[string]*topodatapb.Shard
+}
+
+// ExportTopology reads the records of a topology server.
+func ExportTopology(ctx context.Context, ts *topo.Server) (*TopologyArchive, error) {
+	archive := &TopologyArchive{
+		Cells:        make(map[string]*topodatapb.CellInfo),
+		CellsAliases: make(map[string]*topodatapb.CellsAlias),
+	}
+
+	cells, err := ts.GetCellInfoNames(ctx)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "GetCellInfoNames")
+	}
+	for _, cell := range cells {
+		ci, err := ts.GetCellInfo(ctx, cell, true /*strongRead*/)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "GetCellInfo(%v)", cell)
+		}
+		archive.Cells[cell] = ci
+	}
+	aliases, err := ts.GetCellsAliases(ctx, true /*strongRead*/)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "GetCellsAliases")
+	}
+	for alias, ca := range aliases {
+		archive.CellsAliases[alias] = ca
+	}
+
+	keyspaces, err := ts.GetKeyspaces(ctx)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "GetKeyspaces")
+	}
+	for _, keyspace := range keyspaces {
+		ka, err := exportKeyspace(ctx, ts, keyspace)
+		if err != nil {
+			return nil, err
+		}
+		archive.Keyspaces = append(archive.Keyspaces, ka)
+	}
+
+	for _, cell := range cells {
+		aliases, err := ts.GetTabletAliasesByCell(ctx, cell)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "GetTabletAliasesByCell(%v)", cell)
+		}
+		for _, alias := range aliases {
+			ti, err := ts.GetTablet(ctx, alias)
+			if err != nil {
+				return nil, vterrors.Wrapf(err, "GetTablet(%v)", topoproto.TabletAliasString(alias))
+			}
+			archive.Tablets = append(archive.Tablets, ti.Tablet)
+		}
+	}
+
+	archive.RoutingRules, err = ts.GetRoutingRules(ctx)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "GetRoutingRules")
+	}
+	return archive, nil
+}
+
+// exportKeyspace reads the records of a keyspace.
+func exportKeyspace(ctx context.Context, ts *topo.Server, keyspace string) (*KeyspaceArchive, error) {
+	ki, err := ts.GetKeyspace(ctx, keyspace)
+	if err != nil {
+		return nil, vterrors.Wrapf(err, "GetKeyspace(%v)", keyspace)
+	}
+	ka := &KeyspaceArchive{
+		Name:     keyspace,
+		Keyspace: ki.Keyspace,
+		Shards:   make(map[string]*topodatapb.Shard),
+	}
+
+	ka.VSchema, err = ts.GetVSchema(ctx, keyspace)
+	if err != nil {
+		if !topo.IsErrType(err, topo.NoNode) {
+			return nil, vterrors.Wrapf(err, "GetVSchema(%v)", keyspace)
+		}
+		ka.VSchema = nil
+	}
+
+	shards, err := ts.GetShardNames(ctx, keyspace)
+	if err != nil {
+		return nil, vterrors.Wrapf(err, "GetShardNames(%v)", keyspace)
+	}
+	for _, shard := range shards {
+		si, err := ts.GetShard(ctx, keyspace, shard)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "GetShard(%v/%v)", keyspace, shard)
+		}
+		ka.Shards[shard] = si.Shard
+	}
+	return ka, nil
+}
+
+// ImportTopology writes the records of an archive to a topology
+// server. The keyspaces, shards, tablets and routing rules of the
+// archive replace the existing ones, the other records are kept. The
+// cells and cells aliases that already exist are kept, as their
+// addresses depend on the environment. The serving graph of the
+// keyspaces needs to be rebuilt after the import.
+func ImportTopology(ctx context.Context, ts *topo.Server, archive *TopologyArchive) error {
+	for _, cell := range sortedKeys(archive.Cells) {
+		if err := ts.CreateCellInfo(ctx, cell, archive.Cells[cell]); err != nil {
+			if !topo.IsErrType(err, topo.NodeExists) {
+				return vterrors.Wrapf(err, "CreateCellInfo(%v)", cell)
+			}
+			log.Infof("cell %v already exists, keeping it", cell)
+		}
+	}
+	for _, alias := range sortedKeys(archive.CellsAliases) {
+		if err := ts.CreateCellsAlias(ctx, alias, archive.CellsAliases[alias]); err != nil {
+			if !topo.IsErrType(err, topo.NodeExists) {
+				return vterrors.Wrapf(err, "CreateCellsAlias(%v)", alias)
+			}
+			log.Infof("cells alias %v already exists, keeping it", alias)
+		}
+	}
+
+	for _, ka := range archive.Keyspaces {
+		if err := importKeyspace(ctx, ts, ka); err != nil {
+			return err
+		}
+	}
+
+	for _, tablet := range archive.Tablets {
+		err := ts.CreateTablet(ctx, tablet)
+		if topo.IsErrType(err, topo.NodeExists) {
+			_, err = ts.UpdateTabletFields(ctx, tablet.Alias, func(t *topodatapb.Tablet) error {
+				proto.Reset(t)
+				proto.Merge(t, tablet)
+				return nil
+			})
+		}
+		if err != nil {
+			return vterrors.Wrapf(err, "CreateTablet(%v)", topoproto.TabletAliasString(tablet.Alias))
+		}
+	}
+
+	if archive.RoutingRules != nil {
+		if err := ts.SaveRoutingRules(ctx, archive.RoutingRules); err != nil {
+			return vterrors.Wrap(err, "SaveRoutingRules")
+		}
+	}
+	return nil
+}
+
+// importKeyspace writes the records of a keyspace.
+func importKeyspace(ctx context.Context, ts *topo.Server, ka *KeyspaceArchive) error {
+	if err := ts.CreateKeyspace(ctx, ka.Name, ka.Keyspace); err != nil {
+		if !topo.IsErrType(err, topo.NodeExists) {
+			return vterrors.Wrapf(err, "CreateKeyspace(%v)", ka.Name)
+		}
+		if err := updateKeyspace(ctx, ts, ka); err != nil {
+			return vterrors.Wrapf(err, "UpdateKeyspace(%v)", ka.Name)
+		}
+	}
+
+	if ka.VSchema != nil {
+		if err := ts.SaveVSchema(ctx, ka.Name, ka.VSchema); err != nil {
+			return vterrors.Wrapf(err, "SaveVSchema(%v)", ka.Name)
+		}
+	}
+
+	for _, shard := range sortedKeys(ka.Shards) {
+		if err := ts.CreateShard(ctx, ka.Name, shard); err != nil && !topo.IsErrType(err, topo.NodeExists) {
+			return vterrors.Wrapf(err, "CreateShard(%v/%v)", ka.Name, shard)
+		}
+		if _, err := ts.UpdateShardFields(ctx, ka.Name, shard, func(si *topo.ShardInfo) error {
+			si.Shard = proto.Clone(ka.Shards[shard]).(*topodatapb.Shard)
+			return nil
+		}); err != nil {
+			return vterrors.Wrapf(err, "UpdateShardFields(%v/%v)", ka.Name, shard)
+		}
+	}
+	return nil
+}
+
+// updateKeyspace replaces the record of an existing keyspace.
+func updateKeyspace(ctx context.Context, ts *topo.Server, ka *KeyspaceArchive) (err error) {
+	ctx, unlock, lockErr := ts.LockKeyspace(ctx, ka.Name, "ImportTopology")
+	if lockErr != nil {
+		return lockErr
+	}
+	defer unlock(&err)
+
+	ki, err := ts.GetKeyspace(ctx, ka.Name)
+	if err != nil {
+		return err
+	}
+	ki.Keyspace = proto.Clone(ka.Keyspace).(*topodatapb.Keyspace)
+	return ts.UpdateKeyspace(ctx, ki)
+}
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The JSON encoding of a TopologyArchive. The records are encoded with
+// protojson.
+type topologyArchiveJSON struct {
+	Version      int                        `json:"version"`
+	Cells        map[string]json.RawMessage `json:"cells,omitempty"`
+	CellsAliases map[string]json.RawMessage `json:"cells_aliases,omitempty"`
+	Keyspaces    []*keyspaceArchiveJSON     `json:"keyspaces,omitempty"`
+	Tablets      []json.RawMessage          `json:"tablets,omitempty"`
+	RoutingRules json.RawMessage            `json:"routing_rules,omitempty"`
+}
+
+type keyspaceArchiveJSON struct {
+	Name     string                     `json:"name"`
+	Keyspace json.RawMessage            `json:"keyspace"`
+	VSchema  json.RawMessage            `json:"vschema,omitempty"`
+	Shards   map[string]json.RawMessage `json:"shards,omitempty"`
+}
+
+// WriteTopologyArchive writes an archive as JSON.
+func WriteTopologyArchive(w io.Writer, archive *TopologyArchive) error {
+	aj := &topologyArchiveJSON{
+		Version:      TopologyArchiveVersion,
+		Cells:        make(map[string]json.RawMessage),
+		CellsAliases: make(map[string]json.RawMessage),
+	}
+	var err error
+	for cell, ci := range archive.Cells {
+		if aj.Cells[cell], err = json2.MarshalPB(ci); err != nil {
+			return err
+		}
+	}
+	for alias, ca := range archive.CellsAliases {
+		if aj.CellsAliases[alias], err = json2.MarshalPB(ca); err != nil {
+			return err
+		}
+	}
+	for _, ka := range archive.Keyspaces {
+		kj := &keyspaceArchiveJSON{
+			Name:   ka.Name,
+			Shards: make(map[string]json.RawMessage),
+		}
+		if kj.Keyspace, err = json2.MarshalPB(ka.Keyspace); err != nil {
+			return err
+		}
+		if ka.VSchema != nil {
+			if kj.VSchema, err = json2.MarshalPB(ka.VSchema); err != nil {
+				return err
+			}
+		}
+		for shard, s := range ka.Shards {
+			if kj.Shards[shard], err = json2.MarshalPB(s); err != nil {
+				return err
+			}
+		}
+		aj.Keyspaces = append(aj.Keyspaces, kj)
+	}
+	for _, tablet := range archive.Tablets {
+		tj, err := json2.MarshalPB(tablet)
+		if err != nil {
+			return err
+		}
+		aj.Tablets = append(aj.Tablets, tj)
+	}
+	if archive.RoutingRules != nil {
+		if aj.RoutingRules, err = json2.MarshalPB(archive.RoutingRules); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(aj, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadTopologyArchive reads an archive written by WriteTopologyArchive.
+func ReadTopologyArchive(r io.Reader) (*TopologyArchive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	aj := &topologyArchiveJSON{}
+	if err := json2.Unmarshal(data, aj); err != nil {
+		return nil, vterrors.Wrap(err, "cannot parse topology archive")
+	}
+	if aj.Version != TopologyArchiveVersion {
+		return nil, fmt.Errorf("unsupported topology archive version %v, expected %v", aj.Version, TopologyArchiveVersion)
+	}
+
+	archive := &TopologyArchive{
+		Cells:        make(map[string]*topodatapb.CellInfo),
+		CellsAliases: make(map[string]*topodatapb.CellsAlias),
+	}
+	for cell, cj := range aj.Cells {
+		ci := &topodatapb.CellInfo{}
+		if err := unmarshalArchiveRecord(cj, ci, "cell "+cell); err != nil {
+			return nil, err
+		}
+		archive.Cells[cell] = ci
+	}
+	for alias, cj := range aj.CellsAliases {
+		ca := &topodatapb.CellsAlias{}
+		if err := unmarshalArchiveRecord(cj, ca, "cells alias "+alias); err != nil {
+			return nil, err
+		}
+		archive.CellsAliases[alias] = ca
+	}
+	for _, kj := range aj.Keyspaces {
+		ka := &KeyspaceArchive{
+			Name:     kj.Name,
+			Keyspace: &topodatapb.Keyspace{},
+			Shards:   make(map[string]*topodatapb.Shard),
+		}
+		if err := unmarshalArchiveRecord(kj.Keyspace, ka.Keyspace, "keyspace "+kj.Name); err != nil {
+			return nil, err
+		}
+		if len(kj.VSchema) > 0 {
+			ka.VSchema = &vschemapb.Keyspace{}
+			if err := unmarshalArchiveRecord(kj.VSchema, ka.VSchema, "vschema of keyspace "+kj.Name); err != nil {
+				return nil, err
+			}
+		}
+		for shard, sj := range kj.Shards {
+			s := &topodatapb.Shard{}
+			if err := unmarshalArchiveRecord(sj, s, "shard "+kj.Name+"/"+shard); err != nil {
+				return nil, err
+			}
+			ka.Shards[shard] = s
+		}
+		archive.Keyspaces = append(archive.Keyspaces, ka)
+	}
+	for _, tj := range aj.Tablets {
+		tablet := &topodatapb.Tablet{}
+		if err := unmarshalArchiveRecord(tj, tablet, "tablet"); err != nil {
+			return nil, err
+		}
+		archive.Tablets = append(archive.Tablets, tablet)
+	}
+	if len(aj.RoutingRules) > 0 {
+		archive.RoutingRules = &vschemapb.RoutingRules{}
+		if err := unmarshalArchiveRecord(aj.RoutingRules, archive.RoutingRules, "routing rules"); err != nil {
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+// unmarshalArchiveRecord unmarshals a record of an archive.
+func unmarshalArchiveRecord(data json.RawMessage, pb proto.Message, name string) error {
+	if err := protojson.Unmarshal(data, pb); err != nil {
+		return vterrors.Wrapf(err, "cannot parse %v in topology archive", name)
+	}
+	return nil
+}
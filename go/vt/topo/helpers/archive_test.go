@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/test/utils"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+func TestExportImportTopology(t *testing.T) {
+	ctx := context.Background()
+	fromTS, toTS := createSetup(ctx, t)
+	vs := &vschemapb.Keyspace{
+		Tables: map[string]*vschemapb.Table{"t1": {}},
+	}
+	require.NoError(t, fromTS.SaveVSchema(ctx, "test_keyspace", vs))
+
+	archive, err := ExportTopology(ctx, fromTS)
+	require.NoError(t, err)
+	require.Len(t, archive.Keyspaces, 1)
+	assert.Equal(t, "test_keyspace", archive.Keyspaces[0].Name)
+	assert.Contains(t, archive.Keyspaces[0].Shards, "0")
+	assert.Len(t, archive.Tablets, 2)
+	assert.Contains(t, archive.Cells, "test_cell")
+
+	// The archive survives a round trip through its JSON encoding.
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteTopologyArchive(buf, archive))
+	read, err := ReadTopologyArchive(buf)
+	require.NoError(t, err)
+	utils.MustMatch(t, archive, read)
+
+	// Importing twice replaces the records.
+	require.NoError(t, ImportTopology(ctx, toTS, read))
+	require.NoError(t, ImportTopology(ctx, toTS, read))
+
+	imported, err := ExportTopology(ctx, toTS)
+	require.NoError(t, err)
+	utils.MustMatch(t, archive.Keyspaces[0].VSchema, imported.Keyspaces[0].VSchema)
+	utils.MustMatch(t, archive.RoutingRules, imported.RoutingRules)
+	require.Len(t, imported.Tablets, 2)
+	for i, tablet := range imported.Tablets {
+		assert.Equal(t, archive.Tablets[i].Hostname, tablet.Hostname)
+		assert.Equal(t, archive.Tablets[i].Type, tablet.Type)
+	}
+	si, err := toTS.GetShard(ctx, "test_keyspace", "0")
+	require.NoError(t, err)
+	utils.MustMatch(t, archive.Keyspaces[0].Shards["0"], si.Shard)
+}
+
+func TestImportTopologyUpdatesTablets(t *testing.T) {
+	ctx := context.Background()
+	fromTS, toTS := createSetup(ctx, t)
+	archive, err := ExportTopology(ctx, fromTS)
+	require.NoError(t, err)
+	require.NoError(t, ImportTopology(ctx, toTS, archive))
+
+	archive.Tablets[1].Type = topodatapb.TabletType_RDONLY
+	require.NoError(t, ImportTopology(ctx, toTS, archive))
+	ti, err := toTS.GetTablet(ctx, archive.Tablets[1].Alias)
+	require.NoError(t, err)
+	assert.Equal(t, topodatapb.TabletType_RDONLY, ti.Type)
+}
+
+func TestReadTopologyArchiveVersion(t *testing.T) {
+	_, err := ReadTopologyArchive(strings.NewReader(`{"version": 2}`))
+	require.ErrorContains(t, err, "unsupported topology archive version 2")
+
+	_, err = ReadTopologyArchive(strings.NewReader(`{"version": 1, "tablets": [{"hostname": 3}]}`))
+	require.ErrorContains(t, err, "cannot parse tablet in topology archive")
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// DiffKind is the kind of a difference between two topologies.
+type DiffKind string
+
+const (
+	// DiffAdded is a record that is only in the second topology.
+	DiffAdded = DiffKind("added")
+
+	// DiffRemoved is a record that is only in the first topology.
+	DiffRemoved = DiffKind("removed")
+
+	// DiffChanged is a record that is in both topologies, with
+	// different values.
+	DiffChanged = DiffKind("changed")
+)
+
+// The types of the records of a TopologyDiffEntry.
+const (
+	DiffTypeKeyspace     = "keyspace"
+	DiffTypeVSchema      = "vschema"
+	DiffTypeShard        = "shard"
+	DiffTypeTablet       = "tablet"
+	DiffTypeRoutingRules = "routing_rules"
+)
+
+// TopologyDiffEntry is a record that differs between two topologies.
+type TopologyDiffEntry struct {
+	Kind DiffKind
+
+	// Type is the type of the record, one of the DiffType constants.
+	Type string
+
+	// Name is the name of the record: the keyspace for keyspaces and
+	// VSchemas, keyspace/shard for shards, and the alias for tablets.
+	// It is empty for the routing rules.
+	Name string
+
+	// From and To are the records in the first and second topologies.
+	// From is nil for DiffAdded, and To for DiffRemoved.
+	From, To proto.Message
+
+	// Fields are the names of the top level fields of the record that
+	// differ, for DiffChanged.
+	Fields []string
+}
+
+// String returns a line describing the entry.
+func (e *TopologyDiffEntry) String() string {
+	name := e.Type
+	if e.Name != "" {
+		name += " " + e.Name
+	}
+	if e.Kind != DiffChanged {
+		return fmt.Sprintf("%v %v", e.Kind, name)
+	}
+	return fmt.Sprintf("%v %v: %v", e.Kind, name, strings.Join(e.Fields, ", "))
+}
+
+// TopologyDiff is the difference between two topologies.
+type TopologyDiff struct {
+	Entries []*TopologyDiffEntry
+}
+
+// IsEmpty returns true if the topologies have the same records.
+func (d *TopologyDiff) IsEmpty() bool {
+	return len(d.Entries) == 0
+}
+
+// String returns the entries of the diff, one per line.
+func (d *TopologyDiff) String() string {
+	lines := make([]string, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		lines = append(lines, e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add records the difference of a record, if any. A nil from or to is
+// a missing record.
+func (d *TopologyDiff) add(recordType, name string, from, to proto.Message) {
+	e := &TopologyDiffEntry{
+		Type: recordType,
+		Name: name,
+		From: from,
+		To:   to,
+	}
+	switch {
+	case isNilMessage(from) && isNilMessage(to):
+		return
+	case isNilMessage(from):
+		e.Kind = DiffAdded
+		e.From = nil
+	case isNilMessage(to):
+		e.Kind = DiffRemoved
+		e.To = nil
+	case proto.Equal(from, to):
+		return
+	default:
+		e.Kind = DiffChanged
+		e.Fields = changedFields(from, to)
+	}
+	d.Entries = append(d.Entries, e)
+}
+
+// isNilMessage returns true for a nil message, typed or not.
+func isNilMessage(m proto.Message) bool {
+	return m == nil || !m.ProtoReflect().IsValid()
+}
+
+// changedFields returns the names of the top level fields that differ
+// between two records of the same type.
+func changedFields(from, to proto.Message) []string {
+	fm, tm := from.ProtoReflect(), to.ProtoReflect()
+	var fields []string
+	fds := fm.Descriptor().Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		// Compare the messages with only this field.
+		f, t := fm.New(), tm.New()
+		if fm.Has(fd) {
+			f.Set(fd, fm.Get(fd))
+		}
+		if tm.Has(fd) {
+			t.Set(fd, tm.Get(fd))
+		}
+		if !proto.Equal(f.Interface(), t.Interface()) {
+			fields = append(fields, string(fd.Name()))
+		}
+	}
+	return fields
+}
+
+// DiffTopology returns the difference of the keyspaces, VSchemas,
+// shards, tablets and routing rules of two topology servers.
+func DiffTopology(ctx context.Context, fromTS, toTS *topo.Server) (*TopologyDiff, error) {
+	from, err := ExportTopology(ctx, fromTS)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "cannot export the first topology")
+	}
+	to, err := ExportTopology(ctx, toTS)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "cannot export the second topology")
+	}
+	return DiffTopologyArchives(from, to), nil
+}
+
+// DiffTopologyArchives returns the difference of the keyspaces,
+// VSchemas, shards, tablets and routing rules of two archives. To
+// compare a topology server to an archive, export it with
+// ExportTopology first. The cells are not compared, as their addresses
+// depend on the environment. The entries are sorted by keyspace, then
+// by tablet alias.
+func DiffTopologyArchives(from, to *TopologyArchive) *TopologyDiff {
+	d := &TopologyDiff{}
+
+	fromKeyspaces := keyspaceArchivesByName(from)
+	toKeyspaces := keyspaceArchivesByName(to)
+	for _, name := range unionKeys(fromKeyspaces, toKeyspaces) {
+		fka, tka := fromKeyspaces[name], toKeyspaces[name]
+		if fka == nil {
+			fka = &KeyspaceArchive{}
+		}
+		if tka == nil {
+			tka = &KeyspaceArchive{}
+		}
+		d.add(DiffTypeKeyspace, name, fka.Keyspace, tka.Keyspace)
+		d.add(DiffTypeVSchema, name, fka.VSchema, tka.VSchema)
+		for _, shard := range unionKeys(fka.Shards, tka.Shards) {
+			d.add(DiffTypeShard, topoproto.KeyspaceShardString(name, shard), fka.Shards[shard], tka.Shards[shard])
+		}
+	}
+
+	fromTablets := tabletsByAlias(from)
+	toTablets := tabletsByAlias(to)
+	for _, alias := range unionKeys(fromTablets, toTablets) {
+		d.add(DiffTypeTablet, alias, fromTablets[alias], toTablets[alias])
+	}
+
+	d.add(DiffTypeRoutingRules, "", from.RoutingRules, to.RoutingRules)
+	return d
+}
+
+// keyspaceArchivesByName returns the keyspaces of an archive by name.
+func keyspaceArchivesByName(a *TopologyArchive) map[string]*KeyspaceArchive {
+	result := make(map[string]*KeyspaceArchive, len(a.Keyspaces))
+	for _, ka := range a.Keyspaces {
+		result[ka.Name] = ka
+	}
+	return result
+}
+
+// tabletsByAlias returns the tablets of an archive by alias.
+func tabletsByAlias(a *TopologyArchive) map[string]*topodatapb.Tablet {
+	result := make(map[string]*topodatapb.Tablet, len(a.Tablets))
+	for _, tablet := range a.Tablets {
+		result[topoproto.TabletAliasString(tablet.Alias)] = tablet
+	}
+	return result
+}
+
+// unionKeys returns the keys of two maps, sorted.
+func unionKeys[V1, V2 any](m1 map[string]V1, m2 map[string]V2) []string {
+	keys := make([]string, 0, len(m1)+len(m2))
+	for k := range m1 {
+		keys = append(keys, k)
+	}
+	for k := range m2 {
+		if _, ok := m1[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
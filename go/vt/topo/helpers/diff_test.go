@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/test/utils"
+	"vitess.io/vitess/go/vt/topo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+func TestDiffTopology(t *testing.T) {
+	ctx := context.Background()
+	fromTS, toTS := createSetup(ctx, t)
+
+	archive, err := ExportTopology(ctx, fromTS)
+	require.NoError(t, err)
+	require.NoError(t, ImportTopology(ctx, toTS, archive))
+
+	d, err := DiffTopology(ctx, fromTS, toTS)
+	require.NoError(t, err)
+	assert.True(t, d.IsEmpty(), d.String())
+
+	// Change the second topology.
+	require.NoError(t, toTS.CreateKeyspace(ctx, "other_keyspace", &topodatapb.Keyspace{}))
+	require.NoError(t, toTS.SaveVSchema(ctx, "test_keyspace", &vschemapb.Keyspace{Sharded: true}))
+	_, err = toTS.UpdateShardFields(ctx, "test_keyspace", "0", func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = false
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = toTS.UpdateTabletFields(ctx, archive.Tablets[1].Alias, func(tablet *topodatapb.Tablet) error {
+		tablet.Type = topodatapb.TabletType_RDONLY
+		tablet.Hostname = "otherhost"
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, toTS.DeleteTablet(ctx, archive.Tablets[0].Alias))
+
+	d, err = DiffTopology(ctx, fromTS, toTS)
+	require.NoError(t, err)
+	assert.Equal(t, `added keyspace other_keyspace
+added vschema test_keyspace
+changed shard test_keyspace/0: is_primary_serving
+removed tablet test_cell-0000000123
+changed tablet test_cell-0000000234: hostname, type`, d.String())
+	require.Len(t, d.Entries, 5)
+	assert.Nil(t, d.Entries[0].From)
+	utils.MustMatch(t, archive.Tablets[0], d.Entries[3].From)
+	assert.Nil(t, d.Entries[3].To)
+}
@@ -18,9 +18,12 @@ package helpers
 
 import (
 	"context"
+	"fmt"
 
 	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vterrors"
 )
 
 // TeeFactory is an implementation of topo.Factory that uses a primary
@@ -163,11 +166,41 @@ func (c *TeeConn) Delete(ctx context.Context, filePath string, version topo.Vers
 	return nil
 }
 
+// Txn is part of the topo.Conn interface.
+func (c *TeeConn) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	primaryVersions, err := c.primary.Txn(ctx, ops)
+	if err != nil {
+		// Failed on primary, not updating secondary.
+		return nil, err
+	}
+
+	// Always do unconditional writes on secondary, one by one,
+	// like Update and Delete do.
+	for _, op := range ops {
+		switch op.Type {
+		case topo.TxnCreate, topo.TxnUpdate:
+			if _, err := c.secondary.Update(ctx, op.Path, op.Contents, nil); err != nil {
+				log.Warningf("secondary.Update(%v,unconditonal) failed: %v", op.Path, err)
+			}
+		case topo.TxnDelete:
+			if err := c.secondary.Delete(ctx, op.Path, nil); err != nil && !topo.IsErrType(err, topo.NoNode) {
+				log.Warningf("secondary.Delete(%v) failed: %v", op.Path, err)
+			}
+		}
+	}
+	return primaryVersions, nil
+}
+
 // Watch is part of the topo.Conn interface
 func (c *TeeConn) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-chan *topo.WatchData, error) {
 	return c.primary.Watch(ctx, filePath)
 }
 
+// WatchFrom is part of the topo.Conn interface
+func (c *TeeConn) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return c.primary.WatchFrom(ctx, filePath, version)
+}
+
 func (c *TeeConn) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
 	return c.primary.WatchRecursive(ctx, path)
 }
@@ -233,6 +266,67 @@ func (ld *teeTopoLockDescriptor) Unlock(ctx context.Context) error {
 	return ferr
 }
 
+// teeLockVersion is the version of a holding of a lock through the
+// TeeConn: the versions of the holdings of lockFirst and lockSecond.
+// It implements topo.Version.
+type teeLockVersion struct {
+	first, second topo.Version
+}
+
+// String is part of the topo.Version interface.
+func (v teeLockVersion) String() string {
+	return fmt.Sprintf("%v/%v", v.first, v.second)
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface. It
+// returns the contents of the lock on lockFirst, and the versions of the
+// holdings on both servers, since Lock takes both.
+func (c *TeeConn) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	first, ok := c.lockFirst.(topo.LockInspectorConn)
+	if !ok {
+		return "", nil, topo.NewError(topo.NoImplementation, dirPath)
+	}
+	contents, firstVersion, err := first.LockHolder(ctx, dirPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The lock on lockSecond may not be taken yet, or not be
+	// inspectable: only the lock on lockFirst is broken then.
+	var secondVersion topo.Version
+	if second, ok := c.lockSecond.(topo.LockInspectorConn); ok {
+		if secondContents, version, err := second.LockHolder(ctx, dirPath); err == nil && secondContents == contents {
+			secondVersion = version
+		}
+	}
+	return contents, teeLockVersion{first: firstVersion, second: secondVersion}, nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface. The lock
+// is broken on lockFirst, then on lockSecond if it was held there too.
+func (c *TeeConn) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(teeLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	first, ok := c.lockFirst.(topo.LockInspectorConn)
+	if !ok {
+		return topo.NewError(topo.NoImplementation, dirPath)
+	}
+	if err := first.BreakLock(ctx, dirPath, v.first); err != nil {
+		return err
+	}
+
+	if v.second != nil {
+		if second, ok := c.lockSecond.(topo.LockInspectorConn); ok {
+			if err := second.BreakLock(ctx, dirPath, v.second); err != nil {
+				log.Warningf("Failed to break lockSecond lock for %v: %v", dirPath, err)
+			}
+		}
+	}
+	return nil
+}
+
 // NewLeaderParticipation is part of the topo.Conn interface.
 func (c *TeeConn) NewLeaderParticipation(name, id string) (topo.LeaderParticipation, error) {
 	return c.primary.NewLeaderParticipation(name, id)
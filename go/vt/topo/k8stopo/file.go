@@ -260,6 +260,11 @@ func (s *Server) List(ctx context.Context, filePathPrefix string) ([]topo.KVInfo
 	return results, nil
 }
 
+// Txn is part of the topo.Conn interface.
+func (s *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	return nil, topo.NewError(topo.NoImplementation, "Txn not supported in k8s topo")
+}
+
 // Delete is part of the topo.Conn interface.
 func (s *Server) Delete(ctx context.Context, filePath string, version topo.Version) error {
 	log.V(7).Infof("Delete at '%s'", filePath)
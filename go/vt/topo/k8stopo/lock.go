@@ -23,9 +23,12 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
+	"vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/topo"
 	vtv1beta1 "vitess.io/vitess/go/vt/topo/k8stopo/apis/topo/v1beta1"
+	"vitess.io/vitess/go/vt/vterrors"
 )
 
 // kubernetesLockDescriptor implements topo.LockDescriptor.
@@ -33,6 +36,9 @@ type kubernetesLockDescriptor struct {
 	s         *Server
 	leaseID   string
 	leasePath string
+	// uid is the UID of the resource of the lock, so we don't mistake
+	// the lock of the next holder for ours if ours was broken.
+	uid types.UID
 }
 
 // Lock is part of the topo.Conn interface.
@@ -40,6 +46,42 @@ func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockD
 	return s.lock(ctx, dirPath, contents, false)
 }
 
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (s *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	node := s.newNodeReference(dirPath)
+	result, err := s.resourceClient.Get(ctx, node.id, metav1.GetOptions{})
+	if err != nil {
+		return "", nil, convertError(err, dirPath)
+	}
+	if !result.Data.Ephemeral {
+		return "", nil, topo.NewError(topo.NoNode, dirPath)
+	}
+	contents, err := unpackValue([]byte(result.Data.Value))
+	if err != nil {
+		return "", nil, convertError(err, dirPath)
+	}
+	return string(contents), KubernetesVersion(result.GetResourceVersion()), nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It deletes the resource of the lock if it still has the resource
+// version of the version, the holder then fails its Check.
+func (s *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(KubernetesVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	node := s.newNodeReference(dirPath)
+	resourceVersion := string(v)
+	err := s.resourceClient.Delete(ctx, node.id, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+	})
+	if errors.IsConflict(err) {
+		return topo.NewError(topo.BadVersion, dirPath)
+	}
+	return convertError(err, dirPath)
+}
+
 // lock is used by both Lock() and primary election.
 // it blocks until the lock is taken, interrupted, or times out
 func (s *Server) lock(ctx context.Context, nodePath, contents string, createMissing bool) (topo.LockDescriptor, error) {
@@ -90,24 +132,33 @@ func (s *Server) lock(ctx context.Context, nodePath, contents string, createMiss
 		s:         s,
 		leaseID:   resource.Name,
 		leasePath: resource.Data.Key,
+		uid:       final.UID,
 	}, nil
 }
 
 // Check is part of the topo.LockDescriptor interface.
 func (ld *kubernetesLockDescriptor) Check(ctx context.Context) error {
 	// Get the object and ensure the leaseid
-	_, err := ld.s.resourceClient.Get(ctx, ld.leaseID, metav1.GetOptions{}) // TODO namespacing
+	result, err := ld.s.resourceClient.Get(ctx, ld.leaseID, metav1.GetOptions{}) // TODO namespacing
 	if err != nil {
 		return convertError(err, ld.leasePath)
 
 	}
+	if result.UID != ld.uid {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.leasePath)
+	}
 
 	return nil
 }
 
 // Unlock is part of the topo.LockDescriptor interface.
 func (ld *kubernetesLockDescriptor) Unlock(ctx context.Context) error {
-	err := ld.s.resourceClient.Delete(ctx, ld.leaseID, metav1.DeleteOptions{}) // TODO namespacing
+	err := ld.s.resourceClient.Delete(ctx, ld.leaseID, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &ld.uid},
+	}) // TODO namespacing
+	if errors.IsConflict(err) {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "unlock: lock %v not held", ld.leasePath)
+	}
 	if err != nil {
 		return convertError(err, ld.leasePath)
 	}
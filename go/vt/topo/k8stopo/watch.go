@@ -120,9 +120,14 @@ func closeOnDone(ctx context.Context, filePath string, informerChan chan struct{
 	close(changes)
 }
 
+// WatchFrom is part of the topo.Conn interface.
+func (s *Server) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, s, filePath, version)
+}
+
 // WatchRecursive is part of the topo.Conn interface.
-func (s *Server) WatchRecursive(_ context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
+func (s *Server) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
 	// Kubernetes doesn't seem to provide a primitive that watches a prefix
-	// or directory, so this likely can never be implemented.
-	return nil, nil, topo.NewError(topo.NoImplementation, path)
+	// or directory, so this is emulated with a watch per file.
+	return topo.EmulateWatchRecursive(ctx, s, path, topo.WatchRecursivePollInterval)
 }
@@ -18,6 +18,8 @@ package topo
 
 import (
 	"path"
+	"strings"
+	"sync"
 
 	"google.golang.org/protobuf/proto"
 
@@ -26,6 +28,9 @@ import (
 	"vitess.io/vitess/go/vt/vterrors"
 
 	"vitess.io/vitess/go/event"
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/vt/concurrency"
+	"vitess.io/vitess/go/vt/key"
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/topo/events"
 
@@ -219,7 +224,12 @@ func (ts *Server) UpdateKeyspace(ctx context.Context, ki *KeyspaceInfo) error {
 	if err := CheckKeyspaceLocked(ctx, ki.keyspace); err != nil {
 		return err
 	}
+	return ts.updateKeyspace(ctx, ki)
+}
 
+// updateKeyspace writes the keyspace data, if its version didn't
+// change. It doesn't check the keyspace is locked.
+func (ts *Server) updateKeyspace(ctx context.Context, ki *KeyspaceInfo) error {
 	data, err := proto.Marshal(ki.Keyspace)
 	if err != nil {
 		return err
@@ -239,27 +249,145 @@ func (ts *Server) UpdateKeyspace(ctx context.Context, ki *KeyspaceInfo) error {
 	return nil
 }
 
+// UpdateKeyspaceFields is a high level helper to read a keyspace
+// record, call an update function on it, and then write it back. If the
+// write fails due to a version mismatch, it will re-read the record and
+// retry the update. It doesn't need the keyspace lock.
+// If the update succeeds, it returns the updated KeyspaceInfo.
+// If the update method returns ErrNoUpdateNeeded, nothing is written,
+// and nil,nil is returned.
+func (ts *Server) UpdateKeyspaceFields(ctx context.Context, keyspace string, update func(*KeyspaceInfo) error) (*KeyspaceInfo, error) {
+	for {
+		ki, err := ts.GetKeyspace(ctx, keyspace)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(ki); err != nil {
+			if IsErrType(err, NoUpdateNeeded) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if err := ts.updateKeyspace(ctx, ki); !IsErrType(err, BadVersion) {
+			if err != nil {
+				return nil, err
+			}
+			return ki, nil
+		}
+	}
+}
+
 // FindAllShardsInKeyspace reads and returns all the existing shards in
 // a keyspace. It doesn't take any lock.
 func (ts *Server) FindAllShardsInKeyspace(ctx context.Context, keyspace string) (map[string]*ShardInfo, error) {
-	shards, err := ts.GetShardNames(ctx, keyspace)
+	result, err := ts.GetShards(ctx, keyspace)
 	if err != nil {
 		return nil, vterrors.Wrapf(err, "failed to get list of shards for keyspace '%v'", keyspace)
 	}
+	return result, nil
+}
+
+// KeyspaceCoverage is the part of the keyspace ids of a keyspace
+// covered by its primary serving shards, see GetKeyspaceCoverage. The
+// key ranges are normalized, see key.KeyRangeNormalize, and in order.
+type KeyspaceCoverage struct {
+	// Covered is covered by at least one shard.
+	Covered []*topodatapb.KeyRange
+
+	// Gaps is covered by no shard, and Overlaps by more than one.
+	// Both are empty if the shards are a partition of the keyspace.
+	Gaps     []*topodatapb.KeyRange
+	Overlaps []*topodatapb.KeyRange
+}
 
-	result := make(map[string]*ShardInfo, len(shards))
+// GetKeyspaceCoverage returns the part of the keyspace ids covered by
+// the primary serving shards of a keyspace, which can have any layout,
+// for instance during a resharding of part of the keyspace. A shard
+// with no key range covers all of it.
+func (ts *Server) GetKeyspaceCoverage(ctx context.Context, keyspace string) (*KeyspaceCoverage, error) {
+	shards, err := ts.FindAllShardsInKeyspace(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	var keyRanges []*topodatapb.KeyRange
+	for _, si := range shards {
+		if si.IsPrimaryServing {
+			keyRanges = append(keyRanges, si.KeyRange)
+		}
+	}
+	gaps, overlaps := key.KeyRangeGapsAndOverlaps(keyRanges)
+	return &KeyspaceCoverage{
+		Covered:  key.KeyRangesUnion(keyRanges),
+		Gaps:     gaps,
+		Overlaps: overlaps,
+	}, nil
+}
+
+// StreamShardsInKeyspace reads all the existing shards in a keyspace,
+// and calls callback for each of them as soon as it is read, instead of
+// returning them all at once. At most maxConcurrency shards are read at
+// the same time (one if it is not positive). The callback is
+// never called concurrently, and the shards are passed in no particular
+// order. Shards that disappear while being read are skipped.
+// If reading a shard or the callback fails, no more shards are read,
+// and the first error is returned. It doesn't take any lock.
+func (ts *Server) StreamShardsInKeyspace(ctx context.Context, keyspace string, maxConcurrency int, callback func(*ShardInfo) error) error {
+	shards, err := ts.GetShardNames(ctx, keyspace)
+	if err != nil {
+		return vterrors.Wrapf(err, "failed to get list of shards for keyspace '%v'", keyspace)
+	}
+
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		rec  concurrency.FirstErrorRecorder
+		sema = sync2.NewSemaphore(maxConcurrency, 0)
+	)
 	for _, shard := range shards {
-		si, err := ts.GetShard(ctx, keyspace, shard)
-		if err != nil {
-			if IsErrType(err, NoNode) {
+		if !sema.AcquireContext(ctx) {
+			break
+		}
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			defer sema.Release()
+
+			si, err := ts.GetShard(ctx, keyspace, shard)
+			switch {
+			case IsErrType(err, NoNode):
 				log.Warningf("GetShard(%v, %v) returned ErrNoNode, consider checking the topology.", keyspace, shard)
-			} else {
-				return nil, vterrors.Wrapf(err, "GetShard(%v, %v) failed", keyspace, shard)
+				return
+			case err != nil:
+				rec.RecordError(vterrors.Wrapf(err, "GetShard(%v, %v) failed", keyspace, shard))
+				cancel()
+				return
 			}
-		}
-		result[shard] = si
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() != nil {
+				// Another shard failed, or the caller gave up.
+				return
+			}
+			if err := callback(si); err != nil {
+				rec.RecordError(err)
+				cancel()
+			}
+		}(shard)
 	}
-	return result, nil
+	wg.Wait()
+
+	if rec.HasErrors() {
+		return rec.Error()
+	}
+	// The context of the caller may have expired.
+	return ctx.Err()
 }
 
 // GetServingShards returns all shards where the primary is serving.
@@ -351,3 +479,143 @@ func (ts *Server) GetShardNames(ctx context.Context, keyspace string) ([]string,
 	}
 	return DirEntriesToStringArray(children), err
 }
+
+// WatchKeyspaceData wraps the data we receive on the watch channel
+// The WatchKeyspace API guarantees exactly one of Value or Err will be set.
+type WatchKeyspaceData struct {
+	Value   *topodatapb.Keyspace
+	Version Version
+	Err     error
+}
+
+// WatchKeyspace will set a watch on the Keyspace object.
+// It has the same contract as conn.Watch, but it also unpacks the
+// contents into a Keyspace object
+func (ts *Server) WatchKeyspace(ctx context.Context, keyspace string) (*WatchKeyspaceData, <-chan *WatchKeyspaceData, error) {
+	keyspacePath := path.Join(KeyspacesPath, keyspace, KeyspaceFile)
+	ctx, cancel := context.WithCancel(ctx)
+
+	current, wdChannel, err := ts.globalCell.Watch(ctx, keyspacePath)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	value := &topodatapb.Keyspace{}
+	if err := proto.Unmarshal(current.Contents, value); err != nil {
+		// Cancel the watch, drain channel.
+		cancel()
+		for range wdChannel {
+		}
+		return nil, nil, vterrors.Wrapf(err, "error unpacking initial Keyspace object")
+	}
+
+	changes := make(chan *WatchKeyspaceData, 10)
+	// The background routine reads any event from the watch channel,
+	// translates it, and sends it to the caller.
+	// If cancel() is called, the underlying Watch() code will
+	// send an ErrInterrupted and then close the channel. We'll
+	// just propagate that back to our caller.
+	go func() {
+		defer cancel()
+		defer close(changes)
+
+		for wd := range wdChannel {
+			if wd.Err != nil {
+				// Last error value, we're done.
+				// wdChannel will be closed right after
+				// this, no need to do anything.
+				changes <- &WatchKeyspaceData{Err: wd.Err}
+				return
+			}
+
+			value := &topodatapb.Keyspace{}
+			if err := proto.Unmarshal(wd.Contents, value); err != nil {
+				cancel()
+				for range wdChannel {
+				}
+				changes <- &WatchKeyspaceData{Err: vterrors.Wrapf(err, "error unpacking Keyspace object")}
+				return
+			}
+
+			changes <- &WatchKeyspaceData{Value: value, Version: wd.Version}
+		}
+	}()
+
+	return &WatchKeyspaceData{Value: value, Version: current.Version}, changes, nil
+}
+
+// WatchKeyspacePrefixData wraps the data we receive on the watch channel
+// of WatchKeyspacePrefix. Shard is the name of the shard whose record
+// changed, and exactly one of Value or Err is set: Err is ErrNoNode if
+// the record was deleted. If Shard is empty, Err is the final error of
+// the watch.
+type WatchKeyspacePrefixData struct {
+	Shard string
+	Value *topodatapb.Shard
+	Err   error
+}
+
+// WatchKeyspacePrefix watches the records of all the shards of a keyspace
+// with a single recursive watch, including the shards created later,
+// instead of one WatchShard per shard. It returns the current records,
+// and has the same contract as conn.WatchRecursive.
+func (ts *Server) WatchKeyspacePrefix(ctx context.Context, keyspace string) ([]*WatchKeyspacePrefixData, <-chan *WatchKeyspacePrefixData, error) {
+	shardsPath := path.Join(KeyspacesPath, keyspace, ShardsPath)
+	current, wdChannel, err := ts.globalCell.WatchRecursive(ctx, shardsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var initial []*WatchKeyspacePrefixData
+	for _, wd := range current {
+		if data := newWatchKeyspacePrefixData(wd); data != nil {
+			initial = append(initial, data)
+		}
+	}
+
+	changes := make(chan *WatchKeyspacePrefixData, 10)
+	// The background routine reads any event from the watch channel,
+	// translates it, and sends it to the caller. The files that are
+	// not shard records, like the locks, are skipped.
+	go func() {
+		defer close(changes)
+
+		for wd := range wdChannel {
+			if wd.Err != nil && wd.Path == "" {
+				// Last error value, we're done.
+				// wdChannel will be closed right after
+				// this, no need to do anything.
+				changes <- &WatchKeyspacePrefixData{Err: wd.Err}
+				return
+			}
+			if data := newWatchKeyspacePrefixData(wd); data != nil {
+				changes <- data
+			}
+		}
+	}()
+
+	return initial, changes, nil
+}
+
+// newWatchKeyspacePrefixData unpacks the data of a recursive watch of the
+// shards of a keyspace. It returns nil if the file is not a shard record.
+func newWatchKeyspacePrefixData(wd *WatchDataRecursive) *WatchKeyspacePrefixData {
+	// The path ends with shards/<shard>/Shard. Depending on the
+	// implementation, it may start with the root of the cell.
+	parts := strings.Split(wd.Path, "/")
+	if len(parts) < 3 || parts[len(parts)-1] != ShardFile || parts[len(parts)-3] != ShardsPath {
+		return nil
+	}
+	data := &WatchKeyspacePrefixData{Shard: parts[len(parts)-2]}
+	if wd.Err != nil {
+		data.Err = wd.Err
+		return data
+	}
+	value := &topodatapb.Shard{}
+	if err := proto.Unmarshal(wd.Contents, value); err != nil {
+		data.Err = vterrors.Wrapf(err, "error unpacking Shard object")
+		return data
+	}
+	data.Value = value
+	return data
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// This file contains the helpers for the labels of the shard and
+// keyspace records. Labels are arbitrary key/value pairs that Vitess
+// stores but does not interpret.
+
+// updateLabels sets and removes labels in a map, and returns the new
+// map, and true if it changed. A nil map is returned instead of an
+// empty one, so the field stays unset.
+func updateLabels(labels, set map[string]string, remove []string) (map[string]string, bool) {
+	changed := false
+	for k, v := range set {
+		if old, ok := labels[k]; ok && old == v {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(set))
+		}
+		labels[k] = v
+		changed = true
+	}
+	for _, k := range remove {
+		if _, ok := labels[k]; ok {
+			delete(labels, k)
+			changed = true
+		}
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	return labels, changed
+}
+
+// validateLabels checks the keys of the labels to set are not empty.
+func validateLabels(set map[string]string) error {
+	for k := range set {
+		if k == "" {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "label keys cannot be empty")
+		}
+	}
+	return nil
+}
+
+// UpdateLabels sets the labels in set and removes the labels in
+// remove from the shard. It returns true if the labels changed.
+func (si *ShardInfo) UpdateLabels(set map[string]string, remove []string) bool {
+	var changed bool
+	si.Labels, changed = updateLabels(si.Labels, set, remove)
+	return changed
+}
+
+// UpdateLabels sets the labels in set and removes the labels in
+// remove from the keyspace. It returns true if the labels changed.
+func (ki *KeyspaceInfo) UpdateLabels(set map[string]string, remove []string) bool {
+	var changed bool
+	ki.Labels, changed = updateLabels(ki.Labels, set, remove)
+	return changed
+}
+
+// UpdateShardLabels sets and removes labels on a shard record. The
+// other fields of the record are preserved. If the labels do not
+// change, nothing is written and nil,nil is returned, as for
+// UpdateShardFields.
+func (ts *Server) UpdateShardLabels(ctx context.Context, keyspace, shard string, set map[string]string, remove []string) (*ShardInfo, error) {
+	if err := validateLabels(set); err != nil {
+		return nil, err
+	}
+	return ts.UpdateShardFields(ctx, keyspace, shard, func(si *ShardInfo) error {
+		if !si.UpdateLabels(set, remove) {
+			return NewError(NoUpdateNeeded, si.Keyspace()+"/"+si.ShardName())
+		}
+		return nil
+	})
+}
+
+// UpdateKeyspaceLabels sets and removes labels on a keyspace record,
+// under the keyspace lock. The other fields of the record are
+// preserved. If the labels do not change, nothing is written and the
+// current record is returned.
+func (ts *Server) UpdateKeyspaceLabels(ctx context.Context, keyspace string, set map[string]string, remove []string) (ki *KeyspaceInfo, err error) {
+	if err := validateLabels(set); err != nil {
+		return nil, err
+	}
+	ctx, unlock, lockErr := ts.LockKeyspace(ctx, keyspace, "UpdateKeyspaceLabels")
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	defer unlock(&err)
+
+	ki, err = ts.GetKeyspace(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if !ki.UpdateLabels(set, remove) {
+		return ki, nil
+	}
+	if err := ts.UpdateKeyspace(ctx, ki); err != nil {
+		return nil, err
+	}
+	return ki, nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// This file contains the methods to inspect the locks of keyspaces and
+// shards, and to break them when their holder is stuck, for instance
+// after a crash in the middle of a workflow. They need a backend that
+// implements LockInspectorConn.
+
+// maxLockHistory is the number of forced releases kept in the history
+// of a lock.
+const maxLockHistory = 100
+
+// LockBreak records a forced release of a lock.
+// It needs to be public as we JSON-serialize it.
+type LockBreak struct {
+	// Lock is the lock that was broken, as it was held.
+	Lock *Lock
+
+	// Operator is who broke the lock, and Reason why.
+	Operator string
+	Reason   string
+
+	// Time is when the lock was broken.
+	Time string
+}
+
+// GetKeyspaceLock returns the current holder of the lock of a
+// keyspace. It returns NoNode if the keyspace is not locked.
+func (ts *Server) GetKeyspaceLock(ctx context.Context, keyspace string) (*Lock, error) {
+	l, _, err := ts.getLock(ctx, keyspaceLockPath(keyspace))
+	return l, err
+}
+
+// GetShardLock returns the current holder of the lock of a shard. It
+// returns NoNode if the shard is not locked.
+func (ts *Server) GetShardLock(ctx context.Context, keyspace, shard string) (*Lock, error) {
+	l, _, err := ts.getLock(ctx, shardLockPath(keyspace, shard))
+	return l, err
+}
+
+// ForceUnlockKeyspace breaks the lock of a keyspace, whoever holds it,
+// and records it in the history of the lock with the identity of the
+// operator and the reason. It returns the lock that was broken.
+//
+// The holder of the lock is not notified: it may only notice that it
+// lost the lock when it checks or releases it. This must only be used
+// when the holder is known to be gone.
+func (ts *Server) ForceUnlockKeyspace(ctx context.Context, keyspace, operator, reason string) (*Lock, error) {
+	return ts.forceUnlock(ctx, keyspaceLockPath(keyspace), operator, reason)
+}
+
+// ForceUnlockShard breaks the lock of a shard, see ForceUnlockKeyspace.
+func (ts *Server) ForceUnlockShard(ctx context.Context, keyspace, shard, operator, reason string) (*Lock, error) {
+	return ts.forceUnlock(ctx, shardLockPath(keyspace, shard), operator, reason)
+}
+
+// GetKeyspaceLockHistory returns the forced releases of the lock of a
+// keyspace, oldest first.
+func (ts *Server) GetKeyspaceLockHistory(ctx context.Context, keyspace string) ([]*LockBreak, error) {
+	history, _, err := ts.getLockHistory(ctx, keyspaceLockPath(keyspace))
+	return history, err
+}
+
+// GetShardLockHistory returns the forced releases of the lock of a
+// shard, oldest first.
+func (ts *Server) GetShardLockHistory(ctx context.Context, keyspace, shard string) ([]*LockBreak, error) {
+	history, _, err := ts.getLockHistory(ctx, shardLockPath(keyspace, shard))
+	return history, err
+}
+
+// getLock returns the holder of the lock on dirPath, and the version
+// of its holding of the lock.
+func (ts *Server) getLock(ctx context.Context, dirPath string) (*Lock, Version, error) {
+	contents, version, err := lockHolder(ctx, ts.globalCell, dirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := &Lock{}
+	if err := json.Unmarshal([]byte(contents), l); err != nil {
+		return nil, nil, vterrors.Wrapf(err, "bad lock contents on %v", dirPath)
+	}
+	return l, version, nil
+}
+
+// forceUnlock breaks the lock on dirPath, and records it in its
+// history. The lock is only broken if it is still held by the holder
+// that was read, so a lock taken again in between is not broken.
+func (ts *Server) forceUnlock(ctx context.Context, dirPath, operator, reason string) (*Lock, error) {
+	if operator == "" {
+		return nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "the operator breaking the lock on %v is required", dirPath)
+	}
+
+	l, version, err := ts.getLock(ctx, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := breakLock(ctx, ts.globalCell, dirPath, version); err != nil {
+		if IsErrType(err, BadVersion) {
+			return nil, vterrors.Errorf(vtrpc.Code_ABORTED, "lock on %v was released and taken again while breaking it, not breaking the new one", dirPath)
+		}
+		return nil, err
+	}
+	log.Warningf("Lock on %v for action %v held by %v@%v since %v was broken by %v: %v", dirPath, l.Action, l.UserName, l.HostName, l.Time, operator, reason)
+
+	lb := &LockBreak{
+		Lock:     l,
+		Operator: operator,
+		Reason:   reason,
+		Time:     time.Now().Format(time.RFC3339),
+	}
+	if err := ts.addLockHistory(ctx, dirPath, lb); err != nil {
+		return l, vterrors.Wrapf(err, "lock on %v was broken, but cannot be recorded in its history", dirPath)
+	}
+	return l, nil
+}
+
+// lockHistoryPath returns the path of the history of the lock on
+// dirPath.
+func lockHistoryPath(dirPath string) string {
+	return path.Join(LockHistoryPath, dirPath, LockHistoryFile)
+}
+
+// getLockHistory returns the history of the lock on dirPath, and its
+// version, nil if it has none.
+func (ts *Server) getLockHistory(ctx context.Context, dirPath string) ([]*LockBreak, Version, error) {
+	historyPath := lockHistoryPath(dirPath)
+	data, version, err := ts.globalCell.Get(ctx, historyPath)
+	switch {
+	case IsErrType(err, NoNode):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	var history []*LockBreak
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, nil, vterrors.Wrapf(err, "bad lock history in %v", historyPath)
+	}
+	return history, version, nil
+}
+
+// addLockHistory adds a forced release to the history of the lock on
+// dirPath, and drops the oldest ones beyond maxLockHistory.
+func (ts *Server) addLockHistory(ctx context.Context, dirPath string, lb *LockBreak) error {
+	historyPath := lockHistoryPath(dirPath)
+	for {
+		history, version, err := ts.getLockHistory(ctx, dirPath)
+		if err != nil {
+			return err
+		}
+		history = append(history, lb)
+		if len(history) > maxLockHistory {
+			history = history[len(history)-maxLockHistory:]
+		}
+		data, err := json.MarshalIndent(history, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if version == nil {
+			_, err = ts.globalCell.Create(ctx, historyPath, data)
+		} else {
+			_, err = ts.globalCell.Update(ctx, historyPath, data, version)
+		}
+		if IsErrType(err, NodeExists) || IsErrType(err, BadVersion) {
+			// Someone else updated the history, try again.
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// This file contains the leases of the locks of keyspaces and shards.
+
+// LockOption configures a lock taken by LockKeyspace or LockShard.
+type LockOption func(*lockOptions)
+
+// lockOptions are the options of a lock.
+type lockOptions struct {
+	// leaseTTL is the lease of the lock, 0 if it has none.
+	leaseTTL time.Duration
+
+	// onExpired is called when the lease expires.
+	onExpired func(error)
+}
+
+// WithLeaseTTL gives the lock a lease of ttl. The lock is taken with
+// this lease on the backends that implement LeaseConn, so it is
+// released if its holder crashes, and the holder renews it every third
+// of ttl by checking it. If the lock can't be checked for ttl, its lease
+// expired: the context returned with the lock is canceled, and the
+// callback of WithLeaseExpiredCallback is called.
+func WithLeaseTTL(ttl time.Duration) LockOption {
+	return func(o *lockOptions) {
+		o.leaseTTL = ttl
+	}
+}
+
+// WithLeaseExpiredCallback sets the function called with the last error
+// of the heartbeat of a lock if its lease expires, see WithLeaseTTL.
+// It is called at most once, and never after the lock is released. It
+// must not release the lock itself.
+func WithLeaseExpiredCallback(onExpired func(error)) LockOption {
+	return func(o *lockOptions) {
+		o.onExpired = onExpired
+	}
+}
+
+// newLockOptions returns the options of a lock.
+func newLockOptions(opts []LockOption) *lockOptions {
+	o := &lockOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// lockLease renews the lease of a lock with a heartbeat, until the
+// lock is released or the lease expires.
+type lockLease struct {
+	name           string
+	lockDescriptor LockDescriptor
+	ttl            time.Duration
+	onExpired      func(error)
+
+	// cancel cancels the context of the lock holder.
+	cancel context.CancelFunc
+
+	// stop is closed when the lock is released.
+	stop chan struct{}
+	// done is closed when the heartbeat stopped.
+	done chan struct{}
+	// expired is closed when the lease expired.
+	expired chan struct{}
+}
+
+// newLockLease starts the heartbeat of a lock. It returns the context
+// of the lock holder, canceled when the lease expires or the lock is
+// released.
+func newLockLease(ctx context.Context, name string, lockDescriptor LockDescriptor, o *lockOptions) (context.Context, *lockLease) {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &lockLease{
+		name:           name,
+		lockDescriptor: lockDescriptor,
+		ttl:            o.leaseTTL,
+		onExpired:      o.onExpired,
+		cancel:         cancel,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+		expired:        make(chan struct{}),
+	}
+	go l.heartbeat()
+	return ctx, l
+}
+
+// heartbeat checks the lock every third of its lease. The lease
+// expires if no check succeeded for its duration.
+func (l *lockLease) heartbeat() {
+	defer close(l.done)
+
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.lockDescriptor.Check(ctx)
+		cancel()
+		if err == nil {
+			lastRenewal = time.Now()
+			continue
+		}
+		if time.Since(lastRenewal) < l.ttl {
+			log.Warningf("Heartbeat of lock %v failed, will retry: %v", l.name, err)
+			continue
+		}
+
+		log.Errorf("Lease of lock %v expired: %v", l.name, err)
+		close(l.expired)
+		l.cancel()
+		if l.onExpired != nil {
+			l.onExpired(err)
+		}
+		return
+	}
+}
+
+// check returns an error if the lease expired.
+func (l *lockLease) check() error {
+	select {
+	case <-l.expired:
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lease of lock %v expired", l.name)
+	default:
+		return nil
+	}
+}
+
+// release stops the heartbeat, before the lock is released.
+func (l *lockLease) release() {
+	close(l.stop)
+	<-l.done
+}
@@ -93,6 +93,9 @@ func (l *Lock) ToJSON() (string, error) {
 type lockInfo struct {
 	lockDescriptor LockDescriptor
 	actionNode     *Lock
+
+	// lease is the lease of the lock, nil if it has none.
+	lease *lockLease
 }
 
 // locksInfo is the structure used to remember which locks we took
@@ -107,6 +110,16 @@ type locksInfo struct {
 	info map[string]*lockInfo
 }
 
+// keyspaceLockPath returns the path of the lock of a keyspace.
+func keyspaceLockPath(keyspace string) string {
+	return path.Join(KeyspacesPath, keyspace)
+}
+
+// shardLockPath returns the path of the lock of a shard.
+func shardLockPath(keyspace, shard string) string {
+	return path.Join(KeyspacesPath, keyspace, ShardsPath, shard)
+}
+
 // Context glue
 type locksKeyType int
 
@@ -130,7 +143,7 @@ var locksKey locksKeyType
 //   * 'vtctl SetShardTabletControl' emergency operations
 //   * 'vtctl SourceShardAdd' and 'vtctl SourceShardDelete' emergency operations
 // * keyspace-wide schema changes
-func (ts *Server) LockKeyspace(ctx context.Context, keyspace, action string) (context.Context, func(*error), error) {
+func (ts *Server) LockKeyspace(ctx context.Context, keyspace, action string, opts ...LockOption) (context.Context, func(*error), error) {
 	i, ok := ctx.Value(locksKey).(*locksInfo)
 	if !ok {
 		i = &locksInfo{
@@ -147,16 +160,24 @@ func (ts *Server) LockKeyspace(ctx context.Context, keyspace, action string) (co
 	}
 
 	// lock
+	o := newLockOptions(opts)
 	l := newLock(action)
-	lockDescriptor, err := l.lockKeyspace(ctx, ts, keyspace)
+	lockDescriptor, err := l.lockKeyspace(ctx, ts, keyspace, o.leaseTTL)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// start renewing the lease, if any
+	var lease *lockLease
+	if o.leaseTTL > 0 {
+		ctx, lease = newLockLease(ctx, keyspace, lockDescriptor, o)
+	}
+
 	// and update our structure
 	i.info[keyspace] = &lockInfo{
 		lockDescriptor: lockDescriptor,
 		actionNode:     l,
+		lease:          lease,
 	}
 	return ctx, func(finalErr *error) {
 		i.mu.Lock()
@@ -171,6 +192,10 @@ func (ts *Server) LockKeyspace(ctx context.Context, keyspace, action string) (co
 			return
 		}
 
+		if lease != nil {
+			lease.release()
+			defer lease.cancel()
+		}
 		err := l.unlockKeyspace(ctx, ts, keyspace, lockDescriptor, *finalErr)
 		if *finalErr != nil {
 			if err != nil {
@@ -196,10 +221,15 @@ func CheckKeyspaceLocked(ctx context.Context, keyspace string) error {
 	defer i.mu.Unlock()
 
 	// find the individual entry
-	_, ok = i.info[keyspace]
+	li, ok := i.info[keyspace]
 	if !ok {
 		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "keyspace %v is not locked (no lockInfo in map)", keyspace)
 	}
+	if li.lease != nil {
+		if err := li.lease.check(); err != nil {
+			return err
+		}
+	}
 
 	// TODO(alainjobart): check the lock server implementation
 	// still holds the lock. Will need to look at the lockInfo struct.
@@ -224,13 +254,18 @@ func CheckKeyspaceLockedAndRenew(ctx context.Context, keyspace string) error {
 	if !ok {
 		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "keyspace %v is not locked (no lockInfo in map)", keyspace)
 	}
+	if entry.lease != nil {
+		if err := entry.lease.check(); err != nil {
+			return err
+		}
+	}
 	// try renewing lease:
 	return entry.lockDescriptor.Check(ctx)
 }
 
 // lockKeyspace will lock the keyspace in the topology server.
 // unlockKeyspace should be called if this returns no error.
-func (l *Lock) lockKeyspace(ctx context.Context, ts *Server, keyspace string) (LockDescriptor, error) {
+func (l *Lock) lockKeyspace(ctx context.Context, ts *Server, keyspace string, leaseTTL time.Duration) (LockDescriptor, error) {
 	log.Infof("Locking keyspace %v for action %v", keyspace, l.Action)
 
 	ctx, cancel := context.WithTimeout(ctx, *RemoteOperationTimeout)
@@ -241,12 +276,11 @@ func (l *Lock) lockKeyspace(ctx context.Context, ts *Server, keyspace string) (L
 	span.Annotate("keyspace", keyspace)
 	defer span.Finish()
 
-	keyspacePath := path.Join(KeyspacesPath, keyspace)
 	j, err := l.ToJSON()
 	if err != nil {
 		return nil, err
 	}
-	return ts.globalCell.Lock(ctx, keyspacePath, j)
+	return lockWithTTL(ctx, ts.globalCell, keyspaceLockPath(keyspace), j, leaseTTL)
 }
 
 // unlockKeyspace unlocks a previously locked keyspace.
@@ -292,7 +326,7 @@ func (l *Lock) unlockKeyspace(ctx context.Context, ts *Server, keyspace string,
 // * operations that we don't want to conflict with re-parenting:
 //   * DeleteTablet when it's the shard's current primary
 //
-func (ts *Server) LockShard(ctx context.Context, keyspace, shard, action string) (context.Context, func(*error), error) {
+func (ts *Server) LockShard(ctx context.Context, keyspace, shard, action string, opts ...LockOption) (context.Context, func(*error), error) {
 	i, ok := ctx.Value(locksKey).(*locksInfo)
 	if !ok {
 		i = &locksInfo{
@@ -310,16 +344,24 @@ func (ts *Server) LockShard(ctx context.Context, keyspace, shard, action string)
 	}
 
 	// lock
+	o := newLockOptions(opts)
 	l := newLock(action)
-	lockDescriptor, err := l.lockShard(ctx, ts, keyspace, shard)
+	lockDescriptor, err := l.lockShard(ctx, ts, keyspace, shard, o.leaseTTL)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// start renewing the lease, if any
+	var lease *lockLease
+	if o.leaseTTL > 0 {
+		ctx, lease = newLockLease(ctx, mapKey, lockDescriptor, o)
+	}
+
 	// and update our structure
 	i.info[mapKey] = &lockInfo{
 		lockDescriptor: lockDescriptor,
 		actionNode:     l,
+		lease:          lease,
 	}
 	return ctx, func(finalErr *error) {
 		i.mu.Lock()
@@ -334,6 +376,10 @@ func (ts *Server) LockShard(ctx context.Context, keyspace, shard, action string)
 			return
 		}
 
+		if lease != nil {
+			lease.release()
+			defer lease.cancel()
+		}
 		err := l.unlockShard(ctx, ts, keyspace, shard, lockDescriptor, *finalErr)
 		if *finalErr != nil {
 			if err != nil {
@@ -365,13 +411,19 @@ func CheckShardLocked(ctx context.Context, keyspace, shard string) error {
 		return vterrors.Errorf(vtrpc.Code_INTERNAL, "shard %v/%v is not locked (no lockInfo in map)", keyspace, shard)
 	}
 
+	if li.lease != nil {
+		if err := li.lease.check(); err != nil {
+			return err
+		}
+	}
+
 	// Check the lock server implementation still holds the lock.
 	return li.lockDescriptor.Check(ctx)
 }
 
 // lockShard will lock the shard in the topology server.
 // UnlockShard should be called if this returns no error.
-func (l *Lock) lockShard(ctx context.Context, ts *Server, keyspace, shard string) (LockDescriptor, error) {
+func (l *Lock) lockShard(ctx context.Context, ts *Server, keyspace, shard string, leaseTTL time.Duration) (LockDescriptor, error) {
 	log.Infof("Locking shard %v/%v for action %v", keyspace, shard, l.Action)
 
 	ctx, cancel := context.WithTimeout(ctx, *RemoteOperationTimeout)
@@ -383,12 +435,11 @@ func (l *Lock) lockShard(ctx context.Context, ts *Server, keyspace, shard string
 	span.Annotate("shard", shard)
 	defer span.Finish()
 
-	shardPath := path.Join(KeyspacesPath, keyspace, ShardsPath, shard)
 	j, err := l.ToJSON()
 	if err != nil {
 		return nil, err
 	}
-	return ts.globalCell.Lock(ctx, shardPath, j)
+	return lockWithTTL(ctx, ts.globalCell, shardLockPath(keyspace, shard), j, leaseTTL)
 }
 
 // unlockShard unlocks a previously locked shard.
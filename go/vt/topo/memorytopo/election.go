@@ -138,8 +138,8 @@ func (mp *cLeaderParticipation) WaitForNewLeader(ctx context.Context) (<-chan st
 	}
 
 	notifications := make(chan string, 8)
-	watchIndex := nextWatchIndex
-	nextWatchIndex++
+	watchIndex := mp.c.factory.nextWatchIndex
+	mp.c.factory.nextWatchIndex++
 	n.watches[watchIndex] = watch{lock: notifications}
 
 	if n.lock != nil {
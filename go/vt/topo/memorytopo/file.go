@@ -44,7 +44,11 @@ func (c *Conn) Create(ctx context.Context, filePath string, contents []byte) (to
 	if c.factory.err != nil {
 		return nil, c.factory.err
 	}
+	return c.createLocked(filePath, contents)
+}
 
+// createLocked creates a file. c.factory.mu must be held.
+func (c *Conn) createLocked(filePath string, contents []byte) (topo.Version, error) {
 	// Get the parent dir.
 	dir, file := path.Split(filePath)
 	p := c.factory.getOrCreatePath(c.cell, dir)
@@ -88,7 +92,11 @@ func (c *Conn) Update(ctx context.Context, filePath string, contents []byte, ver
 	if c.factory.err != nil {
 		return nil, c.factory.err
 	}
+	return c.updateLocked(filePath, contents, version)
+}
 
+// updateLocked updates a file. c.factory.mu must be held.
+func (c *Conn) updateLocked(filePath string, contents []byte, version topo.Version) (topo.Version, error) {
 	// Get the parent dir, we'll need it in case of creation.
 	dir, file := path.Split(filePath)
 	p := c.factory.nodeByPath(c.cell, dir)
@@ -246,7 +254,11 @@ func (c *Conn) Delete(ctx context.Context, filePath string, version topo.Version
 	if c.factory.err != nil {
 		return c.factory.err
 	}
+	return c.deleteLocked(filePath, version)
+}
 
+// deleteLocked deletes a file. c.factory.mu must be held.
+func (c *Conn) deleteLocked(filePath string, version topo.Version) error {
 	// Get the parent dir.
 	dir, file := path.Split(filePath)
 	p := c.factory.nodeByPath(c.cell, dir)
@@ -296,3 +308,72 @@ func (c *Conn) Delete(ctx context.Context, filePath string, version topo.Version
 
 	return nil
 }
+
+// Txn is part of the topo.Conn interface.
+func (c *Conn) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := c.dial(ctx); err != nil {
+		return nil, err
+	}
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	c.factory.mu.Lock()
+	defer c.factory.mu.Unlock()
+
+	if c.factory.err != nil {
+		return nil, c.factory.err
+	}
+
+	// Check all the conditions first, so the operations can't fail
+	// once we start applying them.
+	for _, op := range ops {
+		if err := c.checkTxnOpLocked(op); err != nil {
+			return nil, err
+		}
+	}
+
+	versions := make([]topo.Version, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Type {
+		case topo.TxnCreate:
+			versions[i], err = c.createLocked(op.Path, op.Contents)
+		case topo.TxnUpdate:
+			versions[i], err = c.updateLocked(op.Path, op.Contents, op.Version)
+		case topo.TxnDelete:
+			err = c.deleteLocked(op.Path, op.Version)
+		}
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "transaction partially applied")
+		}
+	}
+	return versions, nil
+}
+
+// checkTxnOpLocked returns the error the operation of a transaction
+// would fail with. c.factory.mu must be held.
+func (c *Conn) checkTxnOpLocked(op topo.TxnOp) error {
+	dir, _ := path.Split(op.Path)
+	n := c.factory.nodeByPath(c.cell, op.Path)
+	if n == nil {
+		switch {
+		case op.Type == topo.TxnDelete || op.Type == topo.TxnCheck || op.Version != nil && op.Type == topo.TxnUpdate:
+			return topo.NewError(topo.NoNode, op.Path)
+		case !c.factory.canCreatePath(c.cell, dir):
+			return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "trying to create file %v in cell %v in a path that contains files", op.Path, c.cell)
+		}
+		return nil
+	}
+
+	if op.Type == topo.TxnCreate {
+		return topo.NewError(topo.NodeExists, op.Path)
+	}
+	if n.isDirectory() {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "%v(%v, %v) failed: it's a directory", op.Type, c.cell, op.Path)
+	}
+	if op.Version != nil && n.version != uint64(op.Version.(NodeVersion)) {
+		return topo.NewError(topo.BadVersion, op.Path)
+	}
+	return nil
+}
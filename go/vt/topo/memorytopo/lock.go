@@ -38,6 +38,9 @@ func convertError(err error, nodePath string) error {
 type memoryTopoLockDescriptor struct {
 	c       *Conn
 	dirPath string
+
+	// lock is the lock channel of the node while this lock is held.
+	lock chan struct{}
 }
 
 // Lock is part of the topo.Conn interface.
@@ -74,8 +77,10 @@ func (c *Conn) Lock(ctx context.Context, dirPath, contents string) (topo.LockDes
 		}
 
 		// No one has the lock, grab it.
-		n.lock = make(chan struct{})
+		lock := make(chan struct{})
+		n.lock = lock
 		n.lockContents = contents
+		n.lockVersion = c.factory.getNextVersion()
 		for _, w := range n.watches {
 			if w.lock == nil {
 				continue
@@ -86,22 +91,28 @@ func (c *Conn) Lock(ctx context.Context, dirPath, contents string) (topo.LockDes
 		return &memoryTopoLockDescriptor{
 			c:       c,
 			dirPath: dirPath,
+			lock:    lock,
 		}, nil
 	}
 }
 
 // Check is part of the topo.LockDescriptor interface.
-// We can never lose a lock in this implementation.
+// The lock is only lost if it is broken with BreakLock.
 func (ld *memoryTopoLockDescriptor) Check(ctx context.Context) error {
+	ld.c.factory.mu.Lock()
+	defer ld.c.factory.mu.Unlock()
+	if n := ld.c.factory.nodeByPath(ld.c.cell, ld.dirPath); n == nil || n.lock != ld.lock {
+		return fmt.Errorf("lock on %v was broken", ld.dirPath)
+	}
 	return nil
 }
 
 // Unlock is part of the topo.LockDescriptor interface.
 func (ld *memoryTopoLockDescriptor) Unlock(ctx context.Context) error {
-	return ld.c.unlock(ctx, ld.dirPath)
+	return ld.c.unlock(ctx, ld.dirPath, ld.lock)
 }
 
-func (c *Conn) unlock(ctx context.Context, dirPath string) error {
+func (c *Conn) unlock(ctx context.Context, dirPath string, lock chan struct{}) error {
 	c.factory.mu.Lock()
 	defer c.factory.mu.Unlock()
 
@@ -112,6 +123,54 @@ func (c *Conn) unlock(ctx context.Context, dirPath string) error {
 	if n.lock == nil {
 		return fmt.Errorf("node %v is not locked", dirPath)
 	}
+	if n.lock != lock {
+		// The lock was broken, and may be held by someone else now.
+		return fmt.Errorf("lock on %v was broken", dirPath)
+	}
+	close(n.lock)
+	n.lock = nil
+	n.lockContents = ""
+	return nil
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (c *Conn) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	if err := c.dial(ctx); err != nil {
+		return "", nil, err
+	}
+
+	c.factory.mu.Lock()
+	defer c.factory.mu.Unlock()
+
+	if c.factory.err != nil {
+		return "", nil, c.factory.err
+	}
+	n := c.factory.nodeByPath(c.cell, dirPath)
+	if n == nil || n.lock == nil {
+		return "", nil, topo.NewError(topo.NoNode, dirPath)
+	}
+	return n.lockContents, NodeVersion(n.lockVersion), nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+func (c *Conn) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	if err := c.dial(ctx); err != nil {
+		return err
+	}
+
+	c.factory.mu.Lock()
+	defer c.factory.mu.Unlock()
+
+	if c.factory.err != nil {
+		return c.factory.err
+	}
+	n := c.factory.nodeByPath(c.cell, dirPath)
+	if n == nil || n.lock == nil {
+		return topo.NewError(topo.NoNode, dirPath)
+	}
+	if v, ok := version.(NodeVersion); !ok || uint64(v) != n.lockVersion {
+		return topo.NewError(topo.BadVersion, dirPath)
+	}
 	close(n.lock)
 	n.lock = nil
 	n.lockContents = ""
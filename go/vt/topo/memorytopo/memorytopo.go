@@ -22,6 +22,7 @@ package memorytopo
 import (
 	"context"
 	"math/rand"
+	"path"
 	"strings"
 	"sync"
 	"time"
@@ -46,10 +47,6 @@ const (
 	UnreachableServerAddr = "unreachable"
 )
 
-var (
-	nextWatchIndex = 0
-)
-
 // Factory is a memory-based implementation of topo.Factory.  It
 // takes a file-system like approach, with directories at each level
 // being an actual directory node. This is meant to be closer to
@@ -72,6 +69,8 @@ type Factory struct {
 	// err is used for testing purposes to force queries / watches
 	// to return the given error
 	err error
+	// nextWatchIndex is the index of the next watch of a node.
+	nextWatchIndex int
 }
 
 // HasGlobalReadOnlyCell is part of the topo.Factory interface.
@@ -174,12 +173,26 @@ type node struct {
 	// For regular locks, it has the contents that was passed in.
 	// For primary election, it has the id of the election leader.
 	lockContents string
+
+	// lockVersion is the version of the current holding of the lock,
+	// so it can be broken only if it was not taken again.
+	lockVersion uint64
 }
 
 func (n *node) isDirectory() bool {
 	return n.children != nil
 }
 
+// fullPath returns the path of the node from the root directory of its
+// cell, like the paths of the Conn API.
+func (n *node) fullPath() string {
+	var parts []string
+	for ; n.parent != nil; n = n.parent {
+		parts = append([]string{n.name}, parts...)
+	}
+	return path.Join(parts...)
+}
+
 func (n *node) recurseContents(callback func(n *node)) {
 	if n.isDirectory() {
 		for _, child := range n.children {
@@ -325,6 +338,33 @@ func (f *Factory) getOrCreatePath(cell, filePath string) *node {
 	return n
 }
 
+// canCreatePath returns whether getOrCreatePath would succeed, i.e.
+// whether none of the nodes of the path is a file.
+func (f *Factory) canCreatePath(cell, filePath string) bool {
+	n, ok := f.cells[cell]
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(filePath, "/")
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if n.children == nil {
+			// This is a file.
+			return false
+		}
+		child, ok := n.children[part]
+		if !ok {
+			// The rest of the path would be created.
+			return true
+		}
+		n = child
+	}
+	return n.isDirectory()
+}
+
 // recursiveDelete deletes a node and its parent directory if empty.
 func (f *Factory) recursiveDelete(n *node) {
 	parent := n.parent
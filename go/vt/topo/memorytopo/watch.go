@@ -46,18 +46,21 @@ func (c *Conn) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-c
 	}
 
 	notifications := make(chan *topo.WatchData, 100)
-	watchIndex := nextWatchIndex
-	nextWatchIndex++
+	watchIndex := c.factory.nextWatchIndex
+	c.factory.nextWatchIndex++
 	n.watches[watchIndex] = watch{contents: notifications}
 
+	// The factory is captured, as the Conn can be closed before the
+	// watch is canceled.
+	f := c.factory
 	go func() {
 		<-ctx.Done()
 		// This function can be called at any point, so we first need
 		// to make sure the watch is still valid.
-		c.factory.mu.Lock()
-		defer c.factory.mu.Unlock()
+		f.mu.Lock()
+		defer f.mu.Unlock()
 
-		n := c.factory.nodeByPath(c.cell, filePath)
+		n := f.nodeByPath(c.cell, filePath)
 		if n == nil {
 			return
 		}
@@ -71,6 +74,11 @@ func (c *Conn) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-c
 	return current, notifications, nil
 }
 
+// WatchFrom is part of the topo.Conn interface.
+func (c *Conn) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, c, filePath, version)
+}
+
 // WatchRecursive is part of the topo.Conn interface.
 func (c *Conn) WatchRecursive(ctx context.Context, dirpath string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
 	c.factory.mu.Lock()
@@ -88,7 +96,7 @@ func (c *Conn) WatchRecursive(ctx context.Context, dirpath string) ([]*topo.Watc
 	var initialwd []*topo.WatchDataRecursive
 	n.recurseContents(func(n *node) {
 		initialwd = append(initialwd, &topo.WatchDataRecursive{
-			Path: n.name,
+			Path: n.fullPath(),
 			WatchData: topo.WatchData{
 				Contents: n.contents,
 				Version:  NodeVersion(n.version),
@@ -97,19 +105,20 @@ func (c *Conn) WatchRecursive(ctx context.Context, dirpath string) ([]*topo.Watc
 	})
 
 	notifications := make(chan *topo.WatchDataRecursive, 100)
-	watchIndex := nextWatchIndex
-	nextWatchIndex++
+	watchIndex := c.factory.nextWatchIndex
+	c.factory.nextWatchIndex++
 	n.watches[watchIndex] = watch{recursive: notifications}
 
+	f := c.factory
 	go func() {
 		defer close(notifications)
 
 		<-ctx.Done()
 
-		c.factory.mu.Lock()
-		defer c.factory.mu.Unlock()
+		f.mu.Lock()
+		defer f.mu.Unlock()
 
-		n := c.factory.nodeByPath(c.cell, dirpath)
+		n := f.nodeByPath(c.cell, dirpath)
 		if n != nil {
 			delete(n.watches, watchIndex)
 		}
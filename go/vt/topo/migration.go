@@ -0,0 +1,770 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/sync2"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// This file contains the online migration of the topology server from
+// one backend to another, for instance from ZooKeeper to etcd.
+//
+// A migration goes through three phases, each of which must be rolled
+// out to all the processes before the next one:
+// - MigrationDualWrite: the old backend is read, and the writes go to
+//   both backends. The reads are verified against the new backend.
+// - MigrationSwitchRead: the new backend is read, and the writes still
+//   go to both backends, so the migration can be rolled back. The reads
+//   are verified against the old backend.
+// - MigrationSwitchWrite: the new backend is read and written, the old
+//   one is not used anymore. The processes can then be restarted
+//   without the migration.
+//
+// The data must be copied to the new backend before the first phase,
+// with topo2topo for instance. The records of the cells are not
+// mirrored, as they have the addresses of the cells in each backend.
+// The mirrored writes are conditional on the version of the file on the
+// server that is not read, so a file written there by someone else is
+// detected, counted, and copied again from the server that is read.
+// The watches move to the server that is read when the phase changes.
+// The locks are taken on the old backend then on the new one, until
+// the last phase where they are only taken on the new one, so the
+// processes in two successive phases exclude each other.
+
+var (
+	// topoMigrationImplementation, topoMigrationGlobalServerAddress
+	// and topoMigrationGlobalRoot are the flags of the new backend of a
+	// migration.
+	topoMigrationImplementation      = flag.String("topo_migration_implementation", "", "if set, migrate online from the topology server of --topo_implementation to the one of this implementation, see --topo_migration_phase")
+	topoMigrationGlobalServerAddress = flag.String("topo_migration_global_server_address", "", "the address of the global topology server to migrate to")
+	topoMigrationGlobalRoot          = flag.String("topo_migration_global_root", "", "the path of the global topology data in the global topology server to migrate to")
+
+	// topoMigrationPhase is the phase of the migration.
+	topoMigrationPhase = flag.String("topo_migration_phase", MigrationDualWrite.String(), "the phase of the topology server migration: dual_write (read the old server, write both), switch_read (read the new server, write both) or switch_write (only use the new server)")
+
+	// topoMigrationVerifyReads enables the verification of the reads.
+	topoMigrationVerifyReads = flag.Bool("topo_migration_verify_reads", true, "if true, verify the reads of the topology server migration against the server that is not read, and count the mismatches in the TopologyMigrationMismatches stat")
+
+	topoMigrationMismatches = stats.NewCountersWithSingleLabel(
+		"TopologyMigrationMismatches",
+		"Reads of the topology server migration that differ between the old and new servers",
+		"Operation")
+
+	topoMigrationMirrorErrors = stats.NewCountersWithSingleLabel(
+		"TopologyMigrationMirrorErrors",
+		"Writes of the topology server migration that failed on the server that is not read",
+		"Operation")
+
+	topoMigrationDivergences = stats.NewCountersWithSingleLabel(
+		"TopologyMigrationDivergences",
+		"Writes of the topology server migration that found the file changed by someone else on the server that is not read",
+		"Operation")
+)
+
+// mirrorRetries is the number of times a diverged file is copied again
+// from the server that is read, if it keeps changing.
+const mirrorRetries = 3
+
+// MigrationPhase is a phase of an online migration of the topology
+// server, see NewMigrationServer.
+type MigrationPhase int32
+
+const (
+	// MigrationDualWrite reads the old backend, and writes both.
+	MigrationDualWrite = MigrationPhase(iota)
+
+	// MigrationSwitchRead reads the new backend, and writes both.
+	MigrationSwitchRead
+
+	// MigrationSwitchWrite reads and writes the new backend.
+	MigrationSwitchWrite
+)
+
+var migrationPhaseNames = []string{"dual_write", "switch_read", "switch_write"}
+
+// String returns the name of the phase.
+func (p MigrationPhase) String() string {
+	if p < 0 || int(p) >= len(migrationPhaseNames) {
+		return fmt.Sprintf("MigrationPhase(%d)", int32(p))
+	}
+	return migrationPhaseNames[p]
+}
+
+// ParseMigrationPhase returns the phase of a name.
+func ParseMigrationPhase(name string) (MigrationPhase, error) {
+	for i, n := range migrationPhaseNames {
+		if n == name {
+			return MigrationPhase(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown topology server migration phase %q, expected one of %v", name, strings.Join(migrationPhaseNames, ", "))
+}
+
+// topoMigration is the state of a migration, shared by its connections.
+type topoMigration struct {
+	oldTS       *Server
+	newTS       *Server
+	verifyReads bool
+	phase       sync2.AtomicInt32
+
+	// mu protects changed, closed and replaced when the phase
+	// changes.
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// phaseChanged returns a channel closed when the phase changes.
+func (m *topoMigration) phaseChanged() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.changed
+}
+
+// setPhase changes the phase, and returns the previous one.
+func (m *topoMigration) setPhase(phase MigrationPhase) MigrationPhase {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := MigrationPhase(m.phase.Get())
+	m.phase.Set(int32(phase))
+	close(m.changed)
+	m.changed = make(chan struct{})
+	return old
+}
+
+// NewMigrationServer returns a Server migrating from the backend of
+// oldTS to the one of newTS, starting at phase. If verifyReads is true,
+// the reads are also made on the backend that is not read, to count
+// the mismatches.
+func NewMigrationServer(oldTS, newTS *Server, phase MigrationPhase, verifyReads bool) (*Server, error) {
+	m := &topoMigration{
+		oldTS:       oldTS,
+		newTS:       newTS,
+		verifyReads: verifyReads,
+		changed:     make(chan struct{}),
+	}
+	m.phase.Set(int32(phase))
+	ts, err := NewWithFactory(&migrationFactory{m: m}, "" /*serverAddress*/, "" /*root*/)
+	if err != nil {
+		return nil, err
+	}
+	ts.migration = m
+	return ts, nil
+}
+
+// openMigrationServer returns the migration Server of the flags, from
+// the old Server.
+func openMigrationServer(oldTS *Server) (*Server, error) {
+	phase, err := ParseMigrationPhase(*topoMigrationPhase)
+	if err != nil {
+		return nil, err
+	}
+	newTS, err := OpenServer(*topoMigrationImplementation, *topoMigrationGlobalServerAddress, *topoMigrationGlobalRoot)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrationServer(oldTS, newTS, phase, *topoMigrationVerifyReads)
+}
+
+// MigrationPhase returns the phase of the migration of the Server, and
+// false if it is not migrating.
+func (ts *Server) MigrationPhase() (MigrationPhase, bool) {
+	if ts.migration == nil {
+		return 0, false
+	}
+	return MigrationPhase(ts.migration.phase.Get()), true
+}
+
+// SetMigrationPhase moves the migration of the Server to a phase.
+func (ts *Server) SetMigrationPhase(phase MigrationPhase) error {
+	if ts.migration == nil {
+		return fmt.Errorf("the topology server is not migrating")
+	}
+	if phase < MigrationDualWrite || phase > MigrationSwitchWrite {
+		return fmt.Errorf("unknown topology server migration phase %v", phase)
+	}
+	old := ts.migration.setPhase(phase)
+	log.Infof("Topology server migration moved from phase %v to %v", old, phase)
+	return nil
+}
+
+// migrationFactory creates the connections of a migration Server.
+type migrationFactory struct {
+	m *topoMigration
+}
+
+// HasGlobalReadOnlyCell is part of the Factory interface.
+func (f *migrationFactory) HasGlobalReadOnlyCell(serverAddr, root string) bool {
+	return false
+}
+
+// Create is part of the Factory interface.
+func (f *migrationFactory) Create(cell, serverAddr, root string) (Conn, error) {
+	ctx := context.Background()
+	oldConn, err := f.m.oldTS.ConnForCell(ctx, cell)
+	if err != nil {
+		return nil, err
+	}
+	newConn, err := f.m.newTS.ConnForCell(ctx, cell)
+	if err != nil {
+		return nil, err
+	}
+	return &migrationConn{
+		m:        f.m,
+		oldConn:  oldConn,
+		newConn:  newConn,
+		versions: make(map[Conn]map[string]Version),
+	}, nil
+}
+
+// migrationConn implements the Conn interface for a migration.
+type migrationConn struct {
+	m       *topoMigration
+	oldConn Conn
+	newConn Conn
+
+	// mu protects versions, the versions of the files written by
+	// the last mirrored writes, by secondary connection.
+	mu       sync.Mutex
+	versions map[Conn]map[string]Version
+}
+
+var _ LeaseConn = (*migrationConn)(nil)
+var _ LockInspectorConn = (*migrationConn)(nil)
+
+// conns returns the connection to read and write, and the one to
+// mirror the writes to, nil if none.
+func (c *migrationConn) conns() (primary, secondary Conn) {
+	switch MigrationPhase(c.m.phase.Get()) {
+	case MigrationDualWrite:
+		return c.oldConn, c.newConn
+	case MigrationSwitchRead:
+		return c.newConn, c.oldConn
+	default:
+		return c.newConn, nil
+	}
+}
+
+// isMirrored returns true if the file is mirrored. The records of the
+// cells are not.
+func isMirrored(filePath string) bool {
+	return !strings.HasPrefix(strings.TrimPrefix(filePath, "/"), CellsPath+"/")
+}
+
+// mirrorError records a failed write on the secondary connection.
+func mirrorError(operation, filePath string, err error) {
+	topoMigrationMirrorErrors.Add(operation, 1)
+	log.Warningf("Topology server migration: %v(%v) failed on the secondary server: %v", operation, filePath, err)
+}
+
+// secondaryVersion returns the version of a file written by the last
+// mirrored write on the secondary connection, and false if it is not
+// known.
+func (c *migrationConn) secondaryVersion(secondary Conn, filePath string) (Version, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	version, ok := c.versions[secondary][filePath]
+	return version, ok
+}
+
+// setSecondaryVersion records the version of a file written on the
+// secondary connection, or forgets it if version is nil.
+func (c *migrationConn) setSecondaryVersion(secondary Conn, filePath string, version Version) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version == nil {
+		delete(c.versions[secondary], filePath)
+		return
+	}
+	if c.versions[secondary] == nil {
+		c.versions[secondary] = make(map[string]Version)
+	}
+	c.versions[secondary][filePath] = version
+}
+
+// mirror writes a file on the secondary connection after it was written
+// on the primary one: its contents, or its deletion if deleted is true.
+// The write is conditional on the version of the last mirrored write,
+// or on the current version if it is not known. If the file was changed
+// by someone else, the divergence is counted, and the file is copied
+// again from the primary connection.
+func (c *migrationConn) mirror(ctx context.Context, operation string, primary, secondary Conn, filePath string, contents []byte, deleted bool) {
+	version, ok := c.secondaryVersion(secondary, filePath)
+	if !ok {
+		var err error
+		if _, version, err = secondary.Get(ctx, filePath); err != nil && !IsErrType(err, NoNode) {
+			mirrorError(operation, filePath, err)
+			return
+		}
+	}
+
+	err := c.writeSecondary(ctx, secondary, filePath, contents, deleted, version)
+	for i := 0; i < mirrorRetries && isMirrorConflict(err); i++ {
+		if i == 0 {
+			topoMigrationDivergences.Add(operation, 1)
+			log.Warningf("Topology server migration: %v was changed on the secondary server, copying it again from the primary server", filePath)
+		}
+		contents, _, err = primary.Get(ctx, filePath)
+		deleted = IsErrType(err, NoNode)
+		if err != nil && !deleted {
+			break
+		}
+		if _, version, err = secondary.Get(ctx, filePath); err != nil && !IsErrType(err, NoNode) {
+			break
+		}
+		err = c.writeSecondary(ctx, secondary, filePath, contents, deleted, version)
+	}
+	if err != nil {
+		c.setSecondaryVersion(secondary, filePath, nil)
+		mirrorError(operation, filePath, err)
+	}
+}
+
+// writeSecondary writes a file on the secondary connection, if it has
+// the given version, or doesn't exist if version is nil.
+func (c *migrationConn) writeSecondary(ctx context.Context, secondary Conn, filePath string, contents []byte, deleted bool, version Version) error {
+	var err error
+	switch {
+	case deleted && version == nil:
+		// Already deleted.
+	case deleted:
+		err = secondary.Delete(ctx, filePath, version)
+		version = nil
+	case version == nil:
+		version, err = secondary.Create(ctx, filePath, contents)
+	default:
+		version, err = secondary.Update(ctx, filePath, contents, version)
+	}
+	if err == nil {
+		c.setSecondaryVersion(secondary, filePath, version)
+	}
+	return err
+}
+
+// isMirrorConflict returns true if a mirrored write failed because the
+// file was changed by someone else.
+func isMirrorConflict(err error) bool {
+	return IsErrType(err, BadVersion) || IsErrType(err, NodeExists) || IsErrType(err, NoNode)
+}
+
+// Close is part of the Conn interface.
+func (c *migrationConn) Close() {
+	c.oldConn.Close()
+	c.newConn.Close()
+}
+
+// ListDir is part of the Conn interface.
+func (c *migrationConn) ListDir(ctx context.Context, dirPath string, full bool) ([]DirEntry, error) {
+	primary, _ := c.conns()
+	return primary.ListDir(ctx, dirPath, full)
+}
+
+// Create is part of the Conn interface.
+func (c *migrationConn) Create(ctx context.Context, filePath string, contents []byte) (Version, error) {
+	primary, secondary := c.conns()
+	version, err := primary.Create(ctx, filePath, contents)
+	if err != nil || secondary == nil || !isMirrored(filePath) {
+		return version, err
+	}
+
+	// The file may already exist on the secondary server, if it was
+	// copied there.
+	c.mirror(ctx, "Create", primary, secondary, filePath, contents, false)
+	return version, nil
+}
+
+// Update is part of the Conn interface.
+func (c *migrationConn) Update(ctx context.Context, filePath string, contents []byte, version Version) (Version, error) {
+	primary, secondary := c.conns()
+	newVersion, err := primary.Update(ctx, filePath, contents, version)
+	if err != nil || secondary == nil || !isMirrored(filePath) {
+		return newVersion, err
+	}
+
+	// The versions are the ones of the primary server, so the update
+	// of the secondary server is conditional on its own version.
+	c.mirror(ctx, "Update", primary, secondary, filePath, contents, false)
+	return newVersion, nil
+}
+
+// Get is part of the Conn interface.
+func (c *migrationConn) Get(ctx context.Context, filePath string) ([]byte, Version, error) {
+	primary, secondary := c.conns()
+	contents, version, err := primary.Get(ctx, filePath)
+	if secondary != nil && c.m.verifyReads && isMirrored(filePath) && (err == nil || IsErrType(err, NoNode)) {
+		c.verifyGet(ctx, secondary, filePath, contents, err)
+	}
+	return contents, version, err
+}
+
+// verifyGet counts a mismatch if the file differs on the secondary
+// server. err is the error of the primary server, nil or NoNode.
+func (c *migrationConn) verifyGet(ctx context.Context, secondary Conn, filePath string, contents []byte, err error) {
+	secondaryContents, _, secondaryErr := secondary.Get(ctx, filePath)
+	switch {
+	case secondaryErr != nil && !IsErrType(secondaryErr, NoNode):
+		log.Warningf("Topology server migration: cannot verify Get(%v) on the secondary server: %v", filePath, secondaryErr)
+	case (err == nil) != (secondaryErr == nil), !bytes.Equal(contents, secondaryContents):
+		topoMigrationMismatches.Add("Get", 1)
+		log.Warningf("Topology server migration: %v differs between the primary and secondary servers", filePath)
+	}
+}
+
+// List is part of the Conn interface.
+func (c *migrationConn) List(ctx context.Context, filePathPrefix string) ([]KVInfo, error) {
+	primary, _ := c.conns()
+	return primary.List(ctx, filePathPrefix)
+}
+
+// Delete is part of the Conn interface.
+func (c *migrationConn) Delete(ctx context.Context, filePath string, version Version) error {
+	primary, secondary := c.conns()
+	if err := primary.Delete(ctx, filePath, version); err != nil || secondary == nil || !isMirrored(filePath) {
+		return err
+	}
+	c.mirror(ctx, "Delete", primary, secondary, filePath, nil, true)
+	return nil
+}
+
+// Txn is part of the Conn interface.
+func (c *migrationConn) Txn(ctx context.Context, ops []TxnOp) ([]Version, error) {
+	primary, secondary := c.conns()
+	versions, err := primary.Txn(ctx, ops)
+	if err != nil || secondary == nil {
+		return versions, err
+	}
+
+	// The writes of the secondary server are mirrored one by one,
+	// like in Update and Delete.
+	for _, op := range ops {
+		if !isMirrored(op.Path) {
+			continue
+		}
+		switch op.Type {
+		case TxnCreate, TxnUpdate:
+			c.mirror(ctx, "Txn", primary, secondary, op.Path, op.Contents, false)
+		case TxnDelete:
+			c.mirror(ctx, "Txn", primary, secondary, op.Path, nil, true)
+		}
+	}
+	return versions, nil
+}
+
+// Watch is part of the Conn interface.
+// The watch moves to the primary connection when the phase changes it.
+func (c *migrationConn) Watch(ctx context.Context, filePath string) (*WatchData, <-chan *WatchData, error) {
+	changed := c.m.phaseChanged()
+	primary, _ := c.conns()
+	watchCtx, cancel := context.WithCancel(ctx)
+	current, changes, err := primary.Watch(watchCtx, filePath)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return current, c.forwardWatch(ctx, filePath, changed, primary, changes, cancel, current), nil
+}
+
+// WatchFrom is part of the Conn interface.
+// The watch moves to the primary connection when the phase changes it,
+// like in Watch. The version is the one of the current primary
+// connection.
+func (c *migrationConn) WatchFrom(ctx context.Context, filePath string, version Version) (<-chan *WatchData, error) {
+	changed := c.m.phaseChanged()
+	primary, _ := c.conns()
+	watchCtx, cancel := context.WithCancel(ctx)
+	changes, err := primary.WatchFrom(watchCtx, filePath, version)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return c.forwardWatch(ctx, filePath, changed, primary, changes, cancel, nil), nil
+}
+
+// forwardWatch forwards the changes of a watch on the primary
+// connection. When the phase changes the primary connection, it
+// watches the new one, sends its value if it differs from the last one
+// sent, and stops the previous watch. last is the last value sent, nil
+// if none.
+func (c *migrationConn) forwardWatch(ctx context.Context, filePath string, changed <-chan struct{}, primary Conn, changes <-chan *WatchData, cancel context.CancelFunc, last *WatchData) <-chan *WatchData {
+	notifications := make(chan *WatchData, 10)
+	go func() {
+		defer close(notifications)
+		defer func() { cancel() }()
+
+		for {
+			select {
+			case wd, ok := <-changes:
+				if !ok {
+					return
+				}
+				notifications <- wd
+				if wd.Err != nil {
+					return
+				}
+				last = wd
+			case <-changed:
+				changed = c.m.phaseChanged()
+				newPrimary, _ := c.conns()
+				if newPrimary == primary {
+					continue
+				}
+				watchCtx, newCancel := context.WithCancel(ctx)
+				current, newChanges, err := newPrimary.Watch(watchCtx, filePath)
+				if err != nil {
+					newCancel()
+					notifications <- &WatchData{Err: err}
+					return
+				}
+				log.Infof("Topology server migration: moved the watch of %v to the new primary server", filePath)
+				stopWatch(cancel, changes)
+				primary, changes, cancel = newPrimary, newChanges, newCancel
+				if last == nil || !bytes.Equal(last.Contents, current.Contents) {
+					notifications <- current
+				}
+				last = current
+			}
+		}
+	}()
+	return notifications
+}
+
+// WatchRecursive is part of the Conn interface.
+// The watch moves to the primary connection when the phase changes it,
+// like in Watch.
+func (c *migrationConn) WatchRecursive(ctx context.Context, path string) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error) {
+	changed := c.m.phaseChanged()
+	primary, _ := c.conns()
+	watchCtx, cancel := context.WithCancel(ctx)
+	initial, changes, err := primary.WatchRecursive(watchCtx, path)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	// last has the contents of the files, to send the differences of
+	// the new primary connection.
+	last := make(map[string][]byte)
+	for _, wd := range initial {
+		last[wd.Path] = wd.Contents
+	}
+
+	notifications := make(chan *WatchDataRecursive, 10)
+	go func() {
+		defer close(notifications)
+		defer func() { cancel() }()
+
+		for {
+			select {
+			case wd, ok := <-changes:
+				if !ok {
+					return
+				}
+				notifications <- wd
+				switch {
+				case wd.Err == nil:
+					last[wd.Path] = wd.Contents
+				case IsErrType(wd.Err, NoNode):
+					delete(last, wd.Path)
+				default:
+					return
+				}
+			case <-changed:
+				changed = c.m.phaseChanged()
+				newPrimary, _ := c.conns()
+				if newPrimary == primary {
+					continue
+				}
+				watchCtx, newCancel := context.WithCancel(ctx)
+				current, newChanges, err := newPrimary.WatchRecursive(watchCtx, path)
+				if err != nil {
+					newCancel()
+					notifications <- &WatchDataRecursive{WatchData: WatchData{Err: err}}
+					return
+				}
+				log.Infof("Topology server migration: moved the recursive watch of %v to the new primary server", path)
+				stopWatch(cancel, changes)
+				primary, changes, cancel = newPrimary, newChanges, newCancel
+
+				next := make(map[string][]byte)
+				for _, wd := range current {
+					next[wd.Path] = wd.Contents
+					if contents, ok := last[wd.Path]; !ok || !bytes.Equal(contents, wd.Contents) {
+						notifications <- wd
+					}
+				}
+				for filePath := range last {
+					if _, ok := next[filePath]; !ok {
+						notifications <- &WatchDataRecursive{
+							Path:      filePath,
+							WatchData: WatchData{Err: NewError(NoNode, filePath)},
+						}
+					}
+				}
+				last = next
+			}
+		}
+	}()
+	return initial, notifications, nil
+}
+
+// stopWatch cancels a watch, and drains its channel in the background.
+func stopWatch[T any](cancel context.CancelFunc, changes <-chan T) {
+	cancel()
+	go func() {
+		for range changes {
+		}
+	}()
+}
+
+// Lock is part of the Conn interface.
+func (c *migrationConn) Lock(ctx context.Context, dirPath, contents string) (LockDescriptor, error) {
+	return c.lock(ctx, func(conn Conn) (LockDescriptor, error) {
+		return conn.Lock(ctx, dirPath, contents)
+	}, dirPath)
+}
+
+// LockWithTTL is part of the LeaseConn interface.
+func (c *migrationConn) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (LockDescriptor, error) {
+	return c.lock(ctx, func(conn Conn) (LockDescriptor, error) {
+		return lockWithTTL(ctx, conn, dirPath, contents, ttl)
+	}, dirPath)
+}
+
+// migrationLockVersion is the version of a lock held on both servers:
+// the version of the holding on each of them, nil if not held there.
+type migrationLockVersion struct {
+	old, new Version
+}
+
+// String is part of the Version interface.
+func (v migrationLockVersion) String() string {
+	return fmt.Sprintf("%v/%v", v.old, v.new)
+}
+
+// LockHolder is part of the LockInspectorConn interface. It returns
+// the contents of the lock on the primary, and the versions of the
+// holdings on both servers, like the lock is taken.
+func (c *migrationConn) LockHolder(ctx context.Context, dirPath string) (string, Version, error) {
+	if MigrationPhase(c.m.phase.Get()) == MigrationSwitchWrite {
+		contents, version, err := lockHolder(ctx, c.newConn, dirPath)
+		if err != nil {
+			return "", nil, err
+		}
+		return contents, migrationLockVersion{new: version}, nil
+	}
+	oldContents, oldVersion, oldErr := lockHolder(ctx, c.oldConn, dirPath)
+	newContents, newVersion, newErr := lockHolder(ctx, c.newConn, dirPath)
+	if oldErr != nil && newErr != nil {
+		return "", nil, oldErr
+	}
+	contents := oldContents
+	if primary, _ := c.conns(); oldErr != nil || primary == c.newConn && newErr == nil {
+		contents = newContents
+	}
+	return contents, migrationLockVersion{old: oldVersion, new: newVersion}, nil
+}
+
+// BreakLock is part of the LockInspectorConn interface. The lock is
+// broken on each server it was held on, with the version read there.
+func (c *migrationConn) BreakLock(ctx context.Context, dirPath string, version Version) error {
+	v, ok := version.(migrationLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	var oldErr, newErr error
+	if v.old != nil {
+		oldErr = breakLock(ctx, c.oldConn, dirPath, v.old)
+	}
+	if v.new != nil {
+		newErr = breakLock(ctx, c.newConn, dirPath, v.new)
+	}
+	if oldErr != nil {
+		return oldErr
+	}
+	return newErr
+}
+
+// lock locks the old server then the new one, or only the new one in
+// the last phase.
+func (c *migrationConn) lock(ctx context.Context, lock func(Conn) (LockDescriptor, error), dirPath string) (LockDescriptor, error) {
+	if MigrationPhase(c.m.phase.Get()) == MigrationSwitchWrite {
+		return lock(c.newConn)
+	}
+
+	oldLD, err := lock(c.oldConn)
+	if err != nil {
+		return nil, err
+	}
+	newLD, err := lock(c.newConn)
+	if err != nil {
+		if err := oldLD.Unlock(ctx); err != nil {
+			log.Warningf("Failed to unlock %v on the old server after failing to lock it on the new server: %v", dirPath, err)
+		}
+		return nil, err
+	}
+	return &migrationLockDescriptor{
+		dirPath: dirPath,
+		oldLD:   oldLD,
+		newLD:   newLD,
+	}, nil
+}
+
+// migrationLockDescriptor implements the LockDescriptor interface for
+// a lock on both servers.
+type migrationLockDescriptor struct {
+	dirPath string
+	oldLD   LockDescriptor
+	newLD   LockDescriptor
+}
+
+// Check is part of the LockDescriptor interface.
+func (ld *migrationLockDescriptor) Check(ctx context.Context) error {
+	if err := ld.oldLD.Check(ctx); err != nil {
+		return err
+	}
+	return ld.newLD.Check(ctx)
+}
+
+// Unlock is part of the LockDescriptor interface.
+func (ld *migrationLockDescriptor) Unlock(ctx context.Context) error {
+	newErr := ld.newLD.Unlock(ctx)
+	oldErr := ld.oldLD.Unlock(ctx)
+	if newErr != nil {
+		if oldErr != nil {
+			log.Warningf("Unlock(%v) on the old server failed: %v", ld.dirPath, oldErr)
+		}
+		return newErr
+	}
+	return oldErr
+}
+
+// NewLeaderParticipation is part of the Conn interface.
+func (c *migrationConn) NewLeaderParticipation(name, id string) (LeaderParticipation, error) {
+	primary, _ := c.conns()
+	return primary.NewLeaderParticipation(name, id)
+}
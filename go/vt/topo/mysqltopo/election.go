@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo
+
+import (
+	"context"
+	"path"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/topo"
+)
+
+const (
+	// electionsPath is the directory of the election locks. They are
+	// rows of topo_locks, so they are not listed by ListDir.
+	electionsPath = "elections"
+)
+
+// NewLeaderParticipation is part of the topo.Server interface
+func (s *Server) NewLeaderParticipation(name, id string) (topo.LeaderParticipation, error) {
+	return &mysqlLeaderParticipation{
+		s:    s,
+		name: name,
+		id:   id,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}, nil
+}
+
+// mysqlLeaderParticipation implements topo.LeaderParticipation.
+//
+// We use a lock with path <global>/elections/<name>, that contains the
+// id.
+type mysqlLeaderParticipation struct {
+	// s is our parent mysql topo Server
+	s *Server
+
+	// name is the name of this LeaderParticipation
+	name string
+
+	// id is the process's current id.
+	id string
+
+	// stop is a channel closed when Stop is called.
+	stop chan struct{}
+
+	// done is a channel closed when we're done processing the Stop
+	done chan struct{}
+}
+
+// WaitForLeadership is part of the topo.LeaderParticipation interface.
+func (mp *mysqlLeaderParticipation) WaitForLeadership() (context.Context, error) {
+	// If Stop was already called, mp.done is closed, so we are interrupted.
+	select {
+	case <-mp.done:
+		return nil, topo.NewError(topo.Interrupted, "Leadership")
+	default:
+	}
+
+	// The context is canceled when Stop is called, to interrupt the
+	// lock or to end the leadership.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-mp.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	electionPath := path.Join(mp.s.root, electionsPath, mp.name)
+	owner, err := newLockOwner()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Try to lock until mp.stop is closed.
+	if err := mp.s.lock(ctx, electionPath, mp.id, owner, mp.s.lockTTL); err != nil {
+		cancel()
+		// We can't lock. See if it was because we got canceled.
+		select {
+		case <-mp.stop:
+			close(mp.done)
+		default:
+		}
+		return nil, err
+	}
+
+	// We have the lock, keep leadership until we lose it.
+	ld := mp.s.newLockDescriptor(electionPath, owner, mp.s.lockTTL)
+	go func() {
+		select {
+		case <-ld.lost:
+			cancel()
+			<-mp.stop
+		case <-mp.stop:
+			// Stop was called. We stop the context first,
+			// so the running process is not thinking it
+			// is the leader any more, then we unlock.
+			cancel()
+			if err := ld.Unlock(context.Background()); err != nil {
+				log.Errorf("Leader election(%v) Unlock failed: %v", mp.name, err)
+			}
+		}
+		close(mp.done)
+	}()
+
+	return ctx, nil
+}
+
+// Stop is part of the topo.LeaderParticipation interface
+func (mp *mysqlLeaderParticipation) Stop() {
+	close(mp.stop)
+	<-mp.done
+}
+
+// GetCurrentLeaderID is part of the topo.LeaderParticipation interface
+func (mp *mysqlLeaderParticipation) GetCurrentLeaderID(ctx context.Context) (string, error) {
+	electionPath := path.Join(mp.s.root, electionsPath, mp.name)
+
+	var id string
+	err := mp.s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "select contents from topo_locks where path = %a and expires > now(6)", sqltypes.StringBindVariable(electionPath))
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) > 0 {
+			id = qr.Rows[0][0].ToString()
+		}
+		return nil
+	})
+	if err != nil {
+		return "", convertError(err, electionPath)
+	}
+	return id, nil
+}
+
+// WaitForNewLeader is part of the topo.LeaderParticipation interface
+func (mp *mysqlLeaderParticipation) WaitForNewLeader(context.Context) (<-chan string, error) {
+	// This isn't implemented yet, but likely can be implemented by
+	// polling GetCurrentLeaderID, like the watches.
+	return nil, topo.NewError(topo.NoImplementation, "wait for leader not supported in MySQL topo")
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo
+
+import (
+	"context"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+)
+
+// The tests are in the mysqltopo_test package, since they start MySQL
+// with vttest, which imports mysqltopo. These are the internals they use.
+
+var (
+	MySQLUser         = mysqlUser
+	MySQLPassword     = mysqlPassword
+	WatchPollDuration = watchPollDuration
+)
+
+func (s *Server) SetLockTTL(lockTTL time.Duration) {
+	s.lockTTL = lockTTL
+}
+
+func (s *Server) WithConn(ctx context.Context, fn func(conn *mysql.Conn) error) error {
+	return s.withConn(ctx, fn)
+}
+
+func Execute(conn *mysql.Conn, query string) (*sqltypes.Result, error) {
+	return execute(conn, query)
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo
+
+import (
+	"context"
+	"path"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/topo"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// Create is part of the topo.Conn interface.
+func (s *Server) Create(ctx context.Context, filePath string, contents []byte) (topo.Version, error) {
+	nodePath := path.Join(s.root, filePath)
+
+	var version topo.Version
+	err := s.withTxn(ctx, func(conn *mysql.Conn, revision uint64) error {
+		if err := createRow(conn, nodePath, contents, revision); err != nil {
+			return err
+		}
+		version = MySQLVersion(revision)
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err, nodePath)
+	}
+	return version, nil
+}
+
+// Update is part of the topo.Conn interface.
+func (s *Server) Update(ctx context.Context, filePath string, contents []byte, version topo.Version) (topo.Version, error) {
+	nodePath := path.Join(s.root, filePath)
+
+	var newVersion topo.Version
+	err := s.withTxn(ctx, func(conn *mysql.Conn, revision uint64) error {
+		if err := updateRow(conn, nodePath, contents, version, revision); err != nil {
+			return err
+		}
+		newVersion = MySQLVersion(revision)
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err, nodePath)
+	}
+	return newVersion, nil
+}
+
+// Get is part of the topo.Conn interface.
+func (s *Server) Get(ctx context.Context, filePath string) ([]byte, topo.Version, error) {
+	nodePath := path.Join(s.root, filePath)
+
+	var contents []byte
+	var version topo.Version
+	err := s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "select contents, version from topo_data where path = %a", sqltypes.StringBindVariable(nodePath))
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) == 0 {
+			return topo.NewError(topo.NoNode, nodePath)
+		}
+		contents = qr.Rows[0][0].Raw()
+		v, err := qr.Rows[0][1].ToUint64()
+		if err != nil {
+			return err
+		}
+		version = MySQLVersion(v)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, convertError(err, nodePath)
+	}
+	return contents, version, nil
+}
+
+// List is part of the topo.Conn interface.
+func (s *Server) List(ctx context.Context, filePathPrefix string) ([]topo.KVInfo, error) {
+	nodePathPrefix := path.Join(s.root, filePathPrefix)
+
+	var results []topo.KVInfo
+	err := s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := selectPrefix(conn, "select path, contents, version from topo_data", nodePathPrefix)
+		if err != nil {
+			return err
+		}
+		results = make([]topo.KVInfo, len(qr.Rows))
+		for n, row := range qr.Rows {
+			v, err := row[2].ToUint64()
+			if err != nil {
+				return err
+			}
+			results[n].Key = row[0].Raw()
+			results[n].Value = row[1].Raw()
+			results[n].Version = MySQLVersion(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return []topo.KVInfo{}, convertError(err, nodePathPrefix)
+	}
+	if len(results) == 0 {
+		return []topo.KVInfo{}, topo.NewError(topo.NoNode, nodePathPrefix)
+	}
+	return results, nil
+}
+
+// Delete is part of the topo.Conn interface.
+func (s *Server) Delete(ctx context.Context, filePath string, version topo.Version) error {
+	nodePath := path.Join(s.root, filePath)
+
+	err := s.withTxn(ctx, func(conn *mysql.Conn, revision uint64) error {
+		return deleteRow(conn, nodePath, version)
+	})
+	return convertError(err, nodePath)
+}
+
+// Txn is part of the topo.Conn interface.
+func (s *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	// All the files written by the transaction get the same version.
+	versions := make([]topo.Version, len(ops))
+	err := s.withTxn(ctx, func(conn *mysql.Conn, revision uint64) error {
+		for i, op := range ops {
+			nodePath := path.Join(s.root, op.Path)
+			var err error
+			switch op.Type {
+			case topo.TxnCreate:
+				err = createRow(conn, nodePath, op.Contents, revision)
+				versions[i] = MySQLVersion(revision)
+			case topo.TxnUpdate:
+				err = updateRow(conn, nodePath, op.Contents, op.Version, revision)
+				versions[i] = MySQLVersion(revision)
+			case topo.TxnDelete:
+				err = deleteRow(conn, nodePath, op.Version)
+			case topo.TxnCheck:
+				err = checkRow(conn, nodePath, op.Version)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, convertError(err, s.root)
+	}
+	return versions, nil
+}
+
+// createRow inserts the row of a file, in a transaction.
+func createRow(conn *mysql.Conn, nodePath string, contents []byte, revision uint64) error {
+	_, err := execute(conn, "insert into topo_data (path, contents, version) values (%a, %a, %a)",
+		sqltypes.StringBindVariable(nodePath),
+		sqltypes.BytesBindVariable(contents),
+		sqltypes.Uint64BindVariable(revision))
+	if isDupEntry(err) {
+		return topo.NewError(topo.NodeExists, nodePath)
+	}
+	return err
+}
+
+// updateRow updates the row of a file, in a transaction. If version is
+// nil, the row is inserted if it doesn't exist.
+func updateRow(conn *mysql.Conn, nodePath string, contents []byte, version topo.Version, revision uint64) error {
+	if version == nil {
+		_, err := execute(conn, "insert into topo_data (path, contents, version) values (%a, %a, %a) on duplicate key update contents = values(contents), version = values(version)",
+			sqltypes.StringBindVariable(nodePath),
+			sqltypes.BytesBindVariable(contents),
+			sqltypes.Uint64BindVariable(revision))
+		return err
+	}
+
+	qr, err := execute(conn, "update topo_data set contents = %a, version = %a where path = %a and version = %a",
+		sqltypes.BytesBindVariable(contents),
+		sqltypes.Uint64BindVariable(revision),
+		sqltypes.StringBindVariable(nodePath),
+		sqltypes.Uint64BindVariable(uint64(version.(MySQLVersion))))
+	if err != nil {
+		return err
+	}
+	if qr.RowsAffected == 0 {
+		return missingRowError(conn, nodePath)
+	}
+	return nil
+}
+
+// deleteRow deletes the row of a file, in a transaction. If version is
+// not nil, the file must have it.
+func deleteRow(conn *mysql.Conn, nodePath string, version topo.Version) error {
+	query := "delete from topo_data where path = %a"
+	binds := []*querypb.BindVariable{sqltypes.StringBindVariable(nodePath)}
+	if version != nil {
+		query += " and version = %a"
+		binds = append(binds, sqltypes.Uint64BindVariable(uint64(version.(MySQLVersion))))
+	}
+	qr, err := execute(conn, query, binds...)
+	if err != nil {
+		return err
+	}
+	if qr.RowsAffected == 0 {
+		return missingRowError(conn, nodePath)
+	}
+	return nil
+}
+
+// checkRow checks the version of a file, and locks its row until the
+// end of the transaction.
+func checkRow(conn *mysql.Conn, nodePath string, version topo.Version) error {
+	qr, err := execute(conn, "select version from topo_data where path = %a for update", sqltypes.StringBindVariable(nodePath))
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) == 0 {
+		return topo.NewError(topo.NoNode, nodePath)
+	}
+	v, err := qr.Rows[0][0].ToUint64()
+	if err != nil {
+		return err
+	}
+	if MySQLVersion(v) != version.(MySQLVersion) {
+		return topo.NewError(topo.BadVersion, nodePath)
+	}
+	return nil
+}
+
+// missingRowError returns the error of a write with a version that
+// didn't change any row: ErrNoNode if the file doesn't exist, and
+// ErrBadVersion if it has another version.
+func missingRowError(conn *mysql.Conn, nodePath string) error {
+	qr, err := execute(conn, "select 1 from topo_data where path = %a", sqltypes.StringBindVariable(nodePath))
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) == 0 {
+		return topo.NewError(topo.NoNode, nodePath)
+	}
+	return topo.NewError(topo.BadVersion, nodePath)
+}
+
+// selectPrefix runs query on the rows whose path starts with prefix,
+// sorted by path.
+func selectPrefix(conn *mysql.Conn, query, prefix string) (*sqltypes.Result, error) {
+	binds := []*querypb.BindVariable{sqltypes.StringBindVariable(prefix)}
+	query += " where path >= %a"
+	if end := prefixEnd(prefix); end != "" {
+		query += " and path < %a"
+		binds = append(binds, sqltypes.StringBindVariable(end))
+	}
+	return execute(conn, query+" order by path", binds...)
+}
+
+// prefixEnd returns the smallest string greater than all the strings
+// starting with prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
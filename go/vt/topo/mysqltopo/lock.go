@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"path"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// lockRetryInterval is the time between two attempts to get a lock
+// held by someone else.
+var lockRetryInterval = 100 * time.Millisecond
+
+// mysqlLockDescriptor implements topo.LockDescriptor.
+type mysqlLockDescriptor struct {
+	s        *Server
+	lockPath string
+	owner    string
+	ttl      time.Duration
+
+	// stop is closed by Unlock, to stop renewing the lease.
+	stop chan struct{}
+	// done is closed when the lease is not renewed any more.
+	done chan struct{}
+	// lost is closed if the lease expired before it was renewed.
+	lost chan struct{}
+}
+
+// Lock is part of the topo.Conn interface.
+func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockDescriptor, error) {
+	return s.LockWithTTL(ctx, dirPath, contents, s.lockTTL)
+}
+
+// LockWithTTL is part of the topo.LeaseConn interface.
+func (s *Server) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (topo.LockDescriptor, error) {
+	// We list the directory first to make sure it exists.
+	if _, err := s.ListDir(ctx, dirPath, false /*full*/); err != nil {
+		return nil, convertError(err, dirPath)
+	}
+
+	lockPath := path.Join(s.root, dirPath)
+	owner, err := newLockOwner()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.lock(ctx, lockPath, contents, owner, ttl); err != nil {
+		return nil, err
+	}
+	return s.newLockDescriptor(lockPath, owner, ttl), nil
+}
+
+// mysqlLockVersion is the version of a holding of a lock: the owner of
+// its row in topo_locks.
+// It implements topo.Version.
+type mysqlLockVersion string
+
+// String is part of the topo.Version interface.
+func (v mysqlLockVersion) String() string {
+	return string(v)
+}
+
+// lockHolder returns the contents and the owner of the lock on
+// lockPath, if its lease is not expired.
+func (s *Server) lockHolder(ctx context.Context, lockPath string) (string, string, error) {
+	var contents, owner string
+	err := s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "select contents, owner from topo_locks where path = %a and expires > now(6)", sqltypes.StringBindVariable(lockPath))
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) == 0 {
+			return topo.NewError(topo.NoNode, lockPath)
+		}
+		contents = qr.Rows[0][0].ToString()
+		owner = qr.Rows[0][1].ToString()
+		return nil
+	})
+	if err != nil {
+		return "", "", convertError(err, lockPath)
+	}
+	return contents, owner, nil
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (s *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	contents, owner, err := s.lockHolder(ctx, path.Join(s.root, dirPath))
+	if err != nil {
+		return "", nil, err
+	}
+	return contents, mysqlLockVersion(owner), nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It deletes the row of the lock if it still has the owner of the
+// version. The holder then fails to renew its lease.
+func (s *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(mysqlLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	lockPath := path.Join(s.root, dirPath)
+	deleted := false
+	err := s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "delete from topo_locks where path = %a and owner = %a",
+			sqltypes.StringBindVariable(lockPath),
+			sqltypes.StringBindVariable(string(v)))
+		if err != nil {
+			return err
+		}
+		deleted = qr.RowsAffected > 0
+		return nil
+	})
+	if err != nil {
+		return convertError(err, lockPath)
+	}
+	if !deleted {
+		// The holder released the lock: it is not locked, or it
+		// was locked again.
+		if _, _, err := s.lockHolder(ctx, lockPath); err != nil {
+			return err
+		}
+		return topo.NewError(topo.BadVersion, lockPath)
+	}
+	return nil
+}
+
+// newLockOwner returns a random identifier for the holder of a lock.
+func newLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// lock waits until it can insert the row of lockPath in topo_locks, or
+// until ctx is done. The row of an expired lease is removed first.
+func (s *Server) lock(ctx context.Context, lockPath, contents, owner string, ttl time.Duration) error {
+	for {
+		locked := false
+		err := s.withConn(ctx, func(conn *mysql.Conn) error {
+			if _, err := execute(conn, "delete from topo_locks where path = %a and expires < now(6)", sqltypes.StringBindVariable(lockPath)); err != nil {
+				return err
+			}
+			_, err := execute(conn, "insert into topo_locks (path, contents, owner, expires) values (%a, %a, %a, now(6) + interval %a microsecond)",
+				sqltypes.StringBindVariable(lockPath),
+				sqltypes.StringBindVariable(contents),
+				sqltypes.StringBindVariable(owner),
+				sqltypes.Int64BindVariable(ttl.Microseconds()))
+			if isDupEntry(err) {
+				// Someone else has the lock.
+				return nil
+			}
+			locked = err == nil
+			return err
+		})
+		if err != nil {
+			return convertError(err, lockPath)
+		}
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return convertError(ctx.Err(), lockPath)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// newLockDescriptor returns the descriptor of a lock we hold, and
+// starts renewing its lease.
+func (s *Server) newLockDescriptor(lockPath, owner string, ttl time.Duration) *mysqlLockDescriptor {
+	ld := &mysqlLockDescriptor{
+		s:        s,
+		lockPath: lockPath,
+		owner:    owner,
+		ttl:      ttl,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	go ld.renew()
+	return ld
+}
+
+// renew renews the lease of the lock every third of its duration,
+// until Unlock is called or the lock is lost.
+func (ld *mysqlLockDescriptor) renew() {
+	defer close(ld.done)
+
+	ticker := time.NewTicker(ld.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ld.stop:
+			return
+		case <-ticker.C:
+		}
+
+		renewed := false
+		ctx, cancel := context.WithTimeout(context.Background(), *topo.RemoteOperationTimeout)
+		err := ld.s.withConn(ctx, func(conn *mysql.Conn) error {
+			qr, err := execute(conn, "update topo_locks set expires = now(6) + interval %a microsecond where path = %a and owner = %a",
+				sqltypes.Int64BindVariable(ld.ttl.Microseconds()),
+				sqltypes.StringBindVariable(ld.lockPath),
+				sqltypes.StringBindVariable(ld.owner))
+			if err != nil {
+				return err
+			}
+			renewed = qr.RowsAffected > 0
+			return nil
+		})
+		cancel()
+		switch {
+		case topo.IsErrType(err, topo.Interrupted):
+			// The Server was closed.
+			return
+		case err != nil:
+			// We will try again at the next tick, the lease
+			// may not be expired yet.
+			log.Warningf("failed to renew the lease of lock %v: %v", ld.lockPath, err)
+		case !renewed:
+			log.Errorf("lost lock %v, its lease expired", ld.lockPath)
+			close(ld.lost)
+			return
+		}
+	}
+}
+
+// Check is part of the topo.LockDescriptor interface.
+func (ld *mysqlLockDescriptor) Check(ctx context.Context) error {
+	select {
+	case <-ld.lost:
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.lockPath)
+	default:
+	}
+
+	held := false
+	err := ld.s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "select 1 from topo_locks where path = %a and owner = %a and expires > now(6)",
+			sqltypes.StringBindVariable(ld.lockPath),
+			sqltypes.StringBindVariable(ld.owner))
+		if err != nil {
+			return err
+		}
+		held = len(qr.Rows) > 0
+		return nil
+	})
+	if err != nil {
+		return convertError(err, ld.lockPath)
+	}
+	if !held {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.lockPath)
+	}
+	return nil
+}
+
+// Unlock is part of the topo.LockDescriptor interface.
+func (ld *mysqlLockDescriptor) Unlock(ctx context.Context) error {
+	close(ld.stop)
+	<-ld.done
+
+	deleted := false
+	err := ld.s.withConn(ctx, func(conn *mysql.Conn) error {
+		qr, err := execute(conn, "delete from topo_locks where path = %a and owner = %a",
+			sqltypes.StringBindVariable(ld.lockPath),
+			sqltypes.StringBindVariable(ld.owner))
+		if err != nil {
+			return err
+		}
+		deleted = qr.RowsAffected > 0
+		return nil
+	})
+	if err != nil {
+		return convertError(err, ld.lockPath)
+	}
+	if !deleted {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "unlock: lock %v not held", ld.lockPath)
+	}
+	return nil
+}
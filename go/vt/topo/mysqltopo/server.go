@@ -0,0 +1,337 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package mysqltopo implements topo.Server with a MySQL database as the
+backend, for installations that don't want to run etcd, ZooKeeper or
+consul.
+
+The files are the rows of the topo_data table, keyed by their full
+path. Like with consul, directories only exist through the files they
+contain. The version of a file is the value of a counter of the
+database, incremented by every write, when the file was last written:
+a file deleted and created again has a new version.
+
+Watches poll the database. Locks and elections are rows of the
+topo_locks table, with a lease renewed by their holder.
+*/
+package mysqltopo
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqlescape"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var (
+	mysqlUser     = flag.String("topo_mysql_user", "vt_topo", "user to connect to the MySQL topology server")
+	mysqlPassword = flag.String("topo_mysql_password", "", "password to connect to the MySQL topology server")
+	mysqlDatabase = flag.String("topo_mysql_database", "_vt_topo", "database of the MySQL topology server, created if it doesn't exist")
+	mysqlLockTTL  = flag.Duration("topo_mysql_lock_ttl", 30*time.Second, "lease of the locks of the MySQL topology server, renewed by their holder every third of it")
+	mysqlPoolSize = flag.Int("topo_mysql_pool_size", 4, "maximum number of connections to the MySQL topology server, of each cell")
+)
+
+// killTimeout bounds the kill of a query whose context is done.
+var killTimeout = 5 * time.Second
+
+// The schema of the database. topo_revision has a single row, with the
+// counter used as the version of the files.
+var createTables = []string{
+	`create table if not exists topo_data (
+  path varbinary(1024) not null,
+  contents longblob not null,
+  version bigint unsigned not null,
+  primary key (path)
+) engine=InnoDB`,
+	`create table if not exists topo_revision (
+  id int not null,
+  revision bigint unsigned not null,
+  primary key (id)
+) engine=InnoDB`,
+	`insert ignore into topo_revision (id, revision) values (1, 0)`,
+	`create table if not exists topo_locks (
+  path varbinary(1024) not null,
+  contents blob not null,
+  owner varbinary(64) not null,
+  expires datetime(6) not null,
+  primary key (path)
+) engine=InnoDB`,
+}
+
+// Factory is the mysql topo.Factory implementation.
+type Factory struct{}
+
+// HasGlobalReadOnlyCell is part of the topo.Factory interface.
+func (f Factory) HasGlobalReadOnlyCell(serverAddr, root string) bool {
+	return false
+}
+
+// Create is part of the topo.Factory interface.
+func (f Factory) Create(cell, serverAddr, root string) (topo.Conn, error) {
+	return NewServer(serverAddr, root)
+}
+
+// Server is the implementation of topo.Server for MySQL.
+type Server struct {
+	// params are the parameters of the connection to the database.
+	params *mysql.ConnParams
+
+	// root is the root path for this client.
+	root string
+
+	// lockTTL is the lease of the locks.
+	lockTTL time.Duration
+
+	// slots bounds the number of connections in use, it has a token
+	// per connection that can be opened.
+	slots chan struct{}
+
+	// mu protects the following fields.
+	mu sync.Mutex
+	// idle are the open connections that are not in use. The
+	// connections are opened as needed, and dropped after a
+	// connection error.
+	idle   []*mysql.Conn
+	closed bool
+}
+
+// NewServer returns a new mysqltopo.Server. serverAddr is either the
+// host:port of the MySQL server, or the path of its unix socket. The
+// database and its tables are created if they don't exist.
+func NewServer(serverAddr, root string) (*Server, error) {
+	params := &mysql.ConnParams{
+		Uname: *mysqlUser,
+		Pass:  *mysqlPassword,
+	}
+	if strings.HasPrefix(serverAddr, "/") {
+		params.UnixSocket = serverAddr
+	} else {
+		host, port, err := net.SplitHostPort(serverAddr)
+		if err != nil {
+			return nil, vterrors.Wrapf(err, "invalid MySQL server address %v", serverAddr)
+		}
+		params.Host = host
+		if params.Port, err = strconv.Atoi(port); err != nil {
+			return nil, vterrors.Wrapf(err, "invalid MySQL server address %v", serverAddr)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *topo.RemoteOperationTimeout)
+	defer cancel()
+
+	// The database may not exist yet, so we create it before using
+	// it in the connection parameters.
+	conn, err := mysql.Connect(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	_, err = execute(conn, "create database if not exists "+sqlescape.EscapeID(*mysqlDatabase))
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	params.DbName = *mysqlDatabase
+
+	poolSize := *mysqlPoolSize
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	s := &Server{
+		params:  params,
+		root:    root,
+		lockTTL: *mysqlLockTTL,
+		slots:   make(chan struct{}, poolSize),
+	}
+	if err := s.withConn(ctx, func(conn *mysql.Conn) error {
+		for _, query := range createTables {
+			if _, err := execute(conn, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// withConn runs fn with a connection to the database, taken from the
+// pool of the Server, or opened if none is idle. The connection goes
+// back to the pool, unless fn fails with a connection error. If ctx is
+// done before fn returns, the query running on the connection is killed,
+// and the connection is dropped.
+func (s *Server) withConn(ctx context.Context, fn func(conn *mysql.Conn) error) error {
+	conn, err := s.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { <-s.slots }()
+
+	done := make(chan struct{})
+	killed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.kill(conn)
+			killed <- true
+		case <-done:
+			killed <- false
+		}
+	}()
+	err = fn(conn)
+	close(done)
+	if <-killed {
+		conn.Close()
+		return convertError(ctx.Err(), s.root)
+	}
+	if err != nil && (mysql.IsConnErr(err) || conn.IsClosed()) {
+		conn.Close()
+		return err
+	}
+	s.putConn(conn)
+	return err
+}
+
+// getConn takes a slot of the pool, and returns an idle connection, or
+// a new one. The slot must be released once the connection is returned.
+func (s *Server) getConn(ctx context.Context) (*mysql.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, convertError(err, s.root)
+	}
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, convertError(ctx.Err(), s.root)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.slots
+		return nil, topo.NewError(topo.Interrupted, s.root)
+	}
+	if n := len(s.idle); n > 0 {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	conn, err := mysql.Connect(ctx, s.params)
+	if err != nil {
+		<-s.slots
+		return nil, convertError(err, s.root)
+	}
+	return conn, nil
+}
+
+// putConn returns a connection to the pool, or closes it if the Server
+// was closed.
+func (s *Server) putConn(conn *mysql.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return
+	}
+	s.idle = append(s.idle, conn)
+}
+
+// kill kills the connection from another one, which interrupts its
+// query and rolls back its transaction, and closes it.
+func (s *Server) kill(conn *mysql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+	killConn, err := mysql.Connect(ctx, s.params)
+	if err == nil {
+		_, err = killConn.ExecuteFetch(fmt.Sprintf("kill %d", conn.ID()), 1, false)
+		killConn.Close()
+	}
+	if err != nil {
+		log.Warningf("Failed to kill the connection %d of the MySQL topology server: %v", conn.ID(), err)
+	}
+	conn.Close()
+}
+
+// withTxn runs fn in a transaction, with the next value of the revision
+// counter. The transaction is committed if fn succeeds.
+func (s *Server) withTxn(ctx context.Context, fn func(conn *mysql.Conn, revision uint64) error) error {
+	return s.withConn(ctx, func(conn *mysql.Conn) error {
+		if _, err := execute(conn, "begin"); err != nil {
+			return err
+		}
+		qr, err := execute(conn, "update topo_revision set revision = last_insert_id(revision + 1) where id = 1")
+		if err == nil {
+			err = fn(conn, qr.InsertID)
+		}
+		if err == nil {
+			_, err = execute(conn, "commit")
+		}
+		if err != nil {
+			// A failed rollback means the connection is broken,
+			// and the transaction is rolled back anyway.
+			_, _ = execute(conn, "rollback")
+			return err
+		}
+		return nil
+	})
+}
+
+// execute binds the variables of query, see sqlparser.ParseAndBind,
+// and runs it.
+func execute(conn *mysql.Conn, query string, binds ...*querypb.BindVariable) (*sqltypes.Result, error) {
+	if len(binds) > 0 {
+		var err error
+		if query, err = sqlparser.ParseAndBind(query, binds...); err != nil {
+			return nil, err
+		}
+	}
+	return conn.ExecuteFetch(query, math.MaxInt32, false)
+}
+
+// Close implements topo.Server.Close.
+// The queries made after it fail with ErrInterrupted.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, conn := range s.idle {
+		conn.Close()
+	}
+	s.idle = nil
+}
+
+func init() {
+	topo.RegisterFactory("mysql", Factory{})
+}
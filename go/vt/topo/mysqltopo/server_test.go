@@ -0,0 +1,186 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo_test
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/mysqltopo"
+	"vitess.io/vitess/go/vt/topo/test"
+	"vitess.io/vitess/go/vt/vttest"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vttestpb "vitess.io/vitess/go/vt/proto/vttest"
+)
+
+// startMySQL starts a MySQL server, and returns its address.
+func startMySQL(t *testing.T) string {
+	cluster := &vttest.LocalCluster{
+		Config: vttest.Config{
+			Topology: &vttestpb.VTTestTopology{
+				Keyspaces: []*vttestpb.Keyspace{{
+					Name:   "vttest",
+					Shards: []*vttestpb.Shard{{Name: "0"}},
+				}},
+			},
+			OnlyMySQL: true,
+		},
+	}
+	if err := cluster.Setup(); err != nil {
+		t.Fatalf("could not launch mysql: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := cluster.TearDown(); err != nil {
+			log.Errorf("cluster.TearDown() failed: %v", err)
+		}
+	})
+
+	params := cluster.MySQLConnParams()
+	*mysqltopo.MySQLUser = params.Uname
+	*mysqltopo.MySQLPassword = params.Pass
+	if params.UnixSocket != "" {
+		return params.UnixSocket
+	}
+	return fmt.Sprintf("%v:%v", params.Host, params.Port)
+}
+
+func TestMySQLTopo(t *testing.T) {
+	serverAddr := startMySQL(t)
+
+	// Short polls, so the watch tests don't wait too long.
+	defer func(d time.Duration) { *mysqltopo.WatchPollDuration = d }(*mysqltopo.WatchPollDuration)
+	*mysqltopo.WatchPollDuration = 100 * time.Millisecond
+
+	testIndex := 0
+	newServer := func() *topo.Server {
+		// Each test will use its own sub-directories.
+		testRoot := fmt.Sprintf("/test-%v", testIndex)
+		testIndex++
+
+		// Create the server on the new root.
+		ts, err := topo.OpenServer("mysql", serverAddr, path.Join(testRoot, topo.GlobalCell))
+		if err != nil {
+			t.Fatalf("OpenServer() failed: %v", err)
+		}
+
+		// Create the CellInfo.
+		if err := ts.CreateCellInfo(context.Background(), test.LocalCellName, &topodatapb.CellInfo{
+			ServerAddress: serverAddr,
+			Root:          path.Join(testRoot, test.LocalCellName),
+		}); err != nil {
+			t.Fatalf("CreateCellInfo() failed: %v", err)
+		}
+
+		return ts
+	}
+
+	// Run the TopoServerTestSuite tests.
+	test.TopoServerTestSuite(t, func() *topo.Server {
+		return newServer()
+	})
+
+	// Run mysql-specific tests.
+	testLockLease(t, serverAddr)
+	testQueryKill(t, serverAddr)
+}
+
+// testQueryKill checks that a query is killed when its context is done,
+// and that its connection is not reused.
+func testQueryKill(t *testing.T, serverAddr string) {
+	s, err := mysqltopo.NewServer(serverAddr, "/test-kill")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var killed *mysql.Conn
+	err = s.WithConn(ctx, func(conn *mysql.Conn) error {
+		killed = conn
+		_, err := mysqltopo.Execute(conn, "select sleep(10)")
+		return err
+	})
+	if !topo.IsErrType(err, topo.Timeout) {
+		t.Fatalf("got %v, want a Timeout error", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("the query was not killed, it took %v", d)
+	}
+
+	if err := s.WithConn(context.Background(), func(conn *mysql.Conn) error {
+		if conn == killed {
+			t.Errorf("the connection of the killed query was reused")
+		}
+		_, err := mysqltopo.Execute(conn, "select 1")
+		return err
+	}); err != nil {
+		t.Fatalf("query after the kill failed: %v", err)
+	}
+}
+
+// testLockLease checks that a lock is kept while its holder renews its
+// lease, and can be taken once the lease expired.
+func testLockLease(t *testing.T, serverAddr string) {
+	ctx := context.Background()
+	s1, err := mysqltopo.NewServer(serverAddr, "/test-lease")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s1.SetLockTTL(300 * time.Millisecond)
+	s2, err := mysqltopo.NewServer(serverAddr, "/test-lease")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	defer s2.Close()
+
+	if _, err := s1.Create(ctx, "dir/file", []byte("a")); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := s1.Lock(ctx, "dir", "s1"); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// The lease is renewed, so the lock is still held after it
+	// expired a few times.
+	lockCtx, cancel := context.WithTimeout(ctx, time.Second)
+	_, err = s2.Lock(lockCtx, "dir", "s2")
+	cancel()
+	if !topo.IsErrType(err, topo.Timeout) {
+		t.Fatalf("Lock of a held lock returned: %v", err)
+	}
+
+	// Once s1 is closed, the lease is not renewed any more.
+	s1.Close()
+	lockCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ld, err := s2.Lock(lockCtx, "dir", "s2")
+	if err != nil {
+		t.Fatalf("Lock of an expired lock failed: %v", err)
+	}
+	if err := ld.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+}
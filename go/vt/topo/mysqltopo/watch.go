@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqltopo
+
+import (
+	"context"
+	"flag"
+	"path"
+	"time"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+var (
+	watchPollDuration = flag.Duration("topo_mysql_watch_poll_duration", time.Second, "time between two reads of a watched file of the MySQL topology server")
+)
+
+// Watch is part of the topo.Conn interface.
+func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-chan *topo.WatchData, error) {
+	// Initial get.
+	initialCtx, initialCancel := context.WithTimeout(ctx, *topo.RemoteOperationTimeout)
+	defer initialCancel()
+
+	contents, version, err := s.Get(initialCtx, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Initial value to return.
+	wd := &topo.WatchData{
+		Contents: contents,
+		Version:  version,
+	}
+
+	// Create the notifications channel, and poll the file to send
+	// its changes.
+	notifications := make(chan *topo.WatchData, 10)
+	go func() {
+		defer close(notifications)
+
+		ticker := time.NewTicker(*watchPollDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				notifications <- &topo.WatchData{
+					Err: convertError(ctx.Err(), path.Join(s.root, filePath)),
+				}
+				return
+			case <-ticker.C:
+			}
+
+			contents, newVersion, err := s.Get(ctx, filePath)
+			if err != nil {
+				// The node disappeared, serious error, or
+				// context cancelled.
+				notifications <- &topo.WatchData{
+					Err: err,
+				}
+				return
+			}
+
+			// If we got a new value, send it.
+			if newVersion != version {
+				version = newVersion
+				notifications <- &topo.WatchData{
+					Contents: contents,
+					Version:  version,
+				}
+			}
+		}
+	}()
+
+	return wd, notifications, nil
+}
+
+// WatchFrom is part of the topo.Conn interface.
+func (s *Server) WatchFrom(ctx context.Context, filePath string, version topo.Version) (<-chan *topo.WatchData, error) {
+	return topo.EmulateWatchFrom(ctx, s, filePath, version)
+}
+
+// WatchRecursive is part of the topo.Conn interface.
+func (s *Server) WatchRecursive(ctx context.Context, path string) ([]*topo.WatchDataRecursive, <-chan *topo.WatchDataRecursive, error) {
+	return topo.EmulateWatchRecursive(ctx, s, path, topo.WatchRecursivePollInterval)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/trace"
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/proto/vtrpc"
+	"vitess.io/vitess/go/vt/vterrors"
+)
+
+// This file contains the named locks: locks on arbitrary resources,
+// identified by a name, for the workflows that need to serialize on
+// something that is neither a keyspace nor a shard. They behave like
+// the keyspace and shard locks, see locks.go.
+
+// namedLockPath returns the path of the named lock.
+func namedLockPath(name string) string {
+	return path.Join(NamedLocksPath, name)
+}
+
+// checkLockName returns an error if name can't be used for a named
+// lock.
+func checkLockName(name string) error {
+	if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "invalid lock name %q", name)
+	}
+	return nil
+}
+
+// LockName will lock the resource with the given name, and return:
+// - a context with a locksInfo structure for future reference.
+// - an unlock method
+// - an error if anything failed.
+//
+// The name can be anything but an empty string, and can't contain
+// a '/'. Named locks don't conflict with the keyspace and shard locks,
+// even with the same name. Like them, they accept a lease with
+// WithLeaseTTL, and can be broken with ForceUnlockName.
+func (ts *Server) LockName(ctx context.Context, name, action string, opts ...LockOption) (context.Context, func(*error), error) {
+	if err := checkLockName(name); err != nil {
+		return nil, nil, err
+	}
+
+	i, ok := ctx.Value(locksKey).(*locksInfo)
+	if !ok {
+		i = &locksInfo{
+			info: make(map[string]*lockInfo),
+		}
+		ctx = context.WithValue(ctx, locksKey, i)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// check that we're not already locked
+	mapKey := namedLockPath(name)
+	if _, ok = i.info[mapKey]; ok {
+		return nil, nil, vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "lock for name %v is already held", name)
+	}
+
+	// lock
+	o := newLockOptions(opts)
+	l := newLock(action)
+	lockDescriptor, err := l.lockName(ctx, ts, name, o.leaseTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// start renewing the lease, if any
+	var lease *lockLease
+	if o.leaseTTL > 0 {
+		ctx, lease = newLockLease(ctx, mapKey, lockDescriptor, o)
+	}
+
+	// and update our structure
+	i.info[mapKey] = &lockInfo{
+		lockDescriptor: lockDescriptor,
+		actionNode:     l,
+		lease:          lease,
+	}
+	return ctx, func(finalErr *error) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		if _, ok := i.info[mapKey]; !ok {
+			if *finalErr != nil {
+				log.Errorf("trying to unlock name %v multiple times", name)
+			} else {
+				*finalErr = vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "trying to unlock name %v multiple times", name)
+			}
+			return
+		}
+
+		if lease != nil {
+			lease.release()
+			defer lease.cancel()
+		}
+		err := l.unlockName(ctx, name, lockDescriptor, *finalErr)
+		if *finalErr != nil {
+			if err != nil {
+				// both error are set, just log the unlock error
+				log.Errorf("unlockName(%v) failed: %v", name, err)
+			}
+		} else {
+			*finalErr = err
+		}
+		delete(i.info, mapKey)
+	}, nil
+}
+
+// CheckNameLocked can be called on a context to make sure we have the
+// named lock, and that the lock server still holds it.
+func CheckNameLocked(ctx context.Context, name string) error {
+	// extract the locksInfo pointer
+	i, ok := ctx.Value(locksKey).(*locksInfo)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "name %v is not locked (no locksInfo)", name)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// find the individual entry
+	li, ok := i.info[namedLockPath(name)]
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "name %v is not locked (no lockInfo in map)", name)
+	}
+	if li.lease != nil {
+		if err := li.lease.check(); err != nil {
+			return err
+		}
+	}
+	return li.lockDescriptor.Check(ctx)
+}
+
+// GetNamedLock returns the current holder of a named lock. It returns
+// NoNode if the name is not locked.
+func (ts *Server) GetNamedLock(ctx context.Context, name string) (*Lock, error) {
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	l, _, err := ts.getLock(ctx, namedLockPath(name))
+	return l, err
+}
+
+// ForceUnlockName breaks a named lock, see ForceUnlockKeyspace.
+func (ts *Server) ForceUnlockName(ctx context.Context, name, operator, reason string) (*Lock, error) {
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	return ts.forceUnlock(ctx, namedLockPath(name), operator, reason)
+}
+
+// GetNamedLockHistory returns the forced releases of a named lock,
+// oldest first.
+func (ts *Server) GetNamedLockHistory(ctx context.Context, name string) ([]*LockBreak, error) {
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	history, _, err := ts.getLockHistory(ctx, namedLockPath(name))
+	return history, err
+}
+
+// lockName will lock the name in the topology server. The directory
+// of the lock is created on first use, with a NamedLockFile in it, as
+// the backends can only lock an existing directory.
+// unlockName should be called if this returns no error.
+func (l *Lock) lockName(ctx context.Context, ts *Server, name string, leaseTTL time.Duration) (LockDescriptor, error) {
+	log.Infof("Locking name %v for action %v", name, l.Action)
+
+	ctx, cancel := context.WithTimeout(ctx, *RemoteOperationTimeout)
+	defer cancel()
+
+	span, ctx := trace.NewSpan(ctx, "TopoServer.LockNameForAction")
+	span.Annotate("action", l.Action)
+	span.Annotate("name", name)
+	defer span.Finish()
+
+	lockPath := namedLockPath(name)
+	if _, err := ts.globalCell.Create(ctx, path.Join(lockPath, NamedLockFile), nil); err != nil && !IsErrType(err, NodeExists) {
+		return nil, err
+	}
+	j, err := l.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+	return lockWithTTL(ctx, ts.globalCell, lockPath, j, leaseTTL)
+}
+
+// unlockName unlocks a previously locked name.
+func (l *Lock) unlockName(ctx context.Context, name string, lockDescriptor LockDescriptor, actionError error) error {
+	// Detach from the parent timeout, but copy the trace span.
+	// We need to still release the lock even if the parent
+	// context timed out.
+	ctx = trace.CopySpan(context.TODO(), ctx)
+	ctx, cancel := context.WithTimeout(ctx, defaultLockTimeout)
+	defer cancel()
+
+	span, ctx := trace.NewSpan(ctx, "TopoServer.UnlockNameForAction")
+	span.Annotate("action", l.Action)
+	span.Annotate("name", name)
+	defer span.Finish()
+
+	// first update the actionNode
+	if actionError != nil {
+		log.Infof("Unlocking name %v for action %v with error %v", name, l.Action, actionError)
+		l.Status = "Error: " + actionError.Error()
+	} else {
+		log.Infof("Unlocking name %v for successful action %v", name, l.Action)
+		l.Status = "Done"
+	}
+	return lockDescriptor.Unlock(ctx)
+}
@@ -19,6 +19,7 @@ package topo
 import (
 	"context"
 	"path"
+	"sort"
 
 	"google.golang.org/protobuf/proto"
 
@@ -169,6 +170,216 @@ func FixShardReplication(ctx context.Context, ts *Server, logger logutil.Logger,
 	return nil, nil
 }
 
+// OrphanedShardReplicationNode is an entry of the replication graph of
+// a shard in a cell that points at a tablet that doesn't exist.
+type OrphanedShardReplicationNode struct {
+	Cell        string
+	Keyspace    string
+	Shard       string
+	TabletAlias *topodatapb.TabletAlias
+}
+
+// RemoveOrphanedShardReplicationNodes scans the replication graph of
+// all the shards in the given cells (all the cells if empty), and
+// removes the entries that point at tablets that don't exist, as
+// FixShardReplication does for a single shard, but all at once. The
+// replication graph of the shards that are no longer in the global
+// topology is scanned too. If dryRun is set, the entries are only
+// reported. It returns the orphaned entries that were found.
+func RemoveOrphanedShardReplicationNodes(ctx context.Context, ts *Server, logger logutil.Logger, cells []string, dryRun bool) ([]*OrphanedShardReplicationNode, error) {
+	if len(cells) == 0 {
+		var err error
+		if cells, err = ts.GetCellInfoNames(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []*OrphanedShardReplicationNode
+	for _, cell := range cells {
+		orphans, err := removeOrphanedShardReplicationNodesInCell(ctx, ts, logger, cell, dryRun)
+		result = append(result, orphans...)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// removeOrphanedShardReplicationNodesInCell does the work of
+// RemoveOrphanedShardReplicationNodes for one cell.
+func removeOrphanedShardReplicationNodesInCell(ctx context.Context, ts *Server, logger logutil.Logger, cell string, dryRun bool) ([]*OrphanedShardReplicationNode, error) {
+	conn, err := ts.ConnForCell(ctx, cell)
+	if err != nil {
+		return nil, err
+	}
+	keyspaces, err := conn.ListDir(ctx, KeyspacesPath, false /*full*/)
+	switch {
+	case IsErrType(err, NoNode):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	// List the tablets of the cell once, so we only have to read
+	// the tablets that are not in the list.
+	aliases, err := ts.GetTabletAliasesByCell(ctx, cell)
+	if err != nil {
+		return nil, err
+	}
+	tablets := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		tablets[topoproto.TabletAliasString(alias)] = true
+	}
+
+	var result []*OrphanedShardReplicationNode
+	for _, keyspace := range DirEntriesToStringArray(keyspaces) {
+		shards, err := conn.ListDir(ctx, path.Join(KeyspacesPath, keyspace, ShardsPath), false /*full*/)
+		switch {
+		case IsErrType(err, NoNode):
+			continue
+		case err != nil:
+			return result, err
+		}
+
+		for _, shard := range DirEntriesToStringArray(shards) {
+			sri, err := ts.GetShardReplication(ctx, cell, keyspace, shard)
+			switch {
+			case IsErrType(err, NoNode):
+				continue
+			case err != nil:
+				return result, err
+			}
+
+			orphans := make(map[string]bool)
+			for _, node := range sri.Nodes {
+				if tablets[topoproto.TabletAliasString(node.TabletAlias)] {
+					continue
+				}
+				// The tablet may have been created since we
+				// listed them, or may be in another cell.
+				_, err := ts.GetTablet(ctx, node.TabletAlias)
+				switch {
+				case err == nil:
+					continue
+				case !IsErrType(err, NoNode):
+					return result, err
+				}
+				orphans[topoproto.TabletAliasString(node.TabletAlias)] = true
+				logger.Warningf("Tablet %v is in the replication graph of %v/%v, but does not exist", topoproto.TabletAliasString(node.TabletAlias), keyspace, shard)
+				result = append(result, &OrphanedShardReplicationNode{
+					Cell:        cell,
+					Keyspace:    keyspace,
+					Shard:       shard,
+					TabletAlias: node.TabletAlias,
+				})
+			}
+			if len(orphans) == 0 || dryRun {
+				continue
+			}
+			logger.Infof("Removing %v entries from the replication graph of %v/%v", len(orphans), keyspace, shard)
+			if err := ts.UpdateShardReplicationFields(ctx, cell, keyspace, shard, func(sr *topodatapb.ShardReplication) error {
+				nodes := make([]*topodatapb.ShardReplication_Node, 0, len(sr.Nodes))
+				for _, node := range sr.Nodes {
+					if !orphans[topoproto.TabletAliasString(node.TabletAlias)] {
+						nodes = append(nodes, node)
+					}
+				}
+				if len(nodes) == len(sr.Nodes) {
+					return NewError(NoUpdateNeeded, path.Join(cell, keyspace, shard))
+				}
+				sr.Nodes = nodes
+				return nil
+			}); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// RebuildShardReplication rebuilds the replication graph of a shard in
+// a cell from the records of the tablets of the cell, under the shard
+// lock: the tablets of the shard are added to it, and the entries that
+// point at tablets that don't exist or are not in the shard are
+// removed. The shard must exist. It returns the aliases of the tablets
+// that were added and removed.
+func (ts *Server) RebuildShardReplication(ctx context.Context, cell, keyspace, shard string) (added, removed []*topodatapb.TabletAlias, err error) {
+	if _, err := ts.GetShard(ctx, keyspace, shard); err != nil {
+		return nil, nil, err
+	}
+	ctx, unlock, lockErr := ts.LockShard(ctx, keyspace, shard, "RebuildShardReplication")
+	if lockErr != nil {
+		return nil, nil, lockErr
+	}
+	defer unlock(&err)
+
+	tablets, err := ts.GetTabletsByCell(ctx, cell)
+	if err != nil {
+		return nil, nil, err
+	}
+	inShard := func(tablet *topodatapb.Tablet) bool {
+		return tablet.Keyspace == keyspace && tablet.Shard == shard && tablet.Alias.Cell == cell
+	}
+	var aliases []*topodatapb.TabletAlias
+	for _, ti := range tablets {
+		if inShard(ti.Tablet) {
+			aliases = append(aliases, ti.Alias)
+		}
+	}
+	sort.Sort(topoproto.TabletAliasList(aliases))
+
+	err = ts.UpdateShardReplicationFields(ctx, cell, keyspace, shard, func(sr *topodatapb.ShardReplication) error {
+		added, removed = nil, nil
+		want := make(map[string]bool, len(aliases))
+		for _, alias := range aliases {
+			want[topoproto.TabletAliasString(alias)] = true
+		}
+
+		// Duplicate entries are removed too.
+		kept := make(map[string]bool, len(sr.Nodes))
+		nodes := make([]*topodatapb.ShardReplication_Node, 0, len(aliases))
+		for _, node := range sr.Nodes {
+			aliasStr := topoproto.TabletAliasString(node.TabletAlias)
+			if kept[aliasStr] {
+				continue
+			}
+			if want[aliasStr] {
+				kept[aliasStr] = true
+				nodes = append(nodes, node)
+				continue
+			}
+			// The tablet may have been created since we listed
+			// them: creating a tablet doesn't take the shard lock.
+			ti, err := ts.GetTablet(ctx, node.TabletAlias)
+			switch {
+			case err == nil && inShard(ti.Tablet):
+				kept[aliasStr] = true
+				nodes = append(nodes, node)
+				continue
+			case err != nil && !IsErrType(err, NoNode):
+				return err
+			}
+			removed = append(removed, node.TabletAlias)
+		}
+		for _, alias := range aliases {
+			if !kept[topoproto.TabletAliasString(alias)] {
+				added = append(added, alias)
+				nodes = append(nodes, &topodatapb.ShardReplication_Node{TabletAlias: alias})
+			}
+		}
+
+		if len(nodes) == len(sr.Nodes) && len(added) == 0 && len(removed) == 0 {
+			return NewError(NoUpdateNeeded, path.Join(cell, keyspace, shard))
+		}
+		sr.Nodes = nodes
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
+
 // UpdateShardReplicationFields updates the fields inside a topo.ShardReplication object.
 func (ts *Server) UpdateShardReplicationFields(ctx context.Context, cell, keyspace, shard string, update func(*topodatapb.ShardReplication) error) error {
 	nodePath := path.Join(KeyspacesPath, keyspace, ShardsPath, shard, ShardReplicationFile)
@@ -0,0 +1,293 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var _ Conn = (*RetryConn)(nil)
+
+var topoRetryConnRetries = stats.NewCountersWithMultiLabels(
+	"TopologyConnRetries",
+	"TopologyConnRetries operations retried after a transient error",
+	[]string{"Operation", "Cell"})
+
+// RetryPolicy configures how the operations of the topology server
+// that fail with a transient error are retried. See
+// Server.SetRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of the reads (ListDir,
+	// Get and List), including the first one. The reads are not
+	// retried if it is 1 or less.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry. It doubles
+	// at each retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Budgets overrides the number of attempts of some operations,
+	// indexed by the name of their Conn method. The writes (Create,
+	// Update, Delete and Txn) and the locks (Lock) are only retried if
+	// they have a budget: a write that timed out may have been applied,
+	// in which case its retry fails with NodeExists or BadVersion.
+	Budgets map[string]int
+}
+
+// attempts returns the number of attempts of an operation.
+func (p *RetryPolicy) attempts(operation string) int {
+	if n, ok := p.Budgets[operation]; ok {
+		return n
+	}
+	switch operation {
+	case "ListDir", "Get", "List":
+		return p.MaxAttempts
+	}
+	return 1
+}
+
+// ParseRetryBudgets parses the retry budgets of a RetryPolicy, in the
+// format "Operation=attempts,...", for instance "Create=3,Lock=2".
+func ParseRetryBudgets(value string) (map[string]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	budgets := make(map[string]int)
+	for _, budget := range strings.Split(value, ",") {
+		parts := strings.Split(budget, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid retry budget %q, expected Operation=attempts", budget)
+		}
+		attempts, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of attempts in retry budget %q: %v", budget, err)
+		}
+		budgets[strings.TrimSpace(parts[0])] = attempts
+	}
+	return budgets, nil
+}
+
+// isTransientError returns true if an operation that failed with err
+// can succeed if retried.
+func isTransientError(err error) bool {
+	return IsErrType(err, Timeout) || vterrors.Code(err) == vtrpcpb.Code_UNAVAILABLE
+}
+
+// retrier holds the RetryPolicy of a Server, shared by all its
+// RetryConns, so it can be changed.
+type retrier struct {
+	mu     sync.Mutex
+	policy RetryPolicy
+}
+
+func (r *retrier) get() RetryPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.policy
+}
+
+func (r *retrier) set(policy RetryPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policy = policy
+}
+
+// RetryConn is a wrapper for a Conn that retries the operations that
+// fail with a transient error, like a timeout during a leader election
+// of the topology server, according to a RetryPolicy. It waits between
+// the attempts with an exponential backoff, and stops as soon as the
+// context of the operation is done, or would be before the next one.
+// The watches and the leader participations are not retried.
+type RetryConn struct {
+	cell    string
+	conn    Conn
+	retrier *retrier
+}
+
+// NewRetryConn returns a RetryConn using the given policy.
+func NewRetryConn(cell string, conn Conn, policy RetryPolicy) *RetryConn {
+	return newRetryConn(cell, conn, &retrier{policy: policy})
+}
+
+func newRetryConn(cell string, conn Conn, r *retrier) *RetryConn {
+	return &RetryConn{
+		cell:    cell,
+		conn:    conn,
+		retrier: r,
+	}
+}
+
+// retry calls f until it succeeds, fails with an error that isn't
+// transient, or the budget of the operation is spent.
+func (c *RetryConn) retry(ctx context.Context, operation string, f func() error) error {
+	policy := c.retrier.get()
+	attempts := policy.attempts(operation)
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= attempts || !isTransientError(err) || ctx.Err() != nil {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+
+		topoRetryConnRetries.Add([]string{operation, c.cell}, 1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// ListDir is part of the Conn interface
+func (c *RetryConn) ListDir(ctx context.Context, dirPath string, full bool) (entries []DirEntry, err error) {
+	err = c.retry(ctx, "ListDir", func() error {
+		entries, err = c.conn.ListDir(ctx, dirPath, full)
+		return err
+	})
+	return entries, err
+}
+
+// Create is part of the Conn interface
+func (c *RetryConn) Create(ctx context.Context, filePath string, contents []byte) (version Version, err error) {
+	err = c.retry(ctx, "Create", func() error {
+		version, err = c.conn.Create(ctx, filePath, contents)
+		return err
+	})
+	return version, err
+}
+
+// Update is part of the Conn interface
+func (c *RetryConn) Update(ctx context.Context, filePath string, contents []byte, version Version) (newVersion Version, err error) {
+	err = c.retry(ctx, "Update", func() error {
+		newVersion, err = c.conn.Update(ctx, filePath, contents, version)
+		return err
+	})
+	return newVersion, err
+}
+
+// Get is part of the Conn interface
+func (c *RetryConn) Get(ctx context.Context, filePath string) (contents []byte, version Version, err error) {
+	err = c.retry(ctx, "Get", func() error {
+		contents, version, err = c.conn.Get(ctx, filePath)
+		return err
+	})
+	return contents, version, err
+}
+
+// List is part of the Conn interface
+func (c *RetryConn) List(ctx context.Context, filePathPrefix string) (kvs []KVInfo, err error) {
+	err = c.retry(ctx, "List", func() error {
+		kvs, err = c.conn.List(ctx, filePathPrefix)
+		return err
+	})
+	return kvs, err
+}
+
+// Delete is part of the Conn interface
+func (c *RetryConn) Delete(ctx context.Context, filePath string, version Version) error {
+	return c.retry(ctx, "Delete", func() error {
+		return c.conn.Delete(ctx, filePath, version)
+	})
+}
+
+// Txn is part of the Conn interface
+func (c *RetryConn) Txn(ctx context.Context, ops []TxnOp) (versions []Version, err error) {
+	err = c.retry(ctx, "Txn", func() error {
+		versions, err = c.conn.Txn(ctx, ops)
+		return err
+	})
+	return versions, err
+}
+
+// Lock is part of the Conn interface
+func (c *RetryConn) Lock(ctx context.Context, dirPath, contents string) (ld LockDescriptor, err error) {
+	err = c.retry(ctx, "Lock", func() error {
+		ld, err = c.conn.Lock(ctx, dirPath, contents)
+		return err
+	})
+	return ld, err
+}
+
+// LockWithTTL is part of the LeaseConn interface
+func (c *RetryConn) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (ld LockDescriptor, err error) {
+	err = c.retry(ctx, "Lock", func() error {
+		ld, err = lockWithTTL(ctx, c.conn, dirPath, contents, ttl)
+		return err
+	})
+	return ld, err
+}
+
+// LockHolder is part of the LockInspectorConn interface
+func (c *RetryConn) LockHolder(ctx context.Context, dirPath string) (contents string, version Version, err error) {
+	err = c.retry(ctx, "Get", func() error {
+		contents, version, err = lockHolder(ctx, c.conn, dirPath)
+		return err
+	})
+	return contents, version, err
+}
+
+// BreakLock is part of the LockInspectorConn interface
+func (c *RetryConn) BreakLock(ctx context.Context, dirPath string, version Version) error {
+	return c.retry(ctx, "BreakLock", func() error {
+		return breakLock(ctx, c.conn, dirPath, version)
+	})
+}
+
+// Watch is part of the Conn interface
+func (c *RetryConn) Watch(ctx context.Context, filePath string) (current *WatchData, changes <-chan *WatchData, err error) {
+	return c.conn.Watch(ctx, filePath)
+}
+
+// WatchFrom is part of the Conn interface
+func (c *RetryConn) WatchFrom(ctx context.Context, filePath string, version Version) (<-chan *WatchData, error) {
+	return c.conn.WatchFrom(ctx, filePath, version)
+}
+
+// WatchRecursive is part of the Conn interface
+func (c *RetryConn) WatchRecursive(ctx context.Context, path string) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error) {
+	return c.conn.WatchRecursive(ctx, path)
+}
+
+// NewLeaderParticipation is part of the Conn interface
+func (c *RetryConn) NewLeaderParticipation(name, id string) (LeaderParticipation, error) {
+	return c.conn.NewLeaderParticipation(name, id)
+}
+
+// Close is part of the Conn interface
+func (c *RetryConn) Close() {
+	c.conn.Close()
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyConn is a fakeConn whose Get and Create fail with err, as many
+// times as failures.
+type flakyConn struct {
+	*fakeConn
+	failures int
+	err      error
+	calls    int
+}
+
+func (c *flakyConn) Get(ctx context.Context, filePath string) ([]byte, Version, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, nil, c.err
+	}
+	return []byte("contents"), nil, nil
+}
+
+func (c *flakyConn) Create(ctx context.Context, filePath string, contents []byte) (Version, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, c.err
+	}
+	return nil, nil
+}
+
+func TestRetryConn(t *testing.T) {
+	ctx := context.Background()
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+
+	// A read is retried after a transient error.
+	fc := &flakyConn{fakeConn: &fakeConn{}, failures: 2, err: NewError(Timeout, "path")}
+	conn := NewRetryConn("cell", fc, policy)
+	contents, _, err := conn.Get(ctx, "path")
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(contents))
+	assert.Equal(t, 3, fc.calls)
+
+	// Until the budget is spent.
+	fc = &flakyConn{fakeConn: &fakeConn{}, failures: 5, err: NewError(Timeout, "path")}
+	conn = NewRetryConn("cell", fc, policy)
+	_, _, err = conn.Get(ctx, "path")
+	assert.True(t, IsErrType(err, Timeout), "unexpected error: %v", err)
+	assert.Equal(t, 3, fc.calls)
+
+	// Other errors are not retried.
+	fc = &flakyConn{fakeConn: &fakeConn{}, failures: 1, err: NewError(NoNode, "path")}
+	conn = NewRetryConn("cell", fc, policy)
+	_, _, err = conn.Get(ctx, "path")
+	assert.True(t, IsErrType(err, NoNode), "unexpected error: %v", err)
+	assert.Equal(t, 1, fc.calls)
+
+	// Writes are not retried without a budget.
+	fc = &flakyConn{fakeConn: &fakeConn{}, failures: 1, err: NewError(Timeout, "path")}
+	conn = NewRetryConn("cell", fc, policy)
+	_, err = conn.Create(ctx, "path", nil)
+	assert.True(t, IsErrType(err, Timeout), "unexpected error: %v", err)
+	assert.Equal(t, 1, fc.calls)
+
+	// But they are with one.
+	policy.Budgets = map[string]int{"Create": 2}
+	fc = &flakyConn{fakeConn: &fakeConn{}, failures: 1, err: NewError(Timeout, "path")}
+	conn = NewRetryConn("cell", fc, policy)
+	_, err = conn.Create(ctx, "path", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fc.calls)
+}
+
+func TestRetryConnContext(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	}
+
+	// No retry if the context expires before the next attempt.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	fc := &flakyConn{fakeConn: &fakeConn{}, failures: 5, err: NewError(Timeout, "path")}
+	conn := NewRetryConn("cell", fc, policy)
+	_, _, err := conn.Get(ctx, "path")
+	assert.True(t, IsErrType(err, Timeout), "unexpected error: %v", err)
+	assert.Equal(t, 1, fc.calls)
+
+	// The wait stops when the context is canceled.
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	fc = &flakyConn{fakeConn: &fakeConn{}, failures: 5, err: NewError(Timeout, "path")}
+	conn = NewRetryConn("cell", fc, policy)
+	start := time.Now()
+	_, _, err = conn.Get(ctx, "path")
+	assert.True(t, IsErrType(err, Timeout), "unexpected error: %v", err)
+	assert.Less(t, time.Since(start), time.Minute)
+	assert.Equal(t, 1, fc.calls)
+}
+
+func TestParseRetryBudgets(t *testing.T) {
+	budgets, err := ParseRetryBudgets("")
+	require.NoError(t, err)
+	assert.Nil(t, budgets)
+
+	budgets, err = ParseRetryBudgets("Create=3, Lock=2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"Create": 3, "Lock": 2}, budgets)
+
+	for _, value := range []string{"Create", "Create=x", "Create=1=2"} {
+		_, err = ParseRetryBudgets(value)
+		assert.Error(t, err, fmt.Sprintf("value %q", value))
+	}
+}
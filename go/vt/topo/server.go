@@ -21,8 +21,9 @@ possibly another one to a read-only version of the global topo service),
 and one to each cell topo service.
 
 It contains the plug-in interfaces Conn, Factory and Version that topo
-implementations will use. We support Zookeeper, etcd, consul as real
-topo servers, and in-memory, tee as test and utility topo servers.
+implementations will use. We support Zookeeper, etcd, consul, MySQL,
+DynamoDB as real topo servers, and in-memory, tee as test and utility topo
+servers.
 Implementations are in sub-directories here.
 
 In tests, we do not mock this package. Instead, we just use a memorytopo.
@@ -47,6 +48,7 @@ import (
 	"flag"
 	"fmt"
 	"sync"
+	"time"
 
 	"vitess.io/vitess/go/vt/proto/topodata"
 
@@ -78,16 +80,22 @@ const (
 	SrvKeyspaceFile      = "SrvKeyspace"
 	RoutingRulesFile     = "RoutingRules"
 	ExternalClustersFile = "ExternalClusters"
+	LockHistoryFile      = "LockHistory"
+	NamedLockFile        = "NamedLock"
+	CellHeartbeatFile    = "CellHeartbeat"
 )
 
 // Path for all object types.
 const (
-	CellsPath        = "cells"
-	CellsAliasesPath = "cells_aliases"
-	KeyspacesPath    = "keyspaces"
-	ShardsPath       = "shards"
-	TabletsPath      = "tablets"
-	MetadataPath     = "metadata"
+	CellsPath          = "cells"
+	CellsAliasesPath   = "cells_aliases"
+	KeyspacesPath      = "keyspaces"
+	ShardsPath         = "shards"
+	TabletsPath        = "tablets"
+	MetadataPath       = "metadata"
+	LockHistoryPath    = "lock_history"
+	NamedLocksPath     = "named_locks"
+	CellHeartbeatsPath = "cell_heartbeats"
 
 	ExternalClusterMySQL  = "mysql"
 	ExternalClusterVitess = "vitess"
@@ -136,12 +144,28 @@ type Server struct {
 
 	// mu protects the following fields.
 	mu sync.Mutex
+	// readCacheMaxStaleness and readCacheMaxEntries are the
+	// maxStaleness and the maxEntries of the CachingConn of each
+	// connection, if readCacheMaxStaleness is non-zero. See
+	// EnableReadCache.
+	readCacheMaxStaleness time.Duration
+	readCacheMaxEntries   int
+	// readOnly makes all the connections read-only, including the
+	// ones created later. See SetReadOnly.
+	readOnly bool
+	// retrier has the RetryPolicy of the RetryConn of each
+	// connection, if set. See SetRetryPolicy.
+	retrier *retrier
 	// cellConns contains clients configured to talk to a list of
 	// topo instances representing local topo clusters. These
 	// should be accessed with the ConnForCell() method, which
 	// will read the list of addresses for that cell from the
 	// global cluster and create clients as needed.
 	cellConns map[string]cellConn
+
+	// migration is the online migration of the Server, nil if it is
+	// not migrating. It is set at construction time.
+	migration *topoMigration
 }
 
 type cellConn struct {
@@ -167,6 +191,26 @@ var (
 	// server.
 	topoGlobalRoot = flag.String("topo_global_root", "", "the path of the global topology data in the global topology server")
 
+	// topoReadCacheMaxStaleness enables the read cache of the
+	// topology server, see Server.EnableReadCache.
+	topoReadCacheMaxStaleness = flag.Duration("topo_read_cache_max_staleness", 0, "if non-zero, serve the keyspace, shard and tablet records from a cache kept up to date by watches, and read again a cached record that didn't change for this long")
+
+	// topoReadCacheMaxEntries bounds the read cache of the topology
+	// server, see Server.EnableReadCache.
+	topoReadCacheMaxEntries = flag.Int("topo_read_cache_max_entries", 10000, "the maximum number of records in the topology read cache of each cell, beyond which the least recently read record and its watch are dropped, 0 for no limit")
+
+	// topoReadOnly makes the topology server read-only, see
+	// Server.SetReadOnly.
+	topoReadOnly = flag.Bool("topo_read_only", false, "if true, reject all the writes and locks on the topology server, with a ReadOnly error")
+
+	// topoRetryMaxAttempts, topoRetryInitialBackoff, topoRetryMaxBackoff
+	// and topoRetryBudgets configure the RetryPolicy of the topology
+	// server, see Server.SetRetryPolicy.
+	topoRetryMaxAttempts    = flag.Int("topo_retry_max_attempts", 1, "number of attempts of the topology server reads that fail with a transient error, like a timeout, including the first one. The reads are not retried if 1.")
+	topoRetryInitialBackoff = flag.Duration("topo_retry_initial_backoff", 100*time.Millisecond, "delay before the first retry of a topology server operation. It doubles at each retry, up to topo_retry_max_backoff.")
+	topoRetryMaxBackoff     = flag.Duration("topo_retry_max_backoff", 5*time.Second, "maximum delay between two attempts of a topology server operation")
+	topoRetryBudgets        = flag.String("topo_retry_budgets", "", "number of attempts of some topology server operations, overriding topo_retry_max_attempts, as a comma-separated list of Operation=attempts, e.g. Create=3,Lock=2. The writes and locks are only retried if they are listed.")
+
 	// factories has the factories for the Conn objects.
 	factories = make(map[string]Factory)
 
@@ -236,6 +280,32 @@ func Open() *Server {
 	if err != nil {
 		log.Exitf("Failed to open topo server (%v,%v,%v): %v", *topoImplementation, *topoGlobalServerAddress, *topoGlobalRoot, err)
 	}
+	if *topoMigrationImplementation != "" {
+		ts, err = openMigrationServer(ts)
+		if err != nil {
+			log.Exitf("Failed to open topo server migration to (%v,%v,%v): %v", *topoMigrationImplementation, *topoMigrationGlobalServerAddress, *topoMigrationGlobalRoot, err)
+		}
+	}
+	if *topoRetryMaxAttempts > 1 || *topoRetryBudgets != "" {
+		budgets, err := ParseRetryBudgets(*topoRetryBudgets)
+		if err != nil {
+			log.Exitf("Invalid topo_retry_budgets: %v", err)
+		}
+		ts.SetRetryPolicy(RetryPolicy{
+			MaxAttempts:    *topoRetryMaxAttempts,
+			InitialBackoff: *topoRetryInitialBackoff,
+			MaxBackoff:     *topoRetryMaxBackoff,
+			Budgets:        budgets,
+		})
+	}
+	if *topoReadCacheMaxStaleness > 0 {
+		ts.EnableReadCache(*topoReadCacheMaxStaleness, *topoReadCacheMaxEntries)
+	}
+	if *topoReadOnly {
+		if err := ts.SetReadOnly(true); err != nil {
+			log.Exitf("Failed to make topo server read-only: %v", err)
+		}
+	}
 	return ts
 }
 
@@ -281,7 +351,15 @@ func (ts *Server) ConnForCell(ctx context.Context, cell string) (Conn, error) {
 	conn, err := ts.factory.Create(cell, ci.ServerAddress, ci.Root)
 	switch {
 	case err == nil:
-		conn = NewStatsConn(cell, conn)
+		if ts.retrier != nil {
+			conn = newRetryConn(cell, conn, ts.retrier)
+		}
+		if ts.readCacheMaxStaleness > 0 {
+			conn = NewCachingConn(cell, conn, ts.readCacheMaxStaleness, ts.readCacheMaxEntries)
+		}
+		statsConn := NewStatsConn(cell, conn)
+		statsConn.SetReadOnly(ts.readOnly)
+		conn = statsConn
 		ts.cellConns[cell] = cellConn{ci, conn}
 		return conn, nil
 	case IsErrType(err, NoNode):
@@ -292,6 +370,101 @@ func (ts *Server) ConnForCell(ctx context.Context, cell string) (Conn, error) {
 	}
 }
 
+// EnableReadCache makes the Server serve GetKeyspace, GetShard and
+// GetTablet from memory, see CachingConn: a record is kept up to date by
+// a watch after its first read, and read again if it didn't change for
+// maxStaleness. At most maxEntries records are cached per cell, if it's
+// non-zero. It is meant to be called before the Server is used, but
+// the connections are wrapped safely if they are already in use.
+func (ts *Server) EnableReadCache(maxStaleness time.Duration, maxEntries int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.readCacheMaxStaleness = maxStaleness
+	ts.readCacheMaxEntries = maxEntries
+
+	ts.wrapConnsLocked(func(cell string, conn Conn) Conn {
+		return newCachingStatsConn(cell, conn, maxStaleness, maxEntries)
+	})
+}
+
+// newCachingStatsConn inserts a CachingConn under the StatsConn of a
+// connection, so the reads served from memory are still recorded. The
+// StatsConn itself is kept, so the callers already holding it use the
+// cache too.
+func newCachingStatsConn(cell string, conn Conn, maxStaleness time.Duration, maxEntries int) Conn {
+	st, ok := conn.(*StatsConn)
+	if !ok {
+		return NewCachingConn(cell, conn, maxStaleness, maxEntries)
+	}
+	st.wrapConn(func(conn Conn) Conn {
+		return NewCachingConn(cell, conn, maxStaleness, maxEntries)
+	})
+	return st
+}
+
+// SetRetryPolicy makes the Server retry the operations that fail with
+// a transient error according to policy, on all its connections,
+// including the ones created later. It can be called again to change
+// the policy.
+func (ts *Server) SetRetryPolicy(policy RetryPolicy) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.retrier != nil {
+		ts.retrier.set(policy)
+		return
+	}
+	ts.retrier = &retrier{policy: policy}
+
+	ts.wrapConnsLocked(func(cell string, conn Conn) Conn {
+		return newRetryStatsConn(cell, conn, ts.retrier)
+	})
+}
+
+// wrapConnsLocked wraps all the connections of the Server with wrap.
+// The StatsConn connections are wrapped in place, since they may be in
+// use, so only the other ones are replaced. ts.mu must be held.
+func (ts *Server) wrapConnsLocked(wrap func(cell string, conn Conn) Conn) {
+	readOnlyIsGlobal := ts.globalReadOnlyCell == ts.globalCell
+	if conn := wrap(GlobalCell, ts.globalCell); conn != ts.globalCell {
+		ts.globalCell = conn
+		if readOnlyIsGlobal {
+			ts.globalReadOnlyCell = conn
+		}
+	}
+	if !readOnlyIsGlobal {
+		if conn := wrap(GlobalReadOnlyCell, ts.globalReadOnlyCell); conn != ts.globalReadOnlyCell {
+			ts.globalReadOnlyCell = conn
+		}
+	}
+	for cell, cc := range ts.cellConns {
+		if conn := wrap(cell, cc.conn); conn != cc.conn {
+			cc.conn = conn
+			ts.cellConns[cell] = cc
+		}
+	}
+}
+
+// newRetryStatsConn inserts a RetryConn under the StatsConn and the
+// CachingConn of a connection, so the stats include the retries, and
+// only the reads that miss the cache are retried. Like with
+// newCachingStatsConn, the StatsConn is kept.
+func newRetryStatsConn(cell string, conn Conn, r *retrier) Conn {
+	st, ok := conn.(*StatsConn)
+	if !ok {
+		return newRetryConn(cell, conn, r)
+	}
+	st.wrapConn(func(conn Conn) Conn {
+		if cc, ok := conn.(*CachingConn); ok {
+			cc.wrapConn(func(conn Conn) Conn {
+				return newRetryConn(cell, conn, r)
+			})
+			return cc
+		}
+		return newRetryConn(cell, conn, r)
+	})
+	return st
+}
+
 // GetAliasByCell returns the alias group this `cell` belongs to, if there's none, it returns the `cell` as alias.
 func GetAliasByCell(ctx context.Context, ts *Server, cell string) string {
 	cellsAliases.mu.Lock()
@@ -363,27 +536,41 @@ func (ts *Server) OpenExternalVitessClusterServer(ctx context.Context, clusterNa
 	return externalTopo, nil
 }
 
-// SetReadOnly is initially ONLY implemented by StatsConn and used in ReadOnlyServer
+// SetReadOnly with true makes the Server read-only: all the writes and
+// locks, on all the connections including the ones created later, fail
+// with a ReadOnly error. It is implemented by StatsConn, so it is not
+// supported by a Server created with NewWithFactory from a Conn of
+// another type. It is used by ReadOnlyServer, and by the topo_read_only
+// flag.
 func (ts *Server) SetReadOnly(readOnly bool) error {
-	globalCellConn, ok := ts.globalCell.(*StatsConn)
-	if !ok {
-		return fmt.Errorf("invalid global cell connection type, expected StatsConn but found: %T", ts.globalCell)
-	}
-	globalCellConn.SetReadOnly(readOnly)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
 
+	conns := []Conn{ts.globalCell, ts.globalReadOnlyCell}
 	for _, cc := range ts.cellConns {
-		localCellConn, ok := cc.conn.(*StatsConn)
+		conns = append(conns, cc.conn)
+	}
+	statsConns := make([]*StatsConn, len(conns))
+	for i, conn := range conns {
+		statsConn, ok := conn.(*StatsConn)
 		if !ok {
-			return fmt.Errorf("invalid local cell connection type, expected StatsConn but found: %T", cc.conn)
+			return fmt.Errorf("invalid cell connection type, expected StatsConn but found: %T", conn)
 		}
-		localCellConn.SetReadOnly(true)
+		statsConns[i] = statsConn
 	}
 
+	ts.readOnly = readOnly
+	for _, statsConn := range statsConns {
+		statsConn.SetReadOnly(readOnly)
+	}
 	return nil
 }
 
 // IsReadOnly is initially ONLY implemented by StatsConn and used in ReadOnlyServer
 func (ts *Server) IsReadOnly() (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	globalCellConn, ok := ts.globalCell.(*StatsConn)
 	if !ok {
 		return false, fmt.Errorf("invalid global cell connection type, expected StatsConn but found: %T", ts.globalCell)
@@ -35,7 +35,6 @@ import (
 
 	"vitess.io/vitess/go/event"
 	"vitess.io/vitess/go/trace"
-	"vitess.io/vitess/go/vt/concurrency"
 	"vitess.io/vitess/go/vt/key"
 	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/topo/events"
@@ -220,6 +219,84 @@ func (ts *Server) GetShard(ctx context.Context, keyspace, shard string) (*ShardI
 	}, nil
 }
 
+// GetShards returns all the shards of a keyspace, indexed by shard
+// name. It reads all the shard records with a single List call; if
+// the topo implementation does not support it, it falls back to
+// reading the shards one by one.
+// It returns ErrNoNode if the keyspace doesn't exist.
+func (ts *Server) GetShards(ctx context.Context, keyspace string) (map[string]*ShardInfo, error) {
+	span, ctx := trace.NewSpan(ctx, "TopoServer.GetShards")
+	span.Annotate("keyspace", keyspace)
+	defer span.Finish()
+
+	shardsPath := path.Join(KeyspacesPath, keyspace, ShardsPath)
+	listResults, err := ts.globalCell.List(ctx, shardsPath+"/")
+	switch {
+	case IsErrType(err, NoImplementation):
+		return ts.GetShardsIndividually(ctx, keyspace)
+	case IsErrType(err, NoNode):
+		// No shard at all, let's see if the keyspace is here or not.
+		if _, kerr := ts.GetKeyspace(ctx, keyspace); kerr != nil {
+			return nil, kerr
+		}
+		return map[string]*ShardInfo{}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	result := make(map[string]*ShardInfo, len(listResults))
+	for _, kv := range listResults {
+		// The keys may be prefixed with the root of the topo, and the
+		// shard directories can hold other files than the records.
+		key := string(kv.Key)
+		i := strings.LastIndex(key, shardsPath+"/")
+		if i < 0 {
+			continue
+		}
+		parts := strings.Split(key[i+len(shardsPath)+1:], "/")
+		if len(parts) != 2 || parts[1] != ShardFile {
+			continue
+		}
+
+		value := &topodatapb.Shard{}
+		if err := proto.Unmarshal(kv.Value, value); err != nil {
+			return nil, vterrors.Wrapf(err, "GetShards(%v): bad shard data for %v", keyspace, parts[0])
+		}
+		result[parts[0]] = &ShardInfo{
+			keyspace:  keyspace,
+			shardName: parts[0],
+			version:   kv.Version,
+			Shard:     value,
+		}
+	}
+	return result, nil
+}
+
+// GetShardsIndividually returns all the shards of a keyspace, indexed
+// by shard name, reading them one by one. It is used for topo servers
+// that do not support the Conn.List() functionality.
+// It returns ErrNoNode if the keyspace doesn't exist.
+func (ts *Server) GetShardsIndividually(ctx context.Context, keyspace string) (map[string]*ShardInfo, error) {
+	shards, err := ts.GetShardNames(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*ShardInfo, len(shards))
+	for _, shard := range shards {
+		si, err := ts.GetShard(ctx, keyspace, shard)
+		if err != nil {
+			if IsErrType(err, NoNode) {
+				log.Warningf("GetShard(%v, %v) returned ErrNoNode, consider checking the topology.", keyspace, shard)
+			} else {
+				return nil, vterrors.Wrapf(err, "GetShard(%v, %v) failed", keyspace, shard)
+			}
+		}
+		result[shard] = si
+	}
+	return result, nil
+}
+
 // updateShard updates the shard data, with the right version.
 // It also creates a span, and dispatches the event.
 func (ts *Server) updateShard(ctx context.Context, si *ShardInfo) error {
@@ -258,20 +335,33 @@ func (ts *Server) updateShard(ctx context.Context, si *ShardInfo) error {
 // Note the callback method takes a ShardInfo, so it can get the
 // keyspace and shard from it, or use all the ShardInfo methods.
 func (ts *Server) UpdateShardFields(ctx context.Context, keyspace, shard string, update func(*ShardInfo) error) (*ShardInfo, error) {
+	si, err := ts.GetShard(ctx, keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	return ts.UpdateShardFieldsFrom(ctx, si, update)
+}
+
+// UpdateShardFieldsFrom is like UpdateShardFields, but it calls the
+// update function on si first, instead of reading the shard record: it
+// only reads it again if it changed since the version of si. si can
+// come from a watch, see WatchShardData.ShardInfo. It is modified by
+// the update function.
+func (ts *Server) UpdateShardFieldsFrom(ctx context.Context, si *ShardInfo, update func(*ShardInfo) error) (*ShardInfo, error) {
 	for {
-		si, err := ts.GetShard(ctx, keyspace, shard)
-		if err != nil {
-			return nil, err
-		}
-		if err = update(si); err != nil {
+		if err := update(si); err != nil {
 			if IsErrType(err, NoUpdateNeeded) {
 				return nil, nil
 			}
 			return nil, err
 		}
-		if err = ts.updateShard(ctx, si); !IsErrType(err, BadVersion) {
+		err := ts.updateShard(ctx, si)
+		if !IsErrType(err, BadVersion) {
 			return si, err
 		}
+		if si, err = ts.GetShard(ctx, si.keyspace, si.shardName); err != nil {
+			return nil, err
+		}
 	}
 }
 
@@ -375,17 +465,222 @@ func (ts *Server) DeleteShard(ctx context.Context, keyspace, shard string) error
 	return nil
 }
 
+// SetShardDeleting sets or clears the tombstone of a shard. While it is
+// set, new tablets cannot be registered in the shard. Operators can
+// clear a tombstone left by an interrupted deletion with the
+// SetShardIsDeleting vtctl command. If the tombstone
+// is already in the requested state, nothing is written and nil,nil is
+// returned, as for UpdateShardFields.
+func (ts *Server) SetShardDeleting(ctx context.Context, keyspace, shard string, deleting bool) (*ShardInfo, error) {
+	return ts.UpdateShardFields(ctx, keyspace, shard, func(si *ShardInfo) error {
+		if si.IsDeleting == deleting {
+			return NewError(NoUpdateNeeded, si.keyspace+"/"+si.shardName)
+		}
+		si.IsDeleting = deleting
+		return nil
+	})
+}
+
+// CheckNotDeleting returns an error if the shard is being deleted, in
+// which case no new tablet should be registered in it.
+func (si *ShardInfo) CheckNotDeleting() error {
+	if si.IsDeleting {
+		return vterrors.Errorf(vtrpc.Code_FAILED_PRECONDITION, "shard %v/%v is being deleted", si.keyspace, si.shardName)
+	}
+	return nil
+}
+
+// DeleteShardWithTombstone deletes a shard in two phases. It first
+// removes, in each cell, the ShardReplication entries of the tablets
+// that do not exist anymore or are in another shard. If tablets of the
+// shard remain, or a cell can't be read, it fails and leaves the shard
+// as it was, unless force is set: then the remaining tablets and the
+// cells that can't be reached are only logged. Then it marks the shard
+// as being deleted, so no new tablet can be registered in it, and
+// deletes the ShardReplication objects and the shard record. If the
+// deletion fails after the shard was marked, the mark is cleared, and
+// calling it again resumes the deletion.
+func (ts *Server) DeleteShardWithTombstone(ctx context.Context, keyspace, shard string, force bool) (err error) {
+	cells, err := ts.GetCellInfoNames(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ts.checkShardHasNoTablets(ctx, cells, keyspace, shard, force); err != nil {
+		return err
+	}
+
+	// Only mark the shard once we know we will delete it, so a
+	// refused deletion doesn't leave the mark behind.
+	if _, err := ts.SetShardDeleting(ctx, keyspace, shard, true); err != nil && !IsErrType(err, NoNode) {
+		// If there is no shard record, we still clean up the
+		// replication graph.
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if _, clearErr := ts.SetShardDeleting(ctx, keyspace, shard, false); clearErr != nil && !IsErrType(clearErr, NoNode) {
+			log.Warningf("Cannot clear the deleting mark of shard %v/%v: %v", keyspace, shard, clearErr)
+		}
+	}()
+
+	// A tablet may have been registered before the shard was marked.
+	if !force {
+		if err := ts.checkShardHasNoTablets(ctx, cells, keyspace, shard, false); err != nil {
+			return err
+		}
+	}
+
+	for _, cell := range cells {
+		if err := ts.DeleteShardReplication(ctx, cell, keyspace, shard); err != nil && !IsErrType(err, NoNode) {
+			if !force {
+				return err
+			}
+			log.Warningf("Cannot delete ShardReplication in cell %v for %v/%v: %v", cell, keyspace, shard, err)
+		}
+	}
+	if err := ts.DeleteShard(ctx, keyspace, shard); err != nil && !IsErrType(err, NoNode) {
+		return err
+	}
+	return nil
+}
+
+// checkShardHasNoTablets cleans up the replication graph of a shard in
+// the given cells with collectShardReplication, and returns an error
+// if tablets of the shard remain or if a cell can't be read, unless
+// force is set.
+func (ts *Server) checkShardHasNoTablets(ctx context.Context, cells []string, keyspace, shard string, force bool) error {
+	for _, cell := range cells {
+		tablets, err := ts.collectShardReplication(ctx, cell, keyspace, shard)
+		if err != nil {
+			if !force {
+				return vterrors.Wrapf(err, "cannot clean up the replication graph of shard %v/%v in cell %v", keyspace, shard, cell)
+			}
+			log.Warningf("Cannot clean up the replication graph of shard %v/%v in cell %v, deleting it anyway: %v", keyspace, shard, cell, err)
+			continue
+		}
+		if len(tablets) > 0 {
+			if !force {
+				return vterrors.Errorf(vtrpc.Code_FAILED_PRECONDITION, "shard %v/%v still has %v tablets in cell %v; delete them first, or use force", keyspace, shard, len(tablets), cell)
+			}
+			log.Warningf("Deleting shard %v/%v even though it still has %v tablets in cell %v", keyspace, shard, len(tablets), cell)
+		}
+	}
+	return nil
+}
+
+// collectShardReplication removes the entries of the ShardReplication
+// object of a cell whose tablet does not exist anymore, or is in
+// another shard or cell. It returns the aliases of the other tablets.
+func (ts *Server) collectShardReplication(ctx context.Context, cell, keyspace, shard string) ([]*topodatapb.TabletAlias, error) {
+	sri, err := ts.GetShardReplication(ctx, cell, keyspace, shard)
+	if IsErrType(err, NoNode) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tablets []*topodatapb.TabletAlias
+	for _, node := range sri.Nodes {
+		ti, err := ts.GetTablet(ctx, node.TabletAlias)
+		switch {
+		case IsErrType(err, NoNode):
+		case err != nil:
+			return nil, err
+		case ti.Keyspace == keyspace && ti.Shard == shard && ti.Alias.Cell == cell:
+			tablets = append(tablets, node.TabletAlias)
+			continue
+		}
+		log.Infof("Removing stale tablet %v from the replication graph of shard %v/%v in cell %v", topoproto.TabletAliasString(node.TabletAlias), keyspace, shard, cell)
+		if err := RemoveShardReplicationRecord(ctx, ts, cell, keyspace, shard, node.TabletAlias); err != nil {
+			return nil, err
+		}
+	}
+	return tablets, nil
+}
+
 // GetTabletControl returns the Shard_TabletControl for the given tablet type,
-// or nil if it is not in the map.
+// or nil if it is not in the map. Expired records are ignored.
 func (si *ShardInfo) GetTabletControl(tabletType topodatapb.TabletType) *topodatapb.Shard_TabletControl {
+	now := time.Now()
 	for _, tc := range si.TabletControls {
-		if tc.TabletType == tabletType {
+		if tc.TabletType == tabletType && !IsTabletControlExpired(tc, now) {
 			return tc
 		}
 	}
 	return nil
 }
 
+// IsTabletControlExpired returns true if the Shard_TabletControl has
+// an expire time that is not after now. Expired records should be
+// ignored, as if they were not in the shard record. A frozen record
+// never expires, as a migration went past the point of no return.
+func IsTabletControlExpired(tc *topodatapb.Shard_TabletControl, now time.Time) bool {
+	return !tc.Frozen && tc.ExpireTime != nil && !logutil.ProtoToTime(tc.ExpireTime).After(now)
+}
+
+// SetTabletControlExpireTime sets the time after which the
+// Shard_TabletControl for the given tablet type is ignored. A zero
+// time clears the expire time.
+//
+// This function should be called while holding the keyspace lock.
+func (si *ShardInfo) SetTabletControlExpireTime(ctx context.Context, tabletType topodatapb.TabletType, expireTime time.Time) error {
+	if err := CheckKeyspaceLocked(ctx, si.keyspace); err != nil {
+		return err
+	}
+	tc := si.GetTabletControl(tabletType)
+	if tc == nil {
+		return vterrors.Errorf(vtrpc.Code_NOT_FOUND, "no TabletControl for type %v in shard %v/%v", tabletType, si.keyspace, si.shardName)
+	}
+	if expireTime.IsZero() {
+		tc.ExpireTime = nil
+		return nil
+	}
+	if tc.Frozen {
+		return vterrors.Errorf(vtrpc.Code_FAILED_PRECONDITION, "TabletControl for type %v in shard %v/%v is frozen, it cannot expire", tabletType, si.keyspace, si.shardName)
+	}
+	tc.ExpireTime = logutil.TimeToProto(expireTime)
+	return nil
+}
+
+// RemoveExpiredTabletControls removes the Shard_TabletControl records
+// that are expired at the given time. It returns true if any record
+// was removed.
+func (si *ShardInfo) RemoveExpiredTabletControls(now time.Time) bool {
+	var tabletControls []*topodatapb.Shard_TabletControl
+	for _, tc := range si.TabletControls {
+		if IsTabletControlExpired(tc, now) {
+			log.Infof("Removing expired TabletControl for type %v in shard %v/%v", tc.TabletType, si.keyspace, si.shardName)
+			continue
+		}
+		tabletControls = append(tabletControls, tc)
+	}
+	if len(tabletControls) == len(si.TabletControls) {
+		return false
+	}
+	si.TabletControls = tabletControls
+	return true
+}
+
+// RemoveExpiredTabletControls removes the expired Shard_TabletControl
+// records of a shard. If there are none, nothing is written and nil,nil
+// is returned, as for UpdateShardFields.
+//
+// This function should be called while holding the keyspace lock.
+func (ts *Server) RemoveExpiredTabletControls(ctx context.Context, keyspace, shard string) (*ShardInfo, error) {
+	if err := CheckKeyspaceLocked(ctx, keyspace); err != nil {
+		return nil, err
+	}
+	return ts.UpdateShardFields(ctx, keyspace, shard, func(si *ShardInfo) error {
+		if !si.RemoveExpiredTabletControls(time.Now()) {
+			return NewError(NoUpdateNeeded, si.keyspace+"/"+si.shardName)
+		}
+		return nil
+	})
+}
+
 // UpdateSourceDeniedTables will add or remove the listed tables
 // in the shard record's TabletControl structures. Note we don't
 // support a lot of the corner cases:
@@ -402,6 +697,8 @@ func (si *ShardInfo) UpdateSourceDeniedTables(ctx context.Context, tabletType to
 	if tabletType == topodatapb.TabletType_PRIMARY && len(cells) > 0 {
 		return fmt.Errorf(dlNoCellsForPrimary)
 	}
+	// An expired record would otherwise be left next to the new one.
+	si.RemoveExpiredTabletControls(time.Now())
 	tc := si.GetTabletControl(tabletType)
 	if tc == nil {
 
@@ -530,7 +827,8 @@ func InCellList(cell string, cells []string) bool {
 // tablet aliases in the given shard.
 //
 // It can return ErrPartialResult if some cells were not fetched,
-// in which case the result only contains the cells that were fetched.
+// in which case the result only contains the cells that were fetched,
+// and the error is a *PartialResultError listing the failed cells.
 //
 // The tablet aliases are sorted by cell, then by UID.
 func (ts *Server) FindAllTabletAliasesInShard(ctx context.Context, keyspace, shard string) ([]*topodatapb.TabletAlias, error) {
@@ -541,7 +839,8 @@ func (ts *Server) FindAllTabletAliasesInShard(ctx context.Context, keyspace, sha
 // tablet aliases in the given shard.
 //
 // It can return ErrPartialResult if some cells were not fetched,
-// in which case the result only contains the cells that were fetched.
+// in which case the result only contains the cells that were fetched,
+// and the error is a *PartialResultError listing the failed cells.
 //
 // The tablet aliases are sorted by cell, then by UID.
 func (ts *Server) FindAllTabletAliasesInShardByCell(ctx context.Context, keyspace, shard string, cells []string) ([]*topodatapb.TabletAlias, error) {
@@ -577,7 +876,7 @@ func (ts *Server) FindAllTabletAliasesInShardByCell(ctx context.Context, keyspac
 	// read the replication graph in each cell and add all found tablets
 	wg := sync.WaitGroup{}
 	mutex := sync.Mutex{}
-	rec := concurrency.AllErrorRecorder{}
+	failedCells := make(map[string]error)
 	result := make([]*topodatapb.TabletAlias, 0, len(resultAsMap))
 	for _, cell := range cells {
 		wg.Add(1)
@@ -594,16 +893,18 @@ func (ts *Server) FindAllTabletAliasesInShardByCell(ctx context.Context, keyspac
 			case IsErrType(err, NoNode):
 				// There is no shard replication for this shard in this cell. NOOP
 			default:
-				rec.RecordError(vterrors.Wrap(err, fmt.Sprintf("GetShardReplication(%v, %v, %v) failed.", cell, keyspace, shard)))
+				mutex.Lock()
+				failedCells[cell] = vterrors.Wrap(err, fmt.Sprintf("GetShardReplication(%v, %v, %v) failed.", cell, keyspace, shard))
+				mutex.Unlock()
 				return
 			}
 		}(cell)
 	}
 	wg.Wait()
 	err = nil
-	if rec.HasErrors() {
-		log.Warningf("FindAllTabletAliasesInShard(%v,%v): got partial result: %v", keyspace, shard, rec.Error())
-		err = NewError(PartialResult, shard)
+	if len(failedCells) > 0 {
+		err = &PartialResultError{Node: shard, FailedCells: failedCells}
+		log.Warningf("FindAllTabletAliasesInShard(%v,%v): got %v", keyspace, shard, err)
 	}
 
 	for _, a := range resultAsMap {
@@ -624,6 +925,7 @@ func (ts *Server) GetTabletMapForShard(ctx context.Context, keyspace, shard stri
 // GetTabletMapForShardByCell returns the tablets for a shard. It can return
 // ErrPartialResult if it couldn't read all the cells, or all
 // the individual tablets, in which case the map is valid, but partial.
+// If some cells could not be read, the error is a *PartialResultError.
 // The map is indexed by topoproto.TabletAliasString(tablet alias).
 func (ts *Server) GetTabletMapForShardByCell(ctx context.Context, keyspace, shard string, cells []string) (map[string]*TabletInfo, error) {
 	// if we get a partial result, we keep going. It most likely means
@@ -634,9 +936,10 @@ func (ts *Server) GetTabletMapForShardByCell(ctx context.Context, keyspace, shar
 	}
 
 	// get the tablets for the cells we were able to reach, forward
-	// ErrPartialResult from FindAllTabletAliasesInShard
+	// ErrPartialResult from FindAllTabletAliasesInShard, as it says
+	// which cells failed
 	result, gerr := ts.GetTabletMap(ctx, aliases)
-	if gerr == nil && err != nil {
+	if err != nil && (gerr == nil || IsErrType(gerr, PartialResult)) {
 		gerr = err
 	}
 	return result, gerr
@@ -648,15 +951,36 @@ func shardFilePath(keyspace, shard string) string {
 
 // WatchShardData wraps the data we receive on the watch channel
 // The WatchShard API guarantees exactly one of Value or Err will be set.
+// Version is the version of Value, from which the revision of the
+// backend can be read with String: it can be passed to WatchShardFrom
+// to resume the watch if it fails, and it is the version of the
+// ShardInfo returned by ShardInfo, to update the shard only if it
+// didn't change since.
 type WatchShardData struct {
-	Value *topodatapb.Shard
-	Err   error
+	Value   *topodatapb.Shard
+	Version Version
+	Err     error
+
+	// keyspace and shard identify the watched shard.
+	keyspace string
+	shard    string
+}
+
+// ShardInfo returns a ShardInfo with a copy of Value and its Version,
+// or nil if Err is set. Passing it to UpdateShardFieldsFrom updates the
+// shard without reading it again, unless it changed since.
+func (wd *WatchShardData) ShardInfo() *ShardInfo {
+	if wd.Err != nil || wd.Value == nil {
+		return nil
+	}
+	return NewShardInfo(wd.keyspace, wd.shard, proto.Clone(wd.Value).(*topodatapb.Shard), wd.Version)
 }
 
 // WatchShard will set a watch on the Shard object.
 // It has the same contract as conn.Watch, but it also unpacks the
-// contents into a Shard object
-func (ts *Server) WatchShard(ctx context.Context, keyspace, shard string) (*WatchShardData, <-chan *WatchShardData, error) {
+// contents into a Shard object. The opts configure how the changes are
+// buffered if the consumer is slow, see WatchOption.
+func (ts *Server) WatchShard(ctx context.Context, keyspace, shard string, opts ...WatchOption) (*WatchShardData, <-chan *WatchShardData, error) {
 	shardPath := shardFilePath(keyspace, shard)
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -674,7 +998,31 @@ func (ts *Server) WatchShard(ctx context.Context, keyspace, shard string) (*Watc
 		return nil, nil, vterrors.Wrapf(err, "error unpacking initial Shard object")
 	}
 
-	changes := make(chan *WatchShardData, 10)
+	return &WatchShardData{Value: value, Version: current.Version, keyspace: keyspace, shard: shard}, watchShardChanges(cancel, keyspace, shard, wdChannel, newWatchOptions(opts)), nil
+}
+
+// WatchShardFrom resumes a watch of the Shard object, for instance after
+// the channel of WatchShard returned an error, without reading the
+// Shard object again. version is the Version of the last value received.
+// It has the same contract as conn.WatchFrom: the changes that happened
+// after version, if any, are sent first.
+func (ts *Server) WatchShardFrom(ctx context.Context, keyspace, shard string, version Version, opts ...WatchOption) (<-chan *WatchShardData, error) {
+	shardPath := shardFilePath(keyspace, shard)
+	ctx, cancel := context.WithCancel(ctx)
+
+	wdChannel, err := ts.globalCell.WatchFrom(ctx, shardPath, version)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return watchShardChanges(cancel, keyspace, shard, wdChannel, newWatchOptions(opts)), nil
+}
+
+// watchShardChanges translates the changes of a watch of a Shard object.
+// cancel cancels the watch, and o buffers its changes.
+func watchShardChanges(cancel context.CancelFunc, keyspace, shard string, wdChannel <-chan *WatchData, o *watchOptions) <-chan *WatchShardData {
+	wdChannel = bufferWatch(wdChannel, o, "Shard")
+	changes := make(chan *WatchShardData, o.channelSize())
 	// The background routine reads any event from the watch channel,
 	// translates it, and sends it to the caller.
 	// If cancel() is called, the underlying Watch() code will
@@ -702,9 +1050,8 @@ func (ts *Server) WatchShard(ctx context.Context, keyspace, shard string) (*Watc
 				return
 			}
 
-			changes <- &WatchShardData{Value: value}
+			changes <- &WatchShardData{Value: value, Version: wd.Version, keyspace: keyspace, shard: shard}
 		}
 	}()
-
-	return &WatchShardData{Value: value}, changes, nil
+	return changes
 }
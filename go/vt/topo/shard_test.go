@@ -19,11 +19,15 @@ package topo
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"context"
 
+	"vitess.io/vitess/go/vt/logutil"
+
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 )
 
@@ -59,6 +63,18 @@ func TestAddCells(t *testing.T) {
 	}
 }
 
+func TestValidateShardName(t *testing.T) {
+	// The bounds are compared byte-wise: 8000 is after 80.
+	for _, shard := range []string{"0", "-80", "80-", "80-8000", "C0-E0"} {
+		_, _, err := ValidateShardName(shard)
+		assert.NoError(t, err, shard)
+	}
+	for _, shard := range []string{"80-40", "80-80", "8000-80", "a-b-c"} {
+		_, _, err := ValidateShardName(shard)
+		assert.Error(t, err, shard)
+	}
+}
+
 func TestRemoveCellsFromList(t *testing.T) {
 	var cells []string
 	allCells := []string{"first", "second", "third"}
@@ -222,3 +238,63 @@ func TestUpdateSourceDeniedTables(t *testing.T) {
 		t.Fatalf("one cell removal from all failed: %v", si)
 	}
 }
+
+func TestExpiredTabletControls(t *testing.T) {
+	now := time.Now()
+	si := NewShardInfo("ks", "sh", &topodatapb.Shard{
+		TabletControls: []*topodatapb.Shard_TabletControl{{
+			TabletType:   topodatapb.TabletType_RDONLY,
+			DeniedTables: []string{"t1"},
+			ExpireTime:   logutil.TimeToProto(now.Add(-time.Minute)),
+		}, {
+			TabletType:   topodatapb.TabletType_REPLICA,
+			DeniedTables: []string{"t2"},
+			ExpireTime:   logutil.TimeToProto(now.Add(time.Hour)),
+		}, {
+			TabletType:   topodatapb.TabletType_PRIMARY,
+			DeniedTables: []string{"t3"},
+		}},
+	}, nil)
+
+	assert.True(t, IsTabletControlExpired(si.TabletControls[0], now))
+	assert.False(t, IsTabletControlExpired(si.TabletControls[1], now))
+	assert.False(t, IsTabletControlExpired(si.TabletControls[2], now))
+	assert.True(t, IsTabletControlExpired(si.TabletControls[1], now.Add(2*time.Hour)))
+
+	// The expired record is ignored.
+	assert.Nil(t, si.GetTabletControl(topodatapb.TabletType_RDONLY))
+	assert.NotNil(t, si.GetTabletControl(topodatapb.TabletType_REPLICA))
+
+	// Adding a record for the type of an expired one replaces it.
+	ctx := lockedKeyspaceContext("ks")
+	require.NoError(t, si.UpdateSourceDeniedTables(ctx, topodatapb.TabletType_RDONLY, []string{"first"}, false, []string{"t4"}))
+	require.Len(t, si.TabletControls, 3)
+	tc := si.GetTabletControl(topodatapb.TabletType_RDONLY)
+	require.NotNil(t, tc)
+	assert.Equal(t, []string{"t4"}, tc.DeniedTables)
+	assert.Nil(t, tc.ExpireTime)
+
+	// Set and clear an expire time.
+	require.NoError(t, si.SetTabletControlExpireTime(ctx, topodatapb.TabletType_PRIMARY, now.Add(-time.Second)))
+	assert.Nil(t, si.GetTabletControl(topodatapb.TabletType_PRIMARY))
+	assert.Error(t, si.SetTabletControlExpireTime(ctx, topodatapb.TabletType_PRIMARY, time.Time{}))
+	require.NoError(t, si.SetTabletControlExpireTime(ctx, topodatapb.TabletType_REPLICA, time.Time{}))
+	assert.Nil(t, si.GetTabletControl(topodatapb.TabletType_REPLICA).ExpireTime)
+
+	assert.True(t, si.RemoveExpiredTabletControls(now))
+	assert.False(t, si.RemoveExpiredTabletControls(now))
+	require.Len(t, si.TabletControls, 2)
+	assert.Nil(t, si.GetTabletControl(topodatapb.TabletType_PRIMARY))
+
+	// A frozen record never expires, and is never removed.
+	frozen := &topodatapb.Shard_TabletControl{
+		TabletType: topodatapb.TabletType_PRIMARY,
+		Frozen:     true,
+		ExpireTime: logutil.TimeToProto(now.Add(-time.Minute)),
+	}
+	si.TabletControls = append(si.TabletControls, frozen)
+	assert.False(t, IsTabletControlExpired(frozen, now))
+	assert.Equal(t, frozen, si.GetTabletControl(topodatapb.TabletType_PRIMARY))
+	assert.False(t, si.RemoveExpiredTabletControls(now))
+	assert.Error(t, si.SetTabletControlExpireTime(ctx, topodatapb.TabletType_PRIMARY, now.Add(time.Hour)))
+}
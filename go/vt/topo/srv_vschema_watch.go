@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/log"
+
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+// This file contains a watch of the SrvVSchema objects of several
+// cells, to find the cells that missed a RebuildSrvVSchema.
+
+// CellSrvVSchema is the state of the SrvVSchema of a cell, as seen by
+// a SrvVSchemaWatcher.
+type CellSrvVSchema struct {
+	// Value is the last SrvVSchema of the cell. It is nil if the
+	// cell has no SrvVSchema, or if it could not be read yet.
+	Value *vschemapb.SrvVSchema
+
+	// Err is the error of the watch of the cell, if it failed and
+	// was not restarted yet. Value is then the last known value.
+	Err error
+
+	// LastChange is when Value was received, or when the SrvVSchema
+	// was deleted.
+	LastChange time.Time
+
+	// Staleness is for how long the cell has not had the newest
+	// SrvVSchema, which is the one that was received last from any
+	// of the cells. It is 0 if the cell has the newest SrvVSchema.
+	// When the watcher starts, the cells are compared to the one
+	// that was read last.
+	Staleness time.Duration
+}
+
+// SrvVSchemaWatcher watches the SrvVSchema objects of several cells,
+// see WatchSrvVSchemaCells.
+type SrvVSchemaWatcher struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	cells map[string]*CellSrvVSchema
+}
+
+// WatchSrvVSchemaCells watches the SrvVSchema objects of the given
+// cells (all the known cells if empty), until Stop is called or ctx is
+// canceled. If the watch of a cell fails, it is restarted after
+// retryDelay.
+func (ts *Server) WatchSrvVSchemaCells(ctx context.Context, cells []string, retryDelay time.Duration) (*SrvVSchemaWatcher, error) {
+	if len(cells) == 0 {
+		var err error
+		cells, err = ts.GetKnownCells(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("GetKnownCells failed: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &SrvVSchemaWatcher{
+		cancel: cancel,
+		cells:  make(map[string]*CellSrvVSchema, len(cells)),
+	}
+	for _, cell := range cells {
+		w.cells[cell] = &CellSrvVSchema{}
+		w.wg.Add(1)
+		go func(cell string) {
+			defer w.wg.Done()
+			w.watchCell(ctx, ts, cell, retryDelay)
+		}(cell)
+	}
+	return w, nil
+}
+
+// watchCell watches the SrvVSchema of a cell until ctx is canceled.
+func (w *SrvVSchemaWatcher) watchCell(ctx context.Context, ts *Server, cell string, retryDelay time.Duration) {
+	for {
+		current, changes, err := ts.WatchSrvVSchema(ctx, cell)
+		if err == nil {
+			w.setValue(cell, current.Value)
+			for wd := range changes {
+				if wd.Err != nil {
+					err = wd.Err
+					break
+				}
+				w.setValue(cell, wd.Value)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if IsErrType(err, NoNode) {
+			// The cell has no SrvVSchema: wait for one.
+			w.setValue(cell, nil)
+		} else {
+			log.Warningf("Watch of the SrvVSchema of cell %v failed, retrying in %v: %v", cell, retryDelay, err)
+			w.setErr(cell, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// setValue records the SrvVSchema of a cell, if it changed.
+func (w *SrvVSchemaWatcher) setValue(cell string, value *vschemapb.SrvVSchema) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c := w.cells[cell]
+	c.Err = nil
+	if !c.LastChange.IsZero() && proto.Equal(c.Value, value) {
+		return
+	}
+	c.Value = value
+	c.LastChange = time.Now()
+}
+
+// setErr records the error of the watch of a cell.
+func (w *SrvVSchemaWatcher) setErr(cell string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cells[cell].Err = err
+}
+
+// Cells returns the current state of the SrvVSchema of the watched
+// cells, by cell.
+func (w *SrvVSchemaWatcher) Cells() map[string]*CellSrvVSchema {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var newest *CellSrvVSchema
+	for _, c := range w.cells {
+		if c.Value != nil && (newest == nil || c.LastChange.After(newest.LastChange)) {
+			newest = c
+		}
+	}
+
+	now := time.Now()
+	result := make(map[string]*CellSrvVSchema, len(w.cells))
+	for cell, c := range w.cells {
+		cs := *c
+		if newest != nil && (cs.LastChange.IsZero() || !proto.Equal(cs.Value, newest.Value)) {
+			cs.Staleness = now.Sub(newest.LastChange)
+		}
+		result[cell] = &cs
+	}
+	return result
+}
+
+// StaleCells returns the sorted list of the watched cells that have
+// not had the newest SrvVSchema for more than maxStaleness.
+func (w *SrvVSchemaWatcher) StaleCells(maxStaleness time.Duration) []string {
+	var result []string
+	for cell, c := range w.Cells() {
+		if c.Staleness > maxStaleness {
+			result = append(result, cell)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Stop stops the watches, and waits for them to be done.
+func (w *SrvVSchemaWatcher) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
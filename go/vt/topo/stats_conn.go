@@ -18,11 +18,12 @@ package topo
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"vitess.io/vitess/go/stats"
-	"vitess.io/vitess/go/vt/proto/vtrpc"
-	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/sync2"
 )
 
 var _ Conn = (*StatsConn)(nil)
@@ -39,30 +40,51 @@ var (
 		[]string{"Operation", "Cell"})
 )
 
-const readOnlyErrorStrFormat = "cannot perform %s on %s as the topology server connection is read-only"
+// readOnlyError returns the error of a write operation on a read-only
+// connection.
+func readOnlyError(operation, path string) error {
+	return NewError(ReadOnly, operation+" on "+path)
+}
 
 // The StatsConn is a wrapper for a Conn that emits stats for every operation
 type StatsConn struct {
 	cell     string
-	conn     Conn
-	readOnly bool
+	readOnly sync2.AtomicBool
+
+	// connMu protects conn, which Server.EnableReadCache and
+	// Server.SetRetryPolicy wrap while the connection is in use.
+	connMu sync.RWMutex
+	conn   Conn
 }
 
 // NewStatsConn returns a StatsConn
 func NewStatsConn(cell string, conn Conn) *StatsConn {
 	return &StatsConn{
-		cell:     cell,
-		conn:     conn,
-		readOnly: false,
+		cell: cell,
+		conn: conn,
 	}
 }
 
+// underlying returns the wrapped Conn.
+func (st *StatsConn) underlying() Conn {
+	st.connMu.RLock()
+	defer st.connMu.RUnlock()
+	return st.conn
+}
+
+// wrapConn replaces the wrapped Conn with wrap(conn).
+func (st *StatsConn) wrapConn(wrap func(Conn) Conn) {
+	st.connMu.Lock()
+	defer st.connMu.Unlock()
+	st.conn = wrap(st.conn)
+}
+
 // ListDir is part of the Conn interface
 func (st *StatsConn) ListDir(ctx context.Context, dirPath string, full bool) ([]DirEntry, error) {
 	startTime := time.Now()
 	statsKey := []string{"ListDir", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	res, err := st.conn.ListDir(ctx, dirPath, full)
+	res, err := st.underlying().ListDir(ctx, dirPath, full)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return res, err
@@ -73,12 +95,12 @@ func (st *StatsConn) ListDir(ctx context.Context, dirPath string, full bool) ([]
 // Create is part of the Conn interface
 func (st *StatsConn) Create(ctx context.Context, filePath string, contents []byte) (Version, error) {
 	statsKey := []string{"Create", st.cell}
-	if st.readOnly {
-		return nil, vterrors.Errorf(vtrpc.Code_READ_ONLY, readOnlyErrorStrFormat, statsKey[0], filePath)
+	if st.readOnly.Get() {
+		return nil, readOnlyError(statsKey[0], filePath)
 	}
 	startTime := time.Now()
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	res, err := st.conn.Create(ctx, filePath, contents)
+	res, err := st.underlying().Create(ctx, filePath, contents)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return res, err
@@ -89,12 +111,12 @@ func (st *StatsConn) Create(ctx context.Context, filePath string, contents []byt
 // Update is part of the Conn interface
 func (st *StatsConn) Update(ctx context.Context, filePath string, contents []byte, version Version) (Version, error) {
 	statsKey := []string{"Update", st.cell}
-	if st.readOnly {
-		return nil, vterrors.Errorf(vtrpc.Code_READ_ONLY, readOnlyErrorStrFormat, statsKey[0], filePath)
+	if st.readOnly.Get() {
+		return nil, readOnlyError(statsKey[0], filePath)
 	}
 	startTime := time.Now()
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	res, err := st.conn.Update(ctx, filePath, contents, version)
+	res, err := st.underlying().Update(ctx, filePath, contents, version)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return res, err
@@ -107,7 +129,7 @@ func (st *StatsConn) Get(ctx context.Context, filePath string) ([]byte, Version,
 	startTime := time.Now()
 	statsKey := []string{"Get", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	bytes, version, err := st.conn.Get(ctx, filePath)
+	bytes, version, err := st.underlying().Get(ctx, filePath)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return bytes, version, err
@@ -120,7 +142,7 @@ func (st *StatsConn) List(ctx context.Context, filePathPrefix string) ([]KVInfo,
 	startTime := time.Now()
 	statsKey := []string{"List", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	bytes, err := st.conn.List(ctx, filePathPrefix)
+	bytes, err := st.underlying().List(ctx, filePathPrefix)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return bytes, err
@@ -131,12 +153,12 @@ func (st *StatsConn) List(ctx context.Context, filePathPrefix string) ([]KVInfo,
 // Delete is part of the Conn interface
 func (st *StatsConn) Delete(ctx context.Context, filePath string, version Version) error {
 	statsKey := []string{"Delete", st.cell}
-	if st.readOnly {
-		return vterrors.Errorf(vtrpc.Code_READ_ONLY, readOnlyErrorStrFormat, statsKey[0], filePath)
+	if st.readOnly.Get() {
+		return readOnlyError(statsKey[0], filePath)
 	}
 	startTime := time.Now()
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	err := st.conn.Delete(ctx, filePath, version)
+	err := st.underlying().Delete(ctx, filePath, version)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return err
@@ -144,15 +166,35 @@ func (st *StatsConn) Delete(ctx context.Context, filePath string, version Versio
 	return err
 }
 
+// Txn is part of the Conn interface
+func (st *StatsConn) Txn(ctx context.Context, ops []TxnOp) ([]Version, error) {
+	statsKey := []string{"Txn", st.cell}
+	if st.readOnly.Get() {
+		paths := make([]string, 0, len(ops))
+		for _, op := range ops {
+			paths = append(paths, op.Path)
+		}
+		return nil, readOnlyError(statsKey[0], strings.Join(paths, ", "))
+	}
+	startTime := time.Now()
+	defer topoStatsConnTimings.Record(statsKey, startTime)
+	versions, err := st.underlying().Txn(ctx, ops)
+	if err != nil {
+		topoStatsConnErrors.Add(statsKey, int64(1))
+		return versions, err
+	}
+	return versions, err
+}
+
 // Lock is part of the Conn interface
 func (st *StatsConn) Lock(ctx context.Context, dirPath, contents string) (LockDescriptor, error) {
 	statsKey := []string{"Lock", st.cell}
-	if st.readOnly {
-		return nil, vterrors.Errorf(vtrpc.Code_READ_ONLY, readOnlyErrorStrFormat, statsKey[0], dirPath)
+	if st.readOnly.Get() {
+		return nil, readOnlyError(statsKey[0], dirPath)
 	}
 	startTime := time.Now()
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	res, err := st.conn.Lock(ctx, dirPath, contents)
+	res, err := st.underlying().Lock(ctx, dirPath, contents)
 	if err != nil {
 		topoStatsConnErrors.Add(statsKey, int64(1))
 		return res, err
@@ -160,23 +202,79 @@ func (st *StatsConn) Lock(ctx context.Context, dirPath, contents string) (LockDe
 	return res, err
 }
 
+// LockWithTTL is part of the LeaseConn interface
+func (st *StatsConn) LockWithTTL(ctx context.Context, dirPath, contents string, ttl time.Duration) (LockDescriptor, error) {
+	statsKey := []string{"Lock", st.cell}
+	if st.readOnly.Get() {
+		return nil, readOnlyError(statsKey[0], dirPath)
+	}
+	startTime := time.Now()
+	defer topoStatsConnTimings.Record(statsKey, startTime)
+	res, err := lockWithTTL(ctx, st.underlying(), dirPath, contents, ttl)
+	if err != nil {
+		topoStatsConnErrors.Add(statsKey, int64(1))
+		return res, err
+	}
+	return res, err
+}
+
+// LockHolder is part of the LockInspectorConn interface
+func (st *StatsConn) LockHolder(ctx context.Context, dirPath string) (string, Version, error) {
+	startTime := time.Now()
+	statsKey := []string{"LockHolder", st.cell}
+	defer topoStatsConnTimings.Record(statsKey, startTime)
+	contents, version, err := lockHolder(ctx, st.underlying(), dirPath)
+	if err != nil {
+		topoStatsConnErrors.Add(statsKey, int64(1))
+		return contents, version, err
+	}
+	return contents, version, err
+}
+
+// BreakLock is part of the LockInspectorConn interface
+func (st *StatsConn) BreakLock(ctx context.Context, dirPath string, version Version) error {
+	statsKey := []string{"BreakLock", st.cell}
+	if st.readOnly.Get() {
+		return readOnlyError(statsKey[0], dirPath)
+	}
+	startTime := time.Now()
+	defer topoStatsConnTimings.Record(statsKey, startTime)
+	err := breakLock(ctx, st.underlying(), dirPath, version)
+	if err != nil {
+		topoStatsConnErrors.Add(statsKey, int64(1))
+		return err
+	}
+	return err
+}
+
 // Watch is part of the Conn interface
 func (st *StatsConn) Watch(ctx context.Context, filePath string) (current *WatchData, changes <-chan *WatchData, err error) {
 	startTime := time.Now()
 	statsKey := []string{"Watch", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	return st.conn.Watch(ctx, filePath)
+	return st.underlying().Watch(ctx, filePath)
+}
+
+// WatchFrom is part of the Conn interface
+func (st *StatsConn) WatchFrom(ctx context.Context, filePath string, version Version) (<-chan *WatchData, error) {
+	startTime := time.Now()
+	statsKey := []string{"WatchFrom", st.cell}
+	defer topoStatsConnTimings.Record(statsKey, startTime)
+	return st.underlying().WatchFrom(ctx, filePath, version)
 }
 
 func (st *StatsConn) WatchRecursive(ctx context.Context, path string) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error) {
 	startTime := time.Now()
 	statsKey := []string{"WatchRecursive", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	return st.conn.WatchRecursive(ctx, path)
+	return st.underlying().WatchRecursive(ctx, path)
 }
 
 // NewLeaderParticipation is part of the Conn interface
 func (st *StatsConn) NewLeaderParticipation(name, id string) (LeaderParticipation, error) {
+	if st.readOnly.Get() {
+		return nil, readOnlyError("NewLeaderParticipation", name)
+	}
 	startTime := time.Now()
 	// TODO(deepthi): delete after v13.0
 	deprecatedKey := []string{"NewMasterParticipation", st.cell}
@@ -184,7 +282,7 @@ func (st *StatsConn) NewLeaderParticipation(name, id string) (LeaderParticipatio
 
 	statsKey := []string{"NewLeaderParticipation", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	res, err := st.conn.NewLeaderParticipation(name, id)
+	res, err := st.underlying().NewLeaderParticipation(name, id)
 	if err != nil {
 		topoStatsConnErrors.Add(deprecatedKey, int64(1))
 		topoStatsConnErrors.Add(statsKey, int64(1))
@@ -198,15 +296,15 @@ func (st *StatsConn) Close() {
 	startTime := time.Now()
 	statsKey := []string{"Close", st.cell}
 	defer topoStatsConnTimings.Record(statsKey, startTime)
-	st.conn.Close()
+	st.underlying().Close()
 }
 
 // SetReadOnly with true prevents any write operations from being made on the topo connection
 func (st *StatsConn) SetReadOnly(readOnly bool) {
-	st.readOnly = readOnly
+	st.readOnly.Set(readOnly)
 }
 
 // IsReadOnly allows you to check the access type for the topo connection
 func (st *StatsConn) IsReadOnly() bool {
-	return st.readOnly
+	return st.readOnly.Get()
 }
@@ -92,6 +92,20 @@ func (st *fakeConn) Delete(ctx context.Context, filePath string, version Version
 	return err
 }
 
+// Txn is part of the Conn interface
+func (st *fakeConn) Txn(ctx context.Context, ops []TxnOp) (versions []Version, err error) {
+	if st.readOnly {
+		return nil, vterrors.Errorf(vtrpc.Code_READ_ONLY, "topo server connection is read-only")
+	}
+	for _, op := range ops {
+		if op.Path == "error" {
+			return nil, fmt.Errorf("dummy error")
+		}
+		versions = append(versions, nil)
+	}
+	return versions, err
+}
+
 // Lock is part of the Conn interface
 func (st *fakeConn) Lock(ctx context.Context, dirPath, contents string) (lock LockDescriptor, err error) {
 	if st.readOnly {
@@ -109,6 +123,11 @@ func (st *fakeConn) Watch(ctx context.Context, filePath string) (current *WatchD
 	return current, changes, err
 }
 
+// WatchFrom is part of the Conn interface
+func (st *fakeConn) WatchFrom(ctx context.Context, filePath string, version Version) (changes <-chan *WatchData, err error) {
+	return changes, err
+}
+
 // WatchRecursive is part of the Conn interface
 func (st *fakeConn) WatchRecursive(ctx context.Context, path string) (current []*WatchDataRecursive, changes <-chan *WatchDataRecursive, err error) {
 	return current, changes, err
@@ -272,6 +291,33 @@ func TestStatsConnTopoDelete(t *testing.T) {
 	}
 }
 
+//TestStatsConnTopoTxn emits stats on Txn
+func TestStatsConnTopoTxn(t *testing.T) {
+	conn := &fakeConn{}
+	statsConn := NewStatsConn("global", conn)
+	ctx := context.Background()
+
+	statsConn.Txn(ctx, []TxnOp{{Type: TxnDelete, Path: ""}})
+	timingCounts := topoStatsConnTimings.Counts()["Txn.global"]
+	if got, want := timingCounts, int64(1); got != want {
+		t.Errorf("stats were not properly recorded: got = %d, want = %d", got, want)
+	}
+
+	// error is zero before getting an error
+	errorCount := topoStatsConnErrors.Counts()["Txn.global"]
+	if got, want := errorCount, int64(0); got != want {
+		t.Errorf("stats were not properly recorded: got = %d, want = %d", got, want)
+	}
+
+	statsConn.Txn(ctx, []TxnOp{{Type: TxnDelete, Path: "error"}})
+
+	// error stats gets emitted
+	errorCount = topoStatsConnErrors.Counts()["Txn.global"]
+	if got, want := errorCount, int64(1); got != want {
+		t.Errorf("stats were not properly recorded: got = %d, want = %d", got, want)
+	}
+}
+
 //TestStatsConnTopoLock emits stats on Lock
 func TestStatsConnTopoLock(t *testing.T) {
 	conn := &fakeConn{}
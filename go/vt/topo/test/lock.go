@@ -54,6 +54,9 @@ func checkLock(t *testing.T, ts *topo.Server) {
 
 	t.Log("===      checkLockUnblocks")
 	checkLockUnblocks(ctx, t, conn)
+
+	t.Log("===      checkLockBreak")
+	checkLockBreak(ctx, t, conn)
 }
 
 func checkLockTimeout(ctx context.Context, t *testing.T, conn topo.Conn) {
@@ -174,3 +177,64 @@ func checkLockUnblocks(ctx context.Context, t *testing.T, conn topo.Conn) {
 		t.Fatalf("unlocking timed out")
 	}
 }
+
+// checkLockBreak makes sure a lock can be inspected and broken, and
+// taken again after that.
+func checkLockBreak(ctx context.Context, t *testing.T, conn topo.Conn) {
+	lic, ok := conn.(topo.LockInspectorConn)
+	if !ok {
+		t.Logf("%T doesn't implement topo.LockInspectorConn, skipping", conn)
+		return
+	}
+
+	keyspacePath := path.Join(topo.KeyspacesPath, "test_keyspace")
+	_, _, err := lic.LockHolder(ctx, keyspacePath)
+	if topo.IsErrType(err, topo.NoImplementation) {
+		// The Conn wraps another Conn that can't inspect its locks.
+		t.Logf("%T doesn't support LockHolder, skipping", conn)
+		return
+	}
+	if !topo.IsErrType(err, topo.NoNode) {
+		t.Fatalf("LockHolder(not locked): %v", err)
+	}
+
+	lockDescriptor, err := conn.Lock(ctx, keyspacePath, "stuck")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	contents, version, err := lic.LockHolder(ctx, keyspacePath)
+	if err != nil {
+		t.Fatalf("LockHolder: %v", err)
+	}
+	if contents != "stuck" {
+		t.Errorf("LockHolder returned contents %q, expected %q", contents, "stuck")
+	}
+
+	if err := lic.BreakLock(ctx, keyspacePath, version); err != nil {
+		t.Fatalf("BreakLock: %v", err)
+	}
+	if _, _, err := lic.LockHolder(ctx, keyspacePath); !topo.IsErrType(err, topo.NoNode) {
+		t.Errorf("LockHolder(broken): %v", err)
+	}
+	if err := lic.BreakLock(ctx, keyspacePath, version); !topo.IsErrType(err, topo.NoNode) {
+		t.Errorf("BreakLock(broken): %v", err)
+	}
+	// The holder may or may not notice it lost the lock when it
+	// unlocks, depending on the implementation.
+	_ = lockDescriptor.Unlock(ctx)
+
+	// The lock can be taken again, and the version of the broken
+	// lock doesn't break it.
+	lockCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	lockDescriptor, err = conn.Lock(lockCtx, keyspacePath, "again")
+	if err != nil {
+		t.Fatalf("Lock(again): %v", err)
+	}
+	if err := lic.BreakLock(ctx, keyspacePath, version); !topo.IsErrType(err, topo.BadVersion) {
+		t.Errorf("BreakLock(locked again): %v", err)
+	}
+	if err := lockDescriptor.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock(again): %v", err)
+	}
+}
@@ -111,12 +111,20 @@ func TopoServerTestSuite(t *testing.T, factory func() *topo.Server) {
 	checkFile(t, ts)
 	ts.Close()
 
+	t.Log("=== checkTxn")
+	ts = factory()
+	checkTxn(t, ts)
+	ts.Close()
+
 	t.Log("=== checkWatch")
 	ts = factory()
 	checkWatch(t, ts)
 	t.Log("=== checkWatchInterrupt")
 	checkWatchInterrupt(t, ts)
 
+	t.Log("=== checkWatchFrom")
+	checkWatchFrom(t, ts)
+
 	t.Log("=== checkList")
 	checkList(t, ts)
 
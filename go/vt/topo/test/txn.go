@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"testing"
+
+	"vitess.io/vitess/go/vt/topo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// checkTxn tests the transactions of the Conn API, and the records
+// updated in a transaction.
+func checkTxn(t *testing.T, ts *topo.Server) {
+	ctx := context.Background()
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	if err != nil {
+		t.Fatalf("ConnForCell(global) failed: %v", err)
+	}
+
+	// Create two files.
+	versions, err := conn.Txn(ctx, []topo.TxnOp{
+		{Type: topo.TxnCreate, Path: "/txn/a", Contents: []byte("a1")},
+		{Type: topo.TxnCreate, Path: "/txn/b", Contents: []byte("b1")},
+	})
+	if topo.IsErrType(err, topo.NoImplementation) {
+		t.Logf("%T does not support Txn()", conn)
+		return
+	}
+	if err != nil {
+		t.Fatalf("Txn(create) failed: %v", err)
+	}
+	if len(versions) != 2 || versions[0] == nil || versions[1] == nil {
+		t.Fatalf("Txn(create) returned bad versions: %v", versions)
+	}
+	checkTxnFile(t, conn, "/txn/a", "a1", versions[0])
+	checkTxnFile(t, conn, "/txn/b", "b1", versions[1])
+	versionA, versionB := versions[0], versions[1]
+
+	// Update a, delete b, create c, all at once.
+	versions, err = conn.Txn(ctx, []topo.TxnOp{
+		{Type: topo.TxnUpdate, Path: "/txn/a", Contents: []byte("a2"), Version: versionA},
+		{Type: topo.TxnDelete, Path: "/txn/b", Version: versionB},
+		{Type: topo.TxnCreate, Path: "/txn/c", Contents: []byte("c1")},
+	})
+	if err != nil {
+		t.Fatalf("Txn(update, delete, create) failed: %v", err)
+	}
+	if versions[1] != nil {
+		t.Errorf("Txn(update, delete, create) returned a version for the delete: %v", versions[1])
+	}
+	checkTxnFile(t, conn, "/txn/a", "a2", versions[0])
+	checkTxnFile(t, conn, "/txn/c", "c1", versions[2])
+	if _, _, err := conn.Get(ctx, "/txn/b"); !topo.IsErrType(err, topo.NoNode) {
+		t.Errorf("Get(/txn/b) after delete returned: %v", err)
+	}
+	versionA, versionC := versions[0], versions[2]
+
+	// A failed condition applies nothing, and returns the error of
+	// the operation.
+	for _, tcase := range []struct {
+		op   topo.TxnOp
+		code topo.ErrorCode
+	}{
+		{topo.TxnOp{Type: topo.TxnUpdate, Path: "/txn/c", Contents: []byte("c2"), Version: versionA}, topo.BadVersion},
+		{topo.TxnOp{Type: topo.TxnCreate, Path: "/txn/c", Contents: []byte("c2")}, topo.NodeExists},
+		{topo.TxnOp{Type: topo.TxnDelete, Path: "/txn/b"}, topo.NoNode},
+		{topo.TxnOp{Type: topo.TxnCheck, Path: "/txn/c", Version: versionA}, topo.BadVersion},
+	} {
+		_, err := conn.Txn(ctx, []topo.TxnOp{
+			{Type: topo.TxnUpdate, Path: "/txn/a", Contents: []byte("a3"), Version: versionA},
+			{Type: topo.TxnCreate, Path: "/txn/d", Contents: []byte("d1")},
+			tcase.op,
+		})
+		if !topo.IsErrType(err, tcase.code) {
+			t.Errorf("Txn(%v %v) returned %v, expected %v", tcase.op.Type, tcase.op.Path, err, tcase.code)
+		}
+		checkTxnFile(t, conn, "/txn/a", "a2", versionA)
+		if _, _, err := conn.Get(ctx, "/txn/d"); !topo.IsErrType(err, topo.NoNode) {
+			t.Errorf("Get(/txn/d) after failed Txn returned: %v", err)
+		}
+	}
+
+	// A path can only appear once.
+	if _, err := conn.Txn(ctx, []topo.TxnOp{
+		{Type: topo.TxnCheck, Path: "/txn/a", Version: versionA},
+		{Type: topo.TxnDelete, Path: "/txn/a"},
+	}); err == nil {
+		t.Errorf("Txn with a duplicate path worked")
+	}
+
+	// An unconditional update creates a file, and a check doesn't
+	// change it.
+	versions, err = conn.Txn(ctx, []topo.TxnOp{
+		{Type: topo.TxnCheck, Path: "/txn/c", Version: versionC},
+		{Type: topo.TxnUpdate, Path: "/txn/e", Contents: []byte("e1")},
+	})
+	if err != nil {
+		t.Fatalf("Txn(check, update) failed: %v", err)
+	}
+	checkTxnFile(t, conn, "/txn/c", "c1", versionC)
+	checkTxnFile(t, conn, "/txn/e", "e1", versions[1])
+
+	// Clean up.
+	if _, err := conn.Txn(ctx, []topo.TxnOp{
+		{Type: topo.TxnDelete, Path: "/txn/a"},
+		{Type: topo.TxnDelete, Path: "/txn/c"},
+		{Type: topo.TxnDelete, Path: "/txn/e"},
+	}); err != nil {
+		t.Fatalf("Txn(delete) failed: %v", err)
+	}
+
+	checkUpdateKeyspaceAndShards(t, ts)
+}
+
+// checkTxnFile checks the contents and version of a file.
+func checkTxnFile(t *testing.T, conn topo.Conn, filePath, contents string, version topo.Version) {
+	t.Helper()
+	data, v, err := conn.Get(context.Background(), filePath)
+	if err != nil {
+		t.Fatalf("Get(%v) failed: %v", filePath, err)
+	}
+	if string(data) != contents || v.String() != version.String() {
+		t.Errorf("Get(%v) returned %q version %v, expected %q version %v", filePath, data, v, contents, version)
+	}
+}
+
+// checkUpdateKeyspaceAndShards tests the updates of a keyspace and its
+// shards in a transaction.
+func checkUpdateKeyspaceAndShards(t *testing.T, ts *topo.Server) {
+	ctx := context.Background()
+	if err := ts.CreateKeyspace(ctx, "txn_keyspace", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	for _, shard := range []string{"-80", "80-"} {
+		if err := ts.CreateShard(ctx, "txn_keyspace", shard); err != nil {
+			t.Fatalf("CreateShard(%v) failed: %v", shard, err)
+		}
+	}
+
+	lockCtx, unlock, err := ts.LockKeyspace(ctx, "txn_keyspace", "checkUpdateKeyspaceAndShards")
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	defer unlock(&err)
+
+	ki, err := ts.GetKeyspace(ctx, "txn_keyspace")
+	if err != nil {
+		t.Fatalf("GetKeyspace failed: %v", err)
+	}
+	shards, err := ts.FindAllShardsInKeyspace(ctx, "txn_keyspace")
+	if err != nil {
+		t.Fatalf("FindAllShardsInKeyspace failed: %v", err)
+	}
+	staleShard := *shards["80-"]
+
+	ki.DurabilityPolicy = "semi_sync"
+	shards["-80"].IsPrimaryServing = false
+	shards["80-"].IsPrimaryServing = false
+	if err := ts.UpdateKeyspaceAndShards(lockCtx, ki, []*topo.ShardInfo{shards["-80"], shards["80-"]}); err != nil {
+		t.Fatalf("UpdateKeyspaceAndShards failed: %v", err)
+	}
+
+	// The records were updated, with their versions.
+	for _, shard := range []string{"-80", "80-"} {
+		si, err := ts.GetShard(ctx, "txn_keyspace", shard)
+		if err != nil {
+			t.Fatalf("GetShard(%v) failed: %v", shard, err)
+		}
+		if si.IsPrimaryServing || si.Version().String() != shards[shard].Version().String() {
+			t.Errorf("GetShard(%v) returned %v version %v", shard, si.Shard, si.Version())
+		}
+	}
+
+	// A stale record fails the whole update.
+	ki.DurabilityPolicy = "none"
+	staleShard.IsPrimaryServing = true
+	if err := ts.UpdateKeyspaceAndShards(lockCtx, ki, []*topo.ShardInfo{&staleShard}); !topo.IsErrType(err, topo.BadVersion) {
+		t.Errorf("UpdateKeyspaceAndShards with a stale shard returned: %v", err)
+	}
+	ki, err = ts.GetKeyspace(ctx, "txn_keyspace")
+	if err != nil {
+		t.Fatalf("GetKeyspace failed: %v", err)
+	}
+	if ki.DurabilityPolicy != "semi_sync" {
+		t.Errorf("keyspace was updated by a failed UpdateKeyspaceAndShards: %v", ki.Keyspace)
+	}
+}
@@ -442,3 +442,102 @@ func checkWatchRecursive(t *testing.T, ts *topo.Server) {
 	// And calling cancel() again should just work.
 	secondCancel()
 }
+
+// checkWatchFrom tests we can resume a watch from a version.
+func checkWatchFrom(t *testing.T, ts *topo.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, err := ts.ConnForCell(ctx, LocalCellName)
+	if err != nil {
+		t.Fatalf("ConnForCell(test) failed: %v", err)
+	}
+
+	version, err := conn.Create(ctx, "watch_from/file", []byte("v1"))
+	if err != nil {
+		t.Fatalf("Create(watch_from/file) failed: %v", err)
+	}
+
+	// The file didn't change: the first change is the next update.
+	watchCtx, watchCancel := context.WithCancel(ctx)
+	changes, err := conn.WatchFrom(watchCtx, "watch_from/file", version)
+	if err != nil {
+		t.Fatalf("WatchFrom failed: %v", err)
+	}
+	if _, err := conn.Update(ctx, "watch_from/file", []byte("v2"), nil); err != nil {
+		t.Fatalf("Update(watch_from/file) failed: %v", err)
+	}
+	for {
+		wd, ok := <-changes
+		if !ok || wd.Err != nil {
+			t.Fatalf("watch unexpectedly stopped: %v", wd)
+		}
+		if string(wd.Contents) == "v2" {
+			break
+		}
+		if string(wd.Contents) != "v1" {
+			t.Fatalf("got unknown contents: %q", wd.Contents)
+		}
+	}
+
+	// Stop the watch, and wait for it to be done.
+	watchCancel()
+	for range changes {
+	}
+
+	// The changes after version are not lost, even without a watch.
+	if _, err := conn.Update(ctx, "watch_from/file", []byte("v3"), nil); err != nil {
+		t.Fatalf("Update(watch_from/file) failed: %v", err)
+	}
+	watchCtx, watchCancel = context.WithCancel(ctx)
+	changes, err = conn.WatchFrom(watchCtx, "watch_from/file", version)
+	if err != nil {
+		t.Fatalf("WatchFrom failed: %v", err)
+	}
+	for {
+		wd, ok := <-changes
+		if !ok || wd.Err != nil {
+			t.Fatalf("watch unexpectedly stopped: %v", wd)
+		}
+		if string(wd.Contents) == "v3" {
+			break
+		}
+		if string(wd.Contents) != "v2" {
+			t.Fatalf("got unknown contents: %q", wd.Contents)
+		}
+	}
+
+	watchCancel()
+	for range changes {
+	}
+
+	// Without a version, the current value is sent first.
+	watchCtx, watchCancel = context.WithCancel(ctx)
+	changes, err = conn.WatchFrom(watchCtx, "watch_from/file", nil)
+	if err != nil {
+		t.Fatalf("WatchFrom(nil) failed: %v", err)
+	}
+	if wd, ok := <-changes; !ok || wd.Err != nil || string(wd.Contents) != "v3" {
+		t.Fatalf("got %v, want the current value v3", wd)
+	}
+	watchCancel()
+	for range changes {
+	}
+
+	// A deletion is seen.
+	if err := conn.Delete(ctx, "watch_from/file", nil); err != nil {
+		t.Fatalf("Delete(watch_from/file) failed: %v", err)
+	}
+	changes, err = conn.WatchFrom(ctx, "watch_from/file", version)
+	if err != nil {
+		t.Fatalf("WatchFrom failed: %v", err)
+	}
+	for wd := range changes {
+		if wd.Err != nil {
+			if !topo.IsErrType(wd.Err, topo.NoNode) {
+				t.Fatalf("bad error returned for deletion: %v", wd.Err)
+			}
+			return
+		}
+	}
+	t.Fatalf("watch channel closed without the deletion")
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topobackup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// StateAt returns the contents of the files of the topology server as
+// they were at a time, from the change log in dir. It starts from the
+// last snapshot before that time, and applies the changes received
+// after it.
+func StateAt(ctx context.Context, storage backupstorage.BackupStorage, dir string, at time.Time) (map[string][]byte, error) {
+	segments, err := listSegments(ctx, storage, dir)
+	if err != nil {
+		return nil, err
+	}
+	start := -1
+	for i, s := range segments {
+		if s.kind == snapshotSegment && !s.time.After(at) {
+			start = i
+		}
+	}
+	if start == -1 {
+		return nil, fmt.Errorf("no snapshot of the topology server before %v in %v", at, dir)
+	}
+
+	snapshot, err := readSegment(ctx, segments[start])
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string][]byte, len(snapshot))
+	for _, e := range snapshot {
+		state[e.Path] = e.Contents
+	}
+
+	// The changes segments of several recorders can overlap, so the
+	// changes are applied by time.
+	snapshotTime := segments[start].time
+	var changes []*Entry
+	for _, s := range segments[start+1:] {
+		if s.kind != changesSegment || s.time.After(at) {
+			continue
+		}
+		entries, err := readSegment(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Time.After(snapshotTime) && !e.Time.After(at) {
+				changes = append(changes, e)
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	for _, e := range changes {
+		if e.Deleted {
+			delete(state, e.Path)
+		} else {
+			state[e.Path] = e.Contents
+		}
+	}
+	return state, nil
+}
+
+// Restore writes the files of state to the topology server of conn,
+// and deletes its other files, except the locks and the elections. If
+// the backend can't list its files, the files that are not in state
+// are kept.
+func Restore(ctx context.Context, conn topo.Conn, state map[string][]byte) error {
+	existing := make(map[string]topo.Version)
+	kvs, err := conn.List(ctx, "/")
+	switch {
+	case err == nil:
+		for _, kv := range kvs {
+			p := strings.TrimPrefix(string(kv.Key), "/")
+			if !isEphemeral(p) {
+				existing[p] = kv.Version
+			}
+		}
+	case topo.IsErrType(err, topo.NoNode):
+	case topo.IsErrType(err, topo.NoImplementation):
+		log.Warningf("Cannot list the files of the topology server, the files that are not in the backup will be kept: %v", err)
+	default:
+		return err
+	}
+
+	for _, p := range sortedPaths(state) {
+		version, ok := existing[p]
+		if ok {
+			_, err = conn.Update(ctx, p, state[p], version)
+		} else {
+			_, err = conn.Create(ctx, p, state[p])
+			if topo.IsErrType(err, topo.NodeExists) {
+				_, err = conn.Update(ctx, p, state[p], nil)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("cannot restore %v: %v", p, err)
+		}
+		delete(existing, p)
+	}
+	for p, version := range existing {
+		if err := conn.Delete(ctx, p, version); err != nil && !topo.IsErrType(err, topo.NoNode) {
+			return fmt.Errorf("cannot delete %v: %v", p, err)
+		}
+	}
+	return nil
+}
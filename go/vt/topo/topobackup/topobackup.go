@@ -0,0 +1,355 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package topobackup continuously backs up a topology server to a
+// backup storage, and restores it as it was at a point in time.
+//
+// The backup of a topology server is a change log: a sequence of
+// segments, each stored as a backup in a directory of the backup
+// storage. A snapshot segment has the contents of all the files of the
+// topology server at the time of the segment. A changes segment has the
+// changes of the files received after the previous segment. The
+// segments are never modified once written.
+//
+// The locks and the elections are not backed up, as they are only
+// meaningful to the processes holding them.
+package topobackup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"vitess.io/vitess/go/vt/log"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/topo"
+)
+
+const (
+	// snapshotSegment is the kind of the segments with all the files.
+	snapshotSegment = "snapshot"
+
+	// changesSegment is the kind of the segments with the changes.
+	changesSegment = "changes"
+
+	// segmentFile is the name of the file with the entries of a
+	// segment, in its backup.
+	segmentFile = "entries.json"
+
+	// segmentTimeFormat is the format of the time in the names of the
+	// segments. It has a fixed width, so the names sort by time.
+	segmentTimeFormat = "20060102.150405.000000000"
+
+	// locksPath and electionsPath are the directories the backends use
+	// for the locks and the elections.
+	locksPath     = "locks"
+	electionsPath = "elections"
+)
+
+// recordRetryDelay is how long the Recorder waits before restarting
+// after an error.
+var recordRetryDelay = 5 * time.Second
+
+// Entry is an entry of a segment of the change log.
+type Entry struct {
+	// Time is when the change was received, or the time of the
+	// snapshot.
+	Time time.Time `json:"time"`
+
+	// Path is the path of the file, relative to the root of the
+	// topology server.
+	Path string `json:"path"`
+
+	// Contents are the contents of the file, nil if it was deleted.
+	Contents []byte `json:"contents,omitempty"`
+
+	// Deleted is true if the file was deleted.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// isEphemeral returns true for the files that are not backed up: the
+// locks of the keyspaces and shards, and the elections.
+func isEphemeral(filePath string) bool {
+	parts := strings.Split(strings.TrimPrefix(filePath, "/"), "/")
+	switch {
+	case parts[0] == electionsPath:
+		return true
+	case parts[0] != topo.KeyspacesPath:
+		return false
+	case len(parts) > 3 && parts[2] == locksPath:
+		// keyspaces/<keyspace>/locks/...
+		return true
+	case len(parts) > 5 && parts[2] == topo.ShardsPath && parts[4] == locksPath:
+		// keyspaces/<keyspace>/shards/<shard>/locks/...
+		return true
+	}
+	return false
+}
+
+// Recorder records the changes of a topology server to a directory of
+// a backup storage.
+type Recorder struct {
+	storage          backupstorage.BackupStorage
+	dir              string
+	flushInterval    time.Duration
+	snapshotInterval time.Duration
+}
+
+// NewRecorder returns a Recorder writing to dir in storage. The
+// received changes are written every flushInterval, and a snapshot is
+// written every snapshotInterval, so a restore only reads the segments
+// since the last snapshot.
+func NewRecorder(storage backupstorage.BackupStorage, dir string, flushInterval, snapshotInterval time.Duration) *Recorder {
+	return &Recorder{
+		storage:          storage,
+		dir:              dir,
+		flushInterval:    flushInterval,
+		snapshotInterval: snapshotInterval,
+	}
+}
+
+// Run records the changes of the topology server of conn until ctx is
+// canceled. If the watch of the topology server or a write to the
+// backup storage fails, it starts again with a new snapshot.
+func (r *Recorder) Run(ctx context.Context, conn topo.Conn) {
+	for {
+		err := r.record(ctx, conn)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warningf("Recording of the topology changes to %v failed, restarting in %v: %v", r.dir, recordRetryDelay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(recordRetryDelay):
+		}
+	}
+}
+
+// record writes a snapshot, then the changes received from a recursive
+// watch of the topology server.
+func (r *Recorder) record(ctx context.Context, conn topo.Conn) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	initial, changes, err := conn.WatchRecursive(watchCtx, "/")
+	if err != nil {
+		return err
+	}
+
+	// state is the current contents of the files, for the snapshots.
+	state := make(map[string][]byte)
+	for _, wd := range initial {
+		if !isEphemeral(wd.Path) {
+			state[wd.Path] = wd.Contents
+		}
+	}
+	if err := r.writeSnapshot(ctx, time.Now(), state); err != nil {
+		return err
+	}
+
+	flushTicker := time.NewTicker(r.flushInterval)
+	defer flushTicker.Stop()
+	snapshotTicker := time.NewTicker(r.snapshotInterval)
+	defer snapshotTicker.Stop()
+
+	var pending []*Entry
+	flush := func(ctx context.Context) error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := r.writeSegment(ctx, changesSegment, pending[0].Time, pending); err != nil {
+			return err
+		}
+		pending = nil
+		return nil
+	}
+	// stop writes the pending changes when ctx is canceled.
+	stop := func() error {
+		flushCtx, cancel := context.WithTimeout(context.Background(), r.flushInterval)
+		defer cancel()
+		if err := flush(flushCtx); err != nil {
+			log.Errorf("Cannot write the last topology changes to %v: %v", r.dir, err)
+		}
+		return ctx.Err()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return stop()
+		case <-flushTicker.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		case <-snapshotTicker.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+			if err := r.writeSnapshot(ctx, time.Now(), state); err != nil {
+				return err
+			}
+		case wd, ok := <-changes:
+			if !ok {
+				if ctx.Err() != nil {
+					return stop()
+				}
+				return fmt.Errorf("watch of the topology server closed")
+			}
+			e := &Entry{
+				Time:     time.Now(),
+				Path:     wd.Path,
+				Contents: wd.Contents,
+			}
+			if wd.Err != nil {
+				if ctx.Err() != nil {
+					return stop()
+				}
+				if wd.Path == "" || !topo.IsErrType(wd.Err, topo.NoNode) {
+					return wd.Err
+				}
+				e.Contents = nil
+				e.Deleted = true
+			}
+			if isEphemeral(e.Path) {
+				continue
+			}
+			if e.Deleted {
+				delete(state, e.Path)
+			} else {
+				state[e.Path] = e.Contents
+			}
+			pending = append(pending, e)
+		}
+	}
+}
+
+// writeSnapshot writes a snapshot segment with the files of state.
+func (r *Recorder) writeSnapshot(ctx context.Context, t time.Time, state map[string][]byte) error {
+	entries := make([]*Entry, 0, len(state))
+	for _, p := range sortedPaths(state) {
+		entries = append(entries, &Entry{
+			Time:     t,
+			Path:     p,
+			Contents: state[p],
+		})
+	}
+	return r.writeSegment(ctx, snapshotSegment, t, entries)
+}
+
+// writeSegment writes a segment as a backup, with the entries as JSON
+// lines.
+func (r *Recorder) writeSegment(ctx context.Context, kind string, t time.Time, entries []*Entry) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	name := t.UTC().Format(segmentTimeFormat) + "." + kind
+	bh, err := r.storage.StartBackup(ctx, r.dir, name)
+	if err != nil {
+		return err
+	}
+	w, err := bh.AddFile(ctx, segmentFile, int64(buf.Len()))
+	if err != nil {
+		bh.AbortBackup(ctx)
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		w.Close()
+		bh.AbortBackup(ctx)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		bh.AbortBackup(ctx)
+		return err
+	}
+	return bh.EndBackup(ctx)
+}
+
+// segment is a segment of the change log in a backup storage.
+type segment struct {
+	handle backupstorage.BackupHandle
+	time   time.Time
+	kind   string
+}
+
+// listSegments returns the segments in dir, sorted by time.
+func listSegments(ctx context.Context, storage backupstorage.BackupStorage, dir string) ([]*segment, error) {
+	handles, err := storage.ListBackups(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*segment
+	for _, bh := range handles {
+		ext := path.Ext(bh.Name())
+		t, err := time.Parse(segmentTimeFormat, strings.TrimSuffix(bh.Name(), ext))
+		kind := strings.TrimPrefix(ext, ".")
+		if err != nil || (kind != snapshotSegment && kind != changesSegment) {
+			log.Warningf("Ignoring %v in %v, not a segment of a topology change log", bh.Name(), dir)
+			continue
+		}
+		segments = append(segments, &segment{
+			handle: bh,
+			time:   t,
+			kind:   kind,
+		})
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].time.Before(segments[j].time)
+	})
+	return segments, nil
+}
+
+// readSegment returns the entries of a segment.
+func readSegment(ctx context.Context, s *segment) ([]*Entry, error) {
+	rc, err := s.handle.ReadFile(ctx, segmentFile)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var entries []*Entry
+	dec := json.NewDecoder(rc)
+	for {
+		e := &Entry{}
+		if err := dec.Decode(e); err != nil {
+			if err == io.EOF {
+				return entries, nil
+			}
+			return nil, fmt.Errorf("cannot read segment %v: %v", s.handle.Name(), err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// sortedPaths returns the paths of the files of a state, sorted.
+func sortedPaths(state map[string][]byte) []string {
+	paths := make([]string, 0, len(state))
+	for p := range state {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topobackup
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/mysqlctl/filebackupstorage"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestIsEphemeral(t *testing.T) {
+	testcases := []struct {
+		path string
+		want bool
+	}{
+		{"keyspaces/ks/Keyspace", false},
+		{"keyspaces/ks/locks/1234", true},
+		{"keyspaces/ks/shards/0/locks/1234", true},
+		{"keyspaces/locks/Keyspace", false},
+		{"keyspaces/ks/shards/locks/Shard", false},
+		{"elections/vtctld/1234", true},
+		{"/cells/zone1/CellInfo", false},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, tc.want, isEphemeral(tc.path), tc.path)
+	}
+}
+
+// waitForSegments waits until dir has n changes segments.
+func waitForSegments(t *testing.T, fbs *filebackupstorage.FileBackupStorage, dir string, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		segments, err := listSegments(context.Background(), fbs, dir)
+		require.NoError(t, err)
+		count := 0
+		for _, s := range segments {
+			if s.kind == changesSegment {
+				count++
+			}
+		}
+		if count >= n {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %v changes segments", n)
+}
+
+func keyspaces(t *testing.T, ts *topo.Server) []string {
+	t.Helper()
+	names, err := ts.GetKeyspaces(context.Background())
+	require.NoError(t, err)
+	sort.Strings(names)
+	return names
+}
+
+func TestRecordAndRestore(t *testing.T) {
+	filebackupstorage.FileBackupStorageRoot = t.TempDir()
+	fbs := &filebackupstorage.FileBackupStorage{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+
+	recorder := NewRecorder(fbs, "topo", 10*time.Millisecond, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		recorder.Run(ctx, conn)
+		close(done)
+	}()
+
+	// Wait for the snapshot, then make changes.
+	var snapshotTime time.Time
+	for snapshotTime.IsZero() {
+		segments, err := listSegments(ctx, fbs, "topo")
+		require.NoError(t, err)
+		if len(segments) > 0 {
+			snapshotTime = segments[0].time
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks2", &topodatapb.Keyspace{}))
+	waitForSegments(t, fbs, "topo", 1)
+	beforeDelete := time.Now()
+
+	require.NoError(t, ts.DeleteKeyspace(ctx, "ks1"))
+	waitForSegments(t, fbs, "topo", 2)
+	cancel()
+	<-done
+
+	testcases := []struct {
+		at   time.Time
+		want []string
+	}{
+		{snapshotTime, []string{"ks1"}},
+		{beforeDelete, []string{"ks1", "ks2"}},
+		{time.Now(), []string{"ks2"}},
+	}
+	for _, tc := range testcases {
+		state, err := StateAt(context.Background(), fbs, "topo", tc.at)
+		require.NoError(t, err)
+
+		// Restore into a topology server with other data.
+		to := memorytopo.NewServer("cell1")
+		require.NoError(t, to.CreateKeyspace(context.Background(), "other", &topodatapb.Keyspace{}))
+		toConn, err := to.ConnForCell(context.Background(), topo.GlobalCell)
+		require.NoError(t, err)
+		require.NoError(t, Restore(context.Background(), toConn, state))
+		assert.Equal(t, tc.want, keyspaces(t, to))
+	}
+
+	_, err = StateAt(context.Background(), fbs, "topo", snapshotTime.Add(-time.Second))
+	assert.ErrorContains(t, err, "no snapshot of the topology server")
+}
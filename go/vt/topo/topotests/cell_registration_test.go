@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestRegisterCell(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	ci := &topodatapb.CellInfo{ServerAddress: "cell2-topo:2379", Root: "/vitess/cell2"}
+	require.NoError(t, ts.RegisterCell(ctx, "cell2", ci))
+	got, err := ts.GetCellInfo(ctx, "cell2", true /*strongRead*/)
+	require.NoError(t, err)
+	assert.Equal(t, ci.ServerAddress, got.ServerAddress)
+	assert.Equal(t, ci.Root, got.Root)
+	hb, err := ts.GetCellHeartbeat(ctx, "cell2")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), hb.Time, time.Minute)
+
+	// Registering it again is a no-op, but a different CellInfo fails.
+	require.NoError(t, ts.RegisterCell(ctx, "cell2", ci))
+	err = ts.RegisterCell(ctx, "cell2", &topodatapb.CellInfo{ServerAddress: "other:2379", Root: "/vitess/cell2"})
+	require.Error(t, err)
+
+	// The cells added with CreateCellInfo have no heartbeat, and it is
+	// not created by an update.
+	_, err = ts.GetCellHeartbeat(ctx, "cell1")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	err = ts.UpdateCellHeartbeat(ctx, "cell1")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+
+	stale, err := ts.GetStaleCells(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+	time.Sleep(10 * time.Millisecond)
+	stale, err = ts.GetStaleCells(ctx, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cell2"}, stale)
+
+	// Deleting the cell deletes its heartbeat.
+	require.NoError(t, ts.DeleteCellInfo(ctx, "cell2", true /*force*/))
+	_, err = ts.GetCellHeartbeat(ctx, "cell2")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	err = ts.UpdateCellHeartbeat(ctx, "cell2")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	names, err := ts.GetCellInfoNames(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cell1"}, names)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestUpdateKeyspaceFields(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+
+	// A concurrent update makes the first write fail, and the
+	// update is retried on the new record, without the lock.
+	calls := 0
+	ki, err := ts.UpdateKeyspaceFields(ctx, "ks", func(ki *topo.KeyspaceInfo) error {
+		calls++
+		if calls == 1 {
+			_, err := ts.UpdateKeyspaceFields(ctx, "ks", func(ki *topo.KeyspaceInfo) error {
+				ki.DurabilityPolicy = "semi_sync"
+				return nil
+			})
+			require.NoError(t, err)
+		}
+		ki.BaseKeyspace = "base"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "semi_sync", ki.DurabilityPolicy)
+
+	ki, err = ts.GetKeyspace(ctx, "ks")
+	require.NoError(t, err)
+	assert.Equal(t, "semi_sync", ki.DurabilityPolicy)
+	assert.Equal(t, "base", ki.BaseKeyspace)
+
+	// Nothing is written if no update is needed.
+	ki, err = ts.UpdateKeyspaceFields(ctx, "ks", func(ki *topo.KeyspaceInfo) error {
+		return topo.NewError(topo.NoUpdateNeeded, "ks")
+	})
+	require.NoError(t, err)
+	assert.Nil(t, ki)
+
+	_, err = ts.UpdateKeyspaceFields(ctx, "unknown", func(ki *topo.KeyspaceInfo) error {
+		return nil
+	})
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
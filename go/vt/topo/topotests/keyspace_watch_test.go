@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestWatchKeyspaceNoNode(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	// No Keyspace -> ErrNoNode
+	_, _, err := ts.WatchKeyspace(ctx, "ks1")
+	if !topo.IsErrType(err, topo.NoNode) {
+		t.Errorf("Got invalid result from WatchKeyspace(not there): %v", err)
+	}
+}
+
+func TestWatchKeyspace(t *testing.T) {
+	keyspace := "ks1"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := memorytopo.NewServer("cell1")
+
+	if err := ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{DurabilityPolicy: "none"}); err != nil {
+		t.Fatalf("CreateKeyspace %v failed: %v", keyspace, err)
+	}
+
+	current, changes, err := ts.WatchKeyspace(ctx, keyspace)
+	if err != nil {
+		t.Fatalf("WatchKeyspace failed: %v", err)
+	}
+	if current.Err != nil || current.Version == nil || !proto.Equal(current.Value, &topodatapb.Keyspace{DurabilityPolicy: "none"}) {
+		t.Fatalf("got bad initial data: %v", current)
+	}
+
+	// Update the durability policy, make sure it's seen.
+	lockCtx, unlock, err := ts.LockKeyspace(ctx, keyspace, "TestWatchKeyspace")
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	ki, err := ts.GetKeyspace(lockCtx, keyspace)
+	if err != nil {
+		t.Fatalf("GetKeyspace failed: %v", err)
+	}
+	ki.DurabilityPolicy = "semi_sync"
+	if err := ts.UpdateKeyspace(lockCtx, ki); err != nil {
+		t.Fatalf("UpdateKeyspace failed: %v", err)
+	}
+	unlock(&err)
+	wd := <-changes
+	if wd.Err != nil || !proto.Equal(wd.Value, &topodatapb.Keyspace{DurabilityPolicy: "semi_sync"}) {
+		t.Fatalf("got bad data: %v", wd)
+	}
+
+	// Canceling the watch sends the final error, and closes the channel.
+	cancel()
+	var last *topo.WatchKeyspaceData
+	for wd := range changes {
+		last = wd
+	}
+	if last == nil || !topo.IsErrType(last.Err, topo.Interrupted) {
+		t.Fatalf("got bad final notification: %v", last)
+	}
+}
+
+func TestWatchKeyspacePrefix(t *testing.T) {
+	keyspace := "ks1"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := memorytopo.NewServer("cell1")
+
+	if err := ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace %v failed: %v", keyspace, err)
+	}
+	if err := ts.CreateShard(ctx, keyspace, "-80"); err != nil {
+		t.Fatalf("CreateShard(-80) failed: %v", err)
+	}
+
+	current, changes, err := ts.WatchKeyspacePrefix(ctx, keyspace)
+	if err != nil {
+		t.Fatalf("WatchKeyspacePrefix failed: %v", err)
+	}
+	if len(current) != 1 || current[0].Shard != "-80" || !proto.Equal(current[0].Value, &topodatapb.Shard{KeyRange: current[0].Value.KeyRange, IsPrimaryServing: true}) {
+		t.Fatalf("got bad initial data: %v", current)
+	}
+
+	// A new shard is seen by the same watch.
+	if err := ts.CreateShard(ctx, keyspace, "80-"); err != nil {
+		t.Fatalf("CreateShard(80-) failed: %v", err)
+	}
+	wd := <-changes
+	if wd.Shard != "80-" || wd.Err != nil || wd.Value == nil {
+		t.Fatalf("got bad data for the new shard: %v", wd)
+	}
+
+	if _, err := ts.UpdateShardFields(ctx, keyspace, "-80", func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = false
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateShardFields(-80) failed: %v", err)
+	}
+	wd = <-changes
+	if wd.Shard != "-80" || wd.Err != nil || wd.Value.IsPrimaryServing {
+		t.Fatalf("got bad data for the updated shard: %v", wd)
+	}
+
+	if err := ts.DeleteShard(ctx, keyspace, "80-"); err != nil {
+		t.Fatalf("DeleteShard(80-) failed: %v", err)
+	}
+	wd = <-changes
+	if wd.Shard != "80-" || !topo.IsErrType(wd.Err, topo.NoNode) {
+		t.Fatalf("got bad data for the deleted shard: %v", wd)
+	}
+
+	// Canceling the watch sends the final error.
+	cancel()
+	for wd := range changes {
+		if wd.Shard == "" {
+			if !topo.IsErrType(wd.Err, topo.Interrupted) {
+				t.Fatalf("got bad final error: %v", wd.Err)
+			}
+			break
+		}
+	}
+}
+
+func TestEmulateWatchRecursive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := memorytopo.NewServer("cell1")
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	if err != nil {
+		t.Fatalf("ConnForCell failed: %v", err)
+	}
+	if _, err := conn.Create(ctx, "dir/a", []byte("a1")); err != nil {
+		t.Fatalf("Create(dir/a) failed: %v", err)
+	}
+	if _, err := conn.Create(ctx, "dir/sub/b", []byte("b1")); err != nil {
+		t.Fatalf("Create(dir/sub/b) failed: %v", err)
+	}
+
+	current, changes, err := topo.EmulateWatchRecursive(ctx, conn, "dir", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("EmulateWatchRecursive failed: %v", err)
+	}
+	got := make(map[string]string)
+	for _, wd := range current {
+		got[wd.Path] = string(wd.Contents)
+	}
+	if len(got) != 2 || got["dir/a"] != "a1" || got["dir/sub/b"] != "b1" {
+		t.Fatalf("got bad initial data: %v", got)
+	}
+
+	// A change of a watched file.
+	if _, err := conn.Update(ctx, "dir/sub/b", []byte("b2"), nil); err != nil {
+		t.Fatalf("Update(dir/sub/b) failed: %v", err)
+	}
+	wd := <-changes
+	if wd.Path != "dir/sub/b" || string(wd.Contents) != "b2" {
+		t.Fatalf("got bad change: %v", wd)
+	}
+
+	// A new file is found by the next poll.
+	if _, err := conn.Create(ctx, "dir/sub/c", []byte("c1")); err != nil {
+		t.Fatalf("Create(dir/sub/c) failed: %v", err)
+	}
+	wd = <-changes
+	if wd.Path != "dir/sub/c" || string(wd.Contents) != "c1" {
+		t.Fatalf("got bad new file: %v", wd)
+	}
+
+	if err := conn.Delete(ctx, "dir/a", nil); err != nil {
+		t.Fatalf("Delete(dir/a) failed: %v", err)
+	}
+	wd = <-changes
+	if wd.Path != "dir/a" || !topo.IsErrType(wd.Err, topo.NoNode) {
+		t.Fatalf("got bad deletion: %v", wd)
+	}
+
+	cancel()
+	var last *topo.WatchDataRecursive
+	for wd := range changes {
+		last = wd
+	}
+	if last == nil || last.Path != "" || !topo.IsErrType(last.Err, topo.Interrupted) {
+		t.Fatalf("got bad final notification: %v", last)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestShardLabels(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, "ks", "0"))
+
+	si, err := ts.UpdateShardLabels(ctx, "ks", "0", map[string]string{"owner": "team1", "tier": "gold"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team1", "tier": "gold"}, si.Labels)
+
+	// Labels are preserved across other updates.
+	_, err = ts.UpdateShardFields(ctx, "ks", "0", func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = false
+		return nil
+	})
+	require.NoError(t, err)
+	si, err = ts.GetShard(ctx, "ks", "0")
+	require.NoError(t, err)
+	assert.Equal(t, "gold", si.GetLabels()["tier"])
+
+	// Nothing is written if the labels do not change.
+	si, err = ts.UpdateShardLabels(ctx, "ks", "0", map[string]string{"tier": "gold"}, []string{"unknown"})
+	require.NoError(t, err)
+	assert.Nil(t, si)
+
+	_, err = ts.UpdateShardLabels(ctx, "ks", "0", nil, []string{"owner", "tier"})
+	require.NoError(t, err)
+	si, err = ts.GetShard(ctx, "ks", "0")
+	require.NoError(t, err)
+	assert.Nil(t, si.Labels)
+
+	_, err = ts.UpdateShardLabels(ctx, "ks", "0", map[string]string{"": "value"}, nil)
+	assert.Error(t, err)
+}
+
+func TestKeyspaceLabels(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{
+		DurabilityPolicy: "semi_sync",
+		Labels:           map[string]string{"owner": "team1"},
+	}))
+
+	ki, err := ts.UpdateKeyspaceLabels(ctx, "ks", map[string]string{"owner": "team2", "schedule": "nightly"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team2", "schedule": "nightly"}, ki.Labels)
+
+	ki, err = ts.GetKeyspace(ctx, "ks")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team2", "schedule": "nightly"}, ki.Labels)
+	assert.Equal(t, "semi_sync", ki.DurabilityPolicy)
+
+	ki, err = ts.UpdateKeyspaceLabels(ctx, "ks", nil, []string{"schedule"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team2"}, ki.Labels)
+
+	_, err = ts.UpdateKeyspaceLabels(ctx, "unknown", map[string]string{"owner": "team1"}, nil)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
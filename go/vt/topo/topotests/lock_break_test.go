@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestForceUnlockShard(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, "ks1", "0"))
+
+	// The shard is not locked.
+	_, err := ts.GetShardLock(ctx, "ks1", "0")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	_, err = ts.ForceUnlockShard(ctx, "ks1", "0", "operator", "stuck")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+
+	lockCtx, unlock, err := ts.LockShard(ctx, "ks1", "0", "stuck-workflow")
+	require.NoError(t, err)
+
+	l, err := ts.GetShardLock(ctx, "ks1", "0")
+	require.NoError(t, err)
+	assert.Equal(t, "stuck-workflow", l.Action)
+	assert.Equal(t, "Running", l.Status)
+	assert.NotEmpty(t, l.Time)
+
+	// An operator is required.
+	_, err = ts.ForceUnlockShard(ctx, "ks1", "0", "", "stuck")
+	require.Error(t, err)
+
+	broken, err := ts.ForceUnlockShard(ctx, "ks1", "0", "alice", "vtctld crashed")
+	require.NoError(t, err)
+	assert.Equal(t, "stuck-workflow", broken.Action)
+	_, err = ts.GetShardLock(ctx, "ks1", "0")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+
+	// Someone else can take the lock, and the former holder can't
+	// release it.
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, unlock2, err := ts.LockShard(ctx2, "ks1", "0", "next-workflow")
+	require.NoError(t, err)
+	assert.Error(t, topo.CheckShardLocked(lockCtx, "ks1", "0"))
+	var finalErr error
+	unlock(&finalErr)
+	assert.Error(t, finalErr)
+	l, err = ts.GetShardLock(ctx, "ks1", "0")
+	require.NoError(t, err)
+	assert.Equal(t, "next-workflow", l.Action)
+	finalErr = nil
+	unlock2(&finalErr)
+	require.NoError(t, finalErr)
+
+	history, err := ts.GetShardLockHistory(ctx, "ks1", "0")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "alice", history[0].Operator)
+	assert.Equal(t, "vtctld crashed", history[0].Reason)
+	assert.Equal(t, "stuck-workflow", history[0].Lock.Action)
+
+	// The history of the shard doesn't make it appear as a shard.
+	shards, err := ts.GetShardNames(ctx, "ks1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0"}, shards)
+}
+
+func TestBreakLockTakenAgain(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, "ks1", "0"))
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+	lic, ok := conn.(topo.LockInspectorConn)
+	require.True(t, ok)
+	shardPath := path.Join(topo.KeyspacesPath, "ks1", topo.ShardsPath, "0")
+
+	_, unlock, err := ts.LockShard(ctx, "ks1", "0", "stuck-workflow")
+	require.NoError(t, err)
+	_, version, err := lic.LockHolder(ctx, shardPath)
+	require.NoError(t, err)
+
+	// The lock is released and taken again before it is broken: the
+	// new holding is not broken.
+	var finalErr error
+	unlock(&finalErr)
+	require.NoError(t, finalErr)
+	_, unlock2, err := ts.LockShard(ctx, "ks1", "0", "next-workflow")
+	require.NoError(t, err)
+	err = lic.BreakLock(ctx, shardPath, version)
+	assert.True(t, topo.IsErrType(err, topo.BadVersion), "unexpected error: %v", err)
+	l, err := ts.GetShardLock(ctx, "ks1", "0")
+	require.NoError(t, err)
+	assert.Equal(t, "next-workflow", l.Action)
+
+	// The current holding can be broken.
+	_, version, err = lic.LockHolder(ctx, shardPath)
+	require.NoError(t, err)
+	require.NoError(t, lic.BreakLock(ctx, shardPath, version))
+	_, err = ts.GetShardLock(ctx, "ks1", "0")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	unlock2(&finalErr)
+	assert.Error(t, finalErr)
+}
+
+func TestForceUnlockKeyspace(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+
+	for i, operator := range []string{"alice", "bob"} {
+		_, unlock, err := ts.LockKeyspace(ctx, "ks1", "reshard")
+		require.NoError(t, err)
+		_, err = ts.ForceUnlockKeyspace(ctx, "ks1", operator, "stuck")
+		require.NoError(t, err)
+		var finalErr error
+		unlock(&finalErr)
+
+		history, err := ts.GetKeyspaceLockHistory(ctx, "ks1")
+		require.NoError(t, err)
+		require.Len(t, history, i+1)
+		assert.Equal(t, operator, history[i].Operator)
+		assert.Equal(t, "reshard", history[i].Lock.Action)
+	}
+
+	// The history of the shards is separate.
+	history, err := ts.GetShardLockHistory(ctx, "ks1", "0")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
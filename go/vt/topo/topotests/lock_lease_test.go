@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// checkFactory is a memorytopo.Factory whose locks fail their Check
+// with the error set by setCheckError.
+type checkFactory struct {
+	*memorytopo.Factory
+
+	mu       sync.Mutex
+	checkErr error
+}
+
+func (f *checkFactory) setCheckError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checkErr = err
+}
+
+// Create is part of the topo.Factory interface.
+func (f *checkFactory) Create(cell, serverAddr, root string) (topo.Conn, error) {
+	conn, err := f.Factory.Create(cell, serverAddr, root)
+	if err != nil {
+		return nil, err
+	}
+	return &checkConn{Conn: conn, f: f}, nil
+}
+
+type checkConn struct {
+	topo.Conn
+	f *checkFactory
+}
+
+// Lock is part of the topo.Conn interface.
+func (c *checkConn) Lock(ctx context.Context, dirPath, contents string) (topo.LockDescriptor, error) {
+	ld, err := c.Conn.Lock(ctx, dirPath, contents)
+	if err != nil {
+		return nil, err
+	}
+	return &checkLockDescriptor{LockDescriptor: ld, f: c.f}, nil
+}
+
+type checkLockDescriptor struct {
+	topo.LockDescriptor
+	f *checkFactory
+}
+
+// Check is part of the topo.LockDescriptor interface.
+func (ld *checkLockDescriptor) Check(ctx context.Context) error {
+	ld.f.mu.Lock()
+	defer ld.f.mu.Unlock()
+	return ld.f.checkErr
+}
+
+func TestLockShardLease(t *testing.T) {
+	ctx := context.Background()
+	_, memFactory := memorytopo.NewServerAndFactory("cell1")
+	factory := &checkFactory{Factory: memFactory}
+	ts, err := topo.NewWithFactory(factory, "", "")
+	if err != nil {
+		t.Fatalf("NewWithFactory failed: %v", err)
+	}
+	if err := ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard(ctx, "ks1", "0"); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+
+	expired := make(chan error, 1)
+	lockCtx, unlock, err := ts.LockShard(ctx, "ks1", "0", "test",
+		topo.WithLeaseTTL(300*time.Millisecond),
+		topo.WithLeaseExpiredCallback(func(err error) { expired <- err }))
+	if err != nil {
+		t.Fatalf("LockShard failed: %v", err)
+	}
+
+	// The heartbeat keeps the lease while the lock can be checked.
+	time.Sleep(time.Second)
+	if err := topo.CheckShardLocked(lockCtx, "ks1", "0"); err != nil {
+		t.Fatalf("CheckShardLocked failed: %v", err)
+	}
+	if lockCtx.Err() != nil {
+		t.Fatalf("lock context canceled: %v", lockCtx.Err())
+	}
+
+	// The lease expires if the lock can't be checked for its TTL.
+	checkErr := errors.New("topo down")
+	factory.setCheckError(checkErr)
+	select {
+	case err := <-expired:
+		if err != checkErr {
+			t.Errorf("expiry callback got %v, expected %v", err, checkErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the lease to expire")
+	}
+	<-lockCtx.Done()
+	factory.setCheckError(nil)
+	if err := topo.CheckShardLocked(lockCtx, "ks1", "0"); err == nil {
+		t.Errorf("CheckShardLocked succeeded after the lease expired")
+	}
+
+	var finalErr error
+	unlock(&finalErr)
+	if finalErr != nil {
+		t.Fatalf("unlock failed: %v", finalErr)
+	}
+}
+
+func TestLockKeyspaceLeaseUnlock(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+
+	lockCtx, unlock, err := ts.LockKeyspace(ctx, "ks1", "test",
+		topo.WithLeaseTTL(300*time.Millisecond),
+		topo.WithLeaseExpiredCallback(func(err error) { t.Errorf("lease expired: %v", err) }))
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	if err := topo.CheckKeyspaceLocked(lockCtx, "ks1"); err != nil {
+		t.Fatalf("CheckKeyspaceLocked failed: %v", err)
+	}
+
+	// Releasing the lock stops the heartbeat, and cancels its
+	// context.
+	var finalErr error
+	unlock(&finalErr)
+	if finalErr != nil {
+		t.Fatalf("unlock failed: %v", finalErr)
+	}
+	if lockCtx.Err() == nil {
+		t.Errorf("lock context not canceled after unlock")
+	}
+
+	// The keyspace can be locked again.
+	_, unlock, err = ts.LockKeyspace(ctx, "ks1", "test")
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	unlock(&finalErr)
+	if finalErr != nil {
+		t.Fatalf("unlock failed: %v", finalErr)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestMigrationPhases(t *testing.T) {
+	ctx := context.Background()
+	oldTS := memorytopo.NewServer("cell1")
+	newTS := memorytopo.NewServer("cell1")
+	require.NoError(t, oldTS.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+
+	ts, err := topo.NewMigrationServer(oldTS, newTS, topo.MigrationDualWrite, true)
+	require.NoError(t, err)
+	phase, ok := ts.MigrationPhase()
+	assert.True(t, ok)
+	assert.Equal(t, topo.MigrationDualWrite, phase)
+
+	// Dual write: the old server is read, both are written. The
+	// keyspace that was not copied is a mismatch.
+	_, err = ts.GetKeyspace(ctx, "ks1")
+	require.NoError(t, err)
+	assert.Contains(t, expvar.Get("TopologyMigrationMismatches").String(), `"Get"`)
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks2", &topodatapb.Keyspace{}))
+	for _, s := range []*topo.Server{oldTS, newTS} {
+		_, err := s.GetKeyspace(ctx, "ks2")
+		assert.NoError(t, err)
+	}
+	require.NoError(t, ts.CreateTablet(ctx, &topodatapb.Tablet{
+		Alias:    &topodatapb.TabletAlias{Cell: "cell1", Uid: 1},
+		Keyspace: "ks2",
+		Shard:    "0",
+	}))
+	_, err = newTS.GetTablet(ctx, &topodatapb.TabletAlias{Cell: "cell1", Uid: 1})
+	assert.NoError(t, err)
+
+	// The locks are taken on both servers.
+	lockCtx, unlock, err := ts.LockKeyspace(ctx, "ks2", "test")
+	require.NoError(t, err)
+	for _, s := range []*topo.Server{oldTS, newTS} {
+		shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		_, _, err := s.LockKeyspace(shortCtx, "ks2", "test")
+		cancel()
+		assert.Error(t, err)
+	}
+	require.NoError(t, topo.CheckKeyspaceLocked(lockCtx, "ks2"))
+	unlock(&err)
+	require.NoError(t, err)
+
+	// Switch read: the new server is read, both are written.
+	require.NoError(t, ts.SetMigrationPhase(topo.MigrationSwitchRead))
+	_, err = ts.GetKeyspace(ctx, "ks1")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "ks1 was not copied to the new server: %v", err)
+	require.NoError(t, ts.DeleteKeyspace(ctx, "ks2"))
+	for _, s := range []*topo.Server{oldTS, newTS} {
+		_, err := s.GetKeyspace(ctx, "ks2")
+		assert.True(t, topo.IsErrType(err, topo.NoNode), "ks2 was not deleted: %v", err)
+	}
+
+	// Switch write: only the new server is used.
+	require.NoError(t, ts.SetMigrationPhase(topo.MigrationSwitchWrite))
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks3", &topodatapb.Keyspace{}))
+	_, err = newTS.GetKeyspace(ctx, "ks3")
+	assert.NoError(t, err)
+	_, err = oldTS.GetKeyspace(ctx, "ks3")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "ks3 was written to the old server: %v", err)
+
+	assert.Error(t, oldTS.SetMigrationPhase(topo.MigrationSwitchRead))
+}
+
+func TestMigrationCellsNotMirrored(t *testing.T) {
+	ctx := context.Background()
+	oldTS := memorytopo.NewServer("cell1")
+	newTS := memorytopo.NewServer("cell1")
+	ts, err := topo.NewMigrationServer(oldTS, newTS, topo.MigrationDualWrite, true)
+	require.NoError(t, err)
+
+	require.NoError(t, ts.UpdateCellInfoFields(ctx, "cell1", func(ci *topodatapb.CellInfo) error {
+		ci.Root = "/other"
+		return nil
+	}))
+	ci, err := newTS.GetCellInfo(ctx, "cell1", true)
+	require.NoError(t, err)
+	assert.NotEqual(t, "/other", ci.Root)
+}
+
+func TestMigrationDivergence(t *testing.T) {
+	ctx := context.Background()
+	oldTS := memorytopo.NewServer("cell1")
+	newTS := memorytopo.NewServer("cell1")
+	ts, err := topo.NewMigrationServer(oldTS, newTS, topo.MigrationDualWrite, false)
+	require.NoError(t, err)
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+	newConn, err := newTS.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+
+	divergences := func() string {
+		return expvar.Get("TopologyMigrationDivergences").String()
+	}
+	before := divergences()
+	version, err := conn.Create(ctx, "/file", []byte("a"))
+	require.NoError(t, err)
+	version, err = conn.Update(ctx, "/file", []byte("b"), version)
+	require.NoError(t, err)
+	assert.Equal(t, before, divergences())
+
+	// Someone else writes the new server: the next mirrored write
+	// counts the divergence, and copies the file from the old server.
+	_, err = newConn.Update(ctx, "/file", []byte("other"), nil)
+	require.NoError(t, err)
+	_, err = conn.Update(ctx, "/file", []byte("c"), version)
+	require.NoError(t, err)
+	assert.Contains(t, divergences(), `"Update"`)
+	contents, _, err := newConn.Get(ctx, "/file")
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(contents))
+}
+
+func TestMigrationWatchSwitch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	oldTS := memorytopo.NewServer("cell1")
+	newTS := memorytopo.NewServer("cell1")
+	ts, err := topo.NewMigrationServer(oldTS, newTS, topo.MigrationDualWrite, false)
+	require.NoError(t, err)
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+	oldConn, err := oldTS.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+	newConn, err := newTS.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+
+	_, err = conn.Create(ctx, "/file", []byte("a"))
+	require.NoError(t, err)
+	current, changes, err := conn.Watch(ctx, "/file")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(current.Contents))
+
+	// A change of the new server only is sent when the watch moves to
+	// it.
+	_, err = newConn.Update(ctx, "/file", []byte("b"), nil)
+	require.NoError(t, err)
+	require.NoError(t, ts.SetMigrationPhase(topo.MigrationSwitchRead))
+	wd := <-changes
+	require.NoError(t, wd.Err)
+	assert.Equal(t, "b", string(wd.Contents))
+
+	// The old server is not watched any more.
+	_, err = oldConn.Update(ctx, "/file", []byte("old"), nil)
+	require.NoError(t, err)
+	_, err = newConn.Update(ctx, "/file", []byte("c"), nil)
+	require.NoError(t, err)
+	wd = <-changes
+	require.NoError(t, wd.Err)
+	assert.Equal(t, "c", string(wd.Contents))
+
+	cancel()
+	for wd := range changes {
+		assert.True(t, topo.IsErrType(wd.Err, topo.Interrupted), "unexpected watch data: %v", wd)
+	}
+}
+
+func TestParseMigrationPhase(t *testing.T) {
+	for _, phase := range []topo.MigrationPhase{topo.MigrationDualWrite, topo.MigrationSwitchRead, topo.MigrationSwitchWrite} {
+		parsed, err := topo.ParseMigrationPhase(phase.String())
+		require.NoError(t, err)
+		assert.Equal(t, phase, parsed)
+	}
+	_, err := topo.ParseMigrationPhase("unknown")
+	assert.Error(t, err)
+}
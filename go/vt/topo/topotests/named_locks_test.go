@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestLockName(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+
+	for _, name := range []string{"", "a/b", ".."} {
+		_, _, err := ts.LockName(ctx, name, "test")
+		assert.Error(t, err, "name %q", name)
+	}
+
+	lockCtx, unlock, err := ts.LockName(ctx, "ks1", "migration")
+	require.NoError(t, err)
+	require.NoError(t, topo.CheckNameLocked(lockCtx, "ks1"))
+	assert.Error(t, topo.CheckNameLocked(lockCtx, "other"))
+
+	// The same name can't be locked twice in the same context.
+	_, _, err = ts.LockName(lockCtx, "ks1", "migration")
+	require.Error(t, err)
+
+	// Named locks don't conflict with the keyspace locks, nor with
+	// each other.
+	_, unlockKeyspace, err := ts.LockKeyspace(lockCtx, "ks1", "reshard")
+	require.NoError(t, err)
+	_, unlockOther, err := ts.LockName(ctx, "other", "migration")
+	require.NoError(t, err)
+
+	l, err := ts.GetNamedLock(ctx, "ks1")
+	require.NoError(t, err)
+	assert.Equal(t, "migration", l.Action)
+
+	// Another process waits for the lock.
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err = ts.LockName(shortCtx, "ks1", "migration")
+	assert.True(t, topo.IsErrType(err, topo.Timeout), "unexpected error: %v", err)
+
+	var finalErr error
+	unlock(&finalErr)
+	require.NoError(t, finalErr)
+	unlockKeyspace(&finalErr)
+	require.NoError(t, finalErr)
+	unlockOther(&finalErr)
+	require.NoError(t, finalErr)
+	_, err = ts.GetNamedLock(ctx, "ks1")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+
+	// The name can be locked again, and broken.
+	_, unlock, err = ts.LockName(ctx, "ks1", "migration", topo.WithLeaseTTL(time.Second))
+	require.NoError(t, err)
+	_, err = ts.ForceUnlockName(ctx, "ks1", "alice", "stuck")
+	require.NoError(t, err)
+	unlock(&finalErr)
+	assert.Error(t, finalErr)
+	history, err := ts.GetNamedLockHistory(ctx, "ks1")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "alice", history[0].Operator)
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"expvar"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// readCacheHits returns the number of reads served from the read cache
+// of a cell.
+func readCacheHits(cell string) int64 {
+	return expvar.Get("TopologyCacheHits").(*stats.CountersWithSingleLabel).Counts()[cell]
+}
+
+// waitForKeyspace reads a keyspace until its durability policy is the
+// expected one.
+func waitForKeyspace(t *testing.T, ts *topo.Server, keyspace, durabilityPolicy string) *topo.KeyspaceInfo {
+	ctx := context.Background()
+	start := time.Now()
+	for {
+		ki, err := ts.GetKeyspace(ctx, keyspace)
+		if err != nil {
+			t.Fatalf("GetKeyspace failed: %v", err)
+		}
+		if ki.DurabilityPolicy == durabilityPolicy {
+			return ki
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("time out waiting for durability policy %v, got %v", durabilityPolicy, ki.DurabilityPolicy)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadCache(t *testing.T) {
+	keyspace := "ks1"
+	ctx := context.Background()
+	ts, factory := memorytopo.NewServerAndFactory("cell1")
+	ts.EnableReadCache(time.Hour, 0)
+	defer ts.Close()
+
+	// Another server on the same data, without a cache.
+	other, err := topo.NewWithFactory(factory, "", "")
+	if err != nil {
+		t.Fatalf("NewWithFactory failed: %v", err)
+	}
+	defer other.Close()
+
+	if err := other.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{DurabilityPolicy: "none"}); err != nil {
+		t.Fatalf("CreateKeyspace %v failed: %v", keyspace, err)
+	}
+
+	// The first read starts the watch, the next ones are served
+	// from memory once it's running.
+	start := time.Now()
+	hits := readCacheHits(topo.GlobalCell)
+	for readCacheHits(topo.GlobalCell) == hits {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("time out waiting for a cached read")
+		}
+		waitForKeyspace(t, ts, keyspace, "none")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A change made by another server is seen through the watch.
+	lockCtx, unlock, err := other.LockKeyspace(ctx, keyspace, "TestReadCache")
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	ki, err := other.GetKeyspace(lockCtx, keyspace)
+	if err != nil {
+		t.Fatalf("GetKeyspace failed: %v", err)
+	}
+	ki.DurabilityPolicy = "semi_sync"
+	if err := other.UpdateKeyspace(lockCtx, ki); err != nil {
+		t.Fatalf("UpdateKeyspace failed: %v", err)
+	}
+	unlock(&err)
+	ki = waitForKeyspace(t, ts, keyspace, "semi_sync")
+
+	// A change made through the cache is seen right away, with the
+	// right version.
+	lockCtx, unlock, err = ts.LockKeyspace(ctx, keyspace, "TestReadCache")
+	if err != nil {
+		t.Fatalf("LockKeyspace failed: %v", err)
+	}
+	for _, policy := range []string{"none", "semi_sync", "none"} {
+		ki.DurabilityPolicy = policy
+		if err := ts.UpdateKeyspace(lockCtx, ki); err != nil {
+			t.Fatalf("UpdateKeyspace(%v) failed: %v", policy, err)
+		}
+		ki, err = ts.GetKeyspace(lockCtx, keyspace)
+		if err != nil {
+			t.Fatalf("GetKeyspace failed: %v", err)
+		}
+		if ki.DurabilityPolicy != policy {
+			t.Fatalf("got durability policy %v after update, expected %v", ki.DurabilityPolicy, policy)
+		}
+	}
+	unlock(&err)
+
+	// A deleted record is not served from the cache.
+	if err := ts.DeleteKeyspace(ctx, keyspace); err != nil {
+		t.Fatalf("DeleteKeyspace failed: %v", err)
+	}
+	if _, err := ts.GetKeyspace(ctx, keyspace); !topo.IsErrType(err, topo.NoNode) {
+		t.Fatalf("GetKeyspace of a deleted keyspace returned: %v", err)
+	}
+}
+
+func TestReadCacheMaxStaleness(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	ts.EnableReadCache(time.Nanosecond, 0)
+	defer ts.Close()
+
+	tablet := &topodatapb.Tablet{
+		Alias:    &topodatapb.TabletAlias{Cell: "cell1", Uid: 1},
+		Keyspace: "ks1",
+		Shard:    "0",
+	}
+	if err := ts.CreateTablet(ctx, tablet); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+
+	// All the cached copies are too old, so every read goes to the
+	// topo server.
+	hits := readCacheHits("cell1")
+	for i := 0; i < 10; i++ {
+		if _, err := ts.GetTablet(ctx, tablet.Alias); err != nil {
+			t.Fatalf("GetTablet failed: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := readCacheHits("cell1"); got != hits {
+		t.Fatalf("got %v cached reads with a max staleness of 1ns", got-hits)
+	}
+}
+
+func TestReadCacheEnabledInUse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ts := memorytopo.NewServer("cell1")
+	defer ts.Close()
+	if err := ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+
+	// The connections are wrapped while they are in use.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if _, err := ts.GetKeyspace(ctx, "ks1"); err != nil && ctx.Err() == nil {
+				t.Errorf("GetKeyspace failed: %v", err)
+				return
+			}
+		}
+	}()
+	ts.EnableReadCache(time.Hour, 0)
+	ts.SetRetryPolicy(topo.RetryPolicy{MaxAttempts: 2})
+	waitForKeyspace(t, ts, "ks1", "")
+	cancel()
+	<-done
+}
+
+func TestReadCacheMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	ts.EnableReadCache(time.Hour, 2)
+	defer ts.Close()
+
+	evictions := func() int64 {
+		return expvar.Get("TopologyCacheEvictions").(*stats.CountersWithSingleLabel).Counts()["cell1"]
+	}
+	entries := func() int64 {
+		return expvar.Get("TopologyCacheEntries").(*stats.GaugesWithSingleLabel).Counts()["cell1"]
+	}
+	evicted, cached := evictions(), entries()
+
+	var aliases []*topodatapb.TabletAlias
+	for uid := uint32(1); uid <= 3; uid++ {
+		tablet := &topodatapb.Tablet{
+			Alias:    &topodatapb.TabletAlias{Cell: "cell1", Uid: uid},
+			Keyspace: "ks1",
+			Shard:    "0",
+		}
+		if err := ts.CreateTablet(ctx, tablet); err != nil {
+			t.Fatalf("CreateTablet failed: %v", err)
+		}
+		aliases = append(aliases, tablet.Alias)
+	}
+
+	// The third record read drops the first one, the least recently
+	// read.
+	for _, alias := range aliases {
+		if _, err := ts.GetTablet(ctx, alias); err != nil {
+			t.Fatalf("GetTablet failed: %v", err)
+		}
+	}
+	if got := evictions() - evicted; got != 1 {
+		t.Fatalf("got %v evictions, expected 1", got)
+	}
+	if got := entries() - cached; got != 2 {
+		t.Fatalf("got %v cached records, expected 2", got)
+	}
+
+	// The records that are still cached are served from memory.
+	start := time.Now()
+	hits := readCacheHits("cell1")
+	for readCacheHits("cell1") == hits {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("time out waiting for a cached read")
+		}
+		if _, err := ts.GetTablet(ctx, aliases[2]); err != nil {
+			t.Fatalf("GetTablet failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
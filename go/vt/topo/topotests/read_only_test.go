@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2")
+	if err := ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if _, err := ts.ConnForCell(ctx, "cell1"); err != nil {
+		t.Fatalf("ConnForCell failed: %v", err)
+	}
+
+	if err := ts.SetReadOnly(true); err != nil {
+		t.Fatalf("SetReadOnly failed: %v", err)
+	}
+	readOnly, err := ts.IsReadOnly()
+	if err != nil || !readOnly {
+		t.Fatalf("IsReadOnly() = %v, %v, expected true", readOnly, err)
+	}
+
+	// The reads work, the writes and locks fail.
+	if _, err := ts.GetKeyspace(ctx, "ks1"); err != nil {
+		t.Errorf("GetKeyspace failed: %v", err)
+	}
+	err = ts.CreateKeyspace(ctx, "ks2", &topodatapb.Keyspace{})
+	if !topo.IsErrType(err, topo.ReadOnly) {
+		t.Errorf("CreateKeyspace returned %v, expected ReadOnly", err)
+	}
+	if code := vterrors.Code(err); code != vtrpcpb.Code_READ_ONLY {
+		t.Errorf("CreateKeyspace returned code %v, expected READ_ONLY", code)
+	}
+	if err := ts.DeleteKeyspace(ctx, "ks1"); !topo.IsErrType(err, topo.ReadOnly) {
+		t.Errorf("DeleteKeyspace returned %v, expected ReadOnly", err)
+	}
+	if _, _, err := ts.LockKeyspace(ctx, "ks1", "test"); !topo.IsErrType(err, topo.ReadOnly) {
+		t.Errorf("LockKeyspace returned %v, expected ReadOnly", err)
+	}
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	if err != nil {
+		t.Fatalf("ConnForCell failed: %v", err)
+	}
+	if _, err := conn.NewLeaderParticipation("election", "id"); !topo.IsErrType(err, topo.ReadOnly) {
+		t.Errorf("NewLeaderParticipation returned %v, expected ReadOnly", err)
+	}
+
+	// A connection created after the switch is read-only too.
+	for _, cell := range []string{"cell1", "cell2"} {
+		conn, err := ts.ConnForCell(ctx, cell)
+		if err != nil {
+			t.Fatalf("ConnForCell(%v) failed: %v", cell, err)
+		}
+		if _, err := conn.Create(ctx, "file", []byte("a")); !topo.IsErrType(err, topo.ReadOnly) {
+			t.Errorf("Create in %v returned %v, expected ReadOnly", cell, err)
+		}
+	}
+
+	// The writes work again after the switch is turned off.
+	if err := ts.SetReadOnly(false); err != nil {
+		t.Fatalf("SetReadOnly failed: %v", err)
+	}
+	if err := ts.CreateKeyspace(ctx, "ks2", &topodatapb.Keyspace{}); err != nil {
+		t.Errorf("CreateKeyspace failed: %v", err)
+	}
+	conn, err = ts.ConnForCell(ctx, "cell2")
+	if err != nil {
+		t.Fatalf("ConnForCell failed: %v", err)
+	}
+	if _, err := conn.Create(ctx, "file", []byte("a")); err != nil {
+		t.Errorf("Create failed: %v", err)
+	}
+}
@@ -18,9 +18,13 @@ package topotests
 
 import (
 	"context"
+	"errors"
+	"path"
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
 
 	"vitess.io/vitess/go/vt/logutil"
@@ -173,3 +177,187 @@ func TestFixShardReplication(t *testing.T) {
 		t.Errorf("Wrong log: %v", logger.String())
 	}
 }
+
+func TestFindAllTabletAliasesInShardPartialResult(t *testing.T) {
+	keyspace := "ks1"
+	shard := "shard1"
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2", "cell3")
+
+	for i, cell := range []string{"cell1", "cell2"} {
+		tablet := &topodatapb.Tablet{
+			Keyspace: keyspace,
+			Shard:    shard,
+			Alias:    &topodatapb.TabletAlias{Cell: cell, Uid: uint32(i + 1)},
+		}
+		require.NoError(t, ts.CreateTablet(ctx, tablet))
+	}
+	require.NoError(t, ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, keyspace, shard))
+
+	// Corrupt the replication graph of cell2, so it cannot be read.
+	conn, err := ts.ConnForCell(ctx, "cell2")
+	require.NoError(t, err)
+	_, err = conn.Update(ctx, path.Join(topo.KeyspacesPath, keyspace, topo.ShardsPath, shard, topo.ShardReplicationFile), []byte("bad data"), nil)
+	require.NoError(t, err)
+
+	aliases, err := ts.FindAllTabletAliasesInShard(ctx, keyspace, shard)
+	require.Error(t, err)
+	assert.True(t, topo.IsErrType(err, topo.PartialResult), "unexpected error: %v", err)
+	require.Len(t, aliases, 1)
+	assert.Equal(t, "cell1", aliases[0].Cell)
+
+	var prerr *topo.PartialResultError
+	require.True(t, errors.As(err, &prerr), "unexpected error type: %T", err)
+	assert.Equal(t, shard, prerr.Node)
+	assert.Equal(t, []string{"cell2"}, prerr.Cells())
+	assert.Contains(t, err.Error(), "cell2")
+
+	// The tablet map forwards the failed cells.
+	tablets, err := ts.GetTabletMapForShard(ctx, keyspace, shard)
+	require.True(t, errors.As(err, &prerr), "unexpected error: %v", err)
+	assert.Equal(t, []string{"cell2"}, prerr.Cells())
+	assert.Len(t, tablets, 1)
+}
+
+func TestRemoveOrphanedShardReplicationNodes(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2")
+
+	alias := &topodatapb.TabletAlias{Cell: "cell1", Uid: 1}
+	require.NoError(t, ts.CreateTablet(ctx, &topodatapb.Tablet{
+		Keyspace: "ks1",
+		Shard:    "0",
+		Alias:    alias,
+	}))
+	addNode := func(cell, keyspace, shard string, uid uint32) {
+		require.NoError(t, ts.UpdateShardReplicationFields(ctx, cell, keyspace, shard, func(sr *topodatapb.ShardReplication) error {
+			sr.Nodes = append(sr.Nodes, &topodatapb.ShardReplication_Node{
+				TabletAlias: &topodatapb.TabletAlias{Cell: cell, Uid: uid},
+			})
+			return nil
+		}))
+	}
+	addNode("cell1", "ks1", "0", 2)
+	addNode("cell1", "ks1", "0", 3)
+	// The shard doesn't need to be in the global topology.
+	addNode("cell2", "ks2", "-80", 4)
+
+	orphanStrings := func(orphans []*topo.OrphanedShardReplicationNode) []string {
+		var result []string
+		for _, o := range orphans {
+			result = append(result, o.Cell+" "+o.Keyspace+"/"+o.Shard+" "+topoproto.TabletAliasString(o.TabletAlias))
+		}
+		return result
+	}
+	nodeCount := func(cell, keyspace, shard string) int {
+		sri, err := ts.GetShardReplication(ctx, cell, keyspace, shard)
+		require.NoError(t, err)
+		return len(sri.Nodes)
+	}
+
+	// A dry run only reports the orphans.
+	logger := logutil.NewMemoryLogger()
+	orphans, err := topo.RemoveOrphanedShardReplicationNodes(ctx, ts, logger, nil, true /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"cell1 ks1/0 cell1-0000000002",
+		"cell1 ks1/0 cell1-0000000003",
+		"cell2 ks2/-80 cell2-0000000004",
+	}, orphanStrings(orphans))
+	assert.Equal(t, 3, nodeCount("cell1", "ks1", "0"))
+	assert.Contains(t, logger.String(), "but does not exist")
+
+	// Only the given cells are scanned.
+	orphans, err = topo.RemoveOrphanedShardReplicationNodes(ctx, ts, logger, []string{"cell1"}, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"cell1 ks1/0 cell1-0000000002",
+		"cell1 ks1/0 cell1-0000000003",
+	}, orphanStrings(orphans))
+	sri, err := ts.GetShardReplication(ctx, "cell1", "ks1", "0")
+	require.NoError(t, err)
+	require.Len(t, sri.Nodes, 1)
+	assert.True(t, proto.Equal(alias, sri.Nodes[0].TabletAlias))
+	assert.Equal(t, 1, nodeCount("cell2", "ks2", "-80"))
+
+	orphans, err = topo.RemoveOrphanedShardReplicationNodes(ctx, ts, logger, nil, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cell2 ks2/-80 cell2-0000000004"}, orphanStrings(orphans))
+	assert.Equal(t, 0, nodeCount("cell2", "ks2", "-80"))
+
+	// Nothing is left to remove.
+	orphans, err = topo.RemoveOrphanedShardReplicationNodes(ctx, ts, logger, nil, false /* dryRun */)
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestRebuildShardReplication(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, "ks1", "0"))
+
+	for _, tablet := range []*topodatapb.Tablet{
+		{Keyspace: "ks1", Shard: "0", Alias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 1}},
+		{Keyspace: "ks1", Shard: "0", Alias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 2}},
+		{Keyspace: "ks1", Shard: "0", Alias: &topodatapb.TabletAlias{Cell: "cell2", Uid: 3}},
+		{Keyspace: "ks2", Shard: "0", Alias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 4}},
+	} {
+		require.NoError(t, ts.CreateTablet(ctx, tablet))
+	}
+
+	// Break the replication graph of cell1: tablet 2 is missing, and
+	// there are entries for a tablet that doesn't exist and a tablet
+	// of another keyspace.
+	require.NoError(t, ts.UpdateShardReplicationFields(ctx, "cell1", "ks1", "0", func(sr *topodatapb.ShardReplication) error {
+		sr.Nodes = []*topodatapb.ShardReplication_Node{
+			{TabletAlias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 1}},
+			{TabletAlias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 4}},
+			{TabletAlias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 5}},
+		}
+		return nil
+	}))
+
+	added, removed, err := ts.RebuildShardReplication(ctx, "cell1", "ks1", "0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cell1-0000000002"}, topoproto.TabletAliasList(added).ToStringSlice())
+	assert.Equal(t, []string{"cell1-0000000004", "cell1-0000000005"}, topoproto.TabletAliasList(removed).ToStringSlice())
+
+	sri, err := ts.GetShardReplication(ctx, "cell1", "ks1", "0")
+	require.NoError(t, err)
+	var aliases []*topodatapb.TabletAlias
+	for _, node := range sri.Nodes {
+		aliases = append(aliases, node.TabletAlias)
+	}
+	assert.Equal(t, []string{"cell1-0000000001", "cell1-0000000002"}, topoproto.TabletAliasList(aliases).ToStringSlice())
+
+	// The graph is now up to date, in all the cells.
+	for _, cell := range []string{"cell1", "cell2"} {
+		added, removed, err = ts.RebuildShardReplication(ctx, cell, "ks1", "0")
+		require.NoError(t, err)
+		assert.Empty(t, added)
+		assert.Empty(t, removed)
+	}
+
+	// DeleteTablet leaves the tablet in the replication graph.
+	require.NoError(t, ts.DeleteTablet(ctx, &topodatapb.TabletAlias{Cell: "cell2", Uid: 3}))
+	_, removed, err = ts.RebuildShardReplication(ctx, "cell2", "ks1", "0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cell2-0000000003"}, topoproto.TabletAliasList(removed).ToStringSlice())
+
+	// Duplicate entries are removed.
+	require.NoError(t, ts.UpdateShardReplicationFields(ctx, "cell1", "ks1", "0", func(sr *topodatapb.ShardReplication) error {
+		sr.Nodes = append(sr.Nodes, &topodatapb.ShardReplication_Node{TabletAlias: &topodatapb.TabletAlias{Cell: "cell1", Uid: 1}})
+		return nil
+	}))
+	_, _, err = ts.RebuildShardReplication(ctx, "cell1", "ks1", "0")
+	require.NoError(t, err)
+	sri, err = ts.GetShardReplication(ctx, "cell1", "ks1", "0")
+	require.NoError(t, err)
+	assert.Len(t, sri.Nodes, 2)
+
+	// The shard must exist.
+	_, _, err = ts.RebuildShardReplication(ctx, "cell1", "ks2", "0")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// TestRetryPolicy checks the Server works with a retry policy, set
+// before and after the connections to the cells are created, and
+// combined with the read cache.
+func TestRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2")
+	defer ts.Close()
+
+	tablet := &topodatapb.Tablet{
+		Alias:    &topodatapb.TabletAlias{Cell: "cell1", Uid: 1},
+		Keyspace: "ks",
+		Shard:    "0",
+	}
+	require.NoError(t, ts.CreateTablet(ctx, tablet))
+
+	ts.EnableReadCache(time.Minute, 0)
+	ts.SetRetryPolicy(topo.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	ts.SetRetryPolicy(topo.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+	_, err := ts.GetKeyspace(ctx, "ks")
+	require.NoError(t, err)
+
+	_, err = ts.GetTablet(ctx, tablet.Alias)
+	require.NoError(t, err)
+
+	tablet.Alias = &topodatapb.TabletAlias{Cell: "cell2", Uid: 2}
+	require.NoError(t, ts.CreateTablet(ctx, tablet))
+	_, err = ts.GetTablet(ctx, tablet.Alias)
+	require.NoError(t, err)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+func TestUpdateRoutingRulesFields(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	addRule := func(from, to string) func(*vschemapb.RoutingRules) error {
+		return func(rr *vschemapb.RoutingRules) error {
+			for _, r := range rr.Rules {
+				if r.FromTable == from {
+					return topo.NewError(topo.NoUpdateNeeded, from)
+				}
+			}
+			rr.Rules = append(rr.Rules, &vschemapb.RoutingRule{FromTable: from, ToTables: []string{to}})
+			return nil
+		}
+	}
+
+	// The rules are created if there are none yet. A concurrent
+	// creation makes the first write fail, and the update is retried.
+	calls := 0
+	require.NoError(t, ts.UpdateRoutingRulesFields(ctx, func(rr *vschemapb.RoutingRules) error {
+		calls++
+		if calls == 1 {
+			require.NoError(t, ts.UpdateRoutingRulesFields(ctx, addRule("t1", "ks1.t1")))
+		}
+		return addRule("t2", "ks1.t2")(rr)
+	}))
+	assert.Equal(t, 2, calls)
+
+	// A concurrent update makes the first write fail too.
+	calls = 0
+	require.NoError(t, ts.UpdateRoutingRulesFields(ctx, func(rr *vschemapb.RoutingRules) error {
+		calls++
+		if calls == 1 {
+			require.NoError(t, ts.UpdateRoutingRulesFields(ctx, addRule("t3", "ks1.t3")))
+		}
+		return addRule("t4", "ks1.t4")(rr)
+	}))
+	assert.Equal(t, 2, calls)
+
+	rr, err := ts.GetRoutingRules(ctx)
+	require.NoError(t, err)
+	var from []string
+	for _, r := range rr.Rules {
+		from = append(from, r.FromTable)
+	}
+	assert.Equal(t, []string{"t1", "t2", "t3", "t4"}, from)
+
+	// Nothing is written if no update is needed.
+	require.NoError(t, ts.UpdateRoutingRulesFields(ctx, addRule("t1", "ks2.t1")))
+	rr, err = ts.GetRoutingRules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ks1.t1"}, rr.Rules[0].ToTables)
+
+	// Empty rules are removed.
+	require.NoError(t, ts.UpdateRoutingRulesFields(ctx, func(rr *vschemapb.RoutingRules) error {
+		rr.Rules = nil
+		return nil
+	}))
+	conn, err := ts.ConnForCell(ctx, topo.GlobalCell)
+	require.NoError(t, err)
+	_, _, err = conn.Get(ctx, topo.RoutingRulesFile)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
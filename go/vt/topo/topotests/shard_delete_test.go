@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// This file tests the two-phase shard deletion in shard.go.
+
+func TestDeleteShardWithTombstone(t *testing.T) {
+	cell := "cell1"
+	keyspace := "ks1"
+	shard := "-80"
+	ctx := context.Background()
+	ts := memorytopo.NewServer(cell)
+
+	newTablet := func(uid uint32) *topodatapb.Tablet {
+		return &topodatapb.Tablet{
+			Alias:    &topodatapb.TabletAlias{Cell: cell, Uid: uid},
+			Keyspace: keyspace,
+			Shard:    shard,
+			Type:     topodatapb.TabletType_REPLICA,
+			KeyRange: &topodatapb.KeyRange{End: []byte{0x80}},
+		}
+	}
+
+	// One live tablet, and one stale replication graph entry.
+	live := newTablet(1)
+	require.NoError(t, ts.InitTablet(ctx, live, false, true, false))
+	stale := &topodatapb.TabletAlias{Cell: cell, Uid: 2}
+	require.NoError(t, topo.UpdateShardReplicationRecord(ctx, ts, keyspace, shard, stale))
+
+	// Without force, the deletion is refused because of the live
+	// tablet. The shard is not marked, but the stale entry is removed.
+	err := ts.DeleteShardWithTombstone(ctx, keyspace, shard, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "still has 1 tablets")
+
+	si, err := ts.GetShard(ctx, keyspace, shard)
+	require.NoError(t, err)
+	assert.False(t, si.IsDeleting)
+	sri, err := ts.GetShardReplication(ctx, cell, keyspace, shard)
+	require.NoError(t, err)
+	require.Len(t, sri.Nodes, 1)
+	assert.True(t, proto.Equal(live.Alias, sri.Nodes[0].TabletAlias), "unexpected node %v", sri.Nodes[0])
+
+	// The existing tablet can still be registered again, as on a
+	// restart, and new tablets too.
+	require.NoError(t, ts.InitTablet(ctx, live, false, true, true))
+	require.NoError(t, ts.InitTablet(ctx, newTablet(3), false, true, false))
+
+	// While the shard is marked, new tablets cannot be registered in
+	// it, until the mark is cleared.
+	_, err = ts.SetShardDeleting(ctx, keyspace, shard, true)
+	require.NoError(t, err)
+	err = ts.InitTablet(ctx, newTablet(4), false, true, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is being deleted")
+	_, err = ts.SetShardDeleting(ctx, keyspace, shard, false)
+	require.NoError(t, err)
+
+	// Once the tablets are gone, the deletion completes.
+	require.NoError(t, ts.DeleteTablet(ctx, live.Alias))
+	require.NoError(t, ts.DeleteTablet(ctx, newTablet(3).Alias))
+	require.NoError(t, ts.DeleteShardWithTombstone(ctx, keyspace, shard, false))
+
+	_, err = ts.GetShard(ctx, keyspace, shard)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	_, err = ts.GetShardReplication(ctx, cell, keyspace, shard)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+
+	// Deleting again is a no-op.
+	require.NoError(t, ts.DeleteShardWithTombstone(ctx, keyspace, shard, false))
+}
+
+func TestDeleteShardWithTombstoneForce(t *testing.T) {
+	cell := "cell1"
+	keyspace := "ks1"
+	shard := "0"
+	ctx := context.Background()
+	ts := memorytopo.NewServer(cell)
+
+	tablet := &topodatapb.Tablet{
+		Alias:    &topodatapb.TabletAlias{Cell: cell, Uid: 1},
+		Keyspace: keyspace,
+		Shard:    shard,
+		Type:     topodatapb.TabletType_REPLICA,
+	}
+	require.NoError(t, ts.InitTablet(ctx, tablet, false, true, false))
+
+	require.NoError(t, ts.DeleteShardWithTombstone(ctx, keyspace, shard, true))
+
+	_, err := ts.GetShard(ctx, keyspace, shard)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+	_, err = ts.GetShardReplication(ctx, cell, keyspace, shard)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
+
+// downCellFactory is a memorytopo factory whose cell can't be reached.
+type downCellFactory struct {
+	*memorytopo.Factory
+	cell string
+}
+
+func (f downCellFactory) Create(cell, serverAddr, root string) (topo.Conn, error) {
+	if cell == f.cell {
+		return nil, errors.New("cell is down")
+	}
+	return f.Factory.Create(cell, serverAddr, root)
+}
+
+func TestDeleteShardWithTombstoneUnreachableCell(t *testing.T) {
+	keyspace := "ks1"
+	shard := "0"
+	ctx := context.Background()
+	_, factory := memorytopo.NewServerAndFactory("cell1", "cell2")
+	ts, err := topo.NewWithFactory(downCellFactory{Factory: factory, cell: "cell2"}, "", "")
+	require.NoError(t, err)
+	_, err = ts.GetOrCreateShard(ctx, keyspace, shard)
+	require.NoError(t, err)
+
+	// Without force, the deletion is refused.
+	err = ts.DeleteShardWithTombstone(ctx, keyspace, shard, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cell2")
+	si, err := ts.GetShard(ctx, keyspace, shard)
+	require.NoError(t, err)
+	assert.False(t, si.IsDeleting)
+
+	// With force, the cell is skipped.
+	require.NoError(t, ts.DeleteShardWithTombstone(ctx, keyspace, shard, true))
+	_, err = ts.GetShard(ctx, keyspace, shard)
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/key"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// This file contains tests for the bulk shard reads in shard.go and
+// keyspace.go.
+
+func TestGetShards(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	// A keyspace with no shard.
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+	shards, err := ts.GetShards(ctx, "ks")
+	require.NoError(t, err)
+	assert.Empty(t, shards)
+
+	// A keyspace with a prefix of the name of another keyspace must
+	// not see its shards.
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks2", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.CreateShard(ctx, "ks2", "0"))
+	shards, err = ts.GetShards(ctx, "ks")
+	require.NoError(t, err)
+	assert.Empty(t, shards)
+
+	for _, shard := range []string{"-40", "40-80", "80-"} {
+		require.NoError(t, ts.CreateShard(ctx, "ks", shard))
+	}
+	_, err = ts.UpdateShardFields(ctx, "ks", "80-", func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = false
+		return nil
+	})
+	require.NoError(t, err)
+
+	shards, err = ts.GetShards(ctx, "ks")
+	require.NoError(t, err)
+	individually, err := ts.GetShardsIndividually(ctx, "ks")
+	require.NoError(t, err)
+	require.Len(t, shards, 3)
+	require.Len(t, individually, 3)
+	for name, si := range individually {
+		got, ok := shards[name]
+		require.True(t, ok, "missing shard %v", name)
+		assert.Equal(t, "ks", got.Keyspace())
+		assert.Equal(t, name, got.ShardName())
+		assert.Equal(t, si.Version(), got.Version(), "shard %v", name)
+		assert.True(t, proto.Equal(si.Shard, got.Shard), "shard %v: got %v, want %v", name, got.Shard, si.Shard)
+	}
+
+	// An unknown keyspace returns ErrNoNode.
+	_, err = ts.GetShards(ctx, "unknown")
+	assert.True(t, topo.IsErrType(err, topo.NoNode), "unexpected error: %v", err)
+}
+
+func TestStreamShardsInKeyspace(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+	want := []string{"-40", "40-80", "80-c0", "c0-"}
+	for _, shard := range want {
+		require.NoError(t, ts.CreateShard(ctx, "ks", shard))
+	}
+
+	for _, maxConcurrency := range []int{0, 1, 2, 10} {
+		var got []string
+		err := ts.StreamShardsInKeyspace(ctx, "ks", maxConcurrency, func(si *topo.ShardInfo) error {
+			assert.Equal(t, "ks", si.Keyspace())
+			got = append(got, si.ShardName())
+			return nil
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, want, got, "maxConcurrency %v", maxConcurrency)
+	}
+
+	// The first error of the callback stops the stream.
+	calls := 0
+	err := ts.StreamShardsInKeyspace(ctx, "ks", 1, func(si *topo.ShardInfo) error {
+		calls++
+		return fmt.Errorf("cannot process %v", si.ShardName())
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot process")
+	assert.Equal(t, 1, calls)
+
+	// An unknown keyspace fails.
+	err = ts.StreamShardsInKeyspace(ctx, "unknown", 1, func(si *topo.ShardInfo) error {
+		return nil
+	})
+	require.Error(t, err)
+}
+
+func TestGetKeyspaceCoverage(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}))
+
+	// No shard covers nothing.
+	coverage, err := ts.GetKeyspaceCoverage(ctx, "ks")
+	require.NoError(t, err)
+	assert.Empty(t, coverage.Covered)
+	require.Len(t, coverage.Gaps, 1)
+	assert.Equal(t, "-", key.KeyRangeString(coverage.Gaps[0]))
+
+	// A layout of shards of different widths, with a gap, and a shard
+	// being split that is not serving yet.
+	for _, shard := range []string{"-80", "80-c0", "c000-c080", "e0-", "c0-e0"} {
+		require.NoError(t, ts.CreateShard(ctx, "ks", shard))
+	}
+	for _, shard := range []string{"c0-e0", "c000-c080"} {
+		_, err = ts.UpdateShardFields(ctx, "ks", shard, func(si *topo.ShardInfo) error {
+			si.IsPrimaryServing = shard == "c000-c080"
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	coverage, err = ts.GetKeyspaceCoverage(ctx, "ks")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-c080", "e0-"}, keyRangeStrings(coverage.Covered))
+	assert.Equal(t, []string{"c080-e0"}, keyRangeStrings(coverage.Gaps))
+	assert.Empty(t, coverage.Overlaps)
+
+	// The shards being split overlap with the new ones.
+	_, err = ts.UpdateShardFields(ctx, "ks", "c0-e0", func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = true
+		return nil
+	})
+	require.NoError(t, err)
+	coverage, err = ts.GetKeyspaceCoverage(ctx, "ks")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-"}, keyRangeStrings(coverage.Covered))
+	assert.Empty(t, coverage.Gaps)
+	assert.Equal(t, []string{"c0-c080"}, keyRangeStrings(coverage.Overlaps))
+}
+
+func keyRangeStrings(krs []*topodatapb.KeyRange) []string {
+	var result []string
+	for _, kr := range krs {
+		result = append(result, key.KeyRangeString(kr))
+	}
+	return result
+}
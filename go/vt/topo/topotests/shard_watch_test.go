@@ -28,6 +28,7 @@ import (
 	"vitess.io/vitess/go/vt/topo/memorytopo"
 
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	"vitess.io/vitess/go/vt/proto/vttime"
 )
 
 // waitForInitialShard waits for the initial Shard to appear.
@@ -261,3 +262,195 @@ func TestWatchShardCancel(t *testing.T) {
 	// Cancel should still work here, although it does nothing.
 	cancel()
 }
+
+func TestWatchShardFrom(t *testing.T) {
+	keyspace := "ks1"
+	shard := "0"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := memorytopo.NewServer("cell1")
+
+	if err := ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace %v failed: %v", keyspace, err)
+	}
+	if err := ts.CreateShard(ctx, keyspace, shard); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+	current, changes, err := ts.WatchShard(ctx, keyspace, shard)
+	if err != nil {
+		t.Fatalf("WatchShard failed: %v", err)
+	}
+	if current.Version == nil {
+		t.Fatalf("WatchShard returned no version")
+	}
+
+	// The shard changes while we don't watch it.
+	cancel()
+	for range changes {
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := ts.UpdateShardFields(ctx, keyspace, shard, func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = false
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateShardFields failed: %v", err)
+	}
+
+	// Resuming sends the change we missed.
+	changes, err = ts.WatchShardFrom(ctx, keyspace, shard, current.Version)
+	if err != nil {
+		t.Fatalf("WatchShardFrom failed: %v", err)
+	}
+	wd := <-changes
+	if wd.Err != nil || wd.Value.IsPrimaryServing || wd.Version.String() == current.Version.String() {
+		t.Fatalf("got bad data: %v", wd)
+	}
+	cancel()
+	for range changes {
+	}
+
+	// Resuming from the latest version sends nothing until the next change.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	changes, err = ts.WatchShardFrom(ctx, keyspace, shard, wd.Version)
+	if err != nil {
+		t.Fatalf("WatchShardFrom failed: %v", err)
+	}
+	if _, err := ts.UpdateShardFields(ctx, keyspace, shard, func(si *topo.ShardInfo) error {
+		si.IsPrimaryServing = true
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateShardFields failed: %v", err)
+	}
+	wd = <-changes
+	if wd.Err != nil || !wd.Value.IsPrimaryServing {
+		t.Fatalf("got bad data: %v", wd)
+	}
+}
+
+func TestWatchShardSlowConsumer(t *testing.T) {
+	keyspace := "ks1"
+	shard := "0"
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := ts.CreateShard(ctx, keyspace, shard); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opt  topo.WatchOption
+		max  int
+	}{
+		{name: "coalescing", opt: topo.WithWatchCoalescing(), max: 3},
+		{name: "buffer", opt: topo.WithWatchBuffer(5), max: 7},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			watchCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			_, changes, err := ts.WatchShard(watchCtx, keyspace, shard, tcase.opt)
+			if err != nil {
+				t.Fatalf("WatchShard failed: %v", err)
+			}
+
+			// More changes than the watch of the memory topo can
+			// hold: they would stall it without buffering.
+			const updates = 300
+			updateCtx, updateCancel := context.WithTimeout(ctx, 10*time.Second)
+			defer updateCancel()
+			for i := 1; i <= updates; i++ {
+				if _, err := ts.UpdateShardFields(updateCtx, keyspace, shard, func(si *topo.ShardInfo) error {
+					si.PrimaryTermStartTime = &vttime.Time{Seconds: int64(i)}
+					return nil
+				}); err != nil {
+					t.Fatalf("UpdateShardFields failed: %v", err)
+				}
+			}
+
+			// The consumer gets the latest change, after only a few
+			// of the previous ones.
+			received := 0
+			for wd := range changes {
+				if wd.Err != nil {
+					t.Fatalf("watch failed: %v", wd.Err)
+				}
+				received++
+				if wd.Value.PrimaryTermStartTime.GetSeconds() == updates {
+					break
+				}
+			}
+			if received > tcase.max {
+				t.Errorf("received %v changes, expected at most %v", received, tcase.max)
+			}
+
+			// The error that ends the watch is not dropped.
+			cancel()
+			var last *topo.WatchShardData
+			for wd := range changes {
+				last = wd
+			}
+			if last == nil || !topo.IsErrType(last.Err, topo.Interrupted) {
+				t.Errorf("unexpected last change: %v", last)
+			}
+		})
+	}
+}
+
+func TestWatchShardOptimisticUpdate(t *testing.T) {
+	keyspace := "ks1"
+	shard := "0"
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, keyspace, &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := ts.CreateShard(ctx, keyspace, shard); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+
+	current, changes, cancel := waitForInitialShard(t, ts, keyspace, shard)
+	defer cancel()
+	si := current.ShardInfo()
+	if si.Keyspace() != keyspace || si.ShardName() != shard || si.Version().String() != current.Version.String() {
+		t.Fatalf("unexpected ShardInfo: %v/%v at %v", si.Keyspace(), si.ShardName(), si.Version())
+	}
+
+	// The watched value can be updated without reading the shard.
+	reads := 0
+	updated, err := ts.UpdateShardFieldsFrom(ctx, si, func(si *topo.ShardInfo) error {
+		reads++
+		si.IsPrimaryServing = false
+		return nil
+	})
+	if err != nil || reads != 1 {
+		t.Fatalf("UpdateShardFieldsFrom failed: %v, %v calls", err, reads)
+	}
+	wd := <-changes
+	if wd.Err != nil || wd.Value.IsPrimaryServing {
+		t.Fatalf("unexpected change: %v", wd)
+	}
+	if wd.Version.String() != updated.Version().String() {
+		t.Errorf("got version %v, expected %v", wd.Version, updated.Version())
+	}
+	if !current.Value.IsPrimaryServing {
+		t.Errorf("the watched value was modified")
+	}
+
+	// A stale value is read again before it is updated.
+	reads = 0
+	if _, err := ts.UpdateShardFieldsFrom(ctx, current.ShardInfo(), func(si *topo.ShardInfo) error {
+		reads++
+		si.IsPrimaryServing = true
+		return nil
+	}); err != nil || reads != 2 {
+		t.Fatalf("UpdateShardFieldsFrom failed: %v, %v calls", err, reads)
+	}
+	wd = <-changes
+	if wd.Err != nil || !wd.Value.IsPrimaryServing {
+		t.Fatalf("unexpected change: %v", wd)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topotests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+func TestWatchSrvVSchemaCells(t *testing.T) {
+	ctx := context.Background()
+	cells := []string{"cell1", "cell2", "cell3"}
+	ts := memorytopo.NewServer(cells...)
+
+	// cell3 has no SrvVSchema yet.
+	require.NoError(t, ts.RebuildSrvVSchema(ctx, []string{"cell1", "cell2"}))
+
+	w, err := ts.WatchSrvVSchemaCells(ctx, nil, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer w.Stop()
+
+	waitFor := func(what string, cond func(map[string]*topo.CellSrvVSchema) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond(w.Cells()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %v: %v", what, w.Cells())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("the SrvVSchema of all cells", func(cells map[string]*topo.CellSrvVSchema) bool {
+		return cells["cell1"].Value != nil && cells["cell2"].Value != nil && !cells["cell3"].LastChange.IsZero()
+	})
+	cellsState := w.Cells()
+	require.Len(t, cellsState, 3)
+	assert.Nil(t, cellsState["cell3"].Value)
+	assert.Zero(t, cellsState["cell1"].Staleness)
+	assert.Zero(t, cellsState["cell2"].Staleness)
+	assert.NotZero(t, cellsState["cell3"].Staleness)
+
+	// A rebuild that misses cell2 makes it stale.
+	require.NoError(t, ts.CreateKeyspace(ctx, "ks1", &topodatapb.Keyspace{}))
+	require.NoError(t, ts.RebuildSrvVSchema(ctx, []string{"cell1", "cell3"}))
+	want := &vschemapb.SrvVSchema{
+		RoutingRules: &vschemapb.RoutingRules{},
+		Keyspaces:    map[string]*vschemapb.Keyspace{"ks1": {}},
+	}
+	waitFor("the rebuild", func(cells map[string]*topo.CellSrvVSchema) bool {
+		return proto.Equal(cells["cell1"].Value, want) && proto.Equal(cells["cell3"].Value, want)
+	})
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, []string{"cell2"}, w.StaleCells(10*time.Millisecond))
+	assert.Empty(t, w.StaleCells(time.Hour))
+
+	// A rebuild of all the cells fixes it.
+	require.NoError(t, ts.RebuildSrvVSchema(ctx, nil))
+	waitFor("the rebuild of cell2", func(cells map[string]*topo.CellSrvVSchema) bool {
+		return proto.Equal(cells["cell2"].Value, want)
+	})
+	assert.Empty(t, w.StaleCells(0))
+}
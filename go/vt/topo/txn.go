@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"path"
+
+	"google.golang.org/protobuf/proto"
+
+	"vitess.io/vitess/go/event"
+	"vitess.io/vitess/go/trace"
+	"vitess.io/vitess/go/vt/topo/events"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// TxnOpType is the type of an operation of a transaction.
+type TxnOpType int
+
+const (
+	// TxnCreate creates a file, like Conn.Create: the file must not
+	// exist.
+	TxnCreate = TxnOpType(iota)
+
+	// TxnUpdate updates a file, like Conn.Update: if Version is nil,
+	// the file is created if it doesn't exist, otherwise the file
+	// must have this version.
+	TxnUpdate
+
+	// TxnDelete deletes a file, like Conn.Delete: the file must
+	// exist, and have Version unless it's nil.
+	TxnDelete
+
+	// TxnCheck doesn't change the file, but it must exist and have
+	// Version. It makes the transaction depend on a file it doesn't
+	// write.
+	TxnCheck
+)
+
+// String returns the name of the operation type.
+func (t TxnOpType) String() string {
+	switch t {
+	case TxnCreate:
+		return "create"
+	case TxnUpdate:
+		return "update"
+	case TxnDelete:
+		return "delete"
+	case TxnCheck:
+		return "check"
+	}
+	return "unknown"
+}
+
+// TxnOp is an operation of a transaction, see Conn.Txn.
+type TxnOp struct {
+	Type TxnOpType
+
+	// Path is relative to the root directory of the cell.
+	Path string
+
+	// Contents is the new contents of the file, for TxnCreate and
+	// TxnUpdate.
+	Contents []byte
+
+	// Version is the version the file must have, see the operation
+	// types. It's ignored by TxnCreate, and required by TxnCheck.
+	Version Version
+}
+
+// ValidateTxnOps checks that the operations can be sent in a transaction.
+// Conn implementations call it before applying them.
+func ValidateTxnOps(ops []TxnOp) error {
+	if len(ops) == 0 {
+		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "empty transaction")
+	}
+	paths := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case TxnCreate, TxnUpdate, TxnDelete:
+		case TxnCheck:
+			if op.Version == nil {
+				return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "transaction check of %v has no version", op.Path)
+			}
+		default:
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "invalid transaction operation type %d for %v", op.Type, op.Path)
+		}
+		if paths[op.Path] {
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "path %v appears more than once in the transaction", op.Path)
+		}
+		paths[op.Path] = true
+	}
+	return nil
+}
+
+// UpdateKeyspaceAndShards updates a keyspace record and shard records in a
+// single transaction of the global cell, so an operation like
+// SwitchWrites never leaves them partially updated. ki can be nil to only
+// update shards. Like UpdateKeyspace, the keyspace must be locked, and
+// each record is only written if it has the version it was read with,
+// otherwise nothing is written and ErrBadVersion is returned. On success,
+// the versions of the records are updated.
+func (ts *Server) UpdateKeyspaceAndShards(ctx context.Context, ki *KeyspaceInfo, shards []*ShardInfo) error {
+	span, ctx := trace.NewSpan(ctx, "TopoServer.UpdateKeyspaceAndShards")
+	defer span.Finish()
+
+	ops := make([]TxnOp, 0, len(shards)+1)
+	if ki != nil {
+		if err := CheckKeyspaceLocked(ctx, ki.keyspace); err != nil {
+			return err
+		}
+		data, err := proto.Marshal(ki.Keyspace)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, TxnOp{
+			Type:     TxnUpdate,
+			Path:     path.Join(KeyspacesPath, ki.keyspace, KeyspaceFile),
+			Contents: data,
+			Version:  ki.version,
+		})
+	}
+	for _, si := range shards {
+		data, err := proto.Marshal(si.Shard)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, TxnOp{
+			Type:     TxnUpdate,
+			Path:     shardFilePath(si.keyspace, si.shardName),
+			Contents: data,
+			Version:  si.version,
+		})
+	}
+
+	versions, err := ts.globalCell.Txn(ctx, ops)
+	if err != nil {
+		return err
+	}
+
+	if ki != nil {
+		ki.version, versions = versions[0], versions[1:]
+		event.Dispatch(&events.KeyspaceChange{
+			KeyspaceName: ki.keyspace,
+			Keyspace:     ki.Keyspace,
+			Status:       "updated",
+		})
+	}
+	for i, si := range shards {
+		si.version = versions[i]
+		event.Dispatch(&events.ShardChange{
+			KeyspaceName: si.Keyspace(),
+			ShardName:    si.ShardName(),
+			Shard:        si.Shard,
+			Status:       "updated",
+		})
+	}
+	return nil
+}
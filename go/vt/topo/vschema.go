@@ -130,3 +130,55 @@ func (ts *Server) GetRoutingRules(ctx context.Context) (*vschemapb.RoutingRules,
 	}
 	return rr, nil
 }
+
+// UpdateRoutingRulesFields is a high level helper to read the routing
+// rules, call an update function on them, and then write them back. If
+// the write fails due to a version mismatch, it will re-read the rules
+// and retry the update. If there are no routing rules yet, the update
+// function is called with empty rules, and empty rules are removed, as
+// with SaveRoutingRules.
+// If the update method returns ErrNoUpdateNeeded, nothing is written,
+// and nil is returned.
+func (ts *Server) UpdateRoutingRulesFields(ctx context.Context, update func(*vschemapb.RoutingRules) error) error {
+	for {
+		rr := &vschemapb.RoutingRules{}
+		data, version, err := ts.globalCell.Get(ctx, RoutingRulesFile)
+		switch {
+		case err == nil:
+			if err := proto.Unmarshal(data, rr); err != nil {
+				return vterrors.Wrapf(err, "bad routing rules data: %q", data)
+			}
+		case IsErrType(err, NoNode):
+			// No routing rules yet.
+		default:
+			return err
+		}
+
+		if err := update(rr); err != nil {
+			if IsErrType(err, NoUpdateNeeded) {
+				return nil
+			}
+			return err
+		}
+
+		data, err = proto.Marshal(rr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(data) == 0 && version == nil:
+			return nil
+		case len(data) == 0:
+			err = ts.globalCell.Delete(ctx, RoutingRulesFile, version)
+		case version == nil:
+			_, err = ts.globalCell.Create(ctx, RoutingRulesFile, data)
+		default:
+			_, err = ts.globalCell.Update(ctx, RoutingRulesFile, data, version)
+		}
+		// Retry if the rules were changed, created or deleted since
+		// we read them. Otherwise return, including if err is nil.
+		if !IsErrType(err, BadVersion) && !IsErrType(err, NodeExists) && !IsErrType(err, NoNode) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"vitess.io/vitess/go/stats"
+)
+
+// This file contains the buffering of the changes of the watches, so a
+// slow consumer doesn't stall the watch of the topology server.
+
+var topoWatchDroppedChanges = stats.NewCountersWithSingleLabel(
+	"TopologyWatchDroppedChanges",
+	"TopologyWatchDroppedChanges changes of watches dropped because their consumer was too slow",
+	"Type")
+
+// WatchOption configures how the changes of a watch are buffered
+// until its consumer reads them, see WatchShard.
+//
+// By default, the changes are sent in a small channel, and the watch
+// waits for the consumer to read them when it is full. With a
+// WatchOption, the watch never waits: the oldest changes are dropped
+// when the consumer is too slow, and counted in the
+// TopologyWatchDroppedChanges stat. The errors are never dropped.
+type WatchOption func(*watchOptions)
+
+// watchOptions are the options of a watch.
+type watchOptions struct {
+	// bufferSize is the number of changes kept for the consumer, 0 if
+	// the watch waits for the consumer.
+	bufferSize int
+}
+
+// WithWatchCoalescing only keeps the latest change for the consumer:
+// a change replaces the previous one if it was not read yet.
+func WithWatchCoalescing() WatchOption {
+	return WithWatchBuffer(1)
+}
+
+// WithWatchBuffer keeps up to size changes for the consumer, and drops
+// the oldest one when a new change doesn't fit.
+func WithWatchBuffer(size int) WatchOption {
+	return func(o *watchOptions) {
+		o.bufferSize = size
+	}
+}
+
+// newWatchOptions returns the options of a watch.
+func newWatchOptions(opts []WatchOption) *watchOptions {
+	o := &watchOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// channelSize returns the size of the channel to send the changes of
+// the watch to the consumer.
+func (o *watchOptions) channelSize() int {
+	if o.bufferSize > 0 {
+		// The changes are buffered by bufferWatch, and a larger
+		// channel would keep more of them.
+		return 0
+	}
+	return 10
+}
+
+// bufferWatch returns a channel with the changes of wdChannel, buffered
+// according to o, so wdChannel is always read. watchType labels the
+// dropped changes. Like wdChannel, it is closed after the last change.
+func bufferWatch(wdChannel <-chan *WatchData, o *watchOptions, watchType string) <-chan *WatchData {
+	if o.bufferSize <= 0 {
+		return wdChannel
+	}
+
+	out := make(chan *WatchData)
+	go func() {
+		defer close(out)
+
+		var pending []*WatchData
+		in := wdChannel
+		for in != nil || len(pending) > 0 {
+			// Only try to send when there is something to send.
+			var send chan<- *WatchData
+			var next *WatchData
+			if len(pending) > 0 {
+				send = out
+				next = pending[0]
+			}
+
+			select {
+			case wd, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				// An error is the last change, and is always kept.
+				if wd.Err == nil && len(pending) >= o.bufferSize {
+					pending[0] = nil
+					pending = pending[1:]
+					topoWatchDroppedChanges.Add(watchType, 1)
+				}
+				pending = append(pending, wd)
+			case send <- next:
+				pending[0] = nil
+				pending = pending[1:]
+			}
+		}
+	}()
+	return out
+}
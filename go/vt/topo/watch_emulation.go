@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The Vitess Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package topo
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+)
+
+// WatchRecursivePollInterval is how often EmulateWatchRecursive lists the
+// watched directory again, to find the new files.
+const WatchRecursivePollInterval = 5 * time.Second
+
+// emulatedWatch is a recursive watch made of a Watch per file.
+type emulatedWatch struct {
+	ctx           context.Context
+	conn          Conn
+	dirPath       string
+	notifications chan *WatchDataRecursive
+	wg            sync.WaitGroup
+
+	mu sync.Mutex
+	// watched has the files being watched.
+	watched map[string]bool
+}
+
+// EmulateWatchRecursive implements Conn.WatchRecursive for the backends
+// that can't watch a directory: it watches every file under dirPath,
+// and lists dirPath again every pollInterval to watch the new files.
+// The ephemeral entries, like the locks, are not watched.
+func EmulateWatchRecursive(ctx context.Context, conn Conn, dirPath string, pollInterval time.Duration) ([]*WatchDataRecursive, <-chan *WatchDataRecursive, error) {
+	files, err := listFilesRecursive(ctx, conn, dirPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ew := &emulatedWatch{
+		ctx:           ctx,
+		conn:          conn,
+		dirPath:       dirPath,
+		notifications: make(chan *WatchDataRecursive, 10),
+		watched:       make(map[string]bool),
+	}
+	var initial []*WatchDataRecursive
+	for _, filePath := range files {
+		current, err := ew.watch(filePath)
+		if err != nil {
+			// Stop the watches we started.
+			cancel()
+			ew.wg.Wait()
+			return nil, nil, err
+		}
+		if current != nil {
+			initial = append(initial, current)
+		}
+	}
+
+	go func() {
+		defer cancel()
+		defer close(ew.notifications)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				ew.wg.Wait()
+				ew.notifications <- &WatchDataRecursive{
+					WatchData: WatchData{Err: NewError(Interrupted, dirPath)},
+				}
+				return
+			case <-ticker.C:
+				ew.watchNewFiles()
+			}
+		}
+	}()
+
+	return initial, ew.notifications, nil
+}
+
+// listFilesRecursive returns the paths of the files under dirPath.
+func listFilesRecursive(ctx context.Context, conn Conn, dirPath string) ([]string, error) {
+	entries, err := conn.ListDir(ctx, dirPath, true /*full*/)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Ephemeral {
+			continue
+		}
+		entryPath := path.Join(dirPath, entry.Name)
+		if entry.Type == TypeFile {
+			files = append(files, entryPath)
+			continue
+		}
+		children, err := listFilesRecursive(ctx, conn, entryPath)
+		if IsErrType(err, NoNode) {
+			// The directory was emptied since we listed it.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, children...)
+	}
+	return files, nil
+}
+
+// watch starts watching a file, and returns its current value, or nil
+// if it doesn't exist anymore.
+func (ew *emulatedWatch) watch(filePath string) (*WatchDataRecursive, error) {
+	current, changes, err := ew.conn.Watch(ew.ctx, filePath)
+	if IsErrType(err, NoNode) {
+		// The file was deleted since we listed it.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ew.mu.Lock()
+	ew.watched[filePath] = true
+	ew.mu.Unlock()
+
+	ew.wg.Add(1)
+	go func() {
+		defer ew.wg.Done()
+		for wd := range changes {
+			if wd.Err != nil {
+				// The watch is over, the channel will be
+				// closed right after this. A deleted file is
+				// a change, the other errors are not: the
+				// file will be watched again by the next
+				// poll, unless we're done.
+				ew.mu.Lock()
+				delete(ew.watched, filePath)
+				ew.mu.Unlock()
+				if !IsErrType(wd.Err, NoNode) {
+					continue
+				}
+			}
+			ew.send(&WatchDataRecursive{Path: filePath, WatchData: *wd})
+		}
+	}()
+	return &WatchDataRecursive{Path: filePath, WatchData: *current}, nil
+}
+
+// watchNewFiles lists the directory, and watches the files that are not
+// watched yet. Their current values are sent as changes.
+func (ew *emulatedWatch) watchNewFiles() {
+	files, err := listFilesRecursive(ew.ctx, ew.conn, ew.dirPath)
+	if err != nil {
+		// No file, or we'll try again at the next poll.
+		return
+	}
+	for _, filePath := range files {
+		ew.mu.Lock()
+		watched := ew.watched[filePath]
+		ew.mu.Unlock()
+		if watched {
+			continue
+		}
+		current, err := ew.watch(filePath)
+		if err != nil || current == nil {
+			continue
+		}
+		ew.send(current)
+	}
+}
+
+// send sends a change, unless the watch is being stopped, in which case
+// only the final error matters.
+func (ew *emulatedWatch) send(wd *WatchDataRecursive) {
+	select {
+	case ew.notifications <- wd:
+	case <-ew.ctx.Done():
+	}
+}
+
+// EmulateWatchFrom implements Conn.WatchFrom for the backends that don't
+// keep the history of the files: it starts a new watch, whose current
+// value is sent first, unless it still has version. The changes between
+// version and the current value are lost, like a watch can skip them.
+func EmulateWatchFrom(ctx context.Context, conn Conn, filePath string, version Version) (<-chan *WatchData, error) {
+	current, changes, err := conn.Watch(ctx, filePath)
+	if IsErrType(err, NoNode) {
+		// The file was deleted since version.
+		notifications := make(chan *WatchData, 1)
+		notifications <- &WatchData{Err: err}
+		close(notifications)
+		return notifications, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version != nil && current.Version.String() == version.String() {
+		// Nothing was missed.
+		return changes, nil
+	}
+
+	notifications := make(chan *WatchData, 10)
+	go func() {
+		defer close(notifications)
+
+		notifications <- current
+		for wd := range changes {
+			notifications <- wd
+		}
+	}()
+	return notifications, nil
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/z-division/go-zookeeper/zk"
 
+	"vitess.io/vitess/go/vt/log"
 	"vitess.io/vitess/go/vt/topo"
 )
 
@@ -130,3 +131,84 @@ func (zs *Server) recursiveDeleteParentIfEmpty(ctx context.Context, filePath str
 		return err
 	}
 }
+
+// Txn is part of the topo.Conn interface. It uses a zookeeper multi
+// operation. Like Create, it first creates the parent directories of the
+// new files, and like Delete, it then deletes the directories left empty.
+func (zs *Server) Txn(ctx context.Context, ops []topo.TxnOp) ([]topo.Version, error) {
+	if err := topo.ValidateTxnOps(ops); err != nil {
+		return nil, err
+	}
+
+	zkOps := make([]interface{}, 0, len(ops))
+	zkPaths := make([]string, 0, len(ops))
+	for _, op := range ops {
+		zkPath := path.Join(zs.root, op.Path)
+		zkPaths = append(zkPaths, zkPath)
+
+		// Interpret the version
+		var zkVersion int32
+		if op.Version != nil {
+			zkVersion = int32(op.Version.(ZKVersion))
+		} else {
+			zkVersion = -1
+		}
+
+		create := op.Type == topo.TxnCreate
+		if op.Type == topo.TxnUpdate && op.Version == nil {
+			// In zookeeper, an unconditional set of a
+			// nonexisting node fails. In that case, we want
+			// to create it.
+			exists, _, err := zs.conn.Exists(ctx, zkPath)
+			if err != nil {
+				return nil, convertError(err, zkPath)
+			}
+			create = !exists
+		}
+
+		switch {
+		case create:
+			if _, err := CreateRecursive(ctx, zs.conn, path.Dir(zkPath), nil, 0, zk.WorldACL(PermDirectory), -1); err != nil && err != zk.ErrNodeExists {
+				return nil, convertError(err, zkPath)
+			}
+			zkOps = append(zkOps, &zk.CreateRequest{Path: zkPath, Data: op.Contents, Acl: zk.WorldACL(PermFile)})
+		case op.Type == topo.TxnUpdate:
+			zkOps = append(zkOps, &zk.SetDataRequest{Path: zkPath, Data: op.Contents, Version: zkVersion})
+		case op.Type == topo.TxnDelete:
+			zkOps = append(zkOps, &zk.DeleteRequest{Path: zkPath, Version: zkVersion})
+		case op.Type == topo.TxnCheck:
+			zkOps = append(zkOps, &zk.CheckVersionRequest{Path: zkPath, Version: zkVersion})
+		}
+	}
+
+	responses, err := zs.conn.Multi(ctx, zkOps...)
+	if err != nil {
+		// The operation that failed has its own error, the
+		// others were rolled back.
+		for i, resp := range responses {
+			switch resp.Error {
+			case zk.ErrNoNode, zk.ErrNodeExists, zk.ErrBadVersion:
+				return nil, convertError(resp.Error, zkPaths[i])
+			}
+		}
+		return nil, convertError(err, zs.root)
+	}
+
+	versions := make([]topo.Version, len(ops))
+	for i, op := range ops {
+		switch op.Type {
+		case topo.TxnCreate, topo.TxnUpdate:
+			if _, ok := zkOps[i].(*zk.CreateRequest); ok {
+				// A new file has version 0.
+				versions[i] = ZKVersion(0)
+			} else if i < len(responses) && responses[i].Stat != nil {
+				versions[i] = ZKVersion(responses[i].Stat.Version)
+			}
+		case topo.TxnDelete:
+			if err := zs.recursiveDeleteParentIfEmpty(ctx, op.Path); err != nil {
+				log.Warningf("failed to delete the empty parents of %v: %v", zkPaths[i], err)
+			}
+		}
+	}
+	return versions, nil
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package zk2topo
 
 import (
+	"fmt"
 	"path"
+	"sort"
 
 	"context"
 
 	"github.com/z-division/go-zookeeper/zk"
 
+	"vitess.io/vitess/go/vt/proto/vtrpc"
 	"vitess.io/vitess/go/vt/vterrors"
 
 	"vitess.io/vitess/go/vt/log"
@@ -101,10 +104,84 @@ func (zs *Server) Lock(ctx context.Context, dirPath, contents string) (topo.Lock
 	}, nil
 }
 
+// zkLockVersion is the version of a holding of a lock: the node of the
+// holder in the locks directory, and its version.
+// It implements topo.Version.
+type zkLockVersion struct {
+	nodePath string
+	version  int32
+}
+
+// String is part of the topo.Version interface.
+func (v zkLockVersion) String() string {
+	return fmt.Sprintf("%v@%v", v.nodePath, v.version)
+}
+
+// lockHolderNode returns the node of the holder of the lock on dirPath:
+// the first one in its locks directory.
+func (zs *Server) lockHolderNode(ctx context.Context, dirPath string) (string, error) {
+	locksDir := path.Join(zs.root, dirPath, locksPath)
+	children, _, err := zs.conn.Children(ctx, locksDir)
+	if err != nil {
+		return "", convertError(err, dirPath)
+	}
+	if len(children) == 0 {
+		return "", topo.NewError(topo.NoNode, dirPath)
+	}
+	sort.Strings(children)
+	return path.Join(locksDir, children[0]), nil
+}
+
+// LockHolder is part of the topo.LockInspectorConn interface.
+func (zs *Server) LockHolder(ctx context.Context, dirPath string) (string, topo.Version, error) {
+	nodePath, err := zs.lockHolderNode(ctx, dirPath)
+	if err != nil {
+		return "", nil, err
+	}
+	data, stat, err := zs.conn.Get(ctx, nodePath)
+	if err != nil {
+		// The holder may have just released the lock.
+		return "", nil, convertError(err, dirPath)
+	}
+	return string(data), zkLockVersion{nodePath: nodePath, version: stat.Version}, nil
+}
+
+// BreakLock is part of the topo.LockInspectorConn interface.
+// It deletes the node of the holder if it still has the version of
+// the version. The next node in the locks directory then gets the lock,
+// and the holder fails its Check.
+func (zs *Server) BreakLock(ctx context.Context, dirPath string, version topo.Version) error {
+	v, ok := version.(zkLockVersion)
+	if !ok {
+		return vterrors.Errorf(vtrpc.Code_INVALID_ARGUMENT, "bad lock version %v for %v", version, dirPath)
+	}
+	err := zs.conn.Delete(ctx, v.nodePath, v.version)
+	switch err {
+	case nil:
+		return nil
+	case zk.ErrNoNode, zk.ErrBadVersion:
+		// The holder released the lock: it is not locked, or it
+		// was locked again.
+		if _, err := zs.lockHolderNode(ctx, dirPath); err != nil {
+			return err
+		}
+		return topo.NewError(topo.BadVersion, dirPath)
+	default:
+		return convertError(err, dirPath)
+	}
+}
+
 // Check is part of the topo.LockDescriptor interface.
+// The node of the lock is gone if our session expired, or if the lock
+// was broken.
 func (ld *zkLockDescriptor) Check(ctx context.Context) error {
-	// TODO(alainjobart): check the connection has not been interrupted.
-	// We'd lose the ephemeral node in case of a session loss.
+	exists, _, err := ld.zs.conn.Exists(ctx, path.Join(ld.zs.root, ld.nodePath))
+	if err != nil {
+		return convertError(err, ld.nodePath)
+	}
+	if !exists {
+		return vterrors.Errorf(vtrpc.Code_INTERNAL, "lost lock %v", ld.nodePath)
+	}
 	return nil
 }
 
@@ -180,6 +180,15 @@ func (c *ZkConn) Delete(ctx context.Context, path string, version int32) error {
 	})
 }
 
+// Multi is part of the Conn interface.
+func (c *ZkConn) Multi(ctx context.Context, ops ...interface{}) (responses []zk.MultiResponse, err error) {
+	err = c.withRetry(ctx, func(conn *zk.Conn) error {
+		responses, err = conn.Multi(ops...)
+		return err
+	})
+	return
+}
+
 // GetACL is part of the Conn interface.
 func (c *ZkConn) GetACL(ctx context.Context, path string) (aclv []zk.ACL, stat *zk.Stat, err error) {
 	err = c.withRetry(ctx, func(conn *zk.Conn) error {
@@ -52,30 +52,21 @@ func ValidateForReshard(sourceShards, targetShards []*topo.ShardInfo) error {
 	return nil
 }
 
+// combineKeyRanges returns the key range covered by shards, which must
+// be contiguous and not overlap.
 func combineKeyRanges(shards []*topo.ShardInfo) (*topodatapb.KeyRange, error) {
 	if len(shards) == 0 {
 		return nil, fmt.Errorf("there are no shards to combine")
 	}
-	result := shards[0].KeyRange
-	krmap := make(map[string]*topodatapb.KeyRange)
-	for _, si := range shards[1:] {
-		krmap[si.ShardName()] = si.KeyRange
+	krs := make([]*topodatapb.KeyRange, 0, len(shards))
+	for _, si := range shards {
+		krs = append(krs, si.KeyRange)
 	}
-	for len(krmap) != 0 {
-		foundOne := false
-		for k, kr := range krmap {
-			newkr, ok := key.KeyRangeAdd(result, kr)
-			if ok {
-				foundOne = true
-				result = newkr
-				delete(krmap, k)
-			}
-		}
-		if !foundOne {
-			return nil, errors.New("shards don't form a contiguous keyrange")
-		}
+	union := key.KeyRangesUnion(krs)
+	if _, overlaps := key.KeyRangeGapsAndOverlaps(krs); len(overlaps) > 0 || len(union) != 1 {
+		return nil, errors.New("shards don't form a contiguous keyrange")
 	}
-	return result, nil
+	return union[0], nil
 }
 
 // OverlappingShards contains sets of shards that overlap which each-other.
@@ -129,6 +129,10 @@ func TestValidateForReshard(t *testing.T) {
 		sources: []string{"0"},
 		targets: []string{"-40", "40-"},
 		out:     "",
+	}, {
+		sources: []string{"-80", "8000-c000", "c0-"},
+		targets: []string{"-40", "40-"},
+		out:     "",
 	}, {
 		sources: []string{"-40", "40-80", "80-"},
 		targets: []string{"-40", "40-"},
@@ -20,6 +20,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"sort"
 	"time"
 
 	"google.golang.org/grpc"
@@ -28,6 +29,8 @@ import (
 	"vitess.io/vitess/go/vt/logutil"
 	"vitess.io/vitess/go/vt/mysqlctl"
 	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topobackup"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/wrangler"
@@ -68,6 +71,13 @@ func init() {
 		params: "[--backup_timestamp=yyyy-MM-dd.HHmmss] <tablet alias>",
 		help:   "Stops mysqld and restores the data from the latest backup or if a timestamp is specified then the most recent backup at or before that time.",
 	})
+
+	addCommand("Generic", command{
+		name:   "RestoreTopology",
+		method: commandRestoreTopology,
+		params: "[--restore_to_time=<RFC3339 time>] [--dry-run] <backup dir>",
+		help:   "Restores the global topology server as it was at a time, from the changes recorded by vtctld with --topo_backup_dir. The files recorded at that time replace the files of the topology server, and the other files are deleted. The serving graph may need to be rebuilt afterwards.",
+	})
 }
 
 func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -234,3 +244,54 @@ func commandRestoreFromBackup(ctx context.Context, wr *wrangler.Wrangler, subFla
 
 	return wr.VtctldServer().RestoreFromBackup(req, &backupRestoreEventStreamLogger{logger: wr.Logger(), ctx: ctx})
 }
+
+func commandRestoreTopology(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	restoreToTimeStr := subFlags.String("restore_to_time", "", "Restore the topology server as it was at this time, in RFC3339 format, rather than its latest recorded state.")
+	dryRun := subFlags.Bool("dry-run", false, "Only list the files that would be restored.")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the RestoreTopology command requires the <backup dir> argument")
+	}
+
+	restoreToTime := time.Now()
+	if *restoreToTimeStr != "" {
+		var err error
+		restoreToTime, err = time.Parse(time.RFC3339Nano, *restoreToTimeStr)
+		if err != nil {
+			return vterrors.New(vtrpcpb.Code_INVALID_ARGUMENT, fmt.Sprintf("unable to parse the restore time value provided of '%s'", *restoreToTimeStr))
+		}
+	}
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	defer bs.Close()
+	state, err := topobackup.StateAt(ctx, bs, subFlags.Arg(0), restoreToTime)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		paths := make([]string, 0, len(state))
+		for p := range state {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			wr.Logger().Printf("%v\n", p)
+		}
+		return nil
+	}
+
+	conn, err := wr.TopoServer().ConnForCell(ctx, topo.GlobalCell)
+	if err != nil {
+		return err
+	}
+	if err := topobackup.Restore(ctx, conn, state); err != nil {
+		return err
+	}
+	wr.Logger().Printf("Restored %v files of the topology server as of %v\n", len(state), restoreToTime)
+	return nil
+}
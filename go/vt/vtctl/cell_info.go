@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	"vitess.io/vitess/go/vt/wrangler"
 
@@ -69,6 +70,13 @@ func init() {
 		params: "<cell>",
 		help:   "Prints a JSON representation of the CellInfo for a cell.",
 	})
+
+	addCommand(cellsGroupName, command{
+		name:   "GetStaleCells",
+		method: commandGetStaleCells,
+		params: "[--max_age <duration>]",
+		help:   "Lists the cells that registered themselves, but did not update their heartbeat for more than max_age. The cells added with AddCellInfo are never stale.",
+	})
 }
 
 func commandAddCellInfo(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -145,6 +153,22 @@ func commandGetCellInfoNames(ctx context.Context, wr *wrangler.Wrangler, subFlag
 	return nil
 }
 
+func commandGetStaleCells(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	maxAge := subFlags.Duration("max_age", 10*time.Minute, "How long a cell can go without updating its heartbeat before it is stale.")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 0 {
+		return fmt.Errorf("GetStaleCells command takes no parameter")
+	}
+	cells, err := wr.TopoServer().GetStaleCells(ctx, *maxAge)
+	if err != nil {
+		return err
+	}
+	wr.Logger().Printf("%v\n", strings.Join(cells, "\n"))
+	return nil
+}
+
 func commandGetCellInfo(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -103,20 +103,18 @@ func deleteShard(ctx context.Context, ts *topo.Server, keyspace string, shard st
 	for _, cell := range cells {
 		err = deleteShardCell(ctx, ts, keyspace, shard, cell, recursive)
 		if err != nil {
-			return err
-		}
-	}
-
-	// Try to remove the replication and serving graphs from each cell,
-	// regardless of whether they exist.
-	for _, cell := range cells {
-		if err := ts.DeleteShardReplication(ctx, cell, keyspace, shard); err != nil && !topo.IsErrType(err, topo.NoNode) {
-			log.Warningf("Cannot delete ShardReplication in cell %v for %v/%v: %w", cell, keyspace, shard, err)
+			if !force {
+				return err
+			}
+			log.Warningf("Cannot delete the tablets of shard %v/%v in cell %v, but force=true, proceeding anyway: %v", keyspace, shard, cell, err)
 		}
 	}
 
-	err = ts.DeleteShard(ctx, keyspace, shard)
-	return err
+	// Now that the shard has no tablets, mark it as being deleted, so no
+	// new tablet can be registered in it, and remove the replication
+	// graph and the shard record. The mark is cleared if this fails. With
+	// force, the cells that can't be reached are only logged.
+	return ts.DeleteShardWithTombstone(ctx, keyspace, shard, force)
 }
 
 // deleteShardCell is the per-cell helper function for deleteShard, and is
@@ -111,6 +111,7 @@ import (
 	"vitess.io/vitess/go/vt/schema"
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/helpers"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/topotools"
 	"vitess.io/vitess/go/vt/vtctl/workflow"
@@ -296,6 +297,12 @@ var commands = []commandGroup{
 				params: "[--force] [--parent] <keyspace/shard>",
 				help:   "Creates the specified shard.",
 			},
+			{
+				name:   "PlanShards",
+				method: commandPlanShards,
+				params: "[--create] <keyspace> <shard count>",
+				help:   "Lists the shards to create to split the keyspace evenly in the given number of shards, which doesn't need to be a power of two, leaving out the shards that already exist. With --create, it also creates them.",
+			},
 			{
 				name:   "GetShard",
 				method: commandGetShard,
@@ -326,6 +333,12 @@ var commands = []commandGroup{
 				params: "<keyspace/shard> <is_serving>",
 				help:   "Add or remove a shard from serving. This is meant as an emergency function. It does not rebuild any serving graph i.e. does not run 'RebuildKeyspaceGraph'.",
 			},
+			{
+				name:   "SetShardIsDeleting",
+				method: commandSetShardIsDeleting,
+				params: "<keyspace/shard> <is_deleting>",
+				help:   "Sets or clears the mark of a shard being deleted, which prevents new tablets from being registered in it. This is meant to clear the mark left by an interrupted DeleteShard.",
+			},
 			{
 				name:   "SetShardTabletControl",
 				method: commandSetShardTabletControl,
@@ -373,6 +386,12 @@ var commands = []commandGroup{
 				params: "<cell> <keyspace/shard>",
 				help:   "Walks through a ShardReplication object and fixes the first error that it encounters.",
 			},
+			{
+				name:   "ShardReplicationRemoveOrphans",
+				method: commandShardReplicationRemoveOrphans,
+				params: "[--cells=c1,c2,...] [--dry_run]",
+				help:   "Removes the entries of the ShardReplication objects of all the shards that point at tablets that don't exist, and lists them.",
+			},
 			{
 				name:   "WaitForFilteredReplication",
 				method: commandWaitForFilteredReplication,
@@ -391,6 +410,18 @@ var commands = []commandGroup{
 				params: "[--recursive] [--even_if_serving] <keyspace/shard> ...",
 				help:   "Deletes the specified shard(s). In recursive mode, it also deletes all tablets belonging to the shard. Otherwise, there must be no tablets left in the shard.",
 			},
+			{
+				name:   "GetShardLock",
+				method: commandGetShardLock,
+				params: "<keyspace/shard>",
+				help:   "Outputs a JSON structure that contains the current holder of the shard lock, if any, and the history of its forced releases.",
+			},
+			{
+				name:   "ForceUnlockShard",
+				method: commandForceUnlockShard,
+				params: "--operator=<operator> [--reason=<reason>] <keyspace/shard>",
+				help:   "Breaks the shard lock, whoever holds it, and records it in the lock history with the operator and the reason. Only use it when the holder of the lock is gone, for instance after a crash.",
+			},
 		},
 	},
 	{
@@ -425,6 +456,18 @@ var commands = []commandGroup{
 				params: "",
 				help:   "Outputs a sorted list of all keyspaces.",
 			},
+			{
+				name:   "GetKeyspaceLock",
+				method: commandGetKeyspaceLock,
+				params: "<keyspace>",
+				help:   "Outputs a JSON structure that contains the current holder of the keyspace lock, if any, and the history of its forced releases.",
+			},
+			{
+				name:   "ForceUnlockKeyspace",
+				method: commandForceUnlockKeyspace,
+				params: "--operator=<operator> [--reason=<reason>] <keyspace>",
+				help:   "Breaks the keyspace lock, whoever holds it, and records it in the lock history with the operator and the reason. Only use it when the holder of the lock is gone, for instance after a crash.",
+			},
 			{
 				name:   "RebuildKeyspaceGraph",
 				method: commandRebuildKeyspaceGraph,
@@ -696,6 +739,24 @@ var commands = []commandGroup{
 				params: "[--cells=c1,c2,...]",
 				help:   "Rebuilds the cell-specific SrvVSchema from the global VSchema objects in the provided cells (or all cells if none provided).",
 			},
+			{
+				name:   "ExportTopology",
+				method: commandExportTopology,
+				params: "<archive file>",
+				help:   "Writes the cells, keyspaces, shards, VSchemas, tablets and routing rules of the topology server to a JSON archive.",
+			},
+			{
+				name:   "ImportTopology",
+				method: commandImportTopology,
+				params: "[--skip_rebuild] <archive file>",
+				help:   "Writes the records of an archive written by ExportTopology to the topology server, replacing the existing keyspaces, shards, VSchemas, tablets and routing rules. Existing cells are kept. Rebuilds the serving graph afterwards.",
+			},
+			{
+				name:   "DiffTopology",
+				method: commandDiffTopology,
+				params: "<archive file>",
+				help:   "Displays the differences of the keyspaces, shards, VSchemas, tablets and routing rules between an archive written by ExportTopology and the topology server. Fails if there are any.",
+			},
 		},
 	},
 	{
@@ -1432,6 +1493,39 @@ func commandCreateShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	return err
 }
 
+func commandPlanShards(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	create := subFlags.Bool("create", false, "Creates the shards of the plan")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace> and <shard count> arguments are required for the PlanShards command")
+	}
+
+	keyspace := subFlags.Arg(0)
+	count, err := strconv.Atoi(subFlags.Arg(1))
+	if err != nil {
+		return fmt.Errorf("invalid shard count %v: %v", subFlags.Arg(1), err)
+	}
+	existing, err := wr.TopoServer().GetShardNames(ctx, keyspace)
+	if err != nil && !topo.IsErrType(err, topo.NoNode) {
+		return err
+	}
+	shards, err := key.PlanShardRanges(count, existing)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if *create {
+			if err := wr.TopoServer().CreateShard(ctx, keyspace, shard); err != nil {
+				return err
+			}
+		}
+		wr.Logger().Printf("%v\n", shard)
+	}
+	return nil
+}
+
 func commandGetShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -1452,6 +1546,61 @@ func commandGetShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.
 	return printJSON(wr.Logger(), shardInfo.Shard)
 }
 
+// lockStatus is the output of the GetKeyspaceLock and GetShardLock
+// commands.
+type lockStatus struct {
+	// Holder is the current holder of the lock, nil if it is not locked.
+	Holder  *topo.Lock
+	History []*topo.LockBreak
+}
+
+func commandGetShardLock(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <keyspace/shard> argument is required for the GetShardLock command")
+	}
+
+	keyspace, shard, err := topoproto.ParseKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	holder, err := wr.TopoServer().GetShardLock(ctx, keyspace, shard)
+	if err != nil && !topo.IsErrType(err, topo.NoNode) {
+		return err
+	}
+	history, err := wr.TopoServer().GetShardLockHistory(ctx, keyspace, shard)
+	if err != nil {
+		return err
+	}
+	return printJSON(wr.Logger(), &lockStatus{Holder: holder, History: history})
+}
+
+func commandForceUnlockShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	operator := subFlags.String("operator", "", "Who is breaking the lock, recorded in the lock history")
+	reason := subFlags.String("reason", "", "Why the lock is broken, recorded in the lock history")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <keyspace/shard> argument is required for the ForceUnlockShard command")
+	}
+
+	keyspace, shard, err := topoproto.ParseKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	l, err := wr.TopoServer().ForceUnlockShard(ctx, keyspace, shard, *operator, *reason)
+	if l == nil {
+		return err
+	}
+	if perr := printJSON(wr.Logger(), l); perr != nil {
+		return perr
+	}
+	return err
+}
+
 func commandValidateShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	pingTablets := subFlags.Bool("ping-tablets", true, "Indicates whether all tablets should be pinged during the validation process")
 	if err := subFlags.Parse(args); err != nil {
@@ -1557,6 +1706,27 @@ func commandSetShardIsPrimaryServing(ctx context.Context, wr *wrangler.Wrangler,
 	return err
 }
 
+func commandSetShardIsDeleting(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace/shard> <is_deleting> arguments are both required for the SetShardIsDeleting command")
+	}
+	keyspace, shard, err := topoproto.ParseKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	isDeleting, err := strconv.ParseBool(subFlags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	_, err = wr.TopoServer().SetShardDeleting(ctx, keyspace, shard, isDeleting)
+	return err
+}
+
 func commandUpdateSrvKeyspacePartition(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	cellsStr := subFlags.String("cells", "", "Specifies a comma-separated list of cells to update")
 	remove := subFlags.Bool("remove", false, "Removes shard from serving keyspace partition")
@@ -1749,6 +1919,27 @@ func commandShardReplicationFix(ctx context.Context, wr *wrangler.Wrangler, subF
 	return err
 }
 
+func commandShardReplicationRemoveOrphans(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	cellsStr := subFlags.String("cells", "", "Specifies a comma-separated list of cells to scan. If empty, all cells are scanned.")
+	dryRun := subFlags.Bool("dry_run", false, "Only lists the orphaned entries, without removing them")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 0 {
+		return fmt.Errorf("ShardReplicationRemoveOrphans command takes no parameter")
+	}
+
+	var cells []string
+	if *cellsStr != "" {
+		cells = strings.Split(*cellsStr, ",")
+	}
+	orphans, err := topo.RemoveOrphanedShardReplicationNodes(ctx, wr.TopoServer(), wr.Logger(), cells, *dryRun)
+	for _, orphan := range orphans {
+		wr.Logger().Printf("%v %v/%v %v\n", orphan.Cell, orphan.Keyspace, orphan.Shard, topoproto.TabletAliasString(orphan.TabletAlias))
+	}
+	return err
+}
+
 func commandWaitForFilteredReplication(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	maxDelay := subFlags.Duration("max_delay", wrangler.DefaultWaitForFilteredReplicationMaxDelay,
 		"Specifies the maximum delay, in seconds, the filtered replication of the"+
@@ -1974,6 +2165,46 @@ func commandRemoveKeyspaceCell(ctx context.Context, wr *wrangler.Wrangler, subFl
 	return err
 }
 
+func commandGetKeyspaceLock(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <keyspace> argument is required for the GetKeyspaceLock command")
+	}
+
+	keyspace := subFlags.Arg(0)
+	holder, err := wr.TopoServer().GetKeyspaceLock(ctx, keyspace)
+	if err != nil && !topo.IsErrType(err, topo.NoNode) {
+		return err
+	}
+	history, err := wr.TopoServer().GetKeyspaceLockHistory(ctx, keyspace)
+	if err != nil {
+		return err
+	}
+	return printJSON(wr.Logger(), &lockStatus{Holder: holder, History: history})
+}
+
+func commandForceUnlockKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	operator := subFlags.String("operator", "", "Who is breaking the lock, recorded in the lock history")
+	reason := subFlags.String("reason", "", "Why the lock is broken, recorded in the lock history")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <keyspace> argument is required for the ForceUnlockKeyspace command")
+	}
+
+	l, err := wr.TopoServer().ForceUnlockKeyspace(ctx, subFlags.Arg(0), *operator, *reason)
+	if l == nil {
+		return err
+	}
+	if perr := printJSON(wr.Logger(), l); perr != nil {
+		return perr
+	}
+	return err
+}
+
 func commandGetKeyspace(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	if err := subFlags.Parse(args); err != nil {
 		return err
@@ -3418,6 +3649,95 @@ func commandRebuildVSchemaGraph(ctx context.Context, wr *wrangler.Wrangler, subF
 	return err
 }
 
+func commandExportTopology(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <archive file> argument is required for the ExportTopology command")
+	}
+
+	archive, err := helpers.ExportTopology(ctx, wr.TopoServer())
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := helpers.WriteTopologyArchive(f, archive); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func commandImportTopology(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	skipRebuild := subFlags.Bool("skip_rebuild", false, "If set, do not rebuild the SrvKeyspace and SrvVSchema objects.")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <archive file> argument is required for the ImportTopology command")
+	}
+
+	f, err := os.Open(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	archive, err := helpers.ReadTopologyArchive(f)
+	if err != nil {
+		return err
+	}
+
+	ts := wr.TopoServer()
+	if err := helpers.ImportTopology(ctx, ts, archive); err != nil {
+		return err
+	}
+	if *skipRebuild {
+		wr.Logger().Warningf("Skipping rebuild of the serving graph, will need to run RebuildKeyspaceGraph and RebuildVSchemaGraph for changes to take effect")
+		return nil
+	}
+	for _, ka := range archive.Keyspaces {
+		if err := topotools.RebuildKeyspace(ctx, wr.Logger(), ts, ka.Name, nil, true /*allowPartial*/); err != nil {
+			return err
+		}
+	}
+	return ts.RebuildSrvVSchema(ctx, nil)
+}
+
+func commandDiffTopology(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("the <archive file> argument is required for the DiffTopology command")
+	}
+
+	f, err := os.Open(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	archive, err := helpers.ReadTopologyArchive(f)
+	if err != nil {
+		return err
+	}
+	current, err := helpers.ExportTopology(ctx, wr.TopoServer())
+	if err != nil {
+		return err
+	}
+
+	diff := helpers.DiffTopologyArchives(archive, current)
+	if diff.IsEmpty() {
+		wr.Logger().Printf("The topology server matches the archive\n")
+		return nil
+	}
+	wr.Logger().Printf("%v\n", diff)
+	return fmt.Errorf("the topology server differs from the archive in %v records", len(diff.Entries))
+}
+
 func commandApplyVSchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	vschema := subFlags.String("vschema", "", "Identifies the VTGate routing schema")
 	vschemaFile := subFlags.String("vschema_file", "", "Identifies the VTGate routing schema file")
@@ -164,6 +164,13 @@ func (f *fundamental) Format(s fmt.State, verb rune) {
 	}
 }
 
+// ErrorWithCode is implemented by the errors of other packages that have
+// a vtrpc code, like the topo errors, so Code returns it.
+type ErrorWithCode interface {
+	error
+	ErrorCode() vtrpcpb.Code
+}
+
 // Code returns the error code if it's a vtError.
 // If err is nil, it returns ok.
 func Code(err error) vtrpcpb.Code {
@@ -173,6 +180,9 @@ func Code(err error) vtrpcpb.Code {
 	if err, ok := err.(*fundamental); ok {
 		return err.code
 	}
+	if err, ok := err.(ErrorWithCode); ok {
+		return err.ErrorCode()
+	}
 
 	cause := Cause(err)
 	if cause != err && cause != nil {
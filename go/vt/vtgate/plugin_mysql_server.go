@@ -24,6 +24,7 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -34,6 +35,7 @@ import (
 	"vitess.io/vitess/go/vt/vterrors"
 
 	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqlescape"
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/trace"
 	"vitess.io/vitess/go/vt/callerid"
@@ -54,7 +56,7 @@ var (
 	mysqlServerBindAddress        = flag.String("mysql_server_bind_address", "", "Binds on this address when listening to MySQL binary protocol. Useful to restrict listening to 'localhost' only for instance.")
 	mysqlServerSocketPath         = flag.String("mysql_server_socket_path", "", "This option specifies the Unix socket file to use when listening for local connections. By default it will be empty and it won't listen to a unix socket")
 	mysqlTCPVersion               = flag.String("mysql_tcp_version", "tcp", "Select tcp, tcp4, or tcp6 to control the socket type.")
-	mysqlAuthServerImpl           = flag.String("mysql_auth_server_impl", "static", "Which auth server implementation to use. Options: none, ldap, clientcert, static, vault.")
+	mysqlAuthServerImpl           = flag.String("mysql_auth_server_impl", "static", "Which auth server implementation to use. Options: none, ldap, clientcert, static, vault, secretmanager.")
 	mysqlAllowClearTextWithoutTLS = flag.Bool("mysql_allow_clear_text_without_tls", false, "If set, the server will allow the use of a clear text password over non-SSL connections.")
 	mysqlProxyProtocol            = flag.Bool("proxy_protocol", false, "Enable HAProxy PROXY protocol on MySQL listener socket")
 
@@ -75,6 +77,11 @@ var (
 	mysqlConnWriteTimeout = flag.Duration("mysql_server_write_timeout", 0, "connection write timeout")
 	mysqlQueryTimeout     = flag.Duration("mysql_server_query_timeout", 0, "mysql query timeout")
 
+	mysqlConnMemoryLimit = flag.Int64("mysql_server_conn_memory_limit", 0, "If set, the maximum number of bytes a mysql connection can buffer for its results and large packets. Queries exceeding it are killed with an error.")
+	mysqlFlushTimeout    = flag.Duration("mysql_server_flush_timeout", 0, "If set, the maximum time to wait for a mysql client to read its results. Beyond it, the query is cancelled and the connection is closed.")
+	mysqlDrainTimeout    = flag.Duration("mysql_server_drain_timeout", 0, "If set, the maximum time to drain the mysql connections on shutdown: new connections are refused, idle ones get a shutdown error and are closed, and busy ones are closed once their queries and transactions are done.")
+	mysqlMemoryLimit     = flag.Int64("mysql_server_memory_limit", 0, "If set, the maximum number of bytes all the mysql connections can buffer together for their results and large packets. Queries exceeding it are killed with an error.")
+
 	mysqlDefaultWorkloadName = flag.String("mysql_default_workload", "OLTP", "Default session workload (OLTP, OLAP, DBA)")
 	mysqlDefaultWorkload     int32
 
@@ -334,6 +341,66 @@ func (vh *vtgateHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareDat
 	return callback(qr)
 }
 
+// ComFieldList is the handler for the legacy COM_FIELD_LIST command. It
+// returns the fields of the table, as a select on it would.
+func (vh *vtgateHandler) ComFieldList(c *mysql.Conn, table, wildcard string) ([]*querypb.Field, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if *mysqlQueryTimeout != 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), *mysqlQueryTimeout)
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+
+	ctx = callinfo.MysqlCallInfo(ctx, c)
+
+	// See ComQuery for how the caller IDs are filled in.
+	im := c.UserData.Get()
+	ef := callerid.NewEffectiveCallerID(
+		c.User,                  /* principal: who */
+		c.RemoteAddr().String(), /* component: running client process */
+		"VTGate MySQL Connector" /* subcomponent: part of the client */)
+	ctx = callerid.NewContext(ctx, ef, im)
+
+	session := vh.session(c)
+	if !session.InTransaction {
+		atomic.AddInt32(&busyConnections, 1)
+	}
+	defer func() {
+		if !session.InTransaction {
+			atomic.AddInt32(&busyConnections, -1)
+		}
+	}()
+
+	query := fmt.Sprintf("select * from %s where 1 != 1", sqlescape.EscapeID(table))
+	_, qr, err := vh.vtg.Execute(ctx, session, query, make(map[string]*querypb.BindVariable))
+	if err != nil {
+		return nil, mysql.NewSQLErrorFromError(err)
+	}
+	if wildcard == "" {
+		return qr.Fields, nil
+	}
+	re := sqlparser.LikeToRegexp(wildcard)
+	var fields []*querypb.Field
+	for _, field := range qr.Fields {
+		if re.MatchString(field.Name) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// ComStatistics reports the number of queries processed by vtgate, on
+// top of the uptime and thread count reported by the listener.
+func (vh *vtgateHandler) ComStatistics(c *mysql.Conn) []mysql.Statistic {
+	var questions int64
+	for _, count := range queriesProcessed.Counts() {
+		questions += count
+	}
+	return []mysql.Statistic{{Name: "Questions", Value: strconv.FormatInt(questions, 10)}}
+}
+
 func (vh *vtgateHandler) WarningCount(c *mysql.Conn) uint16 {
 	return uint16(len(vh.session(c).GetWarnings()))
 }
@@ -454,6 +521,7 @@ func initMySQLProtocol() {
 			log.Infof("setting mysql slow connection threshold to %v", mysqlSlowConnectWarnThreshold)
 			mysqlListener.SlowConnectWarnThreshold.Set(*mysqlSlowConnectWarnThreshold)
 		}
+		setListenerLimits(mysqlListener)
 		// Start listening for tcp
 		go mysqlListener.Accept()
 	}
@@ -468,11 +536,20 @@ func initMySQLProtocol() {
 			log.Exitf("mysql.NewListener failed: %v", err)
 			return
 		}
+		setListenerLimits(mysqlUnixListener)
 		// Listen for unix socket
 		go mysqlUnixListener.Accept()
 	}
 }
 
+// setListenerLimits applies the memory limit and flush timeout flags
+// to listener.
+func setListenerLimits(listener *mysql.Listener) {
+	listener.ConnMemoryLimit.Set(*mysqlConnMemoryLimit)
+	listener.GlobalMemoryLimit.Set(*mysqlMemoryLimit)
+	listener.FlushTimeout.Set(*mysqlFlushTimeout)
+}
+
 // newMysqlUnixSocket creates a new unix socket mysql listener. If a socket file already exists, attempts
 // to clean it up.
 func newMysqlUnixSocket(address string, authServer mysql.AuthServer, handler mysql.Handler) (*mysql.Listener, error) {
@@ -505,6 +582,9 @@ func newMysqlUnixSocket(address string, authServer mysql.AuthServer, handler mys
 }
 
 func shutdownMysqlProtocolAndDrain() {
+	if *mysqlDrainTimeout > 0 {
+		drainMysqlListeners(*mysqlDrainTimeout)
+	}
 	if mysqlListener != nil {
 		mysqlListener.Close()
 		mysqlListener = nil
@@ -532,6 +612,29 @@ func shutdownMysqlProtocolAndDrain() {
 	}
 }
 
+// drainMysqlListeners drains the connections of the listeners, so the
+// clients can move to another vtgate without losing their transactions.
+func drainMysqlListeners(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, l := range []*mysql.Listener{mysqlListener, mysqlUnixListener} {
+		if l == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(l *mysql.Listener) {
+			defer wg.Done()
+			log.Infof("Draining the mysql connections of %v for up to %v", l.Addr(), timeout)
+			if busy := l.Drain(ctx); busy > 0 {
+				log.Warningf("Closed %d busy mysql connections of %v after %v", busy, l.Addr(), timeout)
+			}
+		}(l)
+	}
+	wg.Wait()
+}
+
 func rollbackAtShutdown() {
 	defer log.Flush()
 	if vtgateHandle == nil {
@@ -81,9 +81,13 @@ func (mr *MockGRTopoMockRecorder) GetTabletMapForShardByCell(ctx, keyspace, shar
 }
 
 // LockShard mocks base method.
-func (m *MockGRTopo) LockShard(ctx context.Context, keyspace, shard, action string) (context.Context, func(*error), error) {
+func (m *MockGRTopo) LockShard(ctx context.Context, keyspace, shard, action string, opts ...topo.LockOption) (context.Context, func(*error), error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LockShard", ctx, keyspace, shard, action)
+	varargs := []any{ctx, keyspace, shard, action}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "LockShard", varargs...)
 	ret0, _ := ret[0].(context.Context)
 	ret1, _ := ret[1].(func(*error))
 	ret2, _ := ret[2].(error)
@@ -91,9 +95,10 @@ func (m *MockGRTopo) LockShard(ctx context.Context, keyspace, shard, action stri
 }
 
 // LockShard indicates an expected call of LockShard.
-func (mr *MockGRTopoMockRecorder) LockShard(ctx, keyspace, shard, action any) *gomock.Call {
+func (mr *MockGRTopoMockRecorder) LockShard(ctx, keyspace, shard, action any, opts ...any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockShard", reflect.TypeOf((*MockGRTopo)(nil).LockShard), ctx, keyspace, shard, action)
+	varargs := append([]any{ctx, keyspace, shard, action}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockShard", reflect.TypeOf((*MockGRTopo)(nil).LockShard), varargs...)
 }
 
 // MockGRTmcClient is a mock of GRTmcClient interface.
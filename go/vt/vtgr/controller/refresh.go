@@ -55,7 +55,7 @@ type GRTopo interface {
 	GetShardNames(ctx context.Context, keyspace string) ([]string, error)
 	GetShard(ctx context.Context, keyspace, shard string) (*topo.ShardInfo, error)
 	GetTabletMapForShardByCell(ctx context.Context, keyspace, shard string, cells []string) (map[string]*topo.TabletInfo, error)
-	LockShard(ctx context.Context, keyspace, shard, action string) (context.Context, func(*error), error)
+	LockShard(ctx context.Context, keyspace, shard, action string, opts ...topo.LockOption) (context.Context, func(*error), error)
 }
 
 // GRTmcClient is VTGR wrapper for tmc client
@@ -490,6 +490,9 @@ func (tm *TabletManager) createKeyspaceShard(ctx context.Context) (*topo.ShardIn
 	}); err != nil {
 		return nil, vterrors.Wrap(err, "createKeyspaceShard: cannot GetOrCreateShard shard")
 	}
+	if err := shardInfo.CheckNotDeleting(); err != nil {
+		return nil, vterrors.Wrap(err, "createKeyspaceShard")
+	}
 	tm.tmState.RefreshFromTopoInfo(ctx, shardInfo, nil)
 
 	// Rebuild keyspace if this the first tablet in this keyspace/cell
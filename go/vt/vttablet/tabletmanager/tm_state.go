@@ -72,6 +72,13 @@ type tmState struct {
 	isPublishing             bool
 	hasCreatedMetadataTables bool
 
+	// deniedTablesExpiry refreshes the denied tables when the next
+	// TabletControl expires. deniedTablesGeneration is incremented
+	// by each refresh from a shard record, so a timer of an older
+	// record does nothing. They are protected by mu.
+	deniedTablesExpiry     *time.Timer
+	deniedTablesGeneration int64
+
 	// displayState contains the current snapshot of the internal state
 	// and has its own mutex.
 	displayState displayState
@@ -109,6 +116,9 @@ func (ts *tmState) Close() {
 	defer ts.mu.Unlock()
 
 	ts.isOpen = false
+	if ts.deniedTablesExpiry != nil {
+		ts.deniedTablesExpiry.Stop()
+	}
 	ts.cancel()
 }
 
@@ -133,16 +143,42 @@ func (ts *tmState) RefreshFromTopo(ctx context.Context) error {
 func (ts *tmState) RefreshFromTopoInfo(ctx context.Context, shardInfo *topo.ShardInfo, srvKeyspace *topodatapb.SrvKeyspace) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
+	ts.refreshFromTopoInfoLocked(ctx, shardInfo, srvKeyspace)
+}
 
+func (ts *tmState) refreshFromTopoInfoLocked(ctx context.Context, shardInfo *topo.ShardInfo, srvKeyspace *topodatapb.SrvKeyspace) {
 	if shardInfo != nil {
 		ts.isResharding = len(shardInfo.SourceShards) > 0
 
 		ts.deniedTables = make(map[topodatapb.TabletType][]string)
+		now := time.Now()
+		var nextExpiry time.Time
 		for _, tc := range shardInfo.TabletControls {
+			if topo.IsTabletControlExpired(tc, now) {
+				continue
+			}
 			if topo.InCellList(ts.tm.tabletAlias.Cell, tc.Cells) {
 				ts.deniedTables[tc.TabletType] = tc.DeniedTables
+				if expireTime := logutil.ProtoToTime(tc.ExpireTime); !expireTime.IsZero() && (nextExpiry.IsZero() || expireTime.Before(nextExpiry)) {
+					nextExpiry = expireTime
+				}
 			}
 		}
+
+		// Expired records are not removed from the shard record right
+		// away, so the shard watch may not fire: read the shard record
+		// again when the next one expires.
+		ts.deniedTablesGeneration++
+		if ts.deniedTablesExpiry != nil {
+			ts.deniedTablesExpiry.Stop()
+			ts.deniedTablesExpiry = nil
+		}
+		if !nextExpiry.IsZero() {
+			generation := ts.deniedTablesGeneration
+			ts.deniedTablesExpiry = time.AfterFunc(nextExpiry.Sub(now), func() {
+				ts.expireDeniedTables(generation)
+			})
+		}
 	}
 
 	if srvKeyspace != nil {
@@ -171,6 +207,30 @@ func (ts *tmState) RefreshFromTopoInfo(ctx context.Context, shardInfo *topo.Shar
 	_ = ts.updateLocked(ctx)
 }
 
+// expireDeniedTables reads the shard record when a TabletControl
+// expires, and refreshes the denied tables from it, unless they were
+// refreshed from a newer record since the timer was set.
+func (ts *tmState) expireDeniedTables(generation int64) {
+	if ts.ctx.Err() != nil {
+		return
+	}
+	shardInfo, err := ts.tm.TopoServer.GetShard(ts.ctx, ts.Keyspace(), ts.Shard())
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.deniedTablesGeneration != generation || ts.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		log.Warningf("Cannot read the shard record to expire its TabletControls, will retry: %v", err)
+		ts.deniedTablesExpiry = time.AfterFunc(*publishRetryInterval, func() {
+			ts.expireDeniedTables(generation)
+		})
+		return
+	}
+	ts.refreshFromTopoInfoLocked(ts.ctx, shardInfo, nil)
+}
+
 func (ts *tmState) ChangeTabletType(ctx context.Context, tabletType topodatapb.TabletType, action DBAction) error {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -28,6 +28,7 @@ import (
 	"vitess.io/vitess/go/vt/vterrors"
 
 	"vitess.io/vitess/go/vt/key"
+	"vitess.io/vitess/go/vt/logutil"
 	"vitess.io/vitess/go/vt/servenv"
 
 	"context"
@@ -132,6 +133,58 @@ func TestStateDenyList(t *testing.T) {
 	assert.Equal(t, `[{"Description":"enforce denied tables","Name":"denied_table","TableNames":["t1"],"Action":"FAIL_RETRY"}]`, string(b))
 }
 
+func TestStateDenyListExpiry(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1")
+	tm := newTestTM(t, ts, 1, "ks", "0")
+	defer tm.Stop()
+
+	tabletControls := []*topodatapb.Shard_TabletControl{{
+		TabletType:   topodatapb.TabletType_REPLICA,
+		Cells:        []string{"cell1"},
+		DeniedTables: []string{"t1"},
+		ExpireTime:   logutil.TimeToProto(time.Now().Add(-time.Second)),
+	}, {
+		TabletType:   topodatapb.TabletType_RDONLY,
+		Cells:        []string{"cell1"},
+		DeniedTables: []string{"t2"},
+		ExpireTime:   logutil.TimeToProto(time.Now().Add(100 * time.Millisecond)),
+	}}
+	si, err := ts.UpdateShardFields(ctx, "ks", "0", func(si *topo.ShardInfo) error {
+		si.TabletControls = tabletControls
+		return nil
+	})
+	require.NoError(t, err)
+	tm.tmState.RefreshFromTopoInfo(ctx, si, nil)
+	tm.tmState.mu.Lock()
+	assert.Equal(t, map[topodatapb.TabletType][]string{topodatapb.TabletType_RDONLY: {"t2"}}, tm.tmState.deniedTables)
+	tm.tmState.mu.Unlock()
+
+	// The denied tables are refreshed from the shard record when the
+	// second record expires.
+	assert.Eventually(t, func() bool {
+		tm.tmState.mu.Lock()
+		defer tm.tmState.mu.Unlock()
+		return len(tm.tmState.deniedTables) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A refresh from a newer record cancels the expiry of the previous
+	// one, even if its timer already fired.
+	tm.tmState.mu.Lock()
+	generation := tm.tmState.deniedTablesGeneration
+	tm.tmState.mu.Unlock()
+	si.TabletControls = []*topodatapb.Shard_TabletControl{{
+		TabletType:   topodatapb.TabletType_RDONLY,
+		Cells:        []string{"cell1"},
+		DeniedTables: []string{"t3"},
+	}}
+	tm.tmState.RefreshFromTopoInfo(ctx, si, nil)
+	tm.tmState.expireDeniedTables(generation)
+	tm.tmState.mu.Lock()
+	assert.Equal(t, map[topodatapb.TabletType][]string{topodatapb.TabletType_RDONLY: {"t3"}}, tm.tmState.deniedTables)
+	tm.tmState.mu.Unlock()
+}
+
 func TestStateTabletControls(t *testing.T) {
 	ctx := context.Background()
 	ts := memorytopo.NewServer("cell1")
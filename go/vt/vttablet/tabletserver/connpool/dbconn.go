@@ -207,6 +207,11 @@ func (dbc *DBConn) Stream(ctx context.Context, query string, callback func(*sqlt
 					resultSent = true
 					r = r.StripMetadata(includedFields)
 				}
+				// The stream is making progress, so the connection
+				// is not leaked.
+				if dbc.pool != nil {
+					dbc.pool.renew(dbc)
+				}
 				return callback(r)
 			},
 			alloc,
@@ -325,7 +330,7 @@ func (dbc *DBConn) Recycle() {
 	case dbc.pool == nil:
 		dbc.Close()
 	case dbc.conn.IsClosed():
-		dbc.pool.Put(nil)
+		dbc.pool.discard(dbc)
 	default:
 		dbc.pool.Put(dbc)
 	}
@@ -336,7 +341,7 @@ func (dbc *DBConn) Taint() {
 	if dbc.pool == nil {
 		return
 	}
-	dbc.pool.Put(nil)
+	dbc.pool.discard(dbc)
 	dbc.pool = nil
 }
 
@@ -17,9 +17,10 @@ limitations under the License.
 package connpool
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
-	"strings"
+	"net/http"
 	"sync"
 	"time"
 
@@ -27,7 +28,9 @@ import (
 
 	"context"
 
+	"vitess.io/vitess/go/acl"
 	"vitess.io/vitess/go/pools"
+	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/trace"
 	"vitess.io/vitess/go/vt/callerid"
@@ -54,11 +57,18 @@ type Pool struct {
 	env                tabletenv.Env
 	name               string
 	mu                 sync.Mutex
-	connections        pools.IResourcePool
+	connections        *pools.ResourcePool[*DBConn]
 	capacity           int
 	prefillParallelism int
 	timeout            time.Duration
 	idleTimeout        time.Duration
+	maxLifetime        time.Duration
+	leakThreshold      time.Duration
+	waitHistogram      *stats.Histogram
+	heldHistogram      *stats.Histogram
+	freelist           bool
+	maxConcurrentDials int
+	reusePolicy        pools.ReusePolicy
 	waiterCap          int64
 	waiterCount        sync2.AtomicInt64
 	waiterQueueFull    sync2.AtomicInt64
@@ -70,6 +80,8 @@ type Pool struct {
 // to publish stats only.
 func NewPool(env tabletenv.Env, name string, cfg tabletenv.ConnPoolConfig) *Pool {
 	idleTimeout := cfg.IdleTimeoutSeconds.Get()
+	// The invalid policies are rejected by TabletConfig.Verify.
+	reusePolicy, _ := pools.ParseReusePolicy(cfg.ReusePolicy)
 	cp := &Pool{
 		env:                env,
 		name:               name,
@@ -77,6 +89,11 @@ func NewPool(env tabletenv.Env, name string, cfg tabletenv.ConnPoolConfig) *Pool
 		prefillParallelism: cfg.PrefillParallelism,
 		timeout:            cfg.TimeoutSeconds.Get(),
 		idleTimeout:        idleTimeout,
+		maxLifetime:        cfg.MaxLifetimeSeconds.Get(),
+		leakThreshold:      cfg.LeakThresholdSeconds.Get(),
+		freelist:           cfg.Freelist,
+		maxConcurrentDials: cfg.MaxConcurrentDials,
+		reusePolicy:        reusePolicy,
 		waiterCap:          int64(cfg.MaxWaiters),
 		dbaPool:            dbconnpool.NewConnectionPool("", 1, idleTimeout, 0),
 	}
@@ -92,12 +109,25 @@ func NewPool(env tabletenv.Env, name string, cfg tabletenv.ConnPoolConfig) *Pool
 	env.Exporter().NewCounterDurationFunc(name+"WaitTime", "Tablet server wait time", cp.WaitTime)
 	env.Exporter().NewGaugeDurationFunc(name+"IdleTimeout", "Tablet server idle timeout", cp.IdleTimeout)
 	env.Exporter().NewCounterFunc(name+"IdleClosed", "Tablet server conn pool idle closed", cp.IdleClosed)
+	env.Exporter().NewCounterFunc(name+"MaxLifetimeClosed", "Tablet server conn pool connections closed for exceeding their max lifetime", cp.MaxLifetimeClosed)
 	env.Exporter().NewCounterFunc(name+"Exhausted", "Number of times pool had zero available slots", cp.Exhausted)
 	env.Exporter().NewCounterFunc(name+"WaiterQueueFull", "Number of times the waiter queue was full", cp.waiterQueueFull.Get)
+	env.Exporter().NewCounterFunc(name+"Leaked", "Tablet server conn pool connections not returned within the leak threshold", cp.Leaked)
+	env.Exporter().NewCounterFunc(name+"DialErrors", "Tablet server conn pool failures to open a connection", func() int64 { return cp.Stats().DialErrors })
+	env.Exporter().NewGaugeFunc(name+"RecentDialErrors", "Tablet server conn pool failures to open a connection in the last minute", func() int64 { return cp.Stats().RecentDialErrors })
+	env.Exporter().HandleFunc("/debug/checkouts/"+name, cp.handleCheckouts)
+	if len(cfg.HistogramBucketsSeconds) != 0 {
+		cutoffs := make([]int64, 0, len(cfg.HistogramBucketsSeconds))
+		for _, bucket := range cfg.HistogramBucketsSeconds {
+			cutoffs = append(cutoffs, bucket.Get().Nanoseconds())
+		}
+		cp.waitHistogram = env.Exporter().NewHistogram(name+"WaitHistogram", "Tablet server conn pool wait time distribution, in nanoseconds", cutoffs)
+		cp.heldHistogram = env.Exporter().NewHistogram(name+"HeldHistogram", "Tablet server conn pool distribution of the time the connections are held, in nanoseconds", cutoffs)
+	}
 	return cp
 }
 
-func (cp *Pool) pool() (p pools.IResourcePool) {
+func (cp *Pool) pool() (p *pools.ResourcePool[*DBConn]) {
 	cp.mu.Lock()
 	p = cp.connections
 	cp.mu.Unlock()
@@ -109,12 +139,7 @@ func (cp *Pool) Open(appParams, dbaParams, appDebugParams dbconfigs.Connector) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 
-	if cp.prefillParallelism != 0 {
-		log.Infof("Opening pool: '%s'", cp.name)
-		defer log.Infof("Done opening pool: '%s'", cp.name)
-	}
-
-	f := func(ctx context.Context) (pools.Resource, error) {
+	f := func(ctx context.Context) (*DBConn, error) {
 		return NewDBConn(ctx, cp, appParams)
 	}
 
@@ -123,7 +148,31 @@ func (cp *Pool) Open(appParams, dbaParams, appDebugParams dbconfigs.Connector) {
 		refreshCheck = netutil.DNSTracker(appParams.Host())
 	}
 
-	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.capacity, cp.idleTimeout, cp.prefillParallelism, cp.getLogWaitCallback(), refreshCheck, *mysqlctl.PoolDynamicHostnameResolution)
+	cp.connections = pools.NewTypedResourcePoolWithOptions(f, cp.capacity, cp.capacity, cp.idleTimeout, cp.prefillParallelism, cp.getLogWaitCallback(), refreshCheck, *mysqlctl.PoolDynamicHostnameResolution, pools.ResourcePoolOptions{MaxLifetime: cp.maxLifetime})
+	if cp.leakThreshold != 0 {
+		cp.connections.SetLeakThreshold(cp.leakThreshold)
+	}
+	if cp.waitHistogram != nil {
+		cp.connections.SetHistograms(cp.waitHistogram, cp.heldHistogram)
+	}
+	if cp.freelist {
+		cp.connections.SetFreelist(true)
+	}
+	if cp.maxConcurrentDials != 0 {
+		cp.connections.SetMaxConcurrentDials(cp.maxConcurrentDials)
+	}
+	cp.connections.SetReusePolicy(cp.reusePolicy)
+	if cp.prefillParallelism != 0 {
+		// The pool is prefilled in the background.
+		log.Infof("Prefilling pool: '%s'", cp.name)
+		go func(p *pools.ResourcePool[*DBConn]) {
+			if err := p.WaitForPrefill(context.Background()); err != nil {
+				log.Warningf("Prefilling pool '%s' failed: %v", cp.name, err)
+				return
+			}
+			log.Infof("Done prefilling pool: '%s'", cp.name)
+		}(cp.connections)
+	}
 	cp.appDebugParams = appDebugParams
 
 	cp.dbaPool.Open(dbaParams)
@@ -194,11 +243,7 @@ func (cp *Pool) Get(ctx context.Context) (*DBConn, error) {
 		ctx, cancel = context.WithTimeout(ctx, cp.timeout)
 		defer cancel()
 	}
-	r, err := p.Get(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return r.(*DBConn), nil
+	return p.Get(ctx)
 }
 
 // Put puts a connection into the pool.
@@ -207,18 +252,40 @@ func (cp *Pool) Put(conn *DBConn) {
 	if p == nil {
 		panic(ErrConnPoolClosed)
 	}
-	if conn == nil {
-		p.Put(nil)
-	} else {
-		p.Put(conn)
+	p.Put(conn)
+}
+
+// discard gives back the slot of a connection that is not returned to
+// the pool.
+func (cp *Pool) discard(conn *DBConn) {
+	p := cp.pool()
+	if p == nil {
+		panic(ErrConnPoolClosed)
+	}
+	p.Discard(conn)
+}
+
+// renew extends the lease of a connection for the leak detection.
+func (cp *Pool) renew(conn *DBConn) {
+	if cp.leakThreshold == 0 {
+		return
+	}
+	if p := cp.pool(); p != nil {
+		p.Renew(conn)
 	}
 }
 
-// SetCapacity alters the size of the pool at runtime.
+// SetCapacity alters the size of the pool at runtime. The pool keeps its
+// connections, even if it grows beyond the size it was opened with.
 func (cp *Pool) SetCapacity(capacity int) (err error) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
 	if cp.connections != nil {
+		if int64(capacity) > cp.connections.MaxCap() {
+			if err := cp.connections.SetMaxCap(capacity); err != nil {
+				return err
+			}
+		}
 		err = cp.connections.SetCapacity(capacity)
 		if err != nil {
 			return err
@@ -228,6 +295,17 @@ func (cp *Pool) SetCapacity(capacity int) (err error) {
 	return nil
 }
 
+// Drain closes all the connections of the pool, and leaves it open, so
+// it creates new connections as they are needed. See
+// pools.ResourcePool.Drain.
+func (cp *Pool) Drain(ctx context.Context) error {
+	p := cp.pool()
+	if p == nil {
+		return ErrConnPoolClosed
+	}
+	return p.Drain(ctx)
+}
+
 // SetIdleTimeout sets the idleTimeout on the pool.
 func (cp *Pool) SetIdleTimeout(idleTimeout time.Duration) {
 	cp.mu.Lock()
@@ -239,18 +317,32 @@ func (cp *Pool) SetIdleTimeout(idleTimeout time.Duration) {
 	cp.idleTimeout = idleTimeout
 }
 
-// StatsJSON returns the pool stats as a JSON object.
-func (cp *Pool) StatsJSON() string {
+// Stats are the stats of the pool.
+type Stats struct {
+	pools.Stats
+	WaiterQueueFull int64
+}
+
+// Stats returns the pool stats, which are all zero if the pool is
+// closed.
+func (cp *Pool) Stats() Stats {
 	p := cp.pool()
 	if p == nil {
+		return Stats{}
+	}
+	return Stats{Stats: p.Stats(), WaiterQueueFull: cp.waiterQueueFull.Get()}
+}
+
+// StatsJSON returns the pool stats as a JSON object.
+func (cp *Pool) StatsJSON() string {
+	if cp.pool() == nil {
 		return "{}"
 	}
-	res := p.StatsJSON()
-	closingBraceIndex := strings.LastIndex(res, "}")
-	if closingBraceIndex == -1 { // unexpected...
-		return res
+	b, err := json.Marshal(cp.Stats())
+	if err != nil {
+		return "{}"
 	}
-	return fmt.Sprintf(`%s, "WaiterQueueFull": %v}`, res[:closingBraceIndex], cp.waiterQueueFull.Get())
+	return string(b)
 }
 
 // Capacity returns the pool capacity.
@@ -334,6 +426,48 @@ func (cp *Pool) IdleClosed() int64 {
 	return p.IdleClosed()
 }
 
+// MaxLifetimeClosed returns the number of connections closed because
+// they exceeded their max lifetime.
+func (cp *Pool) MaxLifetimeClosed() int64 {
+	p := cp.pool()
+	if p == nil {
+		return 0
+	}
+	return p.MaxLifetimeClosed()
+}
+
+// Leaked returns the number of connections that were not returned
+// within the leak threshold.
+func (cp *Pool) Leaked() int64 {
+	p := cp.pool()
+	if p == nil {
+		return 0
+	}
+	return p.Leaked()
+}
+
+func (cp *Pool) handleCheckouts(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.DEBUGGING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	response.Header().Set("Content-Type", "text/plain")
+	p := cp.pool()
+	if p == nil {
+		response.Write([]byte("closed\n"))
+		return
+	}
+	if cp.leakThreshold == 0 {
+		response.Write([]byte("leak detection disabled\n"))
+		return
+	}
+	checkouts := p.Checkouts()
+	response.Write([]byte(fmt.Sprintf("Length: %d\n", len(checkouts))))
+	for _, co := range checkouts {
+		response.Write([]byte(fmt.Sprintf("\nTaken %v ago for %q by:\n%s", time.Since(co.Time).Round(time.Millisecond), co.Purpose, co.Stack)))
+	}
+}
+
 // Exhausted returns the number of times available went to zero for the pool.
 func (cp *Pool) Exhausted() int64 {
 	p := cp.pool()
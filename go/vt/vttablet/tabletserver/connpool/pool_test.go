@@ -17,6 +17,7 @@ limitations under the License.
 package connpool
 
 import (
+	"encoding/json"
 	"runtime"
 	"sync"
 	"testing"
@@ -69,6 +70,101 @@ func TestConnPoolTimeout(t *testing.T) {
 	assert.EqualError(t, err, "resource pool timed out")
 }
 
+func TestConnPoolLeakDetection(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := NewPool(tabletenv.NewEnv(nil, "PoolTest"), "TestPool", tabletenv.ConnPoolConfig{
+		Size:                 2,
+		IdleTimeoutSeconds:   10,
+		LeakThresholdSeconds: 10,
+	})
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+
+	dbConn, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	tainted, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	checkouts := connPool.pool().Checkouts()
+	require.Len(t, checkouts, 2)
+	assert.Contains(t, checkouts[0].Stack, "connpool.TestConnPoolLeakDetection")
+
+	// A connection that doesn't go back to the pool is not tracked
+	// anymore either.
+	tainted.Taint()
+	defer tainted.Close()
+	dbConn.Close()
+	dbConn.Recycle()
+	assert.Empty(t, connPool.pool().Checkouts())
+	assert.Zero(t, connPool.Leaked())
+}
+
+func TestConnPoolHistograms(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := NewPool(tabletenv.NewEnv(nil, "PoolTest"), "TestPool", tabletenv.ConnPoolConfig{
+		Size:                    1,
+		IdleTimeoutSeconds:      10,
+		HistogramBucketsSeconds: []tabletenv.Seconds{0.001, 1},
+	})
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	assert.Equal(t, []int64{int64(time.Millisecond), int64(time.Second)}, connPool.heldHistogram.Cutoffs())
+
+	dbConn, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	dbConn.Recycle()
+	assert.EqualValues(t, 1, connPool.heldHistogram.Count())
+	assert.EqualValues(t, 0, connPool.waitHistogram.Count())
+}
+
+func TestConnPoolFreelist(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := NewPool(tabletenv.NewEnv(nil, "PoolTest"), "TestPool", tabletenv.ConnPoolConfig{
+		Size:     2,
+		Freelist: true,
+	})
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+
+	var conns []*DBConn
+	for i := 0; i < 2; i++ {
+		dbConn, err := connPool.Get(context.Background())
+		require.NoError(t, err)
+		conns = append(conns, dbConn)
+	}
+	assert.EqualValues(t, 0, connPool.Available())
+	for _, dbConn := range conns {
+		dbConn.Recycle()
+	}
+	assert.EqualValues(t, 2, connPool.Available())
+	assert.EqualValues(t, 2, connPool.Active())
+}
+
+func TestConnPoolReusePolicy(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := NewPool(tabletenv.NewEnv(nil, "PoolTest"), "TestPool", tabletenv.ConnPoolConfig{
+		Size:        2,
+		ReusePolicy: "mru",
+	})
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+
+	first, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	second, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	first.Recycle()
+	second.Recycle()
+	// The most recently used connection is handed out.
+	dbConn, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, second, dbConn)
+	dbConn.Recycle()
+}
+
 func TestConnPoolMaxWaiters(t *testing.T) {
 	db := fakesqldb.New(t)
 	defer db.Close()
@@ -191,6 +287,43 @@ func TestConnPoolSetCapacity(t *testing.T) {
 	}
 }
 
+func TestConnPoolSetCapacityAboveMaxCap(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := newPool()
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	dbConn.Recycle()
+
+	// The pool grows beyond the size it was opened with, and keeps its
+	// connection.
+	require.NoError(t, connPool.SetCapacity(200))
+	assert.EqualValues(t, 200, connPool.Capacity())
+	assert.EqualValues(t, 200, connPool.MaxCap())
+	assert.EqualValues(t, 1, connPool.Active())
+}
+
+func TestConnPoolDrain(t *testing.T) {
+	db := fakesqldb.New(t)
+	defer db.Close()
+	connPool := newPool()
+	require.Equal(t, ErrConnPoolClosed, connPool.Drain(context.Background()))
+	connPool.Open(db.ConnParams(), db.ConnParams(), db.ConnParams())
+	defer connPool.Close()
+	dbConn, err := connPool.Get(context.Background())
+	require.NoError(t, err)
+	dbConn.Recycle()
+	assert.EqualValues(t, 1, connPool.Active())
+
+	// The connections are closed, and the pool keeps its capacity.
+	require.NoError(t, connPool.Drain(context.Background()))
+	assert.True(t, dbConn.IsClosed())
+	assert.EqualValues(t, 0, connPool.Active())
+	assert.EqualValues(t, 100, connPool.Capacity())
+}
+
 func TestConnPoolStatJSON(t *testing.T) {
 	db := fakesqldb.New(t)
 	defer db.Close()
@@ -204,6 +337,10 @@ func TestConnPoolStatJSON(t *testing.T) {
 	if statsJSON == "" || statsJSON == "{}" {
 		t.Fatalf("stats json should not be empty")
 	}
+	var stats Stats
+	require.NoError(t, json.Unmarshal([]byte(statsJSON), &stats))
+	assert.Equal(t, connPool.Stats(), stats)
+	assert.EqualValues(t, 100, stats.Capacity)
 }
 
 func TestConnPoolStateWhilePoolIsClosed(t *testing.T) {
@@ -56,7 +56,7 @@ type StatefulConnectionPool struct {
 	// pool is needed because this option can only be set at
 	// connection time.
 	foundRowsPool *connpool.Pool
-	active        *pools.Numbered
+	active        *pools.Numbered[*StatefulConnection]
 	lastID        sync2.AtomicInt64
 }
 
@@ -64,13 +64,20 @@ type StatefulConnectionPool struct {
 func NewStatefulConnPool(env tabletenv.Env) *StatefulConnectionPool {
 	config := env.Config()
 
-	return &StatefulConnectionPool{
+	scp := &StatefulConnectionPool{
 		env:           env,
 		conns:         connpool.NewPool(env, "TransactionPool", config.TxPool),
 		foundRowsPool: connpool.NewPool(env, "FoundRowsPool", config.TxPool),
-		active:        pools.NewNumbered(),
+		active:        pools.NewTypedNumbered[*StatefulConnection](),
 		lastID:        sync2.NewAtomicInt64(time.Now().UnixNano()),
 	}
+	env.Exporter().NewGaugesFuncWithMultiLabels("StatefulConnectionsInUse", "Stateful connections in use, by purpose", []string{"Purpose"}, func() map[string]int64 {
+		return scp.active.Stats().InUse
+	})
+	env.Exporter().NewGaugeDurationFunc("StatefulConnectionsOldestAge", "Age of the oldest stateful connection", func() time.Duration {
+		return scp.active.Stats().OldestAge
+	})
+	return scp
 }
 
 // Open makes the TxPool operational. This also starts the transaction killer
@@ -87,8 +94,9 @@ func (sf *StatefulConnectionPool) Open(appParams, dbaParams, appDebugParams dbco
 
 // Close closes the TxPool. A closed pool can be reopened.
 func (sf *StatefulConnectionPool) Close() {
-	for _, v := range sf.active.GetOutdated(time.Duration(0), "for closing") {
-		conn := v.(*StatefulConnection)
+	// The connections are not expired, so the expire function is not
+	// called for them.
+	for _, conn := range sf.active.GetByFilter("for closing", func(*StatefulConnection) bool { return true }) {
 		thing := "connection"
 		if conn.IsInTransaction() {
 			thing = "transaction"
@@ -107,9 +115,9 @@ func (sf *StatefulConnectionPool) Close() {
 // InUse connections will be killed as they are returned.
 func (sf *StatefulConnectionPool) ShutdownNonTx() {
 	sf.state.Set(scpKillingNonTx)
-	conns := mapToTxConn(sf.active.GetByFilter("kill non-tx", func(sc any) bool {
-		return !sc.(*StatefulConnection).IsInTransaction()
-	}))
+	conns := sf.active.GetByFilter("kill non-tx", func(sc *StatefulConnection) bool {
+		return !sc.IsInTransaction()
+	})
 	for _, sc := range conns {
 		sc.Releasef("kill non-tx")
 	}
@@ -120,9 +128,9 @@ func (sf *StatefulConnectionPool) ShutdownNonTx() {
 // by the caller (TxPool). InUse connections will be killed as they are returned.
 func (sf *StatefulConnectionPool) ShutdownAll() []*StatefulConnection {
 	sf.state.Set(scpKillingAll)
-	return mapToTxConn(sf.active.GetByFilter("kill non-tx", func(sc any) bool {
+	return sf.active.GetByFilter("kill non-tx", func(sc *StatefulConnection) bool {
 		return true
-	}))
+	})
 }
 
 // AdjustLastID adjusts the last transaction id to be at least
@@ -139,15 +147,7 @@ func (sf *StatefulConnectionPool) AdjustLastID(id int64) {
 // It does not return any connections that are in use.
 // TODO(sougou): deprecate.
 func (sf *StatefulConnectionPool) GetOutdated(age time.Duration, purpose string) []*StatefulConnection {
-	return mapToTxConn(sf.active.GetOutdated(age, purpose))
-}
-
-func mapToTxConn(outdated []any) []*StatefulConnection {
-	result := make([]*StatefulConnection, len(outdated))
-	for i, el := range outdated {
-		result[i] = el.(*StatefulConnection)
-	}
-	return result
+	return sf.active.GetOutdated(age, purpose)
 }
 
 // WaitForEmpty returns as soon as the pool becomes empty
@@ -155,15 +155,17 @@ func (sf *StatefulConnectionPool) WaitForEmpty() {
 	sf.active.WaitForEmpty()
 }
 
+// WaitForEmptyCtx is like WaitForEmpty, but it gives up when the context
+// is done, and then returns the ids of the remaining connections.
+func (sf *StatefulConnectionPool) WaitForEmptyCtx(ctx context.Context) ([]tx.ConnID, error) {
+	return sf.active.WaitForEmptyCtx(ctx)
+}
+
 // GetAndLock locks the connection for use. It accepts a purpose as a string.
 // If it cannot be found, it returns a "not found" error. If in use,
 // it returns a "in use: purpose" error.
 func (sf *StatefulConnectionPool) GetAndLock(id int64, reason string) (*StatefulConnection, error) {
-	conn, err := sf.active.Get(id, reason)
-	if err != nil {
-		return nil, err
-	}
-	return conn.(*StatefulConnection), nil
+	return sf.active.Get(id, reason)
 }
 
 // NewConn creates a new StatefulConnection. It will be created from either the normal pool or
@@ -206,12 +208,13 @@ func (sf *StatefulConnectionPool) NewConn(ctx context.Context, options *querypb.
 
 // ForAllTxProperties executes a function an every connection that has a not-nil TxProperties
 func (sf *StatefulConnectionPool) ForAllTxProperties(f func(*tx.Properties)) {
-	for _, connection := range mapToTxConn(sf.active.GetAll()) {
+	sf.active.ForEach(func(connection *StatefulConnection) bool {
 		props := connection.txProps
 		if props != nil {
 			f(props)
 		}
-	}
+		return true
+	})
 }
 
 // Unregister forgets the specified connection.  If the connection is not present, it's ignored.
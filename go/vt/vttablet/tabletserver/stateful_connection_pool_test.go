@@ -110,6 +110,7 @@ func TestStatefulPoolShutdownNonTx(t *testing.T) {
 	// After ShutdownNonTx, conn1 should be closed, but not conn3.
 	pool.ShutdownNonTx()
 	assert.Equal(t, int64(2), pool.active.Size())
+	assert.Equal(t, map[string]int64{"new connection": 1}, pool.active.Stats().InUse)
 	assert.True(t, conn1.IsClosed())
 	assert.False(t, conn3.IsClosed())
 
@@ -26,6 +26,7 @@ import (
 
 	"vitess.io/vitess/go/cache"
 	"vitess.io/vitess/go/flagutil"
+	"vitess.io/vitess/go/pools"
 	"vitess.io/vitess/go/streamlog"
 	"vitess.io/vitess/go/vt/dbconfigs"
 	"vitess.io/vitess/go/vt/log"
@@ -99,6 +100,12 @@ func init() {
 	SecondsVar(&currentConfig.OlapReadPool.TimeoutSeconds, "queryserver-config-stream-pool-timeout", defaultConfig.OlapReadPool.TimeoutSeconds, "query server stream pool timeout (in seconds), it is how long vttablet waits for a connection from the stream pool. If set to 0 (default) then there is no timeout.")
 	SecondsVar(&currentConfig.TxPool.TimeoutSeconds, "queryserver-config-txpool-timeout", defaultConfig.TxPool.TimeoutSeconds, "query server transaction pool timeout, it is how long vttablet waits if tx pool is full")
 	SecondsVar(&currentConfig.OltpReadPool.IdleTimeoutSeconds, "queryserver-config-idle-timeout", defaultConfig.OltpReadPool.IdleTimeoutSeconds, "query server idle timeout (in seconds), vttablet manages various mysql connection pools. This config means if a connection has not been used in given idle timeout, this connection will be removed from pool. This effectively manages number of connection objects and optimize the pool performance.")
+	SecondsVar(&currentConfig.OltpReadPool.MaxLifetimeSeconds, "queryserver-config-pool-conn-max-lifetime", defaultConfig.OltpReadPool.MaxLifetimeSeconds, "query server connection max lifetime (in seconds), vttablet manages various mysql connection pools. This config means if a connection has been open for longer than this, it will be closed and replaced, when it is returned to the pool or while it is unused in the pool. If set to 0 (default) then connections are never closed because of their age.")
+	SecondsVar(&currentConfig.OltpReadPool.LeakThresholdSeconds, "queryserver-config-pool-conn-leak-threshold", defaultConfig.OltpReadPool.LeakThresholdSeconds, "query server connection leak threshold (in seconds), vttablet manages various mysql connection pools. If set, the pools keep track of the connections that are in use, which are listed under /debug/checkouts/<pool name>, and log a warning for those that are not returned within this threshold. If set to 0 (default) then connections are not tracked.")
+	SecondsListVar(&currentConfig.OltpReadPool.HistogramBucketsSeconds, "queryserver-config-pool-histogram-buckets", defaultConfig.OltpReadPool.HistogramBucketsSeconds, "query server connection pool histogram buckets (in seconds), vttablet manages various mysql connection pools. If set, the pools export the distribution of the waits for a connection as <pool name>WaitHistogram, and of the time the connections are held as <pool name>HeldHistogram, in nanoseconds, with these comma-separated upper bounds. If not set (default) then no histogram is exported.")
+	flag.BoolVar(&currentConfig.OltpReadPool.Freelist, "queryserver-config-pool-freelist", defaultConfig.OltpReadPool.Freelist, "query server connection pool freelist, vttablet manages various mysql connection pools. If set, the pools keep their unused connections in a freelist instead of a buffered channel, which is faster. This is experimental.")
+	flag.IntVar(&currentConfig.OltpReadPool.MaxConcurrentDials, "queryserver-config-pool-max-concurrent-dials", defaultConfig.OltpReadPool.MaxConcurrentDials, "query server connection pool max concurrent dials, vttablet manages various mysql connection pools. If set, each pool opens at most this many connections at the same time, so that after a mass disconnect the connections are reopened at a controlled rate. If set to 0 (default) then there is no limit.")
+	flag.StringVar(&currentConfig.OltpReadPool.ReusePolicy, "queryserver-config-pool-reuse-policy", defaultConfig.OltpReadPool.ReusePolicy, "query server connection pool reuse policy, vttablet manages various mysql connection pools. This config is which unused connection a pool hands out: with lru (default), the least recently used one, so all the connections are used and none is closed by the wait_timeout of mysql, with mru, the most recently used one, so fewer connections stay warm and the others are closed by the idle timeout.")
 	flag.IntVar(&currentConfig.OltpReadPool.MaxWaiters, "queryserver-config-query-pool-waiter-cap", defaultConfig.OltpReadPool.MaxWaiters, "query server query pool waiter limit, this is the maximum number of queries that can be queued waiting to get a connection")
 	flag.IntVar(&currentConfig.OlapReadPool.MaxWaiters, "queryserver-config-stream-pool-waiter-cap", defaultConfig.OlapReadPool.MaxWaiters, "query server stream pool waiter limit, this is the maximum number of streaming queries that can be queued waiting to get a connection")
 	flag.IntVar(&currentConfig.TxPool.MaxWaiters, "queryserver-config-txpool-waiter-cap", defaultConfig.TxPool.MaxWaiters, "query server transaction pool waiter limit, this is the maximum number of transactions that can be queued waiting to get a connection")
@@ -160,6 +167,24 @@ func Init() {
 	// TODO(sougou): Make a decision on whether this should be global or per-pool.
 	currentConfig.OlapReadPool.IdleTimeoutSeconds = currentConfig.OltpReadPool.IdleTimeoutSeconds
 	currentConfig.TxPool.IdleTimeoutSeconds = currentConfig.OltpReadPool.IdleTimeoutSeconds
+	// MaxLifetime is inherited the same way.
+	currentConfig.OlapReadPool.MaxLifetimeSeconds = currentConfig.OltpReadPool.MaxLifetimeSeconds
+	currentConfig.TxPool.MaxLifetimeSeconds = currentConfig.OltpReadPool.MaxLifetimeSeconds
+	// So is the leak threshold.
+	currentConfig.OlapReadPool.LeakThresholdSeconds = currentConfig.OltpReadPool.LeakThresholdSeconds
+	currentConfig.TxPool.LeakThresholdSeconds = currentConfig.OltpReadPool.LeakThresholdSeconds
+	// And the histogram buckets.
+	currentConfig.OlapReadPool.HistogramBucketsSeconds = currentConfig.OltpReadPool.HistogramBucketsSeconds
+	currentConfig.TxPool.HistogramBucketsSeconds = currentConfig.OltpReadPool.HistogramBucketsSeconds
+	// And the freelist.
+	currentConfig.OlapReadPool.Freelist = currentConfig.OltpReadPool.Freelist
+	currentConfig.TxPool.Freelist = currentConfig.OltpReadPool.Freelist
+	// And the max concurrent dials.
+	currentConfig.OlapReadPool.MaxConcurrentDials = currentConfig.OltpReadPool.MaxConcurrentDials
+	currentConfig.TxPool.MaxConcurrentDials = currentConfig.OltpReadPool.MaxConcurrentDials
+	// And the reuse policy.
+	currentConfig.OlapReadPool.ReusePolicy = currentConfig.OltpReadPool.ReusePolicy
+	currentConfig.TxPool.ReusePolicy = currentConfig.OltpReadPool.ReusePolicy
 
 	if enableHotRowProtection {
 		if enableHotRowProtectionDryRun {
@@ -283,11 +308,17 @@ type TabletConfig struct {
 
 // ConnPoolConfig contains the config for a conn pool.
 type ConnPoolConfig struct {
-	Size               int     `json:"size,omitempty"`
-	TimeoutSeconds     Seconds `json:"timeoutSeconds,omitempty"`
-	IdleTimeoutSeconds Seconds `json:"idleTimeoutSeconds,omitempty"`
-	PrefillParallelism int     `json:"prefillParallelism,omitempty"`
-	MaxWaiters         int     `json:"maxWaiters,omitempty"`
+	Size                    int       `json:"size,omitempty"`
+	TimeoutSeconds          Seconds   `json:"timeoutSeconds,omitempty"`
+	IdleTimeoutSeconds      Seconds   `json:"idleTimeoutSeconds,omitempty"`
+	MaxLifetimeSeconds      Seconds   `json:"maxLifetimeSeconds,omitempty"`
+	LeakThresholdSeconds    Seconds   `json:"leakThresholdSeconds,omitempty"`
+	PrefillParallelism      int       `json:"prefillParallelism,omitempty"`
+	MaxWaiters              int       `json:"maxWaiters,omitempty"`
+	HistogramBucketsSeconds []Seconds `json:"histogramBucketsSeconds,omitempty"`
+	Freelist                bool      `json:"freelist,omitempty"`
+	MaxConcurrentDials      int       `json:"maxConcurrentDials,omitempty"`
+	ReusePolicy             string    `json:"reusePolicy,omitempty"`
 }
 
 // OltpConfig contains the config for oltp settings.
@@ -384,6 +415,11 @@ func (c *TabletConfig) Verify() error {
 	if v := c.HotRowProtection.MaxConcurrency; v <= 0 {
 		return fmt.Errorf("-hot_row_protection_concurrent_transactions must be > 0 (specified value: %v)", v)
 	}
+	for _, pool := range []ConnPoolConfig{c.OltpReadPool, c.OlapReadPool, c.TxPool} {
+		if _, err := pools.ParseReusePolicy(pool.ReusePolicy); err != nil {
+			return fmt.Errorf("-queryserver-config-pool-reuse-policy must be lru or mru: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -18,6 +18,8 @@ package tabletenv
 
 import (
 	"flag"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,6 +32,42 @@ func SecondsVar(p *Seconds, name string, value Seconds, usage string) {
 	flag.Float64Var((*float64)(p), name, float64(value), usage)
 }
 
+// SecondsListVar defines a flag for a comma-separated list of Seconds.
+func SecondsListVar(p *[]Seconds, name string, value []Seconds, usage string) {
+	*p = value
+	flag.Var((*secondsList)(p), name, usage)
+}
+
+type secondsList []Seconds
+
+func (sl *secondsList) String() string {
+	values := make([]string, 0, len(*sl))
+	for _, s := range *sl {
+		values = append(values, strconv.FormatFloat(float64(s), 'g', -1, 64))
+	}
+	return strings.Join(values, ",")
+}
+
+func (sl *secondsList) Type() string {
+	return "floatSlice"
+}
+
+func (sl *secondsList) Set(value string) error {
+	var list []Seconds
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		s, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		list = append(list, Seconds(s))
+	}
+	*sl = list
+	return nil
+}
+
 // Get converts Seconds to time.Duration
 func (s Seconds) Get() time.Duration {
 	return time.Duration(s * Seconds(1*time.Second))
@@ -51,3 +51,13 @@ func TestSecondsGetSet(t *testing.T) {
 	assert.Equal(t, Seconds(2), val)
 	assert.Equal(t, 2*time.Second, val.Get())
 }
+
+func TestSecondsList(t *testing.T) {
+	var val secondsList
+	require.NoError(t, val.Set("0.001, 0.5,2"))
+	assert.Equal(t, secondsList{0.001, 0.5, 2}, val)
+	assert.Equal(t, "0.001,0.5,2", val.String())
+	require.NoError(t, val.Set(""))
+	assert.Empty(t, val)
+	assert.Error(t, val.Set("1s"))
+}
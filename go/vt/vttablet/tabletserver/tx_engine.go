@@ -44,6 +44,10 @@ import (
 
 type txEngineState int
 
+// stragglerLogInterval is how often the transactions that are not
+// completed are logged while waiting for them on shutdown.
+var stragglerLogInterval = 30 * time.Second
+
 // The TxEngine can be in any of these states
 const (
 	NotServing txEngineState = iota
@@ -354,7 +358,7 @@ func (te *TxEngine) shutdownLocked() {
 		}
 	}()
 	log.Infof("TxEngine - waiting for empty txPool")
-	te.txPool.WaitForEmpty()
+	te.waitForEmptyTxPool()
 	// If the goroutine is still running, signal that it can exit.
 	close(poolEmpty)
 	// Make sure the goroutine has returned.
@@ -368,6 +372,20 @@ func (te *TxEngine) shutdownLocked() {
 	log.Infof("TxEngine - finished shutdownLocked")
 }
 
+// waitForEmptyTxPool waits for the txPool to be empty, and logs the
+// transactions it waits for every stragglerLogInterval.
+func (te *TxEngine) waitForEmptyTxPool() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), stragglerLogInterval)
+		ids, err := te.txPool.WaitForEmptyCtx(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Warningf("TxEngine - still waiting for %d transactions to complete: %v", len(ids), ids)
+	}
+}
+
 // prepareFromRedo replays and prepares the transactions
 // from the redo log, loads previously failed transactions
 // into the reserved list, and adjusts the txPool LastID
@@ -86,6 +86,7 @@ func NewTxPool(env tabletenv.Env, limiter txlimiter.TxLimiter) *TxPool {
 		limiter:            limiter,
 		txStats:            env.Exporter().NewTimings("Transactions", "Transaction stats", "operation"),
 	}
+	axp.scp.active.SetOnExpire(axp.killTransaction)
 	// Careful: conns also exports name+"xxx" vars,
 	// but we know it doesn't export Timeout.
 	env.Exporter().NewGaugeDurationFunc("TransactionTimeout", "Transaction timeout", axp.transactionTimeout.Get)
@@ -120,30 +121,36 @@ func (tp *TxPool) Shutdown(ctx context.Context) {
 	}
 }
 
+// transactionKiller kills the connections that exceeded the transaction
+// timeout, with killTransaction.
 func (tp *TxPool) transactionKiller() {
 	defer tp.env.LogError()
-	for _, conn := range tp.scp.GetOutdated(tp.Timeout(), vterrors.TxKillerRollback) {
-		log.Warningf("killing transaction (exceeded timeout: %v): %s", tp.Timeout(), conn.String(tp.env.Config().SanitizeLogMessages))
-		switch {
-		case conn.IsTainted():
+	tp.scp.GetOutdated(tp.Timeout(), vterrors.TxKillerRollback)
+}
+
+// killTransaction is called for every connection expired by the
+// transaction killer.
+func (tp *TxPool) killTransaction(conn *StatefulConnection, reason string, age time.Duration) {
+	log.Warningf("killing transaction (exceeded timeout: %v, unused for %v): %s", tp.Timeout(), age.Round(time.Millisecond), conn.String(tp.env.Config().SanitizeLogMessages))
+	switch {
+	case conn.IsTainted():
+		conn.Close()
+		tp.env.Stats().KillCounters.Add("ReservedConnection", 1)
+	case conn.IsInTransaction():
+		_, err := conn.Exec(context.Background(), "rollback", 1, false)
+		if err != nil {
 			conn.Close()
-			tp.env.Stats().KillCounters.Add("ReservedConnection", 1)
-		case conn.IsInTransaction():
-			_, err := conn.Exec(context.Background(), "rollback", 1, false)
-			if err != nil {
-				conn.Close()
-			}
-			tp.env.Stats().KillCounters.Add("Transactions", 1)
 		}
-		// For logging, as transaction is killed as the connection is closed.
-		if conn.IsTainted() && conn.IsInTransaction() {
-			tp.env.Stats().KillCounters.Add("Transactions", 1)
-		}
-		if conn.IsInTransaction() {
-			tp.txComplete(conn, tx.TxKill)
-		}
-		conn.Releasef("exceeded timeout: %v", tp.Timeout())
+		tp.env.Stats().KillCounters.Add("Transactions", 1)
+	}
+	// For logging, as transaction is killed as the connection is closed.
+	if conn.IsTainted() && conn.IsInTransaction() {
+		tp.env.Stats().KillCounters.Add("Transactions", 1)
 	}
+	if conn.IsInTransaction() {
+		tp.txComplete(conn, tx.TxKill)
+	}
+	conn.Releasef("exceeded timeout: %v", tp.Timeout())
 }
 
 // WaitForEmpty waits until all active transactions are completed.
@@ -151,6 +158,12 @@ func (tp *TxPool) WaitForEmpty() {
 	tp.scp.WaitForEmpty()
 }
 
+// WaitForEmptyCtx is like WaitForEmpty, but it gives up when the context
+// is done, and then returns the ids of the remaining transactions.
+func (tp *TxPool) WaitForEmptyCtx(ctx context.Context) ([]tx.ConnID, error) {
+	return tp.scp.WaitForEmptyCtx(ctx)
+}
+
 //NewTxProps creates a new TxProperties struct
 func (tp *TxPool) NewTxProps(immediateCaller *querypb.VTGateCallerID, effectiveCaller *vtrpcpb.CallerID, autocommit bool) *tx.Properties {
 	return &tx.Properties{
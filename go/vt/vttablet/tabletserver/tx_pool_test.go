@@ -381,6 +381,26 @@ func TestTxPoolCloseKillsStrayTransactions(t *testing.T) {
 	require.Equal(t, 0, txPool.scp.Capacity())
 }
 
+func TestTxPoolWaitForEmptyCtx(t *testing.T) {
+	_, txPool, _, closer := setup(t)
+	defer closer()
+
+	conn, _, err := txPool.Begin(context.Background(), &querypb.ExecuteOptions{}, false, 0, nil)
+	require.NoError(t, err)
+
+	// The transaction that is not completed is returned.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ids, err := txPool.WaitForEmptyCtx(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Equal(t, []tx.ConnID{conn.ReservedID()}, ids)
+
+	txPool.RollbackAndRelease(context.Background(), conn)
+	ids, err = txPool.WaitForEmptyCtx(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
 func TestTxTimeoutKillsTransactions(t *testing.T) {
 	env := newEnv("TabletServerTest")
 	env.Config().TxPool.Size = 1
@@ -233,6 +233,7 @@ func (wr *Wrangler) updateShardRecords(ctx context.Context, keyspace string, sha
 func (wr *Wrangler) updateFrozenFlag(ctx context.Context, shards []*topo.ShardInfo, value bool) (err error) {
 	for i, si := range shards {
 		updatedShard, err := wr.ts.UpdateShardFields(ctx, si.Keyspace(), si.ShardName(), func(si *topo.ShardInfo) error {
+			si.RemoveExpiredTabletControls(time.Now())
 			tc := si.GetTabletControl(topodatapb.TabletType_PRIMARY)
 			if tc != nil {
 				tc.Frozen = value
@@ -153,15 +153,10 @@ func (wr *Wrangler) DeleteShard(ctx context.Context, keyspace, shard string, rec
 		}
 	}
 
-	// Try to remove the replication graph and serving graph in each cell,
-	// regardless of its existence.
-	for _, cell := range cells {
-		if err := wr.ts.DeleteShardReplication(ctx, cell, keyspace, shard); err != nil && !topo.IsErrType(err, topo.NoNode) {
-			wr.Logger().Warningf("Cannot delete ShardReplication in cell %v for %v/%v: %v", cell, keyspace, shard, err)
-		}
-	}
-
-	return wr.ts.DeleteShard(ctx, keyspace, shard)
+	// Now that the shard has no tablets, mark it as being deleted, so no
+	// new tablet can be registered in it, and remove the replication
+	// graph and the shard record. The mark is cleared if this fails.
+	return wr.ts.DeleteShardWithTombstone(ctx, keyspace, shard, false)
 }
 
 // SourceShardDelete will delete a SourceShard inside a shard, by index.